@@ -1,13 +1,21 @@
 package main
 
 import (
+	"chemical-ledger-backend/config"
 	"chemical-ledger-backend/db"
 	"chemical-ledger-backend/handlers"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/stock"
+	"chemical-ledger-backend/utils"
+	"context"
 	"embed"
+	"errors"
+	"flag"
 	"fmt"
 	"io/fs"
 	"log"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/exec"
@@ -23,38 +31,87 @@ import (
 var frontendFiles embed.FS
 
 func main() {
-	// --- Logging and DB Setup ---
-	if err := os.MkdirAll("./info", 0755); err != nil && !os.IsExist(err) {
-		log.Fatal("failed to create './info' directory", "error", err)
+	// `chemical-ledger promote` turns a standby into the primary instead of starting the application
+	if len(os.Args) > 1 && os.Args[1] == PROMOTE_COMMAND {
+		os.Exit(runPromote(os.Args[2:], os.Stdout))
 	}
-	logFile, err := os.OpenFile("./info/app.log", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
-	if err != nil {
-		log.Fatal("failed to open log file", "error", err)
+
+	// --- Configuration ---
+	// Read from the configuration file, the environment and the command line; a bad one fails the self-test below
+	cfg, err := config.Load(os.Args[1:], os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
 	}
-	defer logFile.Close()
-	logger := slog.New(slog.NewJSONHandler(logFile, &slog.HandlerOptions{Level: slog.LevelInfo}))
-	slog.SetDefault(logger)
 
-	if err := db.SetUpConnection("./info/chemical-ledger.db"); err != nil {
-		slog.Error("failed to set up database connection", "err", err)
-		panic(err)
+	// --- Startup Self-Test, Logging and DB Setup ---
+	// Exits with a code per failed check rather than panicking, so the desktop launcher can say what to fix
+	selfTest := runSelfTest(cfg, err)
+	if selfTest.logFile != nil {
+		defer selfTest.logFile.Close()
+	}
+	selfTest.log()
+	selfTest.print(os.Stdout)
+	if code := selfTest.exitCode(); code != 0 {
+		os.Exit(code)
+	}
+
+	// Checked before anything is written, so a full disk turns the API read-only rather than failing writes halfway
+	utils.StartDiskGuard(cfg.DataDir)
+
+	// A standby only receives the primary's snapshots until it is promoted
+	if utils.ReplicationMode() == utils.REPLICATION_MODE_STANDBY {
+		startStandbyServer(cfg, selfTest.api)
+		return
 	}
-	if err := db.CreateTables(); err != nil {
-		slog.Error("Failed to create tables", "err", err)
+
+	// The startup work and the scheduled jobs run with the same database, clock and IDs as the requests
+	deps := handlers.NewDependencies(db.Conn)
+	if ids := utils.TenantIds(); len(ids) > 0 {
+		tenants, err := db.NewTenants(utils.TenantDir(), ids, utils.TenantMaxOpen())
+		if err != nil {
+			slog.Error("failed to set up the tenants", "err", err)
+			os.Exit(1)
+		}
+		defer tenants.Close()
+		deps.Tenants = tenants
+		slog.Info("hosting tenants", "tenants", len(ids), "dir", utils.TenantDir())
+	}
+	jobs := deps.Context(context.Background())
+
+	// The current stock is kept along with the entries; rebuilding it catches up databases from before it was
+	if err := db.EachDatabase(jobs, func(ctx context.Context) error {
+		compounds, corrected, err := stock.RebuildStockCurrent(ctx)
+		if err == nil && corrected > 0 {
+			slog.Warn("corrected current stock", "tenant", db.TenantFrom(ctx), "compounds", compounds, "corrected", corrected)
+		}
+		return err
+	}); err != nil {
+		slog.Error("failed to rebuild current stock", "err", err)
 		panic(err)
 	}
 
+	if err := utils.StartTracing(context.Background()); err != nil {
+		slog.Error("failed to start tracing, requests are not traced", "error", err)
+	}
+	utils.StartStockBoardExport(jobs)
+	utils.StartUsageMetrics(jobs)
+	utils.StartEntryLock(jobs)
+	utils.StartRoleGrantExpiry(jobs)
+	utils.StartDailyDigest(jobs)
+	utils.StartReplication(jobs)
+
 	// --- Use WaitGroup to manage goroutines ---
 	var wg sync.WaitGroup
 	wg.Add(2) // We are waiting for two servers to start
 
 	// --- Start API and Frontend Servers Concurrently ---
-	go startAPIServer(&wg)      // Run API on :8080
-	go startFrontendServer(&wg) // Run Frontend on :3000
+	go startAPIServer(&wg, cfg, deps, selfTest.api)     // Run API on cfg.ApiAddr
+	go startFrontendServer(&wg, cfg, selfTest.frontend) // Run Frontend on cfg.FrontendAddr
 
 	// --- Open Browser and Wait ---
-	frontendURL := "http://localhost:3000"
-	slog.Info("Application starting...", "frontend_url", frontendURL)
+	frontendURL := cfg.FrontendURL()
+	build := utils.GetBuildInfo()
+	slog.Info("Application starting...", "frontend_url", frontendURL, "commit", build.Commit, "build_date", build.BuildDate, "schema_version", build.SchemaVersion)
 
 	// Wait a moment for servers to initialize before opening the browser
 	time.Sleep(1 * time.Second)
@@ -64,40 +121,255 @@ func main() {
 	wg.Wait()
 }
 
-// startAPIServer sets up and runs the backend API on port 8080.
-func startAPIServer(wg *sync.WaitGroup) {
+// startAPIServer sets up and runs the backend API on the configured address.
+func startAPIServer(wg *sync.WaitGroup, cfg *config.Config, deps handlers.Dependencies, listener net.Listener) {
 	defer wg.Done() // Signal that this goroutine is done when the function exits
 
+	slog.Info("Backend API server starting", "addr", cfg.ApiAddr)
+	if err := http.Serve(listener, newAPIRouter(cfg, deps)); err != nil {
+		slog.Error("Failed to start API server", "err", err)
+		panic(err)
+	}
+}
+
+// newAPIRouter routes the backend API, with the middleware every request goes through.
+func newAPIRouter(cfg *config.Config, deps handlers.Dependencies) http.Handler {
+	r := chi.NewRouter()
+	r.Use(handlers.DependenciesMiddleware(deps))
+	r.Use(handlers.RequestIdMiddleware)
+	r.Use(handlers.TracingMiddleware)
+	r.Use(cors.Handler(corsOptions(cfg)))
+	r.Use(requestLogger())
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			next.ServeHTTP(w, r)
+		})
+	})
+	r.Use(handlers.ResponseEnvelopeMiddleware)
+	r.Use(handlers.RecoverPanicMiddleware)
+
+	// Probes answer without a user, so they work whatever state the users are in, and are not counted as usage
+	probeRoutes(r)
+
+	// Inbound events come from other systems, which sign them rather than send a user, see InsertInboundEventHandler
+	r.Group(func(r chi.Router) {
+		r.Use(handlers.TenantMiddleware)
+		r.Use(handlers.DiskGuardMiddleware)
+		r.Use(handlers.RequestTimeoutMiddleware)
+
+		r.Post("/inbound/{source}", handlers.InsertInboundEventHandler)
+	})
+
+	r.Group(func(r chi.Router) {
+		r.Use(handlers.TenantMiddleware)
+		r.Use(handlers.QuotaWarningMiddleware)
+		r.Use(handlers.EntryLockNoticeMiddleware)
+		r.Use(handlers.DiskGuardMiddleware)
+		r.Use(handlers.RequestTimeoutMiddleware)
+		r.Use(handlers.IdentifyUserMiddleware)
+		r.Use(handlers.UsageMetricsMiddleware)
+		r.Use(handlers.RedactResponseMiddleware)
+
+		// API routes, also served under the legacy prefix for the frontend expecting the legacy envelope
+		apiRoutes(r)
+		handlers.MountProfiler(r)
+		r.Route(handlers.LEGACY_ROUTE_PREFIX, func(r chi.Router) {
+			probeRoutes(r)
+			apiRoutes(r)
+		})
+	})
+	return r
+}
+
+// startStandbyServer serves the endpoints a standby receives snapshots on, in place of the API, on the configured
+// address. The frontend is not served, so nobody records entries on the standby by mistake.
+func startStandbyServer(cfg *config.Config, listener net.Listener) {
 	r := chi.NewRouter()
-	r.Use(cors.Handler(cors.Options{
-		AllowedOrigins: []string{"http://localhost:3000"},
-		AllowedMethods: []string{"GET", "POST", "PUT"},
-	}))
-	r.Use(slogchi.New(slog.Default()))
+	r.Use(handlers.DependenciesMiddleware(handlers.NewDependencies(db.Conn)))
+	r.Use(handlers.RequestIdMiddleware)
+	r.Use(requestLogger())
+	r.Use(handlers.RecoverPanicMiddleware)
 	r.Use(func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("Content-Type", "application/json")
 			next.ServeHTTP(w, r)
 		})
 	})
+	r.Post(utils.REPLICATION_SNAPSHOT_PATH, handlers.InsertReplicationSnapshotHandler)
+	r.Get(utils.REPLICATION_STATUS_PATH, handlers.GetReplicationStatusHandler)
+
+	slog.Info("Standby server starting", "addr", cfg.ApiAddr, "replication_dir", utils.ReplicationDir())
+	fmt.Println("Running as a standby, receiving snapshots on " + cfg.ApiAddr + ". Run `chemical-ledger promote` to take over from the primary.")
+	if err := http.Serve(listener, r); err != nil {
+		slog.Error("Failed to start standby server", "err", err)
+		panic(err)
+	}
+}
+
+// requestLogger logs every request once answered. The request ID is added by the log handler, like on every other
+// line logged for the request, rather than taken from chi's own.
+func requestLogger() func(http.Handler) http.Handler {
+	return slogchi.NewWithConfig(slog.Default(), slogchi.Config{
+		DefaultLevel:     slog.LevelInfo,
+		ClientErrorLevel: slog.LevelWarn,
+		ServerErrorLevel: slog.LevelError,
+	})
+}
+
+// corsOptions lets the configured origins call the API with the configured methods, the headers the API reads and
+// any others configured. With "*" every origin is allowed; the origin is echoed back rather than answered with "*",
+// which browsers refuse along with credentials.
+func corsOptions(cfg *config.Config) cors.Options {
+	options := cors.Options{
+		AllowedOrigins:   cfg.CorsOrigins,
+		AllowedMethods:   cfg.CorsMethods,
+		AllowedHeaders:   append([]string{"Origin", "Accept", "Content-Type", "X-Requested-With", handlers.AUTHORIZATION_HEADER, handlers.USER_ID_HEADER, handlers.TENANT_HEADER, handlers.RESPONSE_ENVELOPE_HEADER, httpx.REQUEST_ID_HEADER, "traceparent", "tracestate"}, cfg.CorsHeaders...),
+		ExposedHeaders:   []string{httpx.REQUEST_ID_HEADER, handlers.QUOTA_WARNING_HEADER, handlers.ENTRY_LOCK_NOTICE_HEADER, handlers.DISK_SPACE_WARNING_HEADER},
+		AllowCredentials: cfg.CorsCredentials,
+	}
+	if cfg.AllowsAnyOrigin() {
+		options.AllowedOrigins = nil
+		options.AllowOriginFunc = func(r *http.Request, origin string) bool { return true }
+	}
+	return options
+}
+
+// probeRoutes registers the endpoints the desktop launcher and orchestrators check the backend with.
+func probeRoutes(r chi.Router) {
+	r.Get("/healthz", handlers.GetHealthzHandler)
+	r.Get("/readyz", handlers.GetReadyzHandler)
+	r.Get("/version", handlers.GetVersionHandler)
+}
+
+// apiRoutes registers the API endpoints on the given router.
+func apiRoutes(r chi.Router) {
+	// Routes going through the whole ledger get longer than the others; event streams stay open while followed
+	long := handlers.RequestTimeout(utils.LongRequestTimeout())
+	untimed := handlers.RequestTimeout(0)
 
-	// API routes
 	r.Post("/insert-compound", handlers.InsertCompoundHandler)
 	r.Get("/get-compound", handlers.GetCompoundHandler)
+	r.Get("/search-compound", handlers.SearchCompoundHandler)
+	r.Get("/units", handlers.GetUnitsHandler)
 	r.Put("/update-compound", handlers.UpdateCompoundHandler)
+	r.With(handlers.RequireRoles(utils.ROLE_ADMIN, utils.ROLE_SUPERVISOR)).Delete("/delete-compound", handlers.DeleteCompoundHandler)
+	r.With(handlers.RequireRoles(utils.ROLE_ADMIN, utils.ROLE_SUPERVISOR)).Post("/merge-compound", handlers.MergeCompoundHandler)
+	r.With(handlers.RequireRoles(utils.ROLE_ADMIN, utils.ROLE_SUPERVISOR), long).Post("/import-compound-catalog", handlers.ImportCompoundCatalogHandler)
+	r.With(handlers.RequireRoles(utils.ROLE_ADMIN, utils.ROLE_SUPERVISOR, utils.ROLE_OPERATOR)).Post("/compound/{id}/sds", handlers.InsertCompoundSdsHandler)
+	r.Get("/compound/{id}/sds", handlers.GetCompoundSdsHandler)
+	r.Get("/compound/{id}/attachments", handlers.GetCompoundAttachmentsHandler)
 	r.Post("/insert-entry", handlers.InsertEntryHandler)
 	r.Get("/get-entry", handlers.GetEntryHandler)
 	r.Put("/update-entry", handlers.UpdateEntryHandler)
-
-	slog.Info("Backend API server starting on :8080")
-	if err := http.ListenAndServe(":8080", r); err != nil {
-		slog.Error("Failed to start API server", "err", err)
-		panic(err)
-	}
+	r.Patch("/update-entry", handlers.PatchEntryHandler)
+	r.Get("/entry/{id}/history", handlers.GetEntryHistoryHandler)
+	r.Get("/timeline", handlers.GetEntryTimelineHandler)
+	r.Post("/entry/{id}/revert/{version}", handlers.RevertEntryHandler)
+	r.With(handlers.RequireRoles(utils.ROLE_ADMIN, utils.ROLE_SUPERVISOR, utils.ROLE_OPERATOR)).Post("/entry/{id}/attachments", handlers.InsertEntryAttachmentHandler)
+	r.Get("/entry/{id}/attachments", handlers.GetEntryAttachmentsHandler)
+	r.Get("/entry/{id}/attachments/{attachment_id}", handlers.GetEntryAttachmentHandler)
+	r.With(handlers.RequireRoles(utils.ROLE_ADMIN, utils.ROLE_SUPERVISOR)).Delete("/entry/{id}/attachments/{attachment_id}", handlers.DeleteEntryAttachmentHandler)
+	r.With(long).Post("/import-entries", handlers.ImportEntriesHandler)
+	r.With(long).Post("/paste-entries", handlers.PasteEntriesHandler)
+	r.With(handlers.RequireRoles(utils.ROLE_ADMIN), long).Post("/admin/imports/{id}/rollback", handlers.RollbackImportHandler)
+	r.With(handlers.RequireRoles(utils.ROLE_ADMIN)).Get("/admin/item-mappings/{source}", handlers.GetItemMappingsHandler)
+	r.With(handlers.RequireRoles(utils.ROLE_ADMIN)).Put("/admin/item-mappings/{source}", handlers.UpdateItemMappingsHandler)
+	r.With(handlers.RequireRoles(utils.ROLE_ADMIN)).Delete("/admin/item-mappings/{source}/{item_code}", handlers.DeleteItemMappingHandler)
+	r.Post("/approve-entry", handlers.ApproveEntryHandler)
+	r.Post("/reject-entry", handlers.RejectEntryHandler)
+	r.With(handlers.RequireRoles(utils.ROLE_ADMIN, utils.ROLE_SUPERVISOR)).Delete("/delete-entry", handlers.DeleteEntryHandler)
+	r.With(handlers.RequireRoles(utils.ROLE_ADMIN, utils.ROLE_SUPERVISOR)).Get("/trash", handlers.GetTrashHandler)
+	r.With(handlers.RequireRoles(utils.ROLE_ADMIN, utils.ROLE_SUPERVISOR)).Post("/restore", handlers.RestoreEntryHandler)
+	r.With(handlers.RequireRoles(utils.ROLE_ADMIN), long).Post("/admin/renumber-vouchers", handlers.RenumberVouchersHandler)
+	r.With(handlers.RequireRoles(utils.ROLE_ADMIN, utils.ROLE_SUPERVISOR, utils.ROLE_AUDITOR)).Get("/duplicates", handlers.GetDuplicatesHandler)
+	r.With(handlers.RequireRoles(utils.ROLE_ADMIN), long).Post("/admin/rebuild-stock", handlers.RebuildStockHandler)
+	r.With(handlers.RequireRoles(utils.ROLE_ADMIN)).Post("/admin/recalculate-stock", handlers.RecalculateStockHandler)
+	r.With(handlers.RequireRoles(utils.ROLE_ADMIN), long).Get("/admin/validate-ledger", handlers.ValidateLedgerHandler)
+	r.With(handlers.RequireRoles(utils.ROLE_ADMIN), untimed).Get("/admin/operations/{id}/events", handlers.GetOperationEventsHandler)
+	r.With(handlers.RequireRoles(utils.ROLE_ADMIN), untimed).Get("/admin/operations/{id}/poll", handlers.GetOperationPollHandler)
+	r.Get("/lots", handlers.GetLotsHandler)
+	r.Get("/lots/suggest", handlers.GetLotSuggestionHandler)
+	r.Post("/labels/print", handlers.PrintLabelsHandler)
+	r.Get("/quota", handlers.GetQuotaHandler)
+	r.Get("/entry-lock", handlers.GetEntryLockHandler)
+	r.With(handlers.RequireRoles(utils.ROLE_ADMIN)).Post("/admin/unlock-entries", handlers.UnlockEntriesHandler)
+	r.Post("/insert-supplier", handlers.InsertSupplierHandler)
+	r.Get("/get-supplier", handlers.GetSupplierHandler)
+	r.Put("/update-supplier", handlers.UpdateSupplierHandler)
+	r.Delete("/delete-supplier", handlers.DeleteSupplierHandler)
+	r.Get("/report/purchases", handlers.GetPurchaseReportHandler)
+	r.With(handlers.RequireRoles(utils.ROLE_ADMIN, utils.ROLE_SUPERVISOR)).Post("/insert-purchase-order", handlers.InsertPurchaseOrderHandler)
+	r.Get("/get-purchase-order", handlers.GetPurchaseOrderHandler)
+	r.With(handlers.RequireRoles(utils.ROLE_ADMIN, utils.ROLE_SUPERVISOR)).Post("/cancel-purchase-order", handlers.CancelPurchaseOrderHandler)
+	r.With(handlers.RequireRoles(utils.ROLE_ADMIN, utils.ROLE_SUPERVISOR)).Post("/insert-invoice", handlers.InsertInvoiceHandler)
+	r.With(handlers.RequireRoles(utils.ROLE_ADMIN, utils.ROLE_SUPERVISOR, utils.ROLE_AUDITOR)).Get("/get-invoice", handlers.GetInvoiceHandler)
+	r.With(handlers.RequireRoles(utils.ROLE_ADMIN, utils.ROLE_SUPERVISOR)).Delete("/delete-invoice", handlers.DeleteInvoiceHandler)
+	r.Post("/insert-reservation", handlers.InsertReservationHandler)
+	r.Get("/get-reservation", handlers.GetReservationHandler)
+	r.Delete("/delete-reservation", handlers.DeleteReservationHandler)
+	r.Post("/insert-recipient", handlers.InsertRecipientHandler)
+	r.Get("/get-recipient", handlers.GetRecipientHandler)
+	r.Put("/update-recipient", handlers.UpdateRecipientHandler)
+	r.Delete("/delete-recipient", handlers.DeleteRecipientHandler)
+	r.Post("/insert-instrument", handlers.InsertInstrumentHandler)
+	r.Get("/get-instrument", handlers.GetInstrumentHandler)
+	r.Put("/update-instrument", handlers.UpdateInstrumentHandler)
+	r.Delete("/delete-instrument", handlers.DeleteInstrumentHandler)
+	r.Post("/insert-location", handlers.InsertLocationHandler)
+	r.Get("/get-location", handlers.GetLocationHandler)
+	r.Put("/update-location", handlers.UpdateLocationHandler)
+	r.Delete("/delete-location", handlers.DeleteLocationHandler)
+	r.Post("/insert-project", handlers.InsertProjectHandler)
+	r.Get("/get-project", handlers.GetProjectHandler)
+	r.Put("/update-project", handlers.UpdateProjectHandler)
+	r.Delete("/delete-project", handlers.DeleteProjectHandler)
+	r.Get("/report/department-consumption", handlers.GetDepartmentReportHandler)
+	r.Get("/report/instrument-consumption", handlers.GetInstrumentReportHandler)
+	r.Get("/report/project-consumption", handlers.GetProjectReportHandler)
+	r.Get("/report/summary", handlers.GetSummaryReportHandler)
+	r.Get("/report/timeseries", handlers.GetTimeseriesReportHandler)
+	r.Get("/report/statement", handlers.GetStatementReportHandler)
+	r.With(handlers.RequireRoles(utils.ROLE_ADMIN, utils.ROLE_SUPERVISOR, utils.ROLE_AUDITOR)).Get("/report/chain-of-custody", handlers.GetCustodyReportHandler)
+	r.With(handlers.RequireRoles(utils.ROLE_ADMIN, utils.ROLE_SUPERVISOR, utils.ROLE_AUDITOR)).Get("/report/valuation", handlers.GetValuationReportHandler)
+	r.With(handlers.RequireRoles(utils.ROLE_ADMIN, utils.ROLE_SUPERVISOR, utils.ROLE_AUDITOR)).Get("/report/invoice-reconciliation", handlers.GetInvoiceReconciliationReportHandler)
+	r.Get("/report/shrinkage", handlers.GetShrinkageReportHandler)
+	r.Get("/report/consumption", handlers.GetConsumptionReportHandler)
+	r.Get("/report/top-consumers", handlers.GetTopConsumersReportHandler)
+	r.Get("/report/slow-movers", handlers.GetSlowMoversReportHandler)
+	r.Get("/report/disposals", handlers.GetDisposalReportHandler)
+	r.With(handlers.RequireRoles(utils.ROLE_ADMIN, utils.ROLE_SUPERVISOR, utils.ROLE_AUDITOR)).Get("/reports/daily/{date}", handlers.GetDailyDigestHandler)
+	r.With(long).Get("/export/ledger", handlers.GetLedgerArchiveHandler)
+	r.With(long).Get("/export/compound-catalog", handlers.GetCompoundCatalogHandler)
+	r.Get("/stock", handlers.GetStockHandler)
+	r.Post("/stock-take", handlers.InsertStockTakeHandler)
+	r.Get("/stock-take", handlers.GetStockTakeHandler)
+	r.Post("/stock-take/count", handlers.InsertStockTakeCountHandler)
+	r.With(handlers.RequireRoles(utils.ROLE_ADMIN, utils.ROLE_SUPERVISOR)).Post("/stock-take/approve", handlers.ApproveStockTakeHandler)
+	r.Get("/dashboard", handlers.GetDashboardHandler)
+	r.Post("/share", handlers.InsertSharedViewHandler)
+	r.Get("/share/{token}", handlers.GetSharedViewHandler)
+	r.With(handlers.RequireRoles(utils.ROLE_ADMIN)).Get("/admin/diagnostics", handlers.GetDiagnosticsHandler)
+	r.With(handlers.RequireRoles(utils.ROLE_ADMIN)).Get("/admin/usage", handlers.GetUsageHandler)
+	r.With(handlers.RequireRoles(utils.ROLE_ADMIN)).Post("/admin/sql", handlers.RunSqlQueryHandler)
+	r.Get("/me", handlers.GetCurrentUserHandler)
+	r.With(handlers.RequireRoles(utils.ROLE_ADMIN)).Get("/get-user", handlers.GetUserHandler)
+	r.With(handlers.RequireRoles(utils.ROLE_ADMIN)).Post("/insert-user", handlers.InsertUserHandler)
+	r.With(handlers.RequireRoles(utils.ROLE_ADMIN)).Put("/update-user", handlers.UpdateUserHandler)
+	r.Post("/insert-delegation", handlers.InsertDelegationHandler)
+	r.Get("/get-delegation", handlers.GetDelegationHandler)
+	r.Delete("/delete-delegation", handlers.DeleteDelegationHandler)
+	r.With(handlers.RequireRoles(utils.ROLE_ADMIN)).Post("/insert-role-grant", handlers.InsertRoleGrantHandler)
+	r.Get("/get-role-grant", handlers.GetRoleGrantHandler)
+	r.With(handlers.RequireRoles(utils.ROLE_ADMIN)).Delete("/delete-role-grant", handlers.DeleteRoleGrantHandler)
+	r.With(handlers.RequireRoles(utils.ROLE_ADMIN)).Post("/insert-user-token", handlers.InsertUserTokenHandler)
+	r.With(handlers.RequireRoles(utils.ROLE_ADMIN)).Get("/get-user-token", handlers.GetUserTokenHandler)
+	r.With(handlers.RequireRoles(utils.ROLE_ADMIN)).Delete("/delete-user-token", handlers.DeleteUserTokenHandler)
+	r.With(handlers.RequireRoles(utils.ROLE_ADMIN, utils.ROLE_AUDITOR)).Get("/audit-log", handlers.GetAuditLogHandler)
 }
 
-// startFrontendServer serves the embedded frontend files on port 3000.
-func startFrontendServer(wg *sync.WaitGroup) {
+// startFrontendServer serves the embedded frontend files on the configured address.
+func startFrontendServer(wg *sync.WaitGroup, cfg *config.Config, listener net.Listener) {
 	defer wg.Done() // Signal that this goroutine is done when the function exits
 
 	subFS, err := fs.Sub(frontendFiles, "frontend")
@@ -108,8 +380,8 @@ func startFrontendServer(wg *sync.WaitGroup) {
 	mux := http.NewServeMux()
 	mux.Handle("/", http.FileServer(http.FS(subFS)))
 
-	slog.Info("Frontend server starting on :3000")
-	if err := http.ListenAndServe(":3000", mux); err != nil {
+	slog.Info("Frontend server starting", "addr", cfg.FrontendAddr)
+	if err := http.Serve(listener, mux); err != nil {
 		slog.Error("Failed to start frontend server", "err", err)
 		panic(err)
 	}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"chemical-ledger-backend/config"
+	"chemical-ledger-backend/handlers"
+	"chemical-ledger-backend/testutils"
+	"chemical-ledger-backend/utils"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Signed inbound events are taken from other machines without a user, while the rest of the API still wants one
+func TestRemoteInboundEventPassesTheRouter(t *testing.T) {
+	t.Setenv("INBOUND_SECRET_PROCUREMENT", "s3cret")
+	conn := testutils.NewTestDB(t)
+	testutils.InsertCompoundIn(t, conn, "C_1", "Acetone", "ml")
+	if _, err := conn.Exec(
+		"INSERT INTO item_mapping (source, item_code, compound_id, unit, quantity_per_unit, updated_by, updated_at) VALUES ('procurement', 'ACE-2L5', 'C_1', 'l', 2, ?, 0)",
+		utils.LOCAL_USER_ID,
+	); err != nil {
+		t.Fatal(err)
+	}
+	router := newAPIRouter(&config.Config{}, handlers.NewDependencies(conn))
+
+	body := `{"schema_version": 1, "event_id": "GRN-7", "event_type": "goods_received", "date": "2026-03-14", "items": [{"item_code": "ACE-2L5", "quantity": 3}]}`
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write([]byte(body))
+	req := httptest.NewRequest(http.MethodPost, "/inbound/procurement", strings.NewReader(body))
+	req.RemoteAddr = "203.0.113.5:41234"
+	req.Header.Set(utils.INBOUND_SIGNATURE_HEADER, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"duplicate":false`) {
+		t.Fatalf("remote signed event: status %d, %s", w.Code, w.Body)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/get-compound", nil)
+	req.RemoteAddr = "203.0.113.5:41234"
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("remote request without a user: status %d, %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,377 @@
+// Package config holds the settings the application is started with: where it keeps its data, the addresses it
+// serves on, the origins allowed to call the API, the time zone and the trial limits. Each is read from the
+// configuration file, then from the environment and then from the command line, each overriding the one before.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// File read when neither -config nor CONFIG_FILE names one, skipped when it does not exist
+const DEFAULT_CONFIG_FILE = "./chemical-ledger.toml"
+
+type Config struct {
+	// File the settings were read from, empty when there was none
+	File string
+
+	DataDir string
+	DbPath  string
+	LogPath string
+
+	ApiAddr      string
+	FrontendAddr string
+	// Origins allowed to call the API from a browser, the frontend's own unless set. They may hold one wildcard, as in
+	// https://*.lab.example, and "*" allows every origin, for development.
+	CorsOrigins []string
+	CorsMethods []string
+	// Request headers allowed besides those the API reads itself
+	CorsHeaders []string
+	// Whether browsers may send cookies and authorization headers along
+	CorsCredentials bool
+
+	// Zone entries are dated in, the system's unless set
+	Timezone string
+
+	TrialEntryLimit    int
+	TrialCompoundLimit int
+	TrialUserLimit     int
+
+	// Other environment settings given in the [env] table of the file, e.g. DUPLICATE_VOUCHER_CHECK
+	Env map[string]string
+}
+
+// A setting of Config, with the key it has in the file, its environment variable and its flag
+type setting struct {
+	key   string
+	env   string
+	flag  string
+	usage string
+	set   func(c *Config, value string) error
+}
+
+var settings = []setting{
+	{"data_dir", "DATA_DIR", "data-dir", "folder the database, log and attachments are kept in", setString(func(c *Config) *string { return &c.DataDir })},
+	{"db_path", "DB_PATH", "db-path", "database file, chemical-ledger.db in the data folder unless set", setString(func(c *Config) *string { return &c.DbPath })},
+	{"log_path", "LOG_PATH", "log-path", "log file, app.log in the data folder unless set", setString(func(c *Config) *string { return &c.LogPath })},
+	{"api_addr", "API_ADDR", "api-addr", "address the API is served on", setString(func(c *Config) *string { return &c.ApiAddr })},
+	{"frontend_addr", "FRONTEND_ADDR", "frontend-addr", "address the frontend is served on", setString(func(c *Config) *string { return &c.FrontendAddr })},
+	{"cors_origins", "CORS_ORIGINS", "cors-origins", "comma-separated origins allowed to call the API, * for any", setList(func(c *Config) *[]string { return &c.CorsOrigins })},
+	{"cors_methods", "CORS_METHODS", "cors-methods", "comma-separated methods allowed to call the API with", setList(func(c *Config) *[]string { return &c.CorsMethods })},
+	{"cors_headers", "CORS_HEADERS", "cors-headers", "comma-separated request headers allowed besides the API's own", setList(func(c *Config) *[]string { return &c.CorsHeaders })},
+	{"cors_credentials", "CORS_ALLOW_CREDENTIALS", "cors-credentials", "whether browsers may send credentials to the API", setBool(func(c *Config) *bool { return &c.CorsCredentials })},
+	{"timezone", "TZ", "tz", "time zone entries are dated in, e.g. Asia/Kolkata", setString(func(c *Config) *string { return &c.Timezone })},
+	{"trial_entry_limit", "TRIAL_ENTRY_LIMIT", "trial-entry-limit", "most entries that can be recorded, 0 for no limit", setInt(func(c *Config) *int { return &c.TrialEntryLimit })},
+	{"trial_compound_limit", "TRIAL_COMPOUND_LIMIT", "trial-compound-limit", "most compounds that can be added, 0 for no limit", setInt(func(c *Config) *int { return &c.TrialCompoundLimit })},
+	{"trial_user_limit", "TRIAL_USER_LIMIT", "trial-user-limit", "most active users, 0 for no limit", setInt(func(c *Config) *int { return &c.TrialUserLimit })},
+}
+
+func setString(field func(c *Config) *string) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		*field(c) = value
+		return nil
+	}
+}
+
+func setList(field func(c *Config) *[]string) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		list := []string{}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		*field(c) = list
+		return nil
+	}
+}
+
+func setBool(field func(c *Config) *bool) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q is not true or false", value)
+		}
+		*field(c) = b
+		return nil
+	}
+}
+
+func setInt(field func(c *Config) *int) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		num, err := strconv.Atoi(value)
+		if err != nil || num < 0 {
+			return fmt.Errorf("%q is not a whole number of at least 0", value)
+		}
+		*field(c) = num
+		return nil
+	}
+}
+
+func defaults() *Config {
+	return &Config{
+		DataDir:      "./info",
+		ApiAddr:      ":8080",
+		FrontendAddr: ":3000",
+		CorsMethods:  []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
+		Env:          map[string]string{},
+	}
+}
+
+// Loads the settings from the configuration file, the environment and the command line arguments, in that order.
+// The file is the one named by -config or CONFIG_FILE, or DEFAULT_CONFIG_FILE when it exists. Returns flag.ErrHelp
+// when the arguments ask for the usage, which is written to output.
+func Load(args []string, output io.Writer) (*Config, error) {
+	c := defaults()
+
+	flags := flag.NewFlagSet("chemical-ledger", flag.ContinueOnError)
+	flags.SetOutput(output)
+	file := flags.String("config", "", "configuration file, "+DEFAULT_CONFIG_FILE+" when it exists")
+	values := map[string]*string{}
+	for _, s := range settings {
+		values[s.flag] = flags.String(s.flag, "", s.usage+" (env "+s.env+")")
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if flags.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected argument %q", flags.Arg(0))
+	}
+
+	c.File = *file
+	if c.File == "" {
+		c.File = os.Getenv("CONFIG_FILE")
+	}
+	if c.File == "" {
+		if _, err := os.Stat(DEFAULT_CONFIG_FILE); err == nil {
+			c.File = DEFAULT_CONFIG_FILE
+		}
+	}
+	if c.File != "" {
+		if err := c.readFile(c.File); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, s := range settings {
+		value := os.Getenv(s.env)
+		if s.env == "TZ" {
+			// TZ may start with a colon, as in ":Asia/Kolkata"
+			value = strings.TrimPrefix(value, ":")
+		}
+		if value != "" {
+			if err := s.set(c, value); err != nil {
+				return nil, fmt.Errorf("%s: %w", s.env, err)
+			}
+		}
+	}
+
+	// Only the flags given override, so an empty default does not clear the settings read before
+	var flagErr error
+	flags.Visit(func(f *flag.Flag) {
+		for _, s := range settings {
+			if s.flag == f.Name && flagErr == nil {
+				if err := s.set(c, *values[s.flag]); err != nil {
+					flagErr = fmt.Errorf("-%s: %w", s.flag, err)
+				}
+			}
+		}
+	})
+	if flagErr != nil {
+		return nil, flagErr
+	}
+
+	if c.DbPath == "" {
+		c.DbPath = filepath.Join(c.DataDir, "chemical-ledger.db")
+	}
+	if c.LogPath == "" {
+		c.LogPath = filepath.Join(c.DataDir, "app.log")
+	}
+	if len(c.CorsOrigins) == 0 {
+		c.CorsOrigins = []string{c.FrontendURL()}
+	}
+	return c, nil
+}
+
+// Reads the settings in the given file, which are written as a TOML table: one `key = value` per line, strings in
+// quotes, and the environment settings under [env]
+func (c *Config) readFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	table := ""
+	for i, line := range strings.Split(string(data), "\n") {
+		lineErr := func(format string, args ...any) error {
+			return fmt.Errorf("%s:%d: %s", path, i+1, fmt.Sprintf(format, args...))
+		}
+
+		line = strings.TrimSpace(stripComment(line))
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			table = strings.TrimSpace(strings.Trim(line, "[]"))
+			if table != "env" {
+				return lineErr("unknown table [%s]", table)
+			}
+			continue
+		}
+
+		key, raw, found := strings.Cut(line, "=")
+		if !found {
+			return lineErr("expected key = value")
+		}
+		key = strings.TrimSpace(key)
+		value, err := parseValue(strings.TrimSpace(raw))
+		if err != nil {
+			return lineErr("%s: %v", key, err)
+		}
+
+		if table == "env" {
+			c.Env[key] = value
+			continue
+		}
+		s, ok := settingByKey(key)
+		if !ok {
+			return lineErr("unknown setting %q", key)
+		}
+		if err := s.set(c, value); err != nil {
+			return lineErr("%s: %v", key, err)
+		}
+	}
+	return nil
+}
+
+func settingByKey(key string) (setting, bool) {
+	for _, s := range settings {
+		if s.key == key {
+			return s, true
+		}
+	}
+	return setting{}, false
+}
+
+// Cuts off a # comment, leaving those inside quoted strings
+func stripComment(line string) string {
+	var quote rune
+	for i, r := range line {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote == 0 && (r == '"' || r == '\''):
+			quote = r
+		case quote == 0 && r == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// Reads a value as the setting it is given for: strings, numbers and booleans as they are written, and arrays of
+// strings joined with commas
+func parseValue(raw string) (string, error) {
+	switch {
+	case raw == "":
+		return "", errors.New("missing value")
+	case strings.HasPrefix(raw, "["):
+		if !strings.HasSuffix(raw, "]") {
+			return "", errors.New("arrays must be written on one line")
+		}
+		items := []string{}
+		for _, item := range strings.Split(strings.TrimSuffix(strings.TrimPrefix(raw, "["), "]"), ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			value, err := parseValue(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, value)
+		}
+		return strings.Join(items, ","), nil
+	case strings.HasPrefix(raw, `"`):
+		return strconv.Unquote(raw)
+	case strings.HasPrefix(raw, "'"):
+		if len(raw) < 2 || !strings.HasSuffix(raw, "'") {
+			return "", fmt.Errorf("unterminated string %s", raw)
+		}
+		return raw[1 : len(raw)-1], nil
+	default:
+		return raw, nil
+	}
+}
+
+// Makes the settings read through the environment follow the configuration: the time zone, the trial limits and the
+// [env] table, which does not override variables already set. The attachments, the replication snapshots and the
+// databases of the tenants go into the data folder unless ATTACHMENTS_DIR, REPLICATION_DIR or TENANT_DIR say otherwise.
+func (c *Config) Apply() error {
+	for name, value := range c.Env {
+		if _, ok := os.LookupEnv(name); !ok {
+			if err := os.Setenv(name, value); err != nil {
+				return err
+			}
+		}
+	}
+	dirs := map[string]string{
+		"ATTACHMENTS_DIR": filepath.Join(c.DataDir, "attachments"),
+		"REPLICATION_DIR": filepath.Join(c.DataDir, "replication"),
+		"TENANT_DIR":      filepath.Join(c.DataDir, "tenants"),
+	}
+	for name, dir := range dirs {
+		if _, ok := os.LookupEnv(name); !ok {
+			if err := os.Setenv(name, dir); err != nil {
+				return err
+			}
+		}
+	}
+
+	limits := map[string]int{
+		"TRIAL_ENTRY_LIMIT":    c.TrialEntryLimit,
+		"TRIAL_COMPOUND_LIMIT": c.TrialCompoundLimit,
+		"TRIAL_USER_LIMIT":     c.TrialUserLimit,
+	}
+	for name, limit := range limits {
+		if err := os.Setenv(name, strconv.Itoa(limit)); err != nil {
+			return err
+		}
+	}
+
+	// Go only reads TZ when it starts, so the zone is loaded here; one that cannot be is left to the self-test
+	if c.Timezone != "" {
+		if err := os.Setenv("TZ", c.Timezone); err != nil {
+			return err
+		}
+		if loc, err := time.LoadLocation(c.Timezone); err == nil {
+			time.Local = loc
+		}
+	}
+	return nil
+}
+
+// Whether every origin may call the API, which is only meant for development
+func (c *Config) AllowsAnyOrigin() bool {
+	return slices.Contains(c.CorsOrigins, "*")
+}
+
+// URL the frontend is opened at in the browser
+func (c *Config) FrontendURL() string {
+	host, port, err := net.SplitHostPort(c.FrontendAddr)
+	if err != nil {
+		return "http://" + c.FrontendAddr
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	return "http://" + net.JoinHostPort(host, port)
+}
@@ -0,0 +1,116 @@
+package config_test
+
+import (
+	"chemical-ledger-backend/config"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "chemical-ledger.toml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadOverridesFileWithEnvironmentAndFlags(t *testing.T) {
+	path := writeConfig(t, `
+# Lab server
+data_dir = "/srv/ledger"
+api_addr = ":9090"
+frontend_addr = "0.0.0.0:4000"
+cors_origins = ["https://ledger.lab.example", 'http://10.0.0.5:4000']  # both
+trial_entry_limit = 500
+
+[env]
+DUPLICATE_VOUCHER_CHECK = "warn"
+`)
+	t.Setenv("API_ADDR", ":9191")
+	t.Setenv("TRIAL_ENTRY_LIMIT", "")
+	t.Setenv("TZ", ":Asia/Kolkata")
+
+	cfg, err := config.Load([]string{"-config", path, "-trial-entry-limit", "50"}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.DataDir != "/srv/ledger" || cfg.DbPath != filepath.Join("/srv/ledger", "chemical-ledger.db") || cfg.LogPath != filepath.Join("/srv/ledger", "app.log") {
+		t.Errorf("paths %q, %q, %q", cfg.DataDir, cfg.DbPath, cfg.LogPath)
+	}
+	if cfg.ApiAddr != ":9191" || cfg.FrontendAddr != "0.0.0.0:4000" || cfg.FrontendURL() != "http://localhost:4000" {
+		t.Errorf("addresses %q, %q, %q", cfg.ApiAddr, cfg.FrontendAddr, cfg.FrontendURL())
+	}
+	if !slices.Equal(cfg.CorsOrigins, []string{"https://ledger.lab.example", "http://10.0.0.5:4000"}) {
+		t.Errorf("CORS origins %q", cfg.CorsOrigins)
+	}
+	if cfg.Timezone != "Asia/Kolkata" || cfg.TrialEntryLimit != 50 {
+		t.Errorf("time zone %q, entry limit %d", cfg.Timezone, cfg.TrialEntryLimit)
+	}
+	if cfg.Env["DUPLICATE_VOUCHER_CHECK"] != "warn" {
+		t.Errorf("env table %v", cfg.Env)
+	}
+}
+
+func TestLoadDefaultsWithoutFile(t *testing.T) {
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("API_ADDR", "")
+	t.Chdir(t.TempDir())
+
+	cfg, err := config.Load(nil, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.File != "" || cfg.ApiAddr != ":8080" || !slices.Equal(cfg.CorsOrigins, []string{"http://localhost:3000"}) {
+		t.Errorf("defaults %+v", cfg)
+	}
+}
+
+func TestLoadRejectsInvalidSettings(t *testing.T) {
+	t.Setenv("TRIAL_USER_LIMIT", "")
+	for _, tc := range []struct {
+		file string
+		args []string
+		want string
+	}{
+		{`api_port = 8080`, nil, `:1: unknown setting "api_port"`},
+		{"\n[server]\n", nil, ":2: unknown table [server]"},
+		{`trial_user_limit = -1`, nil, "trial_user_limit"},
+		{`db_path = "unterminated`, nil, "db_path"},
+		{``, []string{"-trial-user-limit", "ten"}, "-trial-user-limit"},
+	} {
+		_, err := config.Load(append([]string{"-config", writeConfig(t, tc.file)}, tc.args...), io.Discard)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%q %q: error %v, want it to mention %s", tc.file, tc.args, err, tc.want)
+		}
+	}
+}
+
+func TestLoadCorsSettings(t *testing.T) {
+	path := writeConfig(t, `
+cors_origins = "*"
+cors_headers = ["Authorization"]
+cors_credentials = true
+`)
+	t.Setenv("CORS_ORIGINS", "")
+	t.Setenv("CORS_METHODS", "GET, POST")
+	t.Setenv("CORS_ALLOW_CREDENTIALS", "")
+
+	cfg, err := config.Load([]string{"-config", path}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.AllowsAnyOrigin() || !cfg.CorsCredentials {
+		t.Errorf("origins %q, credentials %v", cfg.CorsOrigins, cfg.CorsCredentials)
+	}
+	if !slices.Equal(cfg.CorsMethods, []string{"GET", "POST"}) || !slices.Equal(cfg.CorsHeaders, []string{"Authorization"}) {
+		t.Errorf("methods %q, headers %q", cfg.CorsMethods, cfg.CorsHeaders)
+	}
+
+	if _, err := config.Load([]string{"-config", path, "-cors-credentials", "maybe"}, io.Discard); err == nil || !strings.Contains(err.Error(), "-cors-credentials") {
+		t.Errorf("invalid credentials flag: %v", err)
+	}
+}
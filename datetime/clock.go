@@ -0,0 +1,40 @@
+// Package datetime holds the application clock and the conversions between the dates entries are entered with and
+// the Unix times they are stored as.
+package datetime
+
+import (
+	"context"
+	"time"
+)
+
+// Source of the current time for dates, validation and IDs
+type Clock interface {
+	Now() time.Time
+}
+
+// Clock reading the system time
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+type clockKey struct{}
+
+// Context carrying the clock that Now reads for the rest of the request. The server sets it once for every request,
+// tests set a fixed clock of their own, see testutils.NewEnv.
+func WithClock(ctx context.Context, clock Clock) context.Context {
+	return context.WithValue(ctx, clockKey{}, clock)
+}
+
+// Clock carried by the context, the system clock when it carries none
+func ClockFrom(ctx context.Context) Clock {
+	if clock, ok := ctx.Value(clockKey{}).(Clock); ok {
+		return clock
+	}
+	return SystemClock{}
+}
+
+func Now(ctx context.Context) time.Time {
+	return ClockFrom(ctx).Now()
+}
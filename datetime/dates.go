@@ -0,0 +1,40 @@
+package datetime
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Gets the Unix timestamp of the given date with the current time of the clock of the context
+func GetDateUnix(ctx context.Context, date string) int64 {
+	t, _ := time.Parse("2006-01-02", date)
+
+	now := Now(ctx).Local()
+	nowDate := time.Date(t.Year(), t.Month(), t.Day(), now.Hour(), now.Minute(), now.Second(), 0, now.Location())
+
+	return nowDate.Unix()
+}
+
+func MergeDateWithUnixTime(dateStr string, unixTime int64) (int64, error) {
+	// Define IST as +05:30
+	ist := time.FixedZone("IST", 5*60*60+30*60)
+
+	// Parse the date string in IST
+	date, err := time.ParseInLocation("2006-01-02", dateStr, ist)
+	if err != nil {
+		return 0, fmt.Errorf("invalid date format: %w", err)
+	}
+
+	// Convert the Unix timestamp to time.Time in IST
+	t := time.Unix(unixTime, 0).In(ist)
+
+	// Merge the date with the time from the Unix timestamp
+	merged := time.Date(
+		date.Year(), date.Month(), date.Day(),
+		t.Hour(), t.Minute(), t.Second(), t.Nanosecond(),
+		ist,
+	)
+
+	return merged.Unix(), nil
+}
@@ -0,0 +1,25 @@
+package datetime_test
+
+import (
+	"chemical-ledger-backend/datetime"
+	"chemical-ledger-backend/testutils"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestGetDateUnixTakesTimeOfDayFromClock(t *testing.T) {
+	t.Parallel()
+	clock := &testutils.FixedClock{T: time.Date(2026, 3, 14, 9, 30, 15, 0, time.Local)}
+	ctx := datetime.WithClock(context.Background(), clock)
+
+	want := time.Date(2026, 1, 2, 9, 30, 15, 0, time.Local).Unix()
+	if got := datetime.GetDateUnix(ctx, "2026-01-02"); got != want {
+		t.Errorf("GetDateUnix at 09:30:15 gives %d, want %d", got, want)
+	}
+
+	clock.Advance(time.Minute)
+	if got := datetime.GetDateUnix(ctx, "2026-01-02"); got != want+60 {
+		t.Errorf("GetDateUnix a minute later gives %d, want %d", got, want+60)
+	}
+}
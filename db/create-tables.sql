@@ -1,25 +1,423 @@
+CREATE TABLE IF NOT EXISTS unit (
+  name TEXT PRIMARY KEY,
+  kind TEXT NOT NULL CHECK(kind IN ('mass', 'volume')),
+  multiplier INT NOT NULL CHECK(multiplier > 0),
+  divisor INT NOT NULL CHECK(divisor > 0)
+);
+
+INSERT OR IGNORE INTO unit (name, kind, multiplier, divisor) VALUES
+  ('mg', 'mass', 1, 1000),
+  ('g', 'mass', 1, 1),
+  ('kg', 'mass', 1000, 1),
+  ('ml', 'volume', 1, 1),
+  ('l', 'volume', 1000, 1);
+
 CREATE TABLE IF NOT EXISTS compound (
   id TEXT PRIMARY KEY,
   lower_case_name TEXT UNIQUE NOT NULL,
   name TEXT NOT NULL,
-  scale TEXT CHECK(scale IN ('g', 'ml'))
+  scale TEXT REFERENCES unit(name),
+  min_stock INT NOT NULL DEFAULT 0,
+  notes TEXT NOT NULL DEFAULT '',
+  pinned_warning TEXT NOT NULL DEFAULT '',
+  category TEXT NOT NULL DEFAULT '',
+  display_unit TEXT REFERENCES unit(name),
+  archived_at INT,
+  archived_by TEXT REFERENCES user(id),
+  cas_no TEXT NOT NULL DEFAULT '',
+  formula TEXT NOT NULL DEFAULT '',
+  molecular_weight REAL,
+  storage_location TEXT NOT NULL DEFAULT '',
+  controlled INT NOT NULL DEFAULT 0,
+  hazard_class TEXT NOT NULL DEFAULT '',
+  max_incoming INT NOT NULL DEFAULT 0
 );
 
 CREATE TABLE IF NOT EXISTS quantity (
   id TEXT PRIMARY KEY,
   num_of_units INT NOT NULL,
-  quantity_per_unit INT NOT NULL
+  quantity_per_unit INT NOT NULL,
+  packs_per_unit INT NOT NULL DEFAULT 1,
+  partial_quantity INT NOT NULL DEFAULT 0,
+  total_quantity INT GENERATED ALWAYS AS (num_of_units * packs_per_unit * quantity_per_unit + partial_quantity) VIRTUAL
 );
 
 CREATE TABLE IF NOT EXISTS entry (
   id TEXT PRIMARY KEY,
-  type TEXT NOT NULL CHECK(type IN ('incoming', 'outgoing')),
+  type TEXT NOT NULL CHECK(type IN ('incoming', 'outgoing', 'adjustment-in', 'adjustment-out', 'disposal', 'transfer')),
   compound_id TEXT NOT NULL,
   date INT NOT NULL,
   remark TEXT,
   voucher_no TEXT,
   quantity_id TEXT NOT NULL,
   net_stock INT NOT NULL,
+  lot_id TEXT,
+  supplier_id TEXT,
+  recipient_id TEXT,
+  reason TEXT,
+  status TEXT NOT NULL DEFAULT 'approved' CHECK(status IN ('pending', 'approved', 'rejected')),
+  created_by TEXT,
+  reviewed_by TEXT,
+  reviewed_at INT,
+  review_remark TEXT,
+  deleted_at INT,
+  deleted_by TEXT,
+  seq INT,
+  import_batch_id TEXT,
+  instrument_id TEXT,
+  instrument_event TEXT,
+  disposal_method TEXT,
+  disposal_authorized_by TEXT,
+  location_id TEXT,
+  to_location_id TEXT,
+  large_incoming_bound INT,
+  project_id TEXT,
+  unit_cost REAL,
+  po_line_id TEXT,
+  FOREIGN KEY(compound_id) REFERENCES compound(id),
+  FOREIGN KEY(quantity_id) REFERENCES quantity(id),
+  FOREIGN KEY(supplier_id) REFERENCES supplier(id),
+  FOREIGN KEY(recipient_id) REFERENCES recipient(id),
+  FOREIGN KEY(created_by) REFERENCES user(id),
+  FOREIGN KEY(reviewed_by) REFERENCES user(id),
+  FOREIGN KEY(deleted_by) REFERENCES user(id),
+  FOREIGN KEY(import_batch_id) REFERENCES import_batch(id),
+  FOREIGN KEY(instrument_id) REFERENCES instrument(id),
+  FOREIGN KEY(location_id) REFERENCES location(id),
+  FOREIGN KEY(to_location_id) REFERENCES location(id),
+  FOREIGN KEY(project_id) REFERENCES project(id),
+  FOREIGN KEY(po_line_id) REFERENCES purchase_order_line(id)
+);
+
+CREATE TABLE IF NOT EXISTS supplier (
+  id TEXT PRIMARY KEY,
+  lower_case_name TEXT UNIQUE NOT NULL,
+  name TEXT NOT NULL,
+  contact_person TEXT NOT NULL DEFAULT '',
+  phone TEXT NOT NULL DEFAULT '',
+  email TEXT NOT NULL DEFAULT '',
+  address TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS recipient (
+  id TEXT PRIMARY KEY,
+  lower_case_name TEXT UNIQUE NOT NULL,
+  name TEXT NOT NULL,
+  department TEXT NOT NULL DEFAULT '',
+  phone TEXT NOT NULL DEFAULT '',
+  email TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS instrument (
+  id TEXT PRIMARY KEY,
+  lower_case_name TEXT UNIQUE NOT NULL,
+  name TEXT NOT NULL,
+  model TEXT NOT NULL DEFAULT '',
+  serial_no TEXT NOT NULL DEFAULT '',
+  location TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS location (
+  id TEXT PRIMARY KEY,
+  lower_case_name TEXT UNIQUE NOT NULL,
+  name TEXT NOT NULL,
+  description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS project (
+  id TEXT PRIMARY KEY,
+  lower_case_name TEXT UNIQUE NOT NULL,
+  name TEXT NOT NULL,
+  code TEXT NOT NULL DEFAULT '',
+  lead TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS purchase_order (
+  id TEXT PRIMARY KEY,
+  supplier_id TEXT NOT NULL,
+  order_no TEXT NOT NULL DEFAULT '',
+  date TEXT NOT NULL,
+  expected_date TEXT NOT NULL DEFAULT '',
+  remark TEXT NOT NULL DEFAULT '',
+  status TEXT NOT NULL DEFAULT 'open' CHECK(status IN ('open', 'partially_received', 'received', 'cancelled')),
+  created_by TEXT NOT NULL,
+  created_at INT NOT NULL,
+  FOREIGN KEY(supplier_id) REFERENCES supplier(id),
+  FOREIGN KEY(created_by) REFERENCES user(id)
+);
+
+CREATE TABLE IF NOT EXISTS purchase_order_line (
+  id TEXT PRIMARY KEY,
+  purchase_order_id TEXT NOT NULL,
+  compound_id TEXT NOT NULL,
+  quantity INT NOT NULL,
+  received_quantity INT NOT NULL DEFAULT 0,
+  FOREIGN KEY(purchase_order_id) REFERENCES purchase_order(id),
+  FOREIGN KEY(compound_id) REFERENCES compound(id)
+);
+
+CREATE TABLE IF NOT EXISTS reservation (
+  id TEXT PRIMARY KEY,
+  compound_id TEXT NOT NULL,
+  quantity INT NOT NULL,
+  needed_on TEXT NOT NULL,
+  purpose TEXT NOT NULL DEFAULT '',
+  reserved_by TEXT NOT NULL,
+  reserved_at INT NOT NULL,
+  cancelled_by TEXT,
+  cancelled_at INT,
   FOREIGN KEY(compound_id) REFERENCES compound(id),
-  FOREIGN KEY(quantity_id) REFERENCES quantity(id)
-);
\ No newline at end of file
+  FOREIGN KEY(reserved_by) REFERENCES user(id),
+  FOREIGN KEY(cancelled_by) REFERENCES user(id)
+);
+
+CREATE TABLE IF NOT EXISTS invoice (
+  id TEXT PRIMARY KEY,
+  supplier_id TEXT NOT NULL,
+  invoice_no TEXT NOT NULL,
+  date TEXT NOT NULL,
+  remark TEXT NOT NULL DEFAULT '',
+  created_by TEXT NOT NULL,
+  created_at INT NOT NULL,
+  UNIQUE(supplier_id, invoice_no),
+  FOREIGN KEY(supplier_id) REFERENCES supplier(id),
+  FOREIGN KEY(created_by) REFERENCES user(id)
+);
+
+CREATE TABLE IF NOT EXISTS invoice_line (
+  id TEXT PRIMARY KEY,
+  invoice_id TEXT NOT NULL,
+  compound_id TEXT NOT NULL,
+  quantity INT NOT NULL,
+  amount REAL NOT NULL,
+  FOREIGN KEY(invoice_id) REFERENCES invoice(id),
+  FOREIGN KEY(compound_id) REFERENCES compound(id)
+);
+
+CREATE TABLE IF NOT EXISTS lot (
+  id TEXT PRIMARY KEY,
+  compound_id TEXT NOT NULL,
+  entry_id TEXT UNIQUE NOT NULL,
+  lot_no TEXT NOT NULL DEFAULT '',
+  expiry TEXT NOT NULL DEFAULT '',
+  supplier TEXT NOT NULL DEFAULT '',
+  FOREIGN KEY(compound_id) REFERENCES compound(id),
+  FOREIGN KEY(entry_id) REFERENCES entry(id)
+);
+
+CREATE TABLE IF NOT EXISTS lot_consumption (
+  entry_id TEXT NOT NULL,
+  lot_id TEXT NOT NULL,
+  quantity INT NOT NULL,
+  PRIMARY KEY(entry_id, lot_id),
+  FOREIGN KEY(entry_id) REFERENCES entry(id),
+  FOREIGN KEY(lot_id) REFERENCES lot(id)
+);
+
+CREATE TABLE IF NOT EXISTS user (
+  id TEXT PRIMARY KEY,
+  name TEXT NOT NULL,
+  role TEXT NOT NULL CHECK(role IN ('admin', 'supervisor', 'operator', 'technician', 'auditor', 'student')),
+  supervisor_id TEXT,
+  active INT NOT NULL DEFAULT 1,
+  FOREIGN KEY(supervisor_id) REFERENCES user(id)
+);
+
+INSERT OR IGNORE INTO user (id, name, role) VALUES ('U_local', 'Local administrator', 'admin');
+INSERT OR IGNORE INTO user (id, name, role, active) VALUES ('U_inbound', 'Inbound integrations', 'operator', 0);
+
+CREATE TABLE IF NOT EXISTS delegation (
+  id TEXT PRIMARY KEY,
+  delegator_id TEXT NOT NULL,
+  delegate_id TEXT NOT NULL,
+  from_date TEXT NOT NULL,
+  to_date TEXT NOT NULL,
+  reason TEXT NOT NULL DEFAULT '',
+  revoked INT NOT NULL DEFAULT 0,
+  created_at INT NOT NULL,
+  FOREIGN KEY(delegator_id) REFERENCES user(id),
+  FOREIGN KEY(delegate_id) REFERENCES user(id)
+);
+
+CREATE TABLE IF NOT EXISTS role_grant (
+  id TEXT PRIMARY KEY,
+  user_id TEXT NOT NULL,
+  role TEXT NOT NULL CHECK(role IN ('admin', 'supervisor', 'operator', 'technician', 'auditor', 'student')),
+  reason TEXT NOT NULL,
+  granted_by TEXT NOT NULL,
+  granted_at INT NOT NULL,
+  expires_at INT NOT NULL,
+  revoked_by TEXT,
+  revoked_at INT,
+  expired_at INT,
+  FOREIGN KEY(user_id) REFERENCES user(id),
+  FOREIGN KEY(granted_by) REFERENCES user(id),
+  FOREIGN KEY(revoked_by) REFERENCES user(id)
+);
+
+CREATE TABLE IF NOT EXISTS user_token (
+  id TEXT PRIMARY KEY,
+  user_id TEXT NOT NULL,
+  token_hash TEXT UNIQUE NOT NULL,
+  label TEXT NOT NULL DEFAULT '',
+  created_by TEXT NOT NULL,
+  created_at INT NOT NULL,
+  revoked_by TEXT,
+  revoked_at INT,
+  FOREIGN KEY(user_id) REFERENCES user(id),
+  FOREIGN KEY(created_by) REFERENCES user(id),
+  FOREIGN KEY(revoked_by) REFERENCES user(id)
+);
+
+CREATE TABLE IF NOT EXISTS audit_log (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  at INT NOT NULL,
+  actor_id TEXT NOT NULL,
+  action TEXT NOT NULL,
+  target_type TEXT NOT NULL,
+  target_id TEXT NOT NULL,
+  details TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS entry_version (
+  entry_id TEXT NOT NULL,
+  version INT NOT NULL,
+  data TEXT NOT NULL,
+  replaced_by TEXT,
+  replaced_at INT NOT NULL,
+  PRIMARY KEY(entry_id, version),
+  FOREIGN KEY(entry_id) REFERENCES entry(id),
+  FOREIGN KEY(replaced_by) REFERENCES user(id)
+);
+
+CREATE TABLE IF NOT EXISTS entry_lock (
+  id INT PRIMARY KEY CHECK(id = 1),
+  locked_before TEXT NOT NULL,
+  locked_at INT NOT NULL,
+  unlocked_until INT,
+  unlocked_by TEXT,
+  FOREIGN KEY(unlocked_by) REFERENCES user(id)
+);
+
+CREATE TABLE IF NOT EXISTS shared_view (
+  token TEXT PRIMARY KEY,
+  path TEXT NOT NULL,
+  filters TEXT NOT NULL DEFAULT '',
+  snapshot TEXT,
+  snapshot_at INT,
+  created_by TEXT NOT NULL,
+  created_at INT NOT NULL,
+  FOREIGN KEY(created_by) REFERENCES user(id)
+);
+
+CREATE TABLE IF NOT EXISTS stock_take (
+  id TEXT PRIMARY KEY,
+  date TEXT NOT NULL,
+  remark TEXT NOT NULL DEFAULT '',
+  status TEXT NOT NULL DEFAULT 'open' CHECK(status IN ('open', 'approved')),
+  opened_by TEXT NOT NULL,
+  opened_at INT NOT NULL,
+  approved_by TEXT,
+  approved_at INT,
+  FOREIGN KEY(opened_by) REFERENCES user(id),
+  FOREIGN KEY(approved_by) REFERENCES user(id)
+);
+
+CREATE TABLE IF NOT EXISTS stock_take_count (
+  stock_take_id TEXT NOT NULL,
+  compound_id TEXT NOT NULL,
+  counted_quantity INT NOT NULL,
+  counted_by TEXT NOT NULL,
+  counted_at INT NOT NULL,
+  ledger_stock INT,
+  adjustment_entry_id TEXT,
+  PRIMARY KEY(stock_take_id, compound_id),
+  FOREIGN KEY(stock_take_id) REFERENCES stock_take(id),
+  FOREIGN KEY(compound_id) REFERENCES compound(id),
+  FOREIGN KEY(counted_by) REFERENCES user(id),
+  FOREIGN KEY(adjustment_entry_id) REFERENCES entry(id)
+);
+
+CREATE TABLE IF NOT EXISTS usage_metric (
+  day TEXT NOT NULL,
+  endpoint TEXT NOT NULL,
+  feature TEXT NOT NULL DEFAULT '',
+  role TEXT NOT NULL,
+  count INT NOT NULL DEFAULT 0,
+  PRIMARY KEY(day, endpoint, feature, role)
+);
+
+CREATE TABLE IF NOT EXISTS stock_current (
+  compound_id TEXT PRIMARY KEY,
+  balance INT NOT NULL,
+  last_entry_at INT NOT NULL,
+  FOREIGN KEY(compound_id) REFERENCES compound(id)
+);
+
+CREATE TABLE IF NOT EXISTS stock_location (
+  compound_id TEXT NOT NULL,
+  location_id TEXT NOT NULL,
+  balance INT NOT NULL,
+  PRIMARY KEY(compound_id, location_id),
+  FOREIGN KEY(compound_id) REFERENCES compound(id)
+);
+
+CREATE TABLE IF NOT EXISTS import_batch (
+  id TEXT PRIMARY KEY,
+  source TEXT NOT NULL CHECK(source IN ('import', 'paste', 'inbound')),
+  filename TEXT NOT NULL DEFAULT '',
+  rows INT NOT NULL,
+  created_by TEXT NOT NULL,
+  created_at INT NOT NULL,
+  rolled_back_by TEXT,
+  rolled_back_at INT,
+  FOREIGN KEY(created_by) REFERENCES user(id),
+  FOREIGN KEY(rolled_back_by) REFERENCES user(id)
+);
+
+CREATE TABLE IF NOT EXISTS attachment (
+  id TEXT PRIMARY KEY,
+  compound_id TEXT NOT NULL,
+  entry_id TEXT,
+  kind TEXT NOT NULL CHECK(kind IN ('sds', 'voucher')),
+  filename TEXT NOT NULL,
+  content_type TEXT NOT NULL,
+  size INT NOT NULL,
+  sha256 TEXT NOT NULL,
+  uploaded_by TEXT NOT NULL,
+  uploaded_at INT NOT NULL,
+  FOREIGN KEY(compound_id) REFERENCES compound(id),
+  FOREIGN KEY(entry_id) REFERENCES entry(id),
+  FOREIGN KEY(uploaded_by) REFERENCES user(id)
+);
+
+CREATE TABLE IF NOT EXISTS item_mapping (
+  source TEXT NOT NULL,
+  item_code TEXT NOT NULL,
+  compound_id TEXT NOT NULL,
+  unit TEXT,
+  quantity_per_unit INT NOT NULL DEFAULT 0 CHECK(quantity_per_unit >= 0),
+  updated_by TEXT NOT NULL,
+  updated_at INT NOT NULL,
+  PRIMARY KEY(source, item_code),
+  FOREIGN KEY(compound_id) REFERENCES compound(id),
+  FOREIGN KEY(unit) REFERENCES unit(name),
+  FOREIGN KEY(updated_by) REFERENCES user(id)
+);
+
+CREATE TABLE IF NOT EXISTS inbound_event (
+  source TEXT NOT NULL,
+  event_id TEXT NOT NULL,
+  schema_version INT NOT NULL,
+  import_batch_id TEXT NOT NULL,
+  received_at INT NOT NULL,
+  PRIMARY KEY(source, event_id),
+  FOREIGN KEY(import_batch_id) REFERENCES import_batch(id)
+);
+
+CREATE TABLE IF NOT EXISTS daily_digest (
+  date TEXT PRIMARY KEY,
+  data TEXT NOT NULL,
+  generated_at INT NOT NULL,
+  emailed_at INT
+);
@@ -1,24 +1,57 @@
 package db
 
 import (
+	"context"
 	"database/sql"
-
-	_ "github.com/mattn/go-sqlite3"
 )
 
+// The database the application was started with. Requests and scheduled jobs do not read it directly but find
+// their database in their context, see ConnFrom, so tests can give each request a database of its own.
 var Conn *sql.DB
 
+type connKey struct{}
+
+// Context carrying the database to work on for the rest of the request
+func WithConn(ctx context.Context, conn *sql.DB) context.Context {
+	return context.WithValue(ctx, connKey{}, conn)
+}
+
+// Database carried by the context, the global "Conn" when it carries none, as for the startup checks
+func ConnFrom(ctx context.Context) *sql.DB {
+	if conn, ok := ctx.Value(connKey{}).(*sql.DB); ok {
+		return conn
+	}
+	return Conn
+}
+
 // Sets up the database connection and assigns it to the Global "Conn" variable
 func SetUpConnection(filepath string) error {
-	conn, err := sql.Open("sqlite3", filepath)
+	conn, err := Open(filepath)
 	if err != nil {
 		return err
 	}
 
+	Conn = conn
+	return nil
+}
+
+// Opens the database at the given path and checks it can be reached, without making it the global connection
+func Open(filepath string) (*sql.DB, error) {
+	conn, err := sql.Open(TRACED_DRIVER, filepath)
+	if err != nil {
+		return nil, err
+	}
+
 	if err := conn.Ping(); err != nil {
-		return err
+		conn.Close()
+		return nil, err
 	}
+	return conn, nil
+}
 
-	Conn = conn
-	return nil
+// Gets the path of the file the given database is kept in, empty for in-memory databases
+func GetDatabaseFile(ctx context.Context, conn *sql.DB) (string, error) {
+	var file string
+	err := conn.QueryRowContext(ctx, "SELECT file FROM pragma_database_list WHERE name = 'main'").Scan(&file)
+	return file, err
 }
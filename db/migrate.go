@@ -1,8 +1,13 @@
 package db
 
 import (
+	"context"
+	"database/sql"
 	_ "embed"
 	"errors"
+	"fmt"
+	"regexp"
+	"strings"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -10,33 +15,457 @@ import (
 //go:embed create-tables.sql
 var createTablesQuery string
 
+// Version of the schema Migrate brings databases to, kept in the database's user_version. Raise it with every change
+// to create-tables.sql or the migrations, so support can tell which schema a database is on.
+const SCHEMA_VERSION = 3
+
 // Create the tables in the database
 func CreateTables() error {
 	if Conn == nil {
 		return errors.New("database connection not set up, run SetUpConnection() first")
 	}
+	return Migrate(Conn)
+}
+
+// Creates the tables missing from the given database and brings those of older releases up to date
+func Migrate(conn *sql.DB) error {
+	if err := setAsideOutdatedUnits(conn); err != nil {
+		return err
+	}
+
+	if _, err := conn.Exec(createTablesQuery); err != nil {
+		return err
+	}
+
+	if err := restoreOutdatedUnits(conn); err != nil {
+		return err
+	}
+
+	if err := addMissingColumns(conn); err != nil {
+		return err
+	}
+
+	if err := rebuildOutdatedTables(conn); err != nil {
+		return err
+	}
+
+	if err := mapCompoundScales(conn); err != nil {
+		return err
+	}
+
+	if err := numberEntries(conn); err != nil {
+		return err
+	}
+
+	_, err := conn.Exec(fmt.Sprintf("PRAGMA user_version = %d", SCHEMA_VERSION))
+	return err
+}
+
+// Gets the schema version the given database was last migrated to, 0 for databases from before it was kept
+func GetSchemaVersion(ctx context.Context, conn *sql.DB) (int, error) {
+	var version int
+	err := conn.QueryRowContext(ctx, "PRAGMA user_version").Scan(&version)
+	return version, err
+}
+
+// Columns added to existing tables after their first release. "CREATE TABLE IF NOT EXISTS" leaves
+// older databases untouched, so these are added separately when missing.
+var addedColumns = []struct {
+	table      string
+	column     string
+	definition string
+}{
+	{"entry", "lot_id", "TEXT"},
+	{"entry", "supplier_id", "TEXT REFERENCES supplier(id)"},
+	{"entry", "recipient_id", "TEXT REFERENCES recipient(id)"},
+	{"entry", "reason", "TEXT"},
+	{"entry", "status", "TEXT NOT NULL DEFAULT 'approved' CHECK(status IN ('pending', 'approved', 'rejected'))"},
+	{"entry", "created_by", "TEXT REFERENCES user(id)"},
+	{"entry", "reviewed_by", "TEXT REFERENCES user(id)"},
+	{"entry", "reviewed_at", "INT"},
+	{"entry", "review_remark", "TEXT"},
+	{"entry", "deleted_at", "INT"},
+	{"entry", "deleted_by", "TEXT REFERENCES user(id)"},
+	{"entry", "seq", "INT"},
+	{"entry", "import_batch_id", "TEXT REFERENCES import_batch(id)"},
+	{"entry", "instrument_id", "TEXT REFERENCES instrument(id)"},
+	{"entry", "instrument_event", "TEXT"},
+	{"entry", "disposal_method", "TEXT"},
+	{"entry", "disposal_authorized_by", "TEXT"},
+	{"entry", "location_id", "TEXT REFERENCES location(id)"},
+	{"entry", "to_location_id", "TEXT REFERENCES location(id)"},
+	{"entry", "large_incoming_bound", "INT"},
+	{"entry", "project_id", "TEXT REFERENCES project(id)"},
+	{"entry", "unit_cost", "REAL"},
+	{"entry", "po_line_id", "TEXT REFERENCES purchase_order_line(id)"},
+	{"compound", "min_stock", "INT NOT NULL DEFAULT 0"},
+	{"compound", "notes", "TEXT NOT NULL DEFAULT ''"},
+	{"compound", "pinned_warning", "TEXT NOT NULL DEFAULT ''"},
+	{"compound", "category", "TEXT NOT NULL DEFAULT ''"},
+	{"compound", "display_unit", "TEXT REFERENCES unit(name)"},
+	{"compound", "archived_at", "INT"},
+	{"compound", "archived_by", "TEXT REFERENCES user(id)"},
+	{"compound", "cas_no", "TEXT NOT NULL DEFAULT ''"},
+	{"compound", "formula", "TEXT NOT NULL DEFAULT ''"},
+	{"compound", "molecular_weight", "REAL"},
+	{"compound", "storage_location", "TEXT NOT NULL DEFAULT ''"},
+	{"compound", "controlled", "INT NOT NULL DEFAULT 0"},
+	{"compound", "hazard_class", "TEXT NOT NULL DEFAULT ''"},
+	{"compound", "max_incoming", "INT NOT NULL DEFAULT 0"},
+	{"attachment", "entry_id", "TEXT REFERENCES entry(id)"},
+	{"quantity", "packs_per_unit", "INT NOT NULL DEFAULT 1"},
+	{"quantity", "partial_quantity", "INT NOT NULL DEFAULT 0"},
+	{"quantity", "total_quantity", "INT GENERATED ALWAYS AS (num_of_units * packs_per_unit * quantity_per_unit + partial_quantity) VIRTUAL"},
+}
+
+// Adds the columns listed in "addedColumns" to databases created before they existed.
+// table_xinfo is used over table_info as the latter leaves out generated columns.
+func addMissingColumns(conn *sql.DB) error {
+	for _, c := range addedColumns {
+		var exists bool
+		err := conn.QueryRow(
+			"SELECT EXISTS(SELECT 1 FROM pragma_table_xinfo(?) WHERE name = ?)",
+			c.table, c.column,
+		).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+
+		if _, err := conn.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", c.table, c.column, c.definition)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Tables whose constraints changed after their first release, with a piece of the new definition that tells
+// whether a database already has it. SQLite cannot alter constraints, so these tables are rebuilt.
+var changedTables = []struct {
+	table  string
+	marker string
+}{
+	{"entry", "'transfer'"},
+	{"compound", "scale TEXT REFERENCES unit(name)"},
+	{"attachment", "'voucher'"},
+	{"import_batch", "'inbound'"},
+}
+
+// Rebuilds the tables listed in "changedTables" whose stored definition predates the change, following the
+// SQLite procedure: create the table anew under a temporary name, copy the rows, drop the old one and rename.
+// Tables referencing the rebuilt one keep pointing to it by name, so their foreign keys stay valid.
+func rebuildOutdatedTables(conn *sql.DB) error {
+	for _, c := range changedTables {
+		var definition string
+		if err := conn.QueryRow("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?", c.table).Scan(&definition); err != nil {
+			return err
+		}
+		if strings.Contains(definition, c.marker) {
+			continue
+		}
+
+		if err := rebuildTable(conn, c.table); err != nil {
+			return fmt.Errorf("failed to rebuild table %s: %w", c.table, err)
+		}
+	}
+
+	return nil
+}
+
+func rebuildTable(conn *sql.DB, table string) error {
+	createQuery := regexp.MustCompile(`(?s)CREATE TABLE IF NOT EXISTS ` + table + ` \(.*?\n\);`).FindString(createTablesQuery)
+	if createQuery == "" {
+		return fmt.Errorf("no definition of table %s in create-tables.sql", table)
+	}
+	tempTable := table + "_rebuild"
+	createQuery = strings.Replace(createQuery, "CREATE TABLE IF NOT EXISTS "+table, "CREATE TABLE "+tempTable, 1)
 
-	if _, err := Conn.Exec(createTablesQuery); err != nil {
+	rows, err := conn.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
 		return err
 	}
+	var columns []string
+	for rows.Next() {
+		var column string
+		if err := rows.Scan(&column); err != nil {
+			rows.Close()
+			return err
+		}
+		columns = append(columns, column)
+	}
+	rows.Close()
+	columnList := strings.Join(columns, ", ")
+
+	tx, err := conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, query := range []string{
+		createQuery,
+		fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s", tempTable, columnList, columnList, table),
+		fmt.Sprintf("DROP TABLE %s", table),
+		fmt.Sprintf("ALTER TABLE %s RENAME TO %s", tempTable, table),
+	} {
+		if _, err := tx.Exec(query); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Units were kept by scale (g or ml) before they had a kind, and create-tables.sql cannot seed the outdated table.
+// Nothing else is stored in it, so it is set aside as "unit_outdated" for the table to be created anew, and its
+// units copied back by restoreOutdatedUnits.
+func setAsideOutdatedUnits(conn *sql.DB) error {
+	var outdated bool
+	if err := conn.QueryRow("SELECT EXISTS(SELECT 1 FROM pragma_table_info('unit') WHERE name = 'scale')").Scan(&outdated); err != nil {
+		return err
+	}
+	if !outdated {
+		return nil
+	}
 
+	tx, err := conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, query := range []string{
+		"CREATE TABLE unit_outdated AS SELECT * FROM unit",
+		"DROP TABLE unit",
+	} {
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("failed to set aside outdated units: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// Copies the units set aside by setAsideOutdatedUnits into the new table, those of the g scale as mass and those of
+// the ml scale as volume. Their multiplier and divisor stay, g and ml being the base units of their kind.
+func restoreOutdatedUnits(conn *sql.DB) error {
+	var outdated bool
+	if err := conn.QueryRow("SELECT EXISTS(SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'unit_outdated')").Scan(&outdated); err != nil {
+		return err
+	}
+	if !outdated {
+		return nil
+	}
+
+	tx, err := conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, query := range []string{
+		`INSERT OR IGNORE INTO unit (name, kind, multiplier, divisor)
+		SELECT name, CASE scale WHEN 'g' THEN 'mass' ELSE 'volume' END, multiplier, divisor FROM unit_outdated`,
+		"DROP TABLE unit_outdated",
+	} {
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("failed to restore outdated units: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// Scales were free text checked against g and ml, and now reference the unit table, which holds both. Scales
+// written differently, e.g. " G", are mapped to their unit. Compounds whose scale is still not a unit would convert
+// nothing, so they stop the start-up with the scales to add to the table.
+func mapCompoundScales(conn *sql.DB) error {
+	if _, err := conn.Exec(`
+		UPDATE compound SET scale = lower(trim(scale))
+		WHERE scale NOT IN (SELECT name FROM unit) AND lower(trim(scale)) IN (SELECT name FROM unit)`,
+	); err != nil {
+		return err
+	}
+
+	rows, err := conn.Query("SELECT DISTINCT scale FROM compound WHERE scale IS NOT NULL AND scale NOT IN (SELECT name FROM unit)")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var unknown []string
+	for rows.Next() {
+		var scale string
+		if err := rows.Scan(&scale); err != nil {
+			return err
+		}
+		unknown = append(unknown, scale)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("compounds are measured in scales missing from the unit table: %s", strings.Join(unknown, ", "))
+	}
 	return nil
 }
 
+// Entries are numbered in the order they are recorded, which orders entries of the same second. Entries recorded
+// before the numbering existed are numbered in the order they were inserted, after any already numbered.
+func numberEntries(conn *sql.DB) error {
+	var lastSeq int64
+	if err := conn.QueryRow("SELECT COALESCE(MAX(seq), 0) FROM entry").Scan(&lastSeq); err != nil {
+		return err
+	}
+	if _, err := conn.Exec(`
+		UPDATE entry SET seq = ? + numbered.position
+		FROM (SELECT id, ROW_NUMBER() OVER (ORDER BY rowid) AS position FROM entry WHERE seq IS NULL) AS numbered
+		WHERE entry.id = numbered.id`,
+		lastSeq,
+	); err != nil {
+		return err
+	}
+
+	// Rebuilding the table drops its indexes, so this comes after the rebuilds
+	_, err := conn.Exec("CREATE UNIQUE INDEX IF NOT EXISTS entry_seq ON entry(seq)")
+	return err
+}
+
 // Drop the tables in the database
 func DropTables() error {
 	if Conn == nil {
 		return errors.New("database connection not set up, run SetUpConnection() & CreateTables() first")
 	}
 
+	if _, err := Conn.Exec("DROP TABLE IF EXISTS daily_digest"); err != nil {
+		return err
+	}
+
+	if _, err := Conn.Exec("DROP TABLE IF EXISTS inbound_event"); err != nil {
+		return err
+	}
+
+	if _, err := Conn.Exec("DROP TABLE IF EXISTS item_mapping"); err != nil {
+		return err
+	}
+
+	if _, err := Conn.Exec("DROP TABLE IF EXISTS attachment"); err != nil {
+		return err
+	}
+
+	if _, err := Conn.Exec("DROP TABLE IF EXISTS stock_location"); err != nil {
+		return err
+	}
+
+	if _, err := Conn.Exec("DROP TABLE IF EXISTS stock_current"); err != nil {
+		return err
+	}
+
+	if _, err := Conn.Exec("DROP TABLE IF EXISTS usage_metric"); err != nil {
+		return err
+	}
+
+	if _, err := Conn.Exec("DROP TABLE IF EXISTS stock_take_count"); err != nil {
+		return err
+	}
+
+	if _, err := Conn.Exec("DROP TABLE IF EXISTS stock_take"); err != nil {
+		return err
+	}
+
+	if _, err := Conn.Exec("DROP TABLE IF EXISTS audit_log"); err != nil {
+		return err
+	}
+
+	if _, err := Conn.Exec("DROP TABLE IF EXISTS role_grant"); err != nil {
+		return err
+	}
+
+	if _, err := Conn.Exec("DROP TABLE IF EXISTS delegation"); err != nil {
+		return err
+	}
+
+	if _, err := Conn.Exec("DROP TABLE IF EXISTS shared_view"); err != nil {
+		return err
+	}
+
+	if _, err := Conn.Exec("DROP TABLE IF EXISTS entry_lock"); err != nil {
+		return err
+	}
+
+	if _, err := Conn.Exec("DROP TABLE IF EXISTS entry_version"); err != nil {
+		return err
+	}
+
+	if _, err := Conn.Exec("DROP TABLE IF EXISTS lot_consumption"); err != nil {
+		return err
+	}
+
+	if _, err := Conn.Exec("DROP TABLE IF EXISTS lot"); err != nil {
+		return err
+	}
+
 	if _, err := Conn.Exec("DROP TABLE IF EXISTS entry"); err != nil {
 		return err
 	}
 
+	if _, err := Conn.Exec("DROP TABLE IF EXISTS purchase_order_line"); err != nil {
+		return err
+	}
+
+	if _, err := Conn.Exec("DROP TABLE IF EXISTS purchase_order"); err != nil {
+		return err
+	}
+
+	if _, err := Conn.Exec("DROP TABLE IF EXISTS reservation"); err != nil {
+		return err
+	}
+
+	if _, err := Conn.Exec("DROP TABLE IF EXISTS invoice_line"); err != nil {
+		return err
+	}
+
+	if _, err := Conn.Exec("DROP TABLE IF EXISTS invoice"); err != nil {
+		return err
+	}
+
+	if _, err := Conn.Exec("DROP TABLE IF EXISTS import_batch"); err != nil {
+		return err
+	}
+
+	if _, err := Conn.Exec("DROP TABLE IF EXISTS user"); err != nil {
+		return err
+	}
+
+	if _, err := Conn.Exec("DROP TABLE IF EXISTS project"); err != nil {
+		return err
+	}
+
+	if _, err := Conn.Exec("DROP TABLE IF EXISTS location"); err != nil {
+		return err
+	}
+
+	if _, err := Conn.Exec("DROP TABLE IF EXISTS instrument"); err != nil {
+		return err
+	}
+
+	if _, err := Conn.Exec("DROP TABLE IF EXISTS recipient"); err != nil {
+		return err
+	}
+
+	if _, err := Conn.Exec("DROP TABLE IF EXISTS supplier"); err != nil {
+		return err
+	}
+
 	if _, err := Conn.Exec("DROP TABLE IF EXISTS compound"); err != nil {
 		return err
 	}
 
+	if _, err := Conn.Exec("DROP TABLE IF EXISTS unit"); err != nil {
+		return err
+	}
+
 	if _, err := Conn.Exec("DROP TABLE IF EXISTS quantity"); err != nil {
 		return err
 	}
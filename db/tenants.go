@@ -0,0 +1,266 @@
+package db
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sync"
+)
+
+// In multi-tenant mode each tenant, e.g. each school the ledger is hosted for, keeps its ledger in a database file of
+// its own, so their data is fully isolated without separate deployments. Requests work on the database of their
+// tenant (see handlers.TenantMiddleware), and at most a set number of databases are kept open: the least recently
+// used one is closed when another has to be opened.
+
+// Tenant IDs name their database file and the subdomain they are reached on, e.g. "stmarys"
+var validTenantId = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+func IsValidTenantId(id string) bool {
+	return validTenantId.MatchString(id)
+}
+
+// Databases of the tenants hosted, "<id>.db" in one folder, created and brought up to date on first use
+type Tenants struct {
+	dir     string
+	ids     []string
+	maxOpen int
+
+	mu sync.Mutex
+	// Elements of "lru" by tenant ID
+	open map[string]*list.Element
+	// Open databases, the most recently used first
+	lru *list.List
+}
+
+// Database of a tenant as long as a request or job uses it
+type tenantConn struct {
+	id string
+	// Closed once the database is opened and migrated, or failed to be; "conn" and "err" are set by then
+	opened chan struct{}
+	conn   *sql.DB
+	err    error
+	users  int
+	// Left out of the open databases to make room, closed once its last user lets go
+	evicted bool
+}
+
+// Hosts the given tenants with their databases in the given folder, created if missing, keeping at most maxOpen of them open
+func NewTenants(dir string, ids []string, maxOpen int) (*Tenants, error) {
+	for _, id := range ids {
+		if !IsValidTenantId(id) {
+			return nil, fmt.Errorf("invalid tenant ID %q", id)
+		}
+	}
+	if maxOpen < 1 {
+		return nil, fmt.Errorf("at least one tenant database must be kept open, not %d", maxOpen)
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create the folder of the tenant databases: %w", err)
+	}
+
+	ids = slices.Clone(ids)
+	slices.Sort(ids)
+	return &Tenants{dir: dir, ids: slices.Compact(ids), maxOpen: maxOpen, open: map[string]*list.Element{}, lru: list.New()}, nil
+}
+
+// IDs of the tenants hosted, sorted
+func (t *Tenants) Ids() []string {
+	return slices.Clone(t.ids)
+}
+
+func (t *Tenants) Has(id string) bool {
+	_, found := slices.BinarySearch(t.ids, id)
+	return found
+}
+
+// Gets the database of the tenant, opening it when it is not open yet. The lease must be released once done with it.
+func (t *Tenants) Acquire(id string) (*Lease, error) {
+	if !t.Has(id) {
+		return nil, fmt.Errorf("unknown tenant %q", id)
+	}
+
+	// "mu" is only held to keep track of the databases. The first request for a database that is not open opens and
+	// migrates it, which can take a while, and those coming in meanwhile wait for it, so it is never opened twice at
+	// once and the other tenants are not held up.
+	t.mu.Lock()
+	el, opening := t.open[id]
+	if opening {
+		t.lru.MoveToFront(el)
+	} else {
+		el = t.lru.PushFront(&tenantConn{id: id, opened: make(chan struct{})})
+		t.open[id] = el
+	}
+	tc := el.Value.(*tenantConn)
+	tc.users++
+	for t.lru.Len() > t.maxOpen {
+		t.evict(t.lru.Back())
+	}
+	t.mu.Unlock()
+
+	if opening {
+		<-tc.opened
+	} else {
+		tc.conn, tc.err = t.openDatabase(id)
+		close(tc.opened)
+	}
+	if tc.err != nil {
+		// Left for the next request to try again
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		tc.users--
+		if t.open[id] == el {
+			t.lru.Remove(el)
+			delete(t.open, id)
+		}
+		return nil, tc.err
+	}
+	return &Lease{Tenant: id, Conn: tc.conn, tenants: t, tc: tc}, nil
+}
+
+// Opens the database of the tenant and brings it up to date
+func (t *Tenants) openDatabase(id string) (*sql.DB, error) {
+	conn, err := Open(filepath.Join(t.dir, id+".db"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database of tenant %q: %w", id, err)
+	}
+	if err := Migrate(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to migrate database of tenant %q: %w", id, err)
+	}
+	return conn, nil
+}
+
+// Number of tenant databases open, including those left to close once their last user lets go
+func (t *Tenants) OpenCount() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.open)
+}
+
+// Closes the databases no one uses; the others are closed as their last user lets go
+func (t *Tenants) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var errs []error
+	for t.lru.Len() > 0 {
+		errs = append(errs, t.evict(t.lru.Back()))
+	}
+	return errors.Join(errs...)
+}
+
+// Must be called with "mu" held
+func (t *Tenants) evict(el *list.Element) error {
+	tc := t.lru.Remove(el).(*tenantConn)
+	delete(t.open, tc.id)
+	tc.evicted = true
+	// Databases being opened have a user, the request opening them
+	if tc.users == 0 && tc.conn != nil {
+		return tc.conn.Close()
+	}
+	return nil
+}
+
+func (t *Tenants) release(tc *tenantConn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tc.users--
+	if tc.evicted && tc.users == 0 && tc.conn != nil {
+		tc.conn.Close()
+	}
+}
+
+// Runs the job on the database of the tenant
+func (t *Tenants) Run(ctx context.Context, id string, job func(ctx context.Context) error) error {
+	lease, err := t.Acquire(id)
+	if err != nil {
+		return err
+	}
+	defer lease.Release()
+	return job(WithLease(ctx, lease))
+}
+
+// Use of the database of a tenant, which stays open until released
+type Lease struct {
+	Tenant string
+	Conn   *sql.DB
+
+	tenants *Tenants
+	tc      *tenantConn
+	once    sync.Once
+}
+
+// Lets go of the database. Releasing a lease again does nothing.
+func (l *Lease) Release() {
+	l.once.Do(func() { l.tenants.release(l.tc) })
+}
+
+// Another use of the same database, released on its own
+func (l *Lease) Hold() *Lease {
+	l.tenants.mu.Lock()
+	defer l.tenants.mu.Unlock()
+
+	l.tc.users++
+	return &Lease{Tenant: l.Tenant, Conn: l.Conn, tenants: l.tenants, tc: l.tc}
+}
+
+type tenantsKey struct{}
+type leaseKey struct{}
+
+// Context carrying the tenants hosted in multi-tenant mode, for the scheduled jobs to run on each of them
+func WithTenants(ctx context.Context, tenants *Tenants) context.Context {
+	return context.WithValue(ctx, tenantsKey{}, tenants)
+}
+
+// Tenants carried by the context, nil in single-tenant mode
+func TenantsFrom(ctx context.Context) *Tenants {
+	tenants, _ := ctx.Value(tenantsKey{}).(*Tenants)
+	return tenants
+}
+
+// Context working on the database of the lease's tenant
+func WithLease(ctx context.Context, lease *Lease) context.Context {
+	return WithConn(context.WithValue(ctx, leaseKey{}, lease), lease.Conn)
+}
+
+// Tenant whose database the context works on, empty in single-tenant mode
+func TenantFrom(ctx context.Context) string {
+	if lease, ok := ctx.Value(leaseKey{}).(*Lease); ok {
+		return lease.Tenant
+	}
+	return ""
+}
+
+// Keeps the database of the context open for work outliving the request, e.g. a recalculation answered before it is
+// done, until the returned function is called
+func Hold(ctx context.Context) (release func()) {
+	if lease, ok := ctx.Value(leaseKey{}).(*Lease); ok {
+		return lease.Hold().Release
+	}
+	return func() {}
+}
+
+// Runs the job on the database of the context, or in multi-tenant mode on the database of every tenant in turn.
+// A tenant it fails for does not keep it from the others.
+func EachDatabase(ctx context.Context, job func(ctx context.Context) error) error {
+	tenants := TenantsFrom(ctx)
+	if tenants == nil {
+		return job(ctx)
+	}
+
+	var errs []error
+	for _, id := range tenants.Ids() {
+		if err := tenants.Run(ctx, id, job); err != nil {
+			errs = append(errs, fmt.Errorf("tenant %s: %w", id, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,107 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SQLite driver adding a span for every query run on the context of a traced request, see utils.StartTracing
+const TRACED_DRIVER = "sqlite3-traced"
+
+var tracer = otel.Tracer("chemical-ledger-backend/db")
+
+func init() {
+	sql.Register(TRACED_DRIVER, tracedDriver{&sqlite3.SQLiteDriver{}})
+}
+
+type tracedDriver struct {
+	*sqlite3.SQLiteDriver
+}
+
+func (d tracedDriver) Open(dsn string) (driver.Conn, error) {
+	conn, err := d.SQLiteDriver.Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &tracedConn{conn.(*sqlite3.SQLiteConn)}, nil
+}
+
+type tracedConn struct {
+	*sqlite3.SQLiteConn
+}
+
+func (c *tracedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	ctx, span, ok := startQuerySpan(ctx, query)
+	if !ok {
+		return c.SQLiteConn.QueryContext(ctx, query, args)
+	}
+	rows, err := c.SQLiteConn.QueryContext(ctx, query, args)
+	if err != nil {
+		endQuerySpan(span, err)
+		return nil, err
+	}
+	// SQLite does most of the work while the rows are read, so the span lasts until they are closed
+	sqliteRows, isSqliteRows := rows.(*sqlite3.SQLiteRows)
+	if !isSqliteRows {
+		endQuerySpan(span, nil)
+		return rows, nil
+	}
+	return &tracedRows{sqliteRows, span}, nil
+}
+
+func (c *tracedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	ctx, span, ok := startQuerySpan(ctx, query)
+	if !ok {
+		return c.SQLiteConn.ExecContext(ctx, query, args)
+	}
+	result, err := c.SQLiteConn.ExecContext(ctx, query, args)
+	endQuerySpan(span, err)
+	return result, err
+}
+
+type tracedRows struct {
+	*sqlite3.SQLiteRows
+	span trace.Span
+}
+
+func (r *tracedRows) Close() error {
+	err := r.SQLiteRows.Close()
+	endQuerySpan(r.span, err)
+	return err
+}
+
+// Starts the span of a query run for a traced request. Queries outside of one, e.g. of scheduled jobs, are not
+// traced, so they do not each start a trace of their own.
+func startQuerySpan(ctx context.Context, query string) (context.Context, trace.Span, bool) {
+	if !trace.SpanFromContext(ctx).IsRecording() {
+		return ctx, nil, false
+	}
+
+	query = strings.TrimSpace(query)
+	operation, _, _ := strings.Cut(query, " ")
+	ctx, span := tracer.Start(ctx, "db."+strings.ToLower(operation),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system.name", "sqlite"),
+			attribute.String("db.operation.name", strings.ToUpper(operation)),
+			attribute.String("db.query.text", query),
+		),
+	)
+	return ctx, span, true
+}
+
+func endQuerySpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
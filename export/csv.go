@@ -0,0 +1,51 @@
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+)
+
+// Writes the tables as CSV. A document of several tables has each start with a row naming it, and a blank row
+// between them.
+type CSVWriter struct{}
+
+func (CSVWriter) ContentType() string { return "text/csv; charset=utf-8" }
+
+func (CSVWriter) Extension() string { return "csv" }
+
+func (CSVWriter) Write(w io.Writer, doc *Document) error {
+	cw := csv.NewWriter(w)
+	for i, table := range doc.Tables {
+		if len(doc.Tables) > 1 {
+			if i > 0 {
+				cw.Write([]string{})
+			}
+			cw.Write([]string{table.Name})
+		}
+		cw.Write(table.Columns)
+		for _, row := range table.Rows {
+			record := make([]string, len(row))
+			for j, cell := range row {
+				record[j] = cellString(cell)
+			}
+			cw.Write(record)
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Formats a cell as text: numbers without exponents, nil as empty
+func cellString(cell any) string {
+	switch v := cell.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return fmt.Sprintf("%g", v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,89 @@
+// Package export renders what list and report endpoints return as files. Endpoints describe their data as a
+// Document of tables, and each format registered here lays it out, so a new format is one Writer rather than a
+// change to every endpoint.
+package export
+
+import (
+	"io"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Data to export, as one or more tables
+type Document struct {
+	// File name without its extension, e.g. "entries-2026-03-01-2026-03-31"
+	Name   string
+	Title  string
+	Tables []Table
+	// Layouts made by hand for some formats, used instead of the format's writer, e.g. a PDF in the layout a
+	// regulator asks for
+	Layouts map[string]func(w io.Writer) error
+	// Time the document was made at, printed on PDFs
+	GeneratedAt time.Time
+}
+
+type Table struct {
+	Name    string
+	Columns []string
+	// Cells hold strings or numbers
+	Rows [][]any
+}
+
+func (t *Table) AddRow(cells ...any) {
+	t.Rows = append(t.Rows, cells)
+}
+
+// Writes a document in one format
+type Writer interface {
+	ContentType() string
+	// File extension, without the dot
+	Extension() string
+	Write(w io.Writer, doc *Document) error
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Writer{}
+)
+
+// Registers the writer of a format, replacing any registered under the same name
+func Register(format string, writer Writer) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[format] = writer
+}
+
+// Gets the writer of a format, false when none is registered
+func Lookup(format string) (Writer, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	writer, ok := registry[format]
+	return writer, ok
+}
+
+// Names of the registered formats, sorted
+func Formats() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	formats := make([]string, 0, len(registry))
+	for format := range registry {
+		formats = append(formats, format)
+	}
+	slices.Sort(formats)
+	return formats
+}
+
+// Writes the document in the format, with the layout made for it if it has one
+func Write(w io.Writer, format string, writer Writer, doc *Document) error {
+	if layout, ok := doc.Layouts[format]; ok {
+		return layout(w)
+	}
+	return writer.Write(w, doc)
+}
+
+func init() {
+	Register("csv", CSVWriter{})
+	Register("xlsx", XLSXWriter{})
+	Register("pdf", PDFWriter{})
+}
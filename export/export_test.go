@@ -0,0 +1,68 @@
+package export_test
+
+import (
+	"bytes"
+	"chemical-ledger-backend/export"
+	"io"
+	"slices"
+	"testing"
+)
+
+type tsvWriter struct{}
+
+func (tsvWriter) ContentType() string { return "text/tab-separated-values" }
+
+func (tsvWriter) Extension() string { return "tsv" }
+
+func (tsvWriter) Write(w io.Writer, doc *export.Document) error {
+	_, err := io.WriteString(w, doc.Tables[0].Columns[0])
+	return err
+}
+
+func stockDocument() *export.Document {
+	totals := export.Table{Name: "Totals", Columns: []string{"Compound", "Quantity"}}
+	totals.AddRow("Acetone, dry", 150)
+	totals.AddRow("Benzene", 2.5)
+	entries := export.Table{Name: "Entries", Columns: []string{"Entry", "Remark"}}
+	entries.AddRow("E_1", `said "urgent"`)
+	return &export.Document{Name: "stock", Tables: []export.Table{totals, entries}}
+}
+
+func TestCSVListsTablesInTurn(t *testing.T) {
+	writer, ok := export.Lookup("csv")
+	if !ok {
+		t.Fatal("csv is not registered")
+	}
+	buf := &bytes.Buffer{}
+	if err := export.Write(buf, "csv", writer, stockDocument()); err != nil {
+		t.Fatal(err)
+	}
+	want := "Totals\nCompound,Quantity\n\"Acetone, dry\",150\nBenzene,2.5\n\nEntries\nEntry,Remark\nE_1,\"said \"\"urgent\"\"\"\n"
+	if buf.String() != want {
+		t.Errorf("CSV\n%s\nwant\n%s", buf, want)
+	}
+}
+
+func TestRegisteredFormatIsOfferedAndLayoutsWin(t *testing.T) {
+	export.Register("tsv", tsvWriter{})
+	if !slices.Contains(export.Formats(), "tsv") {
+		t.Errorf("formats %q", export.Formats())
+	}
+
+	doc := stockDocument()
+	buf := &bytes.Buffer{}
+	if err := export.Write(buf, "tsv", tsvWriter{}, doc); err != nil || buf.String() != "Compound" {
+		t.Errorf("tsv %q, %v", buf, err)
+	}
+
+	doc.Layouts = map[string]func(w io.Writer) error{
+		"tsv": func(w io.Writer) error {
+			_, err := io.WriteString(w, "by hand")
+			return err
+		},
+	}
+	buf.Reset()
+	if err := export.Write(buf, "tsv", tsvWriter{}, doc); err != nil || buf.String() != "by hand" {
+		t.Errorf("tsv layout %q, %v", buf, err)
+	}
+}
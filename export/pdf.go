@@ -0,0 +1,76 @@
+package export
+
+import (
+	"chemical-ledger-backend/utils"
+	"io"
+)
+
+const (
+	pdfFontSize   = 8.0
+	pdfLineHeight = 12.0
+)
+
+// Prints the tables one after another, their columns sharing the width of the page. Documents laid out for print
+// give a layout of their own instead.
+type PDFWriter struct{}
+
+func (PDFWriter) ContentType() string { return "application/pdf" }
+
+func (PDFWriter) Extension() string { return "pdf" }
+
+func (PDFWriter) Write(w io.Writer, doc *Document) error {
+	pdf := utils.NewPDF()
+	right := utils.PDF_PAGE_WIDTH - utils.PDF_MARGIN
+	bottom := utils.PDF_PAGE_HEIGHT - utils.PDF_MARGIN - pdfLineHeight
+	y := utils.PDF_MARGIN + 16
+
+	pdf.Text(utils.PDF_MARGIN, y, 16, true, utils.PDFTruncate(doc.Title, 50))
+	y += 14
+	pdf.TextRight(right, y, 9, false, "Generated: "+doc.GeneratedAt.Format("2006-01-02 15:04"))
+	y += 2 * pdfLineHeight
+
+	for _, table := range doc.Tables {
+		if len(table.Columns) == 0 {
+			continue
+		}
+		width := (right - utils.PDF_MARGIN) / float64(len(table.Columns))
+		maxChars := max(int(width/(pdfFontSize*0.6))-1, 1)
+		header := func() {
+			for i, column := range table.Columns {
+				pdf.Text(utils.PDF_MARGIN+float64(i)*width, y, pdfFontSize, true, utils.PDFTruncate(column, maxChars))
+			}
+			pdf.Line(utils.PDF_MARGIN, right, y+4)
+			y += pdfLineHeight + 2
+		}
+
+		if y > bottom-3*pdfLineHeight {
+			pdf.AddPage()
+			y = utils.PDF_MARGIN + 16
+		}
+		if len(doc.Tables) > 1 {
+			pdf.Text(utils.PDF_MARGIN, y, 11, true, utils.PDFTruncate(table.Name, 60))
+			y += pdfLineHeight + 4
+		}
+		header()
+		for _, row := range table.Rows {
+			if y > bottom {
+				pdf.AddPage()
+				y = utils.PDF_MARGIN + 16
+				header()
+			}
+			for i, cell := range row {
+				text := utils.PDFTruncate(cellString(cell), maxChars)
+				if _, isText := cell.(string); isText || cell == nil {
+					pdf.Text(utils.PDF_MARGIN+float64(i)*width, y, pdfFontSize, false, text)
+				} else {
+					pdf.TextRight(utils.PDF_MARGIN+float64(i+1)*width-4, y, pdfFontSize, false, text)
+				}
+			}
+			y += pdfLineHeight
+		}
+		y += pdfLineHeight
+	}
+
+	_, err := w.Write(pdf.Bytes())
+	return err
+}
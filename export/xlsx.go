@@ -0,0 +1,26 @@
+package export
+
+import (
+	"chemical-ledger-backend/utils"
+	"io"
+)
+
+// Writes each table as a sheet of a workbook
+type XLSXWriter struct{}
+
+func (XLSXWriter) ContentType() string {
+	return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+}
+
+func (XLSXWriter) Extension() string { return "xlsx" }
+
+func (XLSXWriter) Write(w io.Writer, doc *Document) error {
+	workbook := utils.NewXLSX()
+	for _, table := range doc.Tables {
+		sheet := workbook.AddSheet(table.Name, table.Columns...)
+		for _, row := range table.Rows {
+			sheet.AddRow(row...)
+		}
+	}
+	return workbook.Write(w)
+}
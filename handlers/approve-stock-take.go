@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/datetime"
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/stock"
+	"chemical-ledger-backend/utils"
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+type ApproveStockTakeReq struct {
+	StockTakeId string `json:"stock_take_id"`
+}
+
+// Approves an open stock-take. Every counted compound whose count differs from the ledger gets an adjustment
+// entry for the variance at the end of the count date, and the ledger stock it was compared to is kept with the
+// count. The stock-take can no longer change afterwards.
+func ApproveStockTakeHandler(w http.ResponseWriter, r *http.Request) {
+	reqBody := &ApproveStockTakeReq{}
+	if errStr := httpx.DecodeJsonReq(r, reqBody); errStr != utils.NO_ERR {
+		slog.ErrorContext(r.Context(), "failed to decode JSON request", "error", errStr)
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	if reqBody.StockTakeId == "" {
+		slog.ErrorContext(r.Context(), "missing required fields", "stock_take_id", reqBody.StockTakeId)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.MISSING_REQUIRED_FIELDS)
+		return
+	}
+
+	// The variances are taken against the ledger stock, which must stay as it is until the adjustments are in
+	unlock, err := lockStockTakeCompounds(r.Context(), reqBody.StockTakeId)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error locking counted compounds", "stock_take_id", reqBody.StockTakeId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.STOCK_TAKE_RETRIEVAL_ERR)
+		return
+	}
+	defer unlock()
+
+	report, errStr := getStockTake(r.Context(), reqBody.StockTakeId)
+	if errStr == utils.INVALID_STOCK_TAKE_ID {
+		httpx.RespWithError(w, http.StatusNotFound, errStr)
+		return
+	}
+	if errStr != utils.NO_ERR {
+		httpx.RespWithError(w, http.StatusInternalServerError, errStr)
+		return
+	}
+	if report.Status != utils.STOCK_TAKE_STATUS_OPEN {
+		slog.ErrorContext(r.Context(), "stock-take is closed", "stock_take_id", report.Id, "status", report.Status)
+		httpx.RespWithError(w, http.StatusConflict, utils.STOCK_TAKE_CLOSED)
+		return
+	}
+	if len(report.Lines) == 0 {
+		slog.ErrorContext(r.Context(), "stock-take has no counts", "stock_take_id", report.Id)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.STOCK_TAKE_EMPTY)
+		return
+	}
+
+	tx, err := db.ConnFrom(r.Context()).BeginTx(r.Context(), nil)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error starting transaction", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.TX_START_ERR)
+		return
+	}
+	defer tx.Rollback()
+
+	actorId := currentUser(r).Id
+	approvedAt := datetime.Now(r.Context()).Unix()
+	// Guards against counts or approvals that came in since the report was read
+	result, err := tx.ExecContext(r.Context(),
+		"UPDATE stock_take SET status = ?, approved_by = ?, approved_at = ? WHERE id = ? AND status = ?",
+		utils.STOCK_TAKE_STATUS_APPROVED, actorId, approvedAt, report.Id, utils.STOCK_TAKE_STATUS_OPEN,
+	)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error approving stock-take", "stock_take_id", report.Id, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.STOCK_TAKE_UPDATE_ERR)
+		return
+	}
+	if approved, _ := result.RowsAffected(); approved != 1 {
+		slog.ErrorContext(r.Context(), "stock-take closed while approving", "stock_take_id", report.Id)
+		httpx.RespWithError(w, http.StatusConflict, utils.STOCK_TAKE_CLOSED)
+		return
+	}
+
+	countDate, _ := time.ParseInLocation("2006-01-02", report.Date, time.Local)
+	adjustmentDate := countDate.AddDate(0, 0, 1).Unix() - 1
+	if status, errStr := checkEntryDatesUnlocked(r.Context(), adjustmentDate); errStr != utils.NO_ERR {
+		httpx.RespWithError(w, status, errStr)
+		return
+	}
+	reason := "Stock-take " + report.Id
+	if report.Remark != "" {
+		reason += ": " + report.Remark
+	}
+
+	for i := range report.Lines {
+		line := &report.Lines[i]
+		if line.Variance != 0 {
+			entryType, quantity := utils.ENTRY_TYPE_ADJUSTMENT_IN, line.Variance
+			if line.Variance < 0 {
+				entryType, quantity = utils.ENTRY_TYPE_ADJUSTMENT_OUT, -line.Variance
+			}
+
+			quantityId := generateQuantityId(r.Context())
+			line.AdjustmentEntryId = generateEntryId(r.Context())
+			if _, err := tx.ExecContext(r.Context(),
+				"INSERT INTO quantity (id, num_of_units, packs_per_unit, quantity_per_unit, partial_quantity) VALUES (?, ?, 1, 1, 0)",
+				quantityId, quantity,
+			); err != nil {
+				slog.ErrorContext(r.Context(), "error inserting stock-take quantity", "stock_take_id", report.Id, "compound_id", line.CompoundId, "error", err)
+				httpx.RespWithError(w, http.StatusInternalServerError, utils.INSERT_QUANTITY_ERR)
+				return
+			}
+
+			if _, err := tx.ExecContext(r.Context(),
+				"INSERT INTO entry (id, type, compound_id, date, remark, voucher_no, quantity_id, net_stock, reason, created_by, seq) VALUES (?, ?, ?, ?, '', '', ?, 0, ?, ?, "+utils.NEXT_ENTRY_SEQ+")",
+				line.AdjustmentEntryId, entryType, line.CompoundId, adjustmentDate, quantityId, reason, actorId,
+			); err != nil {
+				slog.ErrorContext(r.Context(), "error inserting stock-take adjustment", "stock_take_id", report.Id, "compound_id", line.CompoundId, "error", err)
+				httpx.RespWithError(w, http.StatusInternalServerError, utils.INSERT_ENTRY_ERR)
+				return
+			}
+
+			if utils.IsInwardEntryType(entryType) {
+				if _, err := tx.ExecContext(r.Context(),
+					"INSERT INTO lot (id, compound_id, entry_id, lot_no, expiry, supplier) VALUES (?, ?, ?, '', '', '')",
+					generateLotId(r.Context()), line.CompoundId, line.AdjustmentEntryId,
+				); err != nil {
+					slog.ErrorContext(r.Context(), "error inserting stock-take lot", "stock_take_id", report.Id, "compound_id", line.CompoundId, "error", err)
+					httpx.RespWithError(w, http.StatusInternalServerError, utils.INSERT_ENTRY_ERR)
+					return
+				}
+			}
+
+			if errStr := stock.UpdateNetStockFromTodayOnwards(r.Context(), tx, line.CompoundId, adjustmentDate); errStr != utils.NO_ERR {
+				slog.ErrorContext(r.Context(), "error updating net stock", "stock_take_id", report.Id, "compound_id", line.CompoundId, "error", errStr)
+				httpx.RespWithError(w, recalculationErrStatus(errStr), errStr)
+				return
+			}
+		}
+
+		if _, err := tx.ExecContext(r.Context(),
+			"UPDATE stock_take_count SET ledger_stock = ?, adjustment_entry_id = NULLIF(?, '') WHERE stock_take_id = ? AND compound_id = ?",
+			line.LedgerStock, line.AdjustmentEntryId, report.Id, line.CompoundId,
+		); err != nil {
+			slog.ErrorContext(r.Context(), "error updating stock-take count", "stock_take_id", report.Id, "compound_id", line.CompoundId, "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.STOCK_TAKE_UPDATE_ERR)
+			return
+		}
+	}
+
+	utils.RecordAudit(r.Context(), tx, actorId, "stock_take.approve", utils.AUDIT_TARGET_STOCK_TAKE, report.Id, map[string]any{
+		"date":  report.Date,
+		"lines": len(report.Lines),
+	})
+
+	if err := tx.Commit(); err != nil {
+		slog.ErrorContext(r.Context(), "error committing transaction", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.COMMIT_TRANSACTION_ERR)
+		return
+	}
+
+	report.Status = utils.STOCK_TAKE_STATUS_APPROVED
+	report.ApprovedBy = actorId
+	report.ApprovedAt = time.Unix(approvedAt, 0).Format("2006-01-02 15:04:05")
+	httpx.RespWithData(w, http.StatusOK, report)
+}
+
+// Locks the compounds counted in a stock-take, see stock.LockCompounds
+func lockStockTakeCompounds(ctx context.Context, stockTakeId string) (func(), error) {
+	rows, err := db.ConnFrom(ctx).QueryContext(ctx, "SELECT compound_id FROM stock_take_count WHERE stock_take_id = ?", stockTakeId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	compoundIds := []string{}
+	for rows.Next() {
+		var compoundId string
+		if err := rows.Scan(&compoundId); err != nil {
+			return nil, err
+		}
+		compoundIds = append(compoundIds, compoundId)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return stock.LockCompounds(compoundIds...), nil
+}
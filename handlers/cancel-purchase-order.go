@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"database/sql"
+	"log/slog"
+	"net/http"
+)
+
+type CancelPurchaseOrderReq struct {
+	PurchaseOrderId string `json:"purchase_order_id"`
+	Remark          string `json:"remark"`
+}
+
+// Cancels a purchase order nothing was delivered against yet. Orders with deliveries recorded against them, pending
+// ones included, stay as they are so the deliveries keep their order.
+func CancelPurchaseOrderHandler(w http.ResponseWriter, r *http.Request) {
+	reqBody := &CancelPurchaseOrderReq{}
+	if errStr := httpx.DecodeJsonReq(r, reqBody); errStr != utils.NO_ERR {
+		slog.ErrorContext(r.Context(), "failed to decode JSON request", "error", errStr)
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	tx, err := db.ConnFrom(r.Context()).BeginTx(r.Context(), nil)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error starting transaction", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.TX_START_ERR)
+		return
+	}
+	defer tx.Rollback()
+
+	var status string
+	var delivered bool
+	err = tx.QueryRowContext(r.Context(), `
+		SELECT o.status, EXISTS(
+			SELECT 1 FROM entry e
+			JOIN purchase_order_line l ON e.po_line_id = l.id
+			WHERE l.purchase_order_id = o.id AND e.deleted_at IS NULL AND e.status != ?
+		)
+		FROM purchase_order o
+		WHERE o.id = ?`,
+		utils.ENTRY_STATUS_REJECTED, reqBody.PurchaseOrderId,
+	).Scan(&status, &delivered)
+	if err == sql.ErrNoRows {
+		slog.ErrorContext(r.Context(), "purchase order not found", "purchase_order_id", reqBody.PurchaseOrderId)
+		httpx.RespWithError(w, http.StatusNotFound, utils.INVALID_PURCHASE_ORDER_ID)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error retrieving purchase order", "purchase_order_id", reqBody.PurchaseOrderId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.PURCHASE_ORDER_RETRIEVAL_ERR)
+		return
+	}
+
+	if status == utils.PO_STATUS_CANCELLED {
+		slog.WarnContext(r.Context(), "purchase order already cancelled", "purchase_order_id", reqBody.PurchaseOrderId)
+		httpx.RespWithError(w, http.StatusConflict, utils.PURCHASE_ORDER_CANCELLED)
+		return
+	}
+	if delivered {
+		slog.WarnContext(r.Context(), "purchase order with deliveries cannot be cancelled", "purchase_order_id", reqBody.PurchaseOrderId)
+		httpx.RespWithError(w, http.StatusConflict, utils.PURCHASE_ORDER_RECEIVED)
+		return
+	}
+
+	if _, err := tx.ExecContext(r.Context(), "UPDATE purchase_order SET status = ? WHERE id = ?", utils.PO_STATUS_CANCELLED, reqBody.PurchaseOrderId); err != nil {
+		slog.ErrorContext(r.Context(), "error cancelling purchase order", "purchase_order_id", reqBody.PurchaseOrderId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.PURCHASE_ORDER_UPDATE_ERR)
+		return
+	}
+
+	utils.RecordAudit(r.Context(), tx, currentUser(r).Id, "purchase_order.cancel", utils.AUDIT_TARGET_PURCHASE_ORDER, reqBody.PurchaseOrderId, map[string]any{
+		"remark": reqBody.Remark,
+	})
+
+	if err := tx.Commit(); err != nil {
+		slog.ErrorContext(r.Context(), "error committing transaction", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.COMMIT_TRANSACTION_ERR)
+		return
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"purchase_order_id": reqBody.PurchaseOrderId,
+		"status":            utils.PO_STATUS_CANCELLED,
+	})
+}
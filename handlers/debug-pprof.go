@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// Mounts net/http/pprof under /debug/pprof when utils.PprofEnabled, for admins on this machine only: profiles and
+// goroutine dumps show the internals of the backend, which a leaked user token should not expose. Left out of the request timeout,
+// which would cut CPU profiles and traces asked for with "seconds" short.
+func MountProfiler(r chi.Router) {
+	if !utils.PprofEnabled() {
+		return
+	}
+	slog.Warn("profiling endpoints enabled under /debug/pprof for admins on this machine")
+	r.With(requireLoopback, RequireRoles(utils.ROLE_ADMIN), RequestTimeout(0)).Mount("/debug", middleware.Profiler())
+}
+
+// Refuses requests from other machines with 403
+func requireLoopback(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isLocalRequest(r) {
+			slog.WarnContext(r.Context(), "profiling requested from another machine", "remote_addr", r.RemoteAddr)
+			httpx.RespWithError(w, http.StatusForbidden, utils.PPROF_REMOTE)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,56 @@
+package handlers_test
+
+import (
+	"chemical-ledger-backend/handlers"
+	"chemical-ledger-backend/testutils"
+	"chemical-ledger-backend/utils"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestProfilerOnlyForAdminsWhenEnabled(t *testing.T) {
+	env := testutils.NewEnv(t, time.Date(2026, 3, 14, 10, 0, 0, 0, time.Local))
+	if _, err := env.DB.Exec("INSERT INTO user (id, name, role) VALUES ('U_op', 'Operator', 'operator'), ('U_admin', 'Admin', 'admin')"); err != nil {
+		t.Fatal(err)
+	}
+
+	router := func() http.Handler {
+		r := chi.NewRouter()
+		r.Use(handlers.IdentifyUserMiddleware)
+		handlers.MountProfiler(r)
+		return r
+	}
+	get := func(r http.Handler, userId string, remoteAddr string) *httptest.ResponseRecorder {
+		req := env.Request(http.MethodGet, "/debug/pprof/cmdline", nil)
+		env.SignIn(req, userId)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := get(router(), utils.LOCAL_USER_ID, "127.0.0.1:51234"); w.Code != http.StatusNotFound {
+		t.Errorf("disabled: status %d, %s", w.Code, w.Body)
+	}
+
+	t.Setenv("PPROF", "true")
+	r := router()
+	if w := get(r, "U_op", "127.0.0.1:51234"); w.Code != http.StatusForbidden {
+		t.Errorf("operator: status %d, %s", w.Code, w.Body)
+	}
+	if w := get(r, utils.LOCAL_USER_ID, "127.0.0.1:51234"); w.Code != http.StatusOK || w.Body.Len() == 0 {
+		t.Errorf("local administrator: status %d, %s", w.Code, w.Body)
+	}
+	// Not even admins signed in from other machines
+	if w := get(r, "U_admin", "192.168.1.20:51234"); w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), utils.PPROF_REMOTE) {
+		t.Errorf("admin from another machine: status %d, %s", w.Code, w.Body)
+	}
+	if w := get(r, "", "192.168.1.20:51234"); w.Code == http.StatusOK {
+		t.Errorf("no user from another machine: status %d, %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"context"
+	"database/sql"
+	"log/slog"
+	"net/http"
+)
+
+// Deletes a compound created by mistake, with its attachments. Compounds with entries, even deleted ones, stock-take
+// counts, purchase order or invoice lines or reservations keep their history and are refused; archive them with
+// "archived" on /update-compound instead. Admins and supervisors only; every deletion is audited.
+func DeleteCompoundHandler(w http.ResponseWriter, r *http.Request) {
+	compoundId := httpx.GetParam(r, "id")
+
+	var name string
+	var inUse bool
+	err := db.ConnFrom(r.Context()).QueryRowContext(r.Context(), `
+		SELECT name,
+			EXISTS(SELECT 1 FROM entry WHERE compound_id = compound.id)
+			OR EXISTS(SELECT 1 FROM stock_take_count WHERE compound_id = compound.id)
+			OR EXISTS(SELECT 1 FROM purchase_order_line WHERE compound_id = compound.id)
+			OR EXISTS(SELECT 1 FROM invoice_line WHERE compound_id = compound.id)
+			OR EXISTS(SELECT 1 FROM reservation WHERE compound_id = compound.id)
+		FROM compound WHERE id = ?`,
+		compoundId,
+	).Scan(&name, &inUse)
+	if err == sql.ErrNoRows {
+		slog.WarnContext(r.Context(), "compound not found", "compound_id", compoundId)
+		httpx.RespWithError(w, http.StatusNotFound, utils.INVALID_COMPOUND_ID)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to check compound usage", "compound_id", compoundId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.COMPOUND_RETRIEVAL_ERR)
+		return
+	}
+	if inUse {
+		slog.WarnContext(r.Context(), "compound has history", "compound_id", compoundId)
+		httpx.RespWithError(w, http.StatusNotAcceptable, utils.COMPOUND_IN_USE)
+		return
+	}
+
+	attachmentIds, err := getAttachmentIds(r.Context(), compoundId)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to retrieve attachments of compound", "compound_id", compoundId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.ATTACHMENT_RETRIEVAL_ERR)
+		return
+	}
+
+	if _, err := db.ConnFrom(r.Context()).ExecContext(r.Context(), "DELETE FROM attachment WHERE compound_id = ?; DELETE FROM compound WHERE id = ?", compoundId, compoundId); err != nil {
+		slog.ErrorContext(r.Context(), "failed to delete compound", "compound_id", compoundId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.COMPOUND_DELETE_ERR)
+		return
+	}
+	// The compound is gone either way, files left behind are only logged
+	if err := utils.RemoveAttachmentFiles(attachmentIds); err != nil {
+		slog.ErrorContext(r.Context(), "failed to remove attachment files of deleted compound", "compound_id", compoundId, "error", err)
+	}
+
+	utils.RecordAudit(r.Context(), nil, currentUser(r).Id, "compound.delete", utils.AUDIT_TARGET_COMPOUND, compoundId, map[string]any{
+		"name":        name,
+		"attachments": attachmentIds,
+	})
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"compound_id": compoundId,
+	})
+}
+
+func getAttachmentIds(ctx context.Context, compoundId string) ([]string, error) {
+	rows, err := db.ConnFrom(ctx).QueryContext(ctx, "SELECT id FROM attachment WHERE compound_id = ?", compoundId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+)
+
+// Revokes a delegation. The delegation is kept, flagged as revoked, so the audit trail stays readable.
+func DeleteDelegationHandler(w http.ResponseWriter, r *http.Request) {
+	delegationId := httpx.GetParam(r, "id")
+	if delegationId == "" {
+		slog.WarnContext(r.Context(), "missing required field", "field", "id")
+		httpx.RespWithError(w, http.StatusBadRequest, utils.MISSING_REQUIRED_FIELDS)
+		return
+	}
+
+	var delegatorId string
+	err := db.ConnFrom(r.Context()).QueryRowContext(r.Context(), "SELECT delegator_id FROM delegation WHERE id = ? AND revoked = 0", delegationId).Scan(&delegatorId)
+	if errors.Is(err, sql.ErrNoRows) {
+		slog.WarnContext(r.Context(), "delegation not found", "delegation_id", delegationId)
+		httpx.RespWithError(w, http.StatusNotFound, utils.INVALID_DELEGATION_ID)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get delegation", "delegation_id", delegationId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.DELEGATION_RETRIEVAL_ERR)
+		return
+	}
+
+	actor := currentUser(r)
+	if delegatorId != actor.Id && actor.Role != utils.ROLE_ADMIN {
+		slog.WarnContext(r.Context(), "revoking another user's delegation", "actor_id", actor.Id, "delegation_id", delegationId)
+		httpx.RespWithError(w, http.StatusForbidden, utils.FORBIDDEN_ROLE)
+		return
+	}
+
+	if _, err := db.ConnFrom(r.Context()).ExecContext(r.Context(), "UPDATE delegation SET revoked = 1 WHERE id = ?", delegationId); err != nil {
+		slog.ErrorContext(r.Context(), "failed to revoke delegation", "delegation_id", delegationId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.DELEGATION_UPDATE_ERR)
+		return
+	}
+
+	utils.RecordAudit(r.Context(), nil, actor.Id, "delegation.revoke", utils.AUDIT_TARGET_DELEGATION, delegationId, nil)
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"delegation_id": delegationId,
+	})
+}
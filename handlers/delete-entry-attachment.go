@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"database/sql"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Removes a voucher scan from an entry, e.g. one uploaded to the wrong entry, along with its file. Scans of entries
+// in a locked month stay. Admins and supervisors only; every removal is audited.
+func DeleteEntryAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	entryId := chi.URLParam(r, "id")
+	attachmentId := chi.URLParam(r, "attachment_id")
+
+	tx, err := db.ConnFrom(r.Context()).BeginTx(r.Context(), nil)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error starting transaction", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.TX_START_ERR)
+		return
+	}
+	defer tx.Rollback()
+
+	var filename string
+	var date int64
+	err = tx.QueryRowContext(r.Context(), `
+		SELECT a.filename, e.date
+		FROM attachment a
+		JOIN entry e ON e.id = a.entry_id
+		WHERE a.id = ? AND a.entry_id = ?`,
+		attachmentId, entryId,
+	).Scan(&filename, &date)
+	if err == sql.ErrNoRows {
+		slog.WarnContext(r.Context(), "attachment not found", "entry_id", entryId, "attachment_id", attachmentId)
+		httpx.RespWithError(w, http.StatusNotFound, utils.ATTACHMENT_NOT_FOUND)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to retrieve attachment", "entry_id", entryId, "attachment_id", attachmentId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.ATTACHMENT_RETRIEVAL_ERR)
+		return
+	}
+	if status, errStr := checkEntryDatesUnlocked(r.Context(), date); errStr != utils.NO_ERR {
+		httpx.RespWithError(w, status, errStr)
+		return
+	}
+
+	if _, err := tx.ExecContext(r.Context(), "DELETE FROM attachment WHERE id = ?", attachmentId); err != nil {
+		slog.ErrorContext(r.Context(), "failed to delete attachment", "entry_id", entryId, "attachment_id", attachmentId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.ATTACHMENT_DELETE_ERR)
+		return
+	}
+
+	utils.RecordAudit(r.Context(), tx, currentUser(r).Id, "entry.attachment_delete", utils.AUDIT_TARGET_ENTRY, entryId, map[string]any{
+		"attachment_id": attachmentId,
+		"filename":      filename,
+	})
+
+	if err := tx.Commit(); err != nil {
+		slog.ErrorContext(r.Context(), "error committing transaction", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.COMMIT_TRANSACTION_ERR)
+		return
+	}
+
+	// The record is gone, a file left behind only takes up space
+	if err := utils.RemoveAttachmentFiles([]string{attachmentId}); err != nil {
+		slog.ErrorContext(r.Context(), "failed to remove attachment file", "entry_id", entryId, "attachment_id", attachmentId, "error", err)
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"entry_id":      entryId,
+		"attachment_id": attachmentId,
+	})
+}
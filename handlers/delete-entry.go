@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/datetime"
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/stock"
+	"chemical-ledger-backend/utils"
+	"database/sql"
+	"log/slog"
+	"net/http"
+)
+
+// Moves an entry to the trash: it is kept with the time and user of the deletion but left out of every listing,
+// report and stock calculation until restored. The stock is recalculated from the entry onwards, so an incoming
+// entry whose stock was already issued cannot be deleted.
+func DeleteEntryHandler(w http.ResponseWriter, r *http.Request) {
+	entryId := httpx.GetParam(r, "id")
+	if entryId == "" {
+		slog.ErrorContext(r.Context(), "missing required fields", "id", entryId)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.MISSING_REQUIRED_FIELDS)
+		return
+	}
+
+	unlock, err := stock.LockEntryCompounds(r.Context(), []string{entryId})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error locking compounds of entries", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.ENTRY_RETRIEVAL_ERR)
+		return
+	}
+	defer unlock()
+
+	tx, err := db.ConnFrom(r.Context()).BeginTx(r.Context(), nil)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error starting transaction", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.TX_START_ERR)
+		return
+	}
+	defer tx.Rollback()
+
+	var compoundId string
+	var date int64
+	err = tx.QueryRowContext(r.Context(), "SELECT compound_id, date FROM entry WHERE id = ? AND deleted_at IS NULL", entryId).Scan(&compoundId, &date)
+	if err == sql.ErrNoRows {
+		slog.ErrorContext(r.Context(), "entry not found", "entry_id", entryId)
+		httpx.RespWithError(w, http.StatusNotFound, utils.INVALID_ENTRY_ID)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error retrieving entry", "entry_id", entryId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.ENTRY_RETRIEVAL_ERR)
+		return
+	}
+	if status, errStr := checkEntryDatesUnlocked(r.Context(), date); errStr != utils.NO_ERR {
+		httpx.RespWithError(w, status, errStr)
+		return
+	}
+
+	actor := currentUser(r)
+	if _, err := tx.ExecContext(r.Context(),
+		"UPDATE entry SET deleted_at = ?, deleted_by = ? WHERE id = ?",
+		datetime.Now(r.Context()).Unix(), actor.Id, entryId,
+	); err != nil {
+		slog.ErrorContext(r.Context(), "error deleting entry", "entry_id", entryId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.ENTRY_DELETE_ERR)
+		return
+	}
+
+	if errStr := stock.UpdateNetStockFromTodayOnwards(r.Context(), tx, compoundId, date); errStr != utils.NO_ERR {
+		slog.ErrorContext(r.Context(), "error updating net stock after deletion", "compound_id", compoundId, "error", errStr)
+		httpx.RespWithError(w, recalculationErrStatus(errStr), errStr)
+		return
+	}
+
+	utils.RecordAudit(r.Context(), tx, actor.Id, "entry.delete", utils.AUDIT_TARGET_ENTRY, entryId, nil)
+
+	if err := tx.Commit(); err != nil {
+		slog.ErrorContext(r.Context(), "error committing transaction", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.COMMIT_TRANSACTION_ERR)
+		return
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"entry_id": entryId,
+	})
+}
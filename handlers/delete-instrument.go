@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"log/slog"
+	"net/http"
+)
+
+func DeleteInstrumentHandler(w http.ResponseWriter, r *http.Request) {
+	instrumentId := httpx.GetParam(r, "id")
+
+	if errStr := validateInstrumentIdField(r.Context(), instrumentId); errStr != utils.NO_ERR {
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	var inUse bool
+	if err := db.ConnFrom(r.Context()).QueryRowContext(r.Context(), "SELECT EXISTS(SELECT 1 FROM entry WHERE instrument_id = ?)", instrumentId).Scan(&inUse); err != nil {
+		slog.ErrorContext(r.Context(), "failed to check instrument usage", "instrument_id", instrumentId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.INSTRUMENT_RETRIEVAL_ERR)
+		return
+	}
+	if inUse {
+		slog.WarnContext(r.Context(), "instrument is linked to entries", "instrument_id", instrumentId)
+		httpx.RespWithError(w, http.StatusNotAcceptable, utils.INSTRUMENT_IN_USE)
+		return
+	}
+
+	if _, err := db.ConnFrom(r.Context()).ExecContext(r.Context(), "DELETE FROM instrument WHERE id = ?", instrumentId); err != nil {
+		slog.ErrorContext(r.Context(), "failed to delete instrument", "instrument_id", instrumentId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.INSTRUMENT_DELETE_ERR)
+		return
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"instrument_id": instrumentId,
+	})
+}
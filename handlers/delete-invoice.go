@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"log/slog"
+	"net/http"
+)
+
+// Deletes an invoice entered by mistake, with its lines
+func DeleteInvoiceHandler(w http.ResponseWriter, r *http.Request) {
+	invoiceId := httpx.GetParam(r, "id")
+
+	tx, err := db.ConnFrom(r.Context()).BeginTx(r.Context(), nil)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error starting transaction", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.TX_START_ERR)
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(r.Context(), "DELETE FROM invoice_line WHERE invoice_id = ?", invoiceId); err != nil {
+		slog.ErrorContext(r.Context(), "error deleting invoice lines", "invoice_id", invoiceId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.DELETE_INVOICE_ERR)
+		return
+	}
+	result, err := tx.ExecContext(r.Context(), "DELETE FROM invoice WHERE id = ?", invoiceId)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error deleting invoice", "invoice_id", invoiceId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.DELETE_INVOICE_ERR)
+		return
+	}
+	if deleted, _ := result.RowsAffected(); deleted == 0 {
+		slog.WarnContext(r.Context(), "invoice not found", "invoice_id", invoiceId)
+		httpx.RespWithError(w, http.StatusNotFound, utils.INVALID_INVOICE_ID)
+		return
+	}
+
+	utils.RecordAudit(r.Context(), tx, currentUser(r).Id, "invoice.delete", utils.AUDIT_TARGET_INVOICE, invoiceId, nil)
+
+	if err := tx.Commit(); err != nil {
+		slog.ErrorContext(r.Context(), "error committing transaction", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.COMMIT_TRANSACTION_ERR)
+		return
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"invoice_id": invoiceId,
+	})
+}
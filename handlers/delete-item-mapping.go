@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Removes the mapping of an item code of an inbound source, so its events are refused until it is mapped again.
+// Entries already recorded through it stay. Admins only; every removal is audited.
+func DeleteItemMappingHandler(w http.ResponseWriter, r *http.Request) {
+	source := chi.URLParam(r, "source")
+	itemCode := chi.URLParam(r, "item_code")
+
+	tx, err := db.ConnFrom(r.Context()).BeginTx(r.Context(), nil)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error starting transaction", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.TX_START_ERR)
+		return
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(r.Context(), "DELETE FROM item_mapping WHERE source = ? AND item_code = ?", source, itemCode)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to delete item mapping", "source", source, "item_code", itemCode, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.ITEM_MAPPING_UPDATE_ERR)
+		return
+	}
+	if deleted, _ := res.RowsAffected(); deleted == 0 {
+		slog.WarnContext(r.Context(), "item mapping not found", "source", source, "item_code", itemCode)
+		httpx.RespWithError(w, http.StatusNotFound, utils.ITEM_MAPPING_NOT_FOUND)
+		return
+	}
+
+	utils.RecordAudit(r.Context(), tx, currentUser(r).Id, "item_mapping.delete", utils.AUDIT_TARGET_ITEM_MAPPING, source, map[string]any{
+		"item_code": itemCode,
+	})
+
+	if err := tx.Commit(); err != nil {
+		slog.ErrorContext(r.Context(), "error committing transaction", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.COMMIT_TRANSACTION_ERR)
+		return
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"source":    source,
+		"item_code": itemCode,
+	})
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"log/slog"
+	"net/http"
+)
+
+func DeleteLocationHandler(w http.ResponseWriter, r *http.Request) {
+	locationId := httpx.GetParam(r, "id")
+
+	if errStr := validateLocationIdField(r.Context(), locationId); errStr != utils.NO_ERR {
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	var inUse bool
+	if err := db.ConnFrom(r.Context()).QueryRowContext(r.Context(),
+		"SELECT EXISTS(SELECT 1 FROM entry WHERE location_id = ? OR to_location_id = ?)",
+		locationId, locationId,
+	).Scan(&inUse); err != nil {
+		slog.ErrorContext(r.Context(), "failed to check location usage", "location_id", locationId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.LOCATION_RETRIEVAL_ERR)
+		return
+	}
+	if inUse {
+		slog.WarnContext(r.Context(), "location is linked to entries", "location_id", locationId)
+		httpx.RespWithError(w, http.StatusNotAcceptable, utils.LOCATION_IN_USE)
+		return
+	}
+
+	if _, err := db.ConnFrom(r.Context()).ExecContext(r.Context(), "DELETE FROM location WHERE id = ?", locationId); err != nil {
+		slog.ErrorContext(r.Context(), "failed to delete location", "location_id", locationId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.LOCATION_DELETE_ERR)
+		return
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"location_id": locationId,
+	})
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"log/slog"
+	"net/http"
+)
+
+func DeleteProjectHandler(w http.ResponseWriter, r *http.Request) {
+	projectId := httpx.GetParam(r, "id")
+
+	if errStr := validateProjectIdField(r.Context(), projectId); errStr != utils.NO_ERR {
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	var inUse bool
+	if err := db.ConnFrom(r.Context()).QueryRowContext(r.Context(), "SELECT EXISTS(SELECT 1 FROM entry WHERE project_id = ?)", projectId).Scan(&inUse); err != nil {
+		slog.ErrorContext(r.Context(), "failed to check project usage", "project_id", projectId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.PROJECT_RETRIEVAL_ERR)
+		return
+	}
+	if inUse {
+		slog.WarnContext(r.Context(), "project is linked to entries", "project_id", projectId)
+		httpx.RespWithError(w, http.StatusNotAcceptable, utils.PROJECT_IN_USE)
+		return
+	}
+
+	if _, err := db.ConnFrom(r.Context()).ExecContext(r.Context(), "DELETE FROM project WHERE id = ?", projectId); err != nil {
+		slog.ErrorContext(r.Context(), "failed to delete project", "project_id", projectId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.PROJECT_DELETE_ERR)
+		return
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"project_id": projectId,
+	})
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"log/slog"
+	"net/http"
+)
+
+func DeleteRecipientHandler(w http.ResponseWriter, r *http.Request) {
+	recipientId := httpx.GetParam(r, "id")
+
+	if errStr := validateRecipientIdField(r.Context(), recipientId); errStr != utils.NO_ERR {
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	var inUse bool
+	if err := db.ConnFrom(r.Context()).QueryRowContext(r.Context(), "SELECT EXISTS(SELECT 1 FROM entry WHERE recipient_id = ?)", recipientId).Scan(&inUse); err != nil {
+		slog.ErrorContext(r.Context(), "failed to check recipient usage", "recipient_id", recipientId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.RECIPIENT_RETRIEVAL_ERR)
+		return
+	}
+	if inUse {
+		slog.WarnContext(r.Context(), "recipient is linked to entries", "recipient_id", recipientId)
+		httpx.RespWithError(w, http.StatusNotAcceptable, utils.RECIPIENT_IN_USE)
+		return
+	}
+
+	if _, err := db.ConnFrom(r.Context()).ExecContext(r.Context(), "DELETE FROM recipient WHERE id = ?", recipientId); err != nil {
+		slog.ErrorContext(r.Context(), "failed to delete recipient", "recipient_id", recipientId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.RECIPIENT_DELETE_ERR)
+		return
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"recipient_id": recipientId,
+	})
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/datetime"
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+)
+
+// Cancels a reservation still held, giving its quantity back to what is available. The reservation is kept, marked
+// as cancelled, so the audit trail stays readable. Users cancel their own reservations, admins and supervisors any.
+func DeleteReservationHandler(w http.ResponseWriter, r *http.Request) {
+	reservationId := httpx.GetParam(r, "id")
+	if reservationId == "" {
+		slog.WarnContext(r.Context(), "missing required field", "field", "id")
+		httpx.RespWithError(w, http.StatusBadRequest, utils.MISSING_REQUIRED_FIELDS)
+		return
+	}
+
+	today := datetime.Now(r.Context()).Format("2006-01-02")
+	var reservedBy string
+	err := db.ConnFrom(r.Context()).QueryRowContext(r.Context(),
+		"SELECT reserved_by FROM reservation WHERE id = ? AND cancelled_at IS NULL AND needed_on >= ?",
+		reservationId, today,
+	).Scan(&reservedBy)
+	if errors.Is(err, sql.ErrNoRows) {
+		slog.WarnContext(r.Context(), "reservation not found or no longer held", "reservation_id", reservationId)
+		httpx.RespWithError(w, http.StatusNotFound, utils.INVALID_RESERVATION_ID)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get reservation", "reservation_id", reservationId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.RESERVATION_RETRIEVAL_ERR)
+		return
+	}
+
+	actor := currentUser(r)
+	if reservedBy != actor.Id && actor.Role != utils.ROLE_ADMIN && actor.Role != utils.ROLE_SUPERVISOR {
+		slog.WarnContext(r.Context(), "cancelling another user's reservation", "actor_id", actor.Id, "reservation_id", reservationId)
+		httpx.RespWithError(w, http.StatusForbidden, utils.RESERVATION_NOT_OWN)
+		return
+	}
+
+	result, err := db.ConnFrom(r.Context()).ExecContext(r.Context(),
+		"UPDATE reservation SET cancelled_at = ?, cancelled_by = ? WHERE id = ? AND cancelled_at IS NULL",
+		datetime.Now(r.Context()).Unix(), actor.Id, reservationId,
+	)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to cancel reservation", "reservation_id", reservationId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.RESERVATION_UPDATE_ERR)
+		return
+	}
+	if cancelled, err := result.RowsAffected(); err != nil || cancelled == 0 {
+		slog.WarnContext(r.Context(), "reservation cancelled meanwhile", "reservation_id", reservationId, "error", err)
+		httpx.RespWithError(w, http.StatusNotFound, utils.INVALID_RESERVATION_ID)
+		return
+	}
+
+	utils.RecordAudit(r.Context(), nil, actor.Id, "reservation.cancel", utils.AUDIT_TARGET_RESERVATION, reservationId, nil)
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"reservation_id": reservationId,
+	})
+}
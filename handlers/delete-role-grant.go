@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/datetime"
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"log/slog"
+	"net/http"
+)
+
+// Revokes a role grant before it expires. The grant is kept, marked as revoked, so the audit trail stays readable.
+// Admins only.
+func DeleteRoleGrantHandler(w http.ResponseWriter, r *http.Request) {
+	roleGrantId := httpx.GetParam(r, "id")
+	if roleGrantId == "" {
+		slog.WarnContext(r.Context(), "missing required field", "field", "id")
+		httpx.RespWithError(w, http.StatusBadRequest, utils.MISSING_REQUIRED_FIELDS)
+		return
+	}
+
+	actor := currentUser(r)
+	now := datetime.Now(r.Context()).Unix()
+	result, err := db.ConnFrom(r.Context()).ExecContext(r.Context(),
+		"UPDATE role_grant SET revoked_at = ?, revoked_by = ? WHERE id = ? AND revoked_at IS NULL AND expires_at > ?",
+		now, actor.Id, roleGrantId, now,
+	)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to revoke role grant", "role_grant_id", roleGrantId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.ROLE_GRANT_UPDATE_ERR)
+		return
+	}
+	if revoked, err := result.RowsAffected(); err != nil || revoked == 0 {
+		slog.WarnContext(r.Context(), "role grant not found or no longer active", "role_grant_id", roleGrantId, "error", err)
+		httpx.RespWithError(w, http.StatusNotFound, utils.INVALID_ROLE_GRANT_ID)
+		return
+	}
+
+	utils.RecordAudit(r.Context(), nil, actor.Id, "role_grant.revoke", utils.AUDIT_TARGET_ROLE_GRANT, roleGrantId, nil)
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"role_grant_id": roleGrantId,
+	})
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"log/slog"
+	"net/http"
+)
+
+func DeleteSupplierHandler(w http.ResponseWriter, r *http.Request) {
+	supplierId := httpx.GetParam(r, "id")
+
+	if errStr := validateSupplierIdField(r.Context(), supplierId); errStr != utils.NO_ERR {
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	var inUse bool
+	if err := db.ConnFrom(r.Context()).QueryRowContext(r.Context(), "SELECT EXISTS(SELECT 1 FROM entry WHERE supplier_id = ?) OR EXISTS(SELECT 1 FROM purchase_order WHERE supplier_id = ?) OR EXISTS(SELECT 1 FROM invoice WHERE supplier_id = ?)", supplierId, supplierId, supplierId).Scan(&inUse); err != nil {
+		slog.ErrorContext(r.Context(), "failed to check supplier usage", "supplier_id", supplierId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.SUPPLIER_RETRIEVAL_ERR)
+		return
+	}
+	if inUse {
+		slog.WarnContext(r.Context(), "supplier is linked to entries", "supplier_id", supplierId)
+		httpx.RespWithError(w, http.StatusNotAcceptable, utils.SUPPLIER_IN_USE)
+		return
+	}
+
+	if _, err := db.ConnFrom(r.Context()).ExecContext(r.Context(), "DELETE FROM supplier WHERE id = ?", supplierId); err != nil {
+		slog.ErrorContext(r.Context(), "failed to delete supplier", "supplier_id", supplierId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.SUPPLIER_DELETE_ERR)
+		return
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"supplier_id": supplierId,
+	})
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/datetime"
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"log/slog"
+	"net/http"
+)
+
+// Revokes a user token, e.g. one that was lost, after which requests sending it are refused. The token is kept,
+// marked as revoked, so the audit trail stays readable. Admins only.
+func DeleteUserTokenHandler(w http.ResponseWriter, r *http.Request) {
+	tokenId := httpx.GetParam(r, "id")
+	if tokenId == "" {
+		slog.WarnContext(r.Context(), "missing required field", "field", "id")
+		httpx.RespWithError(w, http.StatusBadRequest, utils.MISSING_REQUIRED_FIELDS)
+		return
+	}
+
+	actor := currentUser(r)
+	result, err := db.ConnFrom(r.Context()).ExecContext(r.Context(),
+		"UPDATE user_token SET revoked_at = ?, revoked_by = ? WHERE id = ? AND revoked_at IS NULL",
+		datetime.Now(r.Context()).Unix(), actor.Id, tokenId,
+	)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to revoke user token", "token_id", tokenId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.USER_TOKEN_UPDATE_ERR)
+		return
+	}
+	if revoked, err := result.RowsAffected(); err != nil || revoked == 0 {
+		slog.WarnContext(r.Context(), "user token not found or already revoked", "token_id", tokenId, "error", err)
+		httpx.RespWithError(w, http.StatusNotFound, utils.INVALID_USER_TOKEN_ID)
+		return
+	}
+
+	utils.RecordAudit(r.Context(), nil, actor.Id, "user_token.revoke", utils.AUDIT_TARGET_USER_TOKEN, tokenId, nil)
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"token_id": tokenId,
+	})
+}
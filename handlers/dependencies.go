@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/datetime"
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/idgen"
+	"chemical-ledger-backend/utils"
+	"context"
+	"database/sql"
+	"net/http"
+)
+
+// What the handlers depend on besides the request, handed to them in its context rather than through globals, so
+// each test can hand them its own
+type Dependencies struct {
+	// Database the requests work on, see db.ConnFrom
+	DB *sql.DB
+	// Clock dating entries, records and exports, see datetime.Now
+	Clock datetime.Clock
+	// Generator of record IDs, see utils.NewId
+	IDs idgen.Generator
+	// Tenants hosted in multi-tenant mode, nil otherwise, see TenantMiddleware
+	Tenants *db.Tenants
+}
+
+// Dependencies of the running application: the given database, the system clock, and ULIDs timed by it
+func NewDependencies(conn *sql.DB) Dependencies {
+	clock := datetime.SystemClock{}
+	return Dependencies{DB: conn, Clock: clock, IDs: &idgen.ULIDs{Now: clock.Now}}
+}
+
+// Context carrying the dependencies, for the scheduled jobs to run with the same ones as the requests
+func (d Dependencies) Context(ctx context.Context) context.Context {
+	ctx = utils.WithIDs(datetime.WithClock(db.WithConn(ctx, d.DB), d.Clock), d.IDs)
+	if d.Tenants != nil {
+		ctx = db.WithTenants(ctx, d.Tenants)
+	}
+	return ctx
+}
+
+// Hands the dependencies to every request. Goes first, so the middlewares after it use them too.
+func DependenciesMiddleware(d Dependencies) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(d.Context(r.Context())))
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"log/slog"
+	"net/http"
+)
+
+const DISK_SPACE_WARNING_HEADER = "X-Disk-Space-Warning"
+
+// Adds the "X-Disk-Space-Warning" header while the disk is running full, e.g. "512 MB of disk space left", and
+// refuses changes with 503 once it is read-only. Reads still go through, so the ledger can be looked up and
+// exported while space is freed.
+func DiskGuardMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := utils.GetDiskStatus()
+		if notice := status.Notice(); notice != "" {
+			w.Header().Set(DISK_SPACE_WARNING_HEADER, notice)
+		}
+
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			if status != nil && status.ReadOnly {
+				slog.WarnContext(r.Context(), "refusing change, disk space low", "method", r.Method, "path", r.URL.Path, "free_mb", status.FreeMB)
+				httpx.RespWithError(w, http.StatusServiceUnavailable, utils.DISK_SPACE_READ_ONLY)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,63 @@
+package handlers_test
+
+import (
+	"chemical-ledger-backend/handlers"
+	"chemical-ledger-backend/testutils"
+	"chemical-ledger-backend/utils"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLowDiskSpaceTurnsAPIReadOnly(t *testing.T) {
+	env := testutils.NewEnv(t, time.Date(2026, 3, 14, 10, 0, 0, 0, time.Local))
+	t.Setenv("DISK_WARN_MB", "1000")
+	t.Setenv("DISK_READ_ONLY_MB", "100")
+
+	env.InsertCompound("C_1", "Acetone", "ml")
+	api := handlers.DiskGuardMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			handlers.GetUnitsHandler(w, r)
+		default:
+			handlers.InsertEntryHandler(w, r)
+		}
+	}))
+	request := func(method string) *httptest.ResponseRecorder {
+		var body *strings.Reader
+		if method == http.MethodGet {
+			body = strings.NewReader("")
+		} else {
+			body = strings.NewReader(`{"type": "incoming", "compound_id": "C_1", "date": "2026-01-05", "num_of_units": 1, "quantity_per_unit": 10}`)
+		}
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, env.Request(method, "/", body))
+		return w
+	}
+
+	testutils.UseFreeDiskSpace(t, 5000)
+	if w := request(http.MethodPost); w.Code != http.StatusOK || w.Header().Get(handlers.DISK_SPACE_WARNING_HEADER) != "" {
+		t.Fatalf("plenty of space: status %d, warning %q, %s", w.Code, w.Header().Get(handlers.DISK_SPACE_WARNING_HEADER), w.Body)
+	}
+
+	testutils.UseFreeDiskSpace(t, 500)
+	if w := request(http.MethodPost); w.Code != http.StatusOK || w.Header().Get(handlers.DISK_SPACE_WARNING_HEADER) != "500 MB of disk space left" {
+		t.Errorf("running low: status %d, warning %q, %s", w.Code, w.Header().Get(handlers.DISK_SPACE_WARNING_HEADER), w.Body)
+	}
+
+	testutils.UseFreeDiskSpace(t, 50)
+	if w := request(http.MethodPost); w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), utils.DISK_SPACE_READ_ONLY) {
+		t.Errorf("read-only: status %d, %s", w.Code, w.Body)
+	}
+	if w := request(http.MethodGet); w.Code != http.StatusOK || !strings.Contains(w.Header().Get(handlers.DISK_SPACE_WARNING_HEADER), "changes are not saved") {
+		t.Errorf("read-only lookup: status %d, warning %q, %s", w.Code, w.Header().Get(handlers.DISK_SPACE_WARNING_HEADER), w.Body)
+	}
+
+	// Freeing space takes changes again
+	testutils.UseFreeDiskSpace(t, 5000)
+	if w := request(http.MethodPost); w.Code != http.StatusOK {
+		t.Errorf("space freed: status %d, %s", w.Code, w.Body)
+	}
+}
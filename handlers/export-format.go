@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"bytes"
+	"chemical-ledger-backend/datetime"
+	"chemical-ledger-backend/export"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+)
+
+// Checks the "format" of a list or report is JSON, the default, or one of the export formats
+func validateExportFormat(ctx context.Context, format string) utils.ErrorMessage {
+	if format == "" || format == REPORT_FORMAT_JSON {
+		return utils.NO_ERR
+	}
+	if _, ok := export.Lookup(format); !ok {
+		slog.ErrorContext(ctx, "invalid report format", "format", format, "formats", export.Formats())
+		return utils.INVALID_REPORT_FORMAT
+	}
+	return utils.NO_ERR
+}
+
+// Whether the format asks for a file rather than the JSON response
+func isExportFormat(format string) bool {
+	return format != "" && format != REPORT_FORMAT_JSON
+}
+
+// Writes a list or report as a file in the given export format, laid out by "document", with the fields hidden from
+// the role of the user blanked as in its JSON response
+func writeRedactedExport[T any](w http.ResponseWriter, r *http.Request, format string, value T, document func(value T) *export.Document) {
+	value, err := utils.RedactForRole(currentUser(r).Role, value)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to redact export", "format", format, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.REDACTION_ERR)
+		return
+	}
+	writeExport(r.Context(), w, format, document(value))
+}
+
+// Cell of an optional value, empty when there is none
+func optionalCell[T any](value *T) any {
+	if value == nil {
+		return nil
+	}
+	return *value
+}
+
+// Name of an export made today, e.g. "valuation-2026-03-31"
+func exportName(ctx context.Context, report string) string {
+	return fmt.Sprintf("%s-%s", report, datetime.Now(ctx).Local().Format("2006-01-02"))
+}
+
+// Writes the document as a file in the given export format, named after the document. A document not dated by its
+// endpoint is dated now, by the clock of the request.
+func writeExport(ctx context.Context, w http.ResponseWriter, format string, doc *export.Document) {
+	writer, ok := export.Lookup(format)
+	if !ok {
+		slog.ErrorContext(ctx, "invalid report format", "format", format)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.INVALID_REPORT_FORMAT)
+		return
+	}
+
+	if doc.GeneratedAt.IsZero() {
+		doc.GeneratedAt = datetime.Now(ctx)
+	}
+
+	// Buffered so a failure can still be reported as a JSON error
+	buf := &bytes.Buffer{}
+	if err := export.Write(buf, format, writer, doc); err != nil {
+		slog.ErrorContext(ctx, "failed to write export", "format", format, "name", doc.Name, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.REPORT_RETRIEVAL_ERR)
+		return
+	}
+
+	w.Header().Set("Content-Type", writer.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", doc.Name+"."+writer.Extension()))
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
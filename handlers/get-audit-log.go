@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"log/slog"
+	"net/http"
+)
+
+// Default and largest number of audit records returned at once
+const (
+	DEFAULT_AUDIT_LOG_LIMIT = 100
+	MAX_AUDIT_LOG_LIMIT     = 1000
+)
+
+// Lists the audit trail, newest first, optionally filtered by "actor_id", "action", "target_type" and "target_id"
+func GetAuditLogHandler(w http.ResponseWriter, r *http.Request) {
+	limit, err := httpx.GetIntParam(r, "limit")
+	if err != nil || limit < 0 || limit > MAX_AUDIT_LOG_LIMIT {
+		slog.ErrorContext(r.Context(), "invalid audit log limit", "limit", httpx.GetParam(r, "limit"), "error", err)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.INVALID_PAGINATION)
+		return
+	}
+	if limit == 0 {
+		limit = DEFAULT_AUDIT_LOG_LIMIT
+	}
+
+	query := `
+		SELECT id, datetime(at, 'unixepoch', 'localtime'), actor_id, action, target_type, target_id, details
+		FROM audit_log
+		WHERE 1 = 1`
+	args := []any{}
+	for _, filter := range []string{"actor_id", "action", "target_type", "target_id"} {
+		if value := httpx.GetParam(r, filter); value != "" {
+			query += " AND " + filter + " = ?"
+			args = append(args, value)
+		}
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := db.ConnFrom(r.Context()).QueryContext(r.Context(), query, args...)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to query audit log", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.AUDIT_RETRIEVAL_ERR)
+		return
+	}
+	defer rows.Close()
+
+	type AuditRecord struct {
+		Id         int    `json:"id"`
+		At         string `json:"at"`
+		ActorId    string `json:"actor_id"`
+		Action     string `json:"action"`
+		TargetType string `json:"target_type"`
+		TargetId   string `json:"target_id"`
+		Details    string `json:"details"`
+	}
+
+	records := []AuditRecord{}
+	for rows.Next() {
+		var a AuditRecord
+		if err := rows.Scan(&a.Id, &a.At, &a.ActorId, &a.Action, &a.TargetType, &a.TargetId, &a.Details); err != nil {
+			slog.ErrorContext(r.Context(), "failed to scan audit row", "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.AUDIT_RETRIEVAL_ERR)
+			return
+		}
+		records = append(records, a)
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"audit_log": records,
+	})
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Lists the files attached to a compound, latest first, e.g. the safety data sheets it has had. The voucher scans of
+// its entries are listed with the entries.
+func GetCompoundAttachmentsHandler(w http.ResponseWriter, r *http.Request) {
+	compoundId := chi.URLParam(r, "id")
+
+	rows, err := db.ConnFrom(r.Context()).QueryContext(r.Context(), `
+		SELECT id, compound_id, kind, filename, content_type, size, sha256, uploaded_by, uploaded_at
+		FROM attachment
+		WHERE compound_id = ? AND entry_id IS NULL
+		ORDER BY uploaded_at DESC, id DESC`,
+		compoundId,
+	)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to query attachments", "compound_id", compoundId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.ATTACHMENT_RETRIEVAL_ERR)
+		return
+	}
+	defer rows.Close()
+
+	attachments := []utils.Attachment{}
+	for rows.Next() {
+		var a utils.Attachment
+		if err := rows.Scan(&a.Id, &a.CompoundId, &a.Kind, &a.Filename, &a.ContentType, &a.Size, &a.Sha256, &a.UploadedBy, &a.UploadedAt); err != nil {
+			slog.ErrorContext(r.Context(), "failed to scan attachment", "compound_id", compoundId, "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.ATTACHMENT_RETRIEVAL_ERR)
+			return
+		}
+		attachments = append(attachments, a)
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"attachments": attachments,
+	})
+}
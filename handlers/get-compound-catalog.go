@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/export"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+// Columns of the compound catalog exchanged with other institutions, as in CAS-keyed ChemIDplus exports. "Unit" is
+// ours: the scale compounds new to the receiving ledger are created with.
+var catalogColumns = []string{"CAS RN", "Name", "Molecular Formula", "Molecular Weight", "Hazard Class", "Unit"}
+
+// Downloads the compounds with a CAS number as a catalog CSV, or in another export "format" such as xlsx, one row per
+// compound by name, to be imported by another ledger with ImportCompoundCatalogHandler. Compounds without a CAS
+// number cannot be matched there and are left out, as are archived compounds unless "include_archived" is set.
+func GetCompoundCatalogHandler(w http.ResponseWriter, r *http.Request) {
+	includeArchived, _ := strconv.ParseBool(httpx.GetParam(r, "include_archived"))
+	format := httpx.GetParam(r, "format")
+	if format == "" {
+		format = "csv"
+	}
+	// The catalog is only ever a file, so JSON is no choice here
+	if _, ok := export.Lookup(format); !ok {
+		slog.ErrorContext(r.Context(), "invalid catalog format", "format", format, "formats", export.Formats())
+		httpx.RespWithError(w, http.StatusBadRequest, utils.INVALID_REPORT_FORMAT)
+		return
+	}
+
+	rows, err := db.ConnFrom(r.Context()).QueryContext(r.Context(), `
+		SELECT cas_no, name, formula, molecular_weight, hazard_class, scale
+		FROM compound
+		WHERE cas_no != '' AND (? OR archived_at IS NULL)
+		ORDER BY lower_case_name ASC`,
+		includeArchived,
+	)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to query compound catalog", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.COMPOUND_RETRIEVAL_ERR)
+		return
+	}
+	defer rows.Close()
+
+	catalog := export.Table{Name: "Catalog", Columns: catalogColumns}
+	for rows.Next() {
+		var casNo, name, formula, hazardClass, scale string
+		var molecularWeight sql.NullFloat64
+		if err := rows.Scan(&casNo, &name, &formula, &molecularWeight, &hazardClass, &scale); err != nil {
+			slog.ErrorContext(r.Context(), "failed to scan catalog row", "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.COMPOUND_RETRIEVAL_ERR)
+			return
+		}
+		weight := ""
+		if molecularWeight.Valid {
+			weight = strconv.FormatFloat(molecularWeight.Float64, 'f', -1, 64)
+		}
+		catalog.AddRow(casNo, name, formula, weight, hazardClass, scale)
+	}
+	if err := rows.Err(); err != nil {
+		slog.ErrorContext(r.Context(), "failed to read compound catalog", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.COMPOUND_RETRIEVAL_ERR)
+		return
+	}
+
+	writeExport(r.Context(), w, format, &export.Document{
+		Name:   exportName(r.Context(), "compound-catalog"),
+		Title:  "Compound catalog",
+		Tables: []export.Table{catalog},
+	})
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Serves the latest safety data sheet of a compound as a PDF to open in the browser, or an earlier one by its
+// "attachment_id" (see GetCompoundAttachmentsHandler).
+func GetCompoundSdsHandler(w http.ResponseWriter, r *http.Request) {
+	compoundId := chi.URLParam(r, "id")
+	attachmentId := httpx.GetParam(r, "attachment_id")
+
+	var filename string
+	err := db.ConnFrom(r.Context()).QueryRowContext(r.Context(), `
+		SELECT id, filename FROM attachment
+		WHERE compound_id = ? AND kind = ? AND (? = '' OR id = ?)
+		ORDER BY uploaded_at DESC, id DESC
+		LIMIT 1`,
+		compoundId, utils.ATTACHMENT_KIND_SDS, attachmentId, attachmentId,
+	).Scan(&attachmentId, &filename)
+	if err == sql.ErrNoRows {
+		slog.WarnContext(r.Context(), "no SDS for compound", "compound_id", compoundId, "attachment_id", attachmentId)
+		httpx.RespWithError(w, http.StatusNotFound, utils.SDS_NOT_FOUND)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to retrieve SDS", "compound_id", compoundId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.ATTACHMENT_RETRIEVAL_ERR)
+		return
+	}
+
+	data, err := utils.ReadAttachment(attachmentId)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to read SDS file", "compound_id", compoundId, "attachment_id", attachmentId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.ATTACHMENT_RETRIEVAL_ERR)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
@@ -2,20 +2,27 @@ package handlers
 
 import (
 	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
 	"chemical-ledger-backend/utils"
 	"database/sql"
 	"log/slog"
 	"net/http"
+	"strconv"
 )
 
 type GetCompoundReq struct {
-	Type string `json:"type"`
+	Type            string `json:"type"`
+	IncludeArchived bool   `json:"include_archived"`
 }
 
+// Lists the compounds to pick from, "all" of them or those that have entries. Archived compounds are left out
+// unless "include_archived" is set.
+
 func GetCompoundHandler(w http.ResponseWriter, r *http.Request) {
 	reqBody := &GetCompoundReq{
-		Type: utils.GetParam(r, "type"),
+		Type: httpx.GetParam(r, "type"),
 	}
+	reqBody.IncludeArchived, _ = strconv.ParseBool(httpx.GetParam(r, "include_archived"))
 
 	const (
 		TYPE_ALL       = "all"
@@ -27,59 +34,79 @@ func GetCompoundHandler(w http.ResponseWriter, r *http.Request) {
 
 	switch reqBody.Type {
 	case TYPE_ALL:
-		rows, err = db.Conn.Query(`
-			SELECT id, name, scale
+		rows, err = db.ConnFrom(r.Context()).QueryContext(r.Context(), `
+			SELECT id, name, scale, min_stock, notes, pinned_warning, category, COALESCE(display_unit, ''), archived_at IS NOT NULL,
+				cas_no, formula, molecular_weight, storage_location, controlled, hazard_class, max_incoming,
+				EXISTS(SELECT 1 FROM attachment a WHERE a.compound_id = compound.id AND a.kind = 'sds')
 			FROM compound
+			WHERE ? OR archived_at IS NULL
 			ORDER BY lower_case_name ASC
-		`)
+		`, reqBody.IncludeArchived)
 	case TYPE_HAS_ENTRY:
-		rows, err = db.Conn.Query(`
-			SELECT c.id, c.name, c.scale
+		rows, err = db.ConnFrom(r.Context()).QueryContext(r.Context(), `
+			SELECT c.id, c.name, c.scale, c.min_stock, c.notes, c.pinned_warning, c.category, COALESCE(c.display_unit, ''), c.archived_at IS NOT NULL,
+				c.cas_no, c.formula, c.molecular_weight, c.storage_location, c.controlled, c.hazard_class, c.max_incoming,
+				EXISTS(SELECT 1 FROM attachment a WHERE a.compound_id = c.id AND a.kind = 'sds')
 			FROM compound AS c
 			WHERE EXISTS (
-				SELECT 1 FROM entry AS e WHERE e.compound_id = c.id
-			)
+				SELECT 1 FROM entry AS e WHERE e.compound_id = c.id AND e.deleted_at IS NULL
+			) AND (? OR c.archived_at IS NULL)
 			ORDER BY c.lower_case_name ASC;
-		`)
+		`, reqBody.IncludeArchived)
 	default:
-		slog.Error("GetCompoundHandler: Invalid compound filter type", slog.String("type", reqBody.Type))
-		utils.RespWithError(w, http.StatusBadRequest, utils.INVALID_COMPOUND_FILTER_TYPE)
+		slog.ErrorContext(r.Context(), "GetCompoundHandler: Invalid compound filter type", slog.String("type", reqBody.Type))
+		httpx.RespWithError(w, http.StatusBadRequest, utils.INVALID_COMPOUND_FILTER_TYPE)
 		return
 	}
 
 	if err != nil {
-		slog.Error("GetCompoundHandler: Failed to execute DB query",
+		slog.ErrorContext(r.Context(), "GetCompoundHandler: Failed to execute DB query",
 			slog.String("type", reqBody.Type),
 			slog.String("error", err.Error()),
 		)
-		utils.RespWithError(w, http.StatusInternalServerError, utils.COMPOUND_RETRIEVAL_ERR)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.COMPOUND_RETRIEVAL_ERR)
 		return
 	}
 
 	defer rows.Close()
 
 	type Compound struct {
-		ID    string `json:"key"`
-		Name  string `json:"name"`
-		Scale string `json:"scale"`
+		ID              string   `json:"key"`
+		Name            string   `json:"name"`
+		Scale           string   `json:"scale"`
+		MinStock        int      `json:"min_stock"`
+		Notes           string   `json:"notes"`
+		PinnedWarning   string   `json:"pinned_warning"`
+		Category        string   `json:"category"`
+		DisplayUnit     string   `json:"display_unit"`
+		Archived        bool     `json:"archived"`
+		CasNo           string   `json:"cas_no"`
+		Formula         string   `json:"formula"`
+		MolecularWeight *float64 `json:"molecular_weight"`
+		StorageLocation string   `json:"storage_location"`
+		Controlled      bool     `json:"controlled"`
+		HazardClass     string   `json:"hazard_class"`
+		MaxIncoming     int      `json:"max_incoming"`
+		HasSds          bool     `json:"has_sds"`
 	}
 
 	compounds := []Compound{}
 	for rows.Next() {
 		var compound Compound
-		err := rows.Scan(&compound.ID, &compound.Name, &compound.Scale)
+		err := rows.Scan(&compound.ID, &compound.Name, &compound.Scale, &compound.MinStock, &compound.Notes, &compound.PinnedWarning, &compound.Category, &compound.DisplayUnit, &compound.Archived,
+			&compound.CasNo, &compound.Formula, &compound.MolecularWeight, &compound.StorageLocation, &compound.Controlled, &compound.HazardClass, &compound.MaxIncoming, &compound.HasSds)
 		if err != nil {
-			slog.Error("GetCompoundHandler: Failed to scan compound row",
+			slog.ErrorContext(r.Context(), "GetCompoundHandler: Failed to scan compound row",
 				slog.String("type", reqBody.Type),
 				slog.String("error", err.Error()),
 			)
-			utils.RespWithError(w, http.StatusInternalServerError, utils.COMPOUND_RETRIEVAL_ERR)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.COMPOUND_RETRIEVAL_ERR)
 			return
 		}
 		compounds = append(compounds, compound)
 	}
 
-	utils.RespWithData(w, http.StatusOK, map[string]any{
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
 		"compounds": compounds,
 	})
 }
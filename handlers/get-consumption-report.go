@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/datetime"
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/export"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"cmp"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// Months of usage the consumption forecast averages over by default, and at most
+const (
+	DEFAULT_CONSUMPTION_MONTHS = 3
+	MAX_CONSUMPTION_MONTHS     = 24
+)
+
+type GetConsumptionReportReq struct {
+	CompoundId string `json:"compound_id"`
+	Months     int    `json:"months"`
+	Format     string `json:"format"`
+}
+
+// Usage of a compound over the window and how long its stock lasts at that pace. The forecast fields are nil when
+// nothing was issued in the window, as the stock then does not run out.
+type Consumption struct {
+	CompoundId          string   `json:"compound_id"`
+	CompoundName        string   `json:"compound_name"`
+	Scale               string   `json:"scale"`
+	NetStock            int      `json:"net_stock"`
+	MinStock            int      `json:"min_stock"`
+	TotalUsage          int      `json:"total_usage"`
+	AverageMonthlyUsage float64  `json:"average_monthly_usage"`
+	DaysUntilStockout   *float64 `json:"days_until_stockout"`
+	StockoutDate        *string  `json:"stockout_date"`
+	DaysUntilMinStock   *float64 `json:"days_until_min_stock"`
+}
+
+// Averages the approved issues of each compound, or of one with "compound_id", over the last "months" months and
+// estimates from the current stock in how many days it runs out and falls below its minimum stock, soonest first,
+// to plan purchases. Archived compounds are left out. The forecast can be downloaded in an export "format" too.
+func GetConsumptionReportHandler(w http.ResponseWriter, r *http.Request) {
+	reqBody := &GetConsumptionReportReq{
+		CompoundId: httpx.GetParam(r, "compound_id"),
+		Format:     httpx.GetParam(r, "format"),
+	}
+	if errStr := validateExportFormat(r.Context(), reqBody.Format); errStr != utils.NO_ERR {
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	reqBody.Months = DEFAULT_CONSUMPTION_MONTHS
+	if httpx.GetParam(r, "months") != "" {
+		months, err := httpx.GetIntParam(r, "months")
+		if err != nil || months < 1 || months > MAX_CONSUMPTION_MONTHS {
+			slog.ErrorContext(r.Context(), "invalid consumption window", "months", httpx.GetParam(r, "months"), "error", err)
+			httpx.RespWithError(w, http.StatusBadRequest, utils.INVALID_CONSUMPTION_WINDOW)
+			return
+		}
+		reqBody.Months = months
+	}
+
+	if reqBody.CompoundId != "" {
+		compoundExists, err := utils.CheckIfCompoundExists(r.Context(), reqBody.CompoundId)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "error checking if compound exists", "compound_id", reqBody.CompoundId, "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.COMPOUND_ID_CHECK_ERR)
+			return
+		}
+		if !compoundExists {
+			slog.ErrorContext(r.Context(), "compound not found", "compound_id", reqBody.CompoundId)
+			httpx.RespWithError(w, http.StatusNotFound, utils.INVALID_COMPOUND_ID)
+			return
+		}
+	}
+
+	now := datetime.Now(r.Context()).Local()
+	windowStart := now.AddDate(0, -reqBody.Months, 0)
+	windowDays := now.Sub(windowStart).Hours() / 24
+
+	rows, err := db.ConnFrom(r.Context()).QueryContext(r.Context(), `
+		SELECT
+			c.id, c.name, c.scale, COALESCE(s.balance, 0), c.min_stock,
+			COALESCE((
+				SELECT SUM(q.total_quantity)
+				FROM entry e
+				JOIN quantity q ON e.quantity_id = q.id
+				WHERE e.compound_id = c.id AND e.type = ? AND e.status = ? AND e.deleted_at IS NULL
+					AND e.date >= ? AND e.date <= ?
+			), 0)
+		FROM compound c
+		LEFT JOIN stock_current s ON s.compound_id = c.id
+		WHERE c.archived_at IS NULL AND (? = '' OR c.id = ?)
+		ORDER BY c.lower_case_name ASC`,
+		utils.ENTRY_TYPE_OUTGOING, utils.ENTRY_STATUS_APPROVED, windowStart.Unix(), now.Unix(),
+		reqBody.CompoundId, reqBody.CompoundId,
+	)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to query consumption report", "months", reqBody.Months, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.REPORT_RETRIEVAL_ERR)
+		return
+	}
+	defer rows.Close()
+
+	round := func(value float64) float64 {
+		return math.Round(value*10) / 10
+	}
+
+	consumption := []Consumption{}
+	for rows.Next() {
+		var c Consumption
+		if err := rows.Scan(&c.CompoundId, &c.CompoundName, &c.Scale, &c.NetStock, &c.MinStock, &c.TotalUsage); err != nil {
+			slog.ErrorContext(r.Context(), "failed to scan consumption row", "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.REPORT_RETRIEVAL_ERR)
+			return
+		}
+		c.AverageMonthlyUsage = round(float64(c.TotalUsage) / float64(reqBody.Months))
+
+		if c.TotalUsage > 0 {
+			dailyUsage := float64(c.TotalUsage) / windowDays
+			daysUntilStockout := round(max(float64(c.NetStock), 0) / dailyUsage)
+			stockoutDate := now.Add(time.Duration(daysUntilStockout * 24 * float64(time.Hour))).Format("2006-01-02")
+			c.DaysUntilStockout, c.StockoutDate = &daysUntilStockout, &stockoutDate
+			if c.MinStock > 0 {
+				daysUntilMinStock := round(max(float64(c.NetStock-c.MinStock), 0) / dailyUsage)
+				c.DaysUntilMinStock = &daysUntilMinStock
+			}
+		}
+		consumption = append(consumption, c)
+	}
+
+	// Compounds running out first come first, those not used in the window last
+	slices.SortStableFunc(consumption, func(a, b Consumption) int {
+		switch {
+		case a.DaysUntilStockout == nil && b.DaysUntilStockout == nil:
+			return 0
+		case a.DaysUntilStockout == nil:
+			return 1
+		case b.DaysUntilStockout == nil:
+			return -1
+		}
+		return cmp.Compare(*a.DaysUntilStockout, *b.DaysUntilStockout)
+	})
+
+	if isExportFormat(reqBody.Format) {
+		writeRedactedExport(w, r, reqBody.Format, consumption, func(consumption []Consumption) *export.Document {
+			table := export.Table{
+				Name: "Consumption",
+				Columns: []string{"Compound", "Net stock", "Min stock", "Scale", "Usage", "Average monthly usage",
+					"Days until stockout", "Stockout date", "Days until min stock"},
+			}
+			for _, c := range consumption {
+				table.AddRow(c.CompoundName, c.NetStock, c.MinStock, c.Scale, c.TotalUsage, c.AverageMonthlyUsage,
+					optionalCell(c.DaysUntilStockout), optionalCell(c.StockoutDate), optionalCell(c.DaysUntilMinStock))
+			}
+			return &export.Document{
+				Name:   exportName(r.Context(), "consumption"),
+				Title:  fmt.Sprintf("Consumption over %d months", reqBody.Months),
+				Tables: []export.Table{table},
+			}
+		})
+		return
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"months":      reqBody.Months,
+		"consumption": consumption,
+	})
+}
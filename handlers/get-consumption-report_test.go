@@ -0,0 +1,75 @@
+package handlers_test
+
+import (
+	"chemical-ledger-backend/handlers"
+	"chemical-ledger-backend/testutils"
+	"chemical-ledger-backend/utils"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConsumptionForecastsStockout(t *testing.T) {
+	t.Parallel()
+	env := testutils.NewEnv(t, time.Date(2026, 4, 1, 10, 0, 0, 0, time.Local))
+
+	env.InsertCompound("C_1", "Acetone", "ml")
+	env.InsertCompound("C_2", "Benzene", "ml")
+	if _, err := env.DB.Exec("UPDATE compound SET min_stock = 190 WHERE id = 'C_1'"); err != nil {
+		t.Fatal(err)
+	}
+	// The month before the clock has 31 days, so 310 ml issued in it is 10 ml a day
+	for _, entry := range []struct {
+		entryType, compoundId, date string
+		quantity                    int
+	}{
+		{utils.ENTRY_TYPE_INCOMING, "C_1", "2026-02-15", 1000},
+		{utils.ENTRY_TYPE_OUTGOING, "C_1", "2026-02-20", 500},
+		{utils.ENTRY_TYPE_INCOMING, "C_1", "2026-03-02", 500},
+		{utils.ENTRY_TYPE_OUTGOING, "C_1", "2026-03-10", 310},
+		{utils.ENTRY_TYPE_INCOMING, "C_2", "2026-03-05", 100},
+	} {
+		if w := insertEntry(env, entry.entryType, entry.compoundId, entry.date, entry.quantity); w.Code != http.StatusOK {
+			t.Fatalf("entry of %s on %s: status %d, %s", entry.compoundId, entry.date, w.Code, w.Body)
+		}
+	}
+
+	get := func(params string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handlers.GetConsumptionReportHandler(w, env.Request(http.MethodGet, "/report/consumption?"+params, nil))
+		return w
+	}
+
+	w := get("months=1")
+	want := `"consumption":[` +
+		`{"compound_id":"C_1","compound_name":"Acetone","scale":"ml","net_stock":690,"min_stock":190,"total_usage":310,"average_monthly_usage":310,"days_until_stockout":69,"stockout_date":"2026-06-09","days_until_min_stock":50},` +
+		`{"compound_id":"C_2","compound_name":"Benzene","scale":"ml","net_stock":100,"min_stock":0,"total_usage":0,"average_monthly_usage":0,"days_until_stockout":null,"stockout_date":null,"days_until_min_stock":null}]`
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), want) {
+		t.Errorf("months=1: status %d, want %s in %s", w.Code, want, w.Body)
+	}
+
+	// Over the default three months the issue of February counts too
+	if w := get("compound_id=C_1"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"months":3`) || !strings.Contains(w.Body.String(), `"total_usage":810,"average_monthly_usage":270,`) {
+		t.Errorf("default window: status %d, %s", w.Code, w.Body)
+	}
+
+	// Exports leave the forecast blank for compounds not issued
+	w = get("months=1&format=csv")
+	want = "Compound,Net stock,Min stock,Scale,Usage,Average monthly usage,Days until stockout,Stockout date,Days until min stock\n" +
+		"Acetone,690,190,ml,310,310,69,2026-06-09,50\n" +
+		"Benzene,100,0,ml,0,0,,,\n"
+	if w.Code != http.StatusOK || w.Body.String() != want {
+		t.Errorf("export: status %d, %q", w.Code, w.Body)
+	}
+
+	for _, params := range []string{"months=0", "months=25", "months=two", "format=docx"} {
+		if w := get(params); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, %s", params, w.Code, w.Body)
+		}
+	}
+	if w := get("compound_id=C_9"); w.Code != http.StatusNotFound {
+		t.Errorf("unknown compound: status %d, %s", w.Code, w.Body)
+	}
+}
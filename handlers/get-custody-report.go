@@ -0,0 +1,358 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/datetime"
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/export"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+// Events in the custody of a lot: it is received (an incoming entry or an adjustment in), issued to a recipient,
+// disposed of, or taken out by an adjustment
+const (
+	CUSTODY_EVENT_RECEIPT    = "receipt"
+	CUSTODY_EVENT_ISSUE      = "issue"
+	CUSTODY_EVENT_DISPOSAL   = "disposal"
+	CUSTODY_EVENT_ADJUSTMENT = "adjustment"
+)
+
+type CustodyEvent struct {
+	EntryId    string `json:"entry_id"`
+	Date       string `json:"date"`
+	Event      string `json:"event"`
+	VoucherNo  string `json:"voucher_no"`
+	Quantity   int    `json:"quantity"`
+	Balance    int    `json:"balance"`
+	Party      string `json:"party"`
+	Department string `json:"department"`
+	Reason     string `json:"reason"`
+	// Of a disposal, the party is the disposal method and this who authorized it
+	AuthorizedBy string `json:"authorized_by"`
+	EnteredBy    string `json:"entered_by"`
+	EnteredId    string `json:"entered_by_id"`
+	ApprovedBy   string `json:"approved_by"`
+	ApprovedId   string `json:"approved_by_id"`
+	ApprovedAt   string `json:"approved_at"`
+}
+
+type CustodyLot struct {
+	LotId     string         `json:"lot_id"`
+	LotNo     string         `json:"lot_no"`
+	Expiry    string         `json:"expiry"`
+	Supplier  string         `json:"supplier"`
+	Received  int            `json:"received"`
+	Remaining int            `json:"remaining"`
+	Events    []CustodyEvent `json:"events"`
+}
+
+type CustodyReport struct {
+	CompoundId  string       `json:"compound_id"`
+	Compound    string       `json:"compound"`
+	Scale       string       `json:"scale"`
+	CasNo       string       `json:"cas_no"`
+	GeneratedAt string       `json:"generated_at"`
+	Lots        []CustodyLot `json:"lots"`
+}
+
+// Gets the chain of custody of the lots of a controlled compound, or of the one lot given with "lot_id": every
+// approved receipt, issue and adjustment of the lot in order, with who entered and who approved it and the stock
+// left in the lot after it. "format=pdf" renders it in the layout the regulator asks for, with a line for the
+// signature of each event; other export formats list the events. Admins, supervisors and auditors only.
+func GetCustodyReportHandler(w http.ResponseWriter, r *http.Request) {
+	compoundId := httpx.GetParam(r, "compound_id")
+	lotId := httpx.GetParam(r, "lot_id")
+	format := httpx.GetParam(r, "format")
+
+	if format == "" {
+		format = REPORT_FORMAT_JSON
+	}
+	if errStr := validateExportFormat(r.Context(), format); errStr != utils.NO_ERR {
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	if compoundId == "" {
+		slog.ErrorContext(r.Context(), "missing required fields", "compound_id", compoundId)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.MISSING_REQUIRED_FIELDS)
+		return
+	}
+
+	report := &CustodyReport{
+		CompoundId:  compoundId,
+		GeneratedAt: datetime.Now(r.Context()).Local().Format("2006-01-02 15:04"),
+		Lots:        []CustodyLot{},
+	}
+	var controlled bool
+	err := db.ConnFrom(r.Context()).QueryRowContext(r.Context(), "SELECT name, scale, cas_no, controlled FROM compound WHERE id = ?", compoundId).Scan(&report.Compound, &report.Scale, &report.CasNo, &controlled)
+	if errors.Is(err, sql.ErrNoRows) {
+		slog.ErrorContext(r.Context(), "compound not found", "compound_id", compoundId)
+		httpx.RespWithError(w, http.StatusNotFound, utils.INVALID_COMPOUND_ID)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get compound", "compound_id", compoundId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.COMPOUND_RETRIEVAL_ERR)
+		return
+	}
+	if !controlled {
+		slog.WarnContext(r.Context(), "custody report of a compound not controlled", "compound_id", compoundId)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.COMPOUND_NOT_CONTROLLED)
+		return
+	}
+
+	if err := fillCustodyReport(r.Context(), report, lotId); err != nil {
+		slog.ErrorContext(r.Context(), "failed to build custody report", "compound_id", compoundId, "lot_id", lotId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.REPORT_RETRIEVAL_ERR)
+		return
+	}
+	if lotId != "" && len(report.Lots) == 0 {
+		slog.WarnContext(r.Context(), "lot not found", "compound_id", compoundId, "lot_id", lotId)
+		httpx.RespWithError(w, http.StatusNotFound, utils.INVALID_LOT_ID)
+		return
+	}
+
+	if isExportFormat(format) {
+		report, err = utils.RedactForRole(currentUser(r).Role, report)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to redact custody report", "compound_id", compoundId, "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.REDACTION_ERR)
+			return
+		}
+		writeExport(r.Context(), w, format, custodyDocument(r.Context(), report))
+		return
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"report": report,
+	})
+}
+
+// Lays out the custody report for export, one row per event of each lot. PDFs are printed in the regulator's
+// layout.
+func custodyDocument(ctx context.Context, report *CustodyReport) *export.Document {
+	table := export.Table{
+		Name: report.Compound,
+		Columns: []string{
+			"Lot no", "Expiry", "Supplier", "Date", "Event", "Entry", "Voucher no", "Supplier/Recipient", "Department", "Reason",
+			"Authorized by", "Quantity (" + report.Scale + ")", "In lot", "Entered by", "Approved by", "Approved at",
+		},
+	}
+	for _, lot := range report.Lots {
+		for _, event := range lot.Events {
+			table.AddRow(
+				lot.LotNo, lot.Expiry, lot.Supplier, event.Date, event.Event, event.EntryId, event.VoucherNo, event.Party, event.Department, event.Reason,
+				event.AuthorizedBy, event.Quantity, event.Balance, event.EnteredBy, event.ApprovedBy, event.ApprovedAt,
+			)
+		}
+	}
+
+	return &export.Document{
+		Name:   fmt.Sprintf("custody-%s-%s", report.CompoundId, datetime.Now(ctx).Local().Format("2006-01-02")),
+		Title:  "Chain of custody",
+		Tables: []export.Table{table},
+		Layouts: map[string]func(w io.Writer) error{
+			REPORT_FORMAT_PDF: func(w io.Writer) error {
+				_, err := w.Write(renderCustodyPDF(report))
+				return err
+			},
+		},
+	}
+}
+
+func fillCustodyReport(ctx context.Context, report *CustodyReport, lotId string) error {
+	// The entry a lot came in with, then the entries drawing from it. Lots only hold and give stock for approved
+	// entries, see stock.AllocateLots.
+	rows, err := db.ConnFrom(ctx).QueryContext(ctx, `
+		SELECT l.id, l.lot_no, l.expiry, l.supplier, e.id, e.type, q.total_quantity, `+custodyEventColumns+`
+		FROM lot l
+		JOIN entry e ON e.id = l.entry_id
+		JOIN quantity q ON e.quantity_id = q.id
+		`+custodyEventJoins+`
+		WHERE l.compound_id = ? AND (? = '' OR l.id = ?) AND e.status = ? AND e.deleted_at IS NULL
+
+		UNION ALL
+
+		SELECT l.id, l.lot_no, l.expiry, l.supplier, e.id, e.type, lc.quantity, `+custodyEventColumns+`
+		FROM lot_consumption lc
+		JOIN lot l ON l.id = lc.lot_id
+		JOIN entry e ON e.id = lc.entry_id
+		`+custodyEventJoins+`
+		WHERE l.compound_id = ? AND (? = '' OR l.id = ?) AND e.status = ? AND e.deleted_at IS NULL
+
+		ORDER BY 1, date_unix ASC, seq ASC`,
+		report.CompoundId, lotId, lotId, utils.ENTRY_STATUS_APPROVED,
+		report.CompoundId, lotId, lotId, utils.ENTRY_STATUS_APPROVED,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var lot *CustodyLot
+	for rows.Next() {
+		var current CustodyLot
+		var event CustodyEvent
+		var entryType string
+		var dateUnix, seq int64
+		if err := rows.Scan(
+			&current.LotId, &current.LotNo, &current.Expiry, &current.Supplier, &event.EntryId, &entryType, &event.Quantity,
+			&event.Date, &event.VoucherNo, &event.Party, &event.Department, &event.Reason, &event.AuthorizedBy,
+			&event.EnteredId, &event.EnteredBy, &event.ApprovedId, &event.ApprovedBy, &event.ApprovedAt, &dateUnix, &seq,
+		); err != nil {
+			return err
+		}
+
+		if lot == nil || lot.LotId != current.LotId {
+			report.Lots = append(report.Lots, current)
+			lot = &report.Lots[len(report.Lots)-1]
+			lot.Events = []CustodyEvent{}
+		}
+
+		switch {
+		case utils.IsInwardEntryType(entryType):
+			event.Event = CUSTODY_EVENT_RECEIPT
+			lot.Received += event.Quantity
+			lot.Remaining += event.Quantity
+		case entryType == utils.ENTRY_TYPE_OUTGOING:
+			event.Event = CUSTODY_EVENT_ISSUE
+			lot.Remaining -= event.Quantity
+		case entryType == utils.ENTRY_TYPE_DISPOSAL:
+			event.Event = CUSTODY_EVENT_DISPOSAL
+			lot.Remaining -= event.Quantity
+		default:
+			event.Event = CUSTODY_EVENT_ADJUSTMENT
+			lot.Remaining -= event.Quantity
+		}
+		event.Balance = lot.Remaining
+		lot.Events = append(lot.Events, event)
+	}
+	return rows.Err()
+}
+
+// Columns describing the entry of a custody event, read after the lot, entry and quantity columns
+const custodyEventColumns = `
+	datetime(e.date, 'unixepoch', 'localtime'), COALESCE(e.voucher_no, ''),
+	COALESCE(s.name, rc.name, e.disposal_method, ''), COALESCE(rc.department, ''), COALESCE(e.reason, ''),
+	COALESCE(e.disposal_authorized_by, ''), COALESCE(e.created_by, ''), COALESCE(cu.name, ''),
+	COALESCE(e.reviewed_by, ''), COALESCE(ru.name, ''), COALESCE(datetime(e.reviewed_at, 'unixepoch', 'localtime'), ''),
+	e.date AS date_unix, e.seq AS seq`
+
+const custodyEventJoins = `
+	LEFT JOIN supplier s ON e.supplier_id = s.id
+	LEFT JOIN recipient rc ON e.recipient_id = rc.id
+	LEFT JOIN user cu ON e.created_by = cu.id
+	LEFT JOIN user ru ON e.reviewed_by = ru.id`
+
+// Column positions of the custody table, in points from the left edge of the page.
+// Quantity columns are right aligned on their position.
+const (
+	custodyColDate     = utils.PDF_MARGIN
+	custodyColEvent    = 132.0
+	custodyColVoucher  = 200.0
+	custodyColParty    = 276.0
+	custodyColQuantity = 470.0
+	custodyColBalance  = utils.PDF_PAGE_WIDTH - utils.PDF_MARGIN
+
+	custodyFontSize   = 9.0
+	custodyLineHeight = 14.0
+)
+
+// Renders the report with a section per lot. Each event takes two lines: what moved, then who entered and
+// approved it by name and user ID, with a line to sign on.
+func renderCustodyPDF(report *CustodyReport) []byte {
+	pdf := utils.NewPDF()
+	right := utils.PDF_PAGE_WIDTH - utils.PDF_MARGIN
+
+	y := utils.PDF_MARGIN + 10
+	pdf.Text(utils.PDF_MARGIN, y, 16, true, "Chain of custody")
+	y += 24
+	title := fmt.Sprintf("%s (%s)", report.Compound, report.Scale)
+	if report.CasNo != "" {
+		title += ", CAS " + report.CasNo
+	}
+	pdf.Text(utils.PDF_MARGIN, y, 11, true, title)
+	pdf.TextRight(right, y, 9, false, "Compound ID: "+report.CompoundId)
+	y += 16
+	pdf.TextRight(right, y, 9, false, "Generated: "+report.GeneratedAt)
+	y += 22
+
+	header := func() {
+		pdf.Text(custodyColDate, y, custodyFontSize, true, "Date")
+		pdf.Text(custodyColEvent, y, custodyFontSize, true, "Event")
+		pdf.Text(custodyColVoucher, y, custodyFontSize, true, "Voucher")
+		pdf.Text(custodyColParty, y, custodyFontSize, true, "Supplier/Recipient")
+		pdf.TextRight(custodyColQuantity, y, custodyFontSize, true, "Quantity")
+		pdf.TextRight(custodyColBalance, y, custodyFontSize, true, "In lot")
+		pdf.Line(utils.PDF_MARGIN, right, y+4)
+		y += custodyLineHeight + 2
+	}
+	// Starts a new page when fewer than the given lines fit on this one
+	reserve := func(lines int) {
+		if y+float64(lines)*custodyLineHeight > utils.PDF_PAGE_HEIGHT-2*utils.PDF_MARGIN {
+			pdf.AddPage()
+			y = utils.PDF_MARGIN + 10
+		}
+	}
+	person := func(name, id string) string {
+		if id == "" {
+			return "-"
+		}
+		return fmt.Sprintf("%s (%s)", name, id)
+	}
+
+	for _, lot := range report.Lots {
+		reserve(5)
+		lotTitle := "Lot " + lot.LotId
+		if lot.LotNo != "" {
+			lotTitle += ", no. " + lot.LotNo
+		}
+		if lot.Expiry != "" {
+			lotTitle += ", expires " + lot.Expiry
+		}
+		pdf.Text(utils.PDF_MARGIN, y, 11, true, utils.PDFTruncate(lotTitle, 60))
+		pdf.TextRight(right, y, 9, false, fmt.Sprintf("Received %d, in lot %d", lot.Received, lot.Remaining))
+		y += 18
+		header()
+
+		for _, event := range lot.Events {
+			reserve(3)
+			party := event.Party
+			if event.Department != "" {
+				party += ", " + event.Department
+			}
+			if event.Event == CUSTODY_EVENT_ADJUSTMENT || event.Reason != "" {
+				party = "ADJ: " + event.Reason
+			} else if event.Event == CUSTODY_EVENT_DISPOSAL {
+				party += ", auth. " + event.AuthorizedBy
+			}
+			pdf.Text(custodyColDate, y, custodyFontSize, false, utils.PDFTruncate(event.Date, 16))
+			pdf.Text(custodyColEvent, y, custodyFontSize, true, event.Event)
+			pdf.Text(custodyColVoucher, y, custodyFontSize, false, utils.PDFTruncate(event.VoucherNo, 12))
+			pdf.Text(custodyColParty, y, custodyFontSize, false, utils.PDFTruncate(party, 28))
+			pdf.TextRight(custodyColQuantity, y, custodyFontSize, false, strconv.Itoa(event.Quantity))
+			pdf.TextRight(custodyColBalance, y, custodyFontSize, false, strconv.Itoa(event.Balance))
+			y += custodyLineHeight - 2
+
+			pdf.Text(custodyColDate, y, 8, false, utils.PDFTruncate(fmt.Sprintf("Entered by %s, approved by %s",
+				person(event.EnteredBy, event.EnteredId), person(event.ApprovedBy, event.ApprovedId)), 62))
+			pdf.Text(custodyColQuantity-90, y, 8, false, "Signature:")
+			pdf.Line(custodyColQuantity-40, right, y+2)
+			y += custodyLineHeight + 4
+		}
+		y += 10
+	}
+
+	if len(report.Lots) == 0 {
+		pdf.Text(utils.PDF_MARGIN, y, 9, false, "No lots received.")
+	}
+	return pdf.Bytes()
+}
@@ -0,0 +1,70 @@
+package handlers_test
+
+import (
+	"chemical-ledger-backend/handlers"
+	"chemical-ledger-backend/testutils"
+	"chemical-ledger-backend/utils"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCustodyReportFollowsEachLot(t *testing.T) {
+	t.Parallel()
+	env := testutils.NewEnv(t, time.Date(2026, 3, 14, 10, 0, 0, 0, time.Local))
+
+	env.InsertCompound("C_1", "Morphine", "mg")
+	env.InsertCompound("C_2", "Acetone", "ml")
+	if _, err := env.DB.Exec("UPDATE compound SET controlled = 1 WHERE id = 'C_1'"); err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range []struct {
+		entryType, date string
+		quantity        int
+	}{
+		{utils.ENTRY_TYPE_INCOMING, "2026-03-10", 500},
+		{utils.ENTRY_TYPE_OUTGOING, "2026-03-11", 200},
+		{utils.ENTRY_TYPE_INCOMING, "2026-03-12", 100},
+		{utils.ENTRY_TYPE_OUTGOING, "2026-03-13", 350},
+	} {
+		env.Clock.Advance(time.Minute)
+		if w := insertEntry(env, entry.entryType, "C_1", entry.date, entry.quantity); w.Code != http.StatusOK {
+			t.Fatalf("entry of %s: status %d, %s", entry.date, w.Code, w.Body)
+		}
+	}
+
+	report := func(params string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handlers.GetCustodyReportHandler(w, env.Request(http.MethodGet, "/report/chain-of-custody?"+params, nil))
+		return w
+	}
+
+	// The last issue draws from both lots, oldest first
+	w := report("compound_id=C_1")
+	body := w.Body.String()
+	for _, want := range []string{
+		`"received":500,"remaining":0`,
+		`"event":"receipt","voucher_no":"","quantity":500,"balance":500`,
+		`"event":"issue","voucher_no":"","quantity":200,"balance":300`,
+		`"event":"issue","voucher_no":"","quantity":300,"balance":0`,
+		`"received":100,"remaining":50`,
+		`"event":"issue","voucher_no":"","quantity":50,"balance":50`,
+		`"entered_by":"Local administrator","entered_by_id":"U_local"`,
+	} {
+		if w.Code != http.StatusOK || !strings.Contains(body, want) {
+			t.Fatalf("report: status %d, want %s in %s", w.Code, want, body)
+		}
+	}
+
+	if w := report("compound_id=C_1&format=pdf"); w.Code != http.StatusOK || !strings.HasPrefix(w.Body.String(), "%PDF") {
+		t.Errorf("pdf: status %d, %.40s", w.Code, w.Body)
+	}
+	if w := report("compound_id=C_2"); w.Code != http.StatusBadRequest {
+		t.Errorf("compound not controlled: status %d, %s", w.Code, w.Body)
+	}
+	if w := report("compound_id=C_1&lot_id=L_missing"); w.Code != http.StatusNotFound {
+		t.Errorf("unknown lot: status %d, %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/datetime"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Gets the digest of a day (YYYY-MM-DD): the approved movements per compound, stock below the minimum, entries
+// waiting for approval and entries worth a second look. It is made each morning for the day before, see
+// utils.RunDailyDigest, or on the first request for a day it was not made for, and stays as it was made.
+func GetDailyDigestHandler(w http.ResponseWriter, r *http.Request) {
+	date := chi.URLParam(r, "date")
+	if errStr := validateDate(r.Context(), date); errStr != utils.NO_ERR {
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+	if date >= datetime.Now(r.Context()).Local().Format("2006-01-02") {
+		slog.WarnContext(r.Context(), "daily digest requested before the day is over", "date", date)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.DIGEST_DAY_NOT_OVER)
+		return
+	}
+
+	digest, _, err := utils.EnsureDailyDigest(r.Context(), date)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get daily digest", "date", date, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.DIGEST_RETRIEVAL_ERR)
+		return
+	}
+
+	httpx.RespWithData(w, http.StatusOK, digest)
+}
@@ -0,0 +1,69 @@
+package handlers_test
+
+import (
+	"chemical-ledger-backend/handlers"
+	"chemical-ledger-backend/testutils"
+	"chemical-ledger-backend/utils"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestDailyDigestIsKeptAsMade(t *testing.T) {
+	t.Parallel()
+	env := testutils.NewEnv(t, time.Date(2026, 3, 14, 10, 0, 0, 0, time.Local))
+
+	env.InsertCompound("C_1", "Acetone", "ml")
+	if _, err := env.DB.Exec("UPDATE compound SET min_stock = 1000 WHERE id = 'C_1'"); err != nil {
+		t.Fatal(err)
+	}
+	for _, body := range []string{
+		`{"type": "incoming", "compound_id": "C_1", "date": "2026-03-13", "num_of_units": 1, "quantity_per_unit": 500, "voucher_no": "V-1"}`,
+		`{"type": "incoming", "compound_id": "C_1", "date": "2026-03-13", "num_of_units": 1, "quantity_per_unit": 500, "voucher_no": "V-1"}`,
+		`{"type": "outgoing", "compound_id": "C_1", "date": "2026-03-13", "num_of_units": 1, "quantity_per_unit": 200}`,
+		`{"type": "adjustment-out", "compound_id": "C_1", "date": "2026-03-13", "num_of_units": 1, "quantity_per_unit": 50, "reason": "spill"}`,
+	} {
+		env.Clock.Advance(time.Minute)
+		w := httptest.NewRecorder()
+		handlers.InsertEntryHandler(w, env.Request(http.MethodPost, "/insert-entry", strings.NewReader(body)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("entry %s: status %d, %s", body, w.Code, w.Body)
+		}
+	}
+
+	router := chi.NewRouter()
+	router.Get("/reports/daily/{date}", handlers.GetDailyDigestHandler)
+	digest := func(date string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, env.Request(http.MethodGet, "/reports/daily/"+date, nil))
+		return w
+	}
+
+	w := digest("2026-03-13")
+	for _, want := range []string{
+		`"entries":4,"incoming":1000,"outgoing":200,"adjustment_in":0,"adjustment_out":50`,
+		`"low_stock":[{"compound_id":"C_1","name":"Acetone","scale":"ml","net_stock":750,"min_stock":1000}]`,
+		`"kind":"duplicate_voucher"`,
+		`"kind":"adjustment_out"`,
+	} {
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), want) {
+			t.Fatalf("digest: status %d, want %s in %s", w.Code, want, w.Body)
+		}
+	}
+
+	// Entries recorded later for the day do not change the digest already made
+	if w := insertEntry(env, utils.ENTRY_TYPE_INCOMING, "C_1", "2026-03-13", 400); w.Code != http.StatusOK {
+		t.Fatalf("late delivery: status %d, %s", w.Code, w.Body)
+	}
+	if again := digest("2026-03-13"); again.Body.String() != w.Body.String() {
+		t.Errorf("digest changed after it was made:\n%s\n%s", w.Body, again.Body)
+	}
+
+	if w := digest("2026-03-14"); w.Code != http.StatusBadRequest {
+		t.Errorf("digest of today: status %d, %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/datetime"
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Number of compounds and entries listed in the dashboard sections
+const (
+	DASHBOARD_TOP_CONSUMED   = 5
+	DASHBOARD_LATEST_ENTRIES = 10
+)
+
+type DashboardCompound struct {
+	CompoundId string `json:"compound_id"`
+	Name       string `json:"name"`
+	Scale      string `json:"scale"`
+	Quantity   int    `json:"quantity"`
+}
+
+type DashboardLowStock struct {
+	CompoundId string `json:"compound_id"`
+	Name       string `json:"name"`
+	Scale      string `json:"scale"`
+	NetStock   int    `json:"net_stock"`
+	MinStock   int    `json:"min_stock"`
+}
+
+type DashboardEntry struct {
+	Id        string `json:"id"`
+	Type      string `json:"type"`
+	Date      string `json:"date"`
+	Compound  string `json:"compound"`
+	Scale     string `json:"scale"`
+	Quantity  int    `json:"quantity"`
+	NetStock  int    `json:"net_stock"`
+	VoucherNo string `json:"voucher_no"`
+}
+
+// Gets everything the home page shows in one go: compound count, entries this month, the most consumed
+// compounds this month, compounds whose stock fell below their minimum and the latest entries.
+func GetDashboardHandler(w http.ResponseWriter, r *http.Request) {
+	now := datetime.Now(r.Context())
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local)
+	monthEnd := monthStart.AddDate(0, 1, 0)
+
+	var compoundCount, monthEntryCount int
+	if err := db.ConnFrom(r.Context()).QueryRowContext(r.Context(), `
+		SELECT
+			(SELECT COUNT(*) FROM compound),
+			(SELECT COUNT(*) FROM entry WHERE date >= ? AND date < ? AND deleted_at IS NULL)`,
+		monthStart.Unix(), monthEnd.Unix(),
+	).Scan(&compoundCount, &monthEntryCount); err != nil {
+		slog.ErrorContext(r.Context(), "failed to count compounds and entries", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.DASHBOARD_RETRIEVAL_ERR)
+		return
+	}
+
+	topConsumed, err := getTopConsumedCompounds(r.Context(), monthStart.Unix(), monthEnd.Unix(), DASHBOARD_TOP_CONSUMED)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get most consumed compounds", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.DASHBOARD_RETRIEVAL_ERR)
+		return
+	}
+
+	lowStock, err := getLowStockCompounds(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get compounds below minimum stock", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.DASHBOARD_RETRIEVAL_ERR)
+		return
+	}
+
+	latestEntries, err := getLatestEntries(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get latest entries", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.DASHBOARD_RETRIEVAL_ERR)
+		return
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"compound_count":     compoundCount,
+		"entries_this_month": monthEntryCount,
+		"top_consumed":       topConsumed,
+		"low_stock":          lowStock,
+		"latest_entries":     latestEntries,
+	})
+}
+
+// The "limit" compounds of which the most was issued between the given times, most first
+func getTopConsumedCompounds(ctx context.Context, from, to int64, limit int) ([]DashboardCompound, error) {
+	rows, err := db.ConnFrom(ctx).QueryContext(ctx, `
+		SELECT c.id, c.name, c.scale, SUM(q.total_quantity) AS consumed
+		FROM entry e
+		JOIN compound c ON e.compound_id = c.id
+		JOIN quantity q ON e.quantity_id = q.id
+		WHERE e.type = ? AND e.status = ? AND e.deleted_at IS NULL AND e.date >= ? AND e.date < ?
+		GROUP BY c.id
+		ORDER BY consumed DESC, c.lower_case_name ASC
+		LIMIT ?`,
+		utils.ENTRY_TYPE_OUTGOING, utils.ENTRY_STATUS_APPROVED, from, to, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	compounds := []DashboardCompound{}
+	for rows.Next() {
+		var c DashboardCompound
+		if err := rows.Scan(&c.CompoundId, &c.Name, &c.Scale, &c.Quantity); err != nil {
+			return nil, err
+		}
+		compounds = append(compounds, c)
+	}
+	return compounds, rows.Err()
+}
+
+// Compounds with a minimum stock set whose current stock is below it
+func getLowStockCompounds(ctx context.Context) ([]DashboardLowStock, error) {
+	rows, err := db.ConnFrom(ctx).QueryContext(ctx, `
+		SELECT c.id, c.name, c.scale, COALESCE(s.balance, 0) AS stock, c.min_stock
+		FROM compound c
+		LEFT JOIN stock_current s ON s.compound_id = c.id
+		WHERE c.min_stock > 0 AND COALESCE(s.balance, 0) < c.min_stock
+		ORDER BY c.lower_case_name ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	compounds := []DashboardLowStock{}
+	for rows.Next() {
+		var c DashboardLowStock
+		if err := rows.Scan(&c.CompoundId, &c.Name, &c.Scale, &c.NetStock, &c.MinStock); err != nil {
+			return nil, err
+		}
+		compounds = append(compounds, c)
+	}
+	return compounds, rows.Err()
+}
+
+func getLatestEntries(ctx context.Context) ([]DashboardEntry, error) {
+	rows, err := db.ConnFrom(ctx).QueryContext(ctx, `
+		SELECT
+			e.id, e.type, datetime(e.date, 'unixepoch', 'localtime'), c.name, c.scale,
+			q.total_quantity, e.net_stock, COALESCE(e.voucher_no, '')
+		FROM entry e
+		JOIN compound c ON e.compound_id = c.id
+		JOIN quantity q ON e.quantity_id = q.id
+		WHERE e.deleted_at IS NULL
+		ORDER BY e.date DESC, e.seq DESC
+		LIMIT ?`, DASHBOARD_LATEST_ENTRIES)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []DashboardEntry{}
+	for rows.Next() {
+		var e DashboardEntry
+		if err := rows.Scan(&e.Id, &e.Type, &e.Date, &e.Compound, &e.Scale, &e.Quantity, &e.NetStock, &e.VoucherNo); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/datetime"
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"log/slog"
+	"net/http"
+)
+
+// Lists the delegations given or received by "user_id" (all delegations when omitted), newest first.
+// "approver_chain" shows where approvals of that user are routed today.
+func GetDelegationHandler(w http.ResponseWriter, r *http.Request) {
+	userId := httpx.GetParam(r, "user_id")
+
+	query := `
+		SELECT
+			d.id, d.delegator_id, dr.name, d.delegate_id, de.name,
+			d.from_date, d.to_date, d.reason, d.revoked,
+			datetime(d.created_at, 'unixepoch', 'localtime')
+		FROM delegation d
+		JOIN user dr ON d.delegator_id = dr.id
+		JOIN user de ON d.delegate_id = de.id`
+	args := []any{}
+	if userId != "" {
+		query += " WHERE d.delegator_id = ? OR d.delegate_id = ?"
+		args = append(args, userId, userId)
+	}
+	query += " ORDER BY d.created_at DESC"
+
+	rows, err := db.ConnFrom(r.Context()).QueryContext(r.Context(), query, args...)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to query delegations", "user_id", userId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.DELEGATION_RETRIEVAL_ERR)
+		return
+	}
+	defer rows.Close()
+
+	type Delegation struct {
+		Id            string `json:"id"`
+		DelegatorId   string `json:"delegator_id"`
+		DelegatorName string `json:"delegator_name"`
+		DelegateId    string `json:"delegate_id"`
+		DelegateName  string `json:"delegate_name"`
+		FromDate      string `json:"from_date"`
+		ToDate        string `json:"to_date"`
+		Reason        string `json:"reason"`
+		Revoked       bool   `json:"revoked"`
+		CreatedAt     string `json:"created_at"`
+	}
+
+	delegations := []Delegation{}
+	for rows.Next() {
+		var d Delegation
+		if err := rows.Scan(&d.Id, &d.DelegatorId, &d.DelegatorName, &d.DelegateId, &d.DelegateName, &d.FromDate, &d.ToDate, &d.Reason, &d.Revoked, &d.CreatedAt); err != nil {
+			slog.ErrorContext(r.Context(), "failed to scan delegation row", "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.DELEGATION_RETRIEVAL_ERR)
+			return
+		}
+		delegations = append(delegations, d)
+	}
+
+	data := map[string]any{
+		"delegations": delegations,
+	}
+	if userId != "" {
+		chain, err := utils.ResolveApprover(r.Context(), userId, datetime.Now(r.Context()))
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to resolve approver", "user_id", userId, "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.DELEGATION_RETRIEVAL_ERR)
+			return
+		}
+		data["approver_chain"] = chain
+	}
+
+	httpx.RespWithData(w, http.StatusOK, data)
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/export"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"log/slog"
+	"net/http"
+)
+
+type GetDepartmentReportReq struct {
+	Department string `json:"department"`
+	LocationId string `json:"location_id"`
+	FromDate   string `json:"from_date"`
+	ToDate     string `json:"to_date"`
+	Format     string `json:"format"`
+}
+
+// Summarises the outgoing entries per department and compound, optionally for one department, the issues from one
+// location and/or a date range.
+// Outgoing entries without a recipient are grouped under an empty department. With an export "format", the rows come
+// as a file instead.
+func GetDepartmentReportHandler(w http.ResponseWriter, r *http.Request) {
+	reqBody := &GetDepartmentReportReq{
+		Department: httpx.GetParam(r, "department"),
+		LocationId: httpx.GetParam(r, "location_id"),
+		FromDate:   httpx.GetParam(r, "from_date"),
+		ToDate:     httpx.GetParam(r, "to_date"),
+		Format:     httpx.GetParam(r, "format"),
+	}
+
+	if errStr := validateExportFormat(r.Context(), reqBody.Format); errStr != utils.NO_ERR {
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	query := `
+		SELECT
+			COALESCE(rc.department, ''), c.id, c.name, c.scale,
+			COUNT(e.id), SUM(q.total_quantity)
+		FROM entry e
+		LEFT JOIN recipient rc ON e.recipient_id = rc.id
+		JOIN compound c ON e.compound_id = c.id
+		JOIN quantity q ON e.quantity_id = q.id
+		WHERE e.type = ? AND e.status = ? AND e.deleted_at IS NULL`
+	args := []any{utils.ENTRY_TYPE_OUTGOING, utils.ENTRY_STATUS_APPROVED}
+
+	if reqBody.Department != "" {
+		query += " AND rc.department = ?"
+		args = append(args, reqBody.Department)
+	}
+
+	if reqBody.LocationId != "" {
+		if errStr := validateLocationIdField(r.Context(), reqBody.LocationId); errStr != utils.NO_ERR {
+			httpx.RespWithError(w, http.StatusBadRequest, errStr)
+			return
+		}
+		query += " AND e.location_id = ?"
+		args = append(args, reqBody.LocationId)
+	}
+
+	fromUnix, toUnix, errStr := parseReportRange(r.Context(), reqBody.FromDate, reqBody.ToDate)
+	if errStr != utils.NO_ERR {
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+	query += " AND e.date >= ? AND e.date < ?"
+	args = append(args, fromUnix, toUnix)
+
+	query += " GROUP BY COALESCE(rc.department, ''), c.id ORDER BY COALESCE(rc.department, '') ASC, c.lower_case_name ASC"
+
+	rows, err := db.ConnFrom(r.Context()).QueryContext(r.Context(), query, args...)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to query department report", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.REPORT_RETRIEVAL_ERR)
+		return
+	}
+	defer rows.Close()
+
+	type Consumption struct {
+		Department    string `json:"department"`
+		CompoundId    string `json:"compound_id"`
+		CompoundName  string `json:"compound_name"`
+		Scale         string `json:"scale"`
+		Entries       int    `json:"entries"`
+		TotalQuantity int    `json:"total_quantity"`
+	}
+
+	consumption := []Consumption{}
+	for rows.Next() {
+		var c Consumption
+		if err := rows.Scan(&c.Department, &c.CompoundId, &c.CompoundName, &c.Scale, &c.Entries, &c.TotalQuantity); err != nil {
+			slog.ErrorContext(r.Context(), "failed to scan department consumption row", "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.REPORT_RETRIEVAL_ERR)
+			return
+		}
+		consumption = append(consumption, c)
+	}
+
+	if isExportFormat(reqBody.Format) {
+		writeRedactedExport(w, r, reqBody.Format, consumption, func(consumption []Consumption) *export.Document {
+			table := export.Table{
+				Name:    "Consumption",
+				Columns: []string{"Department", "Compound", "Entries", "Quantity", "Scale"},
+			}
+			for _, c := range consumption {
+				table.AddRow(c.Department, c.CompoundName, c.Entries, c.TotalQuantity, c.Scale)
+			}
+			return &export.Document{
+				Name:   exportName(r.Context(), "department-consumption"),
+				Title:  "Consumption by department",
+				Tables: []export.Table{table},
+			}
+		})
+		return
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"consumption": consumption,
+	})
+}
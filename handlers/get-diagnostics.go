@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"net/http"
+	"runtime"
+	"time"
+)
+
+var startedAt = time.Now()
+
+// Detailed view of the application's state for support: the build, runtime, database pool and schema version,
+// quotas, disk space, subsystems and the panics recovered from handlers
+func GetDiagnosticsHandler(w http.ResponseWriter, r *http.Request) {
+	databaseErr := ""
+	if err := db.ConnFrom(r.Context()).PingContext(r.Context()); err != nil {
+		databaseErr = err.Error()
+	}
+	stats := db.ConnFrom(r.Context()).Stats()
+	schemaVersion, err := db.GetSchemaVersion(r.Context(), db.ConnFrom(r.Context()))
+	if err != nil && databaseErr == "" {
+		databaseErr = err.Error()
+	}
+
+	quotas, err := utils.GetQuotas(r.Context())
+	quotaErr := ""
+	if err != nil {
+		quotaErr = err.Error()
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"build": utils.GetBuildInfo(),
+		"runtime": map[string]any{
+			"go_version": runtime.Version(),
+			"os":         runtime.GOOS,
+			"arch":       runtime.GOARCH,
+			"goroutines": runtime.NumGoroutine(),
+			"started_at": startedAt.Format(time.RFC3339),
+			"uptime":     time.Since(startedAt).Round(time.Second).String(),
+		},
+		"database": map[string]any{
+			"error":            databaseErr,
+			"open_connections": stats.OpenConnections,
+			"in_use":           stats.InUse,
+			"idle":             stats.Idle,
+			"wait_count":       stats.WaitCount,
+			"schema_version":   schemaVersion,
+		},
+		"quotas":      quotas,
+		"quota_error": quotaErr,
+		"disk":        utils.GetDiskStatus(),
+		"subsystems":  utils.GetSubsystemStatuses(),
+		"panics":      utils.GetPanicStats(),
+	})
+}
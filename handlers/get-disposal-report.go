@@ -0,0 +1,332 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/datetime"
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/export"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type GetDisposalReportReq struct {
+	CompoundId string `json:"compound_id"`
+	Method     string `json:"method"`
+	LocationId string `json:"location_id"`
+	From       string `json:"from"`
+	To         string `json:"to"`
+	Format     string `json:"format"`
+}
+
+type Disposal struct {
+	EntryId      string `json:"entry_id"`
+	Date         string `json:"date"`
+	CompoundId   string `json:"compound_id"`
+	Compound     string `json:"compound"`
+	CasNo        string `json:"cas_no"`
+	Scale        string `json:"scale"`
+	Quantity     int    `json:"quantity"`
+	Method       string `json:"method"`
+	AuthorizedBy string `json:"authorized_by"`
+	LotNos       string `json:"lot_nos"`
+	VoucherNo    string `json:"voucher_no"`
+	Remark       string `json:"remark"`
+	RecordedBy   string `json:"recorded_by"`
+}
+
+// Quantity of a compound disposed of by one method over the period
+type DisposalTotal struct {
+	CompoundId string `json:"compound_id"`
+	Compound   string `json:"compound"`
+	CasNo      string `json:"cas_no"`
+	Scale      string `json:"scale"`
+	Method     string `json:"method"`
+	Entries    int    `json:"entries"`
+	Quantity   int    `json:"quantity"`
+}
+
+type DisposalReport struct {
+	From        string          `json:"from"`
+	To          string          `json:"to"`
+	GeneratedAt string          `json:"generated_at"`
+	Disposals   []Disposal      `json:"disposals"`
+	Totals      []DisposalTotal `json:"totals"`
+}
+
+// Lists the approved disposals of a period oldest first, with how each was disposed of and who authorized it, and
+// totals them per compound and method, as environmental compliance filings ask for. Optionally for one compound, one
+// method and/or the disposals from one location. "format=pdf" renders it for filing.
+func GetDisposalReportHandler(w http.ResponseWriter, r *http.Request) {
+	reqBody := &GetDisposalReportReq{
+		CompoundId: httpx.GetParam(r, "compound_id"),
+		Method:     httpx.GetParam(r, "method"),
+		LocationId: httpx.GetParam(r, "location_id"),
+		From:       httpx.GetParam(r, "from"),
+		To:         httpx.GetParam(r, "to"),
+		Format:     httpx.GetParam(r, "format"),
+	}
+
+	if reqBody.Format == "" {
+		reqBody.Format = REPORT_FORMAT_JSON
+	}
+	if errStr := validateExportFormat(r.Context(), reqBody.Format); errStr != utils.NO_ERR {
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+	if reqBody.Method != "" && !utils.IsValidDisposalMethod(reqBody.Method) {
+		slog.ErrorContext(r.Context(), "invalid disposal method", "method", reqBody.Method)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.INVALID_DISPOSAL_METHOD)
+		return
+	}
+	if reqBody.LocationId != "" {
+		if errStr := validateLocationIdField(r.Context(), reqBody.LocationId); errStr != utils.NO_ERR {
+			httpx.RespWithError(w, http.StatusBadRequest, errStr)
+			return
+		}
+	}
+
+	fromUnix, toUnix, errStr := parseReportRange(r.Context(), reqBody.From, reqBody.To)
+	if errStr != utils.NO_ERR {
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	report := &DisposalReport{
+		From:        reqBody.From,
+		To:          reqBody.To,
+		GeneratedAt: datetime.Now(r.Context()).Local().Format("2006-01-02 15:04"),
+		Disposals:   []Disposal{},
+		Totals:      []DisposalTotal{},
+	}
+	if err := fillDisposalReport(r.Context(), report, reqBody, fromUnix, toUnix); err != nil {
+		slog.ErrorContext(r.Context(), "failed to build disposal report", "compound_id", reqBody.CompoundId, "method", reqBody.Method, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.REPORT_RETRIEVAL_ERR)
+		return
+	}
+
+	if isExportFormat(reqBody.Format) {
+		report, err := utils.RedactForRole(currentUser(r).Role, report)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to redact disposal report", "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.REDACTION_ERR)
+			return
+		}
+		writeExport(r.Context(), w, reqBody.Format, disposalDocument(r.Context(), report))
+		return
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"report": report,
+	})
+}
+
+// Lays out the disposal report for export, as the disposals and their totals. PDFs are printed in the filing's
+// layout.
+func disposalDocument(ctx context.Context, report *DisposalReport) *export.Document {
+	disposals := export.Table{
+		Name:    "Disposals",
+		Columns: []string{"Date", "Entry", "Compound", "CAS no", "Quantity", "Scale", "Method", "Authorized by", "Lot nos", "Voucher no", "Remark", "Recorded by"},
+	}
+	for _, d := range report.Disposals {
+		disposals.AddRow(d.Date, d.EntryId, d.Compound, d.CasNo, d.Quantity, d.Scale, d.Method, d.AuthorizedBy, d.LotNos, d.VoucherNo, d.Remark, d.RecordedBy)
+	}
+	totals := export.Table{
+		Name:    "Totals",
+		Columns: []string{"Compound", "CAS no", "Method", "Entries", "Quantity", "Scale"},
+	}
+	for _, t := range report.Totals {
+		totals.AddRow(t.Compound, t.CasNo, t.Method, t.Entries, t.Quantity, t.Scale)
+	}
+
+	return &export.Document{
+		Name:   fmt.Sprintf("disposals-%s", datetime.Now(ctx).Local().Format("2006-01-02")),
+		Title:  "Chemical disposals",
+		Tables: []export.Table{disposals, totals},
+		Layouts: map[string]func(w io.Writer) error{
+			REPORT_FORMAT_PDF: func(w io.Writer) error {
+				_, err := w.Write(renderDisposalPDF(report))
+				return err
+			},
+		},
+	}
+}
+
+// Reads the disposals of the range and sums them up per compound and method, in the order of the compounds by name
+func fillDisposalReport(ctx context.Context, report *DisposalReport, reqBody *GetDisposalReportReq, fromUnix, toUnix int64) error {
+	query := `
+		SELECT
+			e.id, datetime(e.date, 'unixepoch', 'localtime'), c.id, c.name, COALESCE(c.cas_no, ''), c.scale,
+			q.total_quantity, e.disposal_method, e.disposal_authorized_by,
+			COALESCE((
+				SELECT GROUP_CONCAT(l.lot_no, ', ')
+				FROM lot_consumption lc
+				JOIN lot l ON l.id = lc.lot_id
+				WHERE lc.entry_id = e.id AND l.lot_no != ''
+			), ''),
+			COALESCE(e.voucher_no, ''), COALESCE(e.remark, ''), COALESCE(u.name, e.created_by, '')
+		FROM entry e
+		JOIN compound c ON e.compound_id = c.id
+		JOIN quantity q ON e.quantity_id = q.id
+		LEFT JOIN user u ON e.created_by = u.id
+		WHERE e.type = ? AND e.status = ? AND e.deleted_at IS NULL AND e.date >= ? AND e.date < ?`
+	args := []any{utils.ENTRY_TYPE_DISPOSAL, utils.ENTRY_STATUS_APPROVED, fromUnix, toUnix}
+	if reqBody.CompoundId != "" {
+		query += " AND e.compound_id = ?"
+		args = append(args, reqBody.CompoundId)
+	}
+	if reqBody.Method != "" {
+		query += " AND e.disposal_method = ?"
+		args = append(args, reqBody.Method)
+	}
+	if reqBody.LocationId != "" {
+		query += " AND e.location_id = ?"
+		args = append(args, reqBody.LocationId)
+	}
+	query += " ORDER BY e.date ASC, e.seq ASC"
+
+	rows, err := db.ConnFrom(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	totals := map[[2]string]*DisposalTotal{}
+	for rows.Next() {
+		var d Disposal
+		if err := rows.Scan(
+			&d.EntryId, &d.Date, &d.CompoundId, &d.Compound, &d.CasNo, &d.Scale,
+			&d.Quantity, &d.Method, &d.AuthorizedBy, &d.LotNos, &d.VoucherNo, &d.Remark, &d.RecordedBy,
+		); err != nil {
+			return err
+		}
+		report.Disposals = append(report.Disposals, d)
+
+		key := [2]string{d.CompoundId, d.Method}
+		total, ok := totals[key]
+		if !ok {
+			total = &DisposalTotal{CompoundId: d.CompoundId, Compound: d.Compound, CasNo: d.CasNo, Scale: d.Scale, Method: d.Method}
+			totals[key] = total
+		}
+		total.Entries++
+		total.Quantity += d.Quantity
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, total := range totals {
+		report.Totals = append(report.Totals, *total)
+	}
+	slices.SortFunc(report.Totals, func(a, b DisposalTotal) int {
+		return cmp.Or(
+			strings.Compare(strings.ToLower(a.Compound), strings.ToLower(b.Compound)),
+			strings.Compare(a.CompoundId, b.CompoundId),
+			strings.Compare(a.Method, b.Method),
+		)
+	})
+	return nil
+}
+
+// Column positions of the disposal table, in points from the left edge of the page.
+// Quantity columns are right aligned on their position.
+const (
+	disposalColDate       = utils.PDF_MARGIN
+	disposalColCompound   = 112.0
+	disposalColQuantity   = 300.0
+	disposalColMethod     = 310.0
+	disposalColAuthorized = 410.0
+
+	disposalFontSize   = 9.0
+	disposalLineHeight = 14.0
+)
+
+// Renders the disposals with the lots, voucher and who recorded each under it, followed by the totals per compound
+// and method
+func renderDisposalPDF(report *DisposalReport) []byte {
+	pdf := utils.NewPDF()
+	right := utils.PDF_PAGE_WIDTH - utils.PDF_MARGIN
+
+	y := utils.PDF_MARGIN + 10
+	pdf.Text(utils.PDF_MARGIN, y, 16, true, "Chemical disposals")
+	y += 24
+	period := "All dates"
+	if report.From != "" || report.To != "" {
+		period = fmt.Sprintf("From %s to %s", cmp.Or(report.From, "-"), cmp.Or(report.To, "-"))
+	}
+	pdf.Text(utils.PDF_MARGIN, y, 11, true, period)
+	pdf.TextRight(right, y, 9, false, "Generated: "+report.GeneratedAt)
+	y += 22
+
+	// Starts a new page when fewer than the given lines fit on this one
+	reserve := func(lines int) {
+		if y+float64(lines)*disposalLineHeight > utils.PDF_PAGE_HEIGHT-2*utils.PDF_MARGIN {
+			pdf.AddPage()
+			y = utils.PDF_MARGIN + 10
+		}
+	}
+	header := func(compoundTitle string) {
+		reserve(3)
+		pdf.Text(disposalColDate, y, disposalFontSize, true, "Date")
+		pdf.Text(disposalColCompound, y, disposalFontSize, true, compoundTitle)
+		pdf.TextRight(disposalColQuantity, y, disposalFontSize, true, "Quantity")
+		pdf.Text(disposalColMethod, y, disposalFontSize, true, "Method")
+		pdf.Text(disposalColAuthorized, y, disposalFontSize, true, "Authorized by")
+		pdf.Line(utils.PDF_MARGIN, right, y+4)
+		y += disposalLineHeight + 2
+	}
+	compound := func(name, casNo string) string {
+		if casNo != "" {
+			name += " (CAS " + casNo + ")"
+		}
+		return name
+	}
+
+	header("Compound")
+	if len(report.Disposals) == 0 {
+		pdf.Text(disposalColDate, y, disposalFontSize, false, "No disposals in the period.")
+		y += disposalLineHeight
+	}
+	for _, d := range report.Disposals {
+		reserve(2)
+		pdf.Text(disposalColDate, y, disposalFontSize, false, utils.PDFTruncate(d.Date, 16))
+		pdf.Text(disposalColCompound, y, disposalFontSize, false, utils.PDFTruncate(compound(d.Compound, d.CasNo), 30))
+		pdf.TextRight(disposalColQuantity, y, disposalFontSize, false, strconv.Itoa(d.Quantity)+" "+d.Scale)
+		pdf.Text(disposalColMethod, y, disposalFontSize, false, utils.PDFTruncate(d.Method, 18))
+		pdf.Text(disposalColAuthorized, y, disposalFontSize, false, utils.PDFTruncate(d.AuthorizedBy, 24))
+		y += disposalLineHeight - 2
+
+		details := fmt.Sprintf("Entry %s, recorded by %s", d.EntryId, cmp.Or(d.RecordedBy, "-"))
+		if d.LotNos != "" {
+			details += ", lots " + d.LotNos
+		}
+		if d.VoucherNo != "" {
+			details += ", voucher " + d.VoucherNo
+		}
+		pdf.Text(disposalColCompound, y, 8, false, utils.PDFTruncate(details, 90))
+		y += disposalLineHeight
+	}
+
+	y += 10
+	reserve(3)
+	pdf.Text(utils.PDF_MARGIN, y, 11, true, "Totals")
+	y += 18
+	header("")
+	for _, t := range report.Totals {
+		reserve(1)
+		pdf.Text(disposalColCompound, y, disposalFontSize, false, utils.PDFTruncate(compound(t.Compound, t.CasNo), 30))
+		pdf.TextRight(disposalColQuantity, y, disposalFontSize, true, strconv.Itoa(t.Quantity)+" "+t.Scale)
+		pdf.Text(disposalColMethod, y, disposalFontSize, false, utils.PDFTruncate(t.Method, 18))
+		pdf.Text(disposalColAuthorized, y, disposalFontSize, false, fmt.Sprintf("%d entries", t.Entries))
+		y += disposalLineHeight
+	}
+
+	return pdf.Bytes()
+}
@@ -0,0 +1,98 @@
+package handlers_test
+
+import (
+	"chemical-ledger-backend/handlers"
+	"chemical-ledger-backend/testutils"
+	"chemical-ledger-backend/utils"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDisposalsTakeFromStockAndAreReported(t *testing.T) {
+	t.Parallel()
+	env := testutils.NewEnv(t, time.Date(2026, 3, 14, 10, 0, 0, 0, time.Local))
+
+	env.InsertCompound("C_1", "Acetone", "ml")
+	env.InsertCompound("C_2", "Benzene", "ml")
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handlers.InsertEntryHandler(w, env.Request(http.MethodPost, "/insert-entry", strings.NewReader(body)))
+		return w
+	}
+	dispose := func(compoundId string, date string, quantity int, method string) *httptest.ResponseRecorder {
+		return post(fmt.Sprintf(
+			`{"type": "disposal", "compound_id": %q, "date": %q, "num_of_units": 1, "quantity_per_unit": %d, "disposal_method": %q, "disposal_authorized_by": "Dr. Rao"}`,
+			compoundId, date, quantity, method,
+		))
+	}
+
+	for _, w := range []*httptest.ResponseRecorder{
+		insertEntry(env, utils.ENTRY_TYPE_INCOMING, "C_1", "2026-03-02", 1000),
+		insertEntry(env, utils.ENTRY_TYPE_INCOMING, "C_2", "2026-03-02", 500),
+		dispose("C_1", "2026-03-05", 100, utils.DISPOSAL_METHOD_INCINERATION),
+		dispose("C_1", "2026-03-06", 50, utils.DISPOSAL_METHOD_INCINERATION),
+		dispose("C_2", "2026-03-07", 20, utils.DISPOSAL_METHOD_CONTRACTOR),
+	} {
+		if w.Code != http.StatusOK {
+			t.Fatalf("entry: status %d, %s", w.Code, w.Body)
+		}
+	}
+
+	for name, w := range map[string]*httptest.ResponseRecorder{
+		"without authorizer": post(`{"type": "disposal", "compound_id": "C_1", "date": "2026-03-08", "num_of_units": 1, "quantity_per_unit": 10, "disposal_method": "drain"}`),
+		"unknown method":     dispose("C_1", "2026-03-08", 10, "burial"),
+		"method on an issue": post(`{"type": "outgoing", "compound_id": "C_1", "date": "2026-03-08", "num_of_units": 1, "quantity_per_unit": 10, "disposal_method": "drain"}`),
+	} {
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, %s", name, w.Code, w.Body)
+		}
+	}
+	// 850 ml are left once 150 ml were disposed of
+	if w := dispose("C_1", "2026-03-09", 900, utils.DISPOSAL_METHOD_DRAIN); w.Code != http.StatusNotAcceptable {
+		t.Errorf("disposal beyond the stock: status %d, %s", w.Code, w.Body)
+	}
+	env.AssertNetStock("C_1")
+
+	get := func(url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handlers.GetDisposalReportHandler(w, env.Request(http.MethodGet, url, nil))
+		return w
+	}
+	w := get("/report/disposals?from=2026-03-01&to=2026-03-31")
+	body := w.Body.String()
+	if w.Code != http.StatusOK || strings.Count(body, `"entry_id"`) != 3 ||
+		!strings.Contains(body, `"compound_id":"C_1","compound":"Acetone","cas_no":"","scale":"ml","method":"incineration","entries":2,"quantity":150`) ||
+		!strings.Contains(body, `"compound_id":"C_2","compound":"Benzene","cas_no":"","scale":"ml","method":"licensed-contractor","entries":1,"quantity":20`) ||
+		!strings.Contains(body, `"authorized_by":"Dr. Rao"`) {
+		t.Errorf("disposal report: status %d, %s", w.Code, body)
+	}
+	if w := get("/report/disposals?method=licensed-contractor"); w.Code != http.StatusOK || strings.Count(w.Body.String(), `"entry_id"`) != 1 {
+		t.Errorf("disposals by contractor: status %d, %s", w.Code, w.Body)
+	}
+	if w := get("/report/disposals?format=pdf"); w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/pdf" {
+		t.Errorf("disposal report PDF: status %d, %s", w.Code, w.Header())
+	}
+	if w := get("/report/disposals?method=licensed-contractor&format=csv"); w.Code != http.StatusOK ||
+		!strings.HasPrefix(w.Header().Get("Content-Type"), "text/csv") ||
+		!strings.HasSuffix(w.Header().Get("Content-Disposition"), `.csv"`) ||
+		!strings.Contains(w.Body.String(), "Totals\nCompound,CAS no,Method,Entries,Quantity,Scale\nBenzene,,licensed-contractor,1,20,ml\n") {
+		t.Errorf("disposal report CSV: status %d, %s, %s", w.Code, w.Header(), w.Body)
+	}
+	if w := get("/report/disposals?format=docx"); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown format: status %d, %s", w.Code, w.Body)
+	}
+	if w := get("/report/disposals?method=burial"); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown method: status %d, %s", w.Code, w.Body)
+	}
+
+	w = httptest.NewRecorder()
+	handlers.GetShrinkageReportHandler(w, env.Request(http.MethodGet, "/report/shrinkage?compound_id=C_1&groupBy=compound", nil))
+	if body := w.Body.String(); w.Code != http.StatusOK || !strings.Contains(body, `"disposed":150`) ||
+		!strings.Contains(body, `"unexplained_loss":0`) || !strings.Contains(body, `"book_stock":850`) {
+		t.Errorf("shrinkage report: status %d, %s", w.Code, body)
+	}
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"log/slog"
+	"net/http"
+)
+
+type GetDuplicatesReq struct {
+	CompoundId string `json:"compound_id"`
+	FromDate   string `json:"from_date"`
+	ToDate     string `json:"to_date"`
+}
+
+// Entries sharing a voucher number, compound and day, suspected to be the same voucher recorded twice
+type DuplicateGroup struct {
+	CompoundId   string           `json:"compound_id"`
+	CompoundName string           `json:"compound_name"`
+	VoucherNo    string           `json:"voucher_no"`
+	Date         string           `json:"date"`
+	Entries      []DuplicateEntry `json:"entries"`
+}
+
+type DuplicateEntry struct {
+	Id        string `json:"id"`
+	Type      string `json:"type"`
+	Quantity  int    `json:"quantity"`
+	Status    string `json:"status"`
+	CreatedBy string `json:"created_by"`
+}
+
+// Lists the suspected duplicates among the entries, optionally for one compound and/or a date range: entries with
+// the same voucher number for the same compound on the same day, whether or not DUPLICATE_VOUCHER_CHECK was on
+// when they were recorded. Deleted and rejected entries are left out, as are entries without a voucher number.
+func GetDuplicatesHandler(w http.ResponseWriter, r *http.Request) {
+	reqBody := &GetDuplicatesReq{
+		CompoundId: httpx.GetParam(r, "compound_id"),
+		FromDate:   httpx.GetParam(r, "from_date"),
+		ToDate:     httpx.GetParam(r, "to_date"),
+	}
+
+	fromUnix, toUnix, errStr := parseReportRange(r.Context(), reqBody.FromDate, reqBody.ToDate)
+	if errStr != utils.NO_ERR {
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	query := `
+		SELECT
+			c.id, c.name, e.voucher_no, date(e.date, 'unixepoch', 'localtime'),
+			e.id, e.type, q.total_quantity, e.status, COALESCE(e.created_by, '')
+		FROM entry e
+		JOIN compound c ON e.compound_id = c.id
+		JOIN quantity q ON e.quantity_id = q.id
+		WHERE e.deleted_at IS NULL AND e.status != ? AND COALESCE(e.voucher_no, '') != ''
+			AND e.date >= ? AND e.date < ?
+			AND EXISTS (
+				SELECT 1 FROM entry d
+				WHERE d.compound_id = e.compound_id AND d.voucher_no = e.voucher_no AND d.id != e.id
+					AND d.deleted_at IS NULL AND d.status != ?
+					AND date(d.date, 'unixepoch', 'localtime') = date(e.date, 'unixepoch', 'localtime')
+			)`
+	args := []any{utils.ENTRY_STATUS_REJECTED, fromUnix, toUnix, utils.ENTRY_STATUS_REJECTED}
+
+	if reqBody.CompoundId != "" {
+		query += " AND e.compound_id = ?"
+		args = append(args, reqBody.CompoundId)
+	}
+
+	query += " ORDER BY e.date ASC, c.lower_case_name ASC, e.voucher_no ASC, e.seq ASC"
+
+	rows, err := db.ConnFrom(r.Context()).QueryContext(r.Context(), query, args...)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to query duplicate entries", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.REPORT_RETRIEVAL_ERR)
+		return
+	}
+	defer rows.Close()
+
+	groups := []*DuplicateGroup{}
+	byKey := map[[3]string]*DuplicateGroup{}
+	for rows.Next() {
+		var key [3]string
+		var compoundName string
+		var entry DuplicateEntry
+		if err := rows.Scan(&key[0], &compoundName, &key[1], &key[2], &entry.Id, &entry.Type, &entry.Quantity, &entry.Status, &entry.CreatedBy); err != nil {
+			slog.ErrorContext(r.Context(), "failed to scan duplicate entry row", "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.REPORT_RETRIEVAL_ERR)
+			return
+		}
+
+		group, ok := byKey[key]
+		if !ok {
+			group = &DuplicateGroup{CompoundId: key[0], CompoundName: compoundName, VoucherNo: key[1], Date: key[2]}
+			byKey[key] = group
+			groups = append(groups, group)
+		}
+		group.Entries = append(group.Entries, entry)
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"duplicates": groups,
+	})
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Serves a voucher scan of an entry as it was uploaded, to open in the browser
+func GetEntryAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	entryId := chi.URLParam(r, "id")
+	attachmentId := chi.URLParam(r, "attachment_id")
+
+	var filename, contentType string
+	err := db.ConnFrom(r.Context()).QueryRowContext(r.Context(),
+		"SELECT filename, content_type FROM attachment WHERE id = ? AND entry_id = ?", attachmentId, entryId,
+	).Scan(&filename, &contentType)
+	if err == sql.ErrNoRows {
+		slog.WarnContext(r.Context(), "attachment not found", "entry_id", entryId, "attachment_id", attachmentId)
+		httpx.RespWithError(w, http.StatusNotFound, utils.ATTACHMENT_NOT_FOUND)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to retrieve attachment", "entry_id", entryId, "attachment_id", attachmentId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.ATTACHMENT_RETRIEVAL_ERR)
+		return
+	}
+
+	data, err := utils.ReadAttachment(attachmentId)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to read attachment file", "entry_id", entryId, "attachment_id", attachmentId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.ATTACHMENT_RETRIEVAL_ERR)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Lists the voucher scans attached to an entry, latest first
+func GetEntryAttachmentsHandler(w http.ResponseWriter, r *http.Request) {
+	entryId := chi.URLParam(r, "id")
+
+	rows, err := db.ConnFrom(r.Context()).QueryContext(r.Context(), `
+		SELECT id, compound_id, entry_id, kind, filename, content_type, size, sha256, uploaded_by, uploaded_at
+		FROM attachment
+		WHERE entry_id = ?
+		ORDER BY uploaded_at DESC, id DESC`,
+		entryId,
+	)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to query attachments", "entry_id", entryId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.ATTACHMENT_RETRIEVAL_ERR)
+		return
+	}
+	defer rows.Close()
+
+	attachments := []utils.Attachment{}
+	for rows.Next() {
+		var a utils.Attachment
+		if err := rows.Scan(&a.Id, &a.CompoundId, &a.EntryId, &a.Kind, &a.Filename, &a.ContentType, &a.Size, &a.Sha256, &a.UploadedBy, &a.UploadedAt); err != nil {
+			slog.ErrorContext(r.Context(), "failed to scan attachment", "entry_id", entryId, "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.ATTACHMENT_RETRIEVAL_ERR)
+			return
+		}
+		attachments = append(attachments, a)
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"attachments": attachments,
+	})
+}
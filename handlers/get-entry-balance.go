@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/utils"
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// What an entry moves the balance by: approved deliveries and adjustments in add, approved issues and adjustments
+// out take away, entries pending, rejected or deleted and transfers between locations move nothing
+const entryBalanceChange = `
+	CASE WHEN e.status != ? OR e.type = ? OR e.deleted_at IS NOT NULL THEN 0 WHEN e.type IN (?, ?) THEN q.total_quantity ELSE -q.total_quantity END`
+
+var entryBalanceChangeArgs = []any{utils.ENTRY_STATUS_APPROVED, utils.ENTRY_TYPE_TRANSFER, utils.ENTRY_TYPE_INCOMING, utils.ENTRY_TYPE_ADJUSTMENT_IN}
+
+// Sets the running balance of the listed entries of a single compound, as on a ledger statement: the balance at the
+// start of "from_date" (0 when all transactions are listed) moved by every approved entry listed up to and including
+// the entry. A page starts from the balance left by the entries listed before it. Returns the opening balance.
+func fillRunningBalances(ctx context.Context, filters *GetEntryReq, countQuery string, filterArgs []any, entries []*Entry) (int, error) {
+	openingBalance := 0
+	if filters.Transactions == "basedOnDates" {
+		fromDate, _ := time.Parse("2006-01-02", filters.FromDate)
+		fromUnix := time.Date(fromDate.Year(), fromDate.Month(), fromDate.Day(), 0, 0, 0, 0, time.Local).Unix()
+		err := db.ConnFrom(ctx).QueryRowContext(ctx, `
+			SELECT net_stock FROM entry
+			WHERE compound_id = ? AND date < ? AND deleted_at IS NULL
+			ORDER BY date DESC, seq DESC
+			LIMIT 1`, filters.compoundIds[0], fromUnix,
+		).Scan(&openingBalance)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return 0, err
+		}
+	}
+	if len(entries) == 0 {
+		return openingBalance, nil
+	}
+
+	// Entries are listed newest first unless sorted in ascending order
+	oldestFirst := make([]*Entry, len(entries))
+	copy(oldestFirst, entries)
+	if filters.Order != SORT_ORDER_ASC {
+		for i, j := 0, len(oldestFirst)-1; i < j; i, j = i+1, j-1 {
+			oldestFirst[i], oldestFirst[j] = oldestFirst[j], oldestFirst[i]
+		}
+	}
+
+	balance := openingBalance
+	if filters.Limit > 0 {
+		// The count query selects the entries listed, so the balance query sums up those before the page
+		oldest := oldestFirst[0]
+		balanceQuery := strings.Replace(countQuery, "COUNT(*)", "COALESCE(SUM("+entryBalanceChange+"), 0)", 1) +
+			" AND (e.date < ? OR (e.date = ? AND e.seq < ?))"
+		args := append(append(append([]any{}, entryBalanceChangeArgs...), filterArgs...), oldest.dateUnix, oldest.dateUnix, oldest.seq)
+		var before int
+		if err := db.ConnFrom(ctx).QueryRowContext(ctx, balanceQuery, args...).Scan(&before); err != nil {
+			return 0, err
+		}
+		balance += before
+	}
+
+	for _, entry := range oldestFirst {
+		if entry.Status == utils.ENTRY_STATUS_APPROVED && !entry.Deleted {
+			if utils.IsInwardEntryType(entry.Type) {
+				balance += entry.Quantity
+			} else if utils.IsOutwardEntryType(entry.Type) {
+				balance -= entry.Quantity
+			}
+		}
+		runningBalance := balance
+		entry.RunningBalance = &runningBalance
+	}
+	return openingBalance, nil
+}
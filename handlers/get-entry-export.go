@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/export"
+	"chemical-ledger-backend/utils"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Lays out the entries for export: a summary table with one row per compound, followed by a table per compound
+// listing its entries oldest first. Adjustments are summed up apart, as their net effect on the stock. Entries that
+// are pending or rejected are listed but left out of the totals.
+func entriesDocument(filters *GetEntryReq, entries []*Entry) *export.Document {
+	type compoundSummary struct {
+		name, scale        string
+		count              int
+		incoming, outgoing int
+		adjustments        int
+		disposed           int
+		netStock           int
+		entries            []*Entry
+	}
+
+	// Entries come newest first, so the first entry seen of a compound carries its latest net stock
+	order := []string{}
+	summaries := map[string]*compoundSummary{}
+	for _, entry := range entries {
+		summary, ok := summaries[entry.CompoundId]
+		if !ok {
+			summary = &compoundSummary{name: entry.Name, scale: entry.Scale, netStock: entry.NetStock}
+			summaries[entry.CompoundId] = summary
+			order = append(order, entry.CompoundId)
+		}
+		summary.count++
+		switch {
+		case entry.Status != utils.ENTRY_STATUS_APPROVED || entry.Deleted:
+		case entry.Type == utils.ENTRY_TYPE_INCOMING:
+			summary.incoming += entry.Quantity
+		case entry.Type == utils.ENTRY_TYPE_OUTGOING:
+			summary.outgoing += entry.Quantity
+		case entry.Type == utils.ENTRY_TYPE_ADJUSTMENT_IN:
+			summary.adjustments += entry.Quantity
+		case entry.Type == utils.ENTRY_TYPE_ADJUSTMENT_OUT:
+			summary.adjustments -= entry.Quantity
+		case entry.Type == utils.ENTRY_TYPE_DISPOSAL:
+			summary.disposed += entry.Quantity
+		}
+		summary.entries = append(summary.entries, entry)
+	}
+	slices.SortFunc(order, func(a, b string) int {
+		return strings.Compare(strings.ToLower(summaries[a].name), strings.ToLower(summaries[b].name))
+	})
+
+	doc := &export.Document{
+		Name:  fmt.Sprintf("entries-%s-%s", filters.FromDate, filters.ToDate),
+		Title: "Entries",
+	}
+	summary := export.Table{
+		Name:    "Summary",
+		Columns: []string{"Compound", "Scale", "Entries", "Incoming", "Outgoing", "Adjustments", "Disposed", "Net stock"},
+	}
+	for _, compoundId := range order {
+		s := summaries[compoundId]
+		summary.AddRow(s.name, s.scale, s.count, s.incoming, s.outgoing, s.adjustments, s.disposed, s.netStock)
+	}
+	doc.Tables = append(doc.Tables, summary)
+
+	for _, compoundId := range order {
+		s := summaries[compoundId]
+		sheet := export.Table{
+			Name: s.name,
+			Columns: []string{
+				"Date", "Type", "Status", "Voucher no", "Units", "Packs per unit", "Quantity per unit", "Partial quantity", "Quantity (" + s.scale + ")",
+				"Net stock", "Supplier", "Recipient", "Department", "Remark", "Adjustment reason",
+				"Disposal method", "Disposal authorized by",
+			},
+		}
+		for i := len(s.entries) - 1; i >= 0; i-- {
+			e := s.entries[i]
+			sheet.AddRow(
+				e.Date, e.Type, e.Status, e.VoucherNo, e.NumOfUnits, e.PacksPerUnit, e.QuantityPer, e.Partial, e.Quantity,
+				e.NetStock, e.SupplierName, e.Recipient, e.Department, e.Remark, e.Reason,
+				e.DisposalMethod, e.DisposalAuthorizedBy,
+			)
+		}
+		doc.Tables = append(doc.Tables, sheet)
+	}
+
+	return doc
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type EntryVersion struct {
+	Version    int             `json:"version"`
+	Current    bool            `json:"current"`
+	Entry      *InsertEntryReq `json:"entry"`
+	ReplacedBy string          `json:"replaced_by"`
+	ReplacedAt string          `json:"replaced_at"`
+}
+
+// Lists the versions of an entry, oldest first. Every update keeps the state it replaced as a version, with who
+// replaced it and when; the last version is the entry as it is now.
+func GetEntryHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	entryId := chi.URLParam(r, "id")
+
+	current, err := readEntryVersionData(r.Context(), db.ConnFrom(r.Context()).QueryRowContext, entryId)
+	if err == sql.ErrNoRows {
+		slog.ErrorContext(r.Context(), "entry not found", "entry_id", entryId)
+		httpx.RespWithError(w, http.StatusNotFound, utils.INVALID_ENTRY_ID)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error retrieving entry", "entry_id", entryId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.ENTRY_RETRIEVAL_ERR)
+		return
+	}
+
+	rows, err := db.ConnFrom(r.Context()).QueryContext(r.Context(), `
+		SELECT version, data, COALESCE(replaced_by, ''), datetime(replaced_at, 'unixepoch', 'localtime')
+		FROM entry_version
+		WHERE entry_id = ?
+		ORDER BY version ASC`,
+		entryId,
+	)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to query entry versions", "entry_id", entryId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.ENTRY_HISTORY_RETRIEVAL_ERR)
+		return
+	}
+	defer rows.Close()
+
+	versions := []EntryVersion{}
+	for rows.Next() {
+		var v EntryVersion
+		var data string
+		if err := rows.Scan(&v.Version, &data, &v.ReplacedBy, &v.ReplacedAt); err != nil {
+			slog.ErrorContext(r.Context(), "failed to scan entry version row", "entry_id", entryId, "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.ENTRY_HISTORY_RETRIEVAL_ERR)
+			return
+		}
+		if err := json.Unmarshal([]byte(data), &v.Entry); err != nil {
+			slog.ErrorContext(r.Context(), "failed to decode entry version", "entry_id", entryId, "version", v.Version, "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.ENTRY_HISTORY_RETRIEVAL_ERR)
+			return
+		}
+		versions = append(versions, v)
+	}
+	versions = append(versions, EntryVersion{Version: len(versions) + 1, Current: true, Entry: current})
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"entry_id": entryId,
+		"versions": versions,
+	})
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/datetime"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const ENTRY_LOCK_NOTICE_HEADER = "X-Entry-Lock-Notice"
+
+// Adds the "X-Entry-Lock-Notice" header during the days before the next month locks,
+// e.g. "entries dated before 2026-11-01 lock on 2026-11-05"
+func EntryLockNoticeMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if notice := utils.GetEntryLockPolicy().Notice(datetime.Now(r.Context())); notice != "" {
+			w.Header().Set(ENTRY_LOCK_NOTICE_HEADER, notice)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Returns the entry lock policy, which days are locked and when the next month locks
+func GetEntryLockHandler(w http.ResponseWriter, r *http.Request) {
+	policy := utils.GetEntryLockPolicy()
+	resp := map[string]any{
+		"enabled":     policy.Enabled(),
+		"after_days":  policy.AfterDays,
+		"notice_days": policy.NoticeDays,
+	}
+	if !policy.Enabled() {
+		httpx.RespWithData(w, http.StatusOK, resp)
+		return
+	}
+
+	lock, err := utils.GetEntryLock(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to retrieve entry lock", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.ENTRY_LOCK_RETRIEVAL_ERR)
+		return
+	}
+
+	now := datetime.Now(r.Context())
+	nextLockedBefore, nextLockAt := policy.NextLock(now)
+	resp["next_lock"] = map[string]any{
+		"locked_before": nextLockedBefore.Format("2006-01-02"),
+		"at":            nextLockAt.Format("2006-01-02"),
+	}
+	resp["notice"] = policy.Notice(now)
+	if lock != nil {
+		resp["locked_before"] = lock.LockedBefore
+		if now.Unix() < lock.UnlockedUntil {
+			resp["unlocked_until"] = time.Unix(lock.UnlockedUntil, 0).Format("2006-01-02 15:04:05")
+			resp["unlocked_by"] = lock.UnlockedBy
+		}
+	}
+
+	httpx.RespWithData(w, http.StatusOK, resp)
+}
+
+// Checks that none of the given entry dates (Unix times) fall in a locked month.
+// Returns the status code to answer with when one does or the lock cannot be read.
+func checkEntryDatesUnlocked(ctx context.Context, dates ...int64) (int, utils.ErrorMessage) {
+	lockedBefore, err := utils.ActiveEntryLock(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to retrieve entry lock", "error", err)
+		return http.StatusInternalServerError, utils.ENTRY_LOCK_RETRIEVAL_ERR
+	}
+	if lockedBefore == "" {
+		return http.StatusOK, utils.NO_ERR
+	}
+
+	for _, date := range dates {
+		if day := time.Unix(date, 0).Format("2006-01-02"); day < lockedBefore {
+			slog.WarnContext(ctx, "entry date is locked", "date", day, "locked_before", lockedBefore)
+			return http.StatusForbidden, utils.ENTRY_PERIOD_LOCKED
+		}
+	}
+	return http.StatusOK, utils.NO_ERR
+}
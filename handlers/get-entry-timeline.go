@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/datetime"
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/export"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+type GetEntryTimelineReq struct {
+	VoucherNo   string `json:"voucher_no"`
+	RecipientId string `json:"recipient_id"`
+	ProjectId   string `json:"project_id"`
+	From        string `json:"from"`
+	To          string `json:"to"`
+	Format      string `json:"format"`
+}
+
+// Entry of a timeline, with what it did to the stock of its compound
+type TimelineEntry struct {
+	EntryId      string `json:"entry_id"`
+	Date         string `json:"date"`
+	Type         string `json:"type"`
+	CompoundId   string `json:"compound_id"`
+	CompoundName string `json:"compound_name"`
+	Scale        string `json:"scale"`
+	VoucherNo    string `json:"voucher_no"`
+	Party        string `json:"party"`
+	ProjectId    string `json:"project_id"`
+	ProjectName  string `json:"project_name"`
+	Remark       string `json:"remark"`
+	Quantity     int    `json:"quantity"`
+	// Quantity added to the stock of the compound, negative for what was taken out and 0 for transfers
+	Change int `json:"change"`
+	// Stock of the compound after the entry
+	Balance int `json:"balance"`
+}
+
+// What the entries of a timeline did to the stock of one compound
+type TimelineCompound struct {
+	CompoundId   string `json:"compound_id"`
+	CompoundName string `json:"compound_name"`
+	Scale        string `json:"scale"`
+	Entries      int    `json:"entries"`
+	In           int    `json:"in"`
+	Out          int    `json:"out"`
+	NetChange    int    `json:"net_change"`
+}
+
+// Merges the approved entries sharing a "voucher_no", a recipient ("recipient_id") or a project ("project_id") into
+// one timeline across compounds, oldest first, each with the change it made to its compound's stock and the balance
+// after it, e.g. for what a project drew last week. Exactly one of the three is given; "from" and "to"
+// (YYYY-MM-DD) limit the dates. "compounds" sums up the change per compound. Export formats list the entries.
+func GetEntryTimelineHandler(w http.ResponseWriter, r *http.Request) {
+	reqBody := &GetEntryTimelineReq{
+		VoucherNo:   strings.TrimSpace(httpx.GetParam(r, "voucher_no")),
+		RecipientId: httpx.GetParam(r, "recipient_id"),
+		ProjectId:   httpx.GetParam(r, "project_id"),
+		From:        httpx.GetParam(r, "from"),
+		To:          httpx.GetParam(r, "to"),
+		Format:      httpx.GetParam(r, "format"),
+	}
+
+	if errStr := validateExportFormat(r.Context(), reqBody.Format); errStr != utils.NO_ERR {
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	given := 0
+	for _, filter := range []string{reqBody.VoucherNo, reqBody.RecipientId, reqBody.ProjectId} {
+		if filter != "" {
+			given++
+		}
+	}
+	if given != 1 {
+		slog.ErrorContext(r.Context(), "timeline needs exactly one filter", "voucher_no", reqBody.VoucherNo, "recipient_id", reqBody.RecipientId, "project_id", reqBody.ProjectId)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.INVALID_TIMELINE_FILTER)
+		return
+	}
+
+	query := `
+		SELECT
+			e.id, datetime(e.date, 'unixepoch', 'localtime'), e.type, c.id, c.name, c.scale,
+			COALESCE(e.voucher_no, ''), COALESCE(s.name, rc.name, ''), COALESCE(pj.id, ''), COALESCE(pj.name, ''),
+			COALESCE(e.remark, ''), q.total_quantity, e.net_stock
+		FROM entry e
+		JOIN compound c ON e.compound_id = c.id
+		JOIN quantity q ON e.quantity_id = q.id
+		LEFT JOIN supplier s ON e.supplier_id = s.id
+		LEFT JOIN recipient rc ON e.recipient_id = rc.id
+		LEFT JOIN project pj ON e.project_id = pj.id
+		WHERE e.status = ? AND e.deleted_at IS NULL`
+	args := []any{utils.ENTRY_STATUS_APPROVED}
+
+	switch {
+	case reqBody.VoucherNo != "":
+		query += " AND e.voucher_no = ?"
+		args = append(args, reqBody.VoucherNo)
+	case reqBody.RecipientId != "":
+		if errStr := validateRecipientIdField(r.Context(), reqBody.RecipientId); errStr != utils.NO_ERR {
+			httpx.RespWithError(w, http.StatusBadRequest, errStr)
+			return
+		}
+		query += " AND e.recipient_id = ?"
+		args = append(args, reqBody.RecipientId)
+	default:
+		if errStr := validateProjectIdField(r.Context(), reqBody.ProjectId); errStr != utils.NO_ERR {
+			httpx.RespWithError(w, http.StatusBadRequest, errStr)
+			return
+		}
+		query += " AND e.project_id = ?"
+		args = append(args, reqBody.ProjectId)
+	}
+
+	fromUnix, toUnix, errStr := parseReportRange(r.Context(), reqBody.From, reqBody.To)
+	if errStr != utils.NO_ERR {
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+	query += " AND e.date >= ? AND e.date < ? ORDER BY e.date ASC, e.seq ASC"
+	args = append(args, fromUnix, toUnix)
+
+	rows, err := db.ConnFrom(r.Context()).QueryContext(r.Context(), query, args...)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to query timeline", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.REPORT_RETRIEVAL_ERR)
+		return
+	}
+	defer rows.Close()
+
+	entries := []TimelineEntry{}
+	compounds := map[string]*TimelineCompound{}
+	for rows.Next() {
+		var e TimelineEntry
+		if err := rows.Scan(
+			&e.EntryId, &e.Date, &e.Type, &e.CompoundId, &e.CompoundName, &e.Scale,
+			&e.VoucherNo, &e.Party, &e.ProjectId, &e.ProjectName, &e.Remark, &e.Quantity, &e.Balance,
+		); err != nil {
+			slog.ErrorContext(r.Context(), "failed to scan timeline row", "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.REPORT_RETRIEVAL_ERR)
+			return
+		}
+
+		c := compounds[e.CompoundId]
+		if c == nil {
+			c = &TimelineCompound{CompoundId: e.CompoundId, CompoundName: e.CompoundName, Scale: e.Scale}
+			compounds[e.CompoundId] = c
+		}
+		c.Entries++
+		switch {
+		case utils.IsInwardEntryType(e.Type):
+			e.Change = e.Quantity
+			c.In += e.Quantity
+		case utils.IsOutwardEntryType(e.Type):
+			e.Change = -e.Quantity
+			c.Out += e.Quantity
+		}
+		c.NetChange += e.Change
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		slog.ErrorContext(r.Context(), "failed to read timeline rows", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.REPORT_RETRIEVAL_ERR)
+		return
+	}
+
+	totals := make([]TimelineCompound, 0, len(compounds))
+	for _, c := range compounds {
+		totals = append(totals, *c)
+	}
+	sort.Slice(totals, func(i, j int) bool {
+		return strings.ToLower(totals[i].CompoundName) < strings.ToLower(totals[j].CompoundName)
+	})
+
+	if isExportFormat(reqBody.Format) {
+		entries, err = utils.RedactForRole(currentUser(r).Role, entries)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to redact timeline", "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.REDACTION_ERR)
+			return
+		}
+		writeExport(r.Context(), w, reqBody.Format, timelineDocument(r.Context(), entries, totals))
+		return
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"entries":   entries,
+		"compounds": totals,
+	})
+}
+
+// Lays out a timeline for export, as its entries and the change per compound
+func timelineDocument(ctx context.Context, entries []TimelineEntry, totals []TimelineCompound) *export.Document {
+	timeline := export.Table{
+		Name:    "Timeline",
+		Columns: []string{"Date", "Entry", "Type", "Compound", "Voucher no", "Supplier/Recipient", "Project", "Remark", "Quantity", "Scale", "Change", "Balance"},
+	}
+	for _, e := range entries {
+		timeline.AddRow(e.Date, e.EntryId, e.Type, e.CompoundName, e.VoucherNo, e.Party, e.ProjectName, e.Remark, e.Quantity, e.Scale, e.Change, e.Balance)
+	}
+	compounds := export.Table{
+		Name:    "Compounds",
+		Columns: []string{"Compound", "Scale", "Entries", "In", "Out", "Net change"},
+	}
+	for _, c := range totals {
+		compounds.AddRow(c.CompoundName, c.Scale, c.Entries, c.In, c.Out, c.NetChange)
+	}
+
+	return &export.Document{
+		Name:   fmt.Sprintf("timeline-%s", datetime.Now(ctx).Local().Format("2006-01-02")),
+		Title:  "Entry timeline",
+		Tables: []export.Table{timeline, compounds},
+	}
+}
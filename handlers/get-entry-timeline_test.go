@@ -0,0 +1,74 @@
+package handlers_test
+
+import (
+	"chemical-ledger-backend/handlers"
+	"chemical-ledger-backend/testutils"
+	"chemical-ledger-backend/utils"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimelineMergesEntriesAcrossCompounds(t *testing.T) {
+	t.Parallel()
+	env := testutils.NewEnv(t, time.Date(2026, 3, 14, 10, 0, 0, 0, time.Local))
+
+	env.InsertCompound("C_1", "Acetone", "ml")
+	env.InsertCompound("C_2", "Benzene", "ml")
+	w := httptest.NewRecorder()
+	handlers.InsertProjectHandler(w, env.Request(http.MethodPost, "/insert-project", strings.NewReader(`{"name": "Enzyme kinetics", "code": "DST-42"}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("project: status %d, %s", w.Code, w.Body)
+	}
+
+	post := func(entryType, compoundId, date string, quantity int, extra string) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		handlers.InsertEntryHandler(w, env.Request(http.MethodPost, "/insert-entry", strings.NewReader(fmt.Sprintf(
+			`{"type": %q, "compound_id": %q, "date": %q, "num_of_units": 1, "quantity_per_unit": %d%s}`,
+			entryType, compoundId, date, quantity, extra,
+		))))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s of %s: status %d, %s", entryType, compoundId, w.Code, w.Body)
+		}
+	}
+	post(utils.ENTRY_TYPE_INCOMING, "C_1", "2026-03-02", 1000, `, "voucher_no": "DN-7"`)
+	post(utils.ENTRY_TYPE_INCOMING, "C_2", "2026-03-02", 200, `, "voucher_no": "DN-7"`)
+	post(utils.ENTRY_TYPE_OUTGOING, "C_2", "2026-03-09", 50, `, "project_id": "PJ_1"`)
+	post(utils.ENTRY_TYPE_OUTGOING, "C_1", "2026-03-10", 150, `, "project_id": "PJ_1"`)
+	post(utils.ENTRY_TYPE_OUTGOING, "C_1", "2026-03-11", 300, "")
+	post(utils.ENTRY_TYPE_OUTGOING, "C_1", "2026-03-12", 25, `, "project_id": "PJ_1"`)
+
+	get := func(params string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handlers.GetEntryTimelineHandler(w, env.Request(http.MethodGet, "/timeline?"+params, nil))
+		return w
+	}
+
+	w = get("project_id=PJ_1")
+	body := w.Body.String()
+	benzene, acetone := strings.Index(body, `"compound_name":"Benzene","scale":"ml","voucher_no":"","party":"","project_id":"PJ_1"`), strings.Index(body, `"change":-150,"balance":850`)
+	if w.Code != http.StatusOK || strings.Count(body, `"entry_id"`) != 3 || benzene < 0 || acetone < benzene ||
+		!strings.Contains(body, `"change":-25,"balance":525`) ||
+		!strings.Contains(body, `{"compound_id":"C_1","compound_name":"Acetone","scale":"ml","entries":2,"in":0,"out":175,"net_change":-175}`) ||
+		!strings.Contains(body, `{"compound_id":"C_2","compound_name":"Benzene","scale":"ml","entries":1,"in":0,"out":50,"net_change":-50}`) {
+		t.Errorf("project timeline: status %d, %s", w.Code, body)
+	}
+	if w := get("project_id=PJ_1&from=2026-03-10&to=2026-03-10"); w.Code != http.StatusOK || strings.Count(w.Body.String(), `"entry_id"`) != 1 {
+		t.Errorf("project timeline of a day: status %d, %s", w.Code, w.Body)
+	}
+	if w := get("voucher_no=DN-7"); w.Code != http.StatusOK || strings.Count(w.Body.String(), `"entry_id"`) != 2 || !strings.Contains(w.Body.String(), `"in":200,"out":0,"net_change":200`) {
+		t.Errorf("voucher timeline: status %d, %s", w.Code, w.Body)
+	}
+	if w := get("voucher_no=DN-7&format=csv"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "\nCompounds\n") {
+		t.Errorf("voucher timeline CSV: status %d, %s", w.Code, w.Body)
+	}
+	for _, params := range []string{"", "voucher_no=DN-7&project_id=PJ_1", "project_id=PJ_9"} {
+		if w := get(params); w.Code != http.StatusBadRequest {
+			t.Errorf("%q: status %d, %s", params, w.Code, w.Body)
+		}
+	}
+}
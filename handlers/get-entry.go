@@ -1,10 +1,17 @@
 package handlers
 
 import (
+	"chemical-ledger-backend/datetime"
 	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
 	"chemical-ledger-backend/utils"
+	"context"
+	"encoding/base64"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -16,23 +23,176 @@ type GetEntryReq struct {
 	FromDate     string `json:"from_date"`
 	ToDate       string `json:"to_date"`
 	Transactions string `json:"transactions"`
+	SupplierId   string `json:"supplier_id"`
+	RecipientId  string `json:"recipient_id"`
+	InstrumentId string `json:"instrument_id"`
+	LocationId   string `json:"location_id"`
+	ProjectId    string `json:"project_id"`
+	Department   string `json:"department"`
+	VoucherNo    string `json:"voucher_no"`
+	VoucherMatch string `json:"voucher_match"`
+	Remark       string `json:"remark"`
+	Status       string `json:"status"`
+	Include      string `json:"include"`
+	Sort         string `json:"sort"`
+	Order        string `json:"order"`
+	Limit        int    `json:"limit"`
+	Cursor       string `json:"cursor"`
+	Format       string `json:"format"`
+	DisplayUnits bool   `json:"display_units"`
+	// Whether to add the running balance of the entries listed, for a statement of a single compound
+	RunningBalance bool `json:"running_balance"`
+
+	cursorDate     int64
+	cursorSeq      int64
+	compoundIds    []string
+	includeDeleted bool
+	includePending bool
+}
+
+// Largest number of compounds "compound_id" can list at once
+const MAX_ENTRY_COMPOUNDS = 20
+
+// What entries can be sorted by with "sort", and the column each sorts on
+const (
+	ENTRY_SORT_DATE      = "date"
+	ENTRY_SORT_NAME      = "name"
+	ENTRY_SORT_NET_STOCK = "net_stock"
+	ENTRY_SORT_QUANTITY  = "quantity"
+)
+
+var entrySortColumns = map[string]string{
+	ENTRY_SORT_DATE:      "e.date",
+	ENTRY_SORT_NAME:      "c.lower_case_name",
+	ENTRY_SORT_NET_STOCK: "e.net_stock",
+	ENTRY_SORT_QUANTITY:  "q.total_quantity",
+}
+
+const (
+	SORT_ORDER_ASC  = "asc"
+	SORT_ORDER_DESC = "desc"
+)
+
+// Records left out of the entries unless asked for with "include": entries in the trash, and entries awaiting
+// review unless filtered on with "status=pending". Only the roles in entryIncludeRoles may ask for them.
+const (
+	ENTRY_INCLUDE_DELETED = "deleted"
+	ENTRY_INCLUDE_PENDING = "pending"
+)
+
+var entryIncludeRoles = []string{utils.ROLE_ADMIN, utils.ROLE_AUDITOR}
+
+// Largest page size accepted by the "limit" parameter
+const MAX_ENTRY_PAGE_SIZE = 500
+
+// How "voucher_no" is matched: the whole voucher number (the default) or its start, e.g. "PO-2024-" for a series
+const (
+	VOUCHER_MATCH_EXACT  = "exact"
+	VOUCHER_MATCH_PREFIX = "prefix"
+)
+
+type Entry struct {
+	Id                   string     `json:"id"`
+	Type                 string     `json:"type"`
+	Date                 string     `json:"date"`
+	Remark               string     `json:"remark"`
+	VoucherNo            string     `json:"voucher_no"`
+	NetStock             int        `json:"net_stock"`
+	CompoundId           string     `json:"compound_id"`
+	Name                 string     `json:"name"`
+	Scale                string     `json:"scale"`
+	NumOfUnits           int        `json:"num_of_units"`
+	PacksPerUnit         int        `json:"packs_per_unit"`
+	QuantityPer          int        `json:"quantity_per_unit"`
+	Partial              int        `json:"partial_quantity"`
+	Quantity             int        `json:"quantity"`
+	Packaging            string     `json:"packaging"`
+	SupplierId           string     `json:"supplier_id"`
+	SupplierName         string     `json:"supplier_name"`
+	RecipientId          string     `json:"recipient_id"`
+	Recipient            string     `json:"recipient_name"`
+	Department           string     `json:"department"`
+	Adjustment           bool       `json:"adjustment"`
+	Reason               string     `json:"reason"`
+	InstrumentId         string     `json:"instrument_id"`
+	Instrument           string     `json:"instrument_name"`
+	InstrumentEvent      string     `json:"instrument_event"`
+	DisposalMethod       string     `json:"disposal_method"`
+	DisposalAuthorizedBy string     `json:"disposal_authorized_by"`
+	LocationId           string     `json:"location_id"`
+	Location             string     `json:"location_name"`
+	ToLocationId         string     `json:"to_location_id"`
+	ToLocation           string     `json:"to_location_name"`
+	ProjectId            string     `json:"project_id"`
+	Project              string     `json:"project_name"`
+	UnitCost             *float64   `json:"unit_cost"`
+	PoLineId             string     `json:"po_line_id"`
+	Status               string     `json:"status"`
+	CreatedBy            string     `json:"created_by"`
+	ReviewedBy           string     `json:"reviewed_by"`
+	ReviewRemark         string     `json:"review_remark"`
+	Version              int        `json:"version"`
+	Deleted              bool       `json:"deleted"`
+	DeletedAt            string     `json:"deleted_at,omitempty"`
+	DeletedBy            string     `json:"deleted_by,omitempty"`
+	Lots                 []EntryLot `json:"lots"`
+	// With "display_units", the quantity and net stock in the display unit of the compound, when it has one
+	DisplayUnit     string   `json:"display_unit,omitempty"`
+	DisplayQuantity *float64 `json:"display_quantity,omitempty"`
+	DisplayNetStock *float64 `json:"display_net_stock,omitempty"`
+	// With "running_balance", the opening balance moved by the approved entries listed up to this one
+	RunningBalance *int `json:"running_balance,omitempty"`
+
+	dateUnix int64
+	seq      int64
 }
 
 func GetEntryHandler(w http.ResponseWriter, r *http.Request) {
 	reqBody := &GetEntryReq{
-		Type:         utils.GetParam(r, "entry_type"),
-		CompoundId:   utils.GetParam(r, "compound_id"),
-		FromDate:     utils.GetParam(r, "from_date"),
-		ToDate:       utils.GetParam(r, "to_date"),
-		Transactions: utils.GetParam(r, "transactions"),
+		Type:         httpx.GetParam(r, "entry_type"),
+		CompoundId:   strings.Join(r.URL.Query()["compound_id"], ","),
+		FromDate:     httpx.GetParam(r, "from_date"),
+		ToDate:       httpx.GetParam(r, "to_date"),
+		Transactions: httpx.GetParam(r, "transactions"),
+		SupplierId:   httpx.GetParam(r, "supplier_id"),
+		RecipientId:  httpx.GetParam(r, "recipient_id"),
+		InstrumentId: httpx.GetParam(r, "instrument_id"),
+		LocationId:   httpx.GetParam(r, "location_id"),
+		ProjectId:    httpx.GetParam(r, "project_id"),
+		VoucherNo:    httpx.GetParam(r, "voucher_no"),
+		VoucherMatch: httpx.GetParam(r, "voucher_match"),
+		Remark:       httpx.GetParam(r, "remark"),
+		Department:   httpx.GetParam(r, "department"),
+		Status:       httpx.GetParam(r, "status"),
+		Include:      httpx.GetParam(r, "include"),
+		Sort:         httpx.GetParam(r, "sort"),
+		Order:        httpx.GetParam(r, "order"),
+		Cursor:       httpx.GetParam(r, "cursor"),
+		Format:       httpx.GetParam(r, "format"),
+	}
+
+	limit, err := httpx.GetIntParam(r, "limit")
+	if err != nil {
+		slog.ErrorContext(r.Context(), "invalid limit", "limit", httpx.GetParam(r, "limit"), "error", err)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.INVALID_PAGINATION)
+		return
+	}
+	reqBody.Limit = limit
+	reqBody.DisplayUnits, _ = strconv.ParseBool(httpx.GetParam(r, "display_units"))
+	reqBody.RunningBalance, _ = strconv.ParseBool(httpx.GetParam(r, "running_balance"))
+
+	if user := currentUser(r); reqBody.Include != "" && !slices.Contains(entryIncludeRoles, user.Role) {
+		slog.WarnContext(r.Context(), "role not allowed to include hidden entries", "user_id", user.Id, "role", user.Role, "include", reqBody.Include)
+		httpx.RespWithError(w, http.StatusForbidden, utils.FORBIDDEN_ROLE)
+		return
 	}
 
-	if errStr := validateGetEntryReq(reqBody); errStr != utils.NO_ERR {
-		utils.RespWithError(w, http.StatusBadRequest, errStr)
+	if errStr := validateGetEntryReq(r.Context(), reqBody); errStr != utils.NO_ERR {
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
 		return
 	}
 
-	filterQuery, countQuery, filterArgs := buildGetEntryQueries(reqBody)
+	filterQuery, countQuery, queryArgs, filterArgs := buildGetEntryQueries(reqBody)
 
 	wg := sync.WaitGroup{}
 	wg.Add(1)
@@ -42,28 +202,14 @@ func GetEntryHandler(w http.ResponseWriter, r *http.Request) {
 	go func() {
 		defer wg.Done()
 		count := 0
-		errCh <- db.Conn.QueryRow(countQuery, filterArgs...).Scan(&count)
+		errCh <- db.ConnFrom(r.Context()).QueryRowContext(r.Context(), countQuery, filterArgs...).Scan(&count)
 		countCh <- count
 	}()
 
-	type Entry struct {
-		Id          string `json:"id"`
-		Type        string `json:"type"`
-		Date        string `json:"date"`
-		Remark      string `json:"remark"`
-		VoucherNo   string `json:"voucher_no"`
-		NetStock    int    `json:"net_stock"`
-		CompoundId  string `json:"compound_id"`
-		Name        string `json:"name"`
-		Scale       string `json:"scale"`
-		NumOfUnits  int    `json:"num_of_units"`
-		QuantityPer int    `json:"quantity_per_unit"`
-	}
-
-	rows, err := db.Conn.Query(filterQuery, filterArgs...)
+	rows, err := db.ConnFrom(r.Context()).QueryContext(r.Context(), filterQuery, queryArgs...)
 	if err != nil {
-		slog.Error("failed to query entry data", "error", err)
-		utils.RespWithError(w, http.StatusInternalServerError, utils.ENTRY_RETRIEVAL_ERR)
+		slog.ErrorContext(r.Context(), "failed to query entry data", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.ENTRY_RETRIEVAL_ERR)
 		return
 	}
 
@@ -71,79 +217,285 @@ func GetEntryHandler(w http.ResponseWriter, r *http.Request) {
 	close(countCh)
 	close(errCh)
 	if err := <-errCh; err != nil {
-		slog.Error("failed to scan count of entries", "error", err)
-		utils.RespWithError(w, http.StatusInternalServerError, utils.ENTRY_RETRIEVAL_ERR)
+		slog.ErrorContext(r.Context(), "failed to scan count of entries", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.ENTRY_RETRIEVAL_ERR)
 		return
 	}
 
-	data := make([]*Entry, <-countCh)
-	i := 0
+	total := <-countCh
+	data := make([]*Entry, 0, total)
 
 	for rows.Next() {
 		entry := &Entry{}
 		if err := rows.Scan(
 			&entry.Id, &entry.Type, &entry.Date, &entry.Remark, &entry.VoucherNo, &entry.NetStock,
 			&entry.CompoundId, &entry.Name, &entry.Scale,
-			&entry.NumOfUnits, &entry.QuantityPer); err != nil {
-			slog.Error("failed to scan entry row", "error", err)
-			utils.RespWithError(w, http.StatusInternalServerError, utils.ENTRY_RETRIEVAL_ERR)
+			&entry.NumOfUnits, &entry.PacksPerUnit, &entry.QuantityPer, &entry.Partial,
+			&entry.SupplierId, &entry.SupplierName,
+			&entry.RecipientId, &entry.Recipient, &entry.Department, &entry.Reason,
+			&entry.InstrumentId, &entry.Instrument, &entry.InstrumentEvent,
+			&entry.DisposalMethod, &entry.DisposalAuthorizedBy,
+			&entry.LocationId, &entry.Location, &entry.ToLocationId, &entry.ToLocation,
+			&entry.ProjectId, &entry.Project, &entry.UnitCost, &entry.PoLineId,
+			&entry.Status, &entry.CreatedBy, &entry.ReviewedBy, &entry.ReviewRemark,
+			&entry.Version, &entry.DeletedAt, &entry.DeletedBy, &entry.dateUnix, &entry.seq); err != nil {
+			slog.ErrorContext(r.Context(), "failed to scan entry row", "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.ENTRY_RETRIEVAL_ERR)
 			return
 		}
-		data[i] = entry
-		i++
+		entry.Quantity = utils.GetTotalQuantity(entry.NumOfUnits, entry.PacksPerUnit, entry.QuantityPer, entry.Partial)
+		entry.Packaging = utils.FormatPackaging(entry.NumOfUnits, entry.PacksPerUnit, entry.QuantityPer, entry.Partial, entry.Scale)
+		entry.Adjustment = utils.IsAdjustmentEntryType(entry.Type)
+		entry.Deleted = entry.DeletedAt != ""
+		data = append(data, entry)
 	}
 
-	utils.RespWithData(w, http.StatusOK, data)
+	nextCursor := ""
+	if reqBody.Limit > 0 && len(data) > reqBody.Limit {
+		data = data[:reqBody.Limit]
+		last := data[len(data)-1]
+		nextCursor = encodeEntryCursor(last.dateUnix, last.seq)
+	}
+
+	openingBalance := 0
+	if reqBody.RunningBalance {
+		openingBalance, err = fillRunningBalances(r.Context(), reqBody, countQuery, filterArgs, data)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to compute running balance", "compound_id", reqBody.CompoundId, "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.STOCK_RETRIEVAL_ERR)
+			return
+		}
+	}
+
+	entryIds := make([]string, len(data))
+	for i, entry := range data {
+		entryIds[i] = entry.Id
+	}
+	entryLots, err := getEntryLots(r.Context(), entryIds)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to retrieve lots of entries", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.LOT_RETRIEVAL_ERR)
+		return
+	}
+	for _, entry := range data {
+		entry.Lots = entryLots[entry.Id]
+	}
+
+	if reqBody.DisplayUnits {
+		displayUnits, err := utils.GetDisplayUnits(r.Context())
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to retrieve display units", "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.UNIT_RETRIEVAL_ERR)
+			return
+		}
+		for _, entry := range data {
+			if units, ok := displayUnits[entry.CompoundId]; ok {
+				quantity, netStock := utils.ConvertFromScale(entry.Quantity, &units.Scale, &units.Display), utils.ConvertFromScale(entry.NetStock, &units.Scale, &units.Display)
+				entry.DisplayUnit, entry.DisplayQuantity, entry.DisplayNetStock = units.Display.Name, &quantity, &netStock
+			}
+		}
+	}
+
+	if isExportFormat(reqBody.Format) {
+		data, err = utils.RedactForRole(currentUser(r).Role, data)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to redact entries", "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.REDACTION_ERR)
+			return
+		}
+		writeExport(r.Context(), w, reqBody.Format, entriesDocument(reqBody, data))
+		return
+	}
+
+	if reqBody.Limit == 0 && !reqBody.RunningBalance {
+		httpx.RespWithData(w, http.StatusOK, data)
+		return
+	}
+
+	resp := map[string]any{"entries": data}
+	if reqBody.Limit > 0 {
+		resp["next_cursor"], resp["total"] = nextCursor, total
+	}
+	if reqBody.RunningBalance {
+		resp["opening_balance"] = openingBalance
+	}
+	httpx.RespWithData(w, http.StatusOK, resp)
 }
 
-func validateGetEntryReq(reqBody *GetEntryReq) utils.ErrorMessage {
+func validateGetEntryReq(ctx context.Context, reqBody *GetEntryReq) utils.ErrorMessage {
 	if reqBody.Type == "" || reqBody.CompoundId == "" || reqBody.FromDate == "" || reqBody.ToDate == "" {
-		slog.Error("missing required fields", "entry_type", reqBody.Type, "compound_id", reqBody.CompoundId, "from_date", reqBody.FromDate, "to_date", reqBody.ToDate)
+		slog.ErrorContext(ctx, "missing required fields", "entry_type", reqBody.Type, "compound_id", reqBody.CompoundId, "from_date", reqBody.FromDate, "to_date", reqBody.ToDate)
 		return utils.MISSING_REQUIRED_FIELDS
 	}
 
-	if reqBody.Type != utils.ENTRY_TYPE_INCOMING && reqBody.Type != utils.ENTRY_TYPE_OUTGOING && reqBody.Type != "both" {
-		slog.Error("invalid entry type", "received", reqBody.Type)
+	if !utils.IsValidEntryType(reqBody.Type) && reqBody.Type != "both" {
+		slog.ErrorContext(ctx, "invalid entry type", "received", reqBody.Type)
 		return utils.INVALID_ENTRY_TYPE
 	}
 
 	if _, err := time.Parse("2006-01-02", reqBody.FromDate); err != nil {
-		slog.Error("invalid from_date format", "from_date", reqBody.FromDate, "error", err)
+		slog.ErrorContext(ctx, "invalid from_date format", "from_date", reqBody.FromDate, "error", err)
 		return utils.INVALID_DATE_FORMAT
 	}
 	if _, err := time.Parse("2006-01-02", reqBody.ToDate); err != nil {
-		slog.Error("invalid to_date format", "to_date", reqBody.ToDate, "error", err)
+		slog.ErrorContext(ctx, "invalid to_date format", "to_date", reqBody.ToDate, "error", err)
 		return utils.INVALID_DATE_FORMAT
 	}
 
+	if reqBody.Status != "" && !utils.IsValidEntryStatus(reqBody.Status) {
+		slog.ErrorContext(ctx, "invalid entry status", "received", reqBody.Status)
+		return utils.INVALID_ENTRY_STATUS
+	}
+
+	for _, include := range strings.Split(reqBody.Include, ",") {
+		switch strings.TrimSpace(include) {
+		case "":
+		case ENTRY_INCLUDE_DELETED:
+			reqBody.includeDeleted = true
+		case ENTRY_INCLUDE_PENDING:
+			reqBody.includePending = true
+		default:
+			slog.ErrorContext(ctx, "invalid include", "include", reqBody.Include)
+			return utils.INVALID_ENTRY_INCLUDE
+		}
+	}
+
 	if reqBody.Transactions != "basedOnDates" && reqBody.Transactions != "all" && reqBody.Transactions != "last" {
-		slog.Error("invalid transactions type", "received", reqBody.Transactions)
+		slog.ErrorContext(ctx, "invalid transactions type", "received", reqBody.Transactions)
 		return utils.INVALID_TRANSACTIONS_TYPE
 	}
 
-	unixFromDate := utils.GetDateUnix(reqBody.FromDate)
-	unixToDate := utils.GetDateUnix(reqBody.ToDate)
+	unixFromDate := datetime.GetDateUnix(ctx, reqBody.FromDate)
+	unixToDate := datetime.GetDateUnix(ctx, reqBody.ToDate)
 
-	if unixFromDate > time.Now().Unix() && unixToDate > time.Now().Unix() {
-		slog.Error("future date range provided", "from_date", reqBody.FromDate, "to_date", reqBody.ToDate)
+	if now := datetime.Now(ctx).Unix(); unixFromDate > now && unixToDate > now {
+		slog.ErrorContext(ctx, "future date range provided", "from_date", reqBody.FromDate, "to_date", reqBody.ToDate)
 		return utils.FUTURE_DATE_ERR
 	}
 
 	if unixFromDate > unixToDate {
-		slog.Error("from_date is after to_date", "from_date", reqBody.FromDate, "to_date", reqBody.ToDate)
+		slog.ErrorContext(ctx, "from_date is after to_date", "from_date", reqBody.FromDate, "to_date", reqBody.ToDate)
 		return utils.INVALID_DATE_RANGE
 	}
 
-	err := validateCompoundIdField(reqBody.CompoundId)
-	if err != utils.NO_ERR {
-		slog.Error("invalid compound_id", "compound_id", reqBody.CompoundId)
-		return err
+	// Dated transactions come newest first and the last ones by compound name, unless sorted otherwise
+	if reqBody.Sort == "" {
+		reqBody.Sort = ENTRY_SORT_DATE
+		if reqBody.Transactions == "last" {
+			reqBody.Sort = ENTRY_SORT_NAME
+		}
+	}
+	if reqBody.Order == "" {
+		reqBody.Order = SORT_ORDER_DESC
+		if reqBody.Sort == ENTRY_SORT_NAME {
+			reqBody.Order = SORT_ORDER_ASC
+		}
+	}
+	if _, ok := entrySortColumns[reqBody.Sort]; !ok || (reqBody.Order != SORT_ORDER_ASC && reqBody.Order != SORT_ORDER_DESC) {
+		slog.ErrorContext(ctx, "invalid entry sort", "sort", reqBody.Sort, "order", reqBody.Order)
+		return utils.INVALID_SORT
+	}
+
+	// Exports list the entries of each compound by date, whatever they were sorted by
+	if isExportFormat(reqBody.Format) && (reqBody.Sort != ENTRY_SORT_DATE || reqBody.Order != SORT_ORDER_DESC) {
+		slog.ErrorContext(ctx, "sort requested for export", "sort", reqBody.Sort, "order", reqBody.Order)
+		return utils.INVALID_SORT
+	}
+
+	if reqBody.Limit < 0 || reqBody.Limit > MAX_ENTRY_PAGE_SIZE || (reqBody.Cursor != "" && reqBody.Limit == 0) {
+		slog.ErrorContext(ctx, "invalid pagination", "limit", reqBody.Limit, "cursor", reqBody.Cursor)
+		return utils.INVALID_PAGINATION
+	}
+
+	if errStr := validateExportFormat(ctx, reqBody.Format); errStr != utils.NO_ERR {
+		return errStr
+	}
+
+	if reqBody.Limit > 0 && isExportFormat(reqBody.Format) {
+		slog.ErrorContext(ctx, "pagination requested for export", "limit", reqBody.Limit)
+		return utils.INVALID_PAGINATION
+	}
+
+	// Pages are keyed on the date, so only date ordered entries can be paged through
+	if reqBody.Limit > 0 && (reqBody.Transactions == "last" || reqBody.Sort != ENTRY_SORT_DATE) {
+		slog.ErrorContext(ctx, "pagination requested for entries not ordered by date", "limit", reqBody.Limit, "transactions", reqBody.Transactions, "sort", reqBody.Sort)
+		return utils.INVALID_PAGINATION
+	}
+
+	switch reqBody.VoucherMatch {
+	case "", VOUCHER_MATCH_EXACT, VOUCHER_MATCH_PREFIX:
+	default:
+		slog.ErrorContext(ctx, "invalid voucher match", "voucher_match", reqBody.VoucherMatch)
+		return utils.INVALID_VOUCHER_MATCH
+	}
+
+	if reqBody.RunningBalance && (reqBody.Transactions == "last" || reqBody.Sort != ENTRY_SORT_DATE || isExportFormat(reqBody.Format)) {
+		slog.ErrorContext(ctx, "running balance requested for entries not ordered by date", "transactions", reqBody.Transactions, "sort", reqBody.Sort, "format", reqBody.Format)
+		return utils.INVALID_RUNNING_BALANCE
+	}
+
+	if reqBody.Cursor != "" {
+		cursorDate, cursorSeq, ok := decodeEntryCursor(reqBody.Cursor)
+		if !ok {
+			slog.ErrorContext(ctx, "invalid cursor", "cursor", reqBody.Cursor)
+			return utils.INVALID_CURSOR
+		}
+		reqBody.cursorDate, reqBody.cursorSeq = cursorDate, cursorSeq
+	}
+
+	if errStr := validateEntryCompoundIds(ctx, reqBody); errStr != utils.NO_ERR {
+		return errStr
+	}
+	if reqBody.RunningBalance && len(reqBody.compoundIds) != 1 {
+		slog.ErrorContext(ctx, "running balance requested for several compounds", "compound_id", reqBody.CompoundId)
+		return utils.INVALID_RUNNING_BALANCE
+	}
+
+	if reqBody.SupplierId != "" {
+		supplierExists, err := utils.CheckIfSupplierExists(ctx, reqBody.SupplierId)
+		if err != nil || !supplierExists {
+			slog.ErrorContext(ctx, "supplier ID does not exist or DB error", "supplier_id", reqBody.SupplierId, "error", err)
+			return utils.INVALID_SUPPLIER_ID
+		}
+	}
+
+	if reqBody.RecipientId != "" {
+		recipientExists, err := utils.CheckIfRecipientExists(ctx, reqBody.RecipientId)
+		if err != nil || !recipientExists {
+			slog.ErrorContext(ctx, "recipient ID does not exist or DB error", "recipient_id", reqBody.RecipientId, "error", err)
+			return utils.INVALID_RECIPIENT_ID
+		}
+	}
+
+	if reqBody.InstrumentId != "" {
+		instrumentExists, err := utils.CheckIfInstrumentExists(ctx, reqBody.InstrumentId)
+		if err != nil || !instrumentExists {
+			slog.ErrorContext(ctx, "instrument ID does not exist or DB error", "instrument_id", reqBody.InstrumentId, "error", err)
+			return utils.INVALID_INSTRUMENT_ID
+		}
+	}
+
+	if reqBody.LocationId != "" {
+		locationExists, err := utils.CheckIfLocationExists(ctx, reqBody.LocationId)
+		if err != nil || !locationExists {
+			slog.ErrorContext(ctx, "location ID does not exist or DB error", "location_id", reqBody.LocationId, "error", err)
+			return utils.INVALID_LOCATION_ID
+		}
+	}
+
+	if reqBody.ProjectId != "" {
+		projectExists, err := utils.CheckIfProjectExists(ctx, reqBody.ProjectId)
+		if err != nil || !projectExists {
+			slog.ErrorContext(ctx, "project ID does not exist or DB error", "project_id", reqBody.ProjectId, "error", err)
+			return utils.INVALID_PROJECT_ID
+		}
 	}
 
 	return utils.NO_ERR
 }
 
-func buildGetEntryQueries(filters *GetEntryReq) (string, string, []any) {
+// Builds the entries query and its count query. The entries query gets its own arguments as pagination only applies to it.
+func buildGetEntryQueries(filters *GetEntryReq) (string, string, []any, []any) {
 	var filterArgs []any
 	var whereClause string
 
@@ -161,66 +513,93 @@ func buildGetEntryQueries(filters *GetEntryReq) (string, string, []any) {
 			whereClause += " AND e.type = ?"
 			filterArgs = append(filterArgs, filters.Type)
 		}
-		if filters.CompoundId != "all" {
-			whereClause += " AND e.compound_id = ?"
-			filterArgs = append(filterArgs, filters.CompoundId)
+		if len(filters.compoundIds) > 0 {
+			condition, args := compoundIdsCondition(filters.compoundIds)
+			whereClause += " AND " + condition
+			filterArgs = append(filterArgs, args...)
 		}
+		whereClause, filterArgs = appendOptionalFilters(filters, whereClause, filterArgs)
 
 	case "all":
 		if filters.Type != "both" {
 			whereClause = "e.type = ?"
 			filterArgs = append(filterArgs, filters.Type)
 		}
-		if filters.CompoundId != "all" {
+		if len(filters.compoundIds) > 0 {
 			if whereClause != "" {
 				whereClause += " AND "
 			}
-			whereClause += "e.compound_id = ?"
-			filterArgs = append(filterArgs, filters.CompoundId)
+			condition, args := compoundIdsCondition(filters.compoundIds)
+			whereClause += condition
+			filterArgs = append(filterArgs, args...)
 		}
+		whereClause, filterArgs = appendOptionalFilters(filters, whereClause, filterArgs)
 
 	case "last":
+		// The last transaction of a compound is the last one of those that can be listed, by the order they were
+		// recorded in when several share its date
+		visibility, visibilityArgs := entryVisibilityConditions(filters)
 		subQuery := `
-			SELECT compound_id, MAX(date) AS latest_date
-			FROM entry
-			GROUP BY compound_id
-		`
+			SELECT e.id, ROW_NUMBER() OVER (PARTITION BY e.compound_id ORDER BY e.date DESC, e.seq DESC) AS position
+			FROM entry e`
+		if len(visibility) > 0 {
+			subQuery += " WHERE " + strings.Join(visibility, " AND ")
+		}
+		subQuery = "SELECT id FROM (" + subQuery + ") WHERE position = 1"
+		filterArgs = append(filterArgs, visibilityArgs...)
 		mainQuery := `
 			SELECT
 				e.id, e.type, datetime(e.date, 'unixepoch', 'localtime'),
 				e.remark, e.voucher_no, e.net_stock,
 				c.id, c.name, c.scale,
-				q.num_of_units, q.quantity_per_unit
+				q.num_of_units, q.packs_per_unit, q.quantity_per_unit, q.partial_quantity,
+				COALESCE(e.supplier_id, ''), COALESCE(s.name, ''),
+				COALESCE(e.recipient_id, ''), COALESCE(rc.name, ''), COALESCE(rc.department, ''), COALESCE(e.reason, ''),
+				COALESCE(e.instrument_id, ''), COALESCE(ins.name, ''), COALESCE(e.instrument_event, ''),
+				COALESCE(e.disposal_method, ''), COALESCE(e.disposal_authorized_by, ''),
+				COALESCE(e.location_id, ''), COALESCE(lc.name, ''), COALESCE(e.to_location_id, ''), COALESCE(tlc.name, ''),
+				COALESCE(e.project_id, ''), COALESCE(pj.name, ''), e.unit_cost, COALESCE(e.po_line_id, ''),
+				e.status, COALESCE(e.created_by, ''), COALESCE(e.reviewed_by, ''), COALESCE(e.review_remark, ''),
+				(SELECT COALESCE(MAX(v.version), 0) + 1 FROM entry_version v WHERE v.entry_id = e.id),
+				COALESCE(datetime(e.deleted_at, 'unixepoch', 'localtime'), ''), COALESCE(e.deleted_by, ''), e.date, e.seq
 			FROM entry e
 			JOIN (` + subQuery + `) latest
-				ON e.compound_id = latest.compound_id AND e.date = latest.latest_date
+				ON e.id = latest.id
 			JOIN compound c ON e.compound_id = c.id
 			JOIN quantity q ON e.quantity_id = q.id
+			LEFT JOIN supplier s ON e.supplier_id = s.id
+			LEFT JOIN recipient rc ON e.recipient_id = rc.id
+			LEFT JOIN instrument ins ON e.instrument_id = ins.id
+			LEFT JOIN location lc ON e.location_id = lc.id
+			LEFT JOIN location tlc ON e.to_location_id = tlc.id
+			LEFT JOIN project pj ON e.project_id = pj.id
 		`
 		countQuery := `
 			SELECT COUNT(*)
 			FROM entry e
 			JOIN (` + subQuery + `) latest
-				ON e.compound_id = latest.compound_id AND e.date = latest.latest_date
+				ON e.id = latest.id
 		`
 
 		if filters.Type != "both" {
 			whereClause = "e.type = ?"
 			filterArgs = append(filterArgs, filters.Type)
 		}
-		if filters.CompoundId != "all" {
+		if len(filters.compoundIds) > 0 {
 			if whereClause != "" {
 				whereClause += " AND "
 			}
-			whereClause += "e.compound_id = ?"
-			filterArgs = append(filterArgs, filters.CompoundId)
+			condition, args := compoundIdsCondition(filters.compoundIds)
+			whereClause += condition
+			filterArgs = append(filterArgs, args...)
 		}
+		whereClause, filterArgs = appendOptionalFilters(filters, whereClause, filterArgs)
 		if whereClause != "" {
 			mainQuery += " WHERE " + whereClause
 			countQuery += " WHERE " + whereClause
 		}
-		mainQuery += " ORDER BY c.name;"
-		return mainQuery, countQuery, filterArgs
+		mainQuery += " ORDER BY " + entryOrderBy(filters) + ";"
+		return mainQuery, countQuery, filterArgs, filterArgs
 	}
 
 	query := `
@@ -228,10 +607,25 @@ func buildGetEntryQueries(filters *GetEntryReq) (string, string, []any) {
 			e.id, e.type, datetime(e.date, 'unixepoch', 'localtime'),
 			e.remark, e.voucher_no, e.net_stock,
 			c.id, c.name, c.scale,
-			q.num_of_units, q.quantity_per_unit
+			q.num_of_units, q.packs_per_unit, q.quantity_per_unit, q.partial_quantity,
+			COALESCE(e.supplier_id, ''), COALESCE(s.name, ''),
+			COALESCE(e.recipient_id, ''), COALESCE(rc.name, ''), COALESCE(rc.department, ''), COALESCE(e.reason, ''),
+			COALESCE(e.instrument_id, ''), COALESCE(ins.name, ''), COALESCE(e.instrument_event, ''),
+			COALESCE(e.disposal_method, ''), COALESCE(e.disposal_authorized_by, ''),
+			COALESCE(e.location_id, ''), COALESCE(lc.name, ''), COALESCE(e.to_location_id, ''), COALESCE(tlc.name, ''),
+			COALESCE(e.project_id, ''), COALESCE(pj.name, ''), e.unit_cost, COALESCE(e.po_line_id, ''),
+			e.status, COALESCE(e.created_by, ''), COALESCE(e.reviewed_by, ''), COALESCE(e.review_remark, ''),
+			(SELECT COALESCE(MAX(v.version), 0) + 1 FROM entry_version v WHERE v.entry_id = e.id),
+			COALESCE(datetime(e.deleted_at, 'unixepoch', 'localtime'), ''), COALESCE(e.deleted_by, ''), e.date, e.seq
 		FROM entry e
 		JOIN compound c ON e.compound_id = c.id
 		JOIN quantity q ON e.quantity_id = q.id
+		LEFT JOIN supplier s ON e.supplier_id = s.id
+		LEFT JOIN recipient rc ON e.recipient_id = rc.id
+		LEFT JOIN instrument ins ON e.instrument_id = ins.id
+		LEFT JOIN location lc ON e.location_id = lc.id
+		LEFT JOIN location tlc ON e.to_location_id = tlc.id
+		LEFT JOIN project pj ON e.project_id = pj.id
 	`
 	countQuery := `
 		SELECT COUNT(*)
@@ -240,22 +634,206 @@ func buildGetEntryQueries(filters *GetEntryReq) (string, string, []any) {
 		JOIN quantity q ON e.quantity_id = q.id
 	`
 	if whereClause != "" {
-		query += " WHERE " + whereClause
 		countQuery += " WHERE " + whereClause
 	}
-	query += " ORDER BY e.date DESC;"
-	return query, countQuery, filterArgs
+
+	queryArgs := append([]any{}, filterArgs...)
+	if filters.Cursor != "" {
+		if whereClause != "" {
+			whereClause += " AND "
+		}
+		if filters.Order == SORT_ORDER_ASC {
+			whereClause += "(e.date > ? OR (e.date = ? AND e.seq > ?))"
+		} else {
+			whereClause += "(e.date < ? OR (e.date = ? AND e.seq < ?))"
+		}
+		queryArgs = append(queryArgs, filters.cursorDate, filters.cursorDate, filters.cursorSeq)
+	}
+	if whereClause != "" {
+		query += " WHERE " + whereClause
+	}
+
+	query += " ORDER BY " + entryOrderBy(filters)
+	if filters.Limit > 0 {
+		// One extra row tells whether there is a next page
+		query += " LIMIT ?"
+		queryArgs = append(queryArgs, filters.Limit+1)
+	}
+	return query, countQuery, queryArgs, filterArgs
+}
+
+// Orders the entries by the sort column, entries sorting the same and entries of the same date newest first
+func entryOrderBy(filters *GetEntryReq) string {
+	order := strings.ToUpper(filters.Order)
+	if filters.Sort == ENTRY_SORT_DATE {
+		return "e.date " + order + ", e.seq " + order
+	}
+	return entrySortColumns[filters.Sort] + " " + order + ", e.date DESC, e.seq DESC"
+}
+
+// Encodes the position of the last entry of a page, entries are paged by (date, seq) in the order asked for
+func encodeEntryCursor(date int64, seq int64) string {
+	return base64.RawURLEncoding.EncodeToString(fmt.Appendf(nil, "%d|%d", date, seq))
+}
+
+func decodeEntryCursor(cursor string) (int64, int64, bool) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	dateStr, seqStr, found := strings.Cut(string(raw), "|")
+	if !found {
+		return 0, 0, false
+	}
+	date, err := strconv.ParseInt(dateStr, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	seq, err := strconv.ParseInt(seqStr, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return date, seq, true
+}
+
+// Conditions leaving out the entries not asked for with "include", and their arguments
+func entryVisibilityConditions(filters *GetEntryReq) ([]string, []any) {
+	conditions, args := []string{}, []any{}
+	if !filters.includeDeleted {
+		conditions = append(conditions, "e.deleted_at IS NULL")
+	}
+	if !filters.includePending && filters.Status != utils.ENTRY_STATUS_PENDING {
+		conditions = append(conditions, "e.status != ?")
+		args = append(args, utils.ENTRY_STATUS_PENDING)
+	}
+	return conditions, args
+}
+
+// Adds the optional filters shared by every transactions type to the where clause, along with the conditions leaving
+// out the deleted and pending entries not asked for
+func appendOptionalFilters(filters *GetEntryReq, whereClause string, filterArgs []any) (string, []any) {
+	conditions := []string{}
+	if whereClause != "" {
+		conditions = append(conditions, whereClause)
+	}
+	visibility, visibilityArgs := entryVisibilityConditions(filters)
+	conditions = append(conditions, visibility...)
+	filterArgs = append(filterArgs, visibilityArgs...)
+
+	if filters.SupplierId != "" {
+		conditions = append(conditions, "e.supplier_id = ?")
+		filterArgs = append(filterArgs, filters.SupplierId)
+	}
+
+	if filters.RecipientId != "" {
+		conditions = append(conditions, "e.recipient_id = ?")
+		filterArgs = append(filterArgs, filters.RecipientId)
+	}
+
+	if filters.InstrumentId != "" {
+		conditions = append(conditions, "e.instrument_id = ?")
+		filterArgs = append(filterArgs, filters.InstrumentId)
+	}
+
+	// Transfers are listed at both the location they take from and the one they move to
+	if filters.LocationId != "" {
+		conditions = append(conditions, "(e.location_id = ? OR e.to_location_id = ?)")
+		filterArgs = append(filterArgs, filters.LocationId, filters.LocationId)
+	}
+
+	if filters.ProjectId != "" {
+		conditions = append(conditions, "e.project_id = ?")
+		filterArgs = append(filterArgs, filters.ProjectId)
+	}
+
+	if filters.VoucherNo != "" {
+		if filters.VoucherMatch == VOUCHER_MATCH_PREFIX {
+			conditions = append(conditions, `e.voucher_no LIKE ? || '%' ESCAPE '\'`)
+			filterArgs = append(filterArgs, utils.EscapeLike(filters.VoucherNo))
+		} else {
+			conditions = append(conditions, "e.voucher_no = ?")
+			filterArgs = append(filterArgs, filters.VoucherNo)
+		}
+	}
+
+	// Remarks are free text, so any part of one is matched, ignoring case
+	if filters.Remark != "" {
+		conditions = append(conditions, `e.remark LIKE '%' || ? || '%' ESCAPE '\'`)
+		filterArgs = append(filterArgs, utils.EscapeLike(filters.Remark))
+	}
+
+	if filters.Department != "" {
+		conditions = append(conditions, "e.recipient_id IN (SELECT id FROM recipient WHERE department = ?)")
+		filterArgs = append(filterArgs, filters.Department)
+	}
+
+	if filters.Status != "" {
+		conditions = append(conditions, "e.status = ?")
+		filterArgs = append(filterArgs, filters.Status)
+	}
+
+	return strings.Join(conditions, " AND "), filterArgs
+}
+
+// Checks the compounds the entries are filtered by: "all", or one or more compound IDs separated by commas or given
+// as repeated "compound_id" parameters, e.g. to compare a few related solvents side by side
+func validateEntryCompoundIds(ctx context.Context, reqBody *GetEntryReq) utils.ErrorMessage {
+	if strings.TrimSpace(reqBody.CompoundId) == "all" {
+		return utils.NO_ERR
+	}
+
+	seen := map[string]bool{}
+	for _, id := range strings.Split(reqBody.CompoundId, ",") {
+		id = strings.TrimSpace(id)
+		if id == "" || seen[id] {
+			continue
+		}
+		// "all" cannot be one of several compounds
+		if id == "all" {
+			slog.ErrorContext(ctx, "invalid compound_id", "compound_id", reqBody.CompoundId)
+			return utils.INVALID_COMPOUND_ID
+		}
+		seen[id] = true
+		reqBody.compoundIds = append(reqBody.compoundIds, id)
+	}
+
+	if len(reqBody.compoundIds) == 0 {
+		slog.ErrorContext(ctx, "missing required fields", "compound_id", reqBody.CompoundId)
+		return utils.MISSING_REQUIRED_FIELDS
+	}
+	if len(reqBody.compoundIds) > MAX_ENTRY_COMPOUNDS {
+		slog.ErrorContext(ctx, "too many compounds", "count", len(reqBody.compoundIds))
+		return utils.TOO_MANY_ENTRY_COMPOUNDS
+	}
+
+	for _, id := range reqBody.compoundIds {
+		if errStr := validateCompoundIdField(ctx, id); errStr != utils.NO_ERR {
+			slog.ErrorContext(ctx, "invalid compound_id", "compound_id", id)
+			return errStr
+		}
+	}
+	return utils.NO_ERR
+}
+
+// Condition matching entries of any of the given compounds, with a placeholder for each
+func compoundIdsCondition(compoundIds []string) (string, []any) {
+	args := make([]any, 0, len(compoundIds))
+	for _, id := range compoundIds {
+		args = append(args, id)
+	}
+	return "e.compound_id IN (" + strings.TrimSuffix(strings.Repeat("?, ", len(compoundIds)), ", ") + ")", args
 }
 
-func validateCompoundIdField(id string) utils.ErrorMessage {
+func validateCompoundIdField(ctx context.Context, id string) utils.ErrorMessage {
 	if strings.TrimSpace(id) == "all" {
 		return utils.NO_ERR
 	}
 
 	var exists bool
-	err := db.Conn.QueryRow("SELECT EXISTS (SELECT 1 FROM compound WHERE id = ?)", id).Scan(&exists)
+	err := db.ConnFrom(ctx).QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM compound WHERE id = ?)", id).Scan(&exists)
 	if err != nil || !exists {
-		slog.Error("compound ID does not exist or DB error", "compound_id", id, "error", err)
+		slog.ErrorContext(ctx, "compound ID does not exist or DB error", "compound_id", id, "error", err)
 		return utils.INVALID_COMPOUND_ID
 	}
 
@@ -0,0 +1,311 @@
+package handlers_test
+
+import (
+	"chemical-ledger-backend/handlers"
+	"chemical-ledger-backend/testutils"
+	"chemical-ledger-backend/utils"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEntriesAreFilteredByVoucherAndRemark(t *testing.T) {
+	t.Parallel()
+	env := testutils.NewEnv(t, time.Date(2026, 3, 14, 10, 0, 0, 0, time.Local))
+
+	env.InsertCompound("C_1", "Acetone", "ml")
+	for _, entry := range [][2]string{{"PO-2026-01", "Rack B, cold room"}, {"PO-2026-02", "100% pure"}, {"PO-2025-07", "rack a"}} {
+		env.Clock.Advance(time.Minute)
+		body := fmt.Sprintf(`{"type": "incoming", "compound_id": "C_1", "date": "2026-03-14", "num_of_units": 1, "quantity_per_unit": 100, "voucher_no": %q, "remark": %q}`, entry[0], entry[1])
+		w := httptest.NewRecorder()
+		handlers.InsertEntryHandler(w, env.Request(http.MethodPost, "/insert-entry", strings.NewReader(body)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("entry %s: status %d, %s", entry[0], w.Code, w.Body)
+		}
+	}
+
+	count := func(filters string) int {
+		w := httptest.NewRecorder()
+		handlers.GetEntryHandler(w, env.Request(http.MethodGet, "/get-entry?transactions=basedOnDates&from_date=2026-03-01&to_date=2026-03-14&compound_id=all&entry_type=both&"+filters, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("filters %s: status %d, %s", filters, w.Code, w.Body)
+		}
+		return strings.Count(w.Body.String(), `"voucher_no":"PO-`)
+	}
+
+	for filters, want := range map[string]int{
+		"voucher_no=PO-2026":                       0,
+		"voucher_no=PO-2026-02":                    1,
+		"voucher_no=PO-2026-&voucher_match=prefix": 2,
+		"voucher_no=PO-202_&voucher_match=prefix":  0,
+		"remark=RACK":                              2,
+		"remark=%25":                               1,
+		"remark=rack&voucher_no=PO-2025-07":        1,
+	} {
+		if got := count(filters); got != want {
+			t.Errorf("%s: got %d entries, want %d", filters, got, want)
+		}
+	}
+}
+
+func TestEntriesAreFilteredBySeveralCompounds(t *testing.T) {
+	t.Parallel()
+	env := testutils.NewEnv(t, time.Date(2026, 3, 14, 10, 0, 0, 0, time.Local))
+
+	for _, compound := range [][2]string{{"C_1", "Acetone"}, {"C_2", "Ethanol"}, {"C_3", "Methanol"}} {
+		env.InsertCompound(compound[0], compound[1], "ml")
+		env.Clock.Advance(time.Minute)
+		body := fmt.Sprintf(`{"type": "incoming", "compound_id": %q, "date": "2026-03-14", "num_of_units": 1, "quantity_per_unit": 100}`, compound[0])
+		w := httptest.NewRecorder()
+		handlers.InsertEntryHandler(w, env.Request(http.MethodPost, "/insert-entry", strings.NewReader(body)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("entry of %s: status %d, %s", compound[0], w.Code, w.Body)
+		}
+	}
+
+	get := func(compounds string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handlers.GetEntryHandler(w, env.Request(http.MethodGet, "/get-entry?transactions=basedOnDates&from_date=2026-03-01&to_date=2026-03-14&entry_type=both&"+compounds, nil))
+		return w
+	}
+
+	for compounds, want := range map[string]int{
+		"compound_id=C_1":                 1,
+		"compound_id=C_1,C_3":             2,
+		"compound_id=C_1,%20C_2,C_1":      2,
+		"compound_id=C_2&compound_id=C_3": 2,
+		"compound_id=all":                 3,
+	} {
+		w := get(compounds)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status %d, %s", compounds, w.Code, w.Body)
+		}
+		if got := strings.Count(w.Body.String(), `"type":"incoming"`); got != want {
+			t.Errorf("%s: got %d entries, want %d", compounds, got, want)
+		}
+	}
+
+	for _, compounds := range []string{"compound_id=C_1,C_9", "compound_id=C_1,all", "compound_id=,"} {
+		if w := get(compounds); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", compounds, w.Code)
+		}
+	}
+}
+
+func TestEntriesAreSortedAsAsked(t *testing.T) {
+	t.Parallel()
+	env := testutils.NewEnv(t, time.Date(2026, 3, 14, 10, 0, 0, 0, time.Local))
+
+	env.InsertCompound("C_1", "ethanol", "ml")
+	env.InsertCompound("C_2", "Acetone", "ml")
+	for _, entry := range []struct {
+		compoundId string
+		quantity   int
+	}{{"C_1", 300}, {"C_2", 100}, {"C_1", 200}} {
+		env.Clock.Advance(time.Minute)
+		if w := insertEntry(env, utils.ENTRY_TYPE_INCOMING, entry.compoundId, "2026-03-14", entry.quantity); w.Code != http.StatusOK {
+			t.Fatalf("entry: status %d, %s", w.Code, w.Body)
+		}
+	}
+
+	get := func(params string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handlers.GetEntryHandler(w, env.Request(http.MethodGet, "/get-entry?transactions=all&from_date=2026-03-01&to_date=2026-03-14&compound_id=all&entry_type=both&"+params, nil))
+		return w
+	}
+	quantities := func(body string) string {
+		found := []string{}
+		for _, part := range strings.Split(body, `"quantity_per_unit":`)[1:] {
+			found = append(found, part[:strings.IndexAny(part, ",}")])
+		}
+		return strings.Join(found, " ")
+	}
+
+	for params, want := range map[string]string{
+		"":                         "200 100 300",
+		"order=asc":                "300 100 200",
+		"sort=quantity":            "300 200 100",
+		"sort=quantity&order=asc":  "100 200 300",
+		"sort=name":                "100 200 300",
+		"sort=net_stock&order=asc": "100 300 200",
+		"order=asc&limit=2":        "300 100",
+	} {
+		w := get(params)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status %d, %s", params, w.Code, w.Body)
+		}
+		if got := quantities(w.Body.String()); got != want {
+			t.Errorf("%s: quantities %s, want %s", params, got, want)
+		}
+	}
+
+	for _, params := range []string{"sort=voucher_no", "order=up", "sort=quantity&limit=2", "sort=name&format=xlsx"} {
+		if w := get(params); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", params, w.Code)
+		}
+	}
+}
+
+func TestRunningBalanceOfOneCompound(t *testing.T) {
+	t.Parallel()
+	env := testutils.NewEnv(t, time.Date(2026, 3, 14, 10, 0, 0, 0, time.Local))
+
+	env.InsertCompound("C_1", "Acetone", "ml")
+	env.InsertCompound("C_2", "Ethanol", "ml")
+	for _, entry := range []struct {
+		entryType, compoundId, date string
+		quantity                    int
+	}{
+		{utils.ENTRY_TYPE_INCOMING, "C_1", "2026-03-01", 500},
+		{utils.ENTRY_TYPE_INCOMING, "C_2", "2026-03-11", 900},
+		{utils.ENTRY_TYPE_INCOMING, "C_1", "2026-03-12", 100},
+		{utils.ENTRY_TYPE_OUTGOING, "C_1", "2026-03-13", 50},
+	} {
+		if w := insertEntry(env, entry.entryType, entry.compoundId, entry.date, entry.quantity); w.Code != http.StatusOK {
+			t.Fatalf("entry of %s: status %d, %s", entry.date, w.Code, w.Body)
+		}
+	}
+
+	get := func(params string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handlers.GetEntryHandler(w, env.Request(http.MethodGet, "/get-entry?transactions=basedOnDates&from_date=2026-03-10&to_date=2026-03-14&entry_type=both&running_balance=true&"+params, nil))
+		return w
+	}
+
+	w := get("compound_id=C_1")
+	if body := w.Body.String(); w.Code != http.StatusOK || !strings.Contains(body, `"opening_balance":500`) ||
+		!strings.Contains(body, `"running_balance":550`) || !strings.Contains(body, `"running_balance":600`) {
+		t.Fatalf("statement: status %d, %s", w.Code, body)
+	}
+
+	// A page starts from the balance left by the entries before it
+	first := get("compound_id=C_1&limit=1")
+	cursor := first.Body.String()[strings.Index(first.Body.String(), `"next_cursor":"`)+len(`"next_cursor":"`):]
+	cursor = cursor[:strings.Index(cursor, `"`)]
+	if !strings.Contains(first.Body.String(), `"running_balance":550`) {
+		t.Errorf("first page: %s", first.Body)
+	}
+	if second := get("compound_id=C_1&limit=1&cursor=" + cursor); !strings.Contains(second.Body.String(), `"running_balance":600`) ||
+		!strings.Contains(second.Body.String(), `"opening_balance":500`) {
+		t.Errorf("second page: %s", second.Body)
+	}
+
+	for _, params := range []string{"compound_id=all", "compound_id=C_1,C_2", "compound_id=C_1&sort=quantity"} {
+		if w := get(params); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", params, w.Code)
+		}
+	}
+}
+
+// Deleted and pending entries are only listed when admins or auditors ask for them
+func TestGetEntryIncludesDeletedAndPendingForAdmins(t *testing.T) {
+	t.Parallel()
+	env := testutils.NewEnv(t, time.Date(2026, 3, 14, 10, 0, 0, 0, time.Local))
+
+	env.InsertCompound("C_1", "Acetone", "ml")
+	if _, err := env.DB.Exec(
+		"INSERT INTO user (id, name, role) VALUES ('U_op', 'Operator', 'operator'), ('U_audit', 'Auditor', 'auditor')",
+	); err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range []struct {
+		entryType string
+		date      string
+		quantity  int
+	}{{utils.ENTRY_TYPE_INCOMING, "2026-03-02", 1000}, {utils.ENTRY_TYPE_OUTGOING, "2026-03-05", 100}, {utils.ENTRY_TYPE_OUTGOING, "2026-03-06", 50}} {
+		if w := insertEntry(env, e.entryType, "C_1", e.date, e.quantity); w.Code != http.StatusOK {
+			t.Fatalf("entry: status %d, %s", w.Code, w.Body)
+		}
+	}
+	req := env.Request(http.MethodPost, "/insert-entry", strings.NewReader(
+		`{"type": "outgoing", "compound_id": "C_1", "date": "2026-03-07", "num_of_units": 1, "quantity_per_unit": 30}`,
+	))
+	env.SignIn(req, "U_op")
+	w := httptest.NewRecorder()
+	handlers.IdentifyUserMiddleware(http.HandlerFunc(handlers.InsertEntryHandler)).ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("pending entry: status %d, %s", w.Code, w.Body)
+	}
+
+	var deletedId string
+	if err := env.DB.QueryRow(
+		"SELECT e.id FROM entry e JOIN quantity q ON e.quantity_id = q.id WHERE q.total_quantity = 100",
+	).Scan(&deletedId); err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	handlers.DeleteEntryHandler(w, env.Request(http.MethodDelete, "/delete-entry?id="+deletedId, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("delete: status %d, %s", w.Code, w.Body)
+	}
+
+	get := func(userId string, params string) *httptest.ResponseRecorder {
+		req := env.Request(http.MethodGet, "/get-entry?transactions=basedOnDates&from_date=2026-03-01&to_date=2026-03-14&compound_id=C_1&entry_type=both&running_balance=true&"+params, nil)
+		env.SignIn(req, userId)
+		req.RemoteAddr = "127.0.0.1:51234"
+		w := httptest.NewRecorder()
+		handlers.IdentifyUserMiddleware(http.HandlerFunc(handlers.GetEntryHandler)).ServeHTTP(w, req)
+		return w
+	}
+	for _, tc := range []struct {
+		userId, params   string
+		entries, deleted int
+	}{
+		{"U_op", "", 2, 0},
+		{"U_op", "status=pending", 1, 0},
+		{"U_audit", "include=pending", 3, 0},
+		{"U_local", "include=deleted", 3, 1},
+		{"U_audit", "include=deleted,pending", 4, 1},
+	} {
+		w := get(tc.userId, tc.params)
+		body := w.Body.String()
+		if w.Code != http.StatusOK || strings.Count(body, `"id"`) != tc.entries || strings.Count(body, `"deleted":true`) != tc.deleted {
+			t.Errorf("%s %q: status %d, %s", tc.userId, tc.params, w.Code, body)
+		}
+		// Neither the deleted issue nor the pending one moves the balance, which ends at 950
+		if tc.params != "status=pending" && !strings.Contains(body, `"running_balance":950`) {
+			t.Errorf("%s %q: running balance, %s", tc.userId, tc.params, body)
+		}
+	}
+
+	if w := get("U_op", "include=deleted"); w.Code != http.StatusForbidden {
+		t.Errorf("operator including deleted entries: status %d, %s", w.Code, w.Body)
+	}
+	if w := get("U_audit", "include=rejected"); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown include: status %d, %s", w.Code, w.Body)
+	}
+}
+
+// Of the entries sharing the latest date, and even the second, the last one recorded is the last transaction
+func TestLastTransactionIsTheLastRecordedOfItsDay(t *testing.T) {
+	t.Parallel()
+	env := testutils.NewEnv(t, time.Date(2026, 3, 14, 10, 0, 0, 0, time.Local))
+
+	env.InsertCompound("C_1", "Acetone", "ml")
+	env.InsertCompound("C_2", "Ethanol", "ml")
+	for _, entry := range []struct {
+		entryType  string
+		compoundId string
+		quantity   int
+	}{
+		{utils.ENTRY_TYPE_INCOMING, "C_1", 100},
+		{utils.ENTRY_TYPE_INCOMING, "C_2", 40},
+		{utils.ENTRY_TYPE_OUTGOING, "C_1", 30},
+		{utils.ENTRY_TYPE_INCOMING, "C_1", 5},
+	} {
+		if w := insertEntry(env, entry.entryType, entry.compoundId, "2026-03-14", entry.quantity); w.Code != http.StatusOK {
+			t.Fatalf("entry: status %d, %s", w.Code, w.Body)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	handlers.GetEntryHandler(w, env.Request(http.MethodGet, "/get-entry?transactions=last&from_date=2026-03-01&to_date=2026-03-14&compound_id=all&entry_type=both", nil))
+	body := w.Body.String()
+	if w.Code != http.StatusOK || strings.Count(body, `"net_stock":`) != 2 ||
+		!strings.Contains(body, `"net_stock":75`) || !strings.Contains(body, `"net_stock":40`) {
+		t.Errorf("last transactions: status %d, %s", w.Code, body)
+	}
+}
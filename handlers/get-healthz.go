@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+const (
+	HEALTH_OK      = "ok"
+	HEALTH_FAILING = "failing"
+)
+
+// Reports whether the backend is alive: the database answers and the folder it is kept in takes writes, which SQLite
+// needs for its journal. Unlike /readyz nothing optional is looked at, so a launcher or orchestrator restarting the
+// backend on a 503 only does so when restarting can help.
+func GetHealthzHandler(w http.ResponseWriter, r *http.Request) {
+	status := HEALTH_OK
+	httpStatus := http.StatusOK
+
+	database := "up"
+	if err := db.ConnFrom(r.Context()).PingContext(r.Context()); err != nil {
+		slog.ErrorContext(r.Context(), "health check: database ping failed", "error", err)
+		database = "down"
+		status = HEALTH_FAILING
+		httpStatus = http.StatusServiceUnavailable
+	}
+
+	disk := "writable"
+	if err := checkDatabaseDirWritable(r); err != nil {
+		slog.ErrorContext(r.Context(), "health check: database folder not writable", "error", err)
+		disk = "not_writable"
+		status = HEALTH_FAILING
+		httpStatus = http.StatusServiceUnavailable
+	}
+
+	httpx.RespWithData(w, httpStatus, map[string]any{
+		"status":   status,
+		"database": database,
+		"disk":     disk,
+	})
+}
+
+// Writes and removes a probe file next to the database. In-memory databases have no folder and always pass.
+func checkDatabaseDirWritable(r *http.Request) error {
+	file, err := db.GetDatabaseFile(r.Context(), db.ConnFrom(r.Context()))
+	if err != nil || file == "" {
+		return err
+	}
+	probe, err := os.CreateTemp(filepath.Dir(file), ".healthz-*")
+	if err != nil {
+		return err
+	}
+	probe.Close()
+	return os.Remove(probe.Name())
+}
@@ -0,0 +1,53 @@
+package handlers_test
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/handlers"
+	"chemical-ledger-backend/testutils"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHealthNeedsDatabaseAndWritableFolder(t *testing.T) {
+	t.Parallel()
+	env := testutils.NewEnv(t, time.Date(2026, 3, 14, 10, 0, 0, 0, time.Local))
+
+	w := httptest.NewRecorder()
+	handlers.GetHealthzHandler(w, env.Request(http.MethodGet, "/healthz", nil))
+	if body := w.Body.String(); w.Code != http.StatusOK || !strings.Contains(body, `"database":"up"`) || !strings.Contains(body, `"disk":"writable"`) {
+		t.Errorf("healthz: status %d, %s", w.Code, body)
+	}
+
+	// Pending migrations make the backend unready, not unhealthy
+	if _, err := env.DB.Exec("PRAGMA user_version = 0"); err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	handlers.GetHealthzHandler(w, env.Request(http.MethodGet, "/healthz", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("healthz before migrating: status %d, %s", w.Code, w.Body)
+	}
+
+	// The folder of the database no longer taking writes fails the health check
+	file, err := db.GetDatabaseFile(env.Context(), env.DB)
+	if err != nil || file == "" {
+		t.Fatalf("database file %q: %v", file, err)
+	}
+	if os.Getuid() == 0 {
+		t.Skip("root writes to read-only folders")
+	}
+	if err := os.Chmod(filepath.Dir(file), 0555); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(filepath.Dir(file), 0755)
+	w = httptest.NewRecorder()
+	handlers.GetHealthzHandler(w, env.Request(http.MethodGet, "/healthz", nil))
+	if body := w.Body.String(); w.Code != http.StatusServiceUnavailable || !strings.Contains(body, `"disk":"not_writable"`) {
+		t.Errorf("healthz on a read-only folder: status %d, %s", w.Code, body)
+	}
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/export"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"log/slog"
+	"net/http"
+)
+
+type GetInstrumentReportReq struct {
+	InstrumentId string `json:"instrument_id"`
+	LocationId   string `json:"location_id"`
+	FromDate     string `json:"from_date"`
+	ToDate       string `json:"to_date"`
+	Format       string `json:"format"`
+}
+
+// Summarises the outgoing entries linked to instruments per instrument, compound and event (calibration,
+// maintenance or empty for other use), optionally for one instrument, the issues from one location and/or a date
+// range, to tell what the upkeep of each instrument takes. Can be
+// downloaded in any export "format".
+func GetInstrumentReportHandler(w http.ResponseWriter, r *http.Request) {
+	reqBody := &GetInstrumentReportReq{
+		InstrumentId: httpx.GetParam(r, "instrument_id"),
+		LocationId:   httpx.GetParam(r, "location_id"),
+		FromDate:     httpx.GetParam(r, "from_date"),
+		ToDate:       httpx.GetParam(r, "to_date"),
+		Format:       httpx.GetParam(r, "format"),
+	}
+
+	if errStr := validateExportFormat(r.Context(), reqBody.Format); errStr != utils.NO_ERR {
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	query := `
+		SELECT
+			ins.id, ins.name, c.id, c.name, c.scale, COALESCE(e.instrument_event, ''),
+			COUNT(e.id), SUM(q.total_quantity)
+		FROM entry e
+		JOIN instrument ins ON e.instrument_id = ins.id
+		JOIN compound c ON e.compound_id = c.id
+		JOIN quantity q ON e.quantity_id = q.id
+		WHERE e.type = ? AND e.status = ? AND e.deleted_at IS NULL`
+	args := []any{utils.ENTRY_TYPE_OUTGOING, utils.ENTRY_STATUS_APPROVED}
+
+	if reqBody.InstrumentId != "" {
+		query += " AND e.instrument_id = ?"
+		args = append(args, reqBody.InstrumentId)
+	}
+
+	if reqBody.LocationId != "" {
+		if errStr := validateLocationIdField(r.Context(), reqBody.LocationId); errStr != utils.NO_ERR {
+			httpx.RespWithError(w, http.StatusBadRequest, errStr)
+			return
+		}
+		query += " AND e.location_id = ?"
+		args = append(args, reqBody.LocationId)
+	}
+
+	fromUnix, toUnix, errStr := parseReportRange(r.Context(), reqBody.FromDate, reqBody.ToDate)
+	if errStr != utils.NO_ERR {
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+	query += " AND e.date >= ? AND e.date < ?"
+	args = append(args, fromUnix, toUnix)
+
+	query += ` GROUP BY ins.id, c.id, COALESCE(e.instrument_event, '')
+		ORDER BY ins.lower_case_name ASC, c.lower_case_name ASC, COALESCE(e.instrument_event, '') ASC`
+
+	rows, err := db.ConnFrom(r.Context()).QueryContext(r.Context(), query, args...)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to query instrument report", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.REPORT_RETRIEVAL_ERR)
+		return
+	}
+	defer rows.Close()
+
+	type Consumption struct {
+		InstrumentId   string `json:"instrument_id"`
+		InstrumentName string `json:"instrument_name"`
+		CompoundId     string `json:"compound_id"`
+		CompoundName   string `json:"compound_name"`
+		Scale          string `json:"scale"`
+		Event          string `json:"instrument_event"`
+		Entries        int    `json:"entries"`
+		TotalQuantity  int    `json:"total_quantity"`
+	}
+
+	consumption := []Consumption{}
+	for rows.Next() {
+		var c Consumption
+		if err := rows.Scan(&c.InstrumentId, &c.InstrumentName, &c.CompoundId, &c.CompoundName, &c.Scale, &c.Event, &c.Entries, &c.TotalQuantity); err != nil {
+			slog.ErrorContext(r.Context(), "failed to scan instrument consumption row", "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.REPORT_RETRIEVAL_ERR)
+			return
+		}
+		consumption = append(consumption, c)
+	}
+
+	if isExportFormat(reqBody.Format) {
+		writeRedactedExport(w, r, reqBody.Format, consumption, func(consumption []Consumption) *export.Document {
+			table := export.Table{
+				Name:    "Consumption",
+				Columns: []string{"Instrument", "Compound", "Event", "Entries", "Quantity", "Scale"},
+			}
+			for _, c := range consumption {
+				table.AddRow(c.InstrumentName, c.CompoundName, c.Event, c.Entries, c.TotalQuantity, c.Scale)
+			}
+			return &export.Document{
+				Name:   exportName(r.Context(), "instrument-consumption"),
+				Title:  "Consumption by instrument",
+				Tables: []export.Table{table},
+			}
+		})
+		return
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"consumption": consumption,
+	})
+}
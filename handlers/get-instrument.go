@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"log/slog"
+	"net/http"
+)
+
+func GetInstrumentHandler(w http.ResponseWriter, r *http.Request) {
+	rows, err := db.ConnFrom(r.Context()).QueryContext(r.Context(), `
+		SELECT id, name, model, serial_no, location
+		FROM instrument
+		ORDER BY lower_case_name ASC
+	`)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to query instruments", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.INSTRUMENT_RETRIEVAL_ERR)
+		return
+	}
+	defer rows.Close()
+
+	type Instrument struct {
+		ID       string `json:"key"`
+		Name     string `json:"name"`
+		Model    string `json:"model"`
+		SerialNo string `json:"serial_no"`
+		Location string `json:"location"`
+	}
+
+	instruments := []Instrument{}
+	for rows.Next() {
+		var instrument Instrument
+		if err := rows.Scan(&instrument.ID, &instrument.Name, &instrument.Model, &instrument.SerialNo, &instrument.Location); err != nil {
+			slog.ErrorContext(r.Context(), "failed to scan instrument row", "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.INSTRUMENT_RETRIEVAL_ERR)
+			return
+		}
+		instruments = append(instruments, instrument)
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"instruments": instruments,
+	})
+}
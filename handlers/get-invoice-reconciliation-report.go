@@ -0,0 +1,263 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/export"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"context"
+	"log/slog"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Problems a reconciliation line can be flagged with, in the order they are listed
+const (
+	RECONCILIATION_NOT_INVOICED  = "not_invoiced"
+	RECONCILIATION_NOT_DELIVERED = "not_delivered"
+	RECONCILIATION_QUANTITY      = "quantity"
+	RECONCILIATION_AMOUNT        = "amount"
+	RECONCILIATION_UNCOSTED      = "uncosted_deliveries"
+)
+
+// Deliveries of a compound by a supplier in a month against what the supplier invoiced for it
+type InvoiceReconciliation struct {
+	SupplierId        string  `json:"supplier_id"`
+	SupplierName      string  `json:"supplier_name"`
+	Month             string  `json:"month"`
+	CompoundId        string  `json:"compound_id"`
+	CompoundName      string  `json:"compound_name"`
+	Scale             string  `json:"scale"`
+	Deliveries        int     `json:"deliveries"`
+	DeliveredQuantity int     `json:"delivered_quantity"`
+	DeliveredAmount   float64 `json:"delivered_amount"`
+	// Deliveries recorded without a unit cost, whose amount is unknown
+	UncostedDeliveries int      `json:"uncosted_deliveries"`
+	InvoiceNos         []string `json:"invoice_nos"`
+	InvoicedQuantity   int      `json:"invoiced_quantity"`
+	InvoicedAmount     float64  `json:"invoiced_amount"`
+	QuantityDifference int      `json:"quantity_difference"`
+	AmountDifference   float64  `json:"amount_difference"`
+	Problems           []string `json:"problems"`
+	Matched            bool     `json:"matched"`
+}
+
+// Matches the approved deliveries of each supplier against the invoices entered for them, per month and compound,
+// for the accounts department. A delivery's amount is its unit cost over the quantity it came in. Lines whose
+// quantities or amounts differ, that were delivered but not invoiced or the other way round, or whose deliveries were
+// recorded without a cost are flagged with their "problems". "from_month" and "to_month" (YYYY-MM) limit the months,
+// "supplier_id" the supplier, and "mismatches=true" leaves out the lines that match. An export "format" downloads the
+// lines for the accounts department's own books.
+func GetInvoiceReconciliationReportHandler(w http.ResponseWriter, r *http.Request) {
+	supplierId := httpx.GetParam(r, "supplier_id")
+	fromMonth, toMonth := httpx.GetParam(r, "from_month"), httpx.GetParam(r, "to_month")
+	mismatchesOnly := httpx.GetParam(r, "mismatches") == "true"
+	format := httpx.GetParam(r, "format")
+	if errStr := validateExportFormat(r.Context(), format); errStr != utils.NO_ERR {
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	if supplierId != "" {
+		if errStr := validateSupplierIdField(r.Context(), supplierId); errStr != utils.NO_ERR {
+			httpx.RespWithError(w, http.StatusBadRequest, errStr)
+			return
+		}
+	}
+	for _, month := range []string{fromMonth, toMonth} {
+		if month == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01", month); err != nil {
+			slog.ErrorContext(r.Context(), "invalid month format", "month", month, "error", err)
+			httpx.RespWithError(w, http.StatusBadRequest, utils.INVALID_MONTH_FORMAT)
+			return
+		}
+	}
+	if fromMonth != "" && toMonth != "" && fromMonth > toMonth {
+		slog.ErrorContext(r.Context(), "from month is after to month", "from_month", fromMonth, "to_month", toMonth)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.INVALID_DATE_RANGE)
+		return
+	}
+
+	lines := map[string]*InvoiceReconciliation{}
+	line := func(supplierId, supplierName, month, compoundId, compoundName, scale string) *InvoiceReconciliation {
+		key := supplierId + "|" + month + "|" + compoundId
+		if lines[key] == nil {
+			lines[key] = &InvoiceReconciliation{
+				SupplierId: supplierId, SupplierName: supplierName, Month: month,
+				CompoundId: compoundId, CompoundName: compoundName, Scale: scale,
+				InvoiceNos: []string{}, Problems: []string{},
+			}
+		}
+		return lines[key]
+	}
+	inRange := " AND (? = '' OR month >= ?) AND (? = '' OR month <= ?) AND (? = '' OR supplier_id = ?)"
+	rangeArgs := []any{fromMonth, fromMonth, toMonth, toMonth, supplierId, supplierId}
+
+	rows, err := db.ConnFrom(r.Context()).QueryContext(r.Context(), `
+		SELECT supplier_id, supplier_name, month, compound_id, compound_name, scale,
+			COUNT(*), SUM(quantity), COALESCE(SUM(amount), 0), COUNT(*) - COUNT(amount)
+		FROM (
+			SELECT
+				e.supplier_id, s.name AS supplier_name, strftime('%Y-%m', e.date, 'unixepoch', 'localtime') AS month,
+				e.compound_id, c.name AS compound_name, c.scale, q.total_quantity AS quantity,
+				e.unit_cost * q.total_quantity / NULLIF(q.packs_per_unit * q.quantity_per_unit, 0) AS amount
+			FROM entry e
+			JOIN supplier s ON e.supplier_id = s.id
+			JOIN compound c ON e.compound_id = c.id
+			JOIN quantity q ON e.quantity_id = q.id
+			WHERE e.type = ? AND e.status = ? AND e.deleted_at IS NULL
+		)
+		WHERE 1 = 1`+inRange+`
+		GROUP BY supplier_id, month, compound_id`,
+		append([]any{utils.ENTRY_TYPE_INCOMING, utils.ENTRY_STATUS_APPROVED}, rangeArgs...)...,
+	)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to query deliveries to reconcile", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.REPORT_RETRIEVAL_ERR)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var sId, sName, month, cId, cName, scale string
+		var deliveries, quantity, uncosted int
+		var amount float64
+		if err := rows.Scan(&sId, &sName, &month, &cId, &cName, &scale, &deliveries, &quantity, &amount, &uncosted); err != nil {
+			slog.ErrorContext(r.Context(), "failed to scan delivery row", "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.REPORT_RETRIEVAL_ERR)
+			return
+		}
+		l := line(sId, sName, month, cId, cName, scale)
+		l.Deliveries, l.DeliveredQuantity, l.DeliveredAmount, l.UncostedDeliveries = deliveries, quantity, amount, uncosted
+	}
+	if err := rows.Err(); err != nil {
+		slog.ErrorContext(r.Context(), "failed to read delivery rows", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.REPORT_RETRIEVAL_ERR)
+		return
+	}
+
+	invoiceRows, err := db.ConnFrom(r.Context()).QueryContext(r.Context(), `
+		SELECT supplier_id, supplier_name, month, compound_id, compound_name, scale,
+			GROUP_CONCAT(invoice_no, char(31)), SUM(quantity), SUM(amount)
+		FROM (
+			SELECT
+				i.supplier_id, s.name AS supplier_name, substr(i.date, 1, 7) AS month, i.invoice_no,
+				l.compound_id, c.name AS compound_name, c.scale, l.quantity, l.amount
+			FROM invoice i
+			JOIN invoice_line l ON l.invoice_id = i.id
+			JOIN supplier s ON i.supplier_id = s.id
+			JOIN compound c ON l.compound_id = c.id
+			ORDER BY i.date ASC, i.invoice_no ASC
+		)
+		WHERE 1 = 1`+inRange+`
+		GROUP BY supplier_id, month, compound_id`,
+		rangeArgs...,
+	)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to query invoices to reconcile", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.REPORT_RETRIEVAL_ERR)
+		return
+	}
+	defer invoiceRows.Close()
+	for invoiceRows.Next() {
+		var sId, sName, month, cId, cName, scale, invoiceNos string
+		var quantity int
+		var amount float64
+		if err := invoiceRows.Scan(&sId, &sName, &month, &cId, &cName, &scale, &invoiceNos, &quantity, &amount); err != nil {
+			slog.ErrorContext(r.Context(), "failed to scan invoice row", "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.REPORT_RETRIEVAL_ERR)
+			return
+		}
+		l := line(sId, sName, month, cId, cName, scale)
+		l.InvoicedQuantity, l.InvoicedAmount = quantity, amount
+		for _, no := range strings.Split(invoiceNos, "\x1f") {
+			if len(l.InvoiceNos) == 0 || l.InvoiceNos[len(l.InvoiceNos)-1] != no {
+				l.InvoiceNos = append(l.InvoiceNos, no)
+			}
+		}
+	}
+	if err := invoiceRows.Err(); err != nil {
+		slog.ErrorContext(r.Context(), "failed to read invoice rows", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.REPORT_RETRIEVAL_ERR)
+		return
+	}
+
+	report := []InvoiceReconciliation{}
+	mismatches := 0
+	for _, l := range lines {
+		l.DeliveredAmount = math.Round(l.DeliveredAmount*100) / 100
+		l.InvoicedAmount = math.Round(l.InvoicedAmount*100) / 100
+		l.QuantityDifference = l.InvoicedQuantity - l.DeliveredQuantity
+		l.AmountDifference = math.Round((l.InvoicedAmount-l.DeliveredAmount)*100) / 100
+
+		switch {
+		case len(l.InvoiceNos) == 0:
+			l.Problems = append(l.Problems, RECONCILIATION_NOT_INVOICED)
+		case l.Deliveries == 0:
+			l.Problems = append(l.Problems, RECONCILIATION_NOT_DELIVERED)
+		default:
+			if l.QuantityDifference != 0 {
+				l.Problems = append(l.Problems, RECONCILIATION_QUANTITY)
+			}
+			if l.UncostedDeliveries > 0 {
+				l.Problems = append(l.Problems, RECONCILIATION_UNCOSTED)
+			} else if l.AmountDifference != 0 {
+				l.Problems = append(l.Problems, RECONCILIATION_AMOUNT)
+			}
+		}
+		l.Matched = len(l.Problems) == 0
+
+		if !l.Matched {
+			mismatches++
+		} else if mismatchesOnly {
+			continue
+		}
+		report = append(report, *l)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		a, b := report[i], report[j]
+		if a.SupplierName != b.SupplierName {
+			return strings.ToLower(a.SupplierName) < strings.ToLower(b.SupplierName)
+		}
+		if a.Month != b.Month {
+			return a.Month < b.Month
+		}
+		return strings.ToLower(a.CompoundName) < strings.ToLower(b.CompoundName)
+	})
+
+	if isExportFormat(format) {
+		writeRedactedExport(w, r, format, report, func(report []InvoiceReconciliation) *export.Document {
+			return invoiceReconciliationDocument(r.Context(), report)
+		})
+		return
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"lines":      report,
+		"mismatches": mismatches,
+	})
+}
+
+// Lays out the reconciliation for export, one row per supplier, month and compound with its problems
+func invoiceReconciliationDocument(ctx context.Context, report []InvoiceReconciliation) *export.Document {
+	table := export.Table{
+		Name: "Reconciliation",
+		Columns: []string{"Supplier", "Month", "Compound", "Scale", "Deliveries", "Delivered quantity", "Delivered amount",
+			"Uncosted deliveries", "Invoice nos", "Invoiced quantity", "Invoiced amount", "Quantity difference", "Amount difference", "Problems"},
+	}
+	for _, l := range report {
+		table.AddRow(l.SupplierName, l.Month, l.CompoundName, l.Scale, l.Deliveries, l.DeliveredQuantity, l.DeliveredAmount,
+			l.UncostedDeliveries, strings.Join(l.InvoiceNos, ", "), l.InvoicedQuantity, l.InvoicedAmount, l.QuantityDifference,
+			l.AmountDifference, strings.Join(l.Problems, ", "))
+	}
+
+	return &export.Document{
+		Name:   exportName(ctx, "invoice-reconciliation"),
+		Title:  "Invoice reconciliation",
+		Tables: []export.Table{table},
+	}
+}
@@ -0,0 +1,84 @@
+package handlers_test
+
+import (
+	"chemical-ledger-backend/handlers"
+	"chemical-ledger-backend/testutils"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Deliveries are matched against the invoices per supplier, month and compound
+func TestInvoiceReconciliationFlagsMismatches(t *testing.T) {
+	t.Parallel()
+	env := testutils.NewEnv(t, time.Date(2026, 4, 14, 10, 0, 0, 0, time.Local))
+
+	env.InsertCompound("C_1", "Acetone", "ml")
+	env.InsertCompound("C_2", "Ethanol", "ml")
+	if _, err := env.DB.Exec("INSERT INTO supplier (id, lower_case_name, name) VALUES ('S_1', 'merck', 'Merck')"); err != nil {
+		t.Fatal(err)
+	}
+	deliver := func(compoundId string, date string, units int, unitCost string) {
+		w := httptest.NewRecorder()
+		handlers.InsertEntryHandler(w, env.Request(http.MethodPost, "/insert-entry", strings.NewReader(fmt.Sprintf(
+			`{"type": "incoming", "compound_id": %q, "date": %q, "num_of_units": %d, "quantity_per_unit": 500, "supplier_id": "S_1", "unit_cost": %s}`,
+			compoundId, date, units, unitCost,
+		))))
+		if w.Code != http.StatusOK {
+			t.Fatalf("delivery: status %d, %s", w.Code, w.Body)
+		}
+	}
+	invoice := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handlers.InsertInvoiceHandler(w, env.Request(http.MethodPost, "/insert-invoice", strings.NewReader(body)))
+		return w
+	}
+
+	// March: acetone delivered twice and invoiced once, ethanol invoiced short. April: acetone not invoiced yet.
+	deliver("C_1", "2026-03-02", 2, "50")
+	deliver("C_1", "2026-03-20", 1, "50")
+	deliver("C_2", "2026-03-05", 2, "30")
+	deliver("C_1", "2026-04-02", 1, "50")
+	if w := invoice(`{"supplier_id": "S_1", "invoice_no": "M-1", "date": "2026-03-31", "lines": [
+		{"compound_id": "C_1", "quantity": 1500, "amount": 150}, {"compound_id": "C_2", "quantity": 500, "amount": 30}
+	]}`); w.Code != http.StatusOK {
+		t.Fatalf("invoice: status %d, %s", w.Code, w.Body)
+	}
+	if w := invoice(`{"supplier_id": "S_1", "invoice_no": "M-1", "date": "2026-03-31", "lines": [{"compound_id": "C_1", "quantity": 1, "amount": 1}]}`); w.Code != http.StatusConflict {
+		t.Errorf("duplicate invoice: status %d, %s", w.Code, w.Body)
+	}
+	if w := invoice(`{"supplier_id": "S_1", "invoice_no": "M-2", "date": "2026-03-31", "lines": []}`); w.Code != http.StatusBadRequest {
+		t.Errorf("invoice without lines: status %d, %s", w.Code, w.Body)
+	}
+
+	report := func(params string) string {
+		w := httptest.NewRecorder()
+		handlers.GetInvoiceReconciliationReportHandler(w, env.Request(http.MethodGet, "/report/invoice-reconciliation?"+params, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("report %q: status %d, %s", params, w.Code, w.Body)
+		}
+		return w.Body.String()
+	}
+	body := report("")
+	for _, want := range []string{
+		`"month":"2026-03","compound_id":"C_1","compound_name":"Acetone","scale":"ml","deliveries":2,"delivered_quantity":1500,"delivered_amount":150,"uncosted_deliveries":0,"invoice_nos":["M-1"],"invoiced_quantity":1500,"invoiced_amount":150,"quantity_difference":0,"amount_difference":0,"problems":[],"matched":true`,
+		`"compound_id":"C_2","compound_name":"Ethanol","scale":"ml","deliveries":1,"delivered_quantity":1000,"delivered_amount":60,"uncosted_deliveries":0,"invoice_nos":["M-1"],"invoiced_quantity":500,"invoiced_amount":30,"quantity_difference":-500,"amount_difference":-30,"problems":["quantity","amount"]`,
+		`"month":"2026-04","compound_id":"C_1","compound_name":"Acetone","scale":"ml","deliveries":1,"delivered_quantity":500,"delivered_amount":50,"uncosted_deliveries":0,"invoice_nos":[],"invoiced_quantity":0,"invoiced_amount":0,"quantity_difference":-500,"amount_difference":-50,"problems":["not_invoiced"]`,
+		`"mismatches":2`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("report lacks %s: %s", want, body)
+		}
+	}
+	if body := report("mismatches=true&to_month=2026-03"); strings.Count(body, `"supplier_id"`) != 1 || !strings.Contains(body, `"compound_id":"C_2"`) {
+		t.Errorf("March mismatches: %s", body)
+	}
+	w := httptest.NewRecorder()
+	handlers.GetInvoiceReconciliationReportHandler(w, env.Request(http.MethodGet, "/report/invoice-reconciliation?from_month=2026-3", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("invalid month: status %d, %s", w.Code, w.Body)
+	}
+}
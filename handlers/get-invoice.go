@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+type Invoice struct {
+	Id           string        `json:"id"`
+	SupplierId   string        `json:"supplier_id"`
+	SupplierName string        `json:"supplier_name"`
+	InvoiceNo    string        `json:"invoice_no"`
+	Date         string        `json:"date"`
+	Remark       string        `json:"remark"`
+	CreatedBy    string        `json:"created_by"`
+	CreatedAt    string        `json:"created_at"`
+	Lines        []InvoiceLine `json:"lines"`
+}
+
+type InvoiceLine struct {
+	CompoundId string  `json:"compound_id"`
+	Name       string  `json:"name"`
+	Scale      string  `json:"scale"`
+	Quantity   int     `json:"quantity"`
+	Amount     float64 `json:"amount"`
+}
+
+// Lists the invoices entered, newest first, with their lines, optionally for a "supplier_id" and/or a "month"
+// (YYYY-MM)
+func GetInvoiceHandler(w http.ResponseWriter, r *http.Request) {
+	supplierId, month := httpx.GetParam(r, "supplier_id"), httpx.GetParam(r, "month")
+	if month != "" {
+		if _, err := time.Parse("2006-01", month); err != nil {
+			slog.ErrorContext(r.Context(), "invalid month format", "month", month, "error", err)
+			httpx.RespWithError(w, http.StatusBadRequest, utils.INVALID_MONTH_FORMAT)
+			return
+		}
+	}
+
+	rows, err := db.ConnFrom(r.Context()).QueryContext(r.Context(), `
+		SELECT
+			i.id, i.supplier_id, s.name, i.invoice_no, i.date, i.remark, i.created_by,
+			datetime(i.created_at, 'unixepoch', 'localtime'),
+			l.compound_id, c.name, c.scale, l.quantity, l.amount
+		FROM invoice i
+		JOIN supplier s ON i.supplier_id = s.id
+		JOIN invoice_line l ON l.invoice_id = i.id
+		JOIN compound c ON l.compound_id = c.id
+		WHERE (? = '' OR i.supplier_id = ?) AND (? = '' OR substr(i.date, 1, 7) = ?)
+		ORDER BY i.date DESC, i.created_at DESC, i.id DESC, l.rowid ASC`,
+		supplierId, supplierId, month, month,
+	)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to query invoices", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.INVOICE_RETRIEVAL_ERR)
+		return
+	}
+	defer rows.Close()
+
+	invoices := []*Invoice{}
+	for rows.Next() {
+		var i Invoice
+		var line InvoiceLine
+		if err := rows.Scan(
+			&i.Id, &i.SupplierId, &i.SupplierName, &i.InvoiceNo, &i.Date, &i.Remark, &i.CreatedBy, &i.CreatedAt,
+			&line.CompoundId, &line.Name, &line.Scale, &line.Quantity, &line.Amount,
+		); err != nil {
+			slog.ErrorContext(r.Context(), "failed to scan invoice row", "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.INVOICE_RETRIEVAL_ERR)
+			return
+		}
+		if len(invoices) == 0 || invoices[len(invoices)-1].Id != i.Id {
+			invoices = append(invoices, &i)
+		}
+		last := invoices[len(invoices)-1]
+		last.Lines = append(last.Lines, line)
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"invoices": invoices,
+	})
+}
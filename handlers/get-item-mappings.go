@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"context"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Compound an item code of an inbound source stands for. Quantities of the item are in "unit", the compound's scale
+// when empty, and count items of "quantity_per_unit" each, e.g. 2500 for a 2.5 l bottle in ml, or are the amount
+// itself when it is 0.
+type ItemMapping struct {
+	ItemCode        string `json:"item_code"`
+	CompoundId      string `json:"compound_id"`
+	Unit            string `json:"unit"`
+	QuantityPerUnit int    `json:"quantity_per_unit"`
+	UpdatedBy       string `json:"updated_by"`
+	UpdatedAt       int64  `json:"updated_at"`
+}
+
+// Lists the item mappings of an inbound source by item code
+func GetItemMappingsHandler(w http.ResponseWriter, r *http.Request) {
+	source := chi.URLParam(r, "source")
+
+	mappings, err := getItemMappings(r.Context(), source)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to load item mappings", "source", source, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.ITEM_MAPPING_RETRIEVAL_ERR)
+		return
+	}
+
+	list := make([]ItemMapping, 0, len(mappings))
+	for _, mapping := range mappings {
+		list = append(list, mapping)
+	}
+	slices.SortFunc(list, func(a, b ItemMapping) int { return strings.Compare(a.ItemCode, b.ItemCode) })
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"source":   source,
+		"mappings": list,
+	})
+}
+
+// Gets the item mappings of an inbound source, keyed by item code
+func getItemMappings(ctx context.Context, source string) (map[string]ItemMapping, error) {
+	rows, err := db.ConnFrom(ctx).QueryContext(ctx,
+		"SELECT item_code, compound_id, COALESCE(unit, ''), quantity_per_unit, updated_by, updated_at FROM item_mapping WHERE source = ?",
+		source,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	mappings := map[string]ItemMapping{}
+	for rows.Next() {
+		var m ItemMapping
+		if err := rows.Scan(&m.ItemCode, &m.CompoundId, &m.Unit, &m.QuantityPerUnit, &m.UpdatedBy, &m.UpdatedAt); err != nil {
+			return nil, err
+		}
+		mappings[m.ItemCode] = m
+	}
+	return mappings, rows.Err()
+}
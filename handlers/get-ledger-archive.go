@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"archive/zip"
+	"chemical-ledger-backend/datetime"
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type ledgerArchiveCompound struct {
+	id, name, scale, file       string
+	entries, incoming, outgoing int
+	adjustmentIn, adjustmentOut int
+	disposed, closingStock      int
+}
+
+// Downloads the whole ledger as a zip archive laid out like the physical registers: "summary.csv" with one row per
+// compound, then one CSV per compound listing its approved entries oldest first with the balance after each.
+// The archive is written to the response as the entries are read, so its size does not depend on memory; an error
+// past the summary can only cut the download short, leaving an archive that does not open.
+func GetLedgerArchiveHandler(w http.ResponseWriter, r *http.Request) {
+	compounds, err := getLedgerArchiveCompounds(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to summarize ledger", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.REPORT_RETRIEVAL_ERR)
+		return
+	}
+
+	filename := fmt.Sprintf("ledger-%s.zip", datetime.Now(r.Context()).Format("2006-01-02"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+
+	zw := zip.NewWriter(w)
+	if err := writeLedgerArchive(r.Context(), zw, compounds, currentUser(r).Role); err != nil {
+		slog.ErrorContext(r.Context(), "failed to write ledger archive", "error", err)
+		return
+	}
+	if err := zw.Close(); err != nil {
+		slog.ErrorContext(r.Context(), "failed to finish ledger archive", "error", err)
+	}
+}
+
+// Lists the compounds by name with the totals of their approved entries, naming the file of each
+func getLedgerArchiveCompounds(ctx context.Context) ([]*ledgerArchiveCompound, error) {
+	rows, err := db.ConnFrom(ctx).QueryContext(ctx, `
+		SELECT
+			c.id, c.name, c.scale,
+			COUNT(e.id),
+			COALESCE(SUM(CASE WHEN e.type = ? THEN q.total_quantity END), 0),
+			COALESCE(SUM(CASE WHEN e.type = ? THEN q.total_quantity END), 0),
+			COALESCE(SUM(CASE WHEN e.type = ? THEN q.total_quantity END), 0),
+			COALESCE(SUM(CASE WHEN e.type = ? THEN q.total_quantity END), 0),
+			COALESCE(SUM(CASE WHEN e.type = ? THEN q.total_quantity END), 0),
+			COALESCE((SELECT balance FROM stock_current WHERE compound_id = c.id), 0)
+		FROM compound c
+		LEFT JOIN entry e ON e.compound_id = c.id AND e.status = ? AND e.deleted_at IS NULL
+		LEFT JOIN quantity q ON e.quantity_id = q.id
+		GROUP BY c.id
+		ORDER BY c.lower_case_name ASC`,
+		utils.ENTRY_TYPE_INCOMING, utils.ENTRY_TYPE_OUTGOING, utils.ENTRY_TYPE_ADJUSTMENT_IN, utils.ENTRY_TYPE_ADJUSTMENT_OUT,
+		utils.ENTRY_TYPE_DISPOSAL, utils.ENTRY_STATUS_APPROVED,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	compounds := []*ledgerArchiveCompound{}
+	files := map[string]bool{"summary.csv": true}
+	for rows.Next() {
+		c := &ledgerArchiveCompound{}
+		if err := rows.Scan(
+			&c.id, &c.name, &c.scale, &c.entries,
+			&c.incoming, &c.outgoing, &c.adjustmentIn, &c.adjustmentOut, &c.disposed, &c.closingStock,
+		); err != nil {
+			return nil, err
+		}
+		c.file = ledgerArchiveFileName(c.name, files)
+		compounds = append(compounds, c)
+	}
+	return compounds, rows.Err()
+}
+
+// Name of the CSV of a compound within the archive. Characters file systems reject are replaced, and names
+// that end up alike once replaced are numbered, e.g. "HCl_HNO3.csv" and "HCl_HNO3 (2).csv".
+func ledgerArchiveFileName(name string, taken map[string]bool) string {
+	base := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) || r < ' ' {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(name))
+	if base == "" {
+		base = "_"
+	}
+
+	file := base + ".csv"
+	for i := 2; taken[strings.ToLower(file)]; i++ {
+		file = fmt.Sprintf("%s (%d).csv", base, i)
+	}
+	taken[strings.ToLower(file)] = true
+	return file
+}
+
+func writeLedgerArchive(ctx context.Context, zw *zip.Writer, compounds []*ledgerArchiveCompound, role string) error {
+	f, err := createLedgerArchiveFile(ctx, zw, "summary.csv")
+	if err != nil {
+		return err
+	}
+	summary := csv.NewWriter(f)
+	summary.Write([]string{"Compound", "Scale", "File", "Entries", "Incoming", "Outgoing", "Adjustments in", "Adjustments out", "Disposed", "Closing stock"})
+	for _, c := range compounds {
+		summary.Write([]string{
+			c.name, c.scale, c.file, strconv.Itoa(c.entries),
+			strconv.Itoa(c.incoming), strconv.Itoa(c.outgoing), strconv.Itoa(c.adjustmentIn), strconv.Itoa(c.adjustmentOut),
+			strconv.Itoa(c.disposed), strconv.Itoa(c.closingStock),
+		})
+	}
+	summary.Flush()
+	if err := summary.Error(); err != nil {
+		return err
+	}
+
+	for _, c := range compounds {
+		f, err := createLedgerArchiveFile(ctx, zw, c.file)
+		if err != nil {
+			return err
+		}
+		if err := writeLedgerArchiveCompound(ctx, csv.NewWriter(f), c, role); err != nil {
+			return fmt.Errorf("compound %s: %w", c.id, err)
+		}
+	}
+	return nil
+}
+
+// Adds a compressed file dated now to the archive, zip.Writer.Create leaves files undated
+func createLedgerArchiveFile(ctx context.Context, zw *zip.Writer, name string) (io.Writer, error) {
+	return zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: datetime.Now(ctx)})
+}
+
+// Writes the ledger of a compound row by row as it is read, redacting each line for the role
+func writeLedgerArchiveCompound(ctx context.Context, cw *csv.Writer, c *ledgerArchiveCompound, role string) error {
+	rows, err := db.ConnFrom(ctx).QueryContext(ctx, `
+		SELECT `+statementLineColumns+`
+		FROM entry e
+		JOIN quantity q ON e.quantity_id = q.id
+		LEFT JOIN supplier s ON e.supplier_id = s.id
+		LEFT JOIN recipient rc ON e.recipient_id = rc.id
+		WHERE e.compound_id = ? AND e.status = ? AND e.deleted_at IS NULL
+		ORDER BY e.date ASC, e.seq ASC`,
+		c.id, utils.ENTRY_STATUS_APPROVED,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	cw.Write([]string{
+		"Date", "Entry ID", "Type", "Voucher no", "Supplier / recipient", "Remark", "Adjustment reason",
+		"Incoming (" + c.scale + ")", "Outgoing (" + c.scale + ")", "Balance (" + c.scale + ")",
+	})
+	for rows.Next() {
+		line, _, err := scanStatementLine(rows)
+		if err != nil {
+			return err
+		}
+		if line, err = utils.RedactForRole(role, line); err != nil {
+			return err
+		}
+		cw.Write([]string{
+			line.Date, line.EntryId, line.Type, line.VoucherNo, line.Party, line.Remark, line.Reason,
+			strconv.Itoa(line.Incoming), strconv.Itoa(line.Outgoing), strconv.Itoa(line.Balance),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"log/slog"
+	"net/http"
+)
+
+func GetLocationHandler(w http.ResponseWriter, r *http.Request) {
+	rows, err := db.ConnFrom(r.Context()).QueryContext(r.Context(), `
+		SELECT id, name, description
+		FROM location
+		ORDER BY lower_case_name ASC
+	`)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to query locations", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.LOCATION_RETRIEVAL_ERR)
+		return
+	}
+	defer rows.Close()
+
+	type Location struct {
+		ID          string `json:"key"`
+		Name        string `json:"name"`
+		Description string `json:"description"`
+	}
+
+	locations := []Location{}
+	for rows.Next() {
+		var location Location
+		if err := rows.Scan(&location.ID, &location.Name, &location.Description); err != nil {
+			slog.ErrorContext(r.Context(), "failed to scan location row", "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.LOCATION_RETRIEVAL_ERR)
+			return
+		}
+		locations = append(locations, location)
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"locations": locations,
+	})
+}
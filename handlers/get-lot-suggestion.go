@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/datetime"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+type GetLotSuggestionReq struct {
+	CompoundId string `json:"compound_id"`
+	Quantity   int    `json:"quantity"`
+}
+
+// Lot to draw from and how much, as suggested for an outgoing entry
+type LotSuggestion struct {
+	LotId          string `json:"lot_id"`
+	LotNo          string `json:"lot_no"`
+	Expiry         string `json:"expiry"`
+	Quantity       int    `json:"quantity"`
+	FromOpenUnit   int    `json:"from_open_unit"`
+	UnitsToOpen    int    `json:"units_to_open"`
+	RemainingStock int    `json:"remaining_stock"`
+}
+
+// Suggests the lots to issue the given quantity from, first expiry first out (FEFO). Within a lot the open unit
+// is used up before new units are opened, and between lots expiring on the same day the one with an open unit
+// goes first, so as few units as possible are left open. Expired lots are never suggested.
+func GetLotSuggestionHandler(w http.ResponseWriter, r *http.Request) {
+	reqBody := &GetLotSuggestionReq{
+		CompoundId: httpx.GetParam(r, "compound_id"),
+	}
+
+	quantity, err := httpx.GetIntParam(r, "quantity")
+	if err != nil || quantity <= 0 || reqBody.CompoundId == "" {
+		slog.ErrorContext(r.Context(), "missing or invalid fields", "compound_id", reqBody.CompoundId, "quantity", httpx.GetParam(r, "quantity"), "error", err)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.MISSING_REQUIRED_FIELDS)
+		return
+	}
+	reqBody.Quantity = quantity
+
+	compoundExists, err := utils.CheckIfCompoundExists(r.Context(), reqBody.CompoundId)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error checking if compound exists", "compound_id", reqBody.CompoundId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.COMPOUND_ID_CHECK_ERR)
+		return
+	}
+	if !compoundExists {
+		slog.ErrorContext(r.Context(), "compound not found", "compound_id", reqBody.CompoundId)
+		httpx.RespWithError(w, http.StatusNotFound, utils.INVALID_COMPOUND_ID)
+		return
+	}
+
+	lots, err := getCompoundLots(r.Context(), reqBody.CompoundId)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get lots", "compound_id", reqBody.CompoundId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.LOT_RETRIEVAL_ERR)
+		return
+	}
+
+	today := datetime.Now(r.Context()).Format("2006-01-02")
+	usable := []Lot{}
+	for _, lot := range lots {
+		if lot.RemainingStock > 0 && (lot.Expiry == "" || lot.Expiry >= today) {
+			usable = append(usable, lot)
+		}
+	}
+
+	// Lots without an expiry go last, lots were already listed in the order they were received
+	slices.SortStableFunc(usable, func(a, b Lot) int {
+		if a.Expiry != b.Expiry {
+			if a.Expiry == "" {
+				return 1
+			}
+			if b.Expiry == "" {
+				return -1
+			}
+			return strings.Compare(a.Expiry, b.Expiry)
+		}
+		if (a.OpenUnitBalance > 0) != (b.OpenUnitBalance > 0) {
+			if a.OpenUnitBalance > 0 {
+				return -1
+			}
+			return 1
+		}
+		return 0
+	})
+
+	suggestions := []LotSuggestion{}
+	need := reqBody.Quantity
+	for _, lot := range usable {
+		if need == 0 {
+			break
+		}
+
+		take := min(lot.RemainingStock, need)
+		suggestion := LotSuggestion{
+			LotId:          lot.Id,
+			LotNo:          lot.LotNo,
+			Expiry:         lot.Expiry,
+			Quantity:       take,
+			FromOpenUnit:   min(lot.OpenUnitBalance, take),
+			RemainingStock: lot.RemainingStock - take,
+		}
+		if fromSealed := take - suggestion.FromOpenUnit; fromSealed > 0 && lot.UnitSize > 0 {
+			suggestion.UnitsToOpen = (fromSealed + lot.UnitSize - 1) / lot.UnitSize
+		}
+
+		suggestions = append(suggestions, suggestion)
+		need -= take
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"suggestions": suggestions,
+		"shortfall":   need,
+	})
+}
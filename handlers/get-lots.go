@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/export"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+type GetLotsReq struct {
+	CompoundId string `json:"compound_id"`
+	Format     string `json:"format"`
+}
+
+// Lot linked to an entry. For incoming entries the quantity is the stock left in the lot it created,
+// for outgoing entries it is the quantity drawn from that lot.
+type EntryLot struct {
+	LotId    string `json:"lot_id"`
+	LotNo    string `json:"lot_no"`
+	Expiry   string `json:"expiry"`
+	Supplier string `json:"supplier"`
+	Quantity int    `json:"quantity"`
+}
+
+// Lot created by an incoming entry. Its units are consumed one at a time, so at most one of them is open
+// and the remaining stock splits into sealed units and what is left in the open one.
+type Lot struct {
+	Id              string `json:"id"`
+	LotNo           string `json:"lot_no"`
+	Expiry          string `json:"expiry"`
+	Supplier        string `json:"supplier"`
+	EntryId         string `json:"entry_id"`
+	ReceivedOn      string `json:"received_on"`
+	Quantity        int    `json:"quantity"`
+	RemainingStock  int    `json:"remaining_stock"`
+	UnitSize        int    `json:"unit_size"`
+	SealedUnits     int    `json:"sealed_units"`
+	OpenUnitBalance int    `json:"open_unit_balance"`
+}
+
+// Lists the lots of a compound with their remaining stock, along with the compound's sealed units and
+// the stock left in opened units. Export formats list the lots alone, e.g. for a recall.
+func GetLotsHandler(w http.ResponseWriter, r *http.Request) {
+	reqBody := &GetLotsReq{
+		CompoundId: httpx.GetParam(r, "compound_id"),
+		Format:     httpx.GetParam(r, "format"),
+	}
+	if errStr := validateExportFormat(r.Context(), reqBody.Format); errStr != utils.NO_ERR {
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	if reqBody.CompoundId == "" {
+		slog.ErrorContext(r.Context(), "missing required fields", "compound_id", reqBody.CompoundId)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.MISSING_REQUIRED_FIELDS)
+		return
+	}
+
+	compoundExists, err := utils.CheckIfCompoundExists(r.Context(), reqBody.CompoundId)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error checking if compound exists", "compound_id", reqBody.CompoundId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.COMPOUND_ID_CHECK_ERR)
+		return
+	}
+	if !compoundExists {
+		slog.ErrorContext(r.Context(), "compound not found", "compound_id", reqBody.CompoundId)
+		httpx.RespWithError(w, http.StatusNotFound, utils.INVALID_COMPOUND_ID)
+		return
+	}
+
+	lots, err := getCompoundLots(r.Context(), reqBody.CompoundId)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get lots", "compound_id", reqBody.CompoundId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.LOT_RETRIEVAL_ERR)
+		return
+	}
+
+	sealedUnits, openUnits, openBalance := 0, 0, 0
+	for _, lot := range lots {
+		sealedUnits += lot.SealedUnits
+		if lot.OpenUnitBalance > 0 {
+			openUnits++
+			openBalance += lot.OpenUnitBalance
+		}
+	}
+
+	if isExportFormat(reqBody.Format) {
+		writeRedactedExport(w, r, reqBody.Format, lots, func(lots []Lot) *export.Document {
+			table := export.Table{
+				Name:    "Lots",
+				Columns: []string{"Lot no", "Expiry", "Supplier", "Entry", "Received on", "Quantity", "Remaining stock", "Unit size", "Sealed units", "Open unit balance"},
+			}
+			for _, l := range lots {
+				table.AddRow(l.LotNo, l.Expiry, l.Supplier, l.EntryId, l.ReceivedOn, l.Quantity, l.RemainingStock, l.UnitSize, l.SealedUnits, l.OpenUnitBalance)
+			}
+			return &export.Document{
+				Name:   exportName(r.Context(), "lots-"+reqBody.CompoundId),
+				Title:  "Lots of " + reqBody.CompoundId,
+				Tables: []export.Table{table},
+			}
+		})
+		return
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"lots":              lots,
+		"sealed_units":      sealedUnits,
+		"open_units":        openUnits,
+		"open_unit_balance": openBalance,
+	})
+}
+
+// Gets the lots of a compound in the order they were received, lots of entries not approved yet hold no stock
+func getCompoundLots(ctx context.Context, compoundId string) ([]Lot, error) {
+	rows, err := db.ConnFrom(ctx).QueryContext(ctx, `
+		SELECT
+			l.id, l.lot_no, l.expiry, l.supplier, e.id,
+			datetime(e.date, 'unixepoch', 'localtime'),
+			q.total_quantity,
+			q.total_quantity - COALESCE((
+				SELECT SUM(lc.quantity) FROM lot_consumption lc WHERE lc.lot_id = l.id
+			), 0),
+			q.quantity_per_unit
+		FROM lot l
+		JOIN entry e ON l.entry_id = e.id
+		JOIN quantity q ON e.quantity_id = q.id
+		WHERE l.compound_id = ? AND e.status = ? AND e.deleted_at IS NULL
+		ORDER BY e.date ASC, e.seq ASC`, compoundId, utils.ENTRY_STATUS_APPROVED)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lots := []Lot{}
+	for rows.Next() {
+		var lot Lot
+		if err := rows.Scan(&lot.Id, &lot.LotNo, &lot.Expiry, &lot.Supplier, &lot.EntryId, &lot.ReceivedOn, &lot.Quantity, &lot.RemainingStock, &lot.UnitSize); err != nil {
+			return nil, err
+		}
+		if lot.UnitSize > 0 {
+			lot.SealedUnits = lot.RemainingStock / lot.UnitSize
+			lot.OpenUnitBalance = lot.RemainingStock % lot.UnitSize
+		}
+		lots = append(lots, lot)
+	}
+	return lots, rows.Err()
+}
+
+// Gets the lots linked to each of the given entries, keyed by entry ID
+func getEntryLots(ctx context.Context, entryIds []string) (map[string][]EntryLot, error) {
+	entryLots := map[string][]EntryLot{}
+	if len(entryIds) == 0 {
+		return entryLots, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(entryIds)), ", ")
+	args := make([]any, 0, 2*len(entryIds))
+	for _, id := range entryIds {
+		args = append(args, id)
+	}
+	args = append(args, args...)
+
+	rows, err := db.ConnFrom(ctx).QueryContext(ctx, `
+		SELECT
+			l.entry_id, l.id, l.lot_no, l.expiry, l.supplier,
+			q.total_quantity - COALESCE((
+				SELECT SUM(lc.quantity) FROM lot_consumption lc WHERE lc.lot_id = l.id
+			), 0)
+		FROM lot l
+		JOIN entry e ON l.entry_id = e.id
+		JOIN quantity q ON e.quantity_id = q.id
+		WHERE l.entry_id IN (`+placeholders+`)
+		UNION ALL
+		SELECT lc.entry_id, l.id, l.lot_no, l.expiry, l.supplier, lc.quantity
+		FROM lot_consumption lc
+		JOIN lot l ON lc.lot_id = l.id
+		WHERE lc.entry_id IN (`+placeholders+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entryId string
+		var lot EntryLot
+		if err := rows.Scan(&entryId, &lot.LotId, &lot.LotNo, &lot.Expiry, &lot.Supplier, &lot.Quantity); err != nil {
+			return nil, err
+		}
+		entryLots[entryId] = append(entryLots[entryId], lot)
+	}
+
+	return entryLots, rows.Err()
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Interval of the comments keeping an idle event stream open through proxies
+const OPERATION_KEEPALIVE = 15 * time.Second
+
+// How long a long poll waits for the operation to change before answering with the state unchanged
+const OPERATION_POLL_TIMEOUT = 25 * time.Second
+
+// Streams the progress of a long-running operation as server-sent events ("text/event-stream"), each a "progress"
+// event holding a utils.ProgressEvent as JSON, until the operation is done or the client goes away. The operation
+// is the one started with the same "progress_id"; subscribing first is fine, the stream then waits for it to start.
+// Admins only.
+func GetOperationEventsHandler(w http.ResponseWriter, r *http.Request) {
+	op := utils.TrackOperation(r.Context(), chi.URLParam(r, "id"), "")
+	events, unsubscribe := op.Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+
+	keepalive := time.NewTicker(OPERATION_KEEPALIVE)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "failed to encode progress event", "operation_id", event.OperationId, "error", err)
+				return
+			}
+			fmt.Fprintf(w, "event: progress\ndata: %s\n\n", data)
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+		case <-r.Context().Done():
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			slog.ErrorContext(r.Context(), "failed to flush progress event", "error", err)
+			return
+		}
+	}
+}
+
+// Long-polling variant of GetOperationEventsHandler for networks whose proxies hold back event streams. Answers
+// with the state of the operation as soon as it is newer than the "cursor" (the "seq" of the last state the client
+// saw, 0 or none at first), or unchanged after OPERATION_POLL_TIMEOUT; either way the client polls again with the
+// "seq" answered until the state is "done". Admins only.
+func GetOperationPollHandler(w http.ResponseWriter, r *http.Request) {
+	cursor, err := httpx.GetIntParam(r, "cursor")
+	if err != nil || cursor < 0 {
+		slog.ErrorContext(r.Context(), "invalid operation cursor", "cursor", httpx.GetParam(r, "cursor"), "error", err)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.INVALID_CURSOR)
+		return
+	}
+
+	op := utils.TrackOperation(r.Context(), chi.URLParam(r, "id"), "")
+	events, unsubscribe := op.Subscribe()
+	defer unsubscribe()
+
+	timeout := time.NewTimer(OPERATION_POLL_TIMEOUT)
+	defer timeout.Stop()
+
+	// The first state is the current one, a finished operation is answered straight away
+	event := <-events
+	for event.Seq <= cursor && !event.Done {
+		select {
+		case next, ok := <-events:
+			if !ok {
+				httpx.RespWithData(w, http.StatusOK, event)
+				return
+			}
+			event = next
+		case <-timeout.C:
+			httpx.RespWithData(w, http.StatusOK, event)
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+	httpx.RespWithData(w, http.StatusOK, event)
+}
+
+// Tracks the operation a request runs under the given ID (see utils.TrackOperation), returning the writer for the
+// handler to answer through and a function to call once it has answered. The operation then finishes, failed
+// when the answer was an error.
+func trackRequestOperation(w http.ResponseWriter, r *http.Request, id string, kind string) (http.ResponseWriter, *utils.Operation, func()) {
+	op := utils.TrackOperation(r.Context(), id, kind)
+	if op == nil {
+		return w, nil, func() {}
+	}
+
+	ow := &operationWriter{ResponseWriter: w, status: http.StatusOK}
+	return ow, op, func() {
+		if ow.status >= http.StatusBadRequest {
+			op.Finish(utils.OPERATION_FAILED)
+			return
+		}
+		op.Finish(utils.NO_ERR)
+	}
+}
+
+// Notes the status of the answer to a request running a tracked operation
+type operationWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (ow *operationWriter) WriteHeader(status int) {
+	ow.status = status
+	ow.ResponseWriter.WriteHeader(status)
+}
+
+func (ow *operationWriter) Unwrap() http.ResponseWriter {
+	return ow.ResponseWriter
+}
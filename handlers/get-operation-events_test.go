@@ -0,0 +1,48 @@
+package handlers_test
+
+import (
+	"chemical-ledger-backend/handlers"
+	"chemical-ledger-backend/utils"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestOperationPollWaitsForNewerState(t *testing.T) {
+	op := utils.TrackOperation(context.Background(), "OP_poll", utils.OPERATION_RECALCULATE_ALL)
+	op.Step(1, 4, "C_1")
+
+	router := chi.NewRouter()
+	router.Get("/admin/operations/{id}/poll", handlers.GetOperationPollHandler)
+	poll := func(cursor string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/operations/OP_poll/poll?cursor="+cursor, nil))
+		return w
+	}
+
+	if w := poll("0"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"seq":1,"kind":"recalculate","percent":25`) {
+		t.Fatalf("first poll: status %d, %s", w.Code, w.Body)
+	}
+
+	// Polling with the state already seen waits for the next one
+	answered := make(chan *httptest.ResponseRecorder)
+	go func() { answered <- poll("1") }()
+	select {
+	case w := <-answered:
+		t.Fatalf("poll answered before the operation changed: %s", w.Body)
+	case <-time.After(50 * time.Millisecond):
+	}
+	op.Finish(utils.NO_ERR)
+	if w := <-answered; !strings.Contains(w.Body.String(), `"seq":2,"kind":"recalculate","percent":100`) || !strings.Contains(w.Body.String(), `"done":true`) {
+		t.Errorf("poll after finishing: %s", w.Body)
+	}
+
+	if w := poll("x"); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid cursor: status %d", w.Code)
+	}
+}
@@ -0,0 +1,63 @@
+package handlers_test
+
+import (
+	"chemical-ledger-backend/handlers"
+	"chemical-ledger-backend/testutils"
+	"chemical-ledger-backend/utils"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Issues tagged with a project are totalled per project, and only issues can be tagged
+func TestProjectConsumptionReport(t *testing.T) {
+	t.Parallel()
+	env := testutils.NewEnv(t, time.Date(2026, 3, 14, 10, 0, 0, 0, time.Local))
+
+	env.InsertCompound("C_1", "Acetone", "ml")
+	w := httptest.NewRecorder()
+	handlers.InsertProjectHandler(w, env.Request(http.MethodPost, "/insert-project", strings.NewReader(`{"name": "Enzyme kinetics", "code": "DST-42"}`)))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"project_id":"PJ_1"`) {
+		t.Fatalf("project: status %d, %s", w.Code, w.Body)
+	}
+	projectId := "PJ_1"
+
+	post := func(entryType string, quantity int) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handlers.InsertEntryHandler(w, env.Request(http.MethodPost, "/insert-entry", strings.NewReader(fmt.Sprintf(
+			`{"type": %q, "compound_id": "C_1", "date": "2026-03-10", "num_of_units": 1, "quantity_per_unit": %d, "project_id": %q}`,
+			entryType, quantity, projectId,
+		))))
+		return w
+	}
+	if w := insertEntry(env, utils.ENTRY_TYPE_INCOMING, "C_1", "2026-03-02", 1000); w.Code != http.StatusOK {
+		t.Fatalf("delivery: status %d, %s", w.Code, w.Body)
+	}
+	if w := post(utils.ENTRY_TYPE_INCOMING, 100); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), utils.PROJECT_ON_INCOMING) {
+		t.Errorf("project on a delivery: status %d, %s", w.Code, w.Body)
+	}
+	for _, quantity := range []int{150, 50} {
+		if w := post(utils.ENTRY_TYPE_OUTGOING, quantity); w.Code != http.StatusOK {
+			t.Fatalf("issue: status %d, %s", w.Code, w.Body)
+		}
+	}
+	if w := insertEntry(env, utils.ENTRY_TYPE_OUTGOING, "C_1", "2026-03-11", 300); w.Code != http.StatusOK {
+		t.Fatalf("untagged issue: status %d, %s", w.Code, w.Body)
+	}
+
+	w = httptest.NewRecorder()
+	handlers.GetProjectReportHandler(w, env.Request(http.MethodGet, "/report/project-consumption", nil))
+	want := `"project_name":"Enzyme kinetics","project_code":"DST-42","compound_id":"C_1","compound_name":"Acetone","scale":"ml","entries":2,"total_quantity":200`
+	if w.Code != http.StatusOK || strings.Count(w.Body.String(), `"project_id"`) != 1 || !strings.Contains(w.Body.String(), want) {
+		t.Errorf("report: status %d, %s", w.Code, w.Body)
+	}
+
+	w = httptest.NewRecorder()
+	handlers.DeleteProjectHandler(w, env.Request(http.MethodDelete, "/delete-project?id="+projectId, nil))
+	if w.Code != http.StatusNotAcceptable {
+		t.Errorf("deleting a project in use: status %d, %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"log/slog"
+	"net/http"
+)
+
+func GetProjectHandler(w http.ResponseWriter, r *http.Request) {
+	rows, err := db.ConnFrom(r.Context()).QueryContext(r.Context(), `
+		SELECT id, name, code, lead
+		FROM project
+		ORDER BY lower_case_name ASC
+	`)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to query projects", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.PROJECT_RETRIEVAL_ERR)
+		return
+	}
+	defer rows.Close()
+
+	type Project struct {
+		ID   string `json:"key"`
+		Name string `json:"name"`
+		Code string `json:"code"`
+		Lead string `json:"lead"`
+	}
+
+	projects := []Project{}
+	for rows.Next() {
+		var project Project
+		if err := rows.Scan(&project.ID, &project.Name, &project.Code, &project.Lead); err != nil {
+			slog.ErrorContext(r.Context(), "failed to scan project row", "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.PROJECT_RETRIEVAL_ERR)
+			return
+		}
+		projects = append(projects, project)
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"projects": projects,
+	})
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"context"
+	"database/sql"
+	"log/slog"
+	"net/http"
+)
+
+type PurchaseOrder struct {
+	Id           string `json:"id"`
+	SupplierId   string `json:"supplier_id"`
+	SupplierName string `json:"supplier_name"`
+	OrderNo      string `json:"order_no"`
+	Date         string `json:"date"`
+	ExpectedDate string `json:"expected_date"`
+	Remark       string `json:"remark"`
+	Status       string `json:"status"`
+	CreatedBy    string `json:"created_by"`
+	CreatedAt    string `json:"created_at"`
+}
+
+// Quantity of a compound ordered against what the approved deliveries naming the line brought in
+type PurchaseOrderLine struct {
+	Id               string `json:"id"`
+	CompoundId       string `json:"compound_id"`
+	Name             string `json:"name"`
+	Scale            string `json:"scale"`
+	Quantity         int    `json:"quantity"`
+	ReceivedQuantity int    `json:"received_quantity"`
+	Outstanding      int    `json:"outstanding"`
+}
+
+type PurchaseOrderDetail struct {
+	PurchaseOrder
+	Lines []PurchaseOrderLine `json:"lines"`
+}
+
+// Lists the purchase orders, newest first, optionally with a "status" or for a "supplier_id". With "id" it gets that
+// order with its lines instead.
+func GetPurchaseOrderHandler(w http.ResponseWriter, r *http.Request) {
+	if purchaseOrderId := httpx.GetParam(r, "id"); purchaseOrderId != "" {
+		order, errStr := getPurchaseOrder(r.Context(), purchaseOrderId)
+		if errStr == utils.INVALID_PURCHASE_ORDER_ID {
+			httpx.RespWithError(w, http.StatusNotFound, errStr)
+			return
+		}
+		if errStr != utils.NO_ERR {
+			httpx.RespWithError(w, http.StatusInternalServerError, errStr)
+			return
+		}
+		httpx.RespWithData(w, http.StatusOK, order)
+		return
+	}
+
+	status, supplierId := httpx.GetParam(r, "status"), httpx.GetParam(r, "supplier_id")
+	switch status {
+	case "", utils.PO_STATUS_OPEN, utils.PO_STATUS_PARTIALLY_RECEIVED, utils.PO_STATUS_RECEIVED, utils.PO_STATUS_CANCELLED:
+	default:
+		slog.ErrorContext(r.Context(), "invalid purchase order status", "status", status)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.INVALID_PURCHASE_ORDER_STATUS)
+		return
+	}
+
+	rows, err := db.ConnFrom(r.Context()).QueryContext(r.Context(), `
+		SELECT
+			o.id, o.supplier_id, s.name, o.order_no, o.date, o.expected_date, o.remark, o.status, o.created_by,
+			datetime(o.created_at, 'unixepoch', 'localtime')
+		FROM purchase_order o
+		JOIN supplier s ON o.supplier_id = s.id
+		WHERE (? = '' OR o.status = ?) AND (? = '' OR o.supplier_id = ?)
+		ORDER BY o.date DESC, o.created_at DESC, o.id DESC`,
+		status, status, supplierId, supplierId,
+	)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to query purchase orders", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.PURCHASE_ORDER_RETRIEVAL_ERR)
+		return
+	}
+	defer rows.Close()
+
+	orders := []PurchaseOrder{}
+	for rows.Next() {
+		var o PurchaseOrder
+		if err := rows.Scan(&o.Id, &o.SupplierId, &o.SupplierName, &o.OrderNo, &o.Date, &o.ExpectedDate, &o.Remark, &o.Status, &o.CreatedBy, &o.CreatedAt); err != nil {
+			slog.ErrorContext(r.Context(), "failed to scan purchase order row", "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.PURCHASE_ORDER_RETRIEVAL_ERR)
+			return
+		}
+		orders = append(orders, o)
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"purchase_orders": orders,
+	})
+}
+
+// Gets a purchase order with its lines, in the order they were placed
+func getPurchaseOrder(ctx context.Context, purchaseOrderId string) (*PurchaseOrderDetail, utils.ErrorMessage) {
+	order := &PurchaseOrderDetail{Lines: []PurchaseOrderLine{}}
+	err := db.ConnFrom(ctx).QueryRowContext(ctx, `
+		SELECT
+			o.id, o.supplier_id, s.name, o.order_no, o.date, o.expected_date, o.remark, o.status, o.created_by,
+			datetime(o.created_at, 'unixepoch', 'localtime')
+		FROM purchase_order o
+		JOIN supplier s ON o.supplier_id = s.id
+		WHERE o.id = ?`,
+		purchaseOrderId,
+	).Scan(&order.Id, &order.SupplierId, &order.SupplierName, &order.OrderNo, &order.Date, &order.ExpectedDate, &order.Remark, &order.Status, &order.CreatedBy, &order.CreatedAt)
+	if err == sql.ErrNoRows {
+		slog.ErrorContext(ctx, "purchase order not found", "purchase_order_id", purchaseOrderId)
+		return nil, utils.INVALID_PURCHASE_ORDER_ID
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to query purchase order", "purchase_order_id", purchaseOrderId, "error", err)
+		return nil, utils.PURCHASE_ORDER_RETRIEVAL_ERR
+	}
+
+	rows, err := db.ConnFrom(ctx).QueryContext(ctx, `
+		SELECT l.id, l.compound_id, c.name, c.scale, l.quantity, l.received_quantity
+		FROM purchase_order_line l
+		JOIN compound c ON l.compound_id = c.id
+		WHERE l.purchase_order_id = ?
+		ORDER BY l.rowid ASC`,
+		purchaseOrderId,
+	)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to query purchase order lines", "purchase_order_id", purchaseOrderId, "error", err)
+		return nil, utils.PURCHASE_ORDER_RETRIEVAL_ERR
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var line PurchaseOrderLine
+		if err := rows.Scan(&line.Id, &line.CompoundId, &line.Name, &line.Scale, &line.Quantity, &line.ReceivedQuantity); err != nil {
+			slog.ErrorContext(ctx, "failed to scan purchase order line", "purchase_order_id", purchaseOrderId, "error", err)
+			return nil, utils.PURCHASE_ORDER_RETRIEVAL_ERR
+		}
+		line.Outstanding = max(line.Quantity-line.ReceivedQuantity, 0)
+		order.Lines = append(order.Lines, line)
+	}
+	if err := rows.Err(); err != nil {
+		slog.ErrorContext(ctx, "failed to read purchase order lines", "purchase_order_id", purchaseOrderId, "error", err)
+		return nil, utils.PURCHASE_ORDER_RETRIEVAL_ERR
+	}
+
+	return order, utils.NO_ERR
+}
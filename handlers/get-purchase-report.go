@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/export"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"log/slog"
+	"net/http"
+)
+
+type GetPurchaseReportReq struct {
+	SupplierId string `json:"supplier_id"`
+	LocationId string `json:"location_id"`
+	FromDate   string `json:"from_date"`
+	ToDate     string `json:"to_date"`
+	Format     string `json:"format"`
+}
+
+// Summarises the incoming entries per supplier and compound, optionally for one supplier, the deliveries to one
+// location and/or a date range, as JSON or as a file in an export "format"
+func GetPurchaseReportHandler(w http.ResponseWriter, r *http.Request) {
+	reqBody := &GetPurchaseReportReq{
+		SupplierId: httpx.GetParam(r, "supplier_id"),
+		LocationId: httpx.GetParam(r, "location_id"),
+		FromDate:   httpx.GetParam(r, "from_date"),
+		ToDate:     httpx.GetParam(r, "to_date"),
+		Format:     httpx.GetParam(r, "format"),
+	}
+
+	if errStr := validateExportFormat(r.Context(), reqBody.Format); errStr != utils.NO_ERR {
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	query := `
+		SELECT
+			s.id, s.name, c.id, c.name, c.scale,
+			COUNT(e.id), SUM(q.total_quantity),
+			datetime(MAX(e.date), 'unixepoch', 'localtime')
+		FROM entry e
+		JOIN supplier s ON e.supplier_id = s.id
+		JOIN compound c ON e.compound_id = c.id
+		JOIN quantity q ON e.quantity_id = q.id
+		WHERE e.type = ? AND e.status = ? AND e.deleted_at IS NULL`
+	args := []any{utils.ENTRY_TYPE_INCOMING, utils.ENTRY_STATUS_APPROVED}
+
+	if reqBody.SupplierId != "" {
+		if errStr := validateSupplierIdField(r.Context(), reqBody.SupplierId); errStr != utils.NO_ERR {
+			httpx.RespWithError(w, http.StatusBadRequest, errStr)
+			return
+		}
+		query += " AND e.supplier_id = ?"
+		args = append(args, reqBody.SupplierId)
+	}
+
+	if reqBody.LocationId != "" {
+		if errStr := validateLocationIdField(r.Context(), reqBody.LocationId); errStr != utils.NO_ERR {
+			httpx.RespWithError(w, http.StatusBadRequest, errStr)
+			return
+		}
+		query += " AND e.location_id = ?"
+		args = append(args, reqBody.LocationId)
+	}
+
+	fromUnix, toUnix, errStr := parseReportRange(r.Context(), reqBody.FromDate, reqBody.ToDate)
+	if errStr != utils.NO_ERR {
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+	query += " AND e.date >= ? AND e.date < ?"
+	args = append(args, fromUnix, toUnix)
+
+	query += " GROUP BY s.id, c.id ORDER BY s.lower_case_name ASC, c.lower_case_name ASC"
+
+	rows, err := db.ConnFrom(r.Context()).QueryContext(r.Context(), query, args...)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to query purchase report", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.REPORT_RETRIEVAL_ERR)
+		return
+	}
+	defer rows.Close()
+
+	type Purchase struct {
+		SupplierId    string `json:"supplier_id"`
+		SupplierName  string `json:"supplier_name"`
+		CompoundId    string `json:"compound_id"`
+		CompoundName  string `json:"compound_name"`
+		Scale         string `json:"scale"`
+		Entries       int    `json:"entries"`
+		TotalQuantity int    `json:"total_quantity"`
+		LastPurchase  string `json:"last_purchase"`
+	}
+
+	purchases := []Purchase{}
+	for rows.Next() {
+		var p Purchase
+		if err := rows.Scan(&p.SupplierId, &p.SupplierName, &p.CompoundId, &p.CompoundName, &p.Scale, &p.Entries, &p.TotalQuantity, &p.LastPurchase); err != nil {
+			slog.ErrorContext(r.Context(), "failed to scan purchase row", "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.REPORT_RETRIEVAL_ERR)
+			return
+		}
+		purchases = append(purchases, p)
+	}
+
+	if isExportFormat(reqBody.Format) {
+		writeRedactedExport(w, r, reqBody.Format, purchases, func(purchases []Purchase) *export.Document {
+			table := export.Table{
+				Name:    "Purchases",
+				Columns: []string{"Supplier", "Compound", "Deliveries", "Quantity", "Scale", "Last delivery"},
+			}
+			for _, p := range purchases {
+				table.AddRow(p.SupplierName, p.CompoundName, p.Entries, p.TotalQuantity, p.Scale, p.LastPurchase)
+			}
+			return &export.Document{
+				Name:   exportName(r.Context(), "purchases"),
+				Title:  "Purchases by supplier",
+				Tables: []export.Table{table},
+			}
+		})
+		return
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"purchases": purchases,
+	})
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const QUOTA_WARNING_HEADER = "X-Quota-Warning"
+
+func GetQuotaHandler(w http.ResponseWriter, r *http.Request) {
+	quotas, err := utils.GetQuotas(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get quotas", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.QUOTA_RETRIEVAL_ERR)
+		return
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"quotas": quotas,
+	})
+}
+
+// Adds the "X-Quota-Warning" header listing the resources that are near their limit, e.g. "entries=2 remaining"
+func QuotaWarningMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		quotas, err := utils.GetQuotas(r.Context())
+		if err != nil {
+			slog.WarnContext(r.Context(), "failed to get quotas for warning header", "error", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		warnings := []string{}
+		for resource, quota := range quotas {
+			if quota.NearLimit {
+				warnings = append(warnings, fmt.Sprintf("%s=%d remaining", resource, *quota.Remaining))
+			}
+		}
+		if len(warnings) > 0 {
+			sort.Strings(warnings)
+			w.Header().Set(QUOTA_WARNING_HEADER, strings.Join(warnings, ", "))
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Responds with an error and returns false when the given resource has used up its quota
+func checkQuota(ctx context.Context, w http.ResponseWriter, resource string) bool {
+	quota, err := utils.GetQuota(ctx, resource)
+	if err != nil {
+		slog.ErrorContext(ctx, "error getting quota", "resource", resource, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.QUOTA_RETRIEVAL_ERR)
+		return false
+	}
+	if quota.Exceeded {
+		slog.ErrorContext(ctx, "trial period limit exceeded", "resource", resource, "used", quota.Used, "limit", quota.Limit)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.TRIAL_PERIOD_LIMIT_EXCEEDED)
+		return false
+	}
+	return true
+}
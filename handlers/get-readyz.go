@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"log/slog"
+	"net/http"
+)
+
+const (
+	READINESS_READY       = "ready"
+	READINESS_DEGRADED    = "degraded"
+	READINESS_UNAVAILABLE = "unavailable"
+)
+
+// Reports whether the ledger can serve requests. Only the database is required, migrated to the schema version of
+// this build; failing optional subsystems and a disk too full to take changes mark the service as degraded but keep
+// it ready.
+func GetReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	status := READINESS_READY
+	httpStatus := http.StatusOK
+
+	database := "up"
+	if err := db.ConnFrom(r.Context()).PingContext(r.Context()); err != nil {
+		slog.ErrorContext(r.Context(), "readiness check: database ping failed", "error", err)
+		database = "down"
+		status = READINESS_UNAVAILABLE
+		httpStatus = http.StatusServiceUnavailable
+	}
+
+	// A database behind the schema of this build lacks tables or columns the handlers rely on
+	migrations := "applied"
+	schemaVersion, err := db.GetSchemaVersion(r.Context(), db.ConnFrom(r.Context()))
+	if err != nil || schemaVersion < db.SCHEMA_VERSION {
+		if err != nil {
+			slog.ErrorContext(r.Context(), "readiness check: failed to read database schema version", "error", err)
+		}
+		migrations = "pending"
+		status = READINESS_UNAVAILABLE
+		httpStatus = http.StatusServiceUnavailable
+	}
+
+	subsystems := utils.GetSubsystemStatuses()
+	for _, subsystem := range subsystems {
+		if !subsystem.Healthy && status == READINESS_READY {
+			status = READINESS_DEGRADED
+		}
+	}
+
+	// Lookups still work on a read-only API, so it is degraded rather than unavailable
+	disk := utils.GetDiskStatus()
+	if disk != nil && disk.ReadOnly && status == READINESS_READY {
+		status = READINESS_DEGRADED
+	}
+
+	httpx.RespWithData(w, httpStatus, map[string]any{
+		"status":                  status,
+		"database":                database,
+		"migrations":              migrations,
+		"database_schema_version": schemaVersion,
+		"schema_version":          db.SCHEMA_VERSION,
+		"disk":                    disk,
+		"subsystems":              subsystems,
+	})
+}
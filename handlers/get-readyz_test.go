@@ -0,0 +1,32 @@
+package handlers_test
+
+import (
+	"chemical-ledger-backend/handlers"
+	"chemical-ledger-backend/testutils"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadinessNeedsMigrationsApplied(t *testing.T) {
+	t.Parallel()
+	env := testutils.NewEnv(t, time.Date(2026, 3, 14, 10, 0, 0, 0, time.Local))
+
+	w := httptest.NewRecorder()
+	handlers.GetReadyzHandler(w, env.Request(http.MethodGet, "/readyz", nil))
+	if body := w.Body.String(); w.Code != http.StatusOK || !strings.Contains(body, `"migrations":"applied"`) {
+		t.Errorf("readyz: status %d, %s", w.Code, body)
+	}
+
+	// A database the migrations have not caught up yet is alive but not ready
+	if _, err := env.DB.Exec("PRAGMA user_version = 0"); err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	handlers.GetReadyzHandler(w, env.Request(http.MethodGet, "/readyz", nil))
+	if body := w.Body.String(); w.Code != http.StatusServiceUnavailable || !strings.Contains(body, `"migrations":"pending"`) || !strings.Contains(body, `"database_schema_version":0`) {
+		t.Errorf("readyz before migrating: status %d, %s", w.Code, body)
+	}
+}
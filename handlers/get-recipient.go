@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"log/slog"
+	"net/http"
+)
+
+func GetRecipientHandler(w http.ResponseWriter, r *http.Request) {
+	rows, err := db.ConnFrom(r.Context()).QueryContext(r.Context(), `
+		SELECT id, name, department, phone, email
+		FROM recipient
+		ORDER BY lower_case_name ASC
+	`)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to query recipients", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.RECIPIENT_RETRIEVAL_ERR)
+		return
+	}
+	defer rows.Close()
+
+	type Recipient struct {
+		ID         string `json:"key"`
+		Name       string `json:"name"`
+		Department string `json:"department"`
+		Phone      string `json:"phone"`
+		Email      string `json:"email"`
+	}
+
+	recipients := []Recipient{}
+	for rows.Next() {
+		var recipient Recipient
+		if err := rows.Scan(&recipient.ID, &recipient.Name, &recipient.Department, &recipient.Phone, &recipient.Email); err != nil {
+			slog.ErrorContext(r.Context(), "failed to scan recipient row", "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.RECIPIENT_RETRIEVAL_ERR)
+			return
+		}
+		recipients = append(recipients, recipient)
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"recipients": recipients,
+	})
+}
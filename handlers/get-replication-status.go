@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"errors"
+	"log/slog"
+	"net/http"
+)
+
+// Reports the replica a standby keeps, for monitoring that snapshots keep arriving: which snapshot of the primary it
+// is, when it was taken and received, and its checksum. "replica" is null until the first snapshot arrives.
+func GetReplicationStatusHandler(w http.ResponseWriter, r *http.Request) {
+	manifest, err := utils.GetReplicaManifest()
+	if err != nil && !errors.Is(err, utils.ErrNoReplica) {
+		slog.ErrorContext(r.Context(), "failed to read replica manifest", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.REPLICATION_STATUS_ERR)
+		return
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"mode":    utils.ReplicationMode(),
+		"replica": manifest,
+	})
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/datetime"
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"log/slog"
+	"net/http"
+)
+
+// State of a reservation: still holding its quantity, past the day it was needed on or cancelled before
+const (
+	RESERVATION_STATUS_HELD      = "held"
+	RESERVATION_STATUS_LAPSED    = "lapsed"
+	RESERVATION_STATUS_CANCELLED = "cancelled"
+)
+
+// Lists the reservations of "compound_id" (of every compound when omitted) by the day they are needed on, latest
+// first, each with its "status"
+func GetReservationHandler(w http.ResponseWriter, r *http.Request) {
+	compoundId := httpx.GetParam(r, "compound_id")
+
+	query := `
+		SELECT
+			s.id, s.compound_id, c.name, c.scale, s.quantity, s.needed_on, s.purpose, s.reserved_by,
+			datetime(s.reserved_at, 'unixepoch', 'localtime'),
+			COALESCE(s.cancelled_by, ''), COALESCE(datetime(s.cancelled_at, 'unixepoch', 'localtime'), '')
+		FROM reservation s
+		JOIN compound c ON s.compound_id = c.id`
+	args := []any{}
+	if compoundId != "" {
+		query += " WHERE s.compound_id = ?"
+		args = append(args, compoundId)
+	}
+	query += " ORDER BY s.needed_on DESC, s.reserved_at DESC, s.id DESC"
+
+	rows, err := db.ConnFrom(r.Context()).QueryContext(r.Context(), query, args...)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to query reservations", "compound_id", compoundId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.RESERVATION_RETRIEVAL_ERR)
+		return
+	}
+	defer rows.Close()
+
+	type Reservation struct {
+		Id          string `json:"id"`
+		CompoundId  string `json:"compound_id"`
+		Name        string `json:"name"`
+		Scale       string `json:"scale"`
+		Quantity    int    `json:"quantity"`
+		NeededOn    string `json:"needed_on"`
+		Purpose     string `json:"purpose"`
+		ReservedBy  string `json:"reserved_by"`
+		ReservedAt  string `json:"reserved_at"`
+		CancelledBy string `json:"cancelled_by"`
+		CancelledAt string `json:"cancelled_at"`
+		Status      string `json:"status"`
+	}
+
+	today := datetime.Now(r.Context()).Format("2006-01-02")
+	reservations := []Reservation{}
+	for rows.Next() {
+		var s Reservation
+		if err := rows.Scan(&s.Id, &s.CompoundId, &s.Name, &s.Scale, &s.Quantity, &s.NeededOn, &s.Purpose, &s.ReservedBy, &s.ReservedAt, &s.CancelledBy, &s.CancelledAt); err != nil {
+			slog.ErrorContext(r.Context(), "failed to scan reservation row", "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.RESERVATION_RETRIEVAL_ERR)
+			return
+		}
+		switch {
+		case s.CancelledAt != "":
+			s.Status = RESERVATION_STATUS_CANCELLED
+		case s.NeededOn < today:
+			s.Status = RESERVATION_STATUS_LAPSED
+		default:
+			s.Status = RESERVATION_STATUS_HELD
+		}
+		reservations = append(reservations, s)
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"reservations": reservations,
+	})
+}
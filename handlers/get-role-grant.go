@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/datetime"
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"log/slog"
+	"net/http"
+)
+
+// State of a role grant: in force, run out or revoked before it ran out
+const (
+	ROLE_GRANT_STATUS_ACTIVE  = "active"
+	ROLE_GRANT_STATUS_EXPIRED = "expired"
+	ROLE_GRANT_STATUS_REVOKED = "revoked"
+)
+
+// Lists the role grants of "user_id" (all grants when omitted), newest first, each with its "status"
+func GetRoleGrantHandler(w http.ResponseWriter, r *http.Request) {
+	userId := httpx.GetParam(r, "user_id")
+
+	query := `
+		SELECT
+			g.id, g.user_id, u.name, u.role, g.role, g.reason, g.granted_by,
+			datetime(g.granted_at, 'unixepoch', 'localtime'),
+			datetime(g.expires_at, 'unixepoch', 'localtime'),
+			COALESCE(g.revoked_by, ''), COALESCE(datetime(g.revoked_at, 'unixepoch', 'localtime'), ''),
+			g.revoked_at IS NULL AND g.expires_at > ?
+		FROM role_grant g
+		JOIN user u ON g.user_id = u.id`
+	args := []any{datetime.Now(r.Context()).Unix()}
+	if userId != "" {
+		query += " WHERE g.user_id = ?"
+		args = append(args, userId)
+	}
+	query += " ORDER BY g.granted_at DESC, g.id DESC"
+
+	rows, err := db.ConnFrom(r.Context()).QueryContext(r.Context(), query, args...)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to query role grants", "user_id", userId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.ROLE_GRANT_RETRIEVAL_ERR)
+		return
+	}
+	defer rows.Close()
+
+	type RoleGrant struct {
+		Id        string `json:"id"`
+		UserId    string `json:"user_id"`
+		UserName  string `json:"user_name"`
+		BaseRole  string `json:"base_role"`
+		Role      string `json:"role"`
+		Reason    string `json:"reason"`
+		GrantedBy string `json:"granted_by"`
+		GrantedAt string `json:"granted_at"`
+		ExpiresAt string `json:"expires_at"`
+		RevokedBy string `json:"revoked_by"`
+		RevokedAt string `json:"revoked_at"`
+		Status    string `json:"status"`
+	}
+
+	grants := []RoleGrant{}
+	for rows.Next() {
+		var g RoleGrant
+		var active bool
+		if err := rows.Scan(&g.Id, &g.UserId, &g.UserName, &g.BaseRole, &g.Role, &g.Reason, &g.GrantedBy, &g.GrantedAt, &g.ExpiresAt, &g.RevokedBy, &g.RevokedAt, &active); err != nil {
+			slog.ErrorContext(r.Context(), "failed to scan role grant row", "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.ROLE_GRANT_RETRIEVAL_ERR)
+			return
+		}
+		switch {
+		case active:
+			g.Status = ROLE_GRANT_STATUS_ACTIVE
+		case g.RevokedAt != "":
+			g.Status = ROLE_GRANT_STATUS_REVOKED
+		default:
+			g.Status = ROLE_GRANT_STATUS_EXPIRED
+		}
+		grants = append(grants, g)
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"role_grants": grants,
+	})
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/url"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Resolves a share token back to its view: the path, the filters and the "url" combining them, and the
+// snapshot data when one was kept. The snapshot goes through the redaction of the user opening the link.
+func GetSharedViewHandler(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+
+	var path, filters, createdBy, createdAt, snapshotAt string
+	var snapshot []byte
+	err := db.ConnFrom(r.Context()).QueryRowContext(r.Context(), `
+		SELECT path, filters, snapshot, COALESCE(datetime(snapshot_at, 'unixepoch', 'localtime'), ''),
+			created_by, datetime(created_at, 'unixepoch', 'localtime')
+		FROM shared_view
+		WHERE token = ?`,
+		token,
+	).Scan(&path, &filters, &snapshot, &snapshotAt, &createdBy, &createdAt)
+	if err == sql.ErrNoRows {
+		slog.WarnContext(r.Context(), "share token not found", "token", token)
+		httpx.RespWithError(w, http.StatusNotFound, utils.INVALID_SHARE_TOKEN)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to retrieve shared view", "token", token, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.SHARED_VIEW_RETRIEVAL_ERR)
+		return
+	}
+
+	query, err := url.ParseQuery(filters)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to parse shared view filters", "token", token, "filters", filters, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.SHARED_VIEW_RETRIEVAL_ERR)
+		return
+	}
+	filterMap := map[string]string{}
+	for name := range query {
+		filterMap[name] = query.Get(name)
+	}
+
+	resp := map[string]any{
+		"token":      token,
+		"path":       path,
+		"filters":    filterMap,
+		"url":        sharedViewUrl(path, filters),
+		"created_by": createdBy,
+		"created_at": createdAt,
+	}
+	if snapshot != nil {
+		resp["snapshot"] = json.RawMessage(snapshot)
+		resp["snapshot_at"] = snapshotAt
+	}
+
+	httpx.RespWithData(w, http.StatusOK, resp)
+}
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/export"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"context"
+	"database/sql"
+	"log/slog"
+	"math"
+	"net/http"
+)
+
+type GetShrinkageReportReq struct {
+	CompoundId string `json:"compound_id"`
+	From       string `json:"from"`
+	To         string `json:"to"`
+	GroupBy    string `json:"groupBy"`
+	Format     string `json:"format"`
+}
+
+// Shrinkage of a compound over a period: what the ledger expected from the incoming and outgoing entries, and what
+// the stock-takes found missing (or over) on top of it. Cumulative figures run from the first entry of the compound,
+// so earlier periods count even when the range starts later.
+type Shrinkage struct {
+	Period             string   `json:"period,omitempty"`
+	CompoundId         string   `json:"compound_id"`
+	CompoundName       string   `json:"compound_name"`
+	Scale              string   `json:"scale"`
+	Incoming           int      `json:"incoming"`
+	Outgoing           int      `json:"outgoing"`
+	AdjustmentIn       int      `json:"adjustment_in"`
+	AdjustmentOut      int      `json:"adjustment_out"`
+	Disposed           int      `json:"disposed"`
+	UnexplainedLoss    int      `json:"unexplained_loss"`
+	CumulativeIncoming int      `json:"cumulative_incoming"`
+	CumulativeOutgoing int      `json:"cumulative_outgoing"`
+	CumulativeDisposed int      `json:"cumulative_disposed"`
+	BookStock          int      `json:"book_stock"`
+	CumulativeLoss     int      `json:"cumulative_loss"`
+	ShrinkagePercent   *float64 `json:"shrinkage_percent"`
+}
+
+// Quantifies the unexplained loss of each compound per month (or over the whole range with groupBy=compound),
+// optionally for one compound. The loss is what the adjustments of the stock-takes took out beyond what they put
+// back; a negative loss is stock found over the books. Disposals are accounted for, so they are no loss. "book_stock"
+// is the cumulative incoming minus outgoing and disposed, the stock had nothing gone missing, and "shrinkage_percent" the cumulative loss as a share of everything received.
+// Export formats give the same rows, for the auditors.
+func GetShrinkageReportHandler(w http.ResponseWriter, r *http.Request) {
+	reqBody := &GetShrinkageReportReq{
+		CompoundId: httpx.GetParam(r, "compound_id"),
+		From:       httpx.GetParam(r, "from"),
+		To:         httpx.GetParam(r, "to"),
+		GroupBy:    httpx.GetParam(r, "groupBy"),
+		Format:     httpx.GetParam(r, "format"),
+	}
+
+	if errStr := validateExportFormat(r.Context(), reqBody.Format); errStr != utils.NO_ERR {
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+	if reqBody.GroupBy == "" {
+		reqBody.GroupBy = GROUP_BY_MONTH
+	}
+
+	var periodExpr string
+	switch reqBody.GroupBy {
+	case GROUP_BY_MONTH:
+		periodExpr = "strftime('%Y-%m', e.date, 'unixepoch', 'localtime')"
+	case GROUP_BY_COMPOUND:
+		periodExpr = "''"
+	default:
+		slog.ErrorContext(r.Context(), "invalid shrinkage group by", "groupBy", reqBody.GroupBy)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.INVALID_GROUP_BY)
+		return
+	}
+
+	fromUnix, toUnix, errStr := parseReportRange(r.Context(), reqBody.From, reqBody.To)
+	if errStr != utils.NO_ERR {
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	// Entries before the range only carry the cumulative figures, in a period of their own (NULL)
+	query := `
+		SELECT
+			CASE WHEN e.date < ? THEN NULL ELSE ` + periodExpr + ` END AS period,
+			c.id, c.name, c.scale,
+			SUM(CASE WHEN e.type = ? THEN q.total_quantity ELSE 0 END),
+			SUM(CASE WHEN e.type = ? THEN q.total_quantity ELSE 0 END),
+			SUM(CASE WHEN e.type = ? THEN q.total_quantity ELSE 0 END),
+			SUM(CASE WHEN e.type = ? THEN q.total_quantity ELSE 0 END),
+			SUM(CASE WHEN e.type = ? THEN q.total_quantity ELSE 0 END)
+		FROM entry e
+		JOIN quantity q ON e.quantity_id = q.id
+		JOIN compound c ON e.compound_id = c.id
+		WHERE e.date < ? AND e.status = ? AND e.deleted_at IS NULL`
+	args := []any{
+		fromUnix,
+		utils.ENTRY_TYPE_INCOMING, utils.ENTRY_TYPE_OUTGOING, utils.ENTRY_TYPE_ADJUSTMENT_IN, utils.ENTRY_TYPE_ADJUSTMENT_OUT,
+		utils.ENTRY_TYPE_DISPOSAL, toUnix, utils.ENTRY_STATUS_APPROVED,
+	}
+	if reqBody.CompoundId != "" {
+		query += " AND e.compound_id = ?"
+		args = append(args, reqBody.CompoundId)
+	}
+	query += " GROUP BY c.id, period ORDER BY c.lower_case_name ASC, c.id ASC, period IS NOT NULL, period ASC"
+
+	rows, err := db.ConnFrom(r.Context()).QueryContext(r.Context(), query, args...)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to query shrinkage report", "groupBy", reqBody.GroupBy, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.REPORT_RETRIEVAL_ERR)
+		return
+	}
+	defer rows.Close()
+
+	shrinkage := []Shrinkage{}
+	var running Shrinkage
+	for rows.Next() {
+		var s Shrinkage
+		var period sql.NullString
+		if err := rows.Scan(&period, &s.CompoundId, &s.CompoundName, &s.Scale, &s.Incoming, &s.Outgoing, &s.AdjustmentIn, &s.AdjustmentOut, &s.Disposed); err != nil {
+			slog.ErrorContext(r.Context(), "failed to scan shrinkage row", "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.REPORT_RETRIEVAL_ERR)
+			return
+		}
+
+		if s.CompoundId != running.CompoundId {
+			running = Shrinkage{CompoundId: s.CompoundId}
+		}
+		running.CumulativeIncoming += s.Incoming
+		running.CumulativeOutgoing += s.Outgoing
+		running.CumulativeDisposed += s.Disposed
+		running.CumulativeLoss += s.AdjustmentOut - s.AdjustmentIn
+		if !period.Valid {
+			continue
+		}
+
+		s.Period = period.String
+		s.UnexplainedLoss = s.AdjustmentOut - s.AdjustmentIn
+		s.CumulativeIncoming, s.CumulativeOutgoing, s.CumulativeLoss = running.CumulativeIncoming, running.CumulativeOutgoing, running.CumulativeLoss
+		s.CumulativeDisposed = running.CumulativeDisposed
+		s.BookStock = s.CumulativeIncoming - s.CumulativeOutgoing - s.CumulativeDisposed
+		if s.CumulativeIncoming > 0 {
+			percent := math.Round(float64(s.CumulativeLoss)*10000/float64(s.CumulativeIncoming)) / 100
+			s.ShrinkagePercent = &percent
+		}
+		shrinkage = append(shrinkage, s)
+	}
+
+	if isExportFormat(reqBody.Format) {
+		writeRedactedExport(w, r, reqBody.Format, shrinkage, func(shrinkage []Shrinkage) *export.Document {
+			return shrinkageDocument(r.Context(), shrinkage)
+		})
+		return
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"group_by":  reqBody.GroupBy,
+		"shrinkage": shrinkage,
+	})
+}
+
+// Lays out the shrinkage report for export, one row per compound and period
+func shrinkageDocument(ctx context.Context, shrinkage []Shrinkage) *export.Document {
+	table := export.Table{
+		Name: "Shrinkage",
+		Columns: []string{"Period", "Compound", "Scale", "Incoming", "Outgoing", "Adjustment in", "Adjustment out", "Disposed",
+			"Unexplained loss", "Cumulative incoming", "Cumulative outgoing", "Cumulative disposed", "Book stock", "Cumulative loss", "Shrinkage %"},
+	}
+	for _, s := range shrinkage {
+		table.AddRow(s.Period, s.CompoundName, s.Scale, s.Incoming, s.Outgoing, s.AdjustmentIn, s.AdjustmentOut, s.Disposed,
+			s.UnexplainedLoss, s.CumulativeIncoming, s.CumulativeOutgoing, s.CumulativeDisposed, s.BookStock, s.CumulativeLoss, optionalCell(s.ShrinkagePercent))
+	}
+
+	return &export.Document{
+		Name:   exportName(ctx, "shrinkage"),
+		Title:  "Shrinkage",
+		Tables: []export.Table{table},
+	}
+}
@@ -0,0 +1,50 @@
+package handlers_test
+
+import (
+	"chemical-ledger-backend/handlers"
+	"chemical-ledger-backend/testutils"
+	"chemical-ledger-backend/utils"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Losses before the range still count towards the cumulative figures of the periods in it
+func TestShrinkageReportCarriesLossesAcrossPeriods(t *testing.T) {
+	t.Parallel()
+	env := testutils.NewEnv(t, time.Date(2026, 3, 14, 10, 0, 0, 0, time.Local))
+
+	env.InsertCompound("C_1", "Acetone", "ml")
+	adjust := func(entryType string, date string, quantity int) *httptest.ResponseRecorder {
+		body := fmt.Sprintf(`{"type": %q, "compound_id": "C_1", "date": %q, "num_of_units": 1, "quantity_per_unit": %d, "reason": "stock-take"}`, entryType, date, quantity)
+		w := httptest.NewRecorder()
+		handlers.InsertEntryHandler(w, env.Request(http.MethodPost, "/insert-entry", strings.NewReader(body)))
+		return w
+	}
+
+	for _, w := range []*httptest.ResponseRecorder{
+		insertEntry(env, utils.ENTRY_TYPE_INCOMING, "C_1", "2026-02-02", 1000),
+		insertEntry(env, utils.ENTRY_TYPE_OUTGOING, "C_1", "2026-02-10", 300),
+		adjust(utils.ENTRY_TYPE_ADJUSTMENT_OUT, "2026-02-28", 50),
+		insertEntry(env, utils.ENTRY_TYPE_INCOMING, "C_1", "2026-03-02", 500),
+		insertEntry(env, utils.ENTRY_TYPE_OUTGOING, "C_1", "2026-03-05", 200),
+		adjust(utils.ENTRY_TYPE_ADJUSTMENT_IN, "2026-03-10", 10),
+		adjust(utils.ENTRY_TYPE_ADJUSTMENT_OUT, "2026-03-12", 30),
+	} {
+		if w.Code != http.StatusOK {
+			t.Fatalf("entry: status %d, %s", w.Code, w.Body)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	handlers.GetShrinkageReportHandler(w, env.Request(http.MethodGet, "/report/shrinkage?compound_id=C_1&from=2026-03-01", nil))
+	body := w.Body.String()
+	if w.Code != http.StatusOK || strings.Count(body, `"period"`) != 1 || !strings.Contains(body, `"period":"2026-03"`) ||
+		!strings.Contains(body, `"unexplained_loss":20`) || !strings.Contains(body, `"cumulative_loss":70`) ||
+		!strings.Contains(body, `"book_stock":1000`) || !strings.Contains(body, `"shrinkage_percent":4.67`) {
+		t.Errorf("shrinkage report: status %d, %s", w.Code, body)
+	}
+}
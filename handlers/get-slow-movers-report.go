@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/datetime"
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/export"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Days without movement after which a compound counts as slow moving by default, and at most
+const (
+	DEFAULT_SLOW_MOVER_DAYS = 90
+	MAX_SLOW_MOVER_DAYS     = 3650
+)
+
+type GetSlowMoversReportReq struct {
+	Days   int    `json:"days"`
+	Format string `json:"format"`
+}
+
+// Compound in stock that has not moved for a while. "LastIssue" is empty when none of it was ever issued.
+type SlowMover struct {
+	CompoundId   string `json:"compound_id"`
+	Name         string `json:"name"`
+	Scale        string `json:"scale"`
+	NetStock     int    `json:"net_stock"`
+	LastMovement string `json:"last_movement"`
+	LastIssue    string `json:"last_issue"`
+	IdleDays     int    `json:"idle_days"`
+}
+
+// Lists the compounds still in stock without an approved entry of any type in the last "days" days (default 90),
+// longest idle first, to find the dead stock to dispose of. Archived compounds are left out. With an export "format"
+// the list comes as a file, e.g. to circulate before a clear-out.
+func GetSlowMoversReportHandler(w http.ResponseWriter, r *http.Request) {
+	reqBody := &GetSlowMoversReportReq{Days: DEFAULT_SLOW_MOVER_DAYS, Format: httpx.GetParam(r, "format")}
+	if errStr := validateExportFormat(r.Context(), reqBody.Format); errStr != utils.NO_ERR {
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+	if httpx.GetParam(r, "days") != "" {
+		days, err := httpx.GetIntParam(r, "days")
+		if err != nil || days < 1 || days > MAX_SLOW_MOVER_DAYS {
+			slog.ErrorContext(r.Context(), "invalid slow mover days", "days", httpx.GetParam(r, "days"), "error", err)
+			httpx.RespWithError(w, http.StatusBadRequest, utils.INVALID_IDLE_DAYS)
+			return
+		}
+		reqBody.Days = days
+	}
+
+	now := datetime.Now(r.Context())
+	rows, err := db.ConnFrom(r.Context()).QueryContext(r.Context(), `
+		SELECT c.id, c.name, c.scale, s.balance, m.last_movement, COALESCE(m.last_issue, 0)
+		FROM compound c
+		JOIN stock_current s ON s.compound_id = c.id
+		JOIN (
+			SELECT
+				compound_id,
+				MAX(date) AS last_movement,
+				MAX(CASE WHEN type = ? THEN date END) AS last_issue
+			FROM entry
+			WHERE status = ? AND deleted_at IS NULL
+			GROUP BY compound_id
+		) m ON m.compound_id = c.id
+		WHERE c.archived_at IS NULL AND s.balance > 0 AND m.last_movement < ?
+		ORDER BY m.last_movement ASC, c.lower_case_name ASC`,
+		utils.ENTRY_TYPE_OUTGOING, utils.ENTRY_STATUS_APPROVED, now.AddDate(0, 0, -reqBody.Days).Unix(),
+	)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to query slow movers", "days", reqBody.Days, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.REPORT_RETRIEVAL_ERR)
+		return
+	}
+	defer rows.Close()
+
+	slowMovers := []SlowMover{}
+	for rows.Next() {
+		var m SlowMover
+		var lastMovement, lastIssue int64
+		if err := rows.Scan(&m.CompoundId, &m.Name, &m.Scale, &m.NetStock, &lastMovement, &lastIssue); err != nil {
+			slog.ErrorContext(r.Context(), "failed to scan slow mover row", "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.REPORT_RETRIEVAL_ERR)
+			return
+		}
+		m.LastMovement = time.Unix(lastMovement, 0).Local().Format("2006-01-02")
+		if lastIssue != 0 {
+			m.LastIssue = time.Unix(lastIssue, 0).Local().Format("2006-01-02")
+		}
+		m.IdleDays = int(now.Unix()-lastMovement) / (24 * 60 * 60)
+		slowMovers = append(slowMovers, m)
+	}
+	if err := rows.Err(); err != nil {
+		slog.ErrorContext(r.Context(), "failed to read slow mover rows", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.REPORT_RETRIEVAL_ERR)
+		return
+	}
+
+	if isExportFormat(reqBody.Format) {
+		writeRedactedExport(w, r, reqBody.Format, slowMovers, func(slowMovers []SlowMover) *export.Document {
+			table := export.Table{
+				Name:    "Slow movers",
+				Columns: []string{"Compound", "Net stock", "Scale", "Last movement", "Last issue", "Idle days"},
+			}
+			for _, m := range slowMovers {
+				table.AddRow(m.Name, m.NetStock, m.Scale, m.LastMovement, m.LastIssue, m.IdleDays)
+			}
+			return &export.Document{
+				Name:   exportName(r.Context(), "slow-movers"),
+				Title:  fmt.Sprintf("Compounds idle for %d days or more", reqBody.Days),
+				Tables: []export.Table{table},
+			}
+		})
+		return
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"days":      reqBody.Days,
+		"compounds": slowMovers,
+	})
+}
@@ -0,0 +1,343 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/datetime"
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/export"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Output formats of the reports and exports
+const (
+	REPORT_FORMAT_JSON = "json"
+	REPORT_FORMAT_PDF  = "pdf"
+	REPORT_FORMAT_XLSX = "xlsx"
+)
+
+type GetStatementReportReq struct {
+	CompoundId string `json:"compound_id"`
+	From       string `json:"from"`
+	To         string `json:"to"`
+	Format     string `json:"format"`
+}
+
+type StatementLine struct {
+	EntryId    string `json:"entry_id"`
+	Date       string `json:"date"`
+	Type       string `json:"type"`
+	VoucherNo  string `json:"voucher_no"`
+	Party      string `json:"party"`
+	Remark     string `json:"remark"`
+	Adjustment bool   `json:"adjustment"`
+	Reason     string `json:"reason"`
+	Incoming   int    `json:"incoming"`
+	Outgoing   int    `json:"outgoing"`
+	Balance    int    `json:"balance"`
+}
+
+type Statement struct {
+	CompoundId    string          `json:"compound_id"`
+	Compound      string          `json:"compound"`
+	Scale         string          `json:"scale"`
+	From          string          `json:"from"`
+	To            string          `json:"to"`
+	OpeningStock  int             `json:"opening_stock"`
+	TotalIncoming int             `json:"total_incoming"`
+	TotalOutgoing int             `json:"total_outgoing"`
+	AdjustmentIn  int             `json:"adjustment_in"`
+	AdjustmentOut int             `json:"adjustment_out"`
+	Disposed      int             `json:"disposed"`
+	ClosingStock  int             `json:"closing_stock"`
+	Lines         []StatementLine `json:"lines"`
+}
+
+// Gets the running-balance statement of a compound for a period: the opening stock, every entry in the
+// period with the balance after it, and the closing stock. "format=pdf" renders it for printing, other export
+// formats list the lines.
+// Adjustments show in the incoming and outgoing columns of their line but are flagged and totalled apart, as are
+// disposals in the outgoing column.
+func GetStatementReportHandler(w http.ResponseWriter, r *http.Request) {
+	reqBody := &GetStatementReportReq{
+		CompoundId: httpx.GetParam(r, "compound_id"),
+		From:       httpx.GetParam(r, "from"),
+		To:         httpx.GetParam(r, "to"),
+		Format:     httpx.GetParam(r, "format"),
+	}
+
+	if reqBody.Format == "" {
+		reqBody.Format = REPORT_FORMAT_JSON
+	}
+	if errStr := validateExportFormat(r.Context(), reqBody.Format); errStr != utils.NO_ERR {
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	if reqBody.CompoundId == "" {
+		slog.ErrorContext(r.Context(), "missing required fields", "compound_id", reqBody.CompoundId)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.MISSING_REQUIRED_FIELDS)
+		return
+	}
+
+	fromUnix, toUnix, errStr := parseReportRange(r.Context(), reqBody.From, reqBody.To)
+	if errStr != utils.NO_ERR {
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	statement := &Statement{
+		CompoundId: reqBody.CompoundId,
+		From:       reqBody.From,
+		To:         reqBody.To,
+		Lines:      []StatementLine{},
+	}
+	if statement.To == "" {
+		statement.To = datetime.Now(r.Context()).Format("2006-01-02")
+	}
+
+	err := db.ConnFrom(r.Context()).QueryRowContext(r.Context(), "SELECT name, scale FROM compound WHERE id = ?", reqBody.CompoundId).Scan(&statement.Compound, &statement.Scale)
+	if errors.Is(err, sql.ErrNoRows) {
+		slog.ErrorContext(r.Context(), "compound not found", "compound_id", reqBody.CompoundId)
+		httpx.RespWithError(w, http.StatusNotFound, utils.INVALID_COMPOUND_ID)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get compound", "compound_id", reqBody.CompoundId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.COMPOUND_RETRIEVAL_ERR)
+		return
+	}
+
+	if err := fillStatement(r.Context(), statement, fromUnix, toUnix); err != nil {
+		slog.ErrorContext(r.Context(), "failed to build statement", "compound_id", reqBody.CompoundId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.REPORT_RETRIEVAL_ERR)
+		return
+	}
+
+	if isExportFormat(reqBody.Format) {
+		statement, err = utils.RedactForRole(currentUser(r).Role, statement)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to redact statement", "compound_id", reqBody.CompoundId, "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.REDACTION_ERR)
+			return
+		}
+		writeExport(r.Context(), w, reqBody.Format, statementDocument(statement))
+		return
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"statement": statement,
+	})
+}
+
+func fillStatement(ctx context.Context, statement *Statement, fromUnix, toUnix int64) error {
+	err := db.ConnFrom(ctx).QueryRowContext(ctx, `
+		SELECT net_stock FROM entry
+		WHERE compound_id = ? AND date < ? AND deleted_at IS NULL
+		ORDER BY date DESC, seq DESC
+		LIMIT 1`, statement.CompoundId, fromUnix,
+	).Scan(&statement.OpeningStock)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	rows, err := db.ConnFrom(ctx).QueryContext(ctx, `
+		SELECT `+statementLineColumns+`
+		FROM entry e
+		JOIN quantity q ON e.quantity_id = q.id
+		LEFT JOIN supplier s ON e.supplier_id = s.id
+		LEFT JOIN recipient rc ON e.recipient_id = rc.id
+		WHERE e.compound_id = ? AND e.date >= ? AND e.date < ? AND e.status = ? AND e.deleted_at IS NULL
+		ORDER BY e.date ASC, e.seq ASC`,
+		statement.CompoundId, fromUnix, toUnix, utils.ENTRY_STATUS_APPROVED,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	statement.ClosingStock = statement.OpeningStock
+	for rows.Next() {
+		line, quantity, err := scanStatementLine(rows)
+		if err != nil {
+			return err
+		}
+		switch line.Type {
+		case utils.ENTRY_TYPE_INCOMING:
+			statement.TotalIncoming += quantity
+		case utils.ENTRY_TYPE_OUTGOING:
+			statement.TotalOutgoing += quantity
+		case utils.ENTRY_TYPE_ADJUSTMENT_IN:
+			statement.AdjustmentIn += quantity
+		case utils.ENTRY_TYPE_ADJUSTMENT_OUT:
+			statement.AdjustmentOut += quantity
+		case utils.ENTRY_TYPE_DISPOSAL:
+			statement.Disposed += quantity
+		}
+		statement.ClosingStock = line.Balance
+		statement.Lines = append(statement.Lines, line)
+	}
+
+	return rows.Err()
+}
+
+// Columns of the entries listed in a statement, to be read by scanStatementLine
+const statementLineColumns = `
+	e.id, datetime(e.date, 'unixepoch', 'localtime'), e.type,
+	COALESCE(e.voucher_no, ''), COALESCE(s.name, rc.name, ''), COALESCE(e.remark, ''), COALESCE(e.reason, ''),
+	q.total_quantity, e.net_stock`
+
+// Reads a row of "statementLineColumns" as a line, along with the quantity the entry moved
+func scanStatementLine(rows *sql.Rows) (StatementLine, int, error) {
+	var line StatementLine
+	var quantity int
+	if err := rows.Scan(&line.EntryId, &line.Date, &line.Type, &line.VoucherNo, &line.Party, &line.Remark, &line.Reason, &quantity, &line.Balance); err != nil {
+		return line, 0, err
+	}
+	// Transfers between locations are listed without moving the balance
+	if utils.IsInwardEntryType(line.Type) {
+		line.Incoming = quantity
+	} else if utils.IsOutwardEntryType(line.Type) {
+		line.Outgoing = quantity
+	}
+	line.Adjustment = utils.IsAdjustmentEntryType(line.Type)
+	return line, quantity, nil
+}
+
+// Lays out the statement for export, as its lines between the opening and the closing stock. PDFs are printed in
+// the statement's own layout.
+func statementDocument(statement *Statement) *export.Document {
+	table := export.Table{
+		Name:    statement.Compound,
+		Columns: []string{"Date", "Entry", "Type", "Voucher no", "Supplier/Recipient", "Remark", "Adjustment reason", "In (" + statement.Scale + ")", "Out (" + statement.Scale + ")", "Balance"},
+	}
+	table.AddRow("", "", "Opening stock", "", "", "", "", "", "", statement.OpeningStock)
+	for _, line := range statement.Lines {
+		table.AddRow(line.Date, line.EntryId, line.Type, line.VoucherNo, line.Party, line.Remark, line.Reason, line.Incoming, line.Outgoing, line.Balance)
+	}
+	table.AddRow("", "", "Closing stock", "", "", "", "", statement.TotalIncoming, statement.TotalOutgoing, statement.ClosingStock)
+
+	doc := &export.Document{
+		Name:   fmt.Sprintf("statement-%s-%s", statement.CompoundId, statement.To),
+		Title:  "Stock statement",
+		Tables: []export.Table{table},
+	}
+	doc.Layouts = map[string]func(w io.Writer) error{
+		REPORT_FORMAT_PDF: func(w io.Writer) error {
+			_, err := w.Write(renderStatementPDF(statement, doc.GeneratedAt))
+			return err
+		},
+	}
+	return doc
+}
+
+// Column positions of the statement table, in points from the left edge of the page.
+// Quantity columns are right aligned on their position.
+const (
+	stmtColDate     = utils.PDF_MARGIN
+	stmtColEntry    = 132.0
+	stmtColVoucher  = 208.0
+	stmtColParty    = 272.0
+	stmtColIncoming = 440.0
+	stmtColOutgoing = 500.0
+	stmtColBalance  = utils.PDF_PAGE_WIDTH - utils.PDF_MARGIN
+
+	stmtFontSize   = 9.0
+	stmtLineHeight = 14.0
+)
+
+func renderStatementPDF(statement *Statement, generatedAt time.Time) []byte {
+	pdf := utils.NewPDF()
+	right := utils.PDF_PAGE_WIDTH - utils.PDF_MARGIN
+
+	period := statement.From + " to " + statement.To
+	if statement.From == "" {
+		period = "Up to " + statement.To
+	}
+
+	y := utils.PDF_MARGIN + 10
+	pdf.Text(utils.PDF_MARGIN, y, 16, true, "Stock statement")
+	y += 24
+	pdf.Text(utils.PDF_MARGIN, y, 11, true, fmt.Sprintf("%s (%s)", statement.Compound, statement.Scale))
+	pdf.TextRight(right, y, 9, false, "Compound ID: "+statement.CompoundId)
+	y += 16
+	pdf.Text(utils.PDF_MARGIN, y, 9, false, "Period: "+period)
+	pdf.TextRight(right, y, 9, false, "Generated: "+generatedAt.Format("2006-01-02 15:04"))
+	y += 22
+
+	header := func() {
+		pdf.Text(stmtColDate, y, stmtFontSize, true, "Date")
+		pdf.Text(stmtColEntry, y, stmtFontSize, true, "Entry")
+		pdf.Text(stmtColVoucher, y, stmtFontSize, true, "Voucher")
+		pdf.Text(stmtColParty, y, stmtFontSize, true, "Supplier/Recipient")
+		pdf.TextRight(stmtColIncoming, y, stmtFontSize, true, "In")
+		pdf.TextRight(stmtColOutgoing, y, stmtFontSize, true, "Out")
+		pdf.TextRight(stmtColBalance, y, stmtFontSize, true, "Balance")
+		pdf.Line(utils.PDF_MARGIN, right, y+4)
+		y += stmtLineHeight + 2
+	}
+	nextLine := func() {
+		y += stmtLineHeight
+		if y > utils.PDF_PAGE_HEIGHT-2*utils.PDF_MARGIN {
+			pdf.AddPage()
+			y = utils.PDF_MARGIN + 10
+			header()
+		}
+	}
+	quantity := func(q int) string {
+		if q == 0 {
+			return ""
+		}
+		return strconv.Itoa(q)
+	}
+
+	header()
+
+	pdf.Text(stmtColDate, y, stmtFontSize, true, "Opening stock")
+	pdf.TextRight(stmtColBalance, y, stmtFontSize, true, strconv.Itoa(statement.OpeningStock))
+	nextLine()
+
+	for _, line := range statement.Lines {
+		party := line.Party
+		if line.Adjustment {
+			party = "ADJ: " + line.Reason
+		} else if line.Type == utils.ENTRY_TYPE_DISPOSAL {
+			party = "DISPOSAL"
+		}
+		pdf.Text(stmtColDate, y, stmtFontSize, false, utils.PDFTruncate(line.Date, 16))
+		pdf.Text(stmtColEntry, y, stmtFontSize, false, utils.PDFTruncate(line.EntryId, 13))
+		pdf.Text(stmtColVoucher, y, stmtFontSize, false, utils.PDFTruncate(line.VoucherNo, 11))
+		pdf.Text(stmtColParty, y, stmtFontSize, line.Adjustment, utils.PDFTruncate(party, 22))
+		pdf.TextRight(stmtColIncoming, y, stmtFontSize, false, quantity(line.Incoming))
+		pdf.TextRight(stmtColOutgoing, y, stmtFontSize, false, quantity(line.Outgoing))
+		pdf.TextRight(stmtColBalance, y, stmtFontSize, false, strconv.Itoa(line.Balance))
+		nextLine()
+	}
+
+	pdf.Line(utils.PDF_MARGIN, right, y-stmtLineHeight+4)
+	if statement.AdjustmentIn != 0 || statement.AdjustmentOut != 0 {
+		pdf.Text(stmtColDate, y, stmtFontSize, false, "Adjustments")
+		pdf.TextRight(stmtColIncoming, y, stmtFontSize, false, quantity(statement.AdjustmentIn))
+		pdf.TextRight(stmtColOutgoing, y, stmtFontSize, false, quantity(statement.AdjustmentOut))
+		nextLine()
+	}
+	if statement.Disposed != 0 {
+		pdf.Text(stmtColDate, y, stmtFontSize, false, "Disposed")
+		pdf.TextRight(stmtColOutgoing, y, stmtFontSize, false, quantity(statement.Disposed))
+		nextLine()
+	}
+	pdf.Text(stmtColDate, y, stmtFontSize, true, "Closing stock")
+	pdf.TextRight(stmtColIncoming, y, stmtFontSize, true, strconv.Itoa(statement.TotalIncoming))
+	pdf.TextRight(stmtColOutgoing, y, stmtFontSize, true, strconv.Itoa(statement.TotalOutgoing))
+	pdf.TextRight(stmtColBalance, y, stmtFontSize, true, strconv.Itoa(statement.ClosingStock))
+
+	return pdf.Bytes()
+}
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"context"
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+type StockTake struct {
+	Id         string `json:"id"`
+	Date       string `json:"date"`
+	Remark     string `json:"remark"`
+	Status     string `json:"status"`
+	OpenedBy   string `json:"opened_by"`
+	OpenedAt   string `json:"opened_at"`
+	ApprovedBy string `json:"approved_by"`
+	ApprovedAt string `json:"approved_at"`
+}
+
+// Counted quantity of a compound against its stock in the ledger
+type StockTakeLine struct {
+	CompoundId        string `json:"compound_id"`
+	Name              string `json:"name"`
+	Scale             string `json:"scale"`
+	LedgerStock       int    `json:"ledger_stock"`
+	CountedQuantity   int    `json:"counted_quantity"`
+	Variance          int    `json:"variance"`
+	CountedBy         string `json:"counted_by"`
+	CountedAt         string `json:"counted_at"`
+	AdjustmentEntryId string `json:"adjustment_entry_id"`
+}
+
+type StockTakeReport struct {
+	StockTake
+	Lines []StockTakeLine `json:"lines"`
+}
+
+// Lists the stock-takes, newest first. With "stock_take_id" it gets that stock-take with its variance report
+// instead: for each counted compound, the counted quantity against the ledger stock at the end of the count
+// date. Once approved, the report keeps the ledger stock the adjustments were made against.
+func GetStockTakeHandler(w http.ResponseWriter, r *http.Request) {
+	if stockTakeId := httpx.GetParam(r, "stock_take_id"); stockTakeId != "" {
+		report, errStr := getStockTake(r.Context(), stockTakeId)
+		if errStr == utils.INVALID_STOCK_TAKE_ID {
+			httpx.RespWithError(w, http.StatusNotFound, errStr)
+			return
+		}
+		if errStr != utils.NO_ERR {
+			httpx.RespWithError(w, http.StatusInternalServerError, errStr)
+			return
+		}
+		httpx.RespWithData(w, http.StatusOK, report)
+		return
+	}
+
+	rows, err := db.ConnFrom(r.Context()).QueryContext(r.Context(), `
+		SELECT
+			id, date, remark, status, opened_by,
+			datetime(opened_at, 'unixepoch', 'localtime'),
+			COALESCE(approved_by, ''),
+			COALESCE(datetime(approved_at, 'unixepoch', 'localtime'), '')
+		FROM stock_take
+		ORDER BY opened_at DESC, id DESC`)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to query stock-takes", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.STOCK_TAKE_RETRIEVAL_ERR)
+		return
+	}
+	defer rows.Close()
+
+	stockTakes := []StockTake{}
+	for rows.Next() {
+		var s StockTake
+		if err := rows.Scan(&s.Id, &s.Date, &s.Remark, &s.Status, &s.OpenedBy, &s.OpenedAt, &s.ApprovedBy, &s.ApprovedAt); err != nil {
+			slog.ErrorContext(r.Context(), "failed to scan stock-take row", "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.STOCK_TAKE_RETRIEVAL_ERR)
+			return
+		}
+		stockTakes = append(stockTakes, s)
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"stock_takes": stockTakes,
+	})
+}
+
+// Gets a stock-take with its variance lines, ordered by compound name
+func getStockTake(ctx context.Context, stockTakeId string) (*StockTakeReport, utils.ErrorMessage) {
+	report := &StockTakeReport{Lines: []StockTakeLine{}}
+	err := db.ConnFrom(ctx).QueryRowContext(ctx, `
+		SELECT
+			id, date, remark, status, opened_by,
+			datetime(opened_at, 'unixepoch', 'localtime'),
+			COALESCE(approved_by, ''),
+			COALESCE(datetime(approved_at, 'unixepoch', 'localtime'), '')
+		FROM stock_take
+		WHERE id = ?`,
+		stockTakeId,
+	).Scan(&report.Id, &report.Date, &report.Remark, &report.Status, &report.OpenedBy, &report.OpenedAt, &report.ApprovedBy, &report.ApprovedAt)
+	if err == sql.ErrNoRows {
+		slog.ErrorContext(ctx, "stock-take not found", "stock_take_id", stockTakeId)
+		return nil, utils.INVALID_STOCK_TAKE_ID
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to query stock-take", "stock_take_id", stockTakeId, "error", err)
+		return nil, utils.STOCK_TAKE_RETRIEVAL_ERR
+	}
+
+	countDate, err := time.ParseInLocation("2006-01-02", report.Date, time.Local)
+	if err != nil {
+		slog.ErrorContext(ctx, "invalid stock-take date", "stock_take_id", stockTakeId, "date", report.Date, "error", err)
+		return nil, utils.STOCK_TAKE_RETRIEVAL_ERR
+	}
+
+	rows, err := db.ConnFrom(ctx).QueryContext(ctx, `
+		SELECT
+			c.id, c.name, c.scale,
+			COALESCE(s.ledger_stock, (
+				SELECT e.net_stock
+				FROM entry e
+				WHERE e.compound_id = s.compound_id AND e.date < ? AND e.deleted_at IS NULL
+				ORDER BY e.date DESC, e.seq DESC
+				LIMIT 1
+			), 0),
+			s.counted_quantity,
+			s.counted_by,
+			datetime(s.counted_at, 'unixepoch', 'localtime'),
+			COALESCE(s.adjustment_entry_id, '')
+		FROM stock_take_count s
+		JOIN compound c ON s.compound_id = c.id
+		WHERE s.stock_take_id = ?
+		ORDER BY c.lower_case_name ASC`,
+		countDate.AddDate(0, 0, 1).Unix(), stockTakeId,
+	)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to query stock-take counts", "stock_take_id", stockTakeId, "error", err)
+		return nil, utils.STOCK_TAKE_RETRIEVAL_ERR
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var l StockTakeLine
+		if err := rows.Scan(&l.CompoundId, &l.Name, &l.Scale, &l.LedgerStock, &l.CountedQuantity, &l.CountedBy, &l.CountedAt, &l.AdjustmentEntryId); err != nil {
+			slog.ErrorContext(ctx, "failed to scan stock-take count row", "stock_take_id", stockTakeId, "error", err)
+			return nil, utils.STOCK_TAKE_RETRIEVAL_ERR
+		}
+		l.Variance = l.CountedQuantity - l.LedgerStock
+		report.Lines = append(report.Lines, l)
+	}
+	if err := rows.Err(); err != nil {
+		slog.ErrorContext(ctx, "failed to read stock-take counts", "stock_take_id", stockTakeId, "error", err)
+		return nil, utils.STOCK_TAKE_RETRIEVAL_ERR
+	}
+
+	return report, utils.NO_ERR
+}
@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/datetime"
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/export"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/stock"
+	"chemical-ledger-backend/utils"
+	"context"
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type GetStockReq struct {
+	AsOf         string `json:"asOf"`
+	DisplayUnits bool   `json:"display_units"`
+	LocationId   string `json:"location_id"`
+	Format       string `json:"format"`
+}
+
+// Gets the stock of every compound at the end of the given day, i.e. the net stock of its last entry on or before it.
+// With "location_id", the stock kept at that location instead, along with the last entry that moved it. Either way
+// along with what is reserved and on order of the compound now, as reservations and purchase orders are not dated
+// back, and what is available of the stock after the reservations. With an export "format", the stock comes as a
+// file, e.g. to print for a stock-take.
+func GetStockHandler(w http.ResponseWriter, r *http.Request) {
+	reqBody := &GetStockReq{
+		AsOf:       httpx.GetParam(r, "asOf"),
+		LocationId: httpx.GetParam(r, "location_id"),
+		Format:     httpx.GetParam(r, "format"),
+	}
+	reqBody.DisplayUnits, _ = strconv.ParseBool(httpx.GetParam(r, "display_units"))
+	if errStr := validateExportFormat(r.Context(), reqBody.Format); errStr != utils.NO_ERR {
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	if reqBody.AsOf == "" {
+		reqBody.AsOf = datetime.Now(r.Context()).Format("2006-01-02")
+	}
+
+	asOf, err := time.ParseInLocation("2006-01-02", reqBody.AsOf, time.Local)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "invalid asOf format", "asOf", reqBody.AsOf, "error", err)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.INVALID_DATE_FORMAT)
+		return
+	}
+
+	if reqBody.LocationId != "" {
+		if errStr := validateLocationIdField(r.Context(), reqBody.LocationId); errStr != utils.NO_ERR {
+			httpx.RespWithError(w, http.StatusBadRequest, errStr)
+			return
+		}
+	}
+
+	// Nothing can be dated after today, so the stock at the end of today or later is the current stock
+	var rows *sql.Rows
+	if reqBody.LocationId != "" {
+		rows, err = queryLocationStock(r.Context(), reqBody.LocationId, asOf, reqBody.AsOf >= datetime.Now(r.Context()).Format("2006-01-02"))
+	} else if reqBody.AsOf >= datetime.Now(r.Context()).Format("2006-01-02") {
+		rows, err = db.ConnFrom(r.Context()).QueryContext(r.Context(), `
+			SELECT
+				c.id, c.name, c.scale,
+				COALESCE(s.balance, 0),
+				COALESCE(datetime(s.last_entry_at, 'unixepoch', 'localtime'), '')
+			FROM compound c
+			LEFT JOIN stock_current s ON s.compound_id = c.id
+			ORDER BY c.lower_case_name ASC`)
+	} else {
+		rows, err = queryStockAsOf(r.Context(), asOf)
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to query stock as of date", "asOf", reqBody.AsOf, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.STOCK_RETRIEVAL_ERR)
+		return
+	}
+	defer rows.Close()
+
+	type Stock struct {
+		CompoundId  string `json:"compound_id"`
+		Name        string `json:"name"`
+		Scale       string `json:"scale"`
+		NetStock    int    `json:"net_stock"`
+		LastEntryAt string `json:"last_entry_at"`
+		// Ordered on open and partially received purchase orders but not received yet
+		OnOrder int `json:"on_order"`
+		// Held by reservations for today or later, and what of the stock is left to reserve after them
+		Reserved  int `json:"reserved"`
+		Available int `json:"available"`
+		// With "display_units", the stock in the display unit of the compound, when it has one
+		DisplayUnit      string   `json:"display_unit,omitempty"`
+		DisplayNetStock  *float64 `json:"display_net_stock,omitempty"`
+		DisplayOnOrder   *float64 `json:"display_on_order,omitempty"`
+		DisplayReserved  *float64 `json:"display_reserved,omitempty"`
+		DisplayAvailable *float64 `json:"display_available,omitempty"`
+	}
+
+	onOrder, err := stock.OnOrder(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to retrieve quantities on order", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.PURCHASE_ORDER_RETRIEVAL_ERR)
+		return
+	}
+
+	reserved, err := stock.Reserved(r.Context(), datetime.Now(r.Context()).Format("2006-01-02"))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to retrieve reserved quantities", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.RESERVATION_RETRIEVAL_ERR)
+		return
+	}
+
+	displayUnits := map[string]utils.CompoundUnits{}
+	if reqBody.DisplayUnits {
+		if displayUnits, err = utils.GetDisplayUnits(r.Context()); err != nil {
+			slog.ErrorContext(r.Context(), "failed to retrieve display units", "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.UNIT_RETRIEVAL_ERR)
+			return
+		}
+	}
+
+	stock := []Stock{}
+	for rows.Next() {
+		var s Stock
+		if err := rows.Scan(&s.CompoundId, &s.Name, &s.Scale, &s.NetStock, &s.LastEntryAt); err != nil {
+			slog.ErrorContext(r.Context(), "failed to scan stock row", "asOf", reqBody.AsOf, "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.STOCK_RETRIEVAL_ERR)
+			return
+		}
+		s.OnOrder, s.Reserved = onOrder[s.CompoundId], reserved[s.CompoundId]
+		// Stock drawn after it was reserved can leave less than the reservations hold, of which nothing is available
+		s.Available = max(s.NetStock-s.Reserved, 0)
+		if units, ok := displayUnits[s.CompoundId]; ok {
+			netStock := utils.ConvertFromScale(s.NetStock, &units.Scale, &units.Display)
+			s.DisplayUnit, s.DisplayNetStock = units.Display.Name, &netStock
+			if s.OnOrder > 0 {
+				onOrder := utils.ConvertFromScale(s.OnOrder, &units.Scale, &units.Display)
+				s.DisplayOnOrder = &onOrder
+			}
+			if s.Reserved > 0 {
+				reserved := utils.ConvertFromScale(s.Reserved, &units.Scale, &units.Display)
+				available := utils.ConvertFromScale(s.Available, &units.Scale, &units.Display)
+				s.DisplayReserved, s.DisplayAvailable = &reserved, &available
+			}
+		}
+		stock = append(stock, s)
+	}
+
+	if isExportFormat(reqBody.Format) {
+		writeRedactedExport(w, r, reqBody.Format, stock, func(stock []Stock) *export.Document {
+			table := export.Table{
+				Name:    "Stock",
+				Columns: []string{"Compound", "Net stock", "Scale", "Reserved", "Available", "On order", "Last entry", "Display unit", "Net stock in display unit"},
+			}
+			for _, s := range stock {
+				table.AddRow(s.Name, s.NetStock, s.Scale, s.Reserved, s.Available, s.OnOrder, s.LastEntryAt, s.DisplayUnit, optionalCell(s.DisplayNetStock))
+			}
+			return &export.Document{
+				Name:   "stock-" + reqBody.AsOf,
+				Title:  "Stock as of " + reqBody.AsOf,
+				Tables: []export.Table{table},
+			}
+		})
+		return
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"as_of": reqBody.AsOf,
+		"stock": stock,
+	})
+}
+
+// Queries the stock of every compound at the end of the given day from the entries up to it
+func queryStockAsOf(ctx context.Context, asOf time.Time) (*sql.Rows, error) {
+	return db.ConnFrom(ctx).QueryContext(ctx, `
+		WITH latest AS (
+			SELECT
+				e.compound_id,
+				e.net_stock,
+				e.date,
+				ROW_NUMBER() OVER (PARTITION BY e.compound_id ORDER BY e.date DESC, e.seq DESC) AS recency
+			FROM entry e
+			WHERE e.date < ? AND e.deleted_at IS NULL
+		)
+		SELECT
+			c.id, c.name, c.scale,
+			COALESCE(l.net_stock, 0),
+			COALESCE(datetime(l.date, 'unixepoch', 'localtime'), '')
+		FROM compound c
+		LEFT JOIN latest l ON l.compound_id = c.id AND l.recency = 1
+		ORDER BY c.lower_case_name ASC`,
+		asOf.AddDate(0, 0, 1).Unix(),
+	)
+}
+
+// Queries the stock of every compound at a location, currently or at the end of the given day
+func queryLocationStock(ctx context.Context, locationId string, asOf time.Time, current bool) (*sql.Rows, error) {
+	// The current stock is tracked per location, only the date of the last entry is looked up
+	if current {
+		return db.ConnFrom(ctx).QueryContext(ctx, `
+			SELECT
+				c.id, c.name, c.scale,
+				COALESCE(s.balance, 0),
+				COALESCE((
+					SELECT datetime(MAX(e.date), 'unixepoch', 'localtime') FROM entry e
+					WHERE e.compound_id = c.id AND (e.location_id = ? OR e.to_location_id = ?)
+						AND e.status = ? AND e.deleted_at IS NULL
+				), '')
+			FROM compound c
+			LEFT JOIN stock_location s ON s.compound_id = c.id AND s.location_id = ?
+			ORDER BY c.lower_case_name ASC`,
+			locationId, locationId, utils.ENTRY_STATUS_APPROVED, locationId,
+		)
+	}
+
+	moves, args := stock.LocationMovesQuery("AND e.date < ?", asOf.AddDate(0, 0, 1).Unix())
+	return db.ConnFrom(ctx).QueryContext(ctx, `
+		SELECT
+			c.id, c.name, c.scale,
+			COALESCE(SUM(m.quantity), 0),
+			COALESCE(datetime(MAX(m.date), 'unixepoch', 'localtime'), '')
+		FROM compound c
+		LEFT JOIN (`+moves+`) m ON m.compound_id = c.id AND m.location_id = ?
+		GROUP BY c.id
+		ORDER BY c.lower_case_name ASC`,
+		append(args, locationId)...,
+	)
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"log/slog"
+	"net/http"
+)
+
+func GetSupplierHandler(w http.ResponseWriter, r *http.Request) {
+	rows, err := db.ConnFrom(r.Context()).QueryContext(r.Context(), `
+		SELECT id, name, contact_person, phone, email, address
+		FROM supplier
+		ORDER BY lower_case_name ASC
+	`)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to query suppliers", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.SUPPLIER_RETRIEVAL_ERR)
+		return
+	}
+	defer rows.Close()
+
+	type Supplier struct {
+		ID            string `json:"key"`
+		Name          string `json:"name"`
+		ContactPerson string `json:"contact_person"`
+		Phone         string `json:"phone"`
+		Email         string `json:"email"`
+		Address       string `json:"address"`
+	}
+
+	suppliers := []Supplier{}
+	for rows.Next() {
+		var supplier Supplier
+		if err := rows.Scan(&supplier.ID, &supplier.Name, &supplier.ContactPerson, &supplier.Phone, &supplier.Email, &supplier.Address); err != nil {
+			slog.ErrorContext(r.Context(), "failed to scan supplier row", "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.SUPPLIER_RETRIEVAL_ERR)
+			return
+		}
+		suppliers = append(suppliers, supplier)
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"suppliers": suppliers,
+	})
+}
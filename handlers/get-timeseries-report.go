@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/export"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"fmt"
+	"log/slog"
+	"net/http"
+)
+
+type GetTimeseriesReportReq struct {
+	CompoundId string `json:"compound_id"`
+	Interval   string `json:"interval"`
+	From       string `json:"from"`
+	To         string `json:"to"`
+	Format     string `json:"format"`
+}
+
+// Buckets of the timeseries report, each with the expression grouping the entries into it. Days and weeks are
+// named by the date they start on, weeks starting on Monday, and months as YYYY-MM.
+const (
+	INTERVAL_DAY   = "day"
+	INTERVAL_WEEK  = "week"
+	INTERVAL_MONTH = "month"
+)
+
+var timeseriesBuckets = map[string]string{
+	INTERVAL_DAY:   "date(e.date, 'unixepoch', 'localtime')",
+	INTERVAL_WEEK:  "date(e.date, 'unixepoch', 'localtime', 'weekday 0', '-6 days')",
+	INTERVAL_MONTH: "strftime('%Y-%m', e.date, 'unixepoch', 'localtime')",
+}
+
+// Totals the approved incoming and outgoing quantities of a compound per day, week or month, for consumption charts.
+// Adjustments are totalled apart, and buckets without entries are left out. With an export "format", the buckets come
+// as a file to chart elsewhere.
+func GetTimeseriesReportHandler(w http.ResponseWriter, r *http.Request) {
+	reqBody := &GetTimeseriesReportReq{
+		CompoundId: httpx.GetParam(r, "compound_id"),
+		Interval:   httpx.GetParam(r, "interval"),
+		From:       httpx.GetParam(r, "from"),
+		To:         httpx.GetParam(r, "to"),
+		Format:     httpx.GetParam(r, "format"),
+	}
+
+	if errStr := validateExportFormat(r.Context(), reqBody.Format); errStr != utils.NO_ERR {
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+	if reqBody.Interval == "" {
+		reqBody.Interval = INTERVAL_DAY
+	}
+
+	bucketExpr, ok := timeseriesBuckets[reqBody.Interval]
+	if !ok {
+		slog.ErrorContext(r.Context(), "invalid timeseries interval", "interval", reqBody.Interval)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.INVALID_INTERVAL)
+		return
+	}
+
+	if reqBody.CompoundId == "" {
+		slog.ErrorContext(r.Context(), "missing required fields", "compound_id", reqBody.CompoundId)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.MISSING_REQUIRED_FIELDS)
+		return
+	}
+	compoundExists, err := utils.CheckIfCompoundExists(r.Context(), reqBody.CompoundId)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error checking if compound exists", "compound_id", reqBody.CompoundId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.COMPOUND_ID_CHECK_ERR)
+		return
+	}
+	if !compoundExists {
+		slog.ErrorContext(r.Context(), "compound not found", "compound_id", reqBody.CompoundId)
+		httpx.RespWithError(w, http.StatusNotFound, utils.INVALID_COMPOUND_ID)
+		return
+	}
+
+	fromUnix, toUnix, errStr := parseReportRange(r.Context(), reqBody.From, reqBody.To)
+	if errStr != utils.NO_ERR {
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	rows, err := db.ConnFrom(r.Context()).QueryContext(r.Context(), `
+		SELECT
+			`+bucketExpr+` AS bucket,
+			SUM(CASE WHEN e.type = ? THEN q.total_quantity ELSE 0 END),
+			SUM(CASE WHEN e.type = ? THEN q.total_quantity ELSE 0 END),
+			SUM(CASE WHEN e.type = ? THEN q.total_quantity ELSE 0 END),
+			SUM(CASE WHEN e.type = ? THEN q.total_quantity ELSE 0 END),
+			SUM(CASE WHEN e.type = ? THEN q.total_quantity ELSE 0 END)
+		FROM entry e
+		JOIN quantity q ON e.quantity_id = q.id
+		WHERE e.compound_id = ? AND e.date >= ? AND e.date < ? AND e.status = ? AND e.deleted_at IS NULL
+		GROUP BY bucket
+		ORDER BY bucket ASC`,
+		utils.ENTRY_TYPE_INCOMING, utils.ENTRY_TYPE_OUTGOING, utils.ENTRY_TYPE_ADJUSTMENT_IN, utils.ENTRY_TYPE_ADJUSTMENT_OUT,
+		utils.ENTRY_TYPE_DISPOSAL, reqBody.CompoundId, fromUnix, toUnix, utils.ENTRY_STATUS_APPROVED,
+	)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to query timeseries report", "compound_id", reqBody.CompoundId, "interval", reqBody.Interval, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.REPORT_RETRIEVAL_ERR)
+		return
+	}
+	defer rows.Close()
+
+	type Bucket struct {
+		Period        string `json:"period"`
+		Incoming      int    `json:"incoming"`
+		Outgoing      int    `json:"outgoing"`
+		AdjustmentIn  int    `json:"adjustment_in"`
+		AdjustmentOut int    `json:"adjustment_out"`
+		Disposed      int    `json:"disposed"`
+	}
+
+	buckets := []Bucket{}
+	for rows.Next() {
+		var b Bucket
+		if err := rows.Scan(&b.Period, &b.Incoming, &b.Outgoing, &b.AdjustmentIn, &b.AdjustmentOut, &b.Disposed); err != nil {
+			slog.ErrorContext(r.Context(), "failed to scan timeseries row", "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.REPORT_RETRIEVAL_ERR)
+			return
+		}
+		buckets = append(buckets, b)
+	}
+
+	if isExportFormat(reqBody.Format) {
+		writeRedactedExport(w, r, reqBody.Format, buckets, func(buckets []Bucket) *export.Document {
+			table := export.Table{
+				Name:    "Timeseries",
+				Columns: []string{"Period", "Incoming", "Outgoing", "Adjustment in", "Adjustment out", "Disposed"},
+			}
+			for _, b := range buckets {
+				table.AddRow(b.Period, b.Incoming, b.Outgoing, b.AdjustmentIn, b.AdjustmentOut, b.Disposed)
+			}
+			return &export.Document{
+				Name:   exportName(r.Context(), "timeseries-"+reqBody.CompoundId),
+				Title:  fmt.Sprintf("Movements of %s per %s", reqBody.CompoundId, reqBody.Interval),
+				Tables: []export.Table{table},
+			}
+		})
+		return
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"compound_id": reqBody.CompoundId,
+		"interval":    reqBody.Interval,
+		"buckets":     buckets,
+	})
+}
@@ -0,0 +1,55 @@
+package handlers_test
+
+import (
+	"chemical-ledger-backend/handlers"
+	"chemical-ledger-backend/testutils"
+	"chemical-ledger-backend/utils"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimeseriesTotalsPerInterval(t *testing.T) {
+	t.Parallel()
+	env := testutils.NewEnv(t, time.Date(2026, 3, 20, 10, 0, 0, 0, time.Local))
+
+	env.InsertCompound("C_1", "Acetone", "ml")
+	// 2026-03-08 is a Sunday, the rest of the entries fall in the week starting on Monday 2026-03-09
+	for _, entry := range []struct {
+		entryType, date string
+		quantity        int
+	}{
+		{utils.ENTRY_TYPE_INCOMING, "2026-02-27", 1000},
+		{utils.ENTRY_TYPE_OUTGOING, "2026-03-08", 100},
+		{utils.ENTRY_TYPE_OUTGOING, "2026-03-09", 200},
+		{utils.ENTRY_TYPE_OUTGOING, "2026-03-09", 50},
+		{utils.ENTRY_TYPE_INCOMING, "2026-03-15", 25},
+	} {
+		if w := insertEntry(env, entry.entryType, "C_1", entry.date, entry.quantity); w.Code != http.StatusOK {
+			t.Fatalf("entry of %s: status %d, %s", entry.date, w.Code, w.Body)
+		}
+	}
+
+	get := func(params string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handlers.GetTimeseriesReportHandler(w, env.Request(http.MethodGet, "/report/timeseries?compound_id=C_1&"+params, nil))
+		return w
+	}
+
+	for params, want := range map[string]string{
+		"interval=day&from=2026-03-09": `[{"period":"2026-03-09","incoming":0,"outgoing":250,"adjustment_in":0,"adjustment_out":0,"disposed":0},{"period":"2026-03-15","incoming":25,"outgoing":0,"adjustment_in":0,"adjustment_out":0,"disposed":0}]`,
+		"interval=week&to=2026-03-14":  `[{"period":"2026-02-23","incoming":1000,"outgoing":0,"adjustment_in":0,"adjustment_out":0,"disposed":0},{"period":"2026-03-02","incoming":0,"outgoing":100,"adjustment_in":0,"adjustment_out":0,"disposed":0},{"period":"2026-03-09","incoming":0,"outgoing":250,"adjustment_in":0,"adjustment_out":0,"disposed":0}]`,
+		"interval=month":               `[{"period":"2026-02","incoming":1000,"outgoing":0,"adjustment_in":0,"adjustment_out":0,"disposed":0},{"period":"2026-03","incoming":25,"outgoing":350,"adjustment_in":0,"adjustment_out":0,"disposed":0}]`,
+	} {
+		w := get(params)
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"buckets":`+want) {
+			t.Errorf("%s: status %d, want buckets %s in %s", params, w.Code, want, w.Body)
+		}
+	}
+
+	if w := get("interval=year"); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid interval: status %d, %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/export"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"log/slog"
+	"net/http"
+)
+
+// Compounds the top consumers report lists by default, and at most
+const (
+	DEFAULT_TOP_CONSUMERS_LIMIT = 10
+	MAX_TOP_CONSUMERS_LIMIT     = 100
+)
+
+type GetTopConsumersReportReq struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Limit  int    `json:"limit"`
+	Format string `json:"format"`
+}
+
+// Lists the "limit" compounds of which the most was issued, most first, from the approved outgoing entries between
+// "from" and "to" (YYYY-MM-DD, both optional). Any export "format" downloads the ranking.
+func GetTopConsumersReportHandler(w http.ResponseWriter, r *http.Request) {
+	reqBody := &GetTopConsumersReportReq{
+		From:   httpx.GetParam(r, "from"),
+		To:     httpx.GetParam(r, "to"),
+		Format: httpx.GetParam(r, "format"),
+	}
+
+	if errStr := validateExportFormat(r.Context(), reqBody.Format); errStr != utils.NO_ERR {
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	limit, err := httpx.GetIntParam(r, "limit")
+	if err != nil || limit < 0 || limit > MAX_TOP_CONSUMERS_LIMIT {
+		slog.ErrorContext(r.Context(), "invalid top consumers limit", "limit", httpx.GetParam(r, "limit"), "error", err)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.INVALID_REPORT_LIMIT)
+		return
+	}
+	if limit == 0 {
+		limit = DEFAULT_TOP_CONSUMERS_LIMIT
+	}
+	reqBody.Limit = limit
+
+	fromUnix, toUnix, errStr := parseReportRange(r.Context(), reqBody.From, reqBody.To)
+	if errStr != utils.NO_ERR {
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	compounds, err := getTopConsumedCompounds(r.Context(), fromUnix, toUnix, reqBody.Limit)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get top consumers", "from", reqBody.From, "to", reqBody.To, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.REPORT_RETRIEVAL_ERR)
+		return
+	}
+
+	if isExportFormat(reqBody.Format) {
+		writeRedactedExport(w, r, reqBody.Format, compounds, func(compounds []DashboardCompound) *export.Document {
+			table := export.Table{
+				Name:    "Top consumers",
+				Columns: []string{"Rank", "Compound", "Issued", "Scale"},
+			}
+			for i, c := range compounds {
+				table.AddRow(i+1, c.Name, c.Quantity, c.Scale)
+			}
+			return &export.Document{
+				Name:   exportName(r.Context(), "top-consumers"),
+				Title:  "Most issued compounds",
+				Tables: []export.Table{table},
+			}
+		})
+		return
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"compounds": compounds,
+	})
+}
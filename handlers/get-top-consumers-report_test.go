@@ -0,0 +1,76 @@
+package handlers_test
+
+import (
+	"chemical-ledger-backend/handlers"
+	"chemical-ledger-backend/testutils"
+	"chemical-ledger-backend/utils"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTopConsumersAndSlowMovers(t *testing.T) {
+	t.Parallel()
+	env := testutils.NewEnv(t, time.Date(2026, 6, 1, 10, 0, 0, 0, time.Local))
+
+	env.InsertCompound("C_1", "Acetone", "ml")
+	env.InsertCompound("C_2", "Benzene", "ml")
+	env.InsertCompound("C_3", "Chloroform", "ml")
+	env.InsertCompound("C_4", "Dioxane", "ml")
+	for _, entry := range []struct {
+		entryType, compoundId, date string
+		quantity                    int
+	}{
+		{utils.ENTRY_TYPE_INCOMING, "C_1", "2026-01-10", 1000},
+		{utils.ENTRY_TYPE_OUTGOING, "C_1", "2026-02-01", 100},
+		{utils.ENTRY_TYPE_INCOMING, "C_2", "2026-05-20", 500},
+		{utils.ENTRY_TYPE_OUTGOING, "C_2", "2026-05-25", 300},
+		{utils.ENTRY_TYPE_INCOMING, "C_3", "2025-12-01", 250},
+		{utils.ENTRY_TYPE_INCOMING, "C_4", "2026-01-05", 50},
+		{utils.ENTRY_TYPE_OUTGOING, "C_4", "2026-01-06", 50},
+	} {
+		if w := insertEntry(env, entry.entryType, entry.compoundId, entry.date, entry.quantity); w.Code != http.StatusOK {
+			t.Fatalf("entry of %s on %s: status %d, %s", entry.compoundId, entry.date, w.Code, w.Body)
+		}
+	}
+
+	get := func(handler http.HandlerFunc, url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler(w, env.Request(http.MethodGet, url, nil))
+		return w
+	}
+
+	for url, want := range map[string]string{
+		"/report/top-consumers":                 `"compounds":[{"compound_id":"C_2","name":"Benzene","scale":"ml","quantity":300},{"compound_id":"C_1","name":"Acetone","scale":"ml","quantity":100},{"compound_id":"C_4","name":"Dioxane","scale":"ml","quantity":50}]`,
+		"/report/top-consumers?limit=1":         `"compounds":[{"compound_id":"C_2","name":"Benzene","scale":"ml","quantity":300}]`,
+		"/report/top-consumers?to=2026-03-01":   `"compounds":[{"compound_id":"C_1","name":"Acetone","scale":"ml","quantity":100},{"compound_id":"C_4","name":"Dioxane","scale":"ml","quantity":50}]`,
+		"/report/top-consumers?from=2026-07-01": `"compounds":[]`,
+	} {
+		if w := get(handlers.GetTopConsumersReportHandler, url); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), want) {
+			t.Errorf("%s: status %d, want %s in %s", url, w.Code, want, w.Body)
+		}
+	}
+
+	// Dioxane is used up and Benzene moved recently; Chloroform was never issued
+	want := `"compounds":[` +
+		`{"compound_id":"C_3","name":"Chloroform","scale":"ml","net_stock":250,"last_movement":"2025-12-01","last_issue":"","idle_days":182},` +
+		`{"compound_id":"C_1","name":"Acetone","scale":"ml","net_stock":900,"last_movement":"2026-02-01","last_issue":"2026-02-01","idle_days":120}]`
+	if w := get(handlers.GetSlowMoversReportHandler, "/report/slow-movers"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), want) {
+		t.Errorf("slow movers: status %d, want %s in %s", w.Code, want, w.Body)
+	}
+	if w := get(handlers.GetSlowMoversReportHandler, "/report/slow-movers?days=150"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"compounds":[{"compound_id":"C_3"`) || strings.Contains(w.Body.String(), `"C_1"`) {
+		t.Errorf("slow movers for 150 days: status %d, %s", w.Code, w.Body)
+	}
+
+	for _, url := range []string{"/report/top-consumers?limit=500", "/report/slow-movers?days=0", "/report/slow-movers?days=many"} {
+		handler := handlers.GetSlowMoversReportHandler
+		if strings.Contains(url, "top-consumers") {
+			handler = handlers.GetTopConsumersReportHandler
+		}
+		if w := get(handler, url); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, %s", url, w.Code, w.Body)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"log/slog"
+	"net/http"
+)
+
+// Lists the entries in the trash, most recently deleted first, optionally filtered by "compound_id"
+func GetTrashHandler(w http.ResponseWriter, r *http.Request) {
+	query := `
+		SELECT
+			e.id, e.type, datetime(e.date, 'unixepoch', 'localtime'), e.remark, e.voucher_no,
+			c.id, c.name, c.scale, q.total_quantity, e.status,
+			datetime(e.deleted_at, 'unixepoch', 'localtime'), COALESCE(e.deleted_by, '')
+		FROM entry e
+		JOIN compound c ON e.compound_id = c.id
+		JOIN quantity q ON e.quantity_id = q.id
+		WHERE e.deleted_at IS NOT NULL`
+	args := []any{}
+	if compoundId := httpx.GetParam(r, "compound_id"); compoundId != "" {
+		query += " AND e.compound_id = ?"
+		args = append(args, compoundId)
+	}
+	query += " ORDER BY e.deleted_at DESC, e.id DESC"
+
+	rows, err := db.ConnFrom(r.Context()).QueryContext(r.Context(), query, args...)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to query deleted entries", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.ENTRY_RETRIEVAL_ERR)
+		return
+	}
+	defer rows.Close()
+
+	type DeletedEntry struct {
+		Id         string `json:"id"`
+		Type       string `json:"type"`
+		Date       string `json:"date"`
+		Remark     string `json:"remark"`
+		VoucherNo  string `json:"voucher_no"`
+		CompoundId string `json:"compound_id"`
+		Name       string `json:"name"`
+		Scale      string `json:"scale"`
+		Quantity   int    `json:"quantity"`
+		Status     string `json:"status"`
+		DeletedAt  string `json:"deleted_at"`
+		DeletedBy  string `json:"deleted_by"`
+	}
+
+	entries := []DeletedEntry{}
+	for rows.Next() {
+		var e DeletedEntry
+		if err := rows.Scan(
+			&e.Id, &e.Type, &e.Date, &e.Remark, &e.VoucherNo,
+			&e.CompoundId, &e.Name, &e.Scale, &e.Quantity, &e.Status,
+			&e.DeletedAt, &e.DeletedBy); err != nil {
+			slog.ErrorContext(r.Context(), "failed to scan deleted entry row", "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.ENTRY_RETRIEVAL_ERR)
+			return
+		}
+		entries = append(entries, e)
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"trash": entries,
+	})
+}
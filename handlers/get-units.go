@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"log/slog"
+	"net/http"
+)
+
+// Lists the units quantities can be given in and compounds measured or shown in, by kind and then from the
+// smallest. One of a unit is "multiplier"/"divisor" of the base unit of its kind, e.g. 1000/1 (g) for kg.
+func GetUnitsHandler(w http.ResponseWriter, r *http.Request) {
+	units, err := utils.GetQuantityUnits(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to retrieve units", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.UNIT_RETRIEVAL_ERR)
+		return
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"units": units,
+	})
+}
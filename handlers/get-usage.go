@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"cmp"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Counts every routed request in the usage metrics, by endpoint, query parameters and the role of the user
+func UsageMetricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+
+		// The route pattern is only known once chi has routed the request
+		routeCtx := chi.RouteContext(r.Context())
+		if routeCtx == nil || routeCtx.RoutePattern() == "" {
+			return
+		}
+		utils.RecordUsage(r.Context(), r.Method+" "+routeCtx.RoutePattern(), currentUser(r).Role, r.URL.Query())
+	})
+}
+
+type GetUsageReq struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Role     string `json:"role"`
+	Endpoint string `json:"endpoint"`
+}
+
+// Usage of an endpoint, or of one of its query parameters when "feature" is set
+type FeatureUsage struct {
+	Endpoint string         `json:"endpoint"`
+	Feature  string         `json:"feature"`
+	Calls    int            `json:"calls"`
+	ByRole   map[string]int `json:"by_role"`
+	ByDay    map[string]int `json:"by_day"`
+}
+
+// Reports how often each endpoint and query parameter was used, most used first, split by role and by day.
+// Optionally limited to the days from "from" to "to" (YYYY-MM-DD), one "role" and one "endpoint".
+func GetUsageHandler(w http.ResponseWriter, r *http.Request) {
+	reqBody := &GetUsageReq{
+		From:     httpx.GetParam(r, "from"),
+		To:       httpx.GetParam(r, "to"),
+		Role:     httpx.GetParam(r, "role"),
+		Endpoint: httpx.GetParam(r, "endpoint"),
+	}
+
+	query := "SELECT endpoint, feature, day, role, count FROM usage_metric WHERE 1 = 1"
+	args := []any{}
+	for _, bound := range []struct{ value, condition string }{{reqBody.From, " AND day >= ?"}, {reqBody.To, " AND day <= ?"}} {
+		if bound.value == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", bound.value); err != nil {
+			slog.ErrorContext(r.Context(), "invalid usage date", "date", bound.value, "error", err)
+			httpx.RespWithError(w, http.StatusBadRequest, utils.INVALID_DATE_FORMAT)
+			return
+		}
+		query += bound.condition
+		args = append(args, bound.value)
+	}
+	if reqBody.Role != "" {
+		query += " AND role = ?"
+		args = append(args, reqBody.Role)
+	}
+	if reqBody.Endpoint != "" {
+		query += " AND endpoint = ?"
+		args = append(args, reqBody.Endpoint)
+	}
+
+	// Include what was counted since the last scheduled flush
+	if err := utils.FlushUsage(r.Context()); err != nil {
+		slog.WarnContext(r.Context(), "failed to flush usage metrics", "error", err)
+	}
+
+	rows, err := db.ConnFrom(r.Context()).QueryContext(r.Context(), query, args...)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to query usage metrics", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.USAGE_RETRIEVAL_ERR)
+		return
+	}
+	defer rows.Close()
+
+	usageByFeature := map[[2]string]*FeatureUsage{}
+	for rows.Next() {
+		var endpoint, feature, day, role string
+		var count int
+		if err := rows.Scan(&endpoint, &feature, &day, &role, &count); err != nil {
+			slog.ErrorContext(r.Context(), "failed to scan usage row", "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.USAGE_RETRIEVAL_ERR)
+			return
+		}
+
+		key := [2]string{endpoint, feature}
+		usage, ok := usageByFeature[key]
+		if !ok {
+			usage = &FeatureUsage{Endpoint: endpoint, Feature: feature, ByRole: map[string]int{}, ByDay: map[string]int{}}
+			usageByFeature[key] = usage
+		}
+		usage.Calls += count
+		usage.ByRole[role] += count
+		usage.ByDay[day] += count
+	}
+
+	usage := []*FeatureUsage{}
+	for _, u := range usageByFeature {
+		usage = append(usage, u)
+	}
+	slices.SortFunc(usage, func(a, b *FeatureUsage) int {
+		return cmp.Or(cmp.Compare(b.Calls, a.Calls), cmp.Compare(a.Endpoint, b.Endpoint), cmp.Compare(a.Feature, b.Feature))
+	})
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"usage": usage,
+	})
+}
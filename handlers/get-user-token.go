@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"log/slog"
+	"net/http"
+)
+
+// Lists the tokens issued to "user_id" (all tokens when omitted), newest first, without the tokens themselves
+func GetUserTokenHandler(w http.ResponseWriter, r *http.Request) {
+	userId := httpx.GetParam(r, "user_id")
+
+	query := `
+		SELECT
+			t.id, t.user_id, u.name, t.label, t.created_by,
+			datetime(t.created_at, 'unixepoch', 'localtime'),
+			COALESCE(t.revoked_by, ''), COALESCE(datetime(t.revoked_at, 'unixepoch', 'localtime'), '')
+		FROM user_token t
+		JOIN user u ON t.user_id = u.id`
+	args := []any{}
+	if userId != "" {
+		query += " WHERE t.user_id = ?"
+		args = append(args, userId)
+	}
+	query += " ORDER BY t.created_at DESC, t.id DESC"
+
+	rows, err := db.ConnFrom(r.Context()).QueryContext(r.Context(), query, args...)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to query user tokens", "user_id", userId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.USER_TOKEN_RETRIEVAL_ERR)
+		return
+	}
+	defer rows.Close()
+
+	type UserToken struct {
+		Id        string `json:"id"`
+		UserId    string `json:"user_id"`
+		UserName  string `json:"user_name"`
+		Label     string `json:"label"`
+		CreatedBy string `json:"created_by"`
+		CreatedAt string `json:"created_at"`
+		RevokedBy string `json:"revoked_by"`
+		RevokedAt string `json:"revoked_at"`
+	}
+
+	tokens := []UserToken{}
+	for rows.Next() {
+		var t UserToken
+		if err := rows.Scan(&t.Id, &t.UserId, &t.UserName, &t.Label, &t.CreatedBy, &t.CreatedAt, &t.RevokedBy, &t.RevokedAt); err != nil {
+			slog.ErrorContext(r.Context(), "failed to scan user token row", "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.USER_TOKEN_RETRIEVAL_ERR)
+			return
+		}
+		tokens = append(tokens, t)
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"user_tokens": tokens,
+	})
+}
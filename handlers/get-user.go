@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/datetime"
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"log/slog"
+	"net/http"
+)
+
+// Lists the users by name. Users holding an active role grant are listed in the granted role, with their own
+// "base_role" and the time the grant expires.
+func GetUserHandler(w http.ResponseWriter, r *http.Request) {
+	rows, err := db.ConnFrom(r.Context()).QueryContext(r.Context(), `
+		SELECT
+			u.id, u.name, COALESCE(g.role, u.role), COALESCE(u.supervisor_id, ''), u.active,
+			CASE WHEN g.role IS NULL THEN '' ELSE u.role END,
+			COALESCE(datetime(g.expires_at, 'unixepoch', 'localtime'), '')
+		FROM user u
+		LEFT JOIN role_grant g ON g.id = (
+			SELECT id FROM role_grant
+			WHERE user_id = u.id AND revoked_at IS NULL AND expires_at > ?
+			ORDER BY granted_at DESC
+			LIMIT 1
+		)
+		ORDER BY u.name ASC
+	`, datetime.Now(r.Context()).Unix())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to query users", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.USER_RETRIEVAL_ERR)
+		return
+	}
+	defer rows.Close()
+
+	users := []utils.User{}
+	for rows.Next() {
+		var user utils.User
+		if err := rows.Scan(&user.Id, &user.Name, &user.Role, &user.SupervisorId, &user.Active, &user.BaseRole, &user.ElevatedUntil); err != nil {
+			slog.ErrorContext(r.Context(), "failed to scan user row", "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.USER_RETRIEVAL_ERR)
+			return
+		}
+		users = append(users, user)
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"users": users,
+	})
+}
+
+// Gets the user making the request
+func GetCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"user": currentUser(r),
+	})
+}
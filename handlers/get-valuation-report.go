@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/export"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/stock"
+	"chemical-ledger-backend/utils"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+)
+
+// Values the current stock of every compound, or of one with "compound_id", for the accounts department. "method"
+// is "average" or "fifo", by default the one set with VALUATION_METHOD, see stock.ValueStock. Export formats end the
+// compounds with a row of the total, as the accounts department files it.
+func GetValuationReportHandler(w http.ResponseWriter, r *http.Request) {
+	compoundId := httpx.GetParam(r, "compound_id")
+	method := httpx.GetParam(r, "method")
+	format := httpx.GetParam(r, "format")
+	if errStr := validateExportFormat(r.Context(), format); errStr != utils.NO_ERR {
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+	if method == "" {
+		method = utils.ValuationMethod()
+	}
+	if !utils.IsValidValuationMethod(method) {
+		slog.WarnContext(r.Context(), "invalid valuation method", "method", method)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.INVALID_VALUATION_METHOD)
+		return
+	}
+
+	valuations, err := stock.ValueStock(r.Context(), method, compoundId)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to value stock", "method", method, "compound_id", compoundId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.VALUATION_ERR)
+		return
+	}
+
+	total := 0.0
+	for _, v := range valuations {
+		total += v.Value
+	}
+	total = math.Round(total*100) / 100
+
+	if isExportFormat(format) {
+		writeRedactedExport(w, r, format, valuations, func(valuations []stock.CompoundValuation) *export.Document {
+			table := export.Table{
+				Name:    "Valuation",
+				Columns: []string{"Compound", "Quantity", "Scale", "Unit cost", "Value", "Uncosted quantity"},
+			}
+			for _, v := range valuations {
+				table.AddRow(v.Name, v.Quantity, v.Scale, v.UnitCost, v.Value, v.UncostedQuantity)
+			}
+			table.AddRow("Total", nil, nil, nil, total, nil)
+			return &export.Document{
+				Name:   exportName(r.Context(), "valuation"),
+				Title:  fmt.Sprintf("Stock valuation (%s)", method),
+				Tables: []export.Table{table},
+			}
+		})
+		return
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"method":      method,
+		"compounds":   valuations,
+		"total_value": total,
+	})
+}
@@ -0,0 +1,79 @@
+package handlers_test
+
+import (
+	"chemical-ledger-backend/handlers"
+	"chemical-ledger-backend/testutils"
+	"chemical-ledger-backend/utils"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The same stock is valued at the moving average cost or at the cost of the lots it is left in
+func TestStockValuationByAverageAndFifo(t *testing.T) {
+	t.Parallel()
+	env := testutils.NewEnv(t, time.Date(2026, 3, 14, 10, 0, 0, 0, time.Local))
+
+	env.InsertCompound("C_1", "Acetone", "ml")
+	deliver := func(date string, units int, unitCost string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handlers.InsertEntryHandler(w, env.Request(http.MethodPost, "/insert-entry", strings.NewReader(fmt.Sprintf(
+			`{"type": "incoming", "compound_id": "C_1", "date": %q, "num_of_units": %d, "quantity_per_unit": 500, "unit_cost": %s}`,
+			date, units, unitCost,
+		))))
+		return w
+	}
+	// 1000 ml at 0.10 per ml, 500 issued, then 1000 ml at 0.16 per ml
+	for _, w := range []*httptest.ResponseRecorder{
+		deliver("2026-03-02", 2, "50"),
+		insertEntry(env, utils.ENTRY_TYPE_OUTGOING, "C_1", "2026-03-03", 500),
+		deliver("2026-03-04", 2, "80"),
+	} {
+		if w.Code != http.StatusOK {
+			t.Fatalf("entry: status %d, %s", w.Code, w.Body)
+		}
+	}
+	if w := insertEntry(env, utils.ENTRY_TYPE_OUTGOING, "C_1", "2026-03-05", 100); w.Code != http.StatusOK {
+		t.Fatalf("issue: status %d, %s", w.Code, w.Body)
+	}
+	body := `{"type": "outgoing", "compound_id": "C_1", "date": "2026-03-05", "num_of_units": 1, "quantity_per_unit": 100, "unit_cost": 5}`
+	w := httptest.NewRecorder()
+	handlers.InsertEntryHandler(w, env.Request(http.MethodPost, "/insert-entry", strings.NewReader(body)))
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), utils.UNIT_COST_ON_NON_INCOMING) {
+		t.Errorf("unit cost on an issue: status %d, %s", w.Code, w.Body)
+	}
+
+	valuation := func(method string) string {
+		w := httptest.NewRecorder()
+		handlers.GetValuationReportHandler(w, env.Request(http.MethodGet, "/report/valuation?method="+method, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("valuation by %s: status %d, %s", method, w.Code, w.Body)
+		}
+		return w.Body.String()
+	}
+	// 500 ml at 0.10 and 1000 ml at 0.16 average to 0.14 per ml, 1400 ml are left
+	if body := valuation(utils.VALUATION_AVERAGE); !strings.Contains(body, `"quantity":1400,"unit_cost":0.14,"value":196,"uncosted_quantity":0`) {
+		t.Errorf("average valuation: %s", body)
+	}
+	// The last issue draws on the 400 ml left of the first lot: the 1000 ml of the second are left at 0.16 and 400 ml at 0.10
+	if body := valuation(utils.VALUATION_FIFO); !strings.Contains(body, `"quantity":1400,"unit_cost":0.1429,"value":200,"uncosted_quantity":0`) {
+		t.Errorf("fifo valuation: %s", body)
+	}
+
+	// Exports end with the total
+	w = httptest.NewRecorder()
+	handlers.GetValuationReportHandler(w, env.Request(http.MethodGet, "/report/valuation?method=average&format=csv", nil))
+	want := "Compound,Quantity,Scale,Unit cost,Value,Uncosted quantity\nAcetone,1400,ml,0.14,196,0\nTotal,,,,196,\n"
+	if w.Code != http.StatusOK || w.Body.String() != want || !strings.Contains(w.Header().Get("Content-Disposition"), "valuation-2026-03-14.csv") {
+		t.Errorf("valuation export: status %d, %q, %s", w.Code, w.Body, w.Header().Get("Content-Disposition"))
+	}
+
+	w = httptest.NewRecorder()
+	handlers.GetValuationReportHandler(w, env.Request(http.MethodGet, "/report/valuation?method=lifo", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("unknown method: status %d, %s", w.Code, w.Body)
+	}
+}
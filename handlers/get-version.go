@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"log/slog"
+	"net/http"
+)
+
+type Version struct {
+	utils.BuildInfo
+	// Schema version of the database itself, behind SchemaVersion when migrating it failed
+	DatabaseSchemaVersion int `json:"database_schema_version"`
+}
+
+// Reports which build is running: its commit, build date and Go version, the schema version it migrates to and the
+// one the database is on, and the features switched on, so support can tell what a school is running
+func GetVersionHandler(w http.ResponseWriter, r *http.Request) {
+	version := Version{BuildInfo: utils.GetBuildInfo()}
+
+	var err error
+	if version.DatabaseSchemaVersion, err = db.GetSchemaVersion(r.Context(), db.ConnFrom(r.Context())); err != nil {
+		slog.ErrorContext(r.Context(), "failed to read database schema version", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.SCHEMA_VERSION_ERR)
+		return
+	}
+
+	httpx.RespWithData(w, http.StatusOK, version)
+}
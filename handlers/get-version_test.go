@@ -0,0 +1,48 @@
+package handlers_test
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/handlers"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/testutils"
+	"chemical-ledger-backend/utils"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVersionNamesBuildAndSchema(t *testing.T) {
+	env := testutils.NewEnv(t, time.Date(2026, 3, 14, 10, 0, 0, 0, time.Local))
+	t.Setenv("DUPLICATE_VOUCHER_CHECK", "warn")
+
+	w := httptest.NewRecorder()
+	handlers.GetVersionHandler(w, env.Request(http.MethodGet, "/version", nil))
+	body := w.Body.String()
+	if w.Code != http.StatusOK || !strings.Contains(body, `"go_version":"go`) ||
+		!strings.Contains(body, fmt.Sprintf(`"schema_version":%d,`, db.SCHEMA_VERSION)) ||
+		!strings.Contains(body, fmt.Sprintf(`"database_schema_version":%d`, db.SCHEMA_VERSION)) ||
+		!strings.Contains(body, `"duplicate_voucher_check":"warn"`) {
+		t.Errorf("version: status %d, %s", w.Code, body)
+	}
+
+	// Server errors carry the build, in either envelope
+	failing := handlers.ResponseEnvelopeMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.REPORT_RETRIEVAL_ERR)
+	}))
+	for _, path := range []string{"/report/summary", handlers.LEGACY_ROUTE_PREFIX + "/report/summary"} {
+		w := httptest.NewRecorder()
+		failing.ServeHTTP(w, env.Request(http.MethodGet, path, nil))
+		if !strings.Contains(w.Body.String(), `"build":{"commit":`) {
+			t.Errorf("%s: %s", path, w.Body)
+		}
+	}
+	w = httptest.NewRecorder()
+	httpx.RespWithError(w, http.StatusBadRequest, utils.INVALID_DATE_FORMAT)
+	if strings.Contains(w.Body.String(), `"build"`) {
+		t.Errorf("client error: %s", w.Body)
+	}
+}
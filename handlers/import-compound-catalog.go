@@ -0,0 +1,382 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"context"
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// What importing a catalog row did: created a compound, filled in or overwrote the data of the compound with its CAS
+// number, found nothing to change, or skipped it as its CAS number was on an earlier row
+const (
+	CATALOG_ROW_CREATED   = "created"
+	CATALOG_ROW_UPDATED   = "updated"
+	CATALOG_ROW_UNCHANGED = "unchanged"
+	CATALOG_ROW_DUPLICATE = "duplicate"
+)
+
+// Names catalog columns are also known by, e.g. in ChemIDplus exports, keyed by the field they hold. Headers are
+// matched lower cased with spaces and dashes read as underscores.
+var catalogColumnNames = map[string][]string{
+	"cas_no":           {"cas_rn", "cas", "cas_no", "cas_number", "cas_registry_number"},
+	"name":             {"name", "substance_name", "chemical_name"},
+	"formula":          {"molecular_formula", "formula"},
+	"molecular_weight": {"molecular_weight", "mw"},
+	"hazard_class":     {"hazard_class"},
+	"unit":             {"unit", "scale"},
+}
+
+type CatalogImportResult struct {
+	Row        int    `json:"row"`
+	CasNo      string `json:"cas_no"`
+	CompoundId string `json:"compound_id,omitempty"`
+	Action     string `json:"action"`
+	// Of a duplicate, the row its CAS number was first on
+	DuplicateOf int `json:"duplicate_of,omitempty"`
+}
+
+type CatalogImportReport struct {
+	DryRun     bool                  `json:"dry_run"`
+	Rows       int                   `json:"rows"`
+	Created    int                   `json:"created"`
+	Updated    int                   `json:"updated"`
+	Unchanged  int                   `json:"unchanged"`
+	Duplicates int                   `json:"duplicates"`
+	Results    []CatalogImportResult `json:"results"`
+	Errors     []ImportRowError      `json:"errors"`
+}
+
+// A compound of the catalog as read from a row, or as already in the ledger
+type catalogCompound struct {
+	id, casNo, name, formula, hazardClass, unit string
+	molecularWeight                             *float64
+}
+
+// Imports a compound catalog (multipart field "file", CSV or xlsx with the columns of GetCompoundCatalogHandler),
+// deduplicated on CAS number. A row whose CAS number a compound already has fills in the formula, molecular weight
+// and hazard class that compound lacks, or replaces them with "overwrite=true"; a compound of the same name without
+// a CAS number takes the row's. Other rows create compounds in their "Unit", or the "scale" sent when the file has
+// none. Repeated CAS numbers are skipped as duplicates. Every row is validated before anything is written; with
+// "dry_run=true" the import is reported but not saved.
+func ImportCompoundCatalogHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, MAX_IMPORT_FILE_SIZE)
+	if err := r.ParseMultipartForm(MAX_IMPORT_FILE_SIZE); err != nil {
+		slog.ErrorContext(r.Context(), "failed to parse catalog upload", "error", err)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.INVALID_IMPORT_FILE)
+		return
+	}
+
+	file, fileHeader, err := r.FormFile("file")
+	if err != nil {
+		slog.ErrorContext(r.Context(), "catalog file missing", "error", err)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.INVALID_IMPORT_FILE)
+		return
+	}
+	defer file.Close()
+
+	dryRun, _ := strconv.ParseBool(r.FormValue("dry_run"))
+	overwrite, _ := strconv.ParseBool(r.FormValue("overwrite"))
+
+	defaultScale := ""
+	if scale := strings.TrimSpace(r.FormValue("scale")); scale != "" {
+		parsed, status, errStr := parseScale(r.Context(), scale)
+		if errStr != utils.NO_ERR {
+			httpx.RespWithError(w, status, errStr)
+			return
+		}
+		defaultScale = parsed
+	}
+
+	rows, err := readImportRows(file, fileHeader.Filename)
+	if err != nil || len(rows) == 0 {
+		slog.ErrorContext(r.Context(), "failed to read catalog file", "filename", fileHeader.Filename, "error", err)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.INVALID_IMPORT_FILE)
+		return
+	}
+
+	columns := mapCatalogColumns(rows[0])
+	if _, ok := columns["cas_no"]; !ok {
+		slog.ErrorContext(r.Context(), "catalog without a CAS column", "filename", fileHeader.Filename)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.INVALID_CATALOG_COLUMNS)
+		return
+	}
+	if _, ok := columns["name"]; !ok {
+		slog.ErrorContext(r.Context(), "catalog without a name column", "filename", fileHeader.Filename)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.INVALID_CATALOG_COLUMNS)
+		return
+	}
+
+	byCasNo, byName, err := getCatalogCompounds(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to load compounds for catalog import", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.COMPOUND_RETRIEVAL_ERR)
+		return
+	}
+
+	report := &CatalogImportReport{DryRun: dryRun, Results: []CatalogImportResult{}, Errors: []ImportRowError{}}
+	created, updated := []*catalogCompound{}, []*catalogCompound{}
+	firstRows := map[string]int{}
+	for i, row := range rows[1:] {
+		if isBlankRow(row) {
+			continue
+		}
+		report.Rows++
+		if report.Rows > MAX_IMPORT_ROWS {
+			slog.ErrorContext(r.Context(), "too many rows in catalog", "filename", fileHeader.Filename)
+			httpx.RespWithError(w, http.StatusBadRequest, utils.IMPORT_TOO_MANY_ROWS)
+			return
+		}
+
+		rowNumber := i + 2
+		entry, rowErrors := parseCatalogRow(r.Context(), row, columns, rowNumber)
+		if len(rowErrors) > 0 {
+			report.Errors = append(report.Errors, rowErrors...)
+			continue
+		}
+		result := CatalogImportResult{Row: rowNumber, CasNo: entry.casNo}
+
+		if firstRow, seen := firstRows[entry.casNo]; seen {
+			result.Action, result.DuplicateOf = CATALOG_ROW_DUPLICATE, firstRow
+			if first := byCasNo[entry.casNo]; first != nil {
+				result.CompoundId = first.id
+			}
+			report.Duplicates++
+			report.Results = append(report.Results, result)
+			continue
+		}
+		firstRows[entry.casNo] = rowNumber
+
+		existing := byCasNo[entry.casNo]
+		if existing == nil {
+			// A compound of the same name only matches when it has no CAS number of its own
+			if named := byName[utils.GetLowerCasedCompoundName(entry.name)]; named != nil {
+				if named.casNo != "" {
+					report.Errors = append(report.Errors, ImportRowError{Row: rowNumber, Column: "name", CompoundId: named.id, Error: utils.CATALOG_NAME_CONFLICT})
+					continue
+				}
+				existing = named
+			}
+		}
+
+		if existing == nil {
+			if entry.unit == "" {
+				entry.unit = defaultScale
+			}
+			if entry.unit == "" {
+				report.Errors = append(report.Errors, ImportRowError{Row: rowNumber, Column: "unit", Error: utils.MISSING_CATALOG_UNIT})
+				continue
+			}
+			entry.id = generateCompoundId(r.Context())
+			byCasNo[entry.casNo] = entry
+			byName[utils.GetLowerCasedCompoundName(entry.name)] = entry
+			created = append(created, entry)
+			result.CompoundId, result.Action = entry.id, CATALOG_ROW_CREATED
+			report.Created++
+			report.Results = append(report.Results, result)
+			continue
+		}
+
+		byCasNo[entry.casNo] = existing
+		result.CompoundId, result.Action = existing.id, CATALOG_ROW_UNCHANGED
+		if mergeCatalogCompound(existing, entry, overwrite) {
+			updated = append(updated, existing)
+			result.Action = CATALOG_ROW_UPDATED
+			report.Updated++
+		} else {
+			report.Unchanged++
+		}
+		report.Results = append(report.Results, result)
+	}
+
+	quota, err := utils.GetQuota(r.Context(), utils.QUOTA_COMPOUNDS)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error getting quota", "resource", utils.QUOTA_COMPOUNDS, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.QUOTA_RETRIEVAL_ERR)
+		return
+	}
+	if quota.Remaining != nil && *quota.Remaining < len(created) {
+		slog.ErrorContext(r.Context(), "catalog import exceeds trial limit", "created", len(created), "remaining", *quota.Remaining)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.TRIAL_PERIOD_LIMIT_EXCEEDED)
+		return
+	}
+
+	if len(report.Errors) > 0 || dryRun {
+		respondCatalogImportReport(w, report)
+		return
+	}
+
+	tx, err := db.ConnFrom(r.Context()).BeginTx(r.Context(), nil)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error starting transaction", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.TX_START_ERR)
+		return
+	}
+	defer tx.Rollback()
+
+	for _, c := range created {
+		if _, err := tx.ExecContext(r.Context(),
+			"INSERT INTO compound (id, lower_case_name, name, scale, cas_no, formula, molecular_weight, hazard_class) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+			c.id, utils.GetLowerCasedCompoundName(c.name), c.name, c.unit, c.casNo, c.formula, c.molecularWeight, c.hazardClass,
+		); err != nil {
+			slog.ErrorContext(r.Context(), "error inserting catalog compound", "cas_no", c.casNo, "name", c.name, "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.INSERT_COMPOUND_ERR)
+			return
+		}
+	}
+	for _, c := range updated {
+		if _, err := tx.ExecContext(r.Context(),
+			"UPDATE compound SET cas_no = ?, formula = ?, molecular_weight = ?, hazard_class = ? WHERE id = ?",
+			c.casNo, c.formula, c.molecularWeight, c.hazardClass, c.id,
+		); err != nil {
+			slog.ErrorContext(r.Context(), "error updating compound from catalog", "compound_id", c.id, "cas_no", c.casNo, "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.COMPOUND_UPDATE_ERR)
+			return
+		}
+	}
+
+	utils.RecordAudit(r.Context(), tx, currentUser(r).Id, "compound.catalog_import", utils.AUDIT_TARGET_COMPOUND, "", map[string]any{
+		"filename":  fileHeader.Filename,
+		"overwrite": overwrite,
+		"created":   report.Created,
+		"updated":   report.Updated,
+	})
+
+	if err := tx.Commit(); err != nil {
+		slog.ErrorContext(r.Context(), "error committing transaction", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.COMMIT_TRANSACTION_ERR)
+		return
+	}
+
+	respondCatalogImportReport(w, report)
+}
+
+// Like respondImportReport: invalid rows fail a real import with 400 and nothing written
+func respondCatalogImportReport(w http.ResponseWriter, report *CatalogImportReport) {
+	if len(report.Errors) > 0 && !report.DryRun {
+		httpx.EncodeJsonRes(w, http.StatusBadRequest, &httpx.Resp{Error: utils.IMPORT_VALIDATION_ERR, Data: report})
+		return
+	}
+	httpx.RespWithData(w, http.StatusOK, report)
+}
+
+// Finds the column of each catalog field in the header row, keyed by field. Fields without a column are left out.
+func mapCatalogColumns(header []string) map[string]int {
+	normalize := func(name string) string {
+		return strings.NewReplacer(" ", "_", "-", "_").Replace(strings.ToLower(strings.TrimSpace(name)))
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		name = normalize(name)
+		for field, names := range catalogColumnNames {
+			if _, found := columns[field]; !found && slices.Contains(names, name) {
+				columns[field] = i
+			}
+		}
+	}
+	return columns
+}
+
+// The compounds of the ledger keyed by CAS number, for those that have one, and by lower cased name
+func getCatalogCompounds(ctx context.Context) (map[string]*catalogCompound, map[string]*catalogCompound, error) {
+	rows, err := db.ConnFrom(ctx).QueryContext(ctx, "SELECT id, cas_no, name, lower_case_name, formula, molecular_weight, hazard_class FROM compound")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	byCasNo, byName := map[string]*catalogCompound{}, map[string]*catalogCompound{}
+	for rows.Next() {
+		c := &catalogCompound{}
+		var lowerCaseName string
+		var molecularWeight sql.NullFloat64
+		if err := rows.Scan(&c.id, &c.casNo, &c.name, &lowerCaseName, &c.formula, &molecularWeight, &c.hazardClass); err != nil {
+			return nil, nil, err
+		}
+		if molecularWeight.Valid {
+			c.molecularWeight = &molecularWeight.Float64
+		}
+		if c.casNo != "" {
+			byCasNo[c.casNo] = c
+		}
+		byName[lowerCaseName] = c
+	}
+	return byCasNo, byName, rows.Err()
+}
+
+func parseCatalogRow(ctx context.Context, row []string, columns map[string]int, rowNumber int) (*catalogCompound, []ImportRowError) {
+	errs := []ImportRowError{}
+	value := func(field string) string {
+		index, ok := columns[field]
+		if !ok || index >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[index])
+	}
+
+	c := &catalogCompound{
+		casNo:       value("cas_no"),
+		name:        value("name"),
+		formula:     value("formula"),
+		hazardClass: value("hazard_class"),
+	}
+
+	switch {
+	case c.casNo == "":
+		errs = append(errs, ImportRowError{Row: rowNumber, Column: "cas_no", Error: utils.MISSING_CATALOG_CAS_NO})
+	case !utils.ValidCasNumber(c.casNo):
+		errs = append(errs, ImportRowError{Row: rowNumber, Column: "cas_no", Error: utils.INVALID_CAS_NO})
+	}
+	if c.name == "" {
+		errs = append(errs, ImportRowError{Row: rowNumber, Column: "name", Error: utils.MISSING_REQUIRED_FIELDS})
+	}
+
+	if weight := value("molecular_weight"); weight != "" {
+		molecularWeight, err := strconv.ParseFloat(weight, 64)
+		if err != nil || molecularWeight <= 0 {
+			errs = append(errs, ImportRowError{Row: rowNumber, Column: "molecular_weight", Error: utils.INVALID_MOLECULAR_WEIGHT})
+		} else {
+			c.molecularWeight = &molecularWeight
+		}
+	}
+
+	if unit := value("unit"); unit != "" {
+		scale, _, errStr := parseScale(ctx, unit)
+		if errStr != utils.NO_ERR {
+			errs = append(errs, ImportRowError{Row: rowNumber, Column: "unit", Error: errStr})
+		}
+		c.unit = scale
+	}
+
+	return c, errs
+}
+
+// Takes the formula, molecular weight and hazard class of a catalog row into a compound of the ledger where it has
+// none, or wherever the row has one with "overwrite". Returns whether anything changed, the CAS number included.
+func mergeCatalogCompound(existing *catalogCompound, row *catalogCompound, overwrite bool) bool {
+	changed := existing.casNo != row.casNo
+	existing.casNo = row.casNo
+
+	for _, field := range []struct{ current, imported *string }{
+		{&existing.formula, &row.formula},
+		{&existing.hazardClass, &row.hazardClass},
+	} {
+		if *field.imported != "" && *field.imported != *field.current && (*field.current == "" || overwrite) {
+			*field.current = *field.imported
+			changed = true
+		}
+	}
+
+	if row.molecularWeight != nil && (existing.molecularWeight == nil || (overwrite && *existing.molecularWeight != *row.molecularWeight)) {
+		existing.molecularWeight = row.molecularWeight
+		changed = true
+	}
+	return changed
+}
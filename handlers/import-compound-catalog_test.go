@@ -0,0 +1,113 @@
+package handlers_test
+
+import (
+	"bytes"
+	"chemical-ledger-backend/handlers"
+	"chemical-ledger-backend/testutils"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompoundCatalogRoundTripDedupesOnCasNumber(t *testing.T) {
+	t.Parallel()
+	env := testutils.NewEnv(t, time.Date(2026, 3, 14, 10, 0, 0, 0, time.Local))
+
+	env.InsertCompound("C_ethanol", "Ethanol", "ml")
+	env.InsertCompound("C_acetone", "Acetone", "ml")
+	if _, err := env.DB.Exec("UPDATE compound SET lower_case_name = lower(name), cas_no = CASE WHEN id = 'C_ethanol' THEN '64-17-5' ELSE '' END, hazard_class = '3'"); err != nil {
+		t.Fatal(err)
+	}
+
+	importCatalog := func(catalog string, fields map[string]string) *httptest.ResponseRecorder {
+		body := &bytes.Buffer{}
+		mw := multipart.NewWriter(body)
+		part, _ := mw.CreateFormFile("file", "catalog.csv")
+		part.Write([]byte(catalog))
+		for name, value := range fields {
+			mw.WriteField(name, value)
+		}
+		mw.Close()
+		req := env.Request(http.MethodPost, "/import-compound-catalog", body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		w := httptest.NewRecorder()
+		handlers.ImportCompoundCatalogHandler(w, req)
+		return w
+	}
+
+	// Ethanol is matched on its CAS number and Acetone on its name; the repeated Ethanol row is skipped
+	catalog := "CAS Registry Number,Substance Name,Molecular Formula,MW,Hazard Class\n" +
+		"64-17-5,Ethyl alcohol,C2H6O,46.07,3\n" +
+		"67-64-1,Acetone,C3H6O,58.08,3\n" +
+		"7647-01-0,Hydrochloric acid,HCl,36.46,8\n" +
+		"64-17-5,Ethanol absolute,C2H6O,,\n"
+	w := importCatalog(catalog, map[string]string{"scale": "ml"})
+	body := w.Body.String()
+	for _, want := range []string{
+		`"created":1,"updated":2,"unchanged":0,"duplicates":1`,
+		`{"row":2,"cas_no":"64-17-5","compound_id":"C_ethanol","action":"updated"}`,
+		`{"row":3,"cas_no":"67-64-1","compound_id":"C_acetone","action":"updated"}`,
+		`{"row":4,"cas_no":"7647-01-0","compound_id":"C_1","action":"created"}`,
+		`{"row":5,"cas_no":"64-17-5","compound_id":"C_ethanol","action":"duplicate","duplicate_of":2}`,
+	} {
+		if w.Code != http.StatusOK || !strings.Contains(body, want) {
+			t.Errorf("catalog import: status %d, want %s in %s", w.Code, want, body)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	handlers.GetCompoundCatalogHandler(w, env.Request(http.MethodGet, "/export/compound-catalog", nil))
+	want := "CAS RN,Name,Molecular Formula,Molecular Weight,Hazard Class,Unit\n" +
+		"67-64-1,Acetone,C3H6O,58.08,3,ml\n" +
+		"64-17-5,Ethanol,C2H6O,46.07,3,ml\n" +
+		"7647-01-0,Hydrochloric acid,HCl,36.46,8,ml\n"
+	if w.Code != http.StatusOK || w.Body.String() != want {
+		t.Errorf("catalog export: status %d, %q", w.Code, w.Body)
+	}
+
+	// A workbook export imports alike
+	w = httptest.NewRecorder()
+	handlers.GetCompoundCatalogHandler(w, env.Request(http.MethodGet, "/export/compound-catalog?format=xlsx", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Header().Get("Content-Disposition"), "compound-catalog-2026-03-14.xlsx") {
+		t.Fatalf("catalog workbook: status %d, %s", w.Code, w.Header().Get("Content-Disposition"))
+	}
+	workbook := &bytes.Buffer{}
+	mw := multipart.NewWriter(workbook)
+	part, _ := mw.CreateFormFile("file", "catalog.xlsx")
+	part.Write(w.Body.Bytes())
+	mw.Close()
+	req := env.Request(http.MethodPost, "/import-compound-catalog", workbook)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w = httptest.NewRecorder()
+	handlers.ImportCompoundCatalogHandler(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"created":0,"updated":0,"unchanged":3`) {
+		t.Errorf("catalog workbook reimport: status %d, %s", w.Code, w.Body)
+	}
+	w = httptest.NewRecorder()
+	handlers.GetCompoundCatalogHandler(w, env.Request(http.MethodGet, "/export/compound-catalog?format=json", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("catalog as JSON: status %d, %s", w.Code, w.Body)
+	}
+
+	// Importing the export again changes nothing, not even with "overwrite"
+	if w := importCatalog(want, map[string]string{"overwrite": "true"}); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"created":0,"updated":0,"unchanged":3`) {
+		t.Errorf("catalog reimport: status %d, %s", w.Code, w.Body)
+	}
+
+	for name, catalog := range map[string]string{
+		"bad check digit":        "CAS RN,Name,Unit\n64-17-6,Ethanol,ml\n",
+		"name under another CAS": "CAS RN,Name,Unit\n7732-18-5,Acetone,ml\n",
+		"no unit":                "CAS RN,Name\n7732-18-5,Water\n",
+	} {
+		if w := importCatalog(catalog, nil); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `"errors":[{"row":2`) {
+			t.Errorf("%s: status %d, %s", name, w.Code, w.Body)
+		}
+	}
+	var compounds int
+	if err := env.DB.QueryRow("SELECT COUNT(*) FROM compound").Scan(&compounds); err != nil || compounds != 3 {
+		t.Errorf("compounds after failed imports: %d, %v", compounds, err)
+	}
+}
@@ -0,0 +1,526 @@
+package handlers
+
+import (
+	"bytes"
+	"chemical-ledger-backend/datetime"
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/stock"
+	"chemical-ledger-backend/utils"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limits of a single import
+const (
+	MAX_IMPORT_FILE_SIZE = 10 << 20
+	MAX_IMPORT_ROWS      = 10000
+)
+
+// Entry fields an import column can be mapped to. Without a mapping, columns are matched on these names.
+var importFields = []string{
+	"type", "compound", "date", "num_of_units", "packs_per_unit", "quantity_per_unit", "partial_quantity",
+	"remark", "voucher_no", "lot_no", "expiry", "supplier", "supplier_id", "recipient_id", "reason",
+	"instrument_id", "instrument_event", "disposal_method", "disposal_authorized_by", "location_id", "to_location_id",
+	"project_id", "unit_cost", "po_line_id",
+}
+
+var requiredImportFields = []string{"type", "compound", "date"}
+
+// Problem found in a row, or for a compound when its stock cannot be recalculated with the imported entries
+type ImportRowError struct {
+	Row        int                `json:"row,omitempty"`
+	Column     string             `json:"column,omitempty"`
+	CompoundId string             `json:"compound_id,omitempty"`
+	Error      utils.ErrorMessage `json:"error"`
+}
+
+type ImportReport struct {
+	DryRun   bool             `json:"dry_run"`
+	Rows     int              `json:"rows"`
+	Imported int              `json:"imported"`
+	Status   string           `json:"status,omitempty"`
+	ImportId string           `json:"import_id,omitempty"`
+	Errors   []ImportRowError `json:"errors"`
+}
+
+// Imports historical entries from a CSV or xlsx upload (multipart field "file", first sheet for xlsx).
+// The first row holds the column names, "mapping" optionally maps entry fields to them as a JSON object,
+// e.g. {"compound": "Chemical", "date": "Issued on"}. Every row is validated before anything is written
+// and the whole file goes in one transaction, followed by a stock recalculation of every compound it touches.
+// With "dry_run=true" the import is run and reported but rolled back. With a "progress_id" it reports its progress
+// under that ID, see GetOperationEventsHandler.
+func ImportEntriesHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, MAX_IMPORT_FILE_SIZE)
+	if err := r.ParseMultipartForm(MAX_IMPORT_FILE_SIZE); err != nil {
+		slog.ErrorContext(r.Context(), "failed to parse import upload", "error", err)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.INVALID_IMPORT_FILE)
+		return
+	}
+
+	file, fileHeader, err := r.FormFile("file")
+	if err != nil {
+		slog.ErrorContext(r.Context(), "import file missing", "error", err)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.INVALID_IMPORT_FILE)
+		return
+	}
+	defer file.Close()
+
+	w, op, finish := trackRequestOperation(w, r, r.FormValue("progress_id"), utils.OPERATION_IMPORT)
+	defer finish()
+
+	dryRun, _ := strconv.ParseBool(r.FormValue("dry_run"))
+
+	mapping := map[string]string{}
+	if rawMapping := r.FormValue("mapping"); rawMapping != "" {
+		if err := json.Unmarshal([]byte(rawMapping), &mapping); err != nil {
+			slog.ErrorContext(r.Context(), "invalid import mapping", "mapping", rawMapping, "error", err)
+			httpx.RespWithError(w, http.StatusBadRequest, utils.INVALID_IMPORT_MAPPING)
+			return
+		}
+	}
+
+	rows, err := readImportRows(file, fileHeader.Filename)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to read import file", "filename", fileHeader.Filename, "error", err)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.INVALID_IMPORT_FILE)
+		return
+	}
+	if len(rows) == 0 {
+		slog.ErrorContext(r.Context(), "import file is empty", "filename", fileHeader.Filename)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.INVALID_IMPORT_FILE)
+		return
+	}
+
+	columns, errStr := mapImportColumns(r.Context(), rows[0], mapping)
+	if errStr != utils.NO_ERR {
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	report := &ImportReport{DryRun: dryRun, Errors: []ImportRowError{}}
+	entries, rowNumbers := []*InsertEntryReq{}, []int{}
+
+	compounds, err := getCompoundLookup(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to load compounds for import", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.COMPOUND_RETRIEVAL_ERR)
+		return
+	}
+
+	for i, row := range rows[1:] {
+		if isBlankRow(row) {
+			continue
+		}
+		report.Rows++
+		if report.Rows > MAX_IMPORT_ROWS {
+			slog.ErrorContext(r.Context(), "too many rows in import", "filename", fileHeader.Filename)
+			httpx.RespWithError(w, http.StatusBadRequest, utils.IMPORT_TOO_MANY_ROWS)
+			return
+		}
+
+		// Spreadsheet row numbers, counting the header as row 1
+		rowNumber := i + 2
+		entry, rowErrors := parseImportRow(r.Context(), row, columns, compounds, rowNumber)
+		if len(rowErrors) > 0 {
+			report.Errors = append(report.Errors, rowErrors...)
+			continue
+		}
+		entries = append(entries, entry)
+		rowNumbers = append(rowNumbers, rowNumber)
+	}
+
+	quota, err := utils.GetQuota(r.Context(), utils.QUOTA_ENTRIES)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error getting quota", "resource", utils.QUOTA_ENTRIES, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.QUOTA_RETRIEVAL_ERR)
+		return
+	}
+	if quota.Remaining != nil && *quota.Remaining < report.Rows {
+		slog.ErrorContext(r.Context(), "import exceeds trial limit", "rows", report.Rows, "remaining", *quota.Remaining)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.TRIAL_PERIOD_LIMIT_EXCEEDED)
+		return
+	}
+
+	if len(report.Errors) > 0 {
+		respondImportReport(w, report)
+		return
+	}
+
+	unlock := stock.LockCompounds(importedCompoundIds(entries)...)
+	defer unlock()
+
+	tx, err := db.ConnFrom(r.Context()).BeginTx(r.Context(), nil)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error starting transaction", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.TX_START_ERR)
+		return
+	}
+	defer tx.Rollback()
+
+	actor := currentUser(r)
+	status := utils.ENTRY_STATUS_APPROVED
+	if utils.EntryNeedsApproval(actor.Role) {
+		status = utils.ENTRY_STATUS_PENDING
+	}
+	report.Status = status
+
+	importId, err := createImportBatch(r.Context(), tx, IMPORT_SOURCE_FILE, fileHeader.Filename, len(entries), actor.Id)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error recording import", "filename", fileHeader.Filename, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.IMPORT_BATCH_ERR)
+		return
+	}
+
+	_, recalculationErrors, errStr := insertImportedEntries(r.Context(), tx, entries, rowNumbers, status, actor.Id, importId, op)
+	if errStr != utils.NO_ERR {
+		httpx.RespWithError(w, http.StatusInternalServerError, errStr)
+		return
+	}
+	report.Errors = append(report.Errors, recalculationErrors...)
+	if len(report.Errors) > 0 {
+		respondImportReport(w, report)
+		return
+	}
+
+	if dryRun {
+		respondImportReport(w, report)
+		return
+	}
+
+	utils.RecordAudit(r.Context(), tx, actor.Id, "entry.import", utils.AUDIT_TARGET_ENTRY, "", map[string]any{
+		"filename":  fileHeader.Filename,
+		"rows":      len(entries),
+		"import_id": importId,
+	})
+
+	if err := tx.Commit(); err != nil {
+		slog.ErrorContext(r.Context(), "error committing transaction", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.COMMIT_TRANSACTION_ERR)
+		return
+	}
+
+	report.Imported = len(entries)
+	report.ImportId = importId
+	respondImportReport(w, report)
+}
+
+// Compounds of the parsed entries, to be locked while they are inserted
+func importedCompoundIds(entries []*InsertEntryReq) []string {
+	compoundIds := make([]string, len(entries))
+	for i, entry := range entries {
+		compoundIds[i] = entry.CompoundId
+	}
+	return compoundIds
+}
+
+// Where the entries of an import come from
+const (
+	IMPORT_SOURCE_FILE  = "import"
+	IMPORT_SOURCE_PASTE = "paste"
+	// Events of inbound integrations, see InsertInboundEventHandler
+	IMPORT_SOURCE_INBOUND = "inbound"
+)
+
+// Records an import in the given transaction, returning its ID. Its entries carry the ID so the whole import
+// can be rolled back, see RollbackImportHandler.
+func createImportBatch(ctx context.Context, tx *sql.Tx, source string, filename string, rows int, actorId string) (string, error) {
+	importId := utils.NewId(ctx, "IB")
+	_, err := tx.ExecContext(ctx,
+		"INSERT INTO import_batch (id, source, filename, rows, created_by, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		importId, source, filename, rows, actorId, datetime.Now(ctx).Unix(),
+	)
+	return importId, err
+}
+
+// Inserts parsed entries in the given transaction, with the given status, creator and import, and recalculates the
+// stock of every compound involved. Entries of the same day keep their order. Returns the IDs of the new entries and
+// the compounds whose stock cannot be recalculated with them, e.g. as it would go negative.
+func insertImportedEntries(ctx context.Context, tx *sql.Tx, entries []*InsertEntryReq, rowNumbers []int, status string, actorId string, importId string, op *utils.Operation) ([]string, []ImportRowError, utils.ErrorMessage) {
+	// Each entry is a step, then each compound recalculated
+	steps := len(entries) + len(slices.Compact(slices.Sorted(slices.Values(importedCompoundIds(entries)))))
+	done := 0
+
+	entryIds := make([]string, len(entries))
+	recalculateFrom := map[string]int64{}
+	for i, entry := range entries {
+		op.Step(done, steps, "row "+strconv.Itoa(rowNumbers[i]))
+		done++
+
+		// Rows of the same day keep their order in the file
+		date, _ := time.ParseInLocation("2006-01-02", entry.Date, time.Local)
+		entryDate := date.Unix() + int64(i)
+
+		quantityId := generateQuantityId(ctx)
+		entryId := generateEntryId(ctx)
+		entryIds[i] = entryId
+
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO quantity (id, num_of_units, packs_per_unit, quantity_per_unit, partial_quantity) VALUES (?, ?, ?, ?, ?)",
+			quantityId, entry.NumOfUnits, entry.PacksPerUnit, entry.QuantityPerUnit, entry.PartialQuantity,
+		); err != nil {
+			slog.ErrorContext(ctx, "error inserting imported quantity", "row", rowNumbers[i], "error", err)
+			return nil, nil, utils.INSERT_QUANTITY_ERR
+		}
+
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO entry (id, type, compound_id, date, remark, voucher_no, quantity_id, net_stock, supplier_id, recipient_id, reason, instrument_id, instrument_event, disposal_method, disposal_authorized_by, location_id, to_location_id, project_id, unit_cost, po_line_id, status, created_by, import_batch_id, seq) VALUES (?, ?, ?, ?, ?, ?, ?, 0, NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), ?, NULLIF(?, ''), ?, ?, ?, "+utils.NEXT_ENTRY_SEQ+")",
+			entryId, entry.Type, entry.CompoundId, entryDate, entry.Remark, entry.VoucherNo, quantityId, entry.SupplierId, entry.RecipientId, entry.Reason, entry.InstrumentId, entry.InstrumentEvent, entry.DisposalMethod, entry.DisposalAuthorizedBy, entry.LocationId, entry.ToLocationId, entry.ProjectId, entry.UnitCost, entry.PoLineId, status, actorId, importId,
+		); err != nil {
+			slog.ErrorContext(ctx, "error inserting imported entry", "row", rowNumbers[i], "error", err)
+			return nil, nil, utils.INSERT_ENTRY_ERR
+		}
+
+		if utils.IsInwardEntryType(entry.Type) {
+			if _, err := tx.ExecContext(ctx,
+				"INSERT INTO lot (id, compound_id, entry_id, lot_no, expiry, supplier) VALUES (?, ?, ?, ?, ?, ?)",
+				generateLotId(ctx), entry.CompoundId, entryId, entry.LotNo, entry.Expiry, entry.Supplier,
+			); err != nil {
+				slog.ErrorContext(ctx, "error inserting imported lot", "row", rowNumbers[i], "error", err)
+				return nil, nil, utils.INSERT_ENTRY_ERR
+			}
+		}
+
+		if from, ok := recalculateFrom[entry.CompoundId]; !ok || entryDate < from {
+			recalculateFrom[entry.CompoundId] = entryDate
+		}
+	}
+
+	recalculationErrors := []ImportRowError{}
+	for compoundId, from := range recalculateFrom {
+		op.Step(done, steps, compoundId)
+		done++
+		if errStr := stock.UpdateNetStockFromTodayOnwards(ctx, tx, compoundId, from); errStr != utils.NO_ERR {
+			slog.ErrorContext(ctx, "error recalculating stock after import", "compound_id", compoundId, "error", errStr)
+			recalculationErrors = append(recalculationErrors, ImportRowError{CompoundId: compoundId, Error: errStr})
+			op.Fail(compoundId, errStr)
+		}
+	}
+
+	return entryIds, recalculationErrors, utils.NO_ERR
+}
+
+// A dry run always reports with 200. A real import that failed validation writes nothing and reports the errors with 400.
+func respondImportReport(w http.ResponseWriter, report *ImportReport) {
+	if len(report.Errors) > 0 && !report.DryRun {
+		httpx.EncodeJsonRes(w, http.StatusBadRequest, &httpx.Resp{Error: utils.IMPORT_VALIDATION_ERR, Data: report})
+		return
+	}
+	httpx.RespWithData(w, http.StatusOK, report)
+}
+
+func readImportRows(file io.Reader, filename string) ([][]string, error) {
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+
+	// xlsx files are zip archives
+	if strings.HasSuffix(strings.ToLower(filename), ".xlsx") || bytes.HasPrefix(content, []byte("PK\x03\x04")) {
+		return utils.ReadXLSXRows(bytes.NewReader(content), int64(len(content)))
+	}
+
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(content, []byte("\xef\xbb\xbf"))))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	return reader.ReadAll()
+}
+
+// Finds the column of each entry field in the header row, keyed by field
+func mapImportColumns(ctx context.Context, header []string, mapping map[string]string) (map[string]int, utils.ErrorMessage) {
+	normalize := func(name string) string {
+		return strings.NewReplacer(" ", "_", "-", "_").Replace(strings.ToLower(strings.TrimSpace(name)))
+	}
+
+	headerIndex := map[string]int{}
+	for i, name := range header {
+		headerIndex[normalize(name)] = i
+	}
+
+	columns := map[string]int{}
+	for field, column := range mapping {
+		if !slices.Contains(importFields, field) {
+			slog.ErrorContext(ctx, "import mapping names an unknown field", "field", field)
+			return nil, utils.INVALID_IMPORT_MAPPING
+		}
+		index, ok := headerIndex[normalize(column)]
+		if !ok {
+			slog.ErrorContext(ctx, "mapped import column not found", "field", field, "column", column)
+			return nil, utils.INVALID_IMPORT_MAPPING
+		}
+		columns[field] = index
+	}
+
+	for _, field := range importFields {
+		if _, mapped := columns[field]; mapped {
+			continue
+		}
+		if index, ok := headerIndex[field]; ok {
+			columns[field] = index
+		}
+	}
+
+	for _, field := range requiredImportFields {
+		if _, ok := columns[field]; !ok {
+			slog.ErrorContext(ctx, "required import column missing", "field", field)
+			return nil, utils.INVALID_IMPORT_MAPPING
+		}
+	}
+
+	return columns, utils.NO_ERR
+}
+
+// Compound IDs keyed by ID and by lower cased name, so the compound column can hold either
+type compoundLookup struct {
+	ids map[string]string
+}
+
+func getCompoundLookup(ctx context.Context) (*compoundLookup, error) {
+	rows, err := db.ConnFrom(ctx).QueryContext(ctx, "SELECT id, lower_case_name FROM compound")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lookup := &compoundLookup{ids: map[string]string{}}
+	for rows.Next() {
+		var id, lowerCaseName string
+		if err := rows.Scan(&id, &lowerCaseName); err != nil {
+			return nil, err
+		}
+		lookup.ids[id] = id
+		lookup.ids[lowerCaseName] = id
+	}
+	return lookup, rows.Err()
+}
+
+func parseImportRow(ctx context.Context, row []string, columns map[string]int, compounds *compoundLookup, rowNumber int) (*InsertEntryReq, []ImportRowError) {
+	errs := []ImportRowError{}
+	value := func(field string) string {
+		index, ok := columns[field]
+		if !ok || index >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[index])
+	}
+	number := func(field string) utils.LocalizedInt {
+		n, errStr := parseImportInt(value(field))
+		if errStr != utils.NO_ERR {
+			errs = append(errs, ImportRowError{Row: rowNumber, Column: field, Error: errStr})
+		}
+		return utils.LocalizedInt(n)
+	}
+	cost := func(field string) *float64 {
+		str := value(field)
+		if str == "" {
+			return nil
+		}
+		c, err := strconv.ParseFloat(str, 64)
+		if err != nil {
+			errs = append(errs, ImportRowError{Row: rowNumber, Column: field, Error: utils.INVALID_UNIT_COST})
+			return nil
+		}
+		return &c
+	}
+	date := func(field string) string {
+		d, errStr := parseImportDate(value(field))
+		if errStr != utils.NO_ERR {
+			errs = append(errs, ImportRowError{Row: rowNumber, Column: field, Error: errStr})
+		}
+		return d
+	}
+
+	entry := &InsertEntryReq{
+		Type:                 strings.ToLower(value("type")),
+		Date:                 date("date"),
+		Remark:               value("remark"),
+		VoucherNo:            value("voucher_no"),
+		NumOfUnits:           number("num_of_units"),
+		PacksPerUnit:         number("packs_per_unit"),
+		QuantityPerUnit:      number("quantity_per_unit"),
+		PartialQuantity:      number("partial_quantity"),
+		LotNo:                value("lot_no"),
+		Expiry:               date("expiry"),
+		Supplier:             value("supplier"),
+		SupplierId:           value("supplier_id"),
+		RecipientId:          value("recipient_id"),
+		Reason:               value("reason"),
+		InstrumentId:         value("instrument_id"),
+		InstrumentEvent:      strings.ToLower(value("instrument_event")),
+		DisposalMethod:       strings.ToLower(value("disposal_method")),
+		DisposalAuthorizedBy: value("disposal_authorized_by"),
+		LocationId:           value("location_id"),
+		ToLocationId:         value("to_location_id"),
+		ProjectId:            value("project_id"),
+		UnitCost:             cost("unit_cost"),
+		PoLineId:             value("po_line_id"),
+	}
+
+	if compound := value("compound"); compound != "" {
+		compoundId, ok := compounds.ids[compound]
+		if !ok {
+			compoundId, ok = compounds.ids[utils.GetLowerCasedCompoundName(compound)]
+		}
+		if !ok {
+			errs = append(errs, ImportRowError{Row: rowNumber, Column: "compound", Error: utils.INVALID_COMPOUND_ID})
+		}
+		entry.CompoundId = compoundId
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	if errStr := validateInsertEntryReq(ctx, entry); errStr != utils.NO_ERR {
+		return nil, []ImportRowError{{Row: rowNumber, Error: errStr}}
+	}
+	if errStr := validateDate(ctx, entry.Date); errStr != utils.NO_ERR {
+		return nil, []ImportRowError{{Row: rowNumber, Column: "date", Error: errStr}}
+	}
+	if _, errStr := checkEntryDatesUnlocked(ctx, datetime.GetDateUnix(ctx, entry.Date)); errStr != utils.NO_ERR {
+		return nil, []ImportRowError{{Row: rowNumber, Column: "date", Error: errStr}}
+	}
+
+	return entry, nil
+}
+
+// Parses a whole number written in the configured locale, see utils.ParseLocalizedInt. Empty means 0.
+func parseImportInt(value string) (int, utils.ErrorMessage) {
+	if n, err := strconv.Atoi(value); err == nil {
+		return n, utils.NO_ERR
+	}
+	return utils.ParseLocalizedInt(value)
+}
+
+// Parses a YYYY-MM-DD date or an Excel date serial (days since 1899-12-30) into YYYY-MM-DD. Empty stays empty.
+func parseImportDate(value string) (string, utils.ErrorMessage) {
+	if value == "" {
+		return "", utils.NO_ERR
+	}
+	if _, err := time.Parse("2006-01-02", value); err == nil {
+		return value, utils.NO_ERR
+	}
+	serial, err := strconv.ParseFloat(value, 64)
+	if err != nil || serial < 1 {
+		return "", utils.INVALID_DATE_FORMAT
+	}
+	return time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC).AddDate(0, 0, int(serial)).Format("2006-01-02"), utils.NO_ERR
+}
+
+func isBlankRow(row []string) bool {
+	for _, cell := range row {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/datetime"
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Attaches the safety data sheet of a compound, a PDF uploaded in the multipart field "file". Earlier sheets are
+// kept, GetCompoundSdsHandler serves the latest. Admins, supervisors and operators only; every upload is audited.
+func InsertCompoundSdsHandler(w http.ResponseWriter, r *http.Request) {
+	compoundId := chi.URLParam(r, "id")
+
+	data, filename, err := readUploadedFile(w, r)
+	if err != nil || !utils.IsPdf(data) {
+		slog.WarnContext(r.Context(), "SDS is not a PDF within the size limit", "compound_id", compoundId, "filename", filename, "size", len(data), "error", err)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.INVALID_SDS_FILE)
+		return
+	}
+
+	compoundExists, err := utils.CheckIfCompoundExists(r.Context(), compoundId)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to check compound existence", "compound_id", compoundId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.COMPOUND_ID_CHECK_ERR)
+		return
+	}
+	if !compoundExists {
+		slog.WarnContext(r.Context(), "compound does not exist", "compound_id", compoundId)
+		httpx.RespWithError(w, http.StatusNotFound, utils.INVALID_COMPOUND_ID)
+		return
+	}
+
+	tx, err := db.ConnFrom(r.Context()).BeginTx(r.Context(), nil)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error starting transaction", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.TX_START_ERR)
+		return
+	}
+	defer tx.Rollback()
+
+	actorId := currentUser(r).Id
+	attachment := &utils.Attachment{
+		Id:          utils.NewId(r.Context(), "AT"),
+		CompoundId:  compoundId,
+		Kind:        utils.ATTACHMENT_KIND_SDS,
+		Filename:    filename,
+		ContentType: "application/pdf",
+		UploadedBy:  actorId,
+		UploadedAt:  datetime.Now(r.Context()).Unix(),
+	}
+	if err := utils.SaveAttachment(r.Context(), tx, attachment, data); err != nil {
+		slog.ErrorContext(r.Context(), "failed to save SDS", "compound_id", compoundId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.ATTACHMENT_SAVE_ERR)
+		return
+	}
+
+	utils.RecordAudit(r.Context(), tx, actorId, "compound.sds_upload", utils.AUDIT_TARGET_COMPOUND, compoundId, map[string]any{
+		"attachment_id": attachment.Id,
+		"filename":      attachment.Filename,
+		"sha256":        attachment.Sha256,
+	})
+
+	if err := tx.Commit(); err != nil {
+		slog.ErrorContext(r.Context(), "error committing transaction", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.COMMIT_TRANSACTION_ERR)
+		return
+	}
+
+	httpx.RespWithData(w, http.StatusOK, attachment)
+}
+
+// Reads the file uploaded in the multipart field "file", refusing files larger than MAX_ATTACHMENT_SIZE. Returns its
+// content and name, without the folders some browsers send along.
+func readUploadedFile(w http.ResponseWriter, r *http.Request) ([]byte, string, error) {
+	// Room for the form fields around the file
+	r.Body = http.MaxBytesReader(w, r.Body, utils.MAX_ATTACHMENT_SIZE+1<<20)
+	if err := r.ParseMultipartForm(utils.MAX_ATTACHMENT_SIZE); err != nil {
+		return nil, "", err
+	}
+
+	file, fileHeader, err := r.FormFile("file")
+	if err != nil {
+		return nil, "", err
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, utils.MAX_ATTACHMENT_SIZE+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(data) > utils.MAX_ATTACHMENT_SIZE {
+		return nil, "", errors.New("file larger than the attachment size limit")
+	}
+	return data, filepath.Base(fileHeader.Filename), nil
+}
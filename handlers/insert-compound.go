@@ -2,82 +2,180 @@ package handlers
 
 import (
 	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
 	"chemical-ledger-backend/utils"
-	"fmt"
+	"context"
 	"log/slog"
 	"net/http"
-	"time"
+	"strings"
 )
 
 type InsertCompoundReq struct {
-	Name  string `json:"name"`
-	Scale string `json:"scale"`
+	Name          string             `json:"name"`
+	Scale         string             `json:"scale"`
+	MinStock      utils.LocalizedInt `json:"min_stock"`
+	Notes         string             `json:"notes"`
+	PinnedWarning string             `json:"pinned_warning"`
+	Category      string             `json:"category"`
+	DisplayUnit   string             `json:"display_unit"`
+	// Optional chemical data shown with the compound
+	CasNo           string   `json:"cas_no"`
+	Formula         string   `json:"formula"`
+	MolecularWeight *float64 `json:"molecular_weight"`
+	StorageLocation string   `json:"storage_location"`
+	// Hazard class for transport and storage, e.g. "3" for flammable liquids or "6.1" for toxic substances
+	HazardClass string `json:"hazard_class"`
+	// Controlled substances get a chain-of-custody report per lot
+	Controlled bool `json:"controlled"`
+	// Largest plausible delivery, 0 to derive it from the past deliveries, see utils.LargeIncomingBound
+	MaxIncoming utils.LocalizedInt `json:"max_incoming"`
 }
 
 func InsertCompoundHandler(w http.ResponseWriter, r *http.Request) {
+	if !checkQuota(r.Context(), w, utils.QUOTA_COMPOUNDS) {
+		return
+	}
+
 	reqBody := &InsertCompoundReq{}
-	if errStr := utils.DecodeJsonReq(r, reqBody); errStr != utils.NO_ERR {
-		slog.Error("failed to decode JSON request", "error", errStr)
-		utils.RespWithError(w, http.StatusBadRequest, errStr)
+	if errStr := httpx.DecodeJsonReq(r, reqBody); errStr != utils.NO_ERR {
+		slog.ErrorContext(r.Context(), "failed to decode JSON request", "error", errStr)
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	if errStr := validateCompoundReq(r.Context(), reqBody); errStr != utils.NO_ERR {
+		slog.ErrorContext(r.Context(), "invalid compound request", "error", errStr)
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	scale, status, errStr := parseScale(r.Context(), reqBody.Scale)
+	if errStr != utils.NO_ERR {
+		httpx.RespWithError(w, status, errStr)
 		return
 	}
+	reqBody.Scale = scale
 
-	if errStr := validateCompoundReq(reqBody); errStr != utils.NO_ERR {
-		slog.Error("invalid compound request", "error", errStr)
-		utils.RespWithError(w, http.StatusBadRequest, errStr)
+	if status, errStr := validateDisplayUnit(r.Context(), reqBody.DisplayUnit, reqBody.Scale); errStr != utils.NO_ERR {
+		httpx.RespWithError(w, status, errStr)
 		return
 	}
 
-	compoundId := generateCompoundId()
+	compoundId := generateCompoundId(r.Context())
 	lowerCasedName := utils.GetLowerCasedCompoundName(reqBody.Name)
 
 	var compoundExists bool
-	err := db.Conn.QueryRow(
+	err := db.ConnFrom(r.Context()).QueryRowContext(r.Context(),
 		"SELECT EXISTS(SELECT 1 FROM compound WHERE lower_case_name = ?)",
 		lowerCasedName,
 	).Scan(&compoundExists)
 
 	if err != nil {
-		slog.Error("error checking if compound exists", "compound_name", reqBody.Name, "error", err)
-		utils.RespWithError(w, http.StatusInternalServerError, utils.COMPOUND_ID_CHECK_ERR)
+		slog.ErrorContext(r.Context(), "error checking if compound exists", "compound_name", reqBody.Name, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.COMPOUND_ID_CHECK_ERR)
 		return
 	}
 
 	if compoundExists {
-		slog.Error("compound already exists", "compound_name", reqBody.Name)
-		utils.RespWithError(w, http.StatusNotAcceptable, utils.COMPOUND_ALREADY_EXISTS)
+		slog.ErrorContext(r.Context(), "compound already exists", "compound_name", reqBody.Name)
+		httpx.RespWithError(w, http.StatusNotAcceptable, utils.COMPOUND_ALREADY_EXISTS)
 		return
 	}
 
-	_, err = db.Conn.Exec(
-		"INSERT INTO compound (id, lower_case_name, name, scale) VALUES (?, ?, ?, ?)",
-		compoundId, lowerCasedName, reqBody.Name, reqBody.Scale,
+	_, err = db.ConnFrom(r.Context()).ExecContext(r.Context(),
+		"INSERT INTO compound (id, lower_case_name, name, scale, min_stock, notes, pinned_warning, category, display_unit, cas_no, formula, molecular_weight, storage_location, controlled, hazard_class, max_incoming) VALUES (?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''), ?, ?, ?, ?, ?, ?, ?)",
+		compoundId, lowerCasedName, reqBody.Name, reqBody.Scale, reqBody.MinStock, reqBody.Notes, strings.TrimSpace(reqBody.PinnedWarning), strings.TrimSpace(reqBody.Category), reqBody.DisplayUnit,
+		reqBody.CasNo, strings.TrimSpace(reqBody.Formula), reqBody.MolecularWeight, strings.TrimSpace(reqBody.StorageLocation), reqBody.Controlled, strings.TrimSpace(reqBody.HazardClass), reqBody.MaxIncoming,
 	)
 	if err != nil {
-		slog.Error("error inserting compound", "compound_id", compoundId, "compound_name", reqBody.Name, "scale", reqBody.Scale, "error", err)
-		utils.RespWithError(w, http.StatusInternalServerError, utils.INSERT_COMPOUND_ERR)
+		slog.ErrorContext(r.Context(), "error inserting compound", "compound_id", compoundId, "compound_name", reqBody.Name, "scale", reqBody.Scale, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.INSERT_COMPOUND_ERR)
 		return
 	}
 
-	utils.RespWithData(w, http.StatusOK, map[string]any{
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
 		"compound_id": compoundId,
 	})
 }
 
-func validateCompoundReq(reqBody *InsertCompoundReq) utils.ErrorMessage {
+func validateCompoundReq(ctx context.Context, reqBody *InsertCompoundReq) utils.ErrorMessage {
 	if reqBody.Name == "" || reqBody.Scale == "" {
-		slog.Error("missing required fields", "name", reqBody.Name, "scale", reqBody.Scale)
+		slog.ErrorContext(ctx, "missing required fields", "name", reqBody.Name, "scale", reqBody.Scale)
 		return utils.MISSING_REQUIRED_FIELDS
 	}
 
-	if reqBody.Scale != utils.SCALE_G && reqBody.Scale != utils.SCALE_ML {
-		slog.Error("invalid scale", "scale", reqBody.Scale)
-		return utils.INVALID_SCALE_ERR
+	if reqBody.MinStock < 0 {
+		slog.ErrorContext(ctx, "invalid minimum stock", "min_stock", reqBody.MinStock)
+		return utils.INVALID_MIN_STOCK
+	}
+
+	if reqBody.MaxIncoming < 0 {
+		slog.ErrorContext(ctx, "invalid max incoming", "max_incoming", reqBody.MaxIncoming)
+		return utils.INVALID_MAX_INCOMING
+	}
+
+	reqBody.CasNo = strings.TrimSpace(reqBody.CasNo)
+	return validateChemicalData(ctx, reqBody.CasNo, reqBody.MolecularWeight)
+}
+
+// Checks the chemical data of a compound: a CAS number, unless empty, must pass its checksum, and a molecular weight
+// must be positive.
+func validateChemicalData(ctx context.Context, casNo string, molecularWeight *float64) utils.ErrorMessage {
+	if casNo != "" && !utils.ValidCasNumber(casNo) {
+		slog.WarnContext(ctx, "invalid CAS number", "cas_no", casNo)
+		return utils.INVALID_CAS_NO
+	}
+
+	if molecularWeight != nil && *molecularWeight <= 0 {
+		slog.WarnContext(ctx, "invalid molecular weight", "molecular_weight", *molecularWeight)
+		return utils.INVALID_MOLECULAR_WEIGHT
 	}
 
 	return utils.NO_ERR
 }
 
-func generateCompoundId() string {
-	return fmt.Sprintf("C_%d", time.Now().Unix())
+// Reads the scale a compound is to be measured in: any unit listed by /units, also written out (e.g. "grams"), which
+// is returned by its short name. Returns the status code to answer with when it is not a unit.
+// SQLite does not enforce the unit references of compounds, foreign keys being off, so every scale written goes
+// through here, as every display unit goes through validateDisplayUnit.
+func parseScale(ctx context.Context, scale string) (string, int, utils.ErrorMessage) {
+	unit, err := utils.ParseQuantityUnit(ctx, scale)
+	if err != nil {
+		slog.ErrorContext(ctx, "error retrieving scale unit", "scale", scale, "error", err)
+		return "", http.StatusInternalServerError, utils.UNIT_RETRIEVAL_ERR
+	}
+	if unit == nil {
+		slog.WarnContext(ctx, "invalid scale", "scale", scale)
+		return "", http.StatusBadRequest, utils.INVALID_SCALE_ERR
+	}
+	return unit.Name, http.StatusOK, utils.NO_ERR
+}
+
+// Checks that the unit a compound is to be shown in exists and measures the same kind of quantity as its scale, e.g.
+// kg for a compound kept in g. An empty unit shows the scale itself. Returns the status code to answer with when it
+// is not.
+func validateDisplayUnit(ctx context.Context, displayUnit string, scale string) (int, utils.ErrorMessage) {
+	if displayUnit == "" {
+		return http.StatusOK, utils.NO_ERR
+	}
+
+	unit, err := utils.GetQuantityUnit(ctx, displayUnit)
+	if err != nil {
+		slog.ErrorContext(ctx, "error retrieving display unit", "display_unit", displayUnit, "error", err)
+		return http.StatusInternalServerError, utils.UNIT_RETRIEVAL_ERR
+	}
+	scaleUnit, err := utils.GetQuantityUnit(ctx, scale)
+	if err != nil {
+		slog.ErrorContext(ctx, "error retrieving scale unit", "scale", scale, "error", err)
+		return http.StatusInternalServerError, utils.UNIT_RETRIEVAL_ERR
+	}
+	if unit == nil || scaleUnit == nil || unit.Kind != scaleUnit.Kind {
+		slog.WarnContext(ctx, "invalid display unit", "display_unit", displayUnit, "scale", scale)
+		return http.StatusBadRequest, utils.INVALID_DISPLAY_UNIT
+	}
+	return http.StatusOK, utils.NO_ERR
+}
+
+func generateCompoundId(ctx context.Context) string {
+	return utils.NewId(ctx, "C")
 }
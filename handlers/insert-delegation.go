@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/datetime"
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+type InsertDelegationReq struct {
+	DelegatorId string `json:"delegator_id"`
+	DelegateId  string `json:"delegate_id"`
+	FromDate    string `json:"from_date"`
+	ToDate      string `json:"to_date"`
+	Reason      string `json:"reason"`
+}
+
+// Lets a user hand their approvals to another user for a date range, e.g. while on leave.
+// Admins may set up delegations for anyone, other users only for themselves.
+func InsertDelegationHandler(w http.ResponseWriter, r *http.Request) {
+	reqBody := &InsertDelegationReq{}
+	if errStr := httpx.DecodeJsonReq(r, reqBody); errStr != utils.NO_ERR {
+		slog.ErrorContext(r.Context(), "failed to decode JSON request", "error", errStr)
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	actor := currentUser(r)
+	if reqBody.DelegatorId == "" {
+		reqBody.DelegatorId = actor.Id
+	}
+	if reqBody.DelegatorId != actor.Id && actor.Role != utils.ROLE_ADMIN {
+		slog.WarnContext(r.Context(), "delegation on behalf of another user", "actor_id", actor.Id, "delegator_id", reqBody.DelegatorId)
+		httpx.RespWithError(w, http.StatusForbidden, utils.FORBIDDEN_ROLE)
+		return
+	}
+
+	if errStr := validateDelegationReq(r.Context(), reqBody); errStr != utils.NO_ERR {
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	delegationId := generateDelegationId(r.Context())
+	if _, err := db.ConnFrom(r.Context()).ExecContext(r.Context(),
+		"INSERT INTO delegation (id, delegator_id, delegate_id, from_date, to_date, reason, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		delegationId, reqBody.DelegatorId, reqBody.DelegateId, reqBody.FromDate, reqBody.ToDate, reqBody.Reason, datetime.Now(r.Context()).Unix(),
+	); err != nil {
+		slog.ErrorContext(r.Context(), "error inserting delegation", "delegation_id", delegationId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.INSERT_DELEGATION_ERR)
+		return
+	}
+
+	utils.RecordAudit(r.Context(), nil, actor.Id, "delegation.create", utils.AUDIT_TARGET_DELEGATION, delegationId, reqBody)
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"delegation_id": delegationId,
+	})
+}
+
+func validateDelegationReq(ctx context.Context, reqBody *InsertDelegationReq) utils.ErrorMessage {
+	if reqBody.DelegateId == "" || reqBody.FromDate == "" || reqBody.ToDate == "" {
+		slog.ErrorContext(ctx, "missing required fields", "delegate_id", reqBody.DelegateId, "from_date", reqBody.FromDate, "to_date", reqBody.ToDate)
+		return utils.MISSING_REQUIRED_FIELDS
+	}
+
+	fromDate, err := time.Parse("2006-01-02", reqBody.FromDate)
+	if err != nil {
+		slog.ErrorContext(ctx, "invalid from_date format", "from_date", reqBody.FromDate, "error", err)
+		return utils.INVALID_DATE_FORMAT
+	}
+	toDate, err := time.Parse("2006-01-02", reqBody.ToDate)
+	if err != nil {
+		slog.ErrorContext(ctx, "invalid to_date format", "to_date", reqBody.ToDate, "error", err)
+		return utils.INVALID_DATE_FORMAT
+	}
+	if fromDate.After(toDate) {
+		slog.ErrorContext(ctx, "from_date is after to_date", "from_date", reqBody.FromDate, "to_date", reqBody.ToDate)
+		return utils.INVALID_DATE_RANGE
+	}
+
+	if reqBody.DelegateId == reqBody.DelegatorId {
+		slog.ErrorContext(ctx, "user delegating to themselves", "user_id", reqBody.DelegatorId)
+		return utils.INVALID_DELEGATION
+	}
+
+	for _, userId := range []string{reqBody.DelegatorId, reqBody.DelegateId} {
+		user, err := utils.GetUser(ctx, userId)
+		if err != nil {
+			slog.ErrorContext(ctx, "error getting user", "user_id", userId, "error", err)
+			return utils.USER_RETRIEVAL_ERR
+		}
+		if user == nil || !user.Active {
+			slog.ErrorContext(ctx, "user not found or inactive", "user_id", userId)
+			return utils.INVALID_USER_ID
+		}
+	}
+
+	return utils.NO_ERR
+}
+
+func generateDelegationId(ctx context.Context) string {
+	return utils.NewId(ctx, "D")
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/datetime"
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"database/sql"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Attaches a scan of the physical voucher to an entry, a PDF or an image uploaded in the multipart field "file".
+// An entry can have several, e.g. an invoice and its delivery note. Entries in the trash take none.
+// Admins, supervisors and operators only; every upload is audited.
+func InsertEntryAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	entryId := chi.URLParam(r, "id")
+
+	data, filename, err := readUploadedFile(w, r)
+	contentType, accepted := utils.VoucherContentType(data)
+	if err != nil || !accepted {
+		slog.WarnContext(r.Context(), "voucher scan is not a PDF or image within the size limit", "entry_id", entryId, "filename", filename, "content_type", contentType, "size", len(data), "error", err)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.INVALID_VOUCHER_FILE)
+		return
+	}
+
+	tx, err := db.ConnFrom(r.Context()).BeginTx(r.Context(), nil)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error starting transaction", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.TX_START_ERR)
+		return
+	}
+	defer tx.Rollback()
+
+	var compoundId string
+	err = tx.QueryRowContext(r.Context(), "SELECT compound_id FROM entry WHERE id = ? AND deleted_at IS NULL", entryId).Scan(&compoundId)
+	if err == sql.ErrNoRows {
+		slog.WarnContext(r.Context(), "entry not found", "entry_id", entryId)
+		httpx.RespWithError(w, http.StatusNotFound, utils.INVALID_ENTRY_ID)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error retrieving entry", "entry_id", entryId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.ENTRY_RETRIEVAL_ERR)
+		return
+	}
+
+	actorId := currentUser(r).Id
+	attachment := &utils.Attachment{
+		Id:          utils.NewId(r.Context(), "AT"),
+		CompoundId:  compoundId,
+		EntryId:     entryId,
+		Kind:        utils.ATTACHMENT_KIND_VOUCHER,
+		Filename:    filename,
+		ContentType: contentType,
+		UploadedBy:  actorId,
+		UploadedAt:  datetime.Now(r.Context()).Unix(),
+	}
+	if err := utils.SaveAttachment(r.Context(), tx, attachment, data); err != nil {
+		slog.ErrorContext(r.Context(), "failed to save voucher scan", "entry_id", entryId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.ATTACHMENT_SAVE_ERR)
+		return
+	}
+
+	utils.RecordAudit(r.Context(), tx, actorId, "entry.attachment_upload", utils.AUDIT_TARGET_ENTRY, entryId, map[string]any{
+		"attachment_id": attachment.Id,
+		"filename":      attachment.Filename,
+		"sha256":        attachment.Sha256,
+	})
+
+	if err := tx.Commit(); err != nil {
+		slog.ErrorContext(r.Context(), "error committing transaction", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.COMMIT_TRANSACTION_ERR)
+		return
+	}
+
+	httpx.RespWithData(w, http.StatusOK, attachment)
+}
@@ -1,158 +1,689 @@
 package handlers
 
 import (
+	"chemical-ledger-backend/datetime"
 	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/stock"
 	"chemical-ledger-backend/utils"
+	"context"
+	"database/sql"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"strings"
 	"time"
 )
 
 type InsertEntryReq struct {
-	Type            string `json:"type"`
-	CompoundId      string `json:"compound_id"`
-	Date            string `json:"date"`
-	Remark          string `json:"remark"`
-	VoucherNo       string `json:"voucher_no"`
-	NumOfUnits      int    `json:"num_of_units"`
-	QuantityPerUnit int    `json:"quantity_per_unit"`
+	Type            string             `json:"type"`
+	CompoundId      string             `json:"compound_id"`
+	Date            string             `json:"date"`
+	Remark          string             `json:"remark"`
+	VoucherNo       string             `json:"voucher_no"`
+	NumOfUnits      utils.LocalizedInt `json:"num_of_units"`
+	QuantityPerUnit utils.LocalizedInt `json:"quantity_per_unit"`
+	PacksPerUnit    utils.LocalizedInt `json:"packs_per_unit"`
+	PartialQuantity utils.LocalizedInt `json:"partial_quantity"`
+	LotNo           string             `json:"lot_no"`
+	Expiry          string             `json:"expiry"`
+	Supplier        string             `json:"supplier"`
+	LotId           string             `json:"lot_id"`
+	SupplierId      string             `json:"supplier_id"`
+	RecipientId     string             `json:"recipient_id"`
+	Reason          string             `json:"reason"`
+	// Instrument the chemicals were used for and whether for its "calibration" or "maintenance", outgoing entries only
+	InstrumentId    string `json:"instrument_id"`
+	InstrumentEvent string `json:"instrument_event"`
+	// Research project the chemicals were used for, outgoing entries only
+	ProjectId string `json:"project_id"`
+	// Cost of one unit as delivered, incoming entries only, for the valuation of the stock
+	UnitCost *float64 `json:"unit_cost,omitempty"`
+	// Purchase order line the delivery is received against, incoming entries only. The supplier defaults to the one
+	// the order is placed with.
+	PoLineId string `json:"po_line_id,omitempty"`
+	// How the waste was disposed of, one of utils.DisposalMethods, and who authorized it, disposal entries only
+	DisposalMethod       string `json:"disposal_method"`
+	DisposalAuthorizedBy string `json:"disposal_authorized_by"`
+	// Location the stock is added to or taken from, none for the stock kept without a location. Transfers move the
+	// stock from this location to "to_location_id".
+	LocationId   string `json:"location_id"`
+	ToLocationId string `json:"to_location_id"`
+	// Lets the entry leave the stock short within the day under the same-day grace, see stock.SameDayStockGrace
+	ConfirmShortfall bool `json:"confirm_shortfall,omitempty"`
+	// Records an incoming quantity above the plausible bound of the compound under LARGE_INCOMING_CHECK=confirm
+	ConfirmLargeQuantity bool `json:"confirm_large_quantity,omitempty"`
+	// Unit the quantities are given in when it is not the scale of the compound, see convertEntryUnit
+	Unit        string `json:"unit,omitempty"`
+	ConvertUnit bool   `json:"convert_unit,omitempty"`
 }
 
 func InsertEntryHandler(w http.ResponseWriter, r *http.Request) {
-	/* This part of the code is to prevent the trial period from exceeding the limit */
-	// const TRIAL_PERIOD_ENTRY_LIMIT = 20
-
-	// var totalEntries int
-	// if err := db.Conn.QueryRow("SELECT COUNT(*) FROM entry").Scan(&totalEntries); err != nil {
-	// 	slog.Error("error getting total entries", "error", err)
-	// 	utils.RespWithError(w, http.StatusInternalServerError, utils.ENTRY_RETRIEVAL_ERR)
-	// 	return
-	// }
-	// if totalEntries >= TRIAL_PERIOD_ENTRY_LIMIT {
-	// 	slog.Error("trial period limit exceeded", "total_entries", totalEntries)
-	// 	utils.RespWithError(w, http.StatusBadRequest, utils.TRIAL_PERIOD_LIMIT_EXCEEDED)
-	// 	return
-	// }
-	/* Trial Period code ends here */
+	if !checkQuota(r.Context(), w, utils.QUOTA_ENTRIES) {
+		return
+	}
 
 	reqBody := &InsertEntryReq{}
-	if errStr := utils.DecodeJsonReq(r, reqBody); errStr != utils.NO_ERR {
-		slog.Error("failed to decode JSON request", "error", errStr)
-		utils.RespWithError(w, http.StatusBadRequest, errStr)
+	if errStr := httpx.DecodeJsonReq(r, reqBody); errStr != utils.NO_ERR {
+		slog.ErrorContext(r.Context(), "failed to decode JSON request", "error", errStr)
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	if errStr := validateInsertEntryReq(r.Context(), reqBody); errStr != utils.NO_ERR {
+		slog.ErrorContext(r.Context(), "invalid insert entry request", "error", errStr)
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
 		return
 	}
 
-	if errStr := validateInsertEntryReq(reqBody); errStr != utils.NO_ERR {
-		slog.Error("invalid insert entry request", "error", errStr)
-		utils.RespWithError(w, http.StatusBadRequest, errStr)
+	if errStr := validateDate(r.Context(), reqBody.Date); errStr != utils.NO_ERR {
+		slog.ErrorContext(r.Context(), "invalid date format", "date", reqBody.Date, "error", errStr)
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
 		return
 	}
 
-	if errStr := validateDate(reqBody.Date); errStr != utils.NO_ERR {
-		slog.Error("invalid date format", "date", reqBody.Date, "error", errStr)
-		utils.RespWithError(w, http.StatusBadRequest, errStr)
+	if status, errStr := checkEntryDatesUnlocked(r.Context(), datetime.GetDateUnix(r.Context(), reqBody.Date)); errStr != utils.NO_ERR {
+		httpx.RespWithError(w, status, errStr)
 		return
 	}
 
-	compoundExists, err := utils.CheckIfCompoundExists(reqBody.CompoundId)
+	compoundExists, err := utils.CheckIfCompoundExists(r.Context(), reqBody.CompoundId)
 	if err != nil {
-		slog.Error("error checking if compound exists", "compound_id", reqBody.CompoundId, "error", err)
-		utils.RespWithError(w, http.StatusInternalServerError, utils.COMPOUND_ID_CHECK_ERR)
+		slog.ErrorContext(r.Context(), "error checking if compound exists", "compound_id", reqBody.CompoundId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.COMPOUND_ID_CHECK_ERR)
 		return
 	}
 	if !compoundExists {
-		slog.Error("compound not found", "compound_id", reqBody.CompoundId)
-		utils.RespWithError(w, http.StatusNotFound, utils.INVALID_COMPOUND_ID)
+		slog.ErrorContext(r.Context(), "compound not found", "compound_id", reqBody.CompoundId)
+		httpx.RespWithError(w, http.StatusNotFound, utils.INVALID_COMPOUND_ID)
+		return
+	}
+
+	if status, errStr := convertEntryUnit(r.Context(), reqBody); errStr != utils.NO_ERR {
+		httpx.RespWithError(w, status, errStr)
 		return
 	}
 
-	tx, err := db.Conn.Begin()
+	unlock := stock.LockCompounds(reqBody.CompoundId)
+	defer unlock()
+
+	tx, err := db.ConnFrom(r.Context()).BeginTx(r.Context(), nil)
 	if err != nil {
-		slog.Error("error starting transaction", "error", err)
-		utils.RespWithError(w, http.StatusInternalServerError, utils.TX_START_ERR)
+		slog.ErrorContext(r.Context(), "error starting transaction", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.TX_START_ERR)
 		return
 	}
 	defer tx.Rollback()
 
-	quantityId := generateQuantityId()
-	if _, err := tx.Exec("INSERT INTO quantity (id, num_of_units, quantity_per_unit) VALUES (?, ?, ?)", quantityId, reqBody.NumOfUnits, reqBody.QuantityPerUnit); err != nil {
-		slog.Error("error inserting quantity", "quantity_id", quantityId, "num_of_units", reqBody.NumOfUnits, "quantity_per_unit", reqBody.QuantityPerUnit, "error", err)
-		utils.RespWithError(w, http.StatusInternalServerError, utils.INSERT_QUANTITY_ERR)
+	quantityId := generateQuantityId(r.Context())
+	if _, err := tx.ExecContext(r.Context(), "INSERT INTO quantity (id, num_of_units, packs_per_unit, quantity_per_unit, partial_quantity) VALUES (?, ?, ?, ?, ?)", quantityId, reqBody.NumOfUnits, reqBody.PacksPerUnit, reqBody.QuantityPerUnit, reqBody.PartialQuantity); err != nil {
+		slog.ErrorContext(r.Context(), "error inserting quantity", "quantity_id", quantityId, "num_of_units", reqBody.NumOfUnits, "packs_per_unit", reqBody.PacksPerUnit, "quantity_per_unit", reqBody.QuantityPerUnit, "partial_quantity", reqBody.PartialQuantity, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.INSERT_QUANTITY_ERR)
 		return
 	}
 
-	entryDate := utils.GetDateUnix(reqBody.Date)
-	currentTxQuantity := reqBody.NumOfUnits * reqBody.QuantityPerUnit
-	entryId := generateEntryId()
+	entryDate := datetime.GetDateUnix(r.Context(), reqBody.Date)
+	currentTxQuantity := utils.GetTotalQuantity(int(reqBody.NumOfUnits), int(reqBody.PacksPerUnit), int(reqBody.QuantityPerUnit), int(reqBody.PartialQuantity))
+	entryId := generateEntryId(r.Context())
+	actor := currentUser(r)
+	status := utils.ENTRY_STATUS_APPROVED
+	if utils.EntryNeedsApproval(actor.Role) {
+		status = utils.ENTRY_STATUS_PENDING
+	}
+
+	duplicateId := ""
+	if check := utils.DuplicateVoucherCheck(); check != utils.DUPLICATE_CHECK_OFF {
+		duplicateId, err = utils.FindDuplicateEntry(r.Context(), tx, reqBody.CompoundId, entryDate, reqBody.VoucherNo, entryId)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "error checking for duplicate entry", "compound_id", reqBody.CompoundId, "voucher_no", reqBody.VoucherNo, "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.DUPLICATE_CHECK_ERR)
+			return
+		}
+		if duplicateId != "" && check == utils.DUPLICATE_CHECK_REJECT {
+			slog.WarnContext(r.Context(), "duplicate entry rejected", "compound_id", reqBody.CompoundId, "voucher_no", reqBody.VoucherNo, "duplicate_of", duplicateId)
+			httpx.EncodeJsonRes(w, http.StatusConflict, &httpx.Resp{Error: utils.DUPLICATE_VOUCHER_ENTRY, Data: map[string]any{
+				"duplicate_of": duplicateId,
+			}})
+			return
+		}
+	}
 
-	if _, err := tx.Exec(
-		"INSERT INTO entry (id, type, compound_id, date, remark, voucher_no, quantity_id, net_stock) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
-		entryId, reqBody.Type, reqBody.CompoundId, entryDate, reqBody.Remark, reqBody.VoucherNo, quantityId, currentTxQuantity,
+	largeIncomingBound, ok := checkLargeIncoming(r.Context(), w, tx, reqBody, entryDate, currentTxQuantity)
+	if !ok {
+		return
+	}
+
+	if _, err := tx.ExecContext(r.Context(),
+		"INSERT INTO entry (id, type, compound_id, date, remark, voucher_no, quantity_id, net_stock, lot_id, supplier_id, recipient_id, reason, instrument_id, instrument_event, disposal_method, disposal_authorized_by, location_id, to_location_id, project_id, unit_cost, po_line_id, large_incoming_bound, status, created_by, seq) VALUES (?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), ?, NULLIF(?, ''), NULLIF(?, 0), ?, ?, "+utils.NEXT_ENTRY_SEQ+")",
+		entryId, reqBody.Type, reqBody.CompoundId, entryDate, reqBody.Remark, reqBody.VoucherNo, quantityId, currentTxQuantity, reqBody.LotId, reqBody.SupplierId, reqBody.RecipientId, reqBody.Reason, reqBody.InstrumentId, reqBody.InstrumentEvent, reqBody.DisposalMethod, reqBody.DisposalAuthorizedBy, reqBody.LocationId, reqBody.ToLocationId, reqBody.ProjectId, reqBody.UnitCost, reqBody.PoLineId, largeIncomingBound, status, actor.Id,
 	); err != nil {
-		slog.Error("error inserting entry",
+		slog.ErrorContext(r.Context(), "error inserting entry",
 			"entry_id", entryId,
 			"compound_id", reqBody.CompoundId,
 			"quantity_id", quantityId,
 			"date", reqBody.Date,
 			"error", err,
 		)
-		utils.RespWithError(w, http.StatusInternalServerError, utils.INSERT_ENTRY_ERR)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.INSERT_ENTRY_ERR)
 		return
 	}
 
-	if errStr := utils.UpdateNetStockFromTodayOnwards(tx, reqBody.CompoundId, entryDate); errStr != utils.NO_ERR {
-		slog.Error("error updating net stock", "compound_id", reqBody.CompoundId, "date", reqBody.Date, "error", errStr)
-		utils.RespWithError(w, http.StatusInternalServerError, errStr)
+	if utils.IsInwardEntryType(reqBody.Type) {
+		lotId := generateLotId(r.Context())
+		if _, err := tx.ExecContext(r.Context(),
+			"INSERT INTO lot (id, compound_id, entry_id, lot_no, expiry, supplier) VALUES (?, ?, ?, ?, ?, ?)",
+			lotId, reqBody.CompoundId, entryId, reqBody.LotNo, reqBody.Expiry, reqBody.Supplier,
+		); err != nil {
+			slog.ErrorContext(r.Context(), "error inserting lot", "lot_id", lotId, "entry_id", entryId, "lot_no", reqBody.LotNo, "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.INSERT_ENTRY_ERR)
+			return
+		}
+	}
+
+	recalculate := stock.UpdateNetStockFromTodayOnwards
+	if reqBody.ConfirmShortfall {
+		recalculate = stock.UpdateNetStockConfirmingShortfall
+	}
+	if errStr := recalculate(r.Context(), tx, reqBody.CompoundId, entryDate); errStr != utils.NO_ERR {
+		slog.ErrorContext(r.Context(), "error updating net stock", "compound_id", reqBody.CompoundId, "date", reqBody.Date, "error", errStr)
+		if errStr == utils.INSUFFICIENT_STOCK_ERR && utils.IsOutwardEntryType(reqBody.Type) {
+			respWithSubstitutes(r.Context(), w, tx, reqBody.CompoundId, currentTxQuantity, errStr)
+			return
+		}
+		httpx.RespWithError(w, recalculationErrStatus(errStr), errStr)
 		return
 	}
 
 	if err := tx.Commit(); err != nil {
-		slog.Error("error committing transaction", "error", err)
-		utils.RespWithError(w, http.StatusInternalServerError, utils.COMMIT_TRANSACTION_ERR)
+		slog.ErrorContext(r.Context(), "error committing transaction", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.COMMIT_TRANSACTION_ERR)
 		return
 	}
 
-	utils.RespWithData(w, http.StatusOK, map[string]any{
+	resp := map[string]any{
 		"entry_id": entryId,
-	})
+		"status":   status,
+	}
+	if duplicateId != "" {
+		resp["duplicate_of"] = duplicateId
+	}
+	if largeIncomingBound != 0 {
+		resp["large_quantity"] = map[string]any{"quantity": currentTxQuantity, "max_incoming": largeIncomingBound}
+	}
+	// The entry is in, so failing to read the warning only leaves it out
+	if warning, err := utils.GetCompoundPinnedWarning(r.Context(), reqBody.CompoundId); err != nil {
+		slog.ErrorContext(r.Context(), "error retrieving compound pinned warning", "compound_id", reqBody.CompoundId, "error", err)
+	} else if warning != "" {
+		resp["warning"] = warning
+	}
+	httpx.RespWithData(w, http.StatusOK, resp)
+}
+
+// Checks an incoming entry against the plausible bound of its compound, see utils.LargeIncomingBound. Returns the
+// bound when the quantity is above it, so the entry is flagged with it, or 0 when it is not. Under
+// LARGE_INCOMING_CHECK=confirm an entry above it is refused with the bound until "confirm_large_quantity" is sent.
+// Returns false when it has answered the request.
+func checkLargeIncoming(ctx context.Context, w http.ResponseWriter, tx *sql.Tx, reqBody *InsertEntryReq, date int64, quantity int) (int, bool) {
+	check := utils.LargeIncomingCheck()
+	if reqBody.Type != utils.ENTRY_TYPE_INCOMING || check == utils.LARGE_INCOMING_OFF {
+		return 0, true
+	}
+
+	bound, err := utils.LargeIncomingBound(ctx, tx, reqBody.CompoundId, date)
+	if err != nil {
+		slog.ErrorContext(ctx, "error checking for large incoming quantity", "compound_id", reqBody.CompoundId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.LARGE_INCOMING_CHECK_ERR)
+		return 0, false
+	}
+	if bound == 0 || quantity <= bound {
+		return 0, true
+	}
+
+	if check == utils.LARGE_INCOMING_CONFIRM && !reqBody.ConfirmLargeQuantity {
+		slog.WarnContext(ctx, "unconfirmed large incoming quantity", "compound_id", reqBody.CompoundId, "quantity", quantity, "max_incoming", bound)
+		httpx.EncodeJsonRes(w, http.StatusConflict, &httpx.Resp{Error: utils.LARGE_INCOMING_QUANTITY, Data: map[string]any{
+			"quantity":     quantity,
+			"max_incoming": bound,
+		}})
+		return 0, false
+	}
+	slog.WarnContext(ctx, "large incoming quantity recorded", "compound_id", reqBody.CompoundId, "quantity", quantity, "max_incoming", bound)
+	return bound, true
+}
+
+// Converts the quantities of an entry given in another "unit" than the scale of its compound, e.g. kg for a compound
+// measured in g. Units of the other kind are refused, so ml never end up counted as g. Conversions are only made
+// with "convert_unit" set, without it the error offers the converted quantities.
+// Returns the status code to answer with when it fails.
+func convertEntryUnit(ctx context.Context, reqBody *InsertEntryReq) (int, utils.ErrorMessage) {
+	if reqBody.Unit == "" {
+		return http.StatusOK, utils.NO_ERR
+	}
+
+	unit, err := utils.ParseQuantityUnit(ctx, reqBody.Unit)
+	if err != nil {
+		slog.ErrorContext(ctx, "error retrieving quantity unit", "unit", reqBody.Unit, "error", err)
+		return http.StatusInternalServerError, utils.UNIT_RETRIEVAL_ERR
+	}
+	if unit == nil {
+		slog.WarnContext(ctx, "unrecognized quantity unit", "unit", reqBody.Unit)
+		return http.StatusBadRequest, utils.INVALID_QUANTITY_UNIT
+	}
+
+	scale, err := utils.GetCompoundScale(ctx, reqBody.CompoundId)
+	if err != nil {
+		slog.ErrorContext(ctx, "error retrieving compound scale", "compound_id", reqBody.CompoundId, "error", err)
+		return http.StatusInternalServerError, utils.COMPOUND_RETRIEVAL_ERR
+	}
+	scaleUnit, err := utils.GetQuantityUnit(ctx, scale)
+	if err != nil || scaleUnit == nil {
+		slog.ErrorContext(ctx, "error retrieving unit of compound scale", "compound_id", reqBody.CompoundId, "scale", scale, "error", err)
+		return http.StatusInternalServerError, utils.UNIT_RETRIEVAL_ERR
+	}
+
+	quantityPerUnit, errStr := utils.ConvertToScale(int(reqBody.QuantityPerUnit), unit, scaleUnit)
+	if errStr != utils.NO_ERR {
+		slog.WarnContext(ctx, "quantity does not convert to compound scale", "compound_id", reqBody.CompoundId, "unit", unit.Name, "scale", scale)
+		return http.StatusBadRequest, errStr
+	}
+	partialQuantity, errStr := utils.ConvertToScale(int(reqBody.PartialQuantity), unit, scaleUnit)
+	if errStr != utils.NO_ERR {
+		slog.WarnContext(ctx, "partial quantity does not convert to compound scale", "compound_id", reqBody.CompoundId, "unit", unit.Name, "scale", scale)
+		return http.StatusBadRequest, errStr
+	}
+
+	if unit.Name != scale && !reqBody.ConvertUnit {
+		offers := []string{}
+		if reqBody.QuantityPerUnit != 0 {
+			offers = append(offers, fmt.Sprintf("%d %s per unit is %d %s", reqBody.QuantityPerUnit, unit.Name, quantityPerUnit, scale))
+		}
+		if reqBody.PartialQuantity != 0 {
+			offers = append(offers, fmt.Sprintf("a partial %d %s is %d %s", reqBody.PartialQuantity, unit.Name, partialQuantity, scale))
+		}
+		slog.WarnContext(ctx, "unconfirmed unit conversion", "compound_id", reqBody.CompoundId, "unit", unit.Name, "scale", scale)
+		return http.StatusBadRequest, utils.ErrorMessage(fmt.Sprintf("%s (%s)", utils.UNIT_CONVERSION_NEEDED, strings.Join(offers, ", ")))
+	}
+
+	// The entry is kept in the scale of its compound
+	reqBody.QuantityPerUnit, reqBody.PartialQuantity = utils.LocalizedInt(quantityPerUnit), utils.LocalizedInt(partialQuantity)
+	reqBody.Unit, reqBody.ConvertUnit = "", false
+	return http.StatusOK, utils.NO_ERR
+}
+
+// Answers an outgoing entry the compound does not have the stock for with the compounds of its category that do,
+// as "substitutes", so another grade can be offered straight away. Failing to find them only leaves them out.
+func respWithSubstitutes(ctx context.Context, w http.ResponseWriter, tx *sql.Tx, compoundId string, quantity int, errStr utils.ErrorMessage) {
+	substitutes, err := utils.FindSubstitutes(ctx, tx, compoundId, quantity)
+	if err != nil {
+		slog.ErrorContext(ctx, "error finding substitutes", "compound_id", compoundId, "error", err)
+		httpx.RespWithError(w, http.StatusNotAcceptable, errStr)
+		return
+	}
+	httpx.EncodeJsonRes(w, http.StatusNotAcceptable, &httpx.Resp{Error: errStr, Data: map[string]any{
+		"substitutes": substitutes,
+	}})
 }
 
-func validateInsertEntryReq(reqBody *InsertEntryReq) utils.ErrorMessage {
-	if reqBody.Type == "" || reqBody.CompoundId == "" || reqBody.Date == "" || reqBody.NumOfUnits == 0 || reqBody.QuantityPerUnit == 0 {
-		slog.Error("missing required fields in entry request", "request", reqBody)
+func validateInsertEntryReq(ctx context.Context, reqBody *InsertEntryReq) utils.ErrorMessage {
+	if reqBody.Type == "" || reqBody.CompoundId == "" || reqBody.Date == "" || ((reqBody.NumOfUnits == 0 || reqBody.QuantityPerUnit == 0) && reqBody.PartialQuantity == 0) {
+		slog.ErrorContext(ctx, "missing required fields in entry request", "request", reqBody)
 		return utils.MISSING_REQUIRED_FIELDS
 	}
 
-	if reqBody.Type != utils.ENTRY_TYPE_INCOMING && reqBody.Type != utils.ENTRY_TYPE_OUTGOING {
-		slog.Error("invalid entry type", "received_type", reqBody.Type)
+	if !utils.IsValidEntryType(reqBody.Type) {
+		slog.ErrorContext(ctx, "invalid entry type", "received_type", reqBody.Type)
 		return utils.INVALID_ENTRY_TYPE
 	}
 
+	if errStr := validateReasonField(ctx, reqBody); errStr != utils.NO_ERR {
+		return errStr
+	}
+
+	if errStr := validateDisposalFields(ctx, reqBody); errStr != utils.NO_ERR {
+		return errStr
+	}
+
+	if errStr := validatePackagingField(ctx, reqBody); errStr != utils.NO_ERR {
+		return errStr
+	}
+
+	if errStr := validateLotFields(ctx, reqBody); errStr != utils.NO_ERR {
+		return errStr
+	}
+
+	if errStr := validatePoLineField(ctx, reqBody); errStr != utils.NO_ERR {
+		return errStr
+	}
+
+	if errStr := validateSupplierField(ctx, reqBody); errStr != utils.NO_ERR {
+		return errStr
+	}
+
+	if errStr := validateUnitCostField(ctx, reqBody); errStr != utils.NO_ERR {
+		return errStr
+	}
+
+	if errStr := validateRecipientField(ctx, reqBody); errStr != utils.NO_ERR {
+		return errStr
+	}
+
+	if errStr := validateInstrumentFields(ctx, reqBody); errStr != utils.NO_ERR {
+		return errStr
+	}
+
+	if errStr := validateProjectField(ctx, reqBody); errStr != utils.NO_ERR {
+		return errStr
+	}
+
+	return validateLocationFields(ctx, reqBody)
+}
+
+// Packs per unit is the optional middle packaging level (e.g. 6 bottles per box) and defaults to 1.
+// A partial quantity is drawn from an already open unit, e.g. 150 ml from a 500 ml bottle, so only outgoing
+// entries and adjustments out can have one. It can come on top of whole units or on its own.
+func validatePackagingField(ctx context.Context, reqBody *InsertEntryReq) utils.ErrorMessage {
+	if reqBody.NumOfUnits < 0 || reqBody.QuantityPerUnit < 0 {
+		slog.ErrorContext(ctx, "negative quantity", "num_of_units", reqBody.NumOfUnits, "quantity_per_unit", reqBody.QuantityPerUnit)
+		return utils.MISSING_REQUIRED_FIELDS
+	}
+	if reqBody.PartialQuantity < 0 || (reqBody.PartialQuantity > 0 && !utils.IsOutwardEntryType(reqBody.Type)) {
+		slog.ErrorContext(ctx, "invalid partial quantity", "type", reqBody.Type, "partial_quantity", reqBody.PartialQuantity)
+		return utils.INVALID_PARTIAL_QUANTITY
+	}
+	if reqBody.PacksPerUnit < 0 {
+		slog.ErrorContext(ctx, "invalid packs per unit", "packs_per_unit", reqBody.PacksPerUnit)
+		return utils.INVALID_PACKS_PER_UNIT
+	}
+	if reqBody.PacksPerUnit == 0 {
+		reqBody.PacksPerUnit = 1
+	}
+	return utils.NO_ERR
+}
+
+// Adjustments correct the stock to a physical count, so they must say why. Other entries have no reason.
+func validateReasonField(ctx context.Context, reqBody *InsertEntryReq) utils.ErrorMessage {
+	reqBody.Reason = strings.TrimSpace(reqBody.Reason)
+
+	if utils.IsAdjustmentEntryType(reqBody.Type) && reqBody.Reason == "" {
+		slog.ErrorContext(ctx, "adjustment without a reason", "type", reqBody.Type)
+		return utils.MISSING_ADJUSTMENT_REASON
+	}
+	if !utils.IsAdjustmentEntryType(reqBody.Type) && reqBody.Reason != "" {
+		slog.ErrorContext(ctx, "reason given on a non adjustment entry", "type", reqBody.Type, "reason", reqBody.Reason)
+		return utils.REASON_ON_NON_ADJUSTMENT
+	}
+
+	return utils.NO_ERR
+}
+
+// Disposals are filed with the environmental authority, so they must say how the waste was disposed of and who
+// authorized it. Other entries have neither.
+func validateDisposalFields(ctx context.Context, reqBody *InsertEntryReq) utils.ErrorMessage {
+	reqBody.DisposalMethod = strings.TrimSpace(reqBody.DisposalMethod)
+	reqBody.DisposalAuthorizedBy = strings.TrimSpace(reqBody.DisposalAuthorizedBy)
+
+	if reqBody.Type != utils.ENTRY_TYPE_DISPOSAL {
+		if reqBody.DisposalMethod != "" || reqBody.DisposalAuthorizedBy != "" {
+			slog.ErrorContext(ctx, "disposal fields given on a non disposal entry", "type", reqBody.Type, "disposal_method", reqBody.DisposalMethod)
+			return utils.DISPOSAL_FIELDS_ON_NON_DISPOSAL
+		}
+		return utils.NO_ERR
+	}
+
+	if reqBody.DisposalMethod == "" || reqBody.DisposalAuthorizedBy == "" {
+		slog.ErrorContext(ctx, "disposal without method or authorizer", "disposal_method", reqBody.DisposalMethod, "disposal_authorized_by", reqBody.DisposalAuthorizedBy)
+		return utils.MISSING_DISPOSAL_FIELDS
+	}
+	if !utils.IsValidDisposalMethod(reqBody.DisposalMethod) {
+		slog.ErrorContext(ctx, "invalid disposal method", "disposal_method", reqBody.DisposalMethod)
+		return utils.INVALID_DISPOSAL_METHOD
+	}
+
+	return utils.NO_ERR
+}
+
+func validateLotFields(ctx context.Context, reqBody *InsertEntryReq) utils.ErrorMessage {
+	hasLotDetails := reqBody.LotNo != "" || reqBody.Expiry != "" || reqBody.Supplier != ""
+	if (utils.IsInwardEntryType(reqBody.Type) && reqBody.LotId != "") || (utils.IsOutwardEntryType(reqBody.Type) && hasLotDetails) ||
+		(reqBody.Type == utils.ENTRY_TYPE_TRANSFER && (reqBody.LotId != "" || hasLotDetails)) {
+		slog.ErrorContext(ctx, "lot fields do not match the entry type", "type", reqBody.Type, "lot_id", reqBody.LotId, "lot_no", reqBody.LotNo)
+		return utils.INVALID_LOT_FIELDS
+	}
+
+	if reqBody.Expiry != "" {
+		if _, err := time.Parse("2006-01-02", reqBody.Expiry); err != nil {
+			slog.ErrorContext(ctx, "invalid expiry format", "expiry", reqBody.Expiry, "error", err)
+			return utils.INVALID_DATE_FORMAT
+		}
+	}
+
+	return utils.NO_ERR
+}
+
+func validateSupplierField(ctx context.Context, reqBody *InsertEntryReq) utils.ErrorMessage {
+	if reqBody.SupplierId == "" {
+		return utils.NO_ERR
+	}
+
+	if reqBody.Type != utils.ENTRY_TYPE_INCOMING {
+		slog.ErrorContext(ctx, "supplier given on a non incoming entry", "type", reqBody.Type, "supplier_id", reqBody.SupplierId)
+		return utils.SUPPLIER_ON_OUTGOING
+	}
+
+	supplierExists, err := utils.CheckIfSupplierExists(ctx, reqBody.SupplierId)
+	if err != nil {
+		slog.ErrorContext(ctx, "error checking if supplier exists", "supplier_id", reqBody.SupplierId, "error", err)
+		return utils.SUPPLIER_RETRIEVAL_ERR
+	}
+	if !supplierExists {
+		slog.ErrorContext(ctx, "supplier not found", "supplier_id", reqBody.SupplierId)
+		return utils.INVALID_SUPPLIER_ID
+	}
+
+	return utils.NO_ERR
+}
+
+func validatePoLineField(ctx context.Context, reqBody *InsertEntryReq) utils.ErrorMessage {
+	if reqBody.PoLineId == "" {
+		return utils.NO_ERR
+	}
+
+	if reqBody.Type != utils.ENTRY_TYPE_INCOMING {
+		slog.ErrorContext(ctx, "purchase order line given on a non incoming entry", "type", reqBody.Type, "po_line_id", reqBody.PoLineId)
+		return utils.PO_LINE_ON_NON_INCOMING
+	}
+
+	var compoundId, supplierId, status string
+	err := db.ConnFrom(ctx).QueryRowContext(ctx, `
+		SELECT l.compound_id, o.supplier_id, o.status
+		FROM purchase_order_line l
+		JOIN purchase_order o ON l.purchase_order_id = o.id
+		WHERE l.id = ?`,
+		reqBody.PoLineId,
+	).Scan(&compoundId, &supplierId, &status)
+	if err == sql.ErrNoRows {
+		slog.ErrorContext(ctx, "purchase order line not found", "po_line_id", reqBody.PoLineId)
+		return utils.INVALID_PO_LINE_ID
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "error retrieving purchase order line", "po_line_id", reqBody.PoLineId, "error", err)
+		return utils.PURCHASE_ORDER_RETRIEVAL_ERR
+	}
+
+	switch {
+	case status == utils.PO_STATUS_CANCELLED:
+		slog.ErrorContext(ctx, "delivery against a cancelled purchase order", "po_line_id", reqBody.PoLineId)
+		return utils.PURCHASE_ORDER_CANCELLED
+	case compoundId != reqBody.CompoundId:
+		slog.ErrorContext(ctx, "purchase order line for another compound", "po_line_id", reqBody.PoLineId, "line_compound_id", compoundId, "compound_id", reqBody.CompoundId)
+		return utils.PO_LINE_COMPOUND_MISMATCH
+	case reqBody.SupplierId != "" && reqBody.SupplierId != supplierId:
+		slog.ErrorContext(ctx, "purchase order placed with another supplier", "po_line_id", reqBody.PoLineId, "order_supplier_id", supplierId, "supplier_id", reqBody.SupplierId)
+		return utils.PO_LINE_SUPPLIER_MISMATCH
+	}
+
+	reqBody.SupplierId = supplierId
+	return utils.NO_ERR
+}
+
+func validateUnitCostField(ctx context.Context, reqBody *InsertEntryReq) utils.ErrorMessage {
+	if reqBody.UnitCost == nil {
+		return utils.NO_ERR
+	}
+
+	if reqBody.Type != utils.ENTRY_TYPE_INCOMING {
+		slog.ErrorContext(ctx, "unit cost given on a non incoming entry", "type", reqBody.Type, "unit_cost", *reqBody.UnitCost)
+		return utils.UNIT_COST_ON_NON_INCOMING
+	}
+	if *reqBody.UnitCost < 0 {
+		slog.ErrorContext(ctx, "invalid unit cost", "unit_cost", *reqBody.UnitCost)
+		return utils.INVALID_UNIT_COST
+	}
+
 	return utils.NO_ERR
 }
 
-func validateDate(date string) utils.ErrorMessage {
+func validateRecipientField(ctx context.Context, reqBody *InsertEntryReq) utils.ErrorMessage {
+	if reqBody.RecipientId == "" {
+		return utils.NO_ERR
+	}
+
+	if reqBody.Type != utils.ENTRY_TYPE_OUTGOING {
+		slog.ErrorContext(ctx, "recipient given on a non outgoing entry", "type", reqBody.Type, "recipient_id", reqBody.RecipientId)
+		return utils.RECIPIENT_ON_INCOMING
+	}
+
+	recipientExists, err := utils.CheckIfRecipientExists(ctx, reqBody.RecipientId)
+	if err != nil {
+		slog.ErrorContext(ctx, "error checking if recipient exists", "recipient_id", reqBody.RecipientId, "error", err)
+		return utils.RECIPIENT_RETRIEVAL_ERR
+	}
+	if !recipientExists {
+		slog.ErrorContext(ctx, "recipient not found", "recipient_id", reqBody.RecipientId)
+		return utils.INVALID_RECIPIENT_ID
+	}
+
+	return utils.NO_ERR
+}
+
+func validateInstrumentFields(ctx context.Context, reqBody *InsertEntryReq) utils.ErrorMessage {
+	switch reqBody.InstrumentEvent {
+	case "", utils.INSTRUMENT_EVENT_CALIBRATION, utils.INSTRUMENT_EVENT_MAINTENANCE:
+	default:
+		slog.ErrorContext(ctx, "invalid instrument event", "instrument_event", reqBody.InstrumentEvent)
+		return utils.INVALID_INSTRUMENT_EVENT
+	}
+
+	if reqBody.InstrumentId == "" {
+		if reqBody.InstrumentEvent != "" {
+			slog.ErrorContext(ctx, "instrument event without instrument", "instrument_event", reqBody.InstrumentEvent)
+			return utils.INSTRUMENT_EVENT_ALONE
+		}
+		return utils.NO_ERR
+	}
+
+	if reqBody.Type != utils.ENTRY_TYPE_OUTGOING {
+		slog.ErrorContext(ctx, "instrument given on a non outgoing entry", "type", reqBody.Type, "instrument_id", reqBody.InstrumentId)
+		return utils.INSTRUMENT_ON_INCOMING
+	}
+
+	instrumentExists, err := utils.CheckIfInstrumentExists(ctx, reqBody.InstrumentId)
+	if err != nil {
+		slog.ErrorContext(ctx, "error checking if instrument exists", "instrument_id", reqBody.InstrumentId, "error", err)
+		return utils.INSTRUMENT_RETRIEVAL_ERR
+	}
+	if !instrumentExists {
+		slog.ErrorContext(ctx, "instrument not found", "instrument_id", reqBody.InstrumentId)
+		return utils.INVALID_INSTRUMENT_ID
+	}
+
+	return utils.NO_ERR
+}
+
+func validateProjectField(ctx context.Context, reqBody *InsertEntryReq) utils.ErrorMessage {
+	if reqBody.ProjectId == "" {
+		return utils.NO_ERR
+	}
+
+	if reqBody.Type != utils.ENTRY_TYPE_OUTGOING {
+		slog.ErrorContext(ctx, "project given on a non outgoing entry", "type", reqBody.Type, "project_id", reqBody.ProjectId)
+		return utils.PROJECT_ON_INCOMING
+	}
+
+	projectExists, err := utils.CheckIfProjectExists(ctx, reqBody.ProjectId)
+	if err != nil {
+		slog.ErrorContext(ctx, "error checking if project exists", "project_id", reqBody.ProjectId, "error", err)
+		return utils.PROJECT_RETRIEVAL_ERR
+	}
+	if !projectExists {
+		slog.ErrorContext(ctx, "project not found", "project_id", reqBody.ProjectId)
+		return utils.INVALID_PROJECT_ID
+	}
+
+	return utils.NO_ERR
+}
+
+// Transfers must say where the stock goes, and it must be another location than where it is taken from. Entries of
+// other types only have a location.
+func validateLocationFields(ctx context.Context, reqBody *InsertEntryReq) utils.ErrorMessage {
+	if reqBody.Type != utils.ENTRY_TYPE_TRANSFER && reqBody.ToLocationId != "" {
+		slog.ErrorContext(ctx, "location to move to given on a non transfer entry", "type", reqBody.Type, "to_location_id", reqBody.ToLocationId)
+		return utils.TO_LOCATION_ON_NON_TRANSFER
+	}
+	if reqBody.Type == utils.ENTRY_TYPE_TRANSFER {
+		if reqBody.ToLocationId == "" {
+			slog.ErrorContext(ctx, "transfer without the location to move to", "location_id", reqBody.LocationId)
+			return utils.MISSING_TRANSFER_LOCATION
+		}
+		if reqBody.ToLocationId == reqBody.LocationId {
+			slog.ErrorContext(ctx, "transfer to the location it is taken from", "location_id", reqBody.LocationId)
+			return utils.SAME_TRANSFER_LOCATION
+		}
+	}
+
+	for _, locationId := range []string{reqBody.LocationId, reqBody.ToLocationId} {
+		if locationId == "" {
+			continue
+		}
+		locationExists, err := utils.CheckIfLocationExists(ctx, locationId)
+		if err != nil {
+			slog.ErrorContext(ctx, "error checking if location exists", "location_id", locationId, "error", err)
+			return utils.LOCATION_RETRIEVAL_ERR
+		}
+		if !locationExists {
+			slog.ErrorContext(ctx, "location not found", "location_id", locationId)
+			return utils.INVALID_LOCATION_ID
+		}
+	}
+
+	return utils.NO_ERR
+}
+
+func validateDate(ctx context.Context, date string) utils.ErrorMessage {
 	loc := time.FixedZone("IST", 5*60*60+30*60) // +05:30 IST
 
 	parsed, err := time.ParseInLocation("2006-01-02", date, loc)
 	if err != nil {
-		slog.Error("date parsing failed", "date", date, "error", err)
+		slog.ErrorContext(ctx, "date parsing failed", "date", date, "error", err)
 		return utils.INVALID_DATE_FORMAT
 	}
 
-	if parsed.Unix() > time.Now().Unix() {
-		slog.Error("future date provided", "date", date)
+	if parsed.Unix() > datetime.Now(ctx).Unix() {
+		slog.ErrorContext(ctx, "future date provided", "date", date)
 		return utils.FUTURE_DATE_ERR
 	}
 
 	return utils.NO_ERR
 }
 
-func generateQuantityId() string {
-	return fmt.Sprintf("Q_%d", time.Now().Unix())
+func generateQuantityId(ctx context.Context) string {
+	return utils.NewId(ctx, "Q")
+}
+
+func generateEntryId(ctx context.Context) string {
+	return utils.NewId(ctx, "E")
 }
 
-func generateEntryId() string {
-	return fmt.Sprintf("E_%d", time.Now().Unix())
+func generateLotId(ctx context.Context) string {
+	return utils.NewId(ctx, "L")
 }
@@ -0,0 +1,385 @@
+package handlers_test
+
+import (
+	"chemical-ledger-backend/handlers"
+	"chemical-ledger-backend/testutils"
+	"chemical-ledger-backend/utils"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func insertEntry(env *testutils.Env, entryType string, compoundId string, date string, quantity int) *httptest.ResponseRecorder {
+	body := fmt.Sprintf(
+		`{"type": %q, "compound_id": %q, "date": %q, "num_of_units": 1, "quantity_per_unit": %d}`,
+		entryType, compoundId, date, quantity,
+	)
+	w := httptest.NewRecorder()
+	handlers.InsertEntryHandler(w, env.Request(http.MethodPost, "/insert-entry", strings.NewReader(body)))
+	return w
+}
+
+// The entries share the same second, so every insert recalculates the entries the others inserted before it
+func TestConcurrentInsertsKeepRunningBalance(t *testing.T) {
+	t.Parallel()
+	env := testutils.NewEnv(t, time.Date(2026, 3, 14, 10, 0, 0, 0, time.Local))
+
+	env.InsertCompound("C_1", "Acetone", "ml")
+	if w := insertEntry(env, utils.ENTRY_TYPE_INCOMING, "C_1", "2026-03-13", 1000); w.Code != http.StatusOK {
+		t.Fatalf("opening stock: status %d, %s", w.Code, w.Body)
+	}
+
+	const inserts = 40
+	var wg sync.WaitGroup
+	for i := range inserts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			entryType := utils.ENTRY_TYPE_INCOMING
+			if i%2 == 1 {
+				entryType = utils.ENTRY_TYPE_OUTGOING
+			}
+			if w := insertEntry(env, entryType, "C_1", "2026-03-14", 10); w.Code != http.StatusOK {
+				t.Errorf("insert %d (%s): status %d, %s", i, entryType, w.Code, w.Body)
+			}
+		}()
+	}
+	wg.Wait()
+
+	env.AssertNetStock("C_1")
+	expected := env.ReplayNetStock("C_1")
+	if len(expected) != inserts+1 {
+		t.Errorf("ledger holds %d entries, want %d", len(expected), inserts+1)
+	}
+}
+
+// An issue recorded before the delivery it was drawn from goes in once confirmed, as long as the day ends with stock
+func TestSameDayGraceAcceptsIssueBeforeDelivery(t *testing.T) {
+	t.Setenv("SAME_DAY_STOCK_GRACE", "true")
+	env := testutils.NewEnv(t, time.Date(2026, 3, 14, 10, 0, 0, 0, time.Local))
+
+	env.InsertCompound("C_1", "Acetone", "ml")
+	if w := insertEntry(env, utils.ENTRY_TYPE_INCOMING, "C_1", "2026-03-13", 100); w.Code != http.StatusOK {
+		t.Fatalf("opening stock: status %d, %s", w.Code, w.Body)
+	}
+
+	issue := func(date string, quantity int, confirm bool) *httptest.ResponseRecorder {
+		body := fmt.Sprintf(
+			`{"type": %q, "compound_id": "C_1", "date": %q, "num_of_units": 1, "quantity_per_unit": %d, "confirm_shortfall": %t}`,
+			utils.ENTRY_TYPE_OUTGOING, date, quantity, confirm,
+		)
+		w := httptest.NewRecorder()
+		handlers.InsertEntryHandler(w, env.Request(http.MethodPost, "/insert-entry", strings.NewReader(body)))
+		return w
+	}
+
+	if w := issue("2026-03-14", 150, false); w.Code != http.StatusNotAcceptable || !strings.Contains(w.Body.String(), string(utils.SAME_DAY_STOCK_SHORTFALL_ERR)) {
+		t.Fatalf("unconfirmed shortfall: status %d, %s", w.Code, w.Body)
+	}
+	if w := issue("2026-03-13", 150, true); w.Code != http.StatusNotAcceptable || !strings.Contains(w.Body.String(), string(utils.INSUFFICIENT_STOCK_ERR)) {
+		t.Fatalf("shortfall closing a past day: status %d, %s", w.Code, w.Body)
+	}
+	if w := issue("2026-03-14", 150, true); w.Code != http.StatusOK {
+		t.Fatalf("confirmed shortfall: status %d, %s", w.Code, w.Body)
+	}
+
+	env.Clock.Advance(time.Hour)
+	if w := insertEntry(env, utils.ENTRY_TYPE_INCOMING, "C_1", "2026-03-14", 100); w.Code != http.StatusOK {
+		t.Fatalf("delivery: status %d, %s", w.Code, w.Body)
+	}
+	env.AssertNetStock("C_1")
+
+	// Once the day is over, it has to close with stock
+	env.Clock.Advance(24 * time.Hour)
+	if w := issue("2026-03-15", 60, true); w.Code != http.StatusOK {
+		t.Fatalf("next day: status %d, %s", w.Code, w.Body)
+	}
+	if w := issue("2026-03-14", 60, true); w.Code != http.StatusNotAcceptable {
+		t.Fatalf("shortfall closing yesterday: status %d, %s", w.Code, w.Body)
+	}
+	env.AssertNetStock("C_1")
+}
+
+// Entries of the same second are taken in the order they were recorded, even when their IDs sort otherwise
+func TestSameSecondEntriesKeepRecordedOrder(t *testing.T) {
+	t.Parallel()
+	env := testutils.NewEnv(t, time.Date(2026, 3, 14, 10, 0, 0, 0, time.Local))
+
+	env.InsertCompound("C_1", "Acetone", "ml")
+	for i := range 4 {
+		if w := insertEntry(env, utils.ENTRY_TYPE_INCOMING, "C_1", "2026-03-14", 10); w.Code != http.StatusOK {
+			t.Fatalf("delivery %d: status %d, %s", i, w.Code, w.Body)
+		}
+	}
+	// Its ID, E_14, sorts before those of three deliveries: E_2, E_5 and E_8
+	if w := insertEntry(env, utils.ENTRY_TYPE_OUTGOING, "C_1", "2026-03-14", 40); w.Code != http.StatusOK {
+		t.Fatalf("issue: status %d, %s", w.Code, w.Body)
+	}
+	env.AssertNetStock("C_1")
+}
+
+func TestEntryUnitIsCheckedAgainstCompoundScale(t *testing.T) {
+	t.Parallel()
+	env := testutils.NewEnv(t, time.Date(2026, 3, 14, 10, 0, 0, 0, time.Local))
+
+	env.InsertCompound("C_1", "Sodium chloride", "g")
+	deliver := func(quantity int, unit string, convert bool) *httptest.ResponseRecorder {
+		body := fmt.Sprintf(
+			`{"type": "incoming", "compound_id": "C_1", "date": "2026-03-14", "num_of_units": 2, "quantity_per_unit": %d, "unit": %q, "convert_unit": %t}`,
+			quantity, unit, convert,
+		)
+		w := httptest.NewRecorder()
+		handlers.InsertEntryHandler(w, env.Request(http.MethodPost, "/insert-entry", strings.NewReader(body)))
+		return w
+	}
+
+	if w := deliver(500, "ml", true); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "the quantity is in ml, the compound is measured in g") {
+		t.Fatalf("ml for a compound in g: status %d, %s", w.Code, w.Body)
+	}
+	if w := deliver(1, "Kgs", false); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "1 kg per unit is 1000 g") {
+		t.Fatalf("unconfirmed conversion: status %d, %s", w.Code, w.Body)
+	}
+	if w := deliver(1, "kg", true); w.Code != http.StatusOK {
+		t.Fatalf("confirmed conversion: status %d, %s", w.Code, w.Body)
+	}
+
+	var stock int
+	if err := env.DB.QueryRow("SELECT balance FROM stock_current WHERE compound_id = 'C_1'").Scan(&stock); err != nil {
+		t.Fatalf("failed to read current stock: %v", err)
+	}
+	if stock != 2000 {
+		t.Errorf("current stock %d g, want 2000 g", stock)
+	}
+
+	// Shown in kg once that is the display unit of the compound
+	update := httptest.NewRecorder()
+	handlers.UpdateCompoundHandler(update, env.Request(http.MethodPut, "/update-compound", strings.NewReader(`{"id": "C_1", "display_unit": "kg"}`)))
+	if update.Code != http.StatusOK {
+		t.Fatalf("setting display unit: status %d, %s", update.Code, update.Body)
+	}
+	w := httptest.NewRecorder()
+	handlers.GetStockHandler(w, env.Request(http.MethodGet, "/stock?display_units=true", nil))
+	if !strings.Contains(w.Body.String(), `"display_unit":"kg","display_net_stock":2}`) {
+		t.Errorf("stock in display unit: %s", w.Body)
+	}
+
+	// Compounds may be measured in any unit of the table, converted through the base unit of its kind
+	env.InsertCompound("C_2", "Digoxin", "mg")
+	body := `{"type": "incoming", "compound_id": "C_2", "date": "2026-03-14", "num_of_units": 1, "quantity_per_unit": 3, "unit": "g", "convert_unit": true}`
+	w = httptest.NewRecorder()
+	handlers.InsertEntryHandler(w, env.Request(http.MethodPost, "/insert-entry", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("g for a compound in mg: status %d, %s", w.Code, w.Body)
+	}
+	if err := env.DB.QueryRow("SELECT balance FROM stock_current WHERE compound_id = 'C_2'").Scan(&stock); err != nil || stock != 3000 {
+		t.Errorf("current stock %d mg, want 3000 mg (%v)", stock, err)
+	}
+}
+
+func TestInsufficientStockOffersSubstitutesOfTheSameCategory(t *testing.T) {
+	t.Parallel()
+	env := testutils.NewEnv(t, time.Date(2026, 3, 14, 10, 0, 0, 0, time.Local))
+
+	env.InsertCompound("C_1", "Acetone AR", "ml")
+	env.InsertCompound("C_2", "Acetone LR", "ml")
+	env.InsertCompound("C_3", "Acetone HPLC", "ml")
+	env.InsertCompound("C_4", "Ethanol", "ml")
+	if _, err := env.DB.Exec("UPDATE compound SET category = 'Acetone' WHERE id IN ('C_1', 'C_2', 'C_3')"); err != nil {
+		t.Fatalf("failed to set categories: %v", err)
+	}
+
+	for compoundId, quantity := range map[string]int{"C_1": 100, "C_2": 500, "C_3": 200, "C_4": 1000} {
+		if w := insertEntry(env, "incoming", compoundId, "2026-03-14", quantity); w.Code != http.StatusOK {
+			t.Fatalf("delivery of %s: status %d, %s", compoundId, w.Code, w.Body)
+		}
+	}
+
+	// Only the other acetone holding the 300 ml is offered, not the one short of it nor the ethanol
+	w := insertEntry(env, "outgoing", "C_1", "2026-03-14", 300)
+	if w.Code != http.StatusNotAcceptable {
+		t.Fatalf("issue beyond stock: status %d, %s", w.Code, w.Body)
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, `"compound_id":"C_2"`) || strings.Contains(body, `"compound_id":"C_3"`) || strings.Contains(body, `"compound_id":"C_4"`) {
+		t.Errorf("substitutes for 300 ml of C_1: %s", body)
+	}
+}
+
+func TestDuplicateVoucherIsWarnedOrRejected(t *testing.T) {
+	env := testutils.NewEnv(t, time.Date(2026, 3, 14, 10, 0, 0, 0, time.Local))
+
+	env.InsertCompound("C_1", "Acetone", "ml")
+	deliver := func(voucherNo string) *httptest.ResponseRecorder {
+		env.Clock.Advance(time.Minute)
+		body := fmt.Sprintf(`{"type": "incoming", "compound_id": "C_1", "date": "2026-03-14", "num_of_units": 1, "quantity_per_unit": 500, "voucher_no": %q}`, voucherNo)
+		w := httptest.NewRecorder()
+		handlers.InsertEntryHandler(w, env.Request(http.MethodPost, "/insert-entry", strings.NewReader(body)))
+		return w
+	}
+
+	if w := deliver("V-1"); w.Code != http.StatusOK {
+		t.Fatalf("first delivery: status %d, %s", w.Code, w.Body)
+	}
+
+	t.Setenv("DUPLICATE_VOUCHER_CHECK", utils.DUPLICATE_CHECK_WARN)
+	if w := deliver("V-1"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"duplicate_of":"E_`) {
+		t.Fatalf("duplicate under warn: status %d, %s", w.Code, w.Body)
+	}
+
+	t.Setenv("DUPLICATE_VOUCHER_CHECK", utils.DUPLICATE_CHECK_REJECT)
+	if w := deliver("V-1"); w.Code != http.StatusConflict {
+		t.Fatalf("duplicate under reject: status %d, %s", w.Code, w.Body)
+	}
+	if w := deliver("V-2"); w.Code != http.StatusOK {
+		t.Fatalf("new voucher under reject: status %d, %s", w.Code, w.Body)
+	}
+
+	w := httptest.NewRecorder()
+	handlers.GetDuplicatesHandler(w, env.Request(http.MethodGet, "/duplicates", nil))
+	if w.Code != http.StatusOK || strings.Count(w.Body.String(), `"voucher_no":"V-1"`) != 1 || strings.Count(w.Body.String(), `"type":"incoming"`) != 2 {
+		t.Errorf("duplicates report: status %d, %s", w.Code, w.Body)
+	}
+}
+
+func TestTransfersMoveStockBetweenLocations(t *testing.T) {
+	t.Parallel()
+	env := testutils.NewEnv(t, time.Date(2026, 3, 14, 10, 0, 0, 0, time.Local))
+
+	env.InsertCompound("C_1", "Acetone", "ml")
+	if _, err := env.DB.Exec(`
+		INSERT INTO location (id, lower_case_name, name) VALUES
+			('LC_store', 'main store', 'Main store'), ('LC_lab', 'lab cabinet', 'Lab cabinet')`,
+	); err != nil {
+		t.Fatalf("failed to insert locations: %v", err)
+	}
+	post := func(entryType string, date string, quantity int, locations string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handlers.InsertEntryHandler(w, env.Request(http.MethodPost, "/insert-entry", strings.NewReader(fmt.Sprintf(
+			`{"type": %q, "compound_id": "C_1", "date": %q, "num_of_units": 1, "quantity_per_unit": %d, %s}`,
+			entryType, date, quantity, locations,
+		))))
+		return w
+	}
+
+	for _, w := range []*httptest.ResponseRecorder{
+		post(utils.ENTRY_TYPE_INCOMING, "2026-03-02", 1000, `"location_id": "LC_store"`),
+		post(utils.ENTRY_TYPE_TRANSFER, "2026-03-03", 300, `"location_id": "LC_store", "to_location_id": "LC_lab"`),
+		post(utils.ENTRY_TYPE_OUTGOING, "2026-03-04", 200, `"location_id": "LC_lab"`),
+	} {
+		if w.Code != http.StatusOK {
+			t.Fatalf("entry: status %d, %s", w.Code, w.Body)
+		}
+	}
+
+	// The compound has 800 ml, but only 100 ml of them are in the lab
+	if w := post(utils.ENTRY_TYPE_OUTGOING, "2026-03-05", 200, `"location_id": "LC_lab"`); w.Code != http.StatusNotAcceptable ||
+		!strings.Contains(w.Body.String(), utils.INSUFFICIENT_LOCATION_STOCK_ERR) {
+		t.Errorf("issue beyond the stock of the location: status %d, %s", w.Code, w.Body)
+	}
+	// Nor can a transfer dated before the issue take away what it was issued from
+	if w := post(utils.ENTRY_TYPE_TRANSFER, "2026-03-03", 250, `"location_id": "LC_lab", "to_location_id": "LC_store"`); w.Code != http.StatusNotAcceptable {
+		t.Errorf("transfer leaving a later issue short: status %d, %s", w.Code, w.Body)
+	}
+	for name, w := range map[string]*httptest.ResponseRecorder{
+		"without destination":   post(utils.ENTRY_TYPE_TRANSFER, "2026-03-05", 10, `"location_id": "LC_store"`),
+		"to the same location":  post(utils.ENTRY_TYPE_TRANSFER, "2026-03-05", 10, `"location_id": "LC_lab", "to_location_id": "LC_lab"`),
+		"destination on issue":  post(utils.ENTRY_TYPE_OUTGOING, "2026-03-05", 10, `"location_id": "LC_lab", "to_location_id": "LC_store"`),
+		"unknown location":      post(utils.ENTRY_TYPE_INCOMING, "2026-03-05", 10, `"location_id": "LC_attic"`),
+		"lot details on a move": post(utils.ENTRY_TYPE_TRANSFER, "2026-03-05", 10, `"to_location_id": "LC_lab", "lot_no": "A1"`),
+	} {
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, %s", name, w.Code, w.Body)
+		}
+	}
+	env.AssertNetStock("C_1")
+
+	stockAt := func(query string) string {
+		w := httptest.NewRecorder()
+		handlers.GetStockHandler(w, env.Request(http.MethodGet, "/stock?"+query, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("stock %s: status %d, %s", query, w.Code, w.Body)
+		}
+		return w.Body.String()
+	}
+	for query, netStock := range map[string]string{
+		"":                                   `"net_stock":800`,
+		"location_id=LC_store":               `"net_stock":700`,
+		"location_id=LC_lab":                 `"net_stock":100`,
+		"location_id=LC_lab&asOf=2026-03-03": `"net_stock":300`,
+		"location_id=LC_lab&asOf=2026-03-02": `"net_stock":0`,
+	} {
+		if body := stockAt(query); !strings.Contains(body, netStock) {
+			t.Errorf("stock %s: want %s, got %s", query, netStock, body)
+		}
+	}
+
+	// The transfer keeps the lot of the delivery whole, only the issue draws on it
+	var consumed int
+	if err := env.DB.QueryRow(`
+		SELECT COALESCE(SUM(lc.quantity), 0) FROM lot_consumption lc JOIN entry e ON e.id = lc.entry_id WHERE e.type = ?`,
+		utils.ENTRY_TYPE_TRANSFER,
+	).Scan(&consumed); err != nil || consumed != 0 {
+		t.Errorf("lots consumed by transfers: %d, %v", consumed, err)
+	}
+
+	w := httptest.NewRecorder()
+	handlers.GetEntryHandler(w, env.Request(http.MethodGet, "/get-entry?entry_type=both&compound_id=C_1&transactions=all&from_date=2026-03-01&to_date=2026-03-14&location_id=LC_lab", nil))
+	if body := w.Body.String(); w.Code != http.StatusOK || strings.Count(body, `"id"`) != 2 || !strings.Contains(body, `"to_location_name":"Lab cabinet"`) {
+		t.Errorf("entries of the lab: status %d, %s", w.Code, body)
+	}
+
+	w = httptest.NewRecorder()
+	handlers.DeleteLocationHandler(w, env.Request(http.MethodDelete, "/delete-location?id=LC_lab", nil))
+	if w.Code != http.StatusNotAcceptable {
+		t.Errorf("deleting a location in use: status %d, %s", w.Code, w.Body)
+	}
+}
+
+// A delivery far above the usual ones of its compound is held back under "confirm" and flagged once recorded
+func TestLargeIncomingQuantityNeedsConfirmation(t *testing.T) {
+	env := testutils.NewEnv(t, time.Date(2026, 3, 14, 10, 0, 0, 0, time.Local))
+	t.Setenv("LARGE_INCOMING_CHECK", utils.LARGE_INCOMING_CONFIRM)
+
+	env.InsertCompound("C_1", "Acetone", "ml")
+	for _, date := range []string{"2026-01-05", "2026-02-05", "2026-03-05"} {
+		if w := insertEntry(env, utils.ENTRY_TYPE_INCOMING, "C_1", date, 100); w.Code != http.StatusOK {
+			t.Fatalf("usual delivery: status %d, %s", w.Code, w.Body)
+		}
+	}
+
+	if w := insertEntry(env, utils.ENTRY_TYPE_INCOMING, "C_1", "2026-03-13", 500); w.Code != http.StatusOK || strings.Contains(w.Body.String(), "large_quantity") {
+		t.Fatalf("delivery within the bound: status %d, %s", w.Code, w.Body)
+	}
+	if w := insertEntry(env, utils.ENTRY_TYPE_INCOMING, "C_1", "2026-03-13", 10000); w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), `"max_incoming":500`) {
+		t.Fatalf("unconfirmed large delivery: status %d, %s", w.Code, w.Body)
+	}
+
+	body := `{"type": "incoming", "compound_id": "C_1", "date": "2026-03-13", "num_of_units": 1, "quantity_per_unit": 10000, "confirm_large_quantity": true}`
+	w := httptest.NewRecorder()
+	handlers.InsertEntryHandler(w, env.Request(http.MethodPost, "/insert-entry", strings.NewReader(body)))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"large_quantity":{"max_incoming":500,"quantity":10000}`) {
+		t.Fatalf("confirmed large delivery: status %d, %s", w.Code, w.Body)
+	}
+
+	router := chi.NewRouter()
+	router.Get("/reports/daily/{date}", handlers.GetDailyDigestHandler)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, env.Request(http.MethodGet, "/reports/daily/2026-03-13", nil))
+	if w.Code != http.StatusOK || strings.Count(w.Body.String(), `"kind":"large_incoming"`) != 1 || !strings.Contains(w.Body.String(), "10000 ml, above the plausible 500 ml") {
+		t.Errorf("digest: status %d, %s", w.Code, w.Body)
+	}
+
+	// A bound set on the compound replaces the one of its history
+	if _, err := env.DB.Exec("UPDATE compound SET max_incoming = 20000 WHERE id = 'C_1'"); err != nil {
+		t.Fatal(err)
+	}
+	if w := insertEntry(env, utils.ENTRY_TYPE_INCOMING, "C_1", "2026-03-14", 10000); w.Code != http.StatusOK {
+		t.Errorf("delivery within the set bound: status %d, %s", w.Code, w.Body)
+	}
+}
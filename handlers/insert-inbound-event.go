@@ -0,0 +1,362 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/datetime"
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/stock"
+	"chemical-ledger-backend/utils"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// Largest inbound event body accepted
+	MAX_INBOUND_EVENT_SIZE = 1 << 20
+
+	INBOUND_EVENT_GOODS_RECEIVED   = "goods_received"
+	INBOUND_EVENT_STOCK_ADJUSTMENT = "stock_adjustment"
+)
+
+// Inbound event once read, whatever schema version it came in
+type inboundEvent struct {
+	Id        string
+	Type      string
+	Date      string
+	VoucherNo string
+	Reason    string
+	Supplier  string
+	Items     []inboundItem
+}
+
+type inboundItem struct {
+	ItemCode string
+	// Negative for stock adjustments out
+	Quantity int
+	LotNo    string
+	Expiry   string
+}
+
+// Readers of the schema versions accepted, by version. A new version gets its own reader, so integrations still
+// sending an older one keep working.
+var inboundEventReaders = map[int]func(body []byte) (*inboundEvent, error){
+	1: readInboundEventV1,
+}
+
+type InboundEventV1 struct {
+	SchemaVersion int    `json:"schema_version"`
+	EventId       string `json:"event_id"`
+	EventType     string `json:"event_type"`
+	Date          string `json:"date"`
+	VoucherNo     string `json:"voucher_no"`
+	Reason        string `json:"reason"`
+	Supplier      string `json:"supplier"`
+	Items         []struct {
+		ItemCode string `json:"item_code"`
+		Quantity int    `json:"quantity"`
+		LotNo    string `json:"lot_no"`
+		Expiry   string `json:"expiry"`
+	} `json:"items"`
+}
+
+func readInboundEventV1(body []byte) (*inboundEvent, error) {
+	v1 := &InboundEventV1{}
+	if err := json.Unmarshal(body, v1); err != nil {
+		return nil, err
+	}
+	event := &inboundEvent{
+		Id:        strings.TrimSpace(v1.EventId),
+		Type:      v1.EventType,
+		Date:      v1.Date,
+		VoucherNo: v1.VoucherNo,
+		Reason:    v1.Reason,
+		Supplier:  v1.Supplier,
+	}
+	for _, item := range v1.Items {
+		event.Items = append(event.Items, inboundItem{ItemCode: item.ItemCode, Quantity: item.Quantity, LotNo: item.LotNo, Expiry: item.Expiry})
+	}
+	return event, nil
+}
+
+type InboundEventResult struct {
+	EventId   string   `json:"event_id"`
+	ImportId  string   `json:"import_id"`
+	EntryIds  []string `json:"entry_ids"`
+	Duplicate bool     `json:"duplicate"`
+}
+
+// Records the stock movements an external system, e.g. procurement, pushes to the ledger: received goods become
+// incoming entries and stock adjustments adjustments in or out. Events are signed with the secret of their source
+// (see utils.InboundSecret) in the X-Signature-256 header and name their "schema_version". Item codes become
+// compounds through the item mappings of the source, see UpdateItemMappingsHandler. All items of an event go in
+// together as one import, which can be rolled back as such, recorded by the inbound integrations user. An event ID
+// already received answers with what it recorded then, so events can be sent again safely.
+func InsertInboundEventHandler(w http.ResponseWriter, r *http.Request) {
+	source := chi.URLParam(r, "source")
+	secret := utils.InboundSecret(source)
+	if secret == "" {
+		slog.WarnContext(r.Context(), "event from unknown inbound source", "source", source)
+		httpx.RespWithError(w, http.StatusNotFound, utils.UNKNOWN_INBOUND_SOURCE)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, MAX_INBOUND_EVENT_SIZE)
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to read inbound event", "source", source, "error", err)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.INVALID_INBOUND_EVENT)
+		return
+	}
+
+	if !utils.VerifyInboundSignature(secret, body, r.Header.Get(utils.INBOUND_SIGNATURE_HEADER)) {
+		slog.WarnContext(r.Context(), "inbound event signature mismatch", "source", source)
+		httpx.RespWithError(w, http.StatusUnauthorized, utils.INVALID_INBOUND_SIGNATURE)
+		return
+	}
+
+	var version struct {
+		SchemaVersion int `json:"schema_version"`
+	}
+	if err := json.Unmarshal(body, &version); err != nil {
+		slog.ErrorContext(r.Context(), "invalid inbound event", "source", source, "error", err)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.INVALID_INBOUND_EVENT)
+		return
+	}
+	readEvent, ok := inboundEventReaders[version.SchemaVersion]
+	if !ok {
+		supported := []string{}
+		for _, v := range slices.Sorted(maps.Keys(inboundEventReaders)) {
+			supported = append(supported, fmt.Sprint(v))
+		}
+		slog.WarnContext(r.Context(), "unsupported inbound schema version", "source", source, "schema_version", version.SchemaVersion)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.ErrorMessage(fmt.Sprintf("%s (supported: %s)", utils.UNSUPPORTED_SCHEMA_VERSION, strings.Join(supported, ", "))))
+		return
+	}
+	event, err := readEvent(body)
+	if err != nil || event.Id == "" || len(event.Items) == 0 || len(event.Items) > MAX_IMPORT_ROWS {
+		slog.ErrorContext(r.Context(), "invalid inbound event", "source", source, "schema_version", version.SchemaVersion, "error", err)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.INVALID_INBOUND_EVENT)
+		return
+	}
+	if event.Type != INBOUND_EVENT_GOODS_RECEIVED && event.Type != INBOUND_EVENT_STOCK_ADJUSTMENT {
+		slog.WarnContext(r.Context(), "invalid inbound event type", "source", source, "event_type", event.Type)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.INVALID_INBOUND_EVENT_TYPE)
+		return
+	}
+
+	// Answered before the items are checked again, as mappings may have changed since
+	if result, err := getInboundEventResult(r.Context(), source, event.Id); err != nil {
+		slog.ErrorContext(r.Context(), "failed to look up inbound event", "source", source, "event_id", event.Id, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.INBOUND_EVENT_ERR)
+		return
+	} else if result != nil {
+		slog.InfoContext(r.Context(), "inbound event already recorded", "source", source, "event_id", event.Id)
+		httpx.RespWithData(w, http.StatusOK, result)
+		return
+	}
+
+	mappings, err := getItemMappings(r.Context(), source)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to load item mappings", "source", source, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.ITEM_MAPPING_RETRIEVAL_ERR)
+		return
+	}
+
+	entries, itemNumbers, itemErrors := []*InsertEntryReq{}, []int{}, []ImportRowError{}
+	for i, item := range event.Items {
+		entry, errs := inboundItemEntry(r.Context(), event, item, mappings, i+1)
+		if len(errs) > 0 {
+			itemErrors = append(itemErrors, errs...)
+			continue
+		}
+		entries = append(entries, entry)
+		itemNumbers = append(itemNumbers, i+1)
+	}
+	if len(itemErrors) > 0 {
+		slog.WarnContext(r.Context(), "inbound event rejected", "source", source, "event_id", event.Id, "errors", len(itemErrors))
+		httpx.EncodeJsonRes(w, http.StatusBadRequest, &httpx.Resp{Error: utils.INBOUND_EVENT_REJECTED, Data: map[string]any{
+			"event_id": event.Id,
+			"errors":   itemErrors,
+		}})
+		return
+	}
+
+	quota, err := utils.GetQuota(r.Context(), utils.QUOTA_ENTRIES)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error getting quota", "resource", utils.QUOTA_ENTRIES, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.QUOTA_RETRIEVAL_ERR)
+		return
+	}
+	if quota.Remaining != nil && *quota.Remaining < len(entries) {
+		slog.ErrorContext(r.Context(), "inbound event exceeds trial limit", "items", len(entries), "remaining", *quota.Remaining)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.TRIAL_PERIOD_LIMIT_EXCEEDED)
+		return
+	}
+
+	inboundUser, err := utils.GetUser(r.Context(), utils.INBOUND_USER_ID)
+	if err != nil || inboundUser == nil {
+		slog.ErrorContext(r.Context(), "failed to retrieve inbound integrations user", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.USER_RETRIEVAL_ERR)
+		return
+	}
+	status := utils.ENTRY_STATUS_APPROVED
+	if utils.EntryNeedsApproval(inboundUser.Role) {
+		status = utils.ENTRY_STATUS_PENDING
+	}
+
+	unlock := stock.LockCompounds(importedCompoundIds(entries)...)
+	defer unlock()
+
+	tx, err := db.ConnFrom(r.Context()).BeginTx(r.Context(), nil)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error starting transaction", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.TX_START_ERR)
+		return
+	}
+	defer tx.Rollback()
+
+	importId, err := createImportBatch(r.Context(), tx, IMPORT_SOURCE_INBOUND, source+"/"+event.Id, len(entries), inboundUser.Id)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error recording inbound event import", "source", source, "event_id", event.Id, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.IMPORT_BATCH_ERR)
+		return
+	}
+
+	// The same event sent twice at once gets past the lookup above in both requests, the key stops the second
+	res, err := tx.ExecContext(r.Context(),
+		"INSERT OR IGNORE INTO inbound_event (source, event_id, schema_version, import_batch_id, received_at) VALUES (?, ?, ?, ?, ?)",
+		source, event.Id, version.SchemaVersion, importId, datetime.Now(r.Context()).Unix(),
+	)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error recording inbound event", "source", source, "event_id", event.Id, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.INBOUND_EVENT_ERR)
+		return
+	}
+	if recorded, _ := res.RowsAffected(); recorded == 0 {
+		tx.Rollback()
+		result, err := getInboundEventResult(r.Context(), source, event.Id)
+		if err != nil || result == nil {
+			slog.ErrorContext(r.Context(), "failed to look up inbound event", "source", source, "event_id", event.Id, "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.INBOUND_EVENT_ERR)
+			return
+		}
+		httpx.RespWithData(w, http.StatusOK, result)
+		return
+	}
+
+	entryIds, recalculationErrors, errStr := insertImportedEntries(r.Context(), tx, entries, itemNumbers, status, inboundUser.Id, importId, nil)
+	if errStr != utils.NO_ERR {
+		httpx.RespWithError(w, http.StatusInternalServerError, errStr)
+		return
+	}
+	if len(recalculationErrors) > 0 {
+		slog.WarnContext(r.Context(), "inbound event would leave too little stock", "source", source, "event_id", event.Id)
+		httpx.EncodeJsonRes(w, http.StatusNotAcceptable, &httpx.Resp{Error: utils.INBOUND_EVENT_REJECTED, Data: map[string]any{
+			"event_id": event.Id,
+			"errors":   recalculationErrors,
+		}})
+		return
+	}
+
+	utils.RecordAudit(r.Context(), tx, inboundUser.Id, "entry.inbound", utils.AUDIT_TARGET_ENTRY, "", map[string]any{
+		"source":         source,
+		"event_id":       event.Id,
+		"event_type":     event.Type,
+		"schema_version": version.SchemaVersion,
+		"items":          len(entries),
+		"import_id":      importId,
+	})
+
+	if err := tx.Commit(); err != nil {
+		slog.ErrorContext(r.Context(), "error committing transaction", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.COMMIT_TRANSACTION_ERR)
+		return
+	}
+
+	httpx.RespWithData(w, http.StatusOK, &InboundEventResult{EventId: event.Id, ImportId: importId, EntryIds: entryIds})
+}
+
+// Turns an item of an inbound event into the entry it records, through the mapping of its item code
+func inboundItemEntry(ctx context.Context, event *inboundEvent, item inboundItem, mappings map[string]ItemMapping, itemNumber int) (*InsertEntryReq, []ImportRowError) {
+	mapping, ok := mappings[item.ItemCode]
+	if !ok {
+		return nil, []ImportRowError{{Row: itemNumber, Column: "item_code", Error: utils.ITEM_NOT_MAPPED}}
+	}
+
+	entryType, quantity := utils.ENTRY_TYPE_INCOMING, item.Quantity
+	if event.Type == INBOUND_EVENT_STOCK_ADJUSTMENT {
+		entryType = utils.ENTRY_TYPE_ADJUSTMENT_IN
+		if quantity < 0 {
+			entryType, quantity = utils.ENTRY_TYPE_ADJUSTMENT_OUT, -quantity
+		}
+	}
+
+	entry := &InsertEntryReq{
+		Type:        entryType,
+		CompoundId:  mapping.CompoundId,
+		Date:        event.Date,
+		VoucherNo:   event.VoucherNo,
+		Reason:      event.Reason,
+		Unit:        mapping.Unit,
+		ConvertUnit: true,
+	}
+	if mapping.QuantityPerUnit > 0 {
+		entry.NumOfUnits, entry.QuantityPerUnit = utils.LocalizedInt(quantity), utils.LocalizedInt(mapping.QuantityPerUnit)
+	} else {
+		entry.NumOfUnits, entry.QuantityPerUnit = 1, utils.LocalizedInt(quantity)
+	}
+	if utils.IsInwardEntryType(entryType) {
+		entry.LotNo, entry.Expiry, entry.Supplier = item.LotNo, item.Expiry, event.Supplier
+	}
+
+	if errStr := validateInsertEntryReq(ctx, entry); errStr != utils.NO_ERR {
+		return nil, []ImportRowError{{Row: itemNumber, Error: errStr}}
+	}
+	if errStr := validateDate(ctx, entry.Date); errStr != utils.NO_ERR {
+		return nil, []ImportRowError{{Row: itemNumber, Column: "date", Error: errStr}}
+	}
+	if _, errStr := checkEntryDatesUnlocked(ctx, datetime.GetDateUnix(ctx, entry.Date)); errStr != utils.NO_ERR {
+		return nil, []ImportRowError{{Row: itemNumber, Column: "date", Error: errStr}}
+	}
+	if _, errStr := convertEntryUnit(ctx, entry); errStr != utils.NO_ERR {
+		return nil, []ImportRowError{{Row: itemNumber, Column: "quantity", Error: errStr}}
+	}
+
+	return entry, nil
+}
+
+// Gets what an inbound event recorded when it was received, nil when it was not
+func getInboundEventResult(ctx context.Context, source string, eventId string) (*InboundEventResult, error) {
+	result := &InboundEventResult{EventId: eventId, EntryIds: []string{}, Duplicate: true}
+	err := db.ConnFrom(ctx).QueryRowContext(ctx, "SELECT import_batch_id FROM inbound_event WHERE source = ? AND event_id = ?", source, eventId).Scan(&result.ImportId)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.ConnFrom(ctx).QueryContext(ctx, "SELECT id FROM entry WHERE import_batch_id = ? ORDER BY seq", result.ImportId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var entryId string
+		if err := rows.Scan(&entryId); err != nil {
+			return nil, err
+		}
+		result.EntryIds = append(result.EntryIds, entryId)
+	}
+	return result, rows.Err()
+}
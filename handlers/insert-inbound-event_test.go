@@ -0,0 +1,71 @@
+package handlers_test
+
+import (
+	"chemical-ledger-backend/handlers"
+	"chemical-ledger-backend/testutils"
+	"chemical-ledger-backend/utils"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestInboundEventIsRecordedOnce(t *testing.T) {
+	env := testutils.NewEnv(t, time.Date(2026, 3, 14, 10, 0, 0, 0, time.Local))
+	t.Setenv("INBOUND_SECRET_PROCUREMENT", "s3cret")
+
+	env.InsertCompound("C_1", "Acetone", "ml")
+	router := chi.NewRouter()
+	router.Post("/inbound/{source}", handlers.InsertInboundEventHandler)
+	router.Put("/admin/item-mappings/{source}", handlers.UpdateItemMappingsHandler)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, env.Request(http.MethodPut, "/admin/item-mappings/procurement", strings.NewReader(
+		`{"mappings": [{"item_code": "ACE-2L5", "compound_id": "C_1", "unit": "l", "quantity_per_unit": 2}]}`,
+	)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("mapping: status %d, %s", w.Code, w.Body)
+	}
+
+	send := func(body string, secret string) *httptest.ResponseRecorder {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(body))
+		req := env.Request(http.MethodPost, "/inbound/procurement", strings.NewReader(body))
+		req.Header.Set(utils.INBOUND_SIGNATURE_HEADER, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	event := `{"schema_version": 1, "event_id": "GRN-7", "event_type": "goods_received", "date": "2026-03-14", "items": [{"item_code": "ACE-2L5", "quantity": 3}]}`
+
+	if w := send(event, "wrong"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("bad signature: status %d, %s", w.Code, w.Body)
+	}
+	if w := send(strings.Replace(event, `"schema_version": 1`, `"schema_version": 9`, 1), "s3cret"); w.Code != http.StatusBadRequest {
+		t.Fatalf("unknown schema version: status %d, %s", w.Code, w.Body)
+	}
+	if w := send(strings.Replace(event, "ACE-2L5", "ACE-500", 1), "s3cret"); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `"column":"item_code"`) {
+		t.Fatalf("unmapped item: status %d, %s", w.Code, w.Body)
+	}
+	if w := send(event, "s3cret"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"duplicate":false`) {
+		t.Fatalf("first delivery: status %d, %s", w.Code, w.Body)
+	}
+	if w := send(event, "s3cret"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"duplicate":true`) {
+		t.Fatalf("repeated delivery: status %d, %s", w.Code, w.Body)
+	}
+
+	var entries, total int
+	if err := env.DB.QueryRow("SELECT COUNT(*), COALESCE(SUM(q.total_quantity), 0) FROM entry e JOIN quantity q ON q.id = e.quantity_id WHERE e.compound_id = 'C_1'").Scan(&entries, &total); err != nil {
+		t.Fatal(err)
+	}
+	if entries != 1 || total != 6000 {
+		t.Errorf("entries recorded: %d totalling %d ml, want 1 totalling 6000 ml", entries, total)
+	}
+	env.AssertNetStock("C_1")
+}
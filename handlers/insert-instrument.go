@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"context"
+	"log/slog"
+	"net/http"
+)
+
+type InsertInstrumentReq struct {
+	Name     string `json:"name"`
+	Model    string `json:"model"`
+	SerialNo string `json:"serial_no"`
+	Location string `json:"location"`
+}
+
+// Adds a lab instrument, e.g. a pH meter, that outgoing entries can name so the chemicals its upkeep takes are known
+func InsertInstrumentHandler(w http.ResponseWriter, r *http.Request) {
+	reqBody := &InsertInstrumentReq{}
+	if errStr := httpx.DecodeJsonReq(r, reqBody); errStr != utils.NO_ERR {
+		slog.ErrorContext(r.Context(), "failed to decode JSON request", "error", errStr)
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	if reqBody.Name == "" {
+		slog.ErrorContext(r.Context(), "missing required fields", "name", reqBody.Name)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.MISSING_REQUIRED_FIELDS)
+		return
+	}
+
+	instrumentId := generateInstrumentId(r.Context())
+	lowerCasedName := utils.GetLowerCasedCompoundName(reqBody.Name)
+
+	var instrumentExists bool
+	if err := db.ConnFrom(r.Context()).QueryRowContext(r.Context(),
+		"SELECT EXISTS(SELECT 1 FROM instrument WHERE lower_case_name = ?)",
+		lowerCasedName,
+	).Scan(&instrumentExists); err != nil {
+		slog.ErrorContext(r.Context(), "error checking if instrument exists", "instrument_name", reqBody.Name, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.INSTRUMENT_RETRIEVAL_ERR)
+		return
+	}
+
+	if instrumentExists {
+		slog.ErrorContext(r.Context(), "instrument already exists", "instrument_name", reqBody.Name)
+		httpx.RespWithError(w, http.StatusNotAcceptable, utils.INSTRUMENT_ALREADY_EXISTS)
+		return
+	}
+
+	if _, err := db.ConnFrom(r.Context()).ExecContext(r.Context(),
+		"INSERT INTO instrument (id, lower_case_name, name, model, serial_no, location) VALUES (?, ?, ?, ?, ?, ?)",
+		instrumentId, lowerCasedName, reqBody.Name, reqBody.Model, reqBody.SerialNo, reqBody.Location,
+	); err != nil {
+		slog.ErrorContext(r.Context(), "error inserting instrument", "instrument_id", instrumentId, "instrument_name", reqBody.Name, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.INSERT_INSTRUMENT_ERR)
+		return
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"instrument_id": instrumentId,
+	})
+}
+
+func generateInstrumentId(ctx context.Context) string {
+	return utils.NewId(ctx, "IN")
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/datetime"
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"context"
+	"log/slog"
+	"net/http"
+)
+
+type InsertInvoiceReq struct {
+	SupplierId string `json:"supplier_id"`
+	// Number the supplier issued the invoice under
+	InvoiceNo string              `json:"invoice_no"`
+	Date      string              `json:"date"`
+	Remark    string              `json:"remark"`
+	Lines     []InsertInvoiceLine `json:"lines"`
+}
+
+// Quantity of a compound invoiced, in the scale of the compound, and the amount charged for it
+type InsertInvoiceLine struct {
+	CompoundId string  `json:"compound_id"`
+	Quantity   int     `json:"quantity"`
+	Amount     float64 `json:"amount"`
+}
+
+// Enters the totals of a supplier's invoice, which /report/invoice-reconciliation matches against the deliveries
+// recorded in the month of its date
+func InsertInvoiceHandler(w http.ResponseWriter, r *http.Request) {
+	reqBody := &InsertInvoiceReq{}
+	if errStr := httpx.DecodeJsonReq(r, reqBody); errStr != utils.NO_ERR {
+		slog.ErrorContext(r.Context(), "failed to decode JSON request", "error", errStr)
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	if errStr := validateInsertInvoiceReq(r.Context(), reqBody); errStr != utils.NO_ERR {
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	tx, err := db.ConnFrom(r.Context()).BeginTx(r.Context(), nil)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error starting transaction", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.TX_START_ERR)
+		return
+	}
+	defer tx.Rollback()
+
+	var duplicate bool
+	if err := tx.QueryRowContext(r.Context(),
+		"SELECT EXISTS(SELECT 1 FROM invoice WHERE supplier_id = ? AND invoice_no = ?)", reqBody.SupplierId, reqBody.InvoiceNo,
+	).Scan(&duplicate); err != nil {
+		slog.ErrorContext(r.Context(), "error checking for duplicate invoice", "supplier_id", reqBody.SupplierId, "invoice_no", reqBody.InvoiceNo, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.INVOICE_RETRIEVAL_ERR)
+		return
+	}
+	if duplicate {
+		slog.WarnContext(r.Context(), "invoice already entered", "supplier_id", reqBody.SupplierId, "invoice_no", reqBody.InvoiceNo)
+		httpx.RespWithError(w, http.StatusConflict, utils.DUPLICATE_INVOICE)
+		return
+	}
+
+	actor := currentUser(r)
+	invoiceId := generateInvoiceId(r.Context())
+	if _, err := tx.ExecContext(r.Context(),
+		"INSERT INTO invoice (id, supplier_id, invoice_no, date, remark, created_by, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		invoiceId, reqBody.SupplierId, reqBody.InvoiceNo, reqBody.Date, reqBody.Remark, actor.Id, datetime.Now(r.Context()).Unix(),
+	); err != nil {
+		slog.ErrorContext(r.Context(), "error inserting invoice", "invoice_id", invoiceId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.INSERT_INVOICE_ERR)
+		return
+	}
+
+	for _, line := range reqBody.Lines {
+		if _, err := tx.ExecContext(r.Context(),
+			"INSERT INTO invoice_line (id, invoice_id, compound_id, quantity, amount) VALUES (?, ?, ?, ?, ?)",
+			generateInvoiceLineId(r.Context()), invoiceId, line.CompoundId, line.Quantity, line.Amount,
+		); err != nil {
+			slog.ErrorContext(r.Context(), "error inserting invoice line", "invoice_id", invoiceId, "compound_id", line.CompoundId, "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.INSERT_INVOICE_ERR)
+			return
+		}
+	}
+
+	utils.RecordAudit(r.Context(), tx, actor.Id, "invoice.create", utils.AUDIT_TARGET_INVOICE, invoiceId, reqBody)
+
+	if err := tx.Commit(); err != nil {
+		slog.ErrorContext(r.Context(), "error committing transaction", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.COMMIT_TRANSACTION_ERR)
+		return
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"invoice_id": invoiceId,
+	})
+}
+
+func validateInsertInvoiceReq(ctx context.Context, reqBody *InsertInvoiceReq) utils.ErrorMessage {
+	if reqBody.SupplierId == "" || reqBody.InvoiceNo == "" || reqBody.Date == "" {
+		slog.ErrorContext(ctx, "missing required fields", "supplier_id", reqBody.SupplierId, "invoice_no", reqBody.InvoiceNo, "date", reqBody.Date)
+		return utils.MISSING_REQUIRED_FIELDS
+	}
+
+	if errStr := validateSupplierIdField(ctx, reqBody.SupplierId); errStr != utils.NO_ERR {
+		return errStr
+	}
+	if errStr := validateDate(ctx, reqBody.Date); errStr != utils.NO_ERR {
+		return errStr
+	}
+
+	if len(reqBody.Lines) == 0 {
+		slog.ErrorContext(ctx, "invoice without lines")
+		return utils.EMPTY_INVOICE
+	}
+	for _, line := range reqBody.Lines {
+		if line.CompoundId == "" || line.CompoundId == "all" {
+			slog.ErrorContext(ctx, "invalid compound_id", "compound_id", line.CompoundId)
+			return utils.INVALID_COMPOUND_ID
+		}
+		if errStr := validateCompoundIdField(ctx, line.CompoundId); errStr != utils.NO_ERR {
+			return errStr
+		}
+		if line.Quantity <= 0 || line.Amount < 0 {
+			slog.ErrorContext(ctx, "invalid invoice line", "compound_id", line.CompoundId, "quantity", line.Quantity, "amount", line.Amount)
+			return utils.INVALID_INVOICE_LINE
+		}
+	}
+
+	return utils.NO_ERR
+}
+
+func generateInvoiceId(ctx context.Context) string {
+	return utils.NewId(ctx, "INV")
+}
+
+func generateInvoiceLineId(ctx context.Context) string {
+	return utils.NewId(ctx, "INVL")
+}
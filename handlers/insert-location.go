@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"context"
+	"log/slog"
+	"net/http"
+)
+
+type InsertLocationReq struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// Adds a location the stock is kept at, e.g. a store room or a lab cabinet, for entries to name and transfers to
+// move stock between
+func InsertLocationHandler(w http.ResponseWriter, r *http.Request) {
+	reqBody := &InsertLocationReq{}
+	if errStr := httpx.DecodeJsonReq(r, reqBody); errStr != utils.NO_ERR {
+		slog.ErrorContext(r.Context(), "failed to decode JSON request", "error", errStr)
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	if reqBody.Name == "" {
+		slog.ErrorContext(r.Context(), "missing required fields", "name", reqBody.Name)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.MISSING_REQUIRED_FIELDS)
+		return
+	}
+
+	locationId := generateLocationId(r.Context())
+	lowerCasedName := utils.GetLowerCasedCompoundName(reqBody.Name)
+
+	var locationExists bool
+	if err := db.ConnFrom(r.Context()).QueryRowContext(r.Context(),
+		"SELECT EXISTS(SELECT 1 FROM location WHERE lower_case_name = ?)",
+		lowerCasedName,
+	).Scan(&locationExists); err != nil {
+		slog.ErrorContext(r.Context(), "error checking if location exists", "location_name", reqBody.Name, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.LOCATION_RETRIEVAL_ERR)
+		return
+	}
+
+	if locationExists {
+		slog.ErrorContext(r.Context(), "location already exists", "location_name", reqBody.Name)
+		httpx.RespWithError(w, http.StatusNotAcceptable, utils.LOCATION_ALREADY_EXISTS)
+		return
+	}
+
+	if _, err := db.ConnFrom(r.Context()).ExecContext(r.Context(),
+		"INSERT INTO location (id, lower_case_name, name, description) VALUES (?, ?, ?, ?)",
+		locationId, lowerCasedName, reqBody.Name, reqBody.Description,
+	); err != nil {
+		slog.ErrorContext(r.Context(), "error inserting location", "location_id", locationId, "location_name", reqBody.Name, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.INSERT_LOCATION_ERR)
+		return
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"location_id": locationId,
+	})
+}
+
+func generateLocationId(ctx context.Context) string {
+	return utils.NewId(ctx, "LC")
+}
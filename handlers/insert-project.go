@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"context"
+	"log/slog"
+	"net/http"
+)
+
+type InsertProjectReq struct {
+	Name string `json:"name"`
+	// Grant or cost centre code the project is billed under
+	Code string `json:"code"`
+	Lead string `json:"lead"`
+}
+
+// Adds a research project or experiment that outgoing entries can name, so the chemicals it uses can be charged to it
+func InsertProjectHandler(w http.ResponseWriter, r *http.Request) {
+	reqBody := &InsertProjectReq{}
+	if errStr := httpx.DecodeJsonReq(r, reqBody); errStr != utils.NO_ERR {
+		slog.ErrorContext(r.Context(), "failed to decode JSON request", "error", errStr)
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	if reqBody.Name == "" {
+		slog.ErrorContext(r.Context(), "missing required fields", "name", reqBody.Name)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.MISSING_REQUIRED_FIELDS)
+		return
+	}
+
+	projectId := generateProjectId(r.Context())
+	lowerCasedName := utils.GetLowerCasedCompoundName(reqBody.Name)
+
+	var projectExists bool
+	if err := db.ConnFrom(r.Context()).QueryRowContext(r.Context(),
+		"SELECT EXISTS(SELECT 1 FROM project WHERE lower_case_name = ?)",
+		lowerCasedName,
+	).Scan(&projectExists); err != nil {
+		slog.ErrorContext(r.Context(), "error checking if project exists", "project_name", reqBody.Name, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.PROJECT_RETRIEVAL_ERR)
+		return
+	}
+
+	if projectExists {
+		slog.ErrorContext(r.Context(), "project already exists", "project_name", reqBody.Name)
+		httpx.RespWithError(w, http.StatusNotAcceptable, utils.PROJECT_ALREADY_EXISTS)
+		return
+	}
+
+	if _, err := db.ConnFrom(r.Context()).ExecContext(r.Context(),
+		"INSERT INTO project (id, lower_case_name, name, code, lead) VALUES (?, ?, ?, ?, ?)",
+		projectId, lowerCasedName, reqBody.Name, reqBody.Code, reqBody.Lead,
+	); err != nil {
+		slog.ErrorContext(r.Context(), "error inserting project", "project_id", projectId, "project_name", reqBody.Name, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.INSERT_PROJECT_ERR)
+		return
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"project_id": projectId,
+	})
+}
+
+func generateProjectId(ctx context.Context) string {
+	return utils.NewId(ctx, "PJ")
+}
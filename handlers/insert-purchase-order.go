@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/datetime"
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+type InsertPurchaseOrderReq struct {
+	SupplierId string `json:"supplier_id"`
+	// Number the order was placed under with the supplier
+	OrderNo string `json:"order_no"`
+	// Day the order was placed, today when not given, and the day the delivery is expected
+	Date         string                    `json:"date"`
+	ExpectedDate string                    `json:"expected_date"`
+	Remark       string                    `json:"remark"`
+	Lines        []InsertPurchaseOrderLine `json:"lines"`
+}
+
+// Quantity of a compound ordered, in the scale of the compound
+type InsertPurchaseOrderLine struct {
+	CompoundId string `json:"compound_id"`
+	Quantity   int    `json:"quantity"`
+}
+
+// Places a purchase order with a supplier. Deliveries received against its lines name them with "po_line_id", and
+// the order is partially and then fully received as they are approved.
+func InsertPurchaseOrderHandler(w http.ResponseWriter, r *http.Request) {
+	reqBody := &InsertPurchaseOrderReq{}
+	if errStr := httpx.DecodeJsonReq(r, reqBody); errStr != utils.NO_ERR {
+		slog.ErrorContext(r.Context(), "failed to decode JSON request", "error", errStr)
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	if reqBody.Date == "" {
+		reqBody.Date = datetime.Now(r.Context()).Format("2006-01-02")
+	}
+	if errStr := validateInsertPurchaseOrderReq(r.Context(), reqBody); errStr != utils.NO_ERR {
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	tx, err := db.ConnFrom(r.Context()).BeginTx(r.Context(), nil)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error starting transaction", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.TX_START_ERR)
+		return
+	}
+	defer tx.Rollback()
+
+	actor := currentUser(r)
+	purchaseOrderId := generatePurchaseOrderId(r.Context())
+	if _, err := tx.ExecContext(r.Context(),
+		"INSERT INTO purchase_order (id, supplier_id, order_no, date, expected_date, remark, status, created_by, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		purchaseOrderId, reqBody.SupplierId, reqBody.OrderNo, reqBody.Date, reqBody.ExpectedDate, reqBody.Remark, utils.PO_STATUS_OPEN, actor.Id, datetime.Now(r.Context()).Unix(),
+	); err != nil {
+		slog.ErrorContext(r.Context(), "error inserting purchase order", "purchase_order_id", purchaseOrderId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.INSERT_PURCHASE_ORDER_ERR)
+		return
+	}
+
+	lineIds := make([]string, len(reqBody.Lines))
+	for i, line := range reqBody.Lines {
+		lineIds[i] = generatePoLineId(r.Context())
+		if _, err := tx.ExecContext(r.Context(),
+			"INSERT INTO purchase_order_line (id, purchase_order_id, compound_id, quantity) VALUES (?, ?, ?, ?)",
+			lineIds[i], purchaseOrderId, line.CompoundId, line.Quantity,
+		); err != nil {
+			slog.ErrorContext(r.Context(), "error inserting purchase order line", "purchase_order_id", purchaseOrderId, "compound_id", line.CompoundId, "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.INSERT_PURCHASE_ORDER_ERR)
+			return
+		}
+	}
+
+	utils.RecordAudit(r.Context(), tx, actor.Id, "purchase_order.create", utils.AUDIT_TARGET_PURCHASE_ORDER, purchaseOrderId, reqBody)
+
+	if err := tx.Commit(); err != nil {
+		slog.ErrorContext(r.Context(), "error committing transaction", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.COMMIT_TRANSACTION_ERR)
+		return
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"purchase_order_id": purchaseOrderId,
+		"line_ids":          lineIds,
+	})
+}
+
+func validateInsertPurchaseOrderReq(ctx context.Context, reqBody *InsertPurchaseOrderReq) utils.ErrorMessage {
+	if reqBody.SupplierId == "" {
+		slog.ErrorContext(ctx, "missing required fields", "supplier_id", reqBody.SupplierId)
+		return utils.MISSING_REQUIRED_FIELDS
+	}
+
+	supplierExists, err := utils.CheckIfSupplierExists(ctx, reqBody.SupplierId)
+	if err != nil {
+		slog.ErrorContext(ctx, "error checking if supplier exists", "supplier_id", reqBody.SupplierId, "error", err)
+		return utils.SUPPLIER_RETRIEVAL_ERR
+	}
+	if !supplierExists {
+		slog.ErrorContext(ctx, "supplier not found", "supplier_id", reqBody.SupplierId)
+		return utils.INVALID_SUPPLIER_ID
+	}
+
+	if errStr := validateDate(ctx, reqBody.Date); errStr != utils.NO_ERR {
+		return errStr
+	}
+	if reqBody.ExpectedDate != "" {
+		if _, err := time.Parse("2006-01-02", reqBody.ExpectedDate); err != nil {
+			slog.ErrorContext(ctx, "invalid expected_date format", "expected_date", reqBody.ExpectedDate, "error", err)
+			return utils.INVALID_DATE_FORMAT
+		}
+	}
+
+	if len(reqBody.Lines) == 0 {
+		slog.ErrorContext(ctx, "purchase order without lines")
+		return utils.EMPTY_PURCHASE_ORDER
+	}
+	for _, line := range reqBody.Lines {
+		if line.CompoundId == "" || line.CompoundId == "all" {
+			slog.ErrorContext(ctx, "invalid compound_id", "compound_id", line.CompoundId)
+			return utils.INVALID_COMPOUND_ID
+		}
+		if errStr := validateCompoundIdField(ctx, line.CompoundId); errStr != utils.NO_ERR {
+			return errStr
+		}
+		if line.Quantity <= 0 {
+			slog.ErrorContext(ctx, "invalid ordered quantity", "compound_id", line.CompoundId, "quantity", line.Quantity)
+			return utils.INVALID_PO_LINE_QUANTITY
+		}
+	}
+
+	return utils.NO_ERR
+}
+
+func generatePurchaseOrderId(ctx context.Context) string {
+	return utils.NewId(ctx, "PO")
+}
+
+func generatePoLineId(ctx context.Context) string {
+	return utils.NewId(ctx, "POL")
+}
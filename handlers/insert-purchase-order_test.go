@@ -0,0 +1,130 @@
+package handlers_test
+
+import (
+	"chemical-ledger-backend/handlers"
+	"chemical-ledger-backend/testutils"
+	"chemical-ledger-backend/utils"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// A purchase order is received as the deliveries against it are approved, and reopens when one is deleted
+func TestPurchaseOrderReceivedByDeliveries(t *testing.T) {
+	t.Parallel()
+	env := testutils.NewEnv(t, time.Date(2026, 3, 14, 10, 0, 0, 0, time.Local))
+
+	env.InsertCompound("C_1", "Acetone", "ml")
+	if _, err := env.DB.Exec(
+		"INSERT INTO supplier (id, lower_case_name, name) VALUES ('S_1', 'merck', 'Merck'); INSERT INTO user (id, name, role) VALUES ('U_op', 'Operator', 'operator')",
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	handlers.InsertPurchaseOrderHandler(w, env.Request(http.MethodPost, "/insert-purchase-order", strings.NewReader(
+		`{"supplier_id": "S_1", "order_no": "PO-2026-7", "date": "2026-03-01", "lines": [{"compound_id": "C_1", "quantity": 1000}]}`,
+	)))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"purchase_order_id":"PO_1"`) {
+		t.Fatalf("purchase order: status %d, %s", w.Code, w.Body)
+	}
+	var lineId string
+	if err := env.DB.QueryRow("SELECT id FROM purchase_order_line").Scan(&lineId); err != nil {
+		t.Fatal(err)
+	}
+
+	deliver := func(userId string, entryType string, date string, quantity int) *httptest.ResponseRecorder {
+		req := env.Request(http.MethodPost, "/insert-entry", strings.NewReader(fmt.Sprintf(
+			`{"type": %q, "compound_id": "C_1", "date": %q, "num_of_units": 1, "quantity_per_unit": %d, "po_line_id": %q}`,
+			entryType, date, quantity, lineId,
+		)))
+		env.SignIn(req, userId)
+		req.RemoteAddr = "127.0.0.1:51234"
+		w := httptest.NewRecorder()
+		handlers.IdentifyUserMiddleware(http.HandlerFunc(handlers.InsertEntryHandler)).ServeHTTP(w, req)
+		return w
+	}
+	order := func() string {
+		w := httptest.NewRecorder()
+		handlers.GetPurchaseOrderHandler(w, env.Request(http.MethodGet, "/get-purchase-order?id=PO_1", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("get purchase order: status %d, %s", w.Code, w.Body)
+		}
+		return w.Body.String()
+	}
+	onOrder := func() string {
+		w := httptest.NewRecorder()
+		handlers.GetStockHandler(w, env.Request(http.MethodGet, "/stock", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("stock: status %d, %s", w.Code, w.Body)
+		}
+		return w.Body.String()
+	}
+
+	if body := onOrder(); !strings.Contains(body, `"on_order":1000`) {
+		t.Errorf("on order before delivery: %s", body)
+	}
+	if w := deliver(utils.LOCAL_USER_ID, utils.ENTRY_TYPE_OUTGOING, "2026-03-05", 100); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), utils.PO_LINE_ON_NON_INCOMING) {
+		t.Errorf("line on an issue: status %d, %s", w.Code, w.Body)
+	}
+	if w := deliver(utils.LOCAL_USER_ID, utils.ENTRY_TYPE_INCOMING, "2026-03-05", 400); w.Code != http.StatusOK {
+		t.Fatalf("first delivery: status %d, %s", w.Code, w.Body)
+	}
+	if body := order(); !strings.Contains(body, `"status":"partially_received"`) || !strings.Contains(body, `"received_quantity":400,"outstanding":600`) {
+		t.Errorf("after first delivery: %s", body)
+	}
+	if body := onOrder(); !strings.Contains(body, `"net_stock":400`) || !strings.Contains(body, `"on_order":600`) {
+		t.Errorf("on order after first delivery: %s", body)
+	}
+	var supplierId string
+	if err := env.DB.QueryRow("SELECT COALESCE(supplier_id, '') FROM entry WHERE po_line_id = ?", lineId).Scan(&supplierId); err != nil || supplierId != "S_1" {
+		t.Errorf("supplier of the delivery: %q, %v", supplierId, err)
+	}
+
+	// The rest comes in pending and only counts once approved
+	if w := deliver("U_op", utils.ENTRY_TYPE_INCOMING, "2026-03-10", 600); w.Code != http.StatusOK {
+		t.Fatalf("second delivery: status %d, %s", w.Code, w.Body)
+	}
+	if body := order(); !strings.Contains(body, `"received_quantity":400`) {
+		t.Errorf("with a pending delivery: %s", body)
+	}
+	w = httptest.NewRecorder()
+	handlers.CancelPurchaseOrderHandler(w, env.Request(http.MethodPost, "/cancel-purchase-order", strings.NewReader(`{"purchase_order_id": "PO_1"}`)))
+	if w.Code != http.StatusConflict {
+		t.Errorf("cancelling a delivered order: status %d, %s", w.Code, w.Body)
+	}
+
+	var pendingId, firstId string
+	if err := env.DB.QueryRow("SELECT id FROM entry WHERE status = ?", utils.ENTRY_STATUS_PENDING).Scan(&pendingId); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.DB.QueryRow("SELECT id FROM entry WHERE status = ?", utils.ENTRY_STATUS_APPROVED).Scan(&firstId); err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	handlers.ApproveEntryHandler(w, env.Request(http.MethodPost, "/approve-entry", strings.NewReader(`{"entry_ids": ["`+pendingId+`"]}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("approve: status %d, %s", w.Code, w.Body)
+	}
+	if body := order(); !strings.Contains(body, `"status":"received"`) || !strings.Contains(body, `"outstanding":0`) {
+		t.Errorf("after approval: %s", body)
+	}
+	if body := onOrder(); !strings.Contains(body, `"on_order":0`) {
+		t.Errorf("on order once received: %s", body)
+	}
+
+	w = httptest.NewRecorder()
+	handlers.DeleteEntryHandler(w, env.Request(http.MethodDelete, "/delete-entry?id="+firstId, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("delete: status %d, %s", w.Code, w.Body)
+	}
+	if body := order(); !strings.Contains(body, `"status":"partially_received"`) || !strings.Contains(body, `"received_quantity":600`) {
+		t.Errorf("after deleting the first delivery: %s", body)
+	}
+	if body := onOrder(); !strings.Contains(body, `"on_order":400`) {
+		t.Errorf("on order after deleting the first delivery: %s", body)
+	}
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"context"
+	"log/slog"
+	"net/http"
+)
+
+type InsertRecipientReq struct {
+	Name       string `json:"name"`
+	Department string `json:"department"`
+	Phone      string `json:"phone"`
+	Email      string `json:"email"`
+}
+
+func InsertRecipientHandler(w http.ResponseWriter, r *http.Request) {
+	reqBody := &InsertRecipientReq{}
+	if errStr := httpx.DecodeJsonReq(r, reqBody); errStr != utils.NO_ERR {
+		slog.ErrorContext(r.Context(), "failed to decode JSON request", "error", errStr)
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	if reqBody.Name == "" {
+		slog.ErrorContext(r.Context(), "missing required fields", "name", reqBody.Name)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.MISSING_REQUIRED_FIELDS)
+		return
+	}
+
+	recipientId := generateRecipientId(r.Context())
+	lowerCasedName := utils.GetLowerCasedCompoundName(reqBody.Name)
+
+	var recipientExists bool
+	if err := db.ConnFrom(r.Context()).QueryRowContext(r.Context(),
+		"SELECT EXISTS(SELECT 1 FROM recipient WHERE lower_case_name = ?)",
+		lowerCasedName,
+	).Scan(&recipientExists); err != nil {
+		slog.ErrorContext(r.Context(), "error checking if recipient exists", "recipient_name", reqBody.Name, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.RECIPIENT_RETRIEVAL_ERR)
+		return
+	}
+
+	if recipientExists {
+		slog.ErrorContext(r.Context(), "recipient already exists", "recipient_name", reqBody.Name)
+		httpx.RespWithError(w, http.StatusNotAcceptable, utils.RECIPIENT_ALREADY_EXISTS)
+		return
+	}
+
+	if _, err := db.ConnFrom(r.Context()).ExecContext(r.Context(),
+		"INSERT INTO recipient (id, lower_case_name, name, department, phone, email) VALUES (?, ?, ?, ?, ?, ?)",
+		recipientId, lowerCasedName, reqBody.Name, reqBody.Department, reqBody.Phone, reqBody.Email,
+	); err != nil {
+		slog.ErrorContext(r.Context(), "error inserting recipient", "recipient_id", recipientId, "recipient_name", reqBody.Name, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.INSERT_RECIPIENT_ERR)
+		return
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"recipient_id": recipientId,
+	})
+}
+
+func generateRecipientId(ctx context.Context) string {
+	return utils.NewId(ctx, "R")
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+// Receives a snapshot of the primary's database on a standby. The primary sends the shared REPLICATION_TOKEN, the
+// SHA-256 checksum of the snapshot and its sequence number in headers; the snapshot only replaces the replica once
+// it matches its checksum, passes SQLite's integrity check and is newer than the replica.
+func InsertReplicationSnapshotHandler(w http.ResponseWriter, r *http.Request) {
+	token := utils.ReplicationToken()
+	sent := r.Header.Get(utils.REPLICATION_TOKEN_HEADER)
+	if token == "" || subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+		slog.WarnContext(r.Context(), "snapshot with an invalid replication token", "remote_addr", r.RemoteAddr)
+		httpx.RespWithError(w, http.StatusUnauthorized, utils.INVALID_REPLICATION_TOKEN)
+		return
+	}
+
+	sum := r.Header.Get(utils.REPLICATION_SHA256_HEADER)
+	sequence, err := strconv.ParseInt(r.Header.Get(utils.REPLICATION_SEQUENCE_HEADER), 10, 64)
+	if err != nil || !utils.IsSha256Hex(sum) {
+		slog.ErrorContext(r.Context(), "snapshot without checksum or sequence", "sha256", sum, "sequence", r.Header.Get(utils.REPLICATION_SEQUENCE_HEADER))
+		httpx.RespWithError(w, http.StatusBadRequest, utils.INVALID_REPLICATION_SNAPSHOT)
+		return
+	}
+
+	manifest, err := utils.ReceiveSnapshot(r.Context(), r.Body, sum, sequence, r.Header.Get(utils.REPLICATION_TAKEN_AT_HEADER))
+	switch {
+	case errors.Is(err, utils.ErrReplicaChecksum):
+		slog.ErrorContext(r.Context(), "snapshot does not match its checksum", "sequence", sequence)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.REPLICATION_CHECKSUM_MISMATCH)
+		return
+	case errors.Is(err, utils.ErrReplicaCorrupt):
+		httpx.RespWithError(w, http.StatusBadRequest, utils.REPLICATION_SNAPSHOT_CORRUPT)
+		return
+	case errors.Is(err, utils.ErrReplicaStale):
+		slog.WarnContext(r.Context(), "snapshot older than the replica", "sequence", sequence)
+		httpx.RespWithError(w, http.StatusConflict, utils.REPLICATION_SNAPSHOT_STALE)
+		return
+	case err != nil:
+		slog.ErrorContext(r.Context(), "failed to receive snapshot", "sequence", sequence, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.REPLICATION_RECEIVE_ERR)
+		return
+	}
+
+	httpx.RespWithData(w, http.StatusOK, manifest)
+}
@@ -0,0 +1,94 @@
+package handlers_test
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/handlers"
+	"chemical-ledger-backend/testutils"
+	"chemical-ledger-backend/utils"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestSnapshotShippedToStandbyCanBePromoted(t *testing.T) {
+	env := testutils.NewEnv(t, time.Date(2026, 3, 14, 10, 0, 0, 0, time.Local))
+	dir := t.TempDir()
+	t.Setenv("REPLICATION_DIR", dir)
+	t.Setenv("REPLICATION_TOKEN", "s3cret")
+
+	env.InsertCompound("C_1", "Acetone", "ml")
+	if w := insertEntry(env, testutils.ENTRY_TYPE_INCOMING, "C_1", "2026-03-01", 500); w.Code != http.StatusOK {
+		t.Fatalf("insert entry: status %d, %s", w.Code, w.Body)
+	}
+
+	r := chi.NewRouter()
+	r.Post(utils.REPLICATION_SNAPSHOT_PATH, handlers.InsertReplicationSnapshotHandler)
+	r.Get(utils.REPLICATION_STATUS_PATH, handlers.GetReplicationStatusHandler)
+	standby := httptest.NewServer(r)
+	defer standby.Close()
+
+	if err := utils.ShipSnapshot(env.Context(), standby.URL, "wrong"); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("wrong token: %v", err)
+	}
+	if err := utils.ShipSnapshot(env.Context(), standby.URL, "s3cret"); err != nil {
+		t.Fatalf("ship snapshot: %v", err)
+	}
+	resp, err := http.Get(standby.URL + utils.REPLICATION_STATUS_PATH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(manifest), `"sha256":"`) {
+		t.Errorf("replication status: %s", manifest)
+	}
+
+	post := func(body, sum, sequence string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, utils.REPLICATION_SNAPSHOT_PATH, strings.NewReader(body))
+		req.Header.Set(utils.REPLICATION_TOKEN_HEADER, "s3cret")
+		req.Header.Set(utils.REPLICATION_SHA256_HEADER, sum)
+		req.Header.Set(utils.REPLICATION_SEQUENCE_HEADER, sequence)
+		w := httptest.NewRecorder()
+		handlers.InsertReplicationSnapshotHandler(w, req)
+		return w
+	}
+	future := fmt.Sprint(time.Now().Add(time.Hour).UnixNano())
+	garbage := sha256.Sum256([]byte("not a database"))
+	if w := post("not a database", hex.EncodeToString(garbage[:]), future); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), utils.REPLICATION_SNAPSHOT_CORRUPT) {
+		t.Errorf("damaged snapshot: status %d, %s", w.Code, w.Body)
+	}
+	if w := post("cut sh", hex.EncodeToString(garbage[:]), future); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), utils.REPLICATION_CHECKSUM_MISMATCH) {
+		t.Errorf("checksum mismatch: status %d, %s", w.Code, w.Body)
+	}
+	if w := post("not a database", hex.EncodeToString(garbage[:]), "1"); w.Code != http.StatusConflict {
+		t.Errorf("stale snapshot: status %d, %s", w.Code, w.Body)
+	}
+
+	// The damaged snapshots left the replica as it was, so it promotes to the database shipped
+	dbPath := filepath.Join(t.TempDir(), "chemical-ledger.db")
+	if err := os.WriteFile(dbPath, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, keptAs, err := utils.PromoteReplica(dbPath); err != nil || keptAs == "" {
+		t.Fatalf("promote: kept as %q, %v", keptAs, err)
+	}
+	conn, err := db.Open(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	var balance int
+	if err := conn.QueryRow("SELECT balance FROM stock_current WHERE compound_id = 'C_1'").Scan(&balance); err != nil || balance != 500 {
+		t.Errorf("promoted stock %d, %v", balance, err)
+	}
+}
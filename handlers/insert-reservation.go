@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/datetime"
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/stock"
+	"chemical-ledger-backend/utils"
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+type InsertReservationReq struct {
+	CompoundId string `json:"compound_id"`
+	// Quantity set aside, in the scale of the compound
+	Quantity int `json:"quantity"`
+	// Day the compound is needed on, e.g. of a practical, today when not given
+	NeededOn string `json:"needed_on"`
+	Purpose  string `json:"purpose"`
+}
+
+// Sets a quantity of a compound aside for the day it is needed on, e.g. for next week's practical. Only what is
+// available can be reserved: the current stock less what is reserved already. The reservation holds until the end of
+// "needed_on", as the stock is then drawn with an entry, unless it is cancelled before.
+func InsertReservationHandler(w http.ResponseWriter, r *http.Request) {
+	reqBody := &InsertReservationReq{}
+	if errStr := httpx.DecodeJsonReq(r, reqBody); errStr != utils.NO_ERR {
+		slog.ErrorContext(r.Context(), "failed to decode JSON request", "error", errStr)
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	today := datetime.Now(r.Context()).Format("2006-01-02")
+	if reqBody.NeededOn == "" {
+		reqBody.NeededOn = today
+	}
+	if errStr := validateInsertReservationReq(r.Context(), reqBody, today); errStr != utils.NO_ERR {
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	// Entries drawing from the compound change what is available, so they wait for the reservation and it for them
+	unlock := stock.LockCompounds(reqBody.CompoundId)
+	defer unlock()
+
+	tx, err := db.ConnFrom(r.Context()).BeginTx(r.Context(), nil)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error starting transaction", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.TX_START_ERR)
+		return
+	}
+	defer tx.Rollback()
+
+	available, err := stock.Available(r.Context(), tx, reqBody.CompoundId, today)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error getting available stock", "compound_id", reqBody.CompoundId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.RESERVATION_RETRIEVAL_ERR)
+		return
+	}
+	if reqBody.Quantity > available {
+		slog.WarnContext(r.Context(), "reservation exceeds available stock", "compound_id", reqBody.CompoundId, "quantity", reqBody.Quantity, "available", available)
+		httpx.RespWithError(w, http.StatusConflict, utils.RESERVATION_EXCEEDS_AVAILABLE)
+		return
+	}
+
+	actor := currentUser(r)
+	reservationId := generateReservationId(r.Context())
+	if _, err := tx.ExecContext(r.Context(),
+		"INSERT INTO reservation (id, compound_id, quantity, needed_on, purpose, reserved_by, reserved_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		reservationId, reqBody.CompoundId, reqBody.Quantity, reqBody.NeededOn, reqBody.Purpose, actor.Id, datetime.Now(r.Context()).Unix(),
+	); err != nil {
+		slog.ErrorContext(r.Context(), "error inserting reservation", "reservation_id", reservationId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.INSERT_RESERVATION_ERR)
+		return
+	}
+
+	utils.RecordAudit(r.Context(), tx, actor.Id, "reservation.create", utils.AUDIT_TARGET_RESERVATION, reservationId, reqBody)
+
+	if err := tx.Commit(); err != nil {
+		slog.ErrorContext(r.Context(), "error committing transaction", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.COMMIT_TRANSACTION_ERR)
+		return
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"reservation_id": reservationId,
+		"available":      available - reqBody.Quantity,
+	})
+}
+
+func validateInsertReservationReq(ctx context.Context, reqBody *InsertReservationReq, today string) utils.ErrorMessage {
+	if reqBody.CompoundId == "" || reqBody.CompoundId == "all" {
+		slog.ErrorContext(ctx, "invalid compound_id", "compound_id", reqBody.CompoundId)
+		return utils.INVALID_COMPOUND_ID
+	}
+	if errStr := validateCompoundIdField(ctx, reqBody.CompoundId); errStr != utils.NO_ERR {
+		return errStr
+	}
+	if reqBody.Quantity <= 0 {
+		slog.ErrorContext(ctx, "invalid reserved quantity", "compound_id", reqBody.CompoundId, "quantity", reqBody.Quantity)
+		return utils.INVALID_RESERVATION_QUANTITY
+	}
+
+	if _, err := time.Parse("2006-01-02", reqBody.NeededOn); err != nil {
+		slog.ErrorContext(ctx, "invalid needed_on format", "needed_on", reqBody.NeededOn, "error", err)
+		return utils.INVALID_DATE_FORMAT
+	}
+	if reqBody.NeededOn < today {
+		slog.ErrorContext(ctx, "reservation needed on a past day", "needed_on", reqBody.NeededOn)
+		return utils.RESERVATION_IN_PAST
+	}
+
+	return utils.NO_ERR
+}
+
+func generateReservationId(ctx context.Context) string {
+	return utils.NewId(ctx, "RS")
+}
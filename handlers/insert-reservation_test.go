@@ -0,0 +1,92 @@
+package handlers_test
+
+import (
+	"chemical-ledger-backend/handlers"
+	"chemical-ledger-backend/testutils"
+	"chemical-ledger-backend/utils"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Reservations hold part of the stock until the day they are needed on, and /stock tells what is left to reserve
+func TestReservationsHoldStockUntilNeeded(t *testing.T) {
+	t.Parallel()
+	env := testutils.NewEnv(t, time.Date(2026, 3, 14, 10, 0, 0, 0, time.Local))
+
+	env.InsertCompound("C_1", "Acetone", "ml")
+	if _, err := env.DB.Exec("INSERT INTO user (id, name, role) VALUES ('U_op', 'Operator', 'operator')"); err != nil {
+		t.Fatal(err)
+	}
+	if w := insertEntry(env, utils.ENTRY_TYPE_INCOMING, "C_1", "2026-03-10", 1000); w.Code != http.StatusOK {
+		t.Fatalf("delivery: status %d, %s", w.Code, w.Body)
+	}
+
+	reserve := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handlers.InsertReservationHandler(w, env.Request(http.MethodPost, "/insert-reservation", strings.NewReader(body)))
+		return w
+	}
+	stock := func() string {
+		w := httptest.NewRecorder()
+		handlers.GetStockHandler(w, env.Request(http.MethodGet, "/stock", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("stock: status %d, %s", w.Code, w.Body)
+		}
+		return w.Body.String()
+	}
+	cancel := func(userId string, reservationId string) *httptest.ResponseRecorder {
+		req := env.Request(http.MethodDelete, "/delete-reservation?id="+reservationId, nil)
+		env.SignIn(req, userId)
+		req.RemoteAddr = "127.0.0.1:51234"
+		w := httptest.NewRecorder()
+		handlers.IdentifyUserMiddleware(http.HandlerFunc(handlers.DeleteReservationHandler)).ServeHTTP(w, req)
+		return w
+	}
+
+	if w := reserve(`{"compound_id": "C_1", "quantity": 600, "needed_on": "2026-03-13"}`); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), string(utils.RESERVATION_IN_PAST)) {
+		t.Errorf("reservation for a past day: status %d, %s", w.Code, w.Body)
+	}
+	if w := reserve(`{"compound_id": "C_1", "quantity": 600, "needed_on": "2026-03-20", "purpose": "Class 11 practical"}`); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"available":400`) {
+		t.Fatalf("reservation: status %d, %s", w.Code, w.Body)
+	}
+	if w := reserve(`{"compound_id": "C_1", "quantity": 500, "needed_on": "2026-03-16"}`); w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), string(utils.RESERVATION_EXCEEDS_AVAILABLE)) {
+		t.Errorf("reservation beyond what is available: status %d, %s", w.Code, w.Body)
+	}
+	if w := reserve(`{"compound_id": "C_1", "quantity": 300, "needed_on": "2026-03-16"}`); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"available":100`) {
+		t.Fatalf("second reservation: status %d, %s", w.Code, w.Body)
+	}
+	if body := stock(); !strings.Contains(body, `"net_stock":1000,`) || !strings.Contains(body, `"on_order":0,"reserved":900,"available":100`) {
+		t.Errorf("stock with two reservations: %s", body)
+	}
+
+	var reservationId string
+	if err := env.DB.QueryRow("SELECT id FROM reservation WHERE needed_on = '2026-03-20'").Scan(&reservationId); err != nil {
+		t.Fatal(err)
+	}
+	if w := cancel("U_op", reservationId); w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), string(utils.RESERVATION_NOT_OWN)) {
+		t.Errorf("cancelling another user's reservation: status %d, %s", w.Code, w.Body)
+	}
+	if w := cancel(utils.LOCAL_USER_ID, reservationId); w.Code != http.StatusOK {
+		t.Fatalf("cancel: status %d, %s", w.Code, w.Body)
+	}
+	if w := cancel(utils.LOCAL_USER_ID, reservationId); w.Code != http.StatusNotFound {
+		t.Errorf("cancelling again: status %d, %s", w.Code, w.Body)
+	}
+	if body := stock(); !strings.Contains(body, `"reserved":300,"available":700`) {
+		t.Errorf("stock after the cancellation: %s", body)
+	}
+
+	// Past the day it was needed on, the second reservation no longer holds anything
+	env.Clock.Advance(3 * 24 * time.Hour)
+	if body := stock(); !strings.Contains(body, `"reserved":0,"available":1000`) {
+		t.Errorf("stock after the reservation lapsed: %s", body)
+	}
+	w := httptest.NewRecorder()
+	handlers.GetReservationHandler(w, env.Request(http.MethodGet, "/get-reservation?compound_id=C_1", nil))
+	if body := w.Body.String(); w.Code != http.StatusOK || !strings.Contains(body, `"status":"cancelled"`) || !strings.Contains(body, `"status":"lapsed"`) {
+		t.Errorf("reservations: status %d, %s", w.Code, body)
+	}
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/datetime"
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Longest a role can be granted for at once
+const MAX_ROLE_GRANT_HOURS = 14 * 24
+
+type InsertRoleGrantReq struct {
+	UserId string `json:"user_id"`
+	Role   string `json:"role"`
+	Hours  int    `json:"hours"`
+	Reason string `json:"reason"`
+}
+
+// Lets a user act in another role for "hours" (default 24), e.g. a technician approving as a supervisor over a
+// stock-take weekend, after which the grant expires by itself. Admins only; every grant is audited with its "reason".
+func InsertRoleGrantHandler(w http.ResponseWriter, r *http.Request) {
+	reqBody := &InsertRoleGrantReq{}
+	if errStr := httpx.DecodeJsonReq(r, reqBody); errStr != utils.NO_ERR {
+		slog.ErrorContext(r.Context(), "failed to decode JSON request", "error", errStr)
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	if reqBody.Hours == 0 {
+		reqBody.Hours = 24
+	}
+	if errStr := validateRoleGrantReq(r.Context(), reqBody); errStr != utils.NO_ERR {
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	tx, err := db.ConnFrom(r.Context()).BeginTx(r.Context(), nil)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error starting transaction", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.TX_START_ERR)
+		return
+	}
+	defer tx.Rollback()
+
+	now := datetime.Now(r.Context())
+	var active bool
+	if err := tx.QueryRowContext(r.Context(),
+		"SELECT EXISTS(SELECT 1 FROM role_grant WHERE user_id = ? AND revoked_at IS NULL AND expires_at > ?)",
+		reqBody.UserId, now.Unix(),
+	).Scan(&active); err != nil {
+		slog.ErrorContext(r.Context(), "error checking for active role grant", "user_id", reqBody.UserId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.ROLE_GRANT_RETRIEVAL_ERR)
+		return
+	}
+	if active {
+		slog.WarnContext(r.Context(), "user already holds a role grant", "user_id", reqBody.UserId)
+		httpx.RespWithError(w, http.StatusConflict, utils.ROLE_GRANT_ACTIVE)
+		return
+	}
+
+	actor := currentUser(r)
+	roleGrantId := generateRoleGrantId(r.Context())
+	expiresAt := now.Add(time.Duration(reqBody.Hours) * time.Hour)
+	if _, err := tx.ExecContext(r.Context(),
+		"INSERT INTO role_grant (id, user_id, role, reason, granted_by, granted_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		roleGrantId, reqBody.UserId, reqBody.Role, reqBody.Reason, actor.Id, now.Unix(), expiresAt.Unix(),
+	); err != nil {
+		slog.ErrorContext(r.Context(), "error inserting role grant", "role_grant_id", roleGrantId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.INSERT_ROLE_GRANT_ERR)
+		return
+	}
+
+	utils.RecordAudit(r.Context(), tx, actor.Id, "role_grant.create", utils.AUDIT_TARGET_ROLE_GRANT, roleGrantId, reqBody)
+
+	if err := tx.Commit(); err != nil {
+		slog.ErrorContext(r.Context(), "error committing transaction", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.COMMIT_TRANSACTION_ERR)
+		return
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"role_grant_id": roleGrantId,
+		"expires_at":    expiresAt.Format("2006-01-02 15:04:05"),
+	})
+}
+
+func validateRoleGrantReq(ctx context.Context, reqBody *InsertRoleGrantReq) utils.ErrorMessage {
+	if reqBody.UserId == "" || reqBody.Role == "" {
+		slog.ErrorContext(ctx, "missing required fields", "user_id", reqBody.UserId, "role", reqBody.Role)
+		return utils.MISSING_REQUIRED_FIELDS
+	}
+	if reqBody.Reason == "" {
+		slog.ErrorContext(ctx, "role grant without reason", "user_id", reqBody.UserId)
+		return utils.MISSING_GRANT_REASON
+	}
+	if !utils.IsValidRole(reqBody.Role) {
+		slog.ErrorContext(ctx, "invalid role", "role", reqBody.Role)
+		return utils.INVALID_ROLE
+	}
+	if reqBody.Hours < 0 || reqBody.Hours > MAX_ROLE_GRANT_HOURS {
+		slog.ErrorContext(ctx, "invalid role grant hours", "hours", reqBody.Hours)
+		return utils.INVALID_GRANT_HOURS
+	}
+
+	user, err := utils.GetUser(ctx, reqBody.UserId)
+	if err != nil {
+		slog.ErrorContext(ctx, "error getting user", "user_id", reqBody.UserId, "error", err)
+		return utils.USER_RETRIEVAL_ERR
+	}
+	if user == nil || !user.Active {
+		slog.ErrorContext(ctx, "user not found or inactive", "user_id", reqBody.UserId)
+		return utils.INVALID_USER_ID
+	}
+	if user.Role == reqBody.Role {
+		slog.ErrorContext(ctx, "role granted to a user who already has it", "user_id", reqBody.UserId, "role", reqBody.Role)
+		return utils.INVALID_ROLE_GRANT
+	}
+
+	return utils.NO_ERR
+}
+
+func generateRoleGrantId(ctx context.Context) string {
+	return utils.NewId(ctx, "RG")
+}
@@ -0,0 +1,97 @@
+package handlers_test
+
+import (
+	"chemical-ledger-backend/handlers"
+	"chemical-ledger-backend/testutils"
+	"chemical-ledger-backend/utils"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// A technician granted the supervisor role approves as one until the grant expires
+func TestRoleGrantElevatesUntilExpiry(t *testing.T) {
+	t.Parallel()
+	env := testutils.NewEnv(t, time.Date(2026, 3, 14, 10, 0, 0, 0, time.Local))
+
+	env.InsertCompound("C_1", "Acetone", "ml")
+	if _, err := env.DB.Exec("INSERT INTO user (id, name, role) VALUES ('U_tech', 'Technician', 'technician')"); err != nil {
+		t.Fatal(err)
+	}
+
+	grant := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handlers.InsertRoleGrantHandler(w, env.Request(http.MethodPost, "/insert-role-grant", strings.NewReader(body)))
+		return w
+	}
+	as := func(userId string, h http.HandlerFunc, req *http.Request) *httptest.ResponseRecorder {
+		env.SignIn(req, userId)
+		w := httptest.NewRecorder()
+		handlers.IdentifyUserMiddleware(h).ServeHTTP(w, req)
+		return w
+	}
+	me := func() string {
+		return as("U_tech", handlers.GetCurrentUserHandler, env.Request(http.MethodGet, "/me", nil)).Body.String()
+	}
+
+	if w := grant(`{"user_id": "U_tech", "role": "supervisor", "hours": 48}`); w.Code != http.StatusBadRequest {
+		t.Errorf("grant without reason: status %d, %s", w.Code, w.Body)
+	}
+	if w := grant(`{"user_id": "U_tech", "role": "supervisor", "hours": 48, "reason": "stock-take weekend"}`); w.Code != http.StatusOK {
+		t.Fatalf("grant: status %d, %s", w.Code, w.Body)
+	}
+	if w := grant(`{"user_id": "U_tech", "role": "admin", "reason": "again"}`); w.Code != http.StatusConflict {
+		t.Errorf("second grant: status %d, %s", w.Code, w.Body)
+	}
+
+	if body := me(); !strings.Contains(body, `"role":"supervisor"`) || !strings.Contains(body, `"base_role":"technician"`) {
+		t.Errorf("elevated user: %s", body)
+	}
+	w := httptest.NewRecorder()
+	handlers.GetUserHandler(w, env.Request(http.MethodGet, "/get-user", nil))
+	if !strings.Contains(w.Body.String(), `"base_role":"technician","elevated_until":"2026-03-16 10:00:00"`) {
+		t.Errorf("user list: %s", w.Body)
+	}
+	w = as("U_tech", handlers.InsertEntryHandler, env.Request(http.MethodPost, "/insert-entry", strings.NewReader(
+		`{"type": "incoming", "compound_id": "C_1", "date": "2026-03-14", "num_of_units": 1, "quantity_per_unit": 100}`,
+	)))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), utils.ENTRY_STATUS_APPROVED) {
+		t.Errorf("entry while elevated: status %d, %s", w.Code, w.Body)
+	}
+
+	env.Clock.Advance(49 * time.Hour)
+	if body := me(); !strings.Contains(body, `"role":"technician"`) || strings.Contains(body, "base_role") {
+		t.Errorf("after expiry: %s", body)
+	}
+	if err := utils.ExpireRoleGrants(env.Context()); err != nil {
+		t.Fatal(err)
+	}
+	var expired int
+	if err := env.DB.QueryRow("SELECT COUNT(*) FROM audit_log WHERE action = 'role_grant.expire'").Scan(&expired); err != nil || expired != 1 {
+		t.Errorf("expiry audit records: %d, %v", expired, err)
+	}
+
+	// A new grant can be revoked before it runs out
+	if w := grant(`{"user_id": "U_tech", "role": "supervisor", "reason": "approver on leave"}`); w.Code != http.StatusOK {
+		t.Fatalf("second grant: status %d, %s", w.Code, w.Body)
+	}
+	var grantId string
+	if err := env.DB.QueryRow("SELECT id FROM role_grant WHERE expired_at IS NULL").Scan(&grantId); err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	handlers.DeleteRoleGrantHandler(w, env.Request(http.MethodDelete, "/delete-role-grant?id="+grantId, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("revoke: status %d, %s", w.Code, w.Body)
+	}
+	if body := me(); !strings.Contains(body, `"role":"technician"`) {
+		t.Errorf("after revoke: %s", body)
+	}
+	w = httptest.NewRecorder()
+	handlers.GetRoleGrantHandler(w, env.Request(http.MethodGet, "/get-role-grant?user_id=U_tech", nil))
+	if body := w.Body.String(); !strings.Contains(body, `"status":"expired"`) || !strings.Contains(body, `"status":"revoked"`) {
+		t.Errorf("grants: %s", body)
+	}
+}
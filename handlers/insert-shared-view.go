@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/datetime"
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+)
+
+// Views that can be shared, by path, with the handler used to take their snapshot
+var sharedViewHandlers = map[string]http.HandlerFunc{
+	"/get-entry":                     GetEntryHandler,
+	"/stock":                         GetStockHandler,
+	"/lots":                          GetLotsHandler,
+	"/dashboard":                     GetDashboardHandler,
+	"/report/summary":                GetSummaryReportHandler,
+	"/report/statement":              GetStatementReportHandler,
+	"/report/purchases":              GetPurchaseReportHandler,
+	"/report/department-consumption": GetDepartmentReportHandler,
+	"/report/shrinkage":              GetShrinkageReportHandler,
+}
+
+type InsertSharedViewReq struct {
+	Path     string            `json:"path"`
+	Filters  map[string]string `json:"filters"`
+	Snapshot bool              `json:"snapshot"`
+}
+
+// Turns a view (one of "sharedViewHandlers") and its filters into a short token that GET /share/{token}
+// resolves back, so a view can be shared as a link. With "snapshot" the view is also run right away and its
+// data kept, so the link shows the ledger as it was when shared.
+func InsertSharedViewHandler(w http.ResponseWriter, r *http.Request) {
+	reqBody := &InsertSharedViewReq{}
+	if errStr := httpx.DecodeJsonReq(r, reqBody); errStr != utils.NO_ERR {
+		slog.ErrorContext(r.Context(), "failed to decode JSON request", "error", errStr)
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	handler, ok := sharedViewHandlers[reqBody.Path]
+	if !ok {
+		slog.ErrorContext(r.Context(), "view cannot be shared", "path", reqBody.Path)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.INVALID_SHARED_VIEW_PATH)
+		return
+	}
+
+	query := url.Values{}
+	for name, value := range reqBody.Filters {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+	filters := query.Encode()
+
+	var snapshot, snapshotAt any
+	if reqBody.Snapshot {
+		viewReq, err := http.NewRequestWithContext(r.Context(), http.MethodGet, reqBody.Path+"?"+filters, nil)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to build shared view request", "path", reqBody.Path, "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.INSERT_SHARED_VIEW_ERR)
+			return
+		}
+		recorder := httptest.NewRecorder()
+		handler(recorder, viewReq)
+
+		// Only JSON views can be kept, exports (CSV, xlsx, PDF) set a content type of their own
+		if contentType := recorder.Header().Get("Content-Type"); contentType != "" && !strings.HasPrefix(contentType, "application/json") {
+			slog.ErrorContext(r.Context(), "shared view snapshot is not JSON", "path", reqBody.Path, "content_type", contentType)
+			httpx.RespWithError(w, http.StatusBadRequest, utils.SHARED_VIEW_NOT_JSON)
+			return
+		}
+
+		var resp struct {
+			Error any             `json:"error"`
+			Data  json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil {
+			slog.ErrorContext(r.Context(), "failed to decode shared view snapshot", "path", reqBody.Path, "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.INSERT_SHARED_VIEW_ERR)
+			return
+		}
+		// Filters the view rejects are reported as the view reports them
+		if recorder.Code != http.StatusOK {
+			slog.ErrorContext(r.Context(), "shared view failed", "path", reqBody.Path, "filters", filters, "status", recorder.Code)
+			httpx.EncodeJsonRes(w, recorder.Code, &httpx.Resp{Error: resp.Error})
+			return
+		}
+		snapshot = string(resp.Data)
+		snapshotAt = datetime.Now(r.Context()).Unix()
+	}
+
+	token, err := generateShareToken()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to generate share token", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.INSERT_SHARED_VIEW_ERR)
+		return
+	}
+
+	actorId := currentUser(r).Id
+	if _, err := db.ConnFrom(r.Context()).ExecContext(r.Context(),
+		"INSERT INTO shared_view (token, path, filters, snapshot, snapshot_at, created_by, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		token, reqBody.Path, filters, snapshot, snapshotAt, actorId, datetime.Now(r.Context()).Unix(),
+	); err != nil {
+		slog.ErrorContext(r.Context(), "failed to insert shared view", "path", reqBody.Path, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.INSERT_SHARED_VIEW_ERR)
+		return
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"token": token,
+		"url":   sharedViewUrl(reqBody.Path, filters),
+	})
+}
+
+// Short random token, 11 URL safe characters
+func generateShareToken() (string, error) {
+	raw := make([]byte, 8)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func sharedViewUrl(path, filters string) string {
+	if filters == "" {
+		return path
+	}
+	return path + "?" + filters
+}
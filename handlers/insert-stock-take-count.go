@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/datetime"
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"context"
+	"database/sql"
+	"log/slog"
+	"net/http"
+)
+
+type StockTakeCount struct {
+	CompoundId      string             `json:"compound_id"`
+	CountedQuantity utils.LocalizedInt `json:"counted_quantity"`
+}
+
+type InsertStockTakeCountReq struct {
+	StockTakeId string           `json:"stock_take_id"`
+	Counts      []StockTakeCount `json:"counts"`
+}
+
+// Records the counted quantity of one or more compounds in an open stock-take. Counting a compound again
+// replaces its previous count.
+func InsertStockTakeCountHandler(w http.ResponseWriter, r *http.Request) {
+	reqBody := &InsertStockTakeCountReq{}
+	if errStr := httpx.DecodeJsonReq(r, reqBody); errStr != utils.NO_ERR {
+		slog.ErrorContext(r.Context(), "failed to decode JSON request", "error", errStr)
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	if reqBody.StockTakeId == "" || len(reqBody.Counts) == 0 {
+		slog.ErrorContext(r.Context(), "missing required fields", "stock_take_id", reqBody.StockTakeId, "counts", len(reqBody.Counts))
+		httpx.RespWithError(w, http.StatusBadRequest, utils.MISSING_REQUIRED_FIELDS)
+		return
+	}
+
+	for _, count := range reqBody.Counts {
+		if count.CompoundId == "" {
+			slog.ErrorContext(r.Context(), "missing compound in stock-take count", "stock_take_id", reqBody.StockTakeId)
+			httpx.RespWithError(w, http.StatusBadRequest, utils.MISSING_REQUIRED_FIELDS)
+			return
+		}
+		if count.CountedQuantity < 0 {
+			slog.ErrorContext(r.Context(), "negative counted quantity", "stock_take_id", reqBody.StockTakeId, "compound_id", count.CompoundId, "counted_quantity", count.CountedQuantity)
+			httpx.RespWithError(w, http.StatusBadRequest, utils.INVALID_COUNTED_QUANTITY)
+			return
+		}
+		compoundExists, err := utils.CheckIfCompoundExists(r.Context(), count.CompoundId)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "error checking if compound exists", "compound_id", count.CompoundId, "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.COMPOUND_ID_CHECK_ERR)
+			return
+		}
+		if !compoundExists {
+			slog.ErrorContext(r.Context(), "compound not found", "compound_id", count.CompoundId)
+			httpx.RespWithError(w, http.StatusNotFound, utils.INVALID_COMPOUND_ID)
+			return
+		}
+	}
+
+	tx, err := db.ConnFrom(r.Context()).BeginTx(r.Context(), nil)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error starting transaction", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.TX_START_ERR)
+		return
+	}
+	defer tx.Rollback()
+
+	if status, errStr := checkStockTakeOpen(r.Context(), tx, reqBody.StockTakeId); errStr != utils.NO_ERR {
+		httpx.RespWithError(w, status, errStr)
+		return
+	}
+
+	actorId := currentUser(r).Id
+	countedAt := datetime.Now(r.Context()).Unix()
+	for _, count := range reqBody.Counts {
+		if _, err := tx.ExecContext(r.Context(), `
+			INSERT INTO stock_take_count (stock_take_id, compound_id, counted_quantity, counted_by, counted_at) VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT(stock_take_id, compound_id) DO UPDATE SET
+				counted_quantity = excluded.counted_quantity,
+				counted_by = excluded.counted_by,
+				counted_at = excluded.counted_at`,
+			reqBody.StockTakeId, count.CompoundId, int(count.CountedQuantity), actorId, countedAt,
+		); err != nil {
+			slog.ErrorContext(r.Context(), "error inserting stock-take count", "stock_take_id", reqBody.StockTakeId, "compound_id", count.CompoundId, "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.STOCK_TAKE_UPDATE_ERR)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.ErrorContext(r.Context(), "error committing transaction", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.COMMIT_TRANSACTION_ERR)
+		return
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"stock_take_id": reqBody.StockTakeId,
+		"counted":       len(reqBody.Counts),
+	})
+}
+
+// Checks that the stock-take exists and is still open, giving the status to respond with when it is not
+func checkStockTakeOpen(ctx context.Context, tx *sql.Tx, stockTakeId string) (int, utils.ErrorMessage) {
+	var status string
+	err := tx.QueryRowContext(ctx, "SELECT status FROM stock_take WHERE id = ?", stockTakeId).Scan(&status)
+	if err == sql.ErrNoRows {
+		slog.ErrorContext(ctx, "stock-take not found", "stock_take_id", stockTakeId)
+		return http.StatusNotFound, utils.INVALID_STOCK_TAKE_ID
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "error retrieving stock-take", "stock_take_id", stockTakeId, "error", err)
+		return http.StatusInternalServerError, utils.STOCK_TAKE_RETRIEVAL_ERR
+	}
+	if status != utils.STOCK_TAKE_STATUS_OPEN {
+		slog.ErrorContext(ctx, "stock-take is closed", "stock_take_id", stockTakeId, "status", status)
+		return http.StatusConflict, utils.STOCK_TAKE_CLOSED
+	}
+	return http.StatusOK, utils.NO_ERR
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/datetime"
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"context"
+	"log/slog"
+	"net/http"
+)
+
+type InsertStockTakeReq struct {
+	Date   string `json:"date"`
+	Remark string `json:"remark"`
+}
+
+// Opens a stock-take: a physical count of the stock at the end of the given day (today when not given).
+// Counts are then submitted per compound and compared to the ledger until the stock-take is approved.
+func InsertStockTakeHandler(w http.ResponseWriter, r *http.Request) {
+	reqBody := &InsertStockTakeReq{}
+	if errStr := httpx.DecodeJsonReq(r, reqBody); errStr != utils.NO_ERR {
+		slog.ErrorContext(r.Context(), "failed to decode JSON request", "error", errStr)
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	if reqBody.Date == "" {
+		reqBody.Date = datetime.Now(r.Context()).Format("2006-01-02")
+	}
+	if errStr := validateDate(r.Context(), reqBody.Date); errStr != utils.NO_ERR {
+		slog.ErrorContext(r.Context(), "invalid stock-take date", "date", reqBody.Date, "error", errStr)
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	actor := currentUser(r)
+	stockTakeId := generateStockTakeId(r.Context())
+	if _, err := db.ConnFrom(r.Context()).ExecContext(r.Context(),
+		"INSERT INTO stock_take (id, date, remark, status, opened_by, opened_at) VALUES (?, ?, ?, ?, ?, ?)",
+		stockTakeId, reqBody.Date, reqBody.Remark, utils.STOCK_TAKE_STATUS_OPEN, actor.Id, datetime.Now(r.Context()).Unix(),
+	); err != nil {
+		slog.ErrorContext(r.Context(), "error inserting stock-take", "stock_take_id", stockTakeId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.INSERT_STOCK_TAKE_ERR)
+		return
+	}
+
+	utils.RecordAudit(r.Context(), nil, actor.Id, "stock_take.open", utils.AUDIT_TARGET_STOCK_TAKE, stockTakeId, reqBody)
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"stock_take_id": stockTakeId,
+	})
+}
+
+func generateStockTakeId(ctx context.Context) string {
+	return utils.NewId(ctx, "ST")
+}
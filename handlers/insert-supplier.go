@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"context"
+	"log/slog"
+	"net/http"
+)
+
+type InsertSupplierReq struct {
+	Name          string `json:"name"`
+	ContactPerson string `json:"contact_person"`
+	Phone         string `json:"phone"`
+	Email         string `json:"email"`
+	Address       string `json:"address"`
+}
+
+func InsertSupplierHandler(w http.ResponseWriter, r *http.Request) {
+	reqBody := &InsertSupplierReq{}
+	if errStr := httpx.DecodeJsonReq(r, reqBody); errStr != utils.NO_ERR {
+		slog.ErrorContext(r.Context(), "failed to decode JSON request", "error", errStr)
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	if reqBody.Name == "" {
+		slog.ErrorContext(r.Context(), "missing required fields", "name", reqBody.Name)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.MISSING_REQUIRED_FIELDS)
+		return
+	}
+
+	supplierId := generateSupplierId(r.Context())
+	lowerCasedName := utils.GetLowerCasedCompoundName(reqBody.Name)
+
+	var supplierExists bool
+	if err := db.ConnFrom(r.Context()).QueryRowContext(r.Context(),
+		"SELECT EXISTS(SELECT 1 FROM supplier WHERE lower_case_name = ?)",
+		lowerCasedName,
+	).Scan(&supplierExists); err != nil {
+		slog.ErrorContext(r.Context(), "error checking if supplier exists", "supplier_name", reqBody.Name, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.SUPPLIER_RETRIEVAL_ERR)
+		return
+	}
+
+	if supplierExists {
+		slog.ErrorContext(r.Context(), "supplier already exists", "supplier_name", reqBody.Name)
+		httpx.RespWithError(w, http.StatusNotAcceptable, utils.SUPPLIER_ALREADY_EXISTS)
+		return
+	}
+
+	if _, err := db.ConnFrom(r.Context()).ExecContext(r.Context(),
+		"INSERT INTO supplier (id, lower_case_name, name, contact_person, phone, email, address) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		supplierId, lowerCasedName, reqBody.Name, reqBody.ContactPerson, reqBody.Phone, reqBody.Email, reqBody.Address,
+	); err != nil {
+		slog.ErrorContext(r.Context(), "error inserting supplier", "supplier_id", supplierId, "supplier_name", reqBody.Name, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.INSERT_SUPPLIER_ERR)
+		return
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"supplier_id": supplierId,
+	})
+}
+
+func generateSupplierId(ctx context.Context) string {
+	return utils.NewId(ctx, "S")
+}
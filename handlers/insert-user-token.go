@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/datetime"
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+type InsertUserTokenReq struct {
+	UserId string `json:"user_id"`
+	// Where the token is used, e.g. "lab tablet", to tell a user's tokens apart
+	Label string `json:"label"`
+}
+
+// Issues a token the user signs in with, sent as "Authorization: Bearer <token>" (see IdentifyUserMiddleware).
+// The token is only answered here, as just its hash is kept; a lost one is revoked and another issued. Admins only.
+func InsertUserTokenHandler(w http.ResponseWriter, r *http.Request) {
+	reqBody := &InsertUserTokenReq{}
+	if errStr := httpx.DecodeJsonReq(r, reqBody); errStr != utils.NO_ERR {
+		slog.ErrorContext(r.Context(), "failed to decode JSON request", "error", errStr)
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	reqBody.Label = strings.TrimSpace(reqBody.Label)
+	if errStr := validateUserTokenReq(r.Context(), reqBody); errStr != utils.NO_ERR {
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	token, err := utils.NewUserToken()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to generate user token", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.INSERT_USER_TOKEN_ERR)
+		return
+	}
+
+	actor := currentUser(r)
+	tokenId := generateUserTokenId(r.Context())
+	if _, err := db.ConnFrom(r.Context()).ExecContext(r.Context(),
+		"INSERT INTO user_token (id, user_id, token_hash, label, created_by, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		tokenId, reqBody.UserId, utils.HashUserToken(token), reqBody.Label, actor.Id, datetime.Now(r.Context()).Unix(),
+	); err != nil {
+		slog.ErrorContext(r.Context(), "error inserting user token", "token_id", tokenId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.INSERT_USER_TOKEN_ERR)
+		return
+	}
+
+	utils.RecordAudit(r.Context(), nil, actor.Id, "user_token.issue", utils.AUDIT_TARGET_USER_TOKEN, tokenId, reqBody)
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"token_id": tokenId,
+		"token":    token,
+	})
+}
+
+func validateUserTokenReq(ctx context.Context, reqBody *InsertUserTokenReq) utils.ErrorMessage {
+	if reqBody.UserId == "" {
+		slog.ErrorContext(ctx, "missing required field", "field", "user_id")
+		return utils.MISSING_REQUIRED_FIELDS
+	}
+	if reqBody.UserId == utils.LOCAL_USER_ID {
+		slog.ErrorContext(ctx, "token for the local administrator")
+		return utils.LOCAL_USER_TOKEN
+	}
+
+	user, err := utils.GetUser(ctx, reqBody.UserId)
+	if err != nil {
+		slog.ErrorContext(ctx, "error getting user", "user_id", reqBody.UserId, "error", err)
+		return utils.USER_RETRIEVAL_ERR
+	}
+	if user == nil || !user.Active {
+		slog.ErrorContext(ctx, "user not found or inactive", "user_id", reqBody.UserId)
+		return utils.INVALID_USER_ID
+	}
+
+	return utils.NO_ERR
+}
+
+func generateUserTokenId(ctx context.Context) string {
+	return utils.NewId(ctx, "UT")
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"context"
+	"log/slog"
+	"net/http"
+)
+
+type InsertUserReq struct {
+	Name         string `json:"name"`
+	Role         string `json:"role"`
+	SupervisorId string `json:"supervisor_id"`
+}
+
+func InsertUserHandler(w http.ResponseWriter, r *http.Request) {
+	if !checkQuota(r.Context(), w, utils.QUOTA_USERS) {
+		return
+	}
+
+	reqBody := &InsertUserReq{}
+	if errStr := httpx.DecodeJsonReq(r, reqBody); errStr != utils.NO_ERR {
+		slog.ErrorContext(r.Context(), "failed to decode JSON request", "error", errStr)
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	if errStr := validateUserFields(r.Context(), reqBody, ""); errStr != utils.NO_ERR {
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	userId := generateUserId(r.Context())
+	if _, err := db.ConnFrom(r.Context()).ExecContext(r.Context(),
+		"INSERT INTO user (id, name, role, supervisor_id) VALUES (?, ?, ?, NULLIF(?, ''))",
+		userId, reqBody.Name, reqBody.Role, reqBody.SupervisorId,
+	); err != nil {
+		slog.ErrorContext(r.Context(), "error inserting user", "user_id", userId, "name", reqBody.Name, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.INSERT_USER_ERR)
+		return
+	}
+
+	utils.RecordAudit(r.Context(), nil, currentUser(r).Id, "user.create", utils.AUDIT_TARGET_USER, userId, reqBody)
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"user_id": userId,
+	})
+}
+
+func validateUserFields(ctx context.Context, reqBody *InsertUserReq, userId string) utils.ErrorMessage {
+	if reqBody.Name == "" || reqBody.Role == "" {
+		slog.ErrorContext(ctx, "missing required fields", "name", reqBody.Name, "role", reqBody.Role)
+		return utils.MISSING_REQUIRED_FIELDS
+	}
+
+	if !utils.IsValidRole(reqBody.Role) {
+		slog.ErrorContext(ctx, "invalid role", "role", reqBody.Role)
+		return utils.INVALID_ROLE
+	}
+
+	if reqBody.SupervisorId != "" {
+		if reqBody.SupervisorId == userId {
+			slog.ErrorContext(ctx, "user cannot supervise themselves", "user_id", userId)
+			return utils.INVALID_USER_ID
+		}
+		supervisor, err := utils.GetUser(ctx, reqBody.SupervisorId)
+		if err != nil {
+			slog.ErrorContext(ctx, "error getting supervisor", "supervisor_id", reqBody.SupervisorId, "error", err)
+			return utils.USER_RETRIEVAL_ERR
+		}
+		if supervisor == nil {
+			slog.ErrorContext(ctx, "supervisor not found", "supervisor_id", reqBody.SupervisorId)
+			return utils.INVALID_USER_ID
+		}
+	}
+
+	return utils.NO_ERR
+}
+
+func generateUserId(ctx context.Context) string {
+	return utils.NewId(ctx, "U")
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/datetime"
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/stock"
+	"chemical-ledger-backend/utils"
+	"context"
+	"database/sql"
+	"log/slog"
+	"net/http"
+)
+
+type MergeCompoundReq struct {
+	SourceId string `json:"source_id"`
+	TargetId string `json:"target_id"`
+}
+
+// Merges a compound created twice, e.g. "Acetic acid" and "acetic acid ", into one: the entries, their lots, the
+// stock-take counts, attachments, purchase order and invoice lines and reservations of the source move to the target,
+// whose stock is recalculated from its first entry, and the source is archived. Both must be measured in the same scale, the target must not be archived, and a stock-take
+// that counted both is refused as one of the counts would be lost. Admins and supervisors only; every merge is audited.
+func MergeCompoundHandler(w http.ResponseWriter, r *http.Request) {
+	reqBody := &MergeCompoundReq{}
+	if errStr := httpx.DecodeJsonReq(r, reqBody); errStr != utils.NO_ERR {
+		slog.ErrorContext(r.Context(), "failed to decode JSON request", "error", errStr)
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	if reqBody.SourceId == "" || reqBody.TargetId == "" {
+		slog.WarnContext(r.Context(), "missing required field", "source_id", reqBody.SourceId, "target_id", reqBody.TargetId)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.MISSING_REQUIRED_FIELDS)
+		return
+	}
+	if reqBody.SourceId == reqBody.TargetId {
+		slog.WarnContext(r.Context(), "compound merged into itself", "compound_id", reqBody.SourceId)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.SAME_COMPOUND_MERGE)
+		return
+	}
+
+	unlock := stock.LockCompounds(reqBody.SourceId, reqBody.TargetId)
+	defer unlock()
+
+	tx, err := db.ConnFrom(r.Context()).BeginTx(r.Context(), nil)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error starting transaction", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.TX_START_ERR)
+		return
+	}
+	defer tx.Rollback()
+
+	if status, errStr := checkCompoundsMergeable(r.Context(), tx, reqBody.SourceId, reqBody.TargetId); errStr != utils.NO_ERR {
+		httpx.RespWithError(w, status, errStr)
+		return
+	}
+
+	// Moving entries of a locked month would change its closed books
+	var firstDate sql.NullInt64
+	if err := tx.QueryRowContext(r.Context(), "SELECT MIN(date) FROM entry WHERE compound_id = ?", reqBody.SourceId).Scan(&firstDate); err != nil {
+		slog.ErrorContext(r.Context(), "error retrieving first entry of compound", "compound_id", reqBody.SourceId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.ENTRY_RETRIEVAL_ERR)
+		return
+	}
+	if firstDate.Valid {
+		if status, errStr := checkEntryDatesUnlocked(r.Context(), firstDate.Int64); errStr != utils.NO_ERR {
+			httpx.RespWithError(w, status, errStr)
+			return
+		}
+	}
+
+	result, err := tx.ExecContext(r.Context(), "UPDATE entry SET compound_id = ? WHERE compound_id = ?", reqBody.TargetId, reqBody.SourceId)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error moving entries of compound", "source_id", reqBody.SourceId, "target_id", reqBody.TargetId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.COMPOUND_MERGE_ERR)
+		return
+	}
+	entries, _ := result.RowsAffected()
+
+	if _, err := tx.ExecContext(r.Context(),
+		"UPDATE stock_take_count SET compound_id = ? WHERE compound_id = ?; UPDATE attachment SET compound_id = ? WHERE compound_id = ?; UPDATE purchase_order_line SET compound_id = ? WHERE compound_id = ?; UPDATE invoice_line SET compound_id = ? WHERE compound_id = ?; UPDATE reservation SET compound_id = ? WHERE compound_id = ?",
+		reqBody.TargetId, reqBody.SourceId, reqBody.TargetId, reqBody.SourceId, reqBody.TargetId, reqBody.SourceId, reqBody.TargetId, reqBody.SourceId, reqBody.TargetId, reqBody.SourceId,
+	); err != nil {
+		slog.ErrorContext(r.Context(), "error moving stock-take counts, attachments, purchase order and invoice lines and reservations of compound", "source_id", reqBody.SourceId, "target_id", reqBody.TargetId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.COMPOUND_MERGE_ERR)
+		return
+	}
+
+	// The lots follow their entries as the target is recalculated, the source is left without stock
+	for _, compoundId := range []string{reqBody.TargetId, reqBody.SourceId} {
+		if errStr := stock.UpdateNetStockFromTodayOnwards(r.Context(), tx, compoundId, 0); errStr != utils.NO_ERR {
+			slog.ErrorContext(r.Context(), "error updating net stock after compound merge", "compound_id", compoundId, "error", errStr)
+			httpx.RespWithError(w, recalculationErrStatus(errStr), errStr)
+			return
+		}
+	}
+
+	actorId := currentUser(r).Id
+	if _, err := tx.ExecContext(r.Context(),
+		"UPDATE compound SET archived_at = COALESCE(archived_at, ?), archived_by = COALESCE(archived_by, ?) WHERE id = ?",
+		datetime.Now(r.Context()).Unix(), actorId, reqBody.SourceId,
+	); err != nil {
+		slog.ErrorContext(r.Context(), "error archiving merged compound", "compound_id", reqBody.SourceId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.COMPOUND_MERGE_ERR)
+		return
+	}
+
+	utils.RecordAudit(r.Context(), tx, actorId, "compound.merge", utils.AUDIT_TARGET_COMPOUND, reqBody.TargetId, map[string]any{
+		"source_id": reqBody.SourceId,
+		"entries":   entries,
+	})
+
+	if err := tx.Commit(); err != nil {
+		slog.ErrorContext(r.Context(), "error committing transaction", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.COMMIT_TRANSACTION_ERR)
+		return
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"compound_id":   reqBody.TargetId,
+		"merged_id":     reqBody.SourceId,
+		"moved_entries": entries,
+	})
+}
+
+func checkCompoundsMergeable(ctx context.Context, tx *sql.Tx, sourceId string, targetId string) (int, utils.ErrorMessage) {
+	var sourceScale, targetScale string
+	var targetArchived, countedTogether bool
+	err := tx.QueryRowContext(ctx, `
+		SELECT s.scale, t.scale, t.archived_at IS NOT NULL,
+			EXISTS(
+				SELECT 1 FROM stock_take_count sc
+				JOIN stock_take_count tc ON tc.stock_take_id = sc.stock_take_id AND tc.compound_id = t.id
+				WHERE sc.compound_id = s.id
+			)
+		FROM compound s, compound t
+		WHERE s.id = ? AND t.id = ?`,
+		sourceId, targetId,
+	).Scan(&sourceScale, &targetScale, &targetArchived, &countedTogether)
+	if err == sql.ErrNoRows {
+		slog.WarnContext(ctx, "compound not found", "source_id", sourceId, "target_id", targetId)
+		return http.StatusNotFound, utils.INVALID_COMPOUND_ID
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to check compounds to merge", "source_id", sourceId, "target_id", targetId, "error", err)
+		return http.StatusInternalServerError, utils.COMPOUND_RETRIEVAL_ERR
+	}
+
+	switch {
+	case sourceScale != targetScale:
+		slog.WarnContext(ctx, "compounds to merge differ in scale", "source_scale", sourceScale, "target_scale", targetScale)
+		return http.StatusNotAcceptable, utils.COMPOUND_MERGE_SCALE_MISMATCH
+	case targetArchived:
+		slog.WarnContext(ctx, "compound merged into an archived one", "target_id", targetId)
+		return http.StatusNotAcceptable, utils.COMPOUND_MERGE_TARGET_ARCHIVED
+	case countedTogether:
+		slog.WarnContext(ctx, "compounds to merge counted in the same stock-take", "source_id", sourceId, "target_id", targetId)
+		return http.StatusConflict, utils.COMPOUND_MERGE_COUNT_CONFLICT
+	}
+	return http.StatusOK, utils.NO_ERR
+}
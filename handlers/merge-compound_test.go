@@ -0,0 +1,53 @@
+package handlers_test
+
+import (
+	"chemical-ledger-backend/handlers"
+	"chemical-ledger-backend/testutils"
+	"chemical-ledger-backend/utils"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMergeCompoundMovesEntriesAndArchivesSource(t *testing.T) {
+	t.Parallel()
+	env := testutils.NewEnv(t, time.Date(2026, 3, 14, 10, 0, 0, 0, time.Local))
+
+	env.InsertCompound("C_1", "Acetic acid", "ml")
+	env.InsertCompound("C_2", "Acetic acid 2", "ml")
+	for _, w := range []*httptest.ResponseRecorder{
+		insertEntry(env, utils.ENTRY_TYPE_INCOMING, "C_1", "2026-03-02", 500),
+		insertEntry(env, utils.ENTRY_TYPE_INCOMING, "C_2", "2026-03-03", 300),
+	} {
+		if w.Code != http.StatusOK {
+			t.Fatalf("delivery: status %d, %s", w.Code, w.Body)
+		}
+	}
+	// The issue of 700 ml only fits once both deliveries are one compound
+	if w := insertEntry(env, utils.ENTRY_TYPE_OUTGOING, "C_1", "2026-03-04", 700); w.Code != http.StatusNotAcceptable {
+		t.Fatalf("issue before merge: status %d, %s", w.Code, w.Body)
+	}
+
+	w := httptest.NewRecorder()
+	handlers.MergeCompoundHandler(w, env.Request(http.MethodPost, "/merge-compound", strings.NewReader(`{"source_id": "C_2", "target_id": "C_1"}`)))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"moved_entries":1`) {
+		t.Fatalf("merge: status %d, %s", w.Code, w.Body)
+	}
+	if w := insertEntry(env, utils.ENTRY_TYPE_OUTGOING, "C_1", "2026-03-04", 700); w.Code != http.StatusOK {
+		t.Fatalf("issue after merge: status %d, %s", w.Code, w.Body)
+	}
+	env.AssertNetStock("C_1")
+
+	var archived bool
+	if err := env.DB.QueryRow("SELECT archived_at IS NOT NULL FROM compound WHERE id = 'C_2'").Scan(&archived); err != nil || !archived {
+		t.Errorf("source archived: %v, %v", archived, err)
+	}
+
+	w = httptest.NewRecorder()
+	handlers.MergeCompoundHandler(w, env.Request(http.MethodPost, "/merge-compound", strings.NewReader(`{"source_id": "C_1", "target_id": "C_2"}`)))
+	if w.Code != http.StatusNotAcceptable {
+		t.Errorf("merge into archived compound: status %d, %s", w.Code, w.Body)
+	}
+}
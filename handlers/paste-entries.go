@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"bytes"
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/stock"
+	"chemical-ledger-backend/utils"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Outcome of a pasted row, numbered by its line in the paste: the entry it became, or what is wrong with it
+type PasteRowResult struct {
+	Row     int              `json:"row"`
+	Valid   bool             `json:"valid"`
+	EntryId string           `json:"entry_id,omitempty"`
+	Errors  []ImportRowError `json:"errors,omitempty"`
+}
+
+type PasteReport struct {
+	DryRun   bool             `json:"dry_run"`
+	Rows     int              `json:"rows"`
+	Inserted int              `json:"inserted"`
+	Status   string           `json:"status,omitempty"`
+	ImportId string           `json:"import_id,omitempty"`
+	Results  []PasteRowResult `json:"results"`
+	Errors   []ImportRowError `json:"errors"`
+}
+
+// Inserts entries pasted as text, e.g. rows copied from a spreadsheet into a text area. The body is plain text,
+// tab separated when the first line holds a tab and comma separated otherwise. The first line names the columns
+// like an import file, unless they are given in order with "columns", e.g. "type,compound,date,num_of_units,quantity_per_unit".
+// "mapping" works as for imports. Unlike an import, the valid rows are inserted even when others are not; every
+// row gets its result. The valid rows go in one transaction, so nothing is inserted when they would leave too
+// little stock. With "dry_run=true" the rows are checked and reported but not inserted. "progress_id" works as for imports.
+func PasteEntriesHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, MAX_IMPORT_FILE_SIZE)
+	content, err := io.ReadAll(r.Body)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to read pasted entries", "error", err)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.INVALID_PASTE)
+		return
+	}
+
+	w, op, finish := trackRequestOperation(w, r, httpx.GetParam(r, "progress_id"), utils.OPERATION_PASTE)
+	defer finish()
+
+	dryRun, _ := strconv.ParseBool(httpx.GetParam(r, "dry_run"))
+
+	mapping := map[string]string{}
+	if rawMapping := httpx.GetParam(r, "mapping"); rawMapping != "" {
+		if err := json.Unmarshal([]byte(rawMapping), &mapping); err != nil {
+			slog.ErrorContext(r.Context(), "invalid paste mapping", "mapping", rawMapping, "error", err)
+			httpx.RespWithError(w, http.StatusBadRequest, utils.INVALID_IMPORT_MAPPING)
+			return
+		}
+	}
+
+	rows, lines, err := readPastedRows(content)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to parse pasted entries", "error", err)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.INVALID_PASTE)
+		return
+	}
+
+	header := []string{}
+	if columns := httpx.GetParam(r, "columns"); columns != "" {
+		header = strings.Split(columns, ",")
+	} else if len(rows) > 0 {
+		header, rows, lines = rows[0], rows[1:], lines[1:]
+	}
+	if len(rows) == 0 {
+		slog.ErrorContext(r.Context(), "nothing pasted")
+		httpx.RespWithError(w, http.StatusBadRequest, utils.INVALID_PASTE)
+		return
+	}
+
+	columns, errStr := mapImportColumns(r.Context(), header, mapping)
+	if errStr != utils.NO_ERR {
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	compounds, err := getCompoundLookup(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to load compounds for paste", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.COMPOUND_RETRIEVAL_ERR)
+		return
+	}
+
+	report := &PasteReport{DryRun: dryRun, Results: []PasteRowResult{}, Errors: []ImportRowError{}}
+	entries, rowNumbers, resultIndexes := []*InsertEntryReq{}, []int{}, []int{}
+	for i, row := range rows {
+		if isBlankRow(row) {
+			continue
+		}
+		report.Rows++
+		if report.Rows > MAX_IMPORT_ROWS {
+			slog.ErrorContext(r.Context(), "too many pasted rows")
+			httpx.RespWithError(w, http.StatusBadRequest, utils.IMPORT_TOO_MANY_ROWS)
+			return
+		}
+
+		rowNumber := lines[i]
+		entry, rowErrors := parseImportRow(r.Context(), row, columns, compounds, rowNumber)
+		report.Results = append(report.Results, PasteRowResult{Row: rowNumber, Valid: len(rowErrors) == 0, Errors: rowErrors})
+		if len(rowErrors) > 0 {
+			continue
+		}
+		entries = append(entries, entry)
+		rowNumbers = append(rowNumbers, rowNumber)
+		resultIndexes = append(resultIndexes, len(report.Results)-1)
+	}
+
+	if len(entries) == 0 {
+		slog.ErrorContext(r.Context(), "no valid pasted rows", "rows", report.Rows)
+		httpx.EncodeJsonRes(w, http.StatusBadRequest, &httpx.Resp{Error: utils.PASTE_NO_VALID_ROWS, Data: report})
+		return
+	}
+
+	quota, err := utils.GetQuota(r.Context(), utils.QUOTA_ENTRIES)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error getting quota", "resource", utils.QUOTA_ENTRIES, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.QUOTA_RETRIEVAL_ERR)
+		return
+	}
+	if quota.Remaining != nil && *quota.Remaining < len(entries) {
+		slog.ErrorContext(r.Context(), "paste exceeds trial limit", "rows", len(entries), "remaining", *quota.Remaining)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.TRIAL_PERIOD_LIMIT_EXCEEDED)
+		return
+	}
+
+	unlock := stock.LockCompounds(importedCompoundIds(entries)...)
+	defer unlock()
+
+	tx, err := db.ConnFrom(r.Context()).BeginTx(r.Context(), nil)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error starting transaction", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.TX_START_ERR)
+		return
+	}
+	defer tx.Rollback()
+
+	actor := currentUser(r)
+	report.Status = utils.ENTRY_STATUS_APPROVED
+	if utils.EntryNeedsApproval(actor.Role) {
+		report.Status = utils.ENTRY_STATUS_PENDING
+	}
+
+	importId, err := createImportBatch(r.Context(), tx, IMPORT_SOURCE_PASTE, "", len(entries), actor.Id)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error recording paste", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.IMPORT_BATCH_ERR)
+		return
+	}
+
+	entryIds, recalculationErrors, errStr := insertImportedEntries(r.Context(), tx, entries, rowNumbers, report.Status, actor.Id, importId, op)
+	if errStr != utils.NO_ERR {
+		httpx.RespWithError(w, http.StatusInternalServerError, errStr)
+		return
+	}
+	if len(recalculationErrors) > 0 {
+		report.Errors = recalculationErrors
+		httpx.EncodeJsonRes(w, http.StatusBadRequest, &httpx.Resp{Error: utils.PASTE_STOCK_ERR, Data: report})
+		return
+	}
+
+	if dryRun {
+		httpx.RespWithData(w, http.StatusOK, report)
+		return
+	}
+
+	utils.RecordAudit(r.Context(), tx, actor.Id, "entry.paste", utils.AUDIT_TARGET_ENTRY, "", map[string]any{
+		"rows":      report.Rows,
+		"inserted":  len(entries),
+		"import_id": importId,
+	})
+
+	if err := tx.Commit(); err != nil {
+		slog.ErrorContext(r.Context(), "error committing transaction", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.COMMIT_TRANSACTION_ERR)
+		return
+	}
+
+	for i, resultIndex := range resultIndexes {
+		report.Results[resultIndex].EntryId = entryIds[i]
+	}
+	report.Inserted = len(entries)
+	report.ImportId = importId
+	httpx.RespWithData(w, http.StatusOK, report)
+}
+
+// Splits pasted text into rows of cells along with the line each row starts on, on tabs when the first line has
+// one (spreadsheet copies) and on commas otherwise. Blank lines are skipped.
+func readPastedRows(content []byte) ([][]string, []int, error) {
+	content = bytes.TrimPrefix(content, []byte("\xef\xbb\xbf"))
+
+	reader := csv.NewReader(bytes.NewReader(content))
+	firstLine, _, _ := bytes.Cut(bytes.TrimLeft(content, "\r\n"), []byte("\n"))
+	if bytes.Contains(firstLine, []byte("\t")) {
+		reader.Comma = '\t'
+	} else {
+		// Not with tabs, where it would swallow the tabs around empty cells
+		reader.TrimLeadingSpace = true
+	}
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	rows, lines := [][]string{}, []int{}
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return rows, lines, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		rows = append(rows, row)
+		lines = append(lines, line)
+	}
+}
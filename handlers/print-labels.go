@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/datetime"
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+type PrintLabelsReq struct {
+	Items []LabelItem `json:"items"`
+	// Override the rows and columns of the configured stationery
+	Rows    int `json:"rows"`
+	Columns int `json:"columns"`
+	// Labels already used on the first sheet, which are left blank
+	Skip int `json:"skip"`
+}
+
+// Compound, or lot of it, to print labels for. Without "copies" a lot gets a label for each unit it was received
+// in and a compound a single one.
+type LabelItem struct {
+	CompoundId string `json:"compound_id"`
+	LotId      string `json:"lot_id"`
+	Copies     int    `json:"copies"`
+}
+
+// What a label says
+type Label struct {
+	CompoundId      string
+	Compound        string
+	CasNo           string
+	Formula         string
+	StorageLocation string
+	Warning         string
+	LotId           string
+	LotNo           string
+	Expiry          string
+	Supplier        string
+	ReceivedOn      string
+}
+
+// Prints labels for a list of compounds and lots, e.g. the bottles of a delivery, as one PDF laid out for the
+// label stationery: a sheet of LABEL_ROWS by LABEL_COLUMNS labels unless "rows" and "columns" say otherwise,
+// see utils.LabelSheet. "skip" leaves the labels already peeled off the first sheet blank.
+func PrintLabelsHandler(w http.ResponseWriter, r *http.Request) {
+	reqBody := &PrintLabelsReq{}
+	if errStr := httpx.DecodeJsonReq(r, reqBody); errStr != utils.NO_ERR {
+		slog.ErrorContext(r.Context(), "failed to decode JSON request", "error", errStr)
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+	if len(reqBody.Items) == 0 {
+		slog.ErrorContext(r.Context(), "no labels to print")
+		httpx.RespWithError(w, http.StatusBadRequest, utils.MISSING_REQUIRED_FIELDS)
+		return
+	}
+
+	sheet := utils.GetLabelSheet()
+	if reqBody.Rows != 0 {
+		sheet.Rows = reqBody.Rows
+	}
+	if reqBody.Columns != 0 {
+		sheet.Columns = reqBody.Columns
+	}
+	if err := sheet.Validate(); err != nil || reqBody.Skip < 0 || reqBody.Skip >= sheet.LabelsPerSheet() {
+		slog.WarnContext(r.Context(), "invalid label layout", "sheet", sheet, "skip", reqBody.Skip, "error", err)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.INVALID_LABEL_LAYOUT)
+		return
+	}
+
+	labels := []Label{}
+	for i, item := range reqBody.Items {
+		label, units, status, errStr := getLabel(r.Context(), item)
+		if errStr != utils.NO_ERR {
+			httpx.RespWithError(w, status, utils.ErrorMessage(fmt.Sprintf("%s (item %d)", errStr, i+1)))
+			return
+		}
+
+		copies := item.Copies
+		if copies == 0 {
+			copies = units
+		}
+		if copies < 0 || len(labels)+copies > utils.MAX_LABELS {
+			slog.WarnContext(r.Context(), "too many labels", "item", i+1, "copies", copies, "labels", len(labels))
+			httpx.RespWithError(w, http.StatusBadRequest, utils.TOO_MANY_LABELS)
+			return
+		}
+		for range copies {
+			labels = append(labels, *label)
+		}
+	}
+
+	filename := fmt.Sprintf("labels-%s.pdf", datetime.Now(r.Context()).Local().Format("2006-01-02"))
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+	w.Write(renderLabelsPDF(sheet, reqBody.Skip, labels))
+}
+
+// Gets what the label of a compound or lot says, along with the number of units the lot was received in (1 for a
+// compound). Returns the status code to answer with when it cannot be printed.
+func getLabel(ctx context.Context, item LabelItem) (*Label, int, int, utils.ErrorMessage) {
+	if item.CompoundId == "" {
+		slog.ErrorContext(ctx, "missing required fields", "compound_id", item.CompoundId)
+		return nil, 0, http.StatusBadRequest, utils.MISSING_REQUIRED_FIELDS
+	}
+
+	label := &Label{CompoundId: item.CompoundId, LotId: item.LotId}
+	err := db.ConnFrom(ctx).QueryRowContext(ctx,
+		"SELECT name, cas_no, formula, storage_location, pinned_warning FROM compound WHERE id = ?", item.CompoundId,
+	).Scan(&label.Compound, &label.CasNo, &label.Formula, &label.StorageLocation, &label.Warning)
+	if errors.Is(err, sql.ErrNoRows) {
+		slog.WarnContext(ctx, "label of unknown compound", "compound_id", item.CompoundId)
+		return nil, 0, http.StatusNotFound, utils.INVALID_COMPOUND_ID
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to get compound", "compound_id", item.CompoundId, "error", err)
+		return nil, 0, http.StatusInternalServerError, utils.COMPOUND_RETRIEVAL_ERR
+	}
+	if item.LotId == "" {
+		return label, 1, http.StatusOK, utils.NO_ERR
+	}
+
+	var units int
+	err = db.ConnFrom(ctx).QueryRowContext(ctx, `
+		SELECT l.lot_no, l.expiry, l.supplier, date(e.date, 'unixepoch', 'localtime'), q.num_of_units * q.packs_per_unit
+		FROM lot l
+		JOIN entry e ON l.entry_id = e.id
+		JOIN quantity q ON e.quantity_id = q.id
+		WHERE l.id = ? AND l.compound_id = ? AND e.deleted_at IS NULL`,
+		item.LotId, item.CompoundId,
+	).Scan(&label.LotNo, &label.Expiry, &label.Supplier, &label.ReceivedOn, &units)
+	if errors.Is(err, sql.ErrNoRows) {
+		slog.WarnContext(ctx, "label of unknown lot", "compound_id", item.CompoundId, "lot_id", item.LotId)
+		return nil, 0, http.StatusNotFound, utils.LABEL_LOT_NOT_FOUND
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to get lot", "lot_id", item.LotId, "error", err)
+		return nil, 0, http.StatusInternalServerError, utils.LOT_RETRIEVAL_ERR
+	}
+	return label, units, http.StatusOK, utils.NO_ERR
+}
+
+// Inner margin of a label, in PDF points
+const labelPadding = 5.0
+
+// Lays the labels out on as many sheets as they take, starting at the position "skip" of the first one. The text
+// is sized so every line fits the label's height.
+func renderLabelsPDF(sheet utils.LabelSheet, skip int, labels []Label) []byte {
+	pdf := utils.NewPDF()
+	pdf.NoPageNumbers = true
+	width, height := sheet.LabelSize()
+
+	position := skip
+	for _, label := range labels {
+		if position == sheet.LabelsPerSheet() {
+			pdf.AddPage()
+			position = 0
+		}
+		x, y := sheet.LabelOrigin(position)
+		position++
+
+		lines := []string{}
+		if identity := strings.TrimSpace(strings.Join([]string{prefixed("CAS ", label.CasNo), label.Formula}, "  ")); identity != "" {
+			lines = append(lines, identity)
+		}
+		if label.LotId != "" {
+			if lot := strings.TrimSpace(prefixed("Lot ", label.LotNo) + "  " + prefixed("Exp ", label.Expiry)); lot != "" {
+				lines = append(lines, lot)
+			}
+			lines = append(lines, strings.TrimSpace("Recv "+label.ReceivedOn+"  "+label.Supplier))
+		}
+		if label.StorageLocation != "" {
+			lines = append(lines, "Store: "+label.StorageLocation)
+		}
+		if label.Warning != "" {
+			lines = append(lines, "! "+label.Warning)
+		}
+		id := label.CompoundId
+		if label.LotId != "" {
+			id += " / " + label.LotId
+		}
+		lines = append(lines, id)
+
+		// The name is set larger and bold above the other lines
+		size := min(9, (height-2*labelPadding)/(float64(len(lines))*1.2+1.6))
+		maxChars := func(size float64) int {
+			return max(int((width-2*labelPadding)/(size*0.6)), 2)
+		}
+		lineY := y + labelPadding + size*1.3
+		pdf.Text(x+labelPadding, lineY, size*1.3, true, utils.PDFTruncate(label.Compound, maxChars(size*1.3)))
+		lineY += size * 0.3
+		for _, line := range lines {
+			lineY += size * 1.2
+			pdf.Text(x+labelPadding, lineY, size, false, utils.PDFTruncate(line, maxChars(size)))
+		}
+	}
+	return pdf.Bytes()
+}
+
+// Puts the prefix before a value, leaving empty values empty
+func prefixed(prefix, value string) string {
+	if value == "" {
+		return ""
+	}
+	return prefix + value
+}
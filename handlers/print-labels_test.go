@@ -0,0 +1,69 @@
+package handlers_test
+
+import (
+	"chemical-ledger-backend/handlers"
+	"chemical-ledger-backend/testutils"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLabelsArePrintedOnSheets(t *testing.T) {
+	t.Parallel()
+	env := testutils.NewEnv(t, time.Date(2026, 3, 14, 10, 0, 0, 0, time.Local))
+
+	env.InsertCompound("C_1", "Acetone", "ml")
+	env.InsertCompound("C_2", "Benzene", "ml")
+	w := httptest.NewRecorder()
+	handlers.InsertEntryHandler(w, env.Request(http.MethodPost, "/insert-entry", strings.NewReader(
+		`{"type": "incoming", "compound_id": "C_1", "date": "2026-03-10", "num_of_units": 4, "quantity_per_unit": 500, "lot_no": "B-77", "expiry": "2028-01-31"}`,
+	)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("delivery: status %d, %s", w.Code, w.Body)
+	}
+	var lotId string
+	if err := env.DB.QueryRow("SELECT id FROM lot WHERE compound_id = 'C_1'").Scan(&lotId); err != nil {
+		t.Fatal(err)
+	}
+
+	printLabels := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handlers.PrintLabelsHandler(w, env.Request(http.MethodPost, "/labels/print", strings.NewReader(body)))
+		return w
+	}
+
+	// A label for each of the 4 bottles of the lot and 2 for the other compound, after the label already used,
+	// take 7 places on sheets of 2 by 2
+	w = printLabels(fmt.Sprintf(`{"items": [{"compound_id": "C_1", "lot_id": %q}, {"compound_id": "C_2", "copies": 2}], "rows": 2, "columns": 2, "skip": 1}`, lotId))
+	pdf := w.Body.String()
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/pdf" {
+		t.Fatalf("status %d, %s", w.Code, pdf)
+	}
+	for text, want := range map[string]int{
+		"(Acetone) Tj":                  4,
+		"(Benzene) Tj":                  2,
+		"(Lot B-77  Exp 2028-01-31) Tj": 4,
+		"/Type /Page ":                  2,
+		"Page 1 of":                     0,
+	} {
+		if got := strings.Count(pdf, text); got != want {
+			t.Errorf("%q appears %d times, want %d", text, got, want)
+		}
+	}
+
+	for body, want := range map[string]int{
+		`{"items": [{"compound_id": "C_2", "lot_id": "` + lotId + `"}]}`: http.StatusNotFound,
+		`{"items": [{"compound_id": "C_9"}]}`:                            http.StatusNotFound,
+		`{"items": [{"compound_id": "C_1"}], "columns": 40}`:             http.StatusBadRequest,
+		`{"items": [{"compound_id": "C_1"}], "skip": 21}`:                http.StatusBadRequest,
+		`{"items": [{"compound_id": "C_1", "copies": 2000}]}`:            http.StatusBadRequest,
+		`{"items": []}`: http.StatusBadRequest,
+	} {
+		if w := printLabels(body); w.Code != want {
+			t.Errorf("%s: status %d, want %d, %s", body, w.Code, want, w.Body)
+		}
+	}
+}
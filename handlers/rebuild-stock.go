@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/stock"
+	"chemical-ledger-backend/utils"
+	"log/slog"
+	"net/http"
+)
+
+// Rebuilds the current stock of every compound from the entries, e.g. after the database was edited by hand.
+// Reports how many compounds were out of step with their entries. Admins only; every rebuild is audited.
+func RebuildStockHandler(w http.ResponseWriter, r *http.Request) {
+	compounds, corrected, err := stock.RebuildStockCurrent(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to rebuild current stock", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.STOCK_REBUILD_ERR)
+		return
+	}
+
+	result := map[string]any{
+		"compounds": compounds,
+		"corrected": corrected,
+	}
+	utils.RecordAudit(r.Context(), nil, currentUser(r).Id, "stock.rebuild", utils.AUDIT_TARGET_STOCK, "", result)
+
+	httpx.RespWithData(w, http.StatusOK, result)
+}
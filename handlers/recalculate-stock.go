@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/stock"
+	"chemical-ledger-backend/utils"
+	"context"
+	"log/slog"
+	"net/http"
+)
+
+// Recalculates the net stock of every entry and the lots of every compound from its first entry, e.g. after
+// entries were edited in the database by hand. As it can take long, it runs after the request is answered (202)
+// with the "operation_id" to follow with GetOperationEventsHandler, the client's "progress_id" when given.
+// Compounds are recalculated one at a time in their own transaction; one that fails, e.g. as its stock would go
+// negative, is left as it was and reported as an error of the operation. Admins only; every run is audited.
+func RecalculateStockHandler(w http.ResponseWriter, r *http.Request) {
+	operationId := httpx.GetParam(r, "progress_id")
+	if operationId == "" {
+		operationId = utils.NewId(r.Context(), "OP")
+	}
+
+	rows, err := db.ConnFrom(r.Context()).QueryContext(r.Context(), "SELECT id FROM compound ORDER BY lower_case_name ASC")
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to list compounds for recalculation", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.COMPOUND_RETRIEVAL_ERR)
+		return
+	}
+	compoundIds := []string{}
+	for rows.Next() {
+		var compoundId string
+		if err := rows.Scan(&compoundId); err != nil {
+			rows.Close()
+			slog.ErrorContext(r.Context(), "failed to scan compound for recalculation", "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.COMPOUND_RETRIEVAL_ERR)
+			return
+		}
+		compoundIds = append(compoundIds, compoundId)
+	}
+	rows.Close()
+
+	op := utils.TrackOperation(r.Context(), operationId, utils.OPERATION_RECALCULATE_ALL)
+	actorId := currentUser(r).Id
+	// Runs on after the request is answered, so it is not canceled with it, with the dependencies of the request.
+	// The tenant's database is kept open until it is done.
+	release := db.Hold(r.Context())
+	go func() {
+		defer release()
+		recalculateAllStock(context.WithoutCancel(r.Context()), op, compoundIds, actorId)
+	}()
+
+	httpx.RespWithData(w, http.StatusAccepted, map[string]any{
+		"operation_id": operationId,
+		"compounds":    len(compoundIds),
+	})
+}
+
+func recalculateAllStock(ctx context.Context, op *utils.Operation, compoundIds []string, actorId string) {
+	failed := []string{}
+	for i, compoundId := range compoundIds {
+		op.Step(i, len(compoundIds), compoundId)
+		if errStr := recalculateCompoundStock(ctx, compoundId); errStr != utils.NO_ERR {
+			slog.ErrorContext(ctx, "error recalculating stock", "compound_id", compoundId, "error", errStr)
+			failed = append(failed, compoundId)
+			op.Fail(compoundId, errStr)
+		}
+	}
+
+	utils.RecordAudit(ctx, nil, actorId, "stock.recalculate", utils.AUDIT_TARGET_STOCK, "", map[string]any{
+		"compounds": len(compoundIds),
+		"failed":    failed,
+	})
+
+	if len(failed) > 0 {
+		op.Finish(utils.STOCK_RECALCULATION_ERR)
+		return
+	}
+	op.Finish(utils.NO_ERR)
+}
+
+func recalculateCompoundStock(ctx context.Context, compoundId string) utils.ErrorMessage {
+	unlock := stock.LockCompounds(compoundId)
+	defer unlock()
+
+	tx, err := db.ConnFrom(ctx).BeginTx(ctx, nil)
+	if err != nil {
+		slog.ErrorContext(ctx, "error starting transaction", "error", err)
+		return utils.TX_START_ERR
+	}
+	defer tx.Rollback()
+
+	if errStr := stock.UpdateNetStockFromTodayOnwards(ctx, tx, compoundId, 0); errStr != utils.NO_ERR {
+		return errStr
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.ErrorContext(ctx, "error committing transaction", "error", err)
+		return utils.COMMIT_TRANSACTION_ERR
+	}
+	return utils.NO_ERR
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Recovers from a panic in a handler or the middleware after this one. The panic is logged with its stack and
+// counted in /admin/diagnostics, and the request answered 500 with its ID, see RequestIdMiddleware.
+func RecoverPanicMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			// Raised on purpose to abort the response, and kept quiet by the server
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+
+			ctx := r.Context()
+			requestId := utils.RequestId(ctx)
+			if requestId == "" {
+				requestId = utils.NewId(r.Context(), "REQ")
+				ctx = utils.WithRequestId(ctx, requestId)
+				w.Header().Set(httpx.REQUEST_ID_HEADER, requestId)
+			}
+			route := r.Method + " " + r.URL.Path
+			if routeCtx := chi.RouteContext(r.Context()); routeCtx != nil && routeCtx.RoutePattern() != "" {
+				route = r.Method + " " + routeCtx.RoutePattern()
+			}
+			slog.ErrorContext(ctx, "handler panicked",
+				"route", route,
+				"path", r.URL.Path,
+				"panic", fmt.Sprint(recovered),
+				"stack", string(debug.Stack()),
+			)
+			utils.RecordPanic(route, requestId)
+
+			w.Header().Set("Content-Type", "application/json")
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.INTERNAL_SERVER_ERR)
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,46 @@
+package handlers_test
+
+import (
+	"chemical-ledger-backend/handlers"
+	"chemical-ledger-backend/utils"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestPanicIsRecoveredWithRequestId(t *testing.T) {
+	before := utils.GetPanicStats().Total
+
+	r := chi.NewRouter()
+	r.Use(handlers.ResponseEnvelopeMiddleware)
+	r.Use(handlers.RecoverPanicMiddleware)
+	r.Get("/report/{name}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		var report map[string]int
+		report[chi.URLParam(r, "name")]++
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/report/summary", nil))
+	stats := utils.GetPanicStats()
+	if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), utils.INTERNAL_SERVER_ERR) ||
+		!strings.Contains(w.Body.String(), fmt.Sprintf(`"request_id":%q`, stats.LastRequestId)) {
+		t.Errorf("panic: status %d, %s", w.Code, w.Body)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/report/summary", nil)
+	req.Header.Set(handlers.RESPONSE_ENVELOPE_HEADER, handlers.ENVELOPE_LEGACY)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), `"message":"`+utils.INTERNAL_SERVER_ERR) || !strings.Contains(w.Body.String(), `"request_id":"REQ`) {
+		t.Errorf("panic in legacy envelope: status %d, %s", w.Code, w.Body)
+	}
+
+	if stats := utils.GetPanicStats(); stats.Total != before+2 || stats.ByRoute["GET /report/{name}"] < 2 {
+		t.Errorf("panics counted %+v", stats)
+	}
+}
@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"context"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+type RenumberVouchersReq struct {
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement"`
+	From        string `json:"from"`
+	To          string `json:"to"`
+	CompoundId  string `json:"compound_id"`
+	DryRun      bool   `json:"dry_run"`
+}
+
+// New number of a voucher and the entries carrying it
+type VoucherRenumbering struct {
+	OldVoucherNo string   `json:"old_voucher_no"`
+	NewVoucherNo string   `json:"new_voucher_no"`
+	EntryIds     []string `json:"entry_ids"`
+}
+
+// Voucher number the renumbering would give to several vouchers, or which stays in use by entries left untouched
+type VoucherCollision struct {
+	VoucherNo     string   `json:"voucher_no"`
+	OldVoucherNos []string `json:"old_voucher_nos"`
+	AlreadyInUse  bool     `json:"already_in_use"`
+}
+
+type RenumberVouchersReport struct {
+	DryRun       bool                 `json:"dry_run"`
+	Vouchers     int                  `json:"vouchers"`
+	Entries      int                  `json:"entries"`
+	Renumberings []VoucherRenumbering `json:"renumberings"`
+	Collisions   []VoucherCollision   `json:"collisions"`
+}
+
+// Renumbers the vouchers matching "pattern" (a regular expression) on entries dated within from and to,
+// optionally of one compound, to the result of replacing the match with "replacement" ("$1" refers to the
+// first group), e.g. pattern "^PO-(\d+)$" with replacement "2026/PO-$1". Nothing is written when a new number
+// would be shared by different vouchers or is already used by entries outside the renumbering. Every changed
+// entry is audited. With "dry_run" the renumbering is only previewed.
+func RenumberVouchersHandler(w http.ResponseWriter, r *http.Request) {
+	reqBody := &RenumberVouchersReq{}
+	if errStr := httpx.DecodeJsonReq(r, reqBody); errStr != utils.NO_ERR {
+		slog.ErrorContext(r.Context(), "failed to decode JSON request", "error", errStr)
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	if reqBody.Pattern == "" {
+		slog.ErrorContext(r.Context(), "missing required fields", "pattern", reqBody.Pattern)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.MISSING_REQUIRED_FIELDS)
+		return
+	}
+	pattern, err := regexp.Compile(reqBody.Pattern)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "invalid voucher pattern", "pattern", reqBody.Pattern, "error", err)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.INVALID_VOUCHER_PATTERN)
+		return
+	}
+
+	fromUnix, toUnix, errStr := parseReportRange(r.Context(), reqBody.From, reqBody.To)
+	if errStr != utils.NO_ERR {
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	if reqBody.CompoundId != "" {
+		if errStr := validateCompoundIdField(r.Context(), reqBody.CompoundId); errStr != utils.NO_ERR {
+			httpx.RespWithError(w, http.StatusBadRequest, errStr)
+			return
+		}
+	}
+
+	report, errStr := planVoucherRenumbering(r.Context(), reqBody, pattern, fromUnix, toUnix)
+	if errStr == utils.INVALID_VOUCHER_REPLACEMENT {
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+	if errStr != utils.NO_ERR {
+		httpx.RespWithError(w, http.StatusInternalServerError, errStr)
+		return
+	}
+	report.DryRun = reqBody.DryRun
+
+	if len(report.Collisions) > 0 && !report.DryRun {
+		slog.WarnContext(r.Context(), "voucher renumbering has collisions", "pattern", reqBody.Pattern, "collisions", len(report.Collisions))
+		httpx.EncodeJsonRes(w, http.StatusConflict, &httpx.Resp{Error: utils.VOUCHER_COLLISION, Data: report})
+		return
+	}
+	if report.DryRun {
+		httpx.RespWithData(w, http.StatusOK, report)
+		return
+	}
+	if status, errStr := checkEntryDatesUnlocked(r.Context(), fromUnix); errStr != utils.NO_ERR {
+		httpx.RespWithError(w, status, errStr)
+		return
+	}
+
+	tx, err := db.ConnFrom(r.Context()).BeginTx(r.Context(), nil)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to begin transaction", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.TX_START_ERR)
+		return
+	}
+	defer tx.Rollback()
+
+	actorId := currentUser(r).Id
+	for _, renumbering := range report.Renumberings {
+		for _, entryId := range renumbering.EntryIds {
+			if _, err := tx.ExecContext(r.Context(), "UPDATE entry SET voucher_no = ? WHERE id = ?", renumbering.NewVoucherNo, entryId); err != nil {
+				slog.ErrorContext(r.Context(), "failed to renumber voucher", "entry_id", entryId, "old_voucher_no", renumbering.OldVoucherNo, "new_voucher_no", renumbering.NewVoucherNo, "error", err)
+				httpx.RespWithError(w, http.StatusInternalServerError, utils.VOUCHER_RENUMBER_ERR)
+				return
+			}
+			utils.RecordAudit(r.Context(), tx, actorId, "entry.voucher_renumber", utils.AUDIT_TARGET_ENTRY, entryId, map[string]any{
+				"old_voucher_no": renumbering.OldVoucherNo,
+				"new_voucher_no": renumbering.NewVoucherNo,
+				"pattern":        reqBody.Pattern,
+				"replacement":    reqBody.Replacement,
+			})
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.ErrorContext(r.Context(), "failed to commit transaction", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.COMMIT_TRANSACTION_ERR)
+		return
+	}
+
+	httpx.RespWithData(w, http.StatusOK, report)
+}
+
+// Works out the new number of every matching voucher and the collisions it would cause. Vouchers whose
+// number does not change are left out.
+func planVoucherRenumbering(ctx context.Context, reqBody *RenumberVouchersReq, pattern *regexp.Regexp, fromUnix, toUnix int64) (*RenumberVouchersReport, utils.ErrorMessage) {
+	rows, err := db.ConnFrom(ctx).QueryContext(ctx, `
+		SELECT id, voucher_no, compound_id, date
+		FROM entry
+		WHERE COALESCE(voucher_no, '') != ''
+		ORDER BY date ASC, seq ASC`)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to query vouchers", "error", err)
+		return nil, utils.ENTRY_RETRIEVAL_ERR
+	}
+	defer rows.Close()
+
+	report := &RenumberVouchersReport{
+		Renumberings: []VoucherRenumbering{},
+		Collisions:   []VoucherCollision{},
+	}
+	renumberings := map[string]*VoucherRenumbering{}
+	// Numbers that stay in use after the renumbering, by entries it does not touch
+	keptVouchers := map[string]bool{}
+
+	for rows.Next() {
+		var entryId, voucherNo, compoundId string
+		var date int64
+		if err := rows.Scan(&entryId, &voucherNo, &compoundId, &date); err != nil {
+			slog.ErrorContext(ctx, "failed to scan voucher row", "error", err)
+			return nil, utils.ENTRY_RETRIEVAL_ERR
+		}
+
+		selected := date >= fromUnix && date < toUnix &&
+			(reqBody.CompoundId == "" || reqBody.CompoundId == compoundId) &&
+			pattern.MatchString(voucherNo)
+		newVoucherNo := ""
+		if selected {
+			newVoucherNo = pattern.ReplaceAllString(voucherNo, reqBody.Replacement)
+		}
+		if !selected || newVoucherNo == voucherNo {
+			keptVouchers[voucherNo] = true
+			continue
+		}
+		if newVoucherNo == "" {
+			slog.ErrorContext(ctx, "voucher renumbered to an empty number", "voucher_no", voucherNo, "pattern", reqBody.Pattern, "replacement", reqBody.Replacement)
+			return nil, utils.INVALID_VOUCHER_REPLACEMENT
+		}
+
+		renumbering, ok := renumberings[voucherNo]
+		if !ok {
+			renumbering = &VoucherRenumbering{OldVoucherNo: voucherNo, NewVoucherNo: newVoucherNo}
+			renumberings[voucherNo] = renumbering
+		}
+		renumbering.EntryIds = append(renumbering.EntryIds, entryId)
+	}
+	if err := rows.Err(); err != nil {
+		slog.ErrorContext(ctx, "failed to read vouchers", "error", err)
+		return nil, utils.ENTRY_RETRIEVAL_ERR
+	}
+
+	oldByNew := map[string][]string{}
+	for _, renumbering := range renumberings {
+		report.Renumberings = append(report.Renumberings, *renumbering)
+		report.Entries += len(renumbering.EntryIds)
+		oldByNew[renumbering.NewVoucherNo] = append(oldByNew[renumbering.NewVoucherNo], renumbering.OldVoucherNo)
+	}
+	report.Vouchers = len(report.Renumberings)
+	slices.SortFunc(report.Renumberings, func(a, b VoucherRenumbering) int {
+		return strings.Compare(a.OldVoucherNo, b.OldVoucherNo)
+	})
+
+	for newVoucherNo, oldVoucherNos := range oldByNew {
+		if len(oldVoucherNos) > 1 || keptVouchers[newVoucherNo] {
+			slices.Sort(oldVoucherNos)
+			report.Collisions = append(report.Collisions, VoucherCollision{
+				VoucherNo:     newVoucherNo,
+				OldVoucherNos: oldVoucherNos,
+				AlreadyInUse:  keptVouchers[newVoucherNo],
+			})
+		}
+	}
+	slices.SortFunc(report.Collisions, func(a, b VoucherCollision) int {
+		return strings.Compare(a.VoucherNo, b.VoucherNo)
+	})
+
+	return report, utils.NO_ERR
+}
@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"net/http"
+	"regexp"
+)
+
+// IDs clients may send along with "X-Request-Id", e.g. one a proxy in front of the API gave the request
+var validRequestId = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// Gives every request an ID, the client's "X-Request-Id" when it sent a usable one. The ID is sent back in the
+// "X-Request-Id" header and with every error, and is on every line logged for the request with its context, so a
+// user can quote it when reporting an error and support find what happened.
+func RequestIdMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestId := r.Header.Get(httpx.REQUEST_ID_HEADER)
+		if !validRequestId.MatchString(requestId) {
+			requestId = utils.NewId(r.Context(), "REQ")
+		}
+		w.Header().Set(httpx.REQUEST_ID_HEADER, requestId)
+
+		next.ServeHTTP(w, r.WithContext(utils.WithRequestId(r.Context(), requestId)))
+	})
+}
@@ -0,0 +1,57 @@
+package handlers_test
+
+import (
+	"bytes"
+	"chemical-ledger-backend/handlers"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestIdInErrorsAndLogs(t *testing.T) {
+	var logs bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(utils.NewRequestLogHandler(slog.NewJSONHandler(&logs, nil))))
+	defer slog.SetDefault(defaultLogger)
+
+	handler := handlers.RequestIdMiddleware(http.HandlerFunc(handlers.GetEntryTimelineHandler))
+
+	req := httptest.NewRequest(http.MethodGet, "/timeline", nil)
+	req.Header.Set(httpx.REQUEST_ID_HEADER, "proxy-42")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest || w.Header().Get(httpx.REQUEST_ID_HEADER) != "proxy-42" || !strings.Contains(w.Body.String(), `"request_id":"proxy-42"`) {
+		t.Errorf("client's request ID: status %d, header %q, %s", w.Code, w.Header().Get(httpx.REQUEST_ID_HEADER), w.Body)
+	}
+	if !strings.Contains(logs.String(), `"msg":"timeline needs exactly one filter"`) || !strings.Contains(logs.String(), `"request_id":"proxy-42"`) {
+		t.Errorf("logs: %s", logs.String())
+	}
+
+	// Lines logged by the shared helpers, e.g. decoding the body, carry it as well
+	logs.Reset()
+	req = httptest.NewRequest(http.MethodPut, "/update-entry", strings.NewReader("{not json"))
+	req.Header.Set(httpx.REQUEST_ID_HEADER, "proxy-43")
+	w = httptest.NewRecorder()
+	handlers.RequestIdMiddleware(http.HandlerFunc(handlers.UpdateEntryHandler)).ServeHTTP(w, req)
+	lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	if w.Code != http.StatusBadRequest || !strings.Contains(logs.String(), `"msg":"failed to decode JSON request body"`) {
+		t.Errorf("invalid body: status %d, logs %s", w.Code, logs.String())
+	}
+	for _, line := range lines {
+		if !strings.Contains(line, `"request_id":"proxy-43"`) {
+			t.Errorf("log line without request ID: %s", line)
+		}
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/timeline", nil)
+	req.Header.Set(httpx.REQUEST_ID_HEADER, "not a usable id\n")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if requestId := w.Header().Get(httpx.REQUEST_ID_HEADER); !strings.HasPrefix(requestId, "REQ_") || !strings.Contains(w.Body.String(), requestId) {
+		t.Errorf("generated request ID: header %q, %s", requestId, w.Body)
+	}
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Cause the context of a request that ran out of time is canceled with
+var ErrRequestTimeout = errors.New("request timed out")
+
+type requestDeadlineKey struct{}
+
+// Cancels the context of a request once its time is up. The time starts with the request, and a route can give its
+// requests another, see RequestTimeout.
+type requestDeadline struct {
+	mu     sync.Mutex
+	timer  *time.Timer
+	cancel context.CancelCauseFunc
+}
+
+// Gives the request the given time from now, 0 for as long as it takes
+func (d *requestDeadline) reset(timeout time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+	if timeout > 0 {
+		d.timer = time.AfterFunc(timeout, func() { d.cancel(ErrRequestTimeout) })
+	}
+}
+
+// Cancels the context of a request still running after utils.RequestTimeout, which cancels the queries it runs on
+// it, and answers 503 with REQUEST_TIMEOUT in place of the server error the handler then fails with. The context is
+// also canceled when the client goes away, which stops the stock recalculation of a change it no longer waits for.
+func RequestTimeoutMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithCancelCause(r.Context())
+		deadline := &requestDeadline{cancel: cancel}
+		deadline.reset(utils.RequestTimeout())
+		defer func() {
+			deadline.reset(0)
+			cancel(nil)
+		}()
+
+		ctx = context.WithValue(ctx, requestDeadlineKey{}, deadline)
+		next.ServeHTTP(&timeoutWriter{ResponseWriter: w, r: r, ctx: ctx}, r.WithContext(ctx))
+	})
+}
+
+// Gives the requests of a route the given time in place of utils.RequestTimeout, e.g. utils.LongRequestTimeout for
+// imports and exports, or 0 for event streams that stay open as long as the client listens
+func RequestTimeout(timeout time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if deadline, ok := r.Context().Value(requestDeadlineKey{}).(*requestDeadline); ok {
+				deadline.reset(timeout)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Replaces the server error of a request that ran out of time with REQUEST_TIMEOUT. Responses started before the
+// time was up are passed through as they are.
+type timeoutWriter struct {
+	http.ResponseWriter
+	r           *http.Request
+	ctx         context.Context
+	wroteHeader bool
+	timedOut    bool
+}
+
+func (tw *timeoutWriter) WriteHeader(status int) {
+	if tw.wroteHeader {
+		return
+	}
+	tw.wroteHeader = true
+
+	if status >= http.StatusInternalServerError && errors.Is(context.Cause(tw.ctx), ErrRequestTimeout) {
+		slog.WarnContext(tw.ctx, "request timed out", "method", tw.r.Method, "path", tw.r.URL.Path, "status", status)
+		tw.timedOut = true
+		tw.Header().Set("Content-Type", "application/json")
+		httpx.RespWithError(tw.ResponseWriter, http.StatusServiceUnavailable, utils.REQUEST_TIMEOUT)
+		return
+	}
+	tw.ResponseWriter.WriteHeader(status)
+}
+
+func (tw *timeoutWriter) Write(data []byte) (int, error) {
+	if !tw.wroteHeader {
+		tw.WriteHeader(http.StatusOK)
+	}
+	if tw.timedOut {
+		return len(data), nil
+	}
+	return tw.ResponseWriter.Write(data)
+}
+
+// Lets event streams flush, see http.NewResponseController
+func (tw *timeoutWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
@@ -0,0 +1,63 @@
+package handlers_test
+
+import (
+	"chemical-ledger-backend/handlers"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/testutils"
+	"chemical-ledger-backend/utils"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequestTimeoutCancelsQueries(t *testing.T) {
+	env := testutils.NewEnv(t, time.Date(2026, 3, 14, 10, 0, 0, 0, time.Local))
+	t.Setenv("REQUEST_TIMEOUT_SECONDS", "3600")
+
+	// Counts far enough to outlast the timeout by minutes
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		var count int
+		if err := env.DB.QueryRowContext(r.Context(), `
+			WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < 1000000000)
+			SELECT count(*) FROM n`,
+		).Scan(&count); err == nil {
+			t.Error("query was not canceled")
+		}
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.REPORT_RETRIEVAL_ERR)
+	})
+	handler := handlers.RequestTimeoutMiddleware(handlers.RequestTimeout(50 * time.Millisecond)(slow))
+
+	start := time.Now()
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, env.Request(http.MethodGet, "/report/summary", nil))
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), utils.REQUEST_TIMEOUT) || time.Since(start) > 10*time.Second {
+		t.Errorf("timed out request: status %d after %s, %s", w.Code, time.Since(start), w.Body)
+	}
+
+	// Errors of requests still in time are sent as they are
+	w = httptest.NewRecorder()
+	handlers.RequestTimeoutMiddleware(http.HandlerFunc(handlers.GetEntryTimelineHandler)).ServeHTTP(w, env.Request(http.MethodGet, "/timeline", nil))
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), utils.INVALID_TIMELINE_FILTER) {
+		t.Errorf("request in time: status %d, %s", w.Code, w.Body)
+	}
+
+	// A change the client gave up on is not recorded
+	env.InsertCompound("C_1", "Acetone", "ml")
+	ctx, cancel := context.WithCancel(env.Context())
+	cancel()
+	w = httptest.NewRecorder()
+	body := fmt.Sprintf(`{"type": %q, "compound_id": "C_1", "date": "2026-03-14", "num_of_units": 1, "quantity_per_unit": 100}`, utils.ENTRY_TYPE_INCOMING)
+	handlers.InsertEntryHandler(w, env.Request(http.MethodPost, "/insert-entry", strings.NewReader(body)).WithContext(ctx))
+	var entries int
+	if err := env.DB.QueryRow("SELECT COUNT(*) FROM entry WHERE compound_id = 'C_1'").Scan(&entries); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code == http.StatusOK || entries != 0 {
+		t.Errorf("canceled insert: status %d, %d entries, %s", w.Code, entries, w.Body)
+	}
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/utils"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// Shapes responses can be sent in. The current frontend reads {"error", "data"}; the legacy one reads
+// {"message", "error", "data"}, with the error text in "message" and "error" telling whether the request failed.
+const (
+	ENVELOPE_STANDARD = "standard"
+	ENVELOPE_LEGACY   = "legacy"
+)
+
+const RESPONSE_ENVELOPE_HEADER = "X-Response-Envelope"
+
+// Routes under this prefix answer in the legacy envelope, see ResponseEnvelopeMiddleware
+const LEGACY_ROUTE_PREFIX = "/legacy"
+
+type legacyResp struct {
+	Message string          `json:"message"`
+	Error   bool            `json:"error"`
+	Data    any             `json:"data"`
+	Build   json.RawMessage `json:"build,omitempty"`
+	// Same as in the standard envelope
+	RequestId string `json:"request_id,omitempty"`
+}
+
+// Rewrites JSON responses into the legacy envelope for requests under LEGACY_ROUTE_PREFIX, or for any request
+// sending "X-Response-Envelope: legacy". The header also takes legacy routes back to the standard envelope, so
+// both frontends can be served while they move over. Other responses, e.g. exports, are sent as they are.
+func ResponseEnvelopeMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requestEnvelope(r) != ENVELOPE_LEGACY {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+		if recorder.passThrough {
+			return
+		}
+
+		body := recorder.body.Bytes()
+		if strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") && len(body) > 0 {
+			legacy, err := toLegacyEnvelope(body, recorder.status)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "failed to convert response to legacy envelope", "path", r.URL.Path, "error", err)
+			} else {
+				body = legacy
+			}
+		}
+
+		w.WriteHeader(recorder.status)
+		w.Write(body)
+	})
+}
+
+// Envelope asked for by the request, the header taking precedence over the route
+func requestEnvelope(r *http.Request) string {
+	switch envelope := r.Header.Get(RESPONSE_ENVELOPE_HEADER); envelope {
+	case ENVELOPE_STANDARD, ENVELOPE_LEGACY:
+		return envelope
+	case "":
+	default:
+		slog.WarnContext(r.Context(), "unknown response envelope, using the route's", "envelope", envelope, "path", r.URL.Path)
+	}
+
+	if r.URL.Path == LEGACY_ROUTE_PREFIX || strings.HasPrefix(r.URL.Path, LEGACY_ROUTE_PREFIX+"/") {
+		return ENVELOPE_LEGACY
+	}
+	return ENVELOPE_STANDARD
+}
+
+// Moves a standard {"error", "data"} response into the legacy envelope. Successful responses carry the status
+// text as their message.
+func toLegacyEnvelope(body []byte, status int) ([]byte, error) {
+	var resp struct {
+		Error     json.RawMessage `json:"error"`
+		Data      json.RawMessage `json:"data"`
+		Build     json.RawMessage `json:"build"`
+		RequestId string          `json:"request_id"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+
+	legacy := legacyResp{Message: http.StatusText(status), Data: resp.Data, Build: resp.Build, RequestId: resp.RequestId}
+	if len(resp.Data) == 0 {
+		legacy.Data = nil
+	}
+	if len(resp.Error) > 0 {
+		legacy.Error = true
+		var errStr utils.ErrorMessage
+		if json.Unmarshal(resp.Error, &errStr) == nil {
+			legacy.Message = string(errStr)
+		}
+	}
+
+	data, err := json.Marshal(legacy)
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
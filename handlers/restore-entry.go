@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/stock"
+	"chemical-ledger-backend/utils"
+	"database/sql"
+	"log/slog"
+	"net/http"
+)
+
+type RestoreEntryReq struct {
+	EntryId string `json:"entry_id"`
+}
+
+// Takes an entry back out of the trash. The stock is recalculated from the entry onwards, so an outgoing entry
+// cannot be restored once the stock it issued has been issued again.
+func RestoreEntryHandler(w http.ResponseWriter, r *http.Request) {
+	reqBody := &RestoreEntryReq{}
+	if errStr := httpx.DecodeJsonReq(r, reqBody); errStr != utils.NO_ERR {
+		slog.ErrorContext(r.Context(), "failed to decode JSON request", "error", errStr)
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	if reqBody.EntryId == "" {
+		slog.ErrorContext(r.Context(), "missing required fields", "entry_id", reqBody.EntryId)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.MISSING_REQUIRED_FIELDS)
+		return
+	}
+
+	unlock, err := stock.LockEntryCompounds(r.Context(), []string{reqBody.EntryId})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error locking compounds of entries", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.ENTRY_RETRIEVAL_ERR)
+		return
+	}
+	defer unlock()
+
+	tx, err := db.ConnFrom(r.Context()).BeginTx(r.Context(), nil)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error starting transaction", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.TX_START_ERR)
+		return
+	}
+	defer tx.Rollback()
+
+	var compoundId string
+	var date int64
+	var deleted bool
+	err = tx.QueryRowContext(r.Context(),
+		"SELECT compound_id, date, deleted_at IS NOT NULL FROM entry WHERE id = ?", reqBody.EntryId,
+	).Scan(&compoundId, &date, &deleted)
+	if err == sql.ErrNoRows {
+		slog.ErrorContext(r.Context(), "entry not found", "entry_id", reqBody.EntryId)
+		httpx.RespWithError(w, http.StatusNotFound, utils.INVALID_ENTRY_ID)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error retrieving entry", "entry_id", reqBody.EntryId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.ENTRY_RETRIEVAL_ERR)
+		return
+	}
+	if !deleted {
+		slog.ErrorContext(r.Context(), "entry is not in the trash", "entry_id", reqBody.EntryId)
+		httpx.RespWithError(w, http.StatusConflict, utils.ENTRY_NOT_DELETED)
+		return
+	}
+	if status, errStr := checkEntryDatesUnlocked(r.Context(), date); errStr != utils.NO_ERR {
+		httpx.RespWithError(w, status, errStr)
+		return
+	}
+
+	if _, err := tx.ExecContext(r.Context(), "UPDATE entry SET deleted_at = NULL, deleted_by = NULL WHERE id = ?", reqBody.EntryId); err != nil {
+		slog.ErrorContext(r.Context(), "error restoring entry", "entry_id", reqBody.EntryId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.ENTRY_RESTORE_ERR)
+		return
+	}
+
+	if errStr := stock.UpdateNetStockFromTodayOnwards(r.Context(), tx, compoundId, date); errStr != utils.NO_ERR {
+		slog.ErrorContext(r.Context(), "error updating net stock after restore", "compound_id", compoundId, "error", errStr)
+		httpx.RespWithError(w, recalculationErrStatus(errStr), errStr)
+		return
+	}
+
+	utils.RecordAudit(r.Context(), tx, currentUser(r).Id, "entry.restore", utils.AUDIT_TARGET_ENTRY, reqBody.EntryId, nil)
+
+	if err := tx.Commit(); err != nil {
+		slog.ErrorContext(r.Context(), "error committing transaction", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.COMMIT_TRANSACTION_ERR)
+		return
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"entry_id": reqBody.EntryId,
+	})
+}
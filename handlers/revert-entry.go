@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Reverts an entry to one of its earlier versions (see GetEntryHistoryHandler). This is an update like any other:
+// the state it replaces is kept as a new version and the stock is recalculated, so a revert that would leave too
+// little stock is refused, and a reverted entry can be reverted back.
+func RevertEntryHandler(w http.ResponseWriter, r *http.Request) {
+	entryId := chi.URLParam(r, "id")
+	version, err := strconv.Atoi(chi.URLParam(r, "version"))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "invalid entry version", "version", chi.URLParam(r, "version"), "error", err)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.INVALID_ENTRY_VERSION)
+		return
+	}
+
+	var data string
+	err = db.ConnFrom(r.Context()).QueryRowContext(r.Context(), "SELECT data FROM entry_version WHERE entry_id = ? AND version = ?", entryId, version).Scan(&data)
+	if err == sql.ErrNoRows {
+		slog.ErrorContext(r.Context(), "entry version not found", "entry_id", entryId, "version", version)
+		httpx.RespWithError(w, http.StatusNotFound, utils.INVALID_ENTRY_VERSION)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error retrieving entry version", "entry_id", entryId, "version", version, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.ENTRY_HISTORY_RETRIEVAL_ERR)
+		return
+	}
+
+	reqBody := &UpdateEntryReq{Id: entryId}
+	if err := json.Unmarshal([]byte(data), &reqBody.InsertEntryReq); err != nil {
+		slog.ErrorContext(r.Context(), "failed to decode entry version", "entry_id", entryId, "version", version, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.ENTRY_HISTORY_RETRIEVAL_ERR)
+		return
+	}
+
+	// The version may refer to suppliers, recipients, instruments, projects, purchase orders or lots that are gone since
+	if errStr := validateUpdateEntryReq(r.Context(), reqBody); errStr != utils.NO_ERR {
+		slog.ErrorContext(r.Context(), "entry version can no longer be applied", "entry_id", entryId, "version", version, "error", errStr)
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	// The revert replaces the entry as the client last saw it, named by the "If-Match" header
+	if status, errStr := readEntryVersionPrecondition(r, reqBody, true); errStr != utils.NO_ERR {
+		httpx.RespWithError(w, status, errStr)
+		return
+	}
+
+	actor := currentUser(r)
+	if status, errStr := updateEntry(r.Context(), reqBody, actor.Id); errStr != utils.NO_ERR {
+		httpx.RespWithError(w, status, errStr)
+		return
+	}
+
+	utils.RecordAudit(r.Context(), nil, actor.Id, "entry.revert", utils.AUDIT_TARGET_ENTRY, entryId, map[string]any{"version": version})
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"entry_id":        entryId,
+		"version":         version,
+		"current_version": reqBody.Version + 1,
+	})
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/datetime"
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/stock"
+	"chemical-ledger-backend/utils"
+	"database/sql"
+	"log/slog"
+	"net/http"
+)
+
+type ReviewEntryReq struct {
+	EntryIds []string `json:"entry_ids"`
+	Remark   string   `json:"remark"`
+}
+
+// Approves pending entries, after which they count towards the stock. See reviewEntries.
+func ApproveEntryHandler(w http.ResponseWriter, r *http.Request) {
+	reviewEntries(w, r, utils.ENTRY_STATUS_APPROVED)
+}
+
+// Rejects pending entries, which then never count towards the stock. See reviewEntries.
+func RejectEntryHandler(w http.ResponseWriter, r *http.Request) {
+	reviewEntries(w, r, utils.ENTRY_STATUS_REJECTED)
+}
+
+// Reviews the pending entries in "entry_ids" with an optional "remark", all or none of them. An entry is reviewed
+// by the supervisor of the user who recorded it, by whoever that supervisor delegated their approvals to, or by an
+// admin. Approving recalculates the stock from the entry onwards, so entries that would leave too little stock
+// cannot be approved.
+func reviewEntries(w http.ResponseWriter, r *http.Request, status string) {
+	reqBody := &ReviewEntryReq{}
+	if errStr := httpx.DecodeJsonReq(r, reqBody); errStr != utils.NO_ERR {
+		slog.ErrorContext(r.Context(), "failed to decode JSON request", "error", errStr)
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	if len(reqBody.EntryIds) == 0 {
+		slog.ErrorContext(r.Context(), "missing required fields", "entry_ids", reqBody.EntryIds)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.MISSING_REQUIRED_FIELDS)
+		return
+	}
+
+	unlock, err := stock.LockEntryCompounds(r.Context(), reqBody.EntryIds)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error locking compounds of entries", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.ENTRY_RETRIEVAL_ERR)
+		return
+	}
+	defer unlock()
+
+	tx, err := db.ConnFrom(r.Context()).BeginTx(r.Context(), nil)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error starting transaction", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.TX_START_ERR)
+		return
+	}
+	defer tx.Rollback()
+
+	actor := currentUser(r)
+	reviewedAt := datetime.Now(r.Context())
+	recalculateFrom := map[string]int64{}
+	for _, entryId := range reqBody.EntryIds {
+		var compoundId, entryStatus, createdBy string
+		var date int64
+		err := tx.QueryRowContext(r.Context(),
+			"SELECT compound_id, date, status, COALESCE(created_by, '') FROM entry WHERE id = ? AND deleted_at IS NULL", entryId,
+		).Scan(&compoundId, &date, &entryStatus, &createdBy)
+		if err == sql.ErrNoRows {
+			slog.ErrorContext(r.Context(), "entry not found", "entry_id", entryId)
+			httpx.RespWithError(w, http.StatusNotFound, utils.INVALID_ENTRY_ID)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "error retrieving entry", "entry_id", entryId, "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.ENTRY_RETRIEVAL_ERR)
+			return
+		}
+		if entryStatus != utils.ENTRY_STATUS_PENDING {
+			slog.ErrorContext(r.Context(), "entry already reviewed", "entry_id", entryId, "status", entryStatus)
+			httpx.RespWithError(w, http.StatusConflict, utils.ENTRY_NOT_PENDING)
+			return
+		}
+		if status, errStr := checkEntryDatesUnlocked(r.Context(), date); errStr != utils.NO_ERR {
+			httpx.RespWithError(w, status, errStr)
+			return
+		}
+
+		approverId := ""
+		if creator, err := utils.GetUser(r.Context(), createdBy); err != nil {
+			slog.ErrorContext(r.Context(), "error retrieving entry creator", "entry_id", entryId, "created_by", createdBy, "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.USER_RETRIEVAL_ERR)
+			return
+		} else if creator != nil {
+			approverId = creator.SupervisorId
+		}
+
+		allowed, onBehalfOf, err := utils.AuthorizeApproval(r.Context(), actor, approverId, reviewedAt)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "error resolving entry approver", "entry_id", entryId, "approver_id", approverId, "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.DELEGATION_RETRIEVAL_ERR)
+			return
+		}
+		if !allowed {
+			slog.WarnContext(r.Context(), "user may not review entry", "entry_id", entryId, "user_id", actor.Id, "approver_id", approverId)
+			httpx.RespWithError(w, http.StatusForbidden, utils.FORBIDDEN_APPROVAL)
+			return
+		}
+
+		if _, err := tx.ExecContext(r.Context(),
+			"UPDATE entry SET status = ?, reviewed_by = ?, reviewed_at = ?, review_remark = NULLIF(?, '') WHERE id = ?",
+			status, actor.Id, reviewedAt.Unix(), reqBody.Remark, entryId,
+		); err != nil {
+			slog.ErrorContext(r.Context(), "error reviewing entry", "entry_id", entryId, "status", status, "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.ENTRY_REVIEW_ERR)
+			return
+		}
+
+		details := map[string]any{"remark": reqBody.Remark}
+		if onBehalfOf != "" {
+			details["on_behalf_of"] = onBehalfOf
+		}
+		action := "entry.approve"
+		if status == utils.ENTRY_STATUS_REJECTED {
+			action = "entry.reject"
+		}
+		utils.RecordAudit(r.Context(), tx, actor.Id, action, utils.AUDIT_TARGET_ENTRY, entryId, details)
+
+		if from, ok := recalculateFrom[compoundId]; status == utils.ENTRY_STATUS_APPROVED && (!ok || date < from) {
+			recalculateFrom[compoundId] = date
+		}
+	}
+
+	for compoundId, from := range recalculateFrom {
+		if errStr := stock.UpdateNetStockFromTodayOnwards(r.Context(), tx, compoundId, from); errStr != utils.NO_ERR {
+			slog.ErrorContext(r.Context(), "error updating net stock after approval", "compound_id", compoundId, "error", errStr)
+			httpx.RespWithError(w, recalculationErrStatus(errStr), errStr)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.ErrorContext(r.Context(), "error committing transaction", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.COMMIT_TRANSACTION_ERR)
+		return
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"entry_ids": reqBody.EntryIds,
+		"status":    status,
+	})
+}
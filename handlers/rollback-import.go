@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/datetime"
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/stock"
+	"chemical-ledger-backend/utils"
+	"context"
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Hours after an import or paste during which it can be rolled back, set with IMPORT_ROLLBACK_HOURS (default 48,
+// 0 turns rollbacks off)
+func importRollbackWindow() time.Duration {
+	return time.Duration(max(utils.GetEnvInt("IMPORT_ROLLBACK_HOURS", 48), 0)) * time.Hour
+}
+
+// Moves every entry of an import or paste to the trash, for mistakes found after it went in, and recalculates the
+// stock of the compounds it touched. Entries of the import already deleted stay so. Like deleting them one by one,
+// it is refused when the stock they brought in was already issued. Admins only; every rollback is audited.
+func RollbackImportHandler(w http.ResponseWriter, r *http.Request) {
+	importId := chi.URLParam(r, "id")
+
+	var createdAt int64
+	var rolledBackAt sql.NullInt64
+	err := db.ConnFrom(r.Context()).QueryRowContext(r.Context(), "SELECT created_at, rolled_back_at FROM import_batch WHERE id = ?", importId).Scan(&createdAt, &rolledBackAt)
+	if err == sql.ErrNoRows {
+		slog.WarnContext(r.Context(), "import not found", "import_id", importId)
+		httpx.RespWithError(w, http.StatusNotFound, utils.INVALID_IMPORT_ID)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error retrieving import", "import_id", importId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.IMPORT_ROLLBACK_ERR)
+		return
+	}
+	if rolledBackAt.Valid {
+		slog.WarnContext(r.Context(), "import already rolled back", "import_id", importId)
+		httpx.RespWithError(w, http.StatusConflict, utils.IMPORT_ROLLED_BACK)
+		return
+	}
+	if window := importRollbackWindow(); window == 0 || datetime.Now(r.Context()).After(time.Unix(createdAt, 0).Add(window)) {
+		slog.WarnContext(r.Context(), "import past its rollback window", "import_id", importId, "created_at", createdAt)
+		httpx.RespWithError(w, http.StatusForbidden, utils.IMPORT_ROLLBACK_CLOSED)
+		return
+	}
+
+	compoundIds, err := getImportCompoundIds(r.Context(), importId)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error retrieving compounds of import", "import_id", importId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.IMPORT_ROLLBACK_ERR)
+		return
+	}
+	unlock := stock.LockCompounds(compoundIds...)
+	defer unlock()
+
+	tx, err := db.ConnFrom(r.Context()).BeginTx(r.Context(), nil)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error starting transaction", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.TX_START_ERR)
+		return
+	}
+	defer tx.Rollback()
+
+	// Each compound is recalculated from the first entry of the import it has
+	rows, err := tx.QueryContext(r.Context(),
+		"SELECT compound_id, MIN(date) FROM entry WHERE import_batch_id = ? AND deleted_at IS NULL GROUP BY compound_id",
+		importId,
+	)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error retrieving entries of import", "import_id", importId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.IMPORT_ROLLBACK_ERR)
+		return
+	}
+	recalculateFrom := map[string]int64{}
+	dates := []int64{}
+	for rows.Next() {
+		var compoundId string
+		var date int64
+		if err := rows.Scan(&compoundId, &date); err != nil {
+			rows.Close()
+			slog.ErrorContext(r.Context(), "error scanning entries of import", "import_id", importId, "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.IMPORT_ROLLBACK_ERR)
+			return
+		}
+		recalculateFrom[compoundId] = date
+		dates = append(dates, date)
+	}
+	rows.Close()
+
+	if status, errStr := checkEntryDatesUnlocked(r.Context(), dates...); errStr != utils.NO_ERR {
+		httpx.RespWithError(w, status, errStr)
+		return
+	}
+
+	actor := currentUser(r)
+	now := datetime.Now(r.Context()).Unix()
+	result, err := tx.ExecContext(r.Context(),
+		"UPDATE entry SET deleted_at = ?, deleted_by = ? WHERE import_batch_id = ? AND deleted_at IS NULL",
+		now, actor.Id, importId,
+	)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error deleting entries of import", "import_id", importId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.ENTRY_DELETE_ERR)
+		return
+	}
+	deleted, _ := result.RowsAffected()
+
+	for compoundId, date := range recalculateFrom {
+		if errStr := stock.UpdateNetStockFromTodayOnwards(r.Context(), tx, compoundId, date); errStr != utils.NO_ERR {
+			slog.ErrorContext(r.Context(), "error updating net stock after import rollback", "import_id", importId, "compound_id", compoundId, "error", errStr)
+			httpx.RespWithError(w, recalculationErrStatus(errStr), errStr)
+			return
+		}
+	}
+
+	if _, err := tx.ExecContext(r.Context(),
+		"UPDATE import_batch SET rolled_back_by = ?, rolled_back_at = ? WHERE id = ?",
+		actor.Id, now, importId,
+	); err != nil {
+		slog.ErrorContext(r.Context(), "error marking import rolled back", "import_id", importId, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.IMPORT_ROLLBACK_ERR)
+		return
+	}
+
+	utils.RecordAudit(r.Context(), tx, actor.Id, "import.rollback", utils.AUDIT_TARGET_IMPORT, importId, map[string]any{
+		"deleted": deleted,
+	})
+
+	if err := tx.Commit(); err != nil {
+		slog.ErrorContext(r.Context(), "error committing transaction", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.COMMIT_TRANSACTION_ERR)
+		return
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"import_id": importId,
+		"deleted":   deleted,
+	})
+}
+
+// Compounds with entries in the given import, to be locked while it is rolled back
+func getImportCompoundIds(ctx context.Context, importId string) ([]string, error) {
+	rows, err := db.ConnFrom(ctx).QueryContext(ctx, "SELECT DISTINCT compound_id FROM entry WHERE import_batch_id = ?", importId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	compoundIds := []string{}
+	for rows.Next() {
+		var compoundId string
+		if err := rows.Scan(&compoundId); err != nil {
+			return nil, err
+		}
+		compoundIds = append(compoundIds, compoundId)
+	}
+	return compoundIds, rows.Err()
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"fmt"
+	"log/slog"
+	"net/http"
+)
+
+type RunSqlQueryReq struct {
+	Query string `json:"query"`
+	Limit int    `json:"limit"`
+}
+
+// Runs a read-only query against the database for investigations on deployments the file cannot be copied from.
+// Only single SELECT (or WITH) queries are taken and SQLite is kept from changing anything, see
+// utils.RunReadOnlyQuery; "limit" caps the rows returned. Admins only, and only with SQL_CONSOLE set. Every query,
+// refused or failed ones included, is audited as "sql.query" with its text.
+func RunSqlQueryHandler(w http.ResponseWriter, r *http.Request) {
+	if !utils.SqlConsoleEnabled() {
+		slog.WarnContext(r.Context(), "SQL console is disabled")
+		httpx.RespWithError(w, http.StatusForbidden, utils.SQL_CONSOLE_DISABLED)
+		return
+	}
+
+	reqBody := &RunSqlQueryReq{}
+	if errStr := httpx.DecodeJsonReq(r, reqBody); errStr != utils.NO_ERR {
+		slog.ErrorContext(r.Context(), "failed to decode JSON request", "error", errStr)
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	actorId := currentUser(r).Id
+	query, errStr := utils.CheckReadOnlyQuery(reqBody.Query)
+	if errStr != utils.NO_ERR {
+		slog.WarnContext(r.Context(), "SQL console query refused", "actor_id", actorId, "error", errStr)
+		utils.RecordAudit(r.Context(), nil, actorId, "sql.query", utils.AUDIT_TARGET_DATABASE, "", map[string]any{
+			"query": reqBody.Query,
+			"error": errStr,
+		})
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	result, err := utils.RunReadOnlyQuery(r.Context(), query, reqBody.Limit)
+	if err != nil {
+		slog.WarnContext(r.Context(), "SQL console query failed", "actor_id", actorId, "error", err)
+		utils.RecordAudit(r.Context(), nil, actorId, "sql.query", utils.AUDIT_TARGET_DATABASE, "", map[string]any{
+			"query": query,
+			"error": err.Error(),
+		})
+		httpx.RespWithError(w, http.StatusBadRequest, utils.ErrorMessage(fmt.Sprintf("%s (%v)", utils.SQL_QUERY_ERR, err)))
+		return
+	}
+
+	utils.RecordAudit(r.Context(), nil, actorId, "sql.query", utils.AUDIT_TARGET_DATABASE, "", map[string]any{
+		"query":     query,
+		"rows":      len(result.Rows),
+		"truncated": result.Truncated,
+	})
+
+	httpx.RespWithData(w, http.StatusOK, result)
+}
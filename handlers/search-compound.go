@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Default and largest number of compounds a search returns
+const (
+	DEFAULT_COMPOUND_SEARCH_LIMIT = 10
+	MAX_COMPOUND_SEARCH_LIMIT     = 50
+)
+
+type CompoundSearchResult struct {
+	ID       string `json:"key"`
+	Name     string `json:"name"`
+	Scale    string `json:"scale"`
+	CasNo    string `json:"cas_no"`
+	Archived bool   `json:"archived"`
+}
+
+// Finds the compounds whose name or CAS number contains "q", ignoring case, for the compound dropdown to fill as
+// the user types. The best matches come first: the name itself, names starting with it, names with a word starting
+// with it, CAS numbers starting with it, and then the rest, each alphabetically. At most "limit" (default 10, at most
+// 50) are returned; archived compounds only with "include_archived".
+func SearchCompoundHandler(w http.ResponseWriter, r *http.Request) {
+	q := strings.ToLower(strings.TrimSpace(httpx.GetParam(r, "q")))
+	if q == "" {
+		slog.WarnContext(r.Context(), "empty compound search")
+		httpx.RespWithError(w, http.StatusBadRequest, utils.MISSING_REQUIRED_FIELDS)
+		return
+	}
+
+	limit, err := httpx.GetIntParam(r, "limit")
+	if err != nil || limit < 0 || limit > MAX_COMPOUND_SEARCH_LIMIT {
+		slog.ErrorContext(r.Context(), "invalid compound search limit", "limit", httpx.GetParam(r, "limit"), "error", err)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.INVALID_PAGINATION)
+		return
+	}
+	if limit == 0 {
+		limit = DEFAULT_COMPOUND_SEARCH_LIMIT
+	}
+	includeArchived, _ := strconv.ParseBool(httpx.GetParam(r, "include_archived"))
+
+	pattern := utils.EscapeLike(q)
+	rows, err := db.ConnFrom(r.Context()).QueryContext(r.Context(), `
+		SELECT id, name, scale, cas_no, archived_at IS NOT NULL
+		FROM (
+			SELECT *, CASE
+				WHEN lower_case_name = ? THEN 0
+				WHEN lower_case_name LIKE ? || '%' ESCAPE '\' THEN 1
+				WHEN lower_case_name LIKE '% ' || ? || '%' ESCAPE '\' THEN 2
+				WHEN lower(cas_no) LIKE ? || '%' ESCAPE '\' THEN 3
+				WHEN lower_case_name LIKE '%' || ? || '%' ESCAPE '\' OR lower(cas_no) LIKE '%' || ? || '%' ESCAPE '\' THEN 4
+			END AS rank
+			FROM compound
+			WHERE ? OR archived_at IS NULL
+		)
+		WHERE rank IS NOT NULL
+		ORDER BY rank ASC, lower_case_name ASC
+		LIMIT ?`,
+		q, pattern, pattern, pattern, pattern, pattern, includeArchived, limit,
+	)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to search compounds", "q", q, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.COMPOUND_RETRIEVAL_ERR)
+		return
+	}
+	defer rows.Close()
+
+	compounds := []CompoundSearchResult{}
+	for rows.Next() {
+		var c CompoundSearchResult
+		if err := rows.Scan(&c.ID, &c.Name, &c.Scale, &c.CasNo, &c.Archived); err != nil {
+			slog.ErrorContext(r.Context(), "failed to scan compound search result", "q", q, "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.COMPOUND_RETRIEVAL_ERR)
+			return
+		}
+		compounds = append(compounds, c)
+	}
+	if err := rows.Err(); err != nil {
+		slog.ErrorContext(r.Context(), "failed to search compounds", "q", q, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.COMPOUND_RETRIEVAL_ERR)
+		return
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"compounds": compounds,
+	})
+}
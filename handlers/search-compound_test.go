@@ -0,0 +1,51 @@
+package handlers_test
+
+import (
+	"chemical-ledger-backend/handlers"
+	"chemical-ledger-backend/testutils"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompoundSearchRanksNameMatchesFirst(t *testing.T) {
+	t.Parallel()
+	env := testutils.NewEnv(t, time.Date(2026, 3, 14, 10, 0, 0, 0, time.Local))
+
+	env.InsertCompound("C_1", "Sodium chloride", "g")
+	env.InsertCompound("C_2", "Chloroform", "ml")
+	env.InsertCompound("C_3", "Hydrochloric acid", "ml")
+	env.InsertCompound("C_4", "Chlor", "g")
+	env.InsertCompound("C_5", "Ethanol", "ml")
+	if _, err := env.DB.Exec("UPDATE compound SET cas_no = '67-66-3' WHERE id = 'C_2'"); err != nil {
+		t.Fatal(err)
+	}
+
+	search := func(query string) string {
+		w := httptest.NewRecorder()
+		handlers.SearchCompoundHandler(w, env.Request(http.MethodGet, "/search-compound?"+query, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("search %s: status %d, %s", query, w.Code, w.Body)
+		}
+		keys := []string{}
+		for _, part := range strings.Split(w.Body.String(), `"key":"`)[1:] {
+			keys = append(keys, part[:strings.Index(part, `"`)])
+		}
+		return strings.Join(keys, ",")
+	}
+
+	if got := search("q=CHLOR"); got != "C_4,C_2,C_1,C_3" {
+		t.Errorf("ranking: got %s", got)
+	}
+	if got := search("q=chlor&limit=2"); got != "C_4,C_2" {
+		t.Errorf("limit: got %s", got)
+	}
+	if got := search("q=67-66"); got != "C_2" {
+		t.Errorf("CAS number: got %s", got)
+	}
+	if got := search("q=%25"); got != "" {
+		t.Errorf("wildcard taken literally: got %s", got)
+	}
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+)
+
+const TENANT_HEADER = "X-Tenant-Id"
+
+// In multi-tenant mode, works the request on the database of its tenant: the subdomain it was sent to under
+// TENANT_DOMAIN, e.g. "stmarys" for "stmarys.ledger.example.org", or else the "X-Tenant-Id" header, which only
+// requests forwarded by a trusted proxy (see utils.TrustedProxies) may set, as anyone can send it. Requests naming
+// no tenant are refused with 400 and those naming one not hosted with 404. Does nothing in single-tenant mode.
+func TenantMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenants := db.TenantsFrom(r.Context())
+		if tenants == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		tenantId := requestTenant(r)
+		if tenantId == "" {
+			httpx.RespWithError(w, http.StatusBadRequest, utils.TENANT_REQUIRED)
+			return
+		}
+		if !tenants.Has(tenantId) {
+			slog.WarnContext(r.Context(), "unknown tenant", "tenant_id", tenantId)
+			httpx.RespWithError(w, http.StatusNotFound, utils.UNKNOWN_TENANT)
+			return
+		}
+
+		lease, err := tenants.Acquire(tenantId)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to open tenant database", "tenant_id", tenantId, "error", err)
+			httpx.RespWithError(w, http.StatusServiceUnavailable, utils.TENANT_DATABASE_ERR)
+			return
+		}
+		defer lease.Release()
+
+		next.ServeHTTP(w, r.WithContext(db.WithLease(r.Context(), lease)))
+	})
+}
+
+// Tenant the request names by its subdomain, or else by the "X-Tenant-Id" header of a trusted proxy
+func requestTenant(r *http.Request) string {
+	if domain := utils.TenantDomain(); domain != "" {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		host = strings.ToLower(strings.TrimSuffix(host, "."))
+		if sub, found := strings.CutSuffix(host, "."+domain); found && sub != "" && !strings.Contains(sub, ".") {
+			return sub
+		}
+	}
+	if !utils.IsTrustedProxy(r.RemoteAddr) {
+		if r.Header.Get(TENANT_HEADER) != "" {
+			slog.WarnContext(r.Context(), "tenant header from an untrusted address", "remote_addr", r.RemoteAddr)
+		}
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(r.Header.Get(TENANT_HEADER)))
+}
@@ -0,0 +1,225 @@
+package handlers_test
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/handlers"
+	"chemical-ledger-backend/testutils"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTenants(t *testing.T, maxOpen int, ids ...string) *db.Tenants {
+	t.Helper()
+	tenants, err := db.NewTenants(t.TempDir(), ids, maxOpen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { tenants.Close() })
+	return tenants
+}
+
+func TestTenantsOnlySeeTheirOwnLedger(t *testing.T) {
+	// httptest sends requests from 192.0.2.1
+	t.Setenv("TRUSTED_PROXIES", "192.0.2.0/24")
+	env := testutils.NewEnv(t, time.Date(2026, 3, 14, 10, 0, 0, 0, time.Local))
+	env.InsertCompound("C_default", "Ethanol", "ml")
+	tenants := newTenants(t, 4, "stmarys", "oakridge")
+
+	lease, err := tenants.Acquire("stmarys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutils.InsertCompoundIn(t, lease.Conn, "C_stmarys", "Ethanol", "ml")
+	lease.Release()
+
+	search := handlers.TenantMiddleware(http.HandlerFunc(handlers.SearchCompoundHandler))
+	getFrom := func(remoteAddr string, tenantId string) *httptest.ResponseRecorder {
+		req := env.Request(http.MethodGet, "/search-compound?q=ethanol", nil)
+		req = req.WithContext(db.WithTenants(req.Context(), tenants))
+		req.RemoteAddr = remoteAddr
+		if tenantId != "" {
+			req.Header.Set(handlers.TENANT_HEADER, tenantId)
+		}
+		w := httptest.NewRecorder()
+		search.ServeHTTP(w, req)
+		return w
+	}
+	get := func(tenantId string) *httptest.ResponseRecorder {
+		return getFrom("192.0.2.1:41234", tenantId)
+	}
+
+	if w := get("stmarys"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "C_stmarys") || strings.Contains(w.Body.String(), "C_default") {
+		t.Errorf("stmarys: status %d, %s", w.Code, w.Body)
+	}
+	if w := get("oakridge"); w.Code != http.StatusOK || strings.Contains(w.Body.String(), "C_") {
+		t.Errorf("oakridge sees compounds of others: status %d, %s", w.Code, w.Body)
+	}
+	if w := get(""); w.Code != http.StatusBadRequest {
+		t.Errorf("no tenant: status %d, %s", w.Code, w.Body)
+	}
+	if w := get("elmwood"); w.Code != http.StatusNotFound {
+		t.Errorf("unknown tenant: status %d, %s", w.Code, w.Body)
+	}
+	// Only the proxies name the tenant in the header, whether the request comes from afar or from this machine
+	for _, addr := range []string{"203.0.113.5:41234", "127.0.0.1:41234"} {
+		if w := getFrom(addr, "stmarys"); w.Code != http.StatusBadRequest {
+			t.Errorf("tenant header from %s: status %d, %s", addr, w.Code, w.Body)
+		}
+	}
+
+	// Without tenants, requests work on the database they were handed
+	w := httptest.NewRecorder()
+	search.ServeHTTP(w, env.Request(http.MethodGet, "/search-compound?q=ethanol", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "C_default") {
+		t.Errorf("single-tenant: status %d, %s", w.Code, w.Body)
+	}
+}
+
+func TestTenantFromSubdomain(t *testing.T) {
+	t.Setenv("TENANT_DOMAIN", "ledger.example.org")
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.7")
+	env := testutils.NewEnv(t, time.Date(2026, 3, 14, 10, 0, 0, 0, time.Local))
+	tenants := newTenants(t, 4, "stmarys", "oakridge")
+
+	var served string
+	handler := handlers.TenantMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served = db.TenantFrom(r.Context())
+	}))
+	remoteAddr := "10.0.0.7:41234"
+	tenantOf := func(host string, header string) string {
+		served = ""
+		req := env.Request(http.MethodGet, "/me", nil)
+		req = req.WithContext(db.WithTenants(req.Context(), tenants))
+		req.RemoteAddr = remoteAddr
+		req.Host = host
+		if header != "" {
+			req.Header.Set(handlers.TENANT_HEADER, header)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		return served
+	}
+
+	if got := tenantOf("StMarys.ledger.example.org:8080", "oakridge"); got != "stmarys" {
+		t.Errorf("subdomain over header: got %q", got)
+	}
+	if got := tenantOf("ledger.example.org", "oakridge"); got != "oakridge" {
+		t.Errorf("bare domain falls back to the header: got %q", got)
+	}
+	if got := tenantOf("a.stmarys.ledger.example.org", ""); got != "" {
+		t.Errorf("nested subdomain: got %q", got)
+	}
+
+	// Subdomains are taken from anyone, the header only from the proxy
+	remoteAddr = "203.0.113.5:41234"
+	if got := tenantOf("oakridge.ledger.example.org", ""); got != "oakridge" {
+		t.Errorf("subdomain without a proxy: got %q", got)
+	}
+	if got := tenantOf("ledger.example.org", "oakridge"); got != "" {
+		t.Errorf("header without a proxy: got %q", got)
+	}
+}
+
+func TestTenantDatabasesAreClosedLeastRecentlyUsedFirst(t *testing.T) {
+	t.Parallel()
+	tenants := newTenants(t, 2, "a", "b", "c")
+
+	a, err := tenants.Acquire("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"b", "c"} {
+		lease, err := tenants.Acquire(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lease.Release()
+	}
+	if n := tenants.OpenCount(); n != 2 {
+		t.Errorf("open databases: got %d, want 2", n)
+	}
+
+	// "a" was made room for, but stays usable until let go
+	if err := a.Conn.Ping(); err != nil {
+		t.Errorf("evicted database in use: %v", err)
+	}
+	a.Release()
+	a.Release()
+	if err := a.Conn.Ping(); err == nil {
+		t.Error("evicted database still open once released")
+	}
+
+	again, err := tenants.Acquire("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer again.Release()
+	if err := again.Conn.Ping(); err != nil {
+		t.Errorf("reopened database: %v", err)
+	}
+	if n := tenants.OpenCount(); n != 2 {
+		t.Errorf("open databases after reopening: got %d, want 2", n)
+	}
+}
+
+// A tenant whose database cannot be opened keeps failing on its own, and is tried again on its next request, while
+// requests coming in together for a database not yet open share it once opened
+func TestTenantDatabasesOpenApart(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	tenants, err := db.NewTenants(dir, []string{"a", "b"}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { tenants.Close() })
+
+	// A folder in the place of its database file
+	if err := os.Mkdir(filepath.Join(dir, "a.db"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tenants.Acquire("a"); err == nil {
+		t.Fatal("database of a opened")
+	}
+
+	leases := make([]*db.Lease, 8)
+	var wg sync.WaitGroup
+	for i := range leases {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lease, err := tenants.Acquire("b")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			leases[i] = lease
+		}()
+	}
+	wg.Wait()
+	for _, lease := range leases {
+		if lease == nil {
+			continue
+		}
+		if lease.Conn != leases[0].Conn {
+			t.Error("database of b opened more than once")
+		}
+		lease.Release()
+	}
+	if n := tenants.OpenCount(); n != 1 {
+		t.Errorf("open databases: got %d, want 1", n)
+	}
+
+	if err := os.Remove(filepath.Join(dir, "a.db")); err != nil {
+		t.Fatal(err)
+	}
+	lease, err := tenants.Acquire("a")
+	if err != nil {
+		t.Fatalf("database of a once it can be opened: %v", err)
+	}
+	lease.Release()
+}
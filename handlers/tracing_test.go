@@ -0,0 +1,65 @@
+package handlers_test
+
+import (
+	"chemical-ledger-backend/handlers"
+	"chemical-ledger-backend/testutils"
+	"chemical-ledger-backend/utils"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracingCoversRequestQueriesAndRecalculation(t *testing.T) {
+	env := testutils.NewEnv(t, time.Date(2026, 3, 14, 10, 0, 0, 0, time.Local))
+
+	spans := tracetest.NewSpanRecorder()
+	defaultProvider := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)))
+	defer otel.SetTracerProvider(defaultProvider)
+
+	env.InsertCompound("C_1", "Acetone", "ml")
+	r := chi.NewRouter()
+	r.Use(handlers.TracingMiddleware)
+	r.Post("/insert-entry", handlers.InsertEntryHandler)
+
+	body := fmt.Sprintf(`{"type": %q, "compound_id": "C_1", "date": "2026-03-14", "num_of_units": 1, "quantity_per_unit": 100}`, utils.ENTRY_TYPE_INCOMING)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, env.Request(http.MethodPost, "/insert-entry", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("insert: status %d, %s", w.Code, w.Body)
+	}
+
+	var request sdktrace.ReadOnlySpan
+	byName := map[string][]sdktrace.ReadOnlySpan{}
+	for _, span := range spans.Ended() {
+		byName[span.Name()] = append(byName[span.Name()], span)
+		if span.Name() == "POST /insert-entry" {
+			request = span
+		}
+	}
+	if request == nil {
+		t.Fatalf("no request span among %v", byName)
+	}
+	recalculations := byName["stock.UpdateNetStock"]
+	if len(recalculations) != 1 || recalculations[0].Parent().SpanID() != request.SpanContext().SpanID() {
+		t.Fatalf("recalculation spans %v", recalculations)
+	}
+	entries := false
+	for _, attr := range recalculations[0].Attributes() {
+		entries = entries || attr.Key == "entries" && attr.Value.AsInt64() == 1
+	}
+	if !entries {
+		t.Errorf("recalculation attributes %v", recalculations[0].Attributes())
+	}
+	if len(byName["db.insert"]) == 0 || len(byName["db.select"]) == 0 || byName["db.insert"][0].SpanContext().TraceID() != request.SpanContext().TraceID() {
+		t.Errorf("query spans %v", byName)
+	}
+}
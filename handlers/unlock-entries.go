@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/datetime"
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Longest an admin can suspend the entry lock for at once
+const MAX_UNLOCK_HOURS = 7 * 24
+
+type UnlockEntriesReq struct {
+	Hours  int    `json:"hours"`
+	Reason string `json:"reason"`
+}
+
+// Suspends the entry lock for "hours" (default 24) so backdated entries can be recorded or corrected, after
+// which the locked months lock again by themselves. Admins only; every unlock is audited with its "reason".
+func UnlockEntriesHandler(w http.ResponseWriter, r *http.Request) {
+	reqBody := &UnlockEntriesReq{}
+	if errStr := httpx.DecodeJsonReq(r, reqBody); errStr != utils.NO_ERR {
+		slog.ErrorContext(r.Context(), "failed to decode JSON request", "error", errStr)
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	if reqBody.Hours == 0 {
+		reqBody.Hours = 24
+	}
+	if reqBody.Hours < 0 || reqBody.Hours > MAX_UNLOCK_HOURS {
+		slog.ErrorContext(r.Context(), "invalid unlock hours", "hours", reqBody.Hours)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.INVALID_UNLOCK_HOURS)
+		return
+	}
+
+	actor := currentUser(r)
+	unlockedUntil := datetime.Now(r.Context()).Add(time.Duration(reqBody.Hours) * time.Hour)
+	result, err := db.ConnFrom(r.Context()).ExecContext(r.Context(),
+		"UPDATE entry_lock SET unlocked_until = ?, unlocked_by = ? WHERE id = 1",
+		unlockedUntil.Unix(), actor.Id,
+	)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to unlock entries", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.ENTRY_UNLOCK_ERR)
+		return
+	}
+	if changed, err := result.RowsAffected(); err != nil || changed == 0 {
+		slog.WarnContext(r.Context(), "no entries are locked", "error", err)
+		httpx.RespWithError(w, http.StatusConflict, utils.NOTHING_LOCKED)
+		return
+	}
+
+	utils.RecordAudit(r.Context(), nil, actor.Id, "entry_lock.unlock", utils.AUDIT_TARGET_ENTRY_LOCK, "", reqBody)
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"unlocked_until": unlockedUntil.Format("2006-01-02 15:04:05"),
+	})
+}
@@ -1,76 +1,119 @@
 package handlers
 
 import (
+	"chemical-ledger-backend/datetime"
 	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/retry"
 	"chemical-ledger-backend/utils"
+	"context"
 	"log/slog"
 	"net/http"
+	"strings"
 )
 
 type UpdateCompoundReq struct {
-	ID    string `json:"id"`
-	Name  string `json:"name"`
-	Scale string `json:"scale"`
+	ID            string              `json:"id"`
+	Name          string              `json:"name"`
+	Scale         string              `json:"scale"`
+	MinStock      *utils.LocalizedInt `json:"min_stock"`
+	Notes         *string             `json:"notes"`
+	PinnedWarning *string             `json:"pinned_warning"`
+	Category      *string             `json:"category"`
+	DisplayUnit   *string             `json:"display_unit"`
+	Archived      *bool               `json:"archived"`
+	// Empty strings clear the chemical data, as does a molecular weight of 0
+	CasNo           *string  `json:"cas_no"`
+	Formula         *string  `json:"formula"`
+	MolecularWeight *float64 `json:"molecular_weight"`
+	StorageLocation *string  `json:"storage_location"`
+	HazardClass     *string  `json:"hazard_class"`
+	Controlled      *bool    `json:"controlled"`
+	// 0 derives the largest plausible delivery from the past deliveries again
+	MaxIncoming *utils.LocalizedInt `json:"max_incoming"`
 }
 
 func UpdateCompoundHandler(w http.ResponseWriter, r *http.Request) {
 	reqBody := &UpdateCompoundReq{}
-	if errStr := utils.DecodeJsonReq(r, reqBody); errStr != utils.NO_ERR {
-		slog.Error("failed to decode JSON request", "error", errStr)
-		utils.RespWithError(w, http.StatusBadRequest, errStr)
+	if errStr := httpx.DecodeJsonReq(r, reqBody); errStr != utils.NO_ERR {
+		slog.ErrorContext(r.Context(), "failed to decode JSON request", "error", errStr)
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
 		return
 	}
 
-	if errMsg := validateUpdateCompoundReq(reqBody); errMsg != utils.NO_ERR {
-		slog.Error("invalid compound update request", "compound_id", reqBody.ID, "error", errMsg)
-		utils.RespWithError(w, http.StatusBadRequest, errMsg)
+	if errMsg := validateUpdateCompoundReq(r.Context(), reqBody); errMsg != utils.NO_ERR {
+		slog.ErrorContext(r.Context(), "invalid compound update request", "compound_id", reqBody.ID, "error", errMsg)
+		httpx.RespWithError(w, http.StatusBadRequest, errMsg)
 		return
 	}
 
 	lowerCasedName := utils.GetLowerCasedCompoundName(reqBody.Name)
 
-	lowerCaseCompoundExists, err := utils.CheckIfLowerCaseCompoundExists(lowerCasedName)
+	lowerCaseCompoundExists, err := utils.CheckIfLowerCaseCompoundExists(r.Context(), lowerCasedName)
 	if err != nil {
-		slog.Error("failed to check lowercased compound existence", "compound_name", reqBody.Name, "error", err)
-		utils.RespWithError(w, http.StatusInternalServerError, utils.COMPOUND_ID_CHECK_ERR)
+		slog.ErrorContext(r.Context(), "failed to check lowercased compound existence", "compound_name", reqBody.Name, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.COMPOUND_ID_CHECK_ERR)
 		return
 	}
 
-	scale, err := getCompoundScale(reqBody.ID)
+	scale, err := getCompoundScale(r.Context(), reqBody.ID)
 	if err != nil {
-		slog.Error("failed to get compound scale", "compound_id", reqBody.ID, "error", err)
-		utils.RespWithError(w, http.StatusInternalServerError, utils.COMPOUND_SCALE_ERR)
+		slog.ErrorContext(r.Context(), "failed to get compound scale", "compound_id", reqBody.ID, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.COMPOUND_SCALE_ERR)
 		return
 	}
 
-	compoundName, err := getCompoundName(reqBody.ID)
+	compoundName, err := getCompoundName(r.Context(), reqBody.ID)
 	if err != nil {
-		slog.Error("failed to get compound name", "compound_id", reqBody.ID, "error", err)
-		utils.RespWithError(w, http.StatusInternalServerError, utils.COMPOUND_SCALE_ERR)
+		slog.ErrorContext(r.Context(), "failed to get compound name", "compound_id", reqBody.ID, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.COMPOUND_SCALE_ERR)
 		return
 	}
 
+	if reqBody.Scale != "" {
+		newScale, status, errStr := parseScale(r.Context(), reqBody.Scale)
+		if errStr != utils.NO_ERR {
+			httpx.RespWithError(w, status, errStr)
+			return
+		}
+		reqBody.Scale = newScale
+	}
+
 	if scale != reqBody.Scale && reqBody.Scale != "" && compoundName == reqBody.Name {
-		if _, err := db.Conn.Exec(`
+		// Recorded quantities are kept in the scale and would silently change meaning, so only compounds without any
+		// may change it. A display unit of the other kind no longer fits.
+		result, err := db.ConnFrom(r.Context()).ExecContext(r.Context(), `
 			UPDATE compound
-			SET scale = ?
-			WHERE id = ?`,
-			reqBody.Scale, reqBody.ID,
-		); err != nil {
-			slog.Error("failed to update compound scale", "compound_id", reqBody.ID, "scale", reqBody.Scale, "error", err)
-			utils.RespWithError(w, http.StatusInternalServerError, utils.COMPOUND_UPDATE_ERR)
+			SET scale = ?, display_unit = CASE WHEN (SELECT kind FROM unit WHERE name = display_unit) = (SELECT kind FROM unit WHERE name = ?) THEN display_unit END
+			WHERE id = ?
+				AND NOT EXISTS(SELECT 1 FROM entry WHERE compound_id = compound.id)
+				AND NOT EXISTS(SELECT 1 FROM stock_take_count WHERE compound_id = compound.id)
+				AND NOT EXISTS(SELECT 1 FROM purchase_order_line WHERE compound_id = compound.id)
+				AND NOT EXISTS(SELECT 1 FROM invoice_line WHERE compound_id = compound.id)
+				AND NOT EXISTS(SELECT 1 FROM reservation WHERE compound_id = compound.id)`,
+			reqBody.Scale, reqBody.Scale, reqBody.ID,
+		)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to update compound scale", "compound_id", reqBody.ID, "scale", reqBody.Scale, "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.COMPOUND_UPDATE_ERR)
+			return
+		}
+		if changed, err := result.RowsAffected(); err != nil || changed == 0 {
+			slog.WarnContext(r.Context(), "compound scale in use", "compound_id", reqBody.ID, "scale", scale, "new_scale", reqBody.Scale, "error", err)
+			httpx.RespWithError(w, http.StatusNotAcceptable, utils.COMPOUND_SCALE_IN_USE)
 			return
 		}
+		scale = reqBody.Scale
 	}
 
 	if reqBody.Name != compoundName && reqBody.Name != "" {
 		if lowerCaseCompoundExists {
-			slog.Warn("compound name already exists", "name", reqBody.Name)
-			utils.RespWithError(w, http.StatusNotAcceptable, utils.COMPOUND_ALREADY_EXISTS)
+			slog.WarnContext(r.Context(), "compound name already exists", "name", reqBody.Name)
+			httpx.RespWithError(w, http.StatusNotAcceptable, utils.COMPOUND_ALREADY_EXISTS)
 			return
 		}
 
-		if _, err := db.Conn.Exec(`
+		if _, err := db.ConnFrom(r.Context()).ExecContext(r.Context(), `
 			UPDATE compound
 			SET
 				name = CASE WHEN ? != '' THEN ? ELSE name END,
@@ -80,41 +123,162 @@ func UpdateCompoundHandler(w http.ResponseWriter, r *http.Request) {
 			lowerCasedName, lowerCasedName,
 			reqBody.ID,
 		); err != nil {
-			slog.Error("failed to update compound name", "compound_id", reqBody.ID, "name", reqBody.Name, "error", err)
-			utils.RespWithError(w, http.StatusInternalServerError, utils.COMPOUND_UPDATE_ERR)
+			slog.ErrorContext(r.Context(), "failed to update compound name", "compound_id", reqBody.ID, "name", reqBody.Name, "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.COMPOUND_UPDATE_ERR)
+			return
+		}
+	}
+
+	if reqBody.MinStock != nil {
+		if _, err := db.ConnFrom(r.Context()).ExecContext(r.Context(), "UPDATE compound SET min_stock = ? WHERE id = ?", *reqBody.MinStock, reqBody.ID); err != nil {
+			slog.ErrorContext(r.Context(), "failed to update compound minimum stock", "compound_id", reqBody.ID, "min_stock", *reqBody.MinStock, "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.COMPOUND_UPDATE_ERR)
+			return
+		}
+	}
+
+	if reqBody.MaxIncoming != nil {
+		if _, err := db.ConnFrom(r.Context()).ExecContext(r.Context(), "UPDATE compound SET max_incoming = ? WHERE id = ?", *reqBody.MaxIncoming, reqBody.ID); err != nil {
+			slog.ErrorContext(r.Context(), "failed to update compound max incoming", "compound_id", reqBody.ID, "max_incoming", *reqBody.MaxIncoming, "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.COMPOUND_UPDATE_ERR)
+			return
+		}
+	}
+
+	if reqBody.Notes != nil {
+		if _, err := db.ConnFrom(r.Context()).ExecContext(r.Context(), "UPDATE compound SET notes = ? WHERE id = ?", *reqBody.Notes, reqBody.ID); err != nil {
+			slog.ErrorContext(r.Context(), "failed to update compound notes", "compound_id", reqBody.ID, "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.COMPOUND_UPDATE_ERR)
+			return
+		}
+	}
+
+	// An empty pinned warning unpins it
+	if reqBody.PinnedWarning != nil {
+		if _, err := db.ConnFrom(r.Context()).ExecContext(r.Context(), "UPDATE compound SET pinned_warning = ? WHERE id = ?", strings.TrimSpace(*reqBody.PinnedWarning), reqBody.ID); err != nil {
+			slog.ErrorContext(r.Context(), "failed to update compound pinned warning", "compound_id", reqBody.ID, "pinned_warning", *reqBody.PinnedWarning, "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.COMPOUND_UPDATE_ERR)
+			return
+		}
+	}
+
+	// An empty display unit shows the compound in its scale again
+	if reqBody.DisplayUnit != nil {
+		if status, errStr := validateDisplayUnit(r.Context(), *reqBody.DisplayUnit, scale); errStr != utils.NO_ERR {
+			httpx.RespWithError(w, status, errStr)
+			return
+		}
+		if _, err := db.ConnFrom(r.Context()).ExecContext(r.Context(), "UPDATE compound SET display_unit = NULLIF(?, '') WHERE id = ?", *reqBody.DisplayUnit, reqBody.ID); err != nil {
+			slog.ErrorContext(r.Context(), "failed to update compound display unit", "compound_id", reqBody.ID, "display_unit", *reqBody.DisplayUnit, "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.COMPOUND_UPDATE_ERR)
 			return
 		}
 	}
 
-	utils.RespWithData(w, http.StatusOK, map[string]any{
+	// An empty category takes the compound out of substitute suggestions
+	if reqBody.Category != nil {
+		if _, err := db.ConnFrom(r.Context()).ExecContext(r.Context(), "UPDATE compound SET category = ? WHERE id = ?", strings.TrimSpace(*reqBody.Category), reqBody.ID); err != nil {
+			slog.ErrorContext(r.Context(), "failed to update compound category", "compound_id", reqBody.ID, "category", *reqBody.Category, "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.COMPOUND_UPDATE_ERR)
+			return
+		}
+	}
+
+	if reqBody.CasNo != nil || reqBody.Formula != nil || reqBody.MolecularWeight != nil || reqBody.StorageLocation != nil || reqBody.HazardClass != nil {
+		if _, err := db.ConnFrom(r.Context()).ExecContext(r.Context(), `
+			UPDATE compound SET
+				cas_no = COALESCE(?, cas_no),
+				formula = COALESCE(?, formula),
+				molecular_weight = CASE WHEN ? THEN NULLIF(?, 0) ELSE molecular_weight END,
+				storage_location = COALESCE(?, storage_location),
+				hazard_class = COALESCE(?, hazard_class)
+			WHERE id = ?`,
+			reqBody.CasNo, reqBody.Formula, reqBody.MolecularWeight != nil, reqBody.MolecularWeight, reqBody.StorageLocation, reqBody.HazardClass, reqBody.ID,
+		); err != nil {
+			slog.ErrorContext(r.Context(), "failed to update compound chemical data", "compound_id", reqBody.ID, "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.COMPOUND_UPDATE_ERR)
+			return
+		}
+	}
+
+	if reqBody.Controlled != nil {
+		if _, err := db.ConnFrom(r.Context()).ExecContext(r.Context(), "UPDATE compound SET controlled = ? WHERE id = ?", *reqBody.Controlled, reqBody.ID); err != nil {
+			slog.ErrorContext(r.Context(), "failed to update compound controlled flag", "compound_id", reqBody.ID, "controlled", *reqBody.Controlled, "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.COMPOUND_UPDATE_ERR)
+			return
+		}
+	}
+
+	// Archiving hides the compound from the pickers, its entries stay
+	if reqBody.Archived != nil {
+		actorId := currentUser(r).Id
+		if _, err := db.ConnFrom(r.Context()).ExecContext(r.Context(),
+			"UPDATE compound SET archived_at = CASE WHEN ? THEN COALESCE(archived_at, ?) END, archived_by = CASE WHEN ? THEN COALESCE(archived_by, ?) END WHERE id = ?",
+			*reqBody.Archived, datetime.Now(r.Context()).Unix(), *reqBody.Archived, actorId, reqBody.ID,
+		); err != nil {
+			slog.ErrorContext(r.Context(), "failed to update compound archived flag", "compound_id", reqBody.ID, "archived", *reqBody.Archived, "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.COMPOUND_UPDATE_ERR)
+			return
+		}
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
 		"compound_id": reqBody.ID,
 	})
 }
 
-func validateUpdateCompoundReq(reqBody *UpdateCompoundReq) utils.ErrorMessage {
+func validateUpdateCompoundReq(ctx context.Context, reqBody *UpdateCompoundReq) utils.ErrorMessage {
 	if reqBody.ID == "" {
-		slog.Warn("missing required field", "field", "id")
+		slog.WarnContext(ctx, "missing required field", "field", "id")
 		return utils.MISSING_REQUIRED_FIELDS
 	}
 
-	compoundExists, err := utils.CheckIfCompoundExists(reqBody.ID)
+	if reqBody.MinStock != nil && *reqBody.MinStock < 0 {
+		slog.WarnContext(ctx, "invalid minimum stock", "min_stock", *reqBody.MinStock)
+		return utils.INVALID_MIN_STOCK
+	}
+
+	if reqBody.MaxIncoming != nil && *reqBody.MaxIncoming < 0 {
+		slog.WarnContext(ctx, "invalid max incoming", "max_incoming", *reqBody.MaxIncoming)
+		return utils.INVALID_MAX_INCOMING
+	}
+
+	for _, field := range []*string{reqBody.CasNo, reqBody.Formula, reqBody.StorageLocation, reqBody.HazardClass} {
+		if field != nil {
+			*field = strings.TrimSpace(*field)
+		}
+	}
+	casNo := ""
+	if reqBody.CasNo != nil {
+		casNo = *reqBody.CasNo
+	}
+	molecularWeight := reqBody.MolecularWeight
+	if molecularWeight != nil && *molecularWeight == 0 {
+		// Clears the molecular weight rather than being one
+		molecularWeight = nil
+	}
+	if errStr := validateChemicalData(ctx, casNo, molecularWeight); errStr != utils.NO_ERR {
+		return errStr
+	}
+
+	compoundExists, err := utils.CheckIfCompoundExists(ctx, reqBody.ID)
 	if err != nil {
-		slog.Error("failed to check compound existence", "compound_id", reqBody.ID, "error", err)
+		slog.ErrorContext(ctx, "failed to check compound existence", "compound_id", reqBody.ID, "error", err)
 		return utils.COMPOUND_ID_CHECK_ERR
 	}
 
 	if !compoundExists {
-		slog.Warn("compound does not exist", "compound_id", reqBody.ID)
+		slog.WarnContext(ctx, "compound does not exist", "compound_id", reqBody.ID)
 		return utils.INVALID_COMPOUND_ID
 	}
 
 	return utils.NO_ERR
 }
 
-func getCompoundScale(compoundId string) (string, error) {
+func getCompoundScale(ctx context.Context, compoundId string) (string, error) {
 	var scale string
-	err := utils.IfErrRetry(func() error {
-		return db.Conn.QueryRow("SELECT scale FROM compound WHERE id = ?", compoundId).Scan(&scale)
+	err := retry.Once(func() error {
+		return db.ConnFrom(ctx).QueryRowContext(ctx, "SELECT scale FROM compound WHERE id = ?", compoundId).Scan(&scale)
 	})
 	if err != nil {
 		return "", err
@@ -122,10 +286,10 @@ func getCompoundScale(compoundId string) (string, error) {
 	return scale, nil
 }
 
-func getCompoundName(compoundId string) (string, error) {
+func getCompoundName(ctx context.Context, compoundId string) (string, error) {
 	var name string
-	err := utils.IfErrRetry(func() error {
-		return db.Conn.QueryRow("SELECT name FROM compound WHERE id = ?", compoundId).Scan(&name)
+	err := retry.Once(func() error {
+		return db.ConnFrom(ctx).QueryRowContext(ctx, "SELECT name FROM compound WHERE id = ?", compoundId).Scan(&name)
 	})
 	if err != nil {
 		return "", err
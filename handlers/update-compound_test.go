@@ -0,0 +1,52 @@
+package handlers_test
+
+import (
+	"chemical-ledger-backend/handlers"
+	"chemical-ledger-backend/testutils"
+	"chemical-ledger-backend/utils"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The scale only changes while nothing is recorded in it, and only to a unit of the units table
+func TestScaleChangeIsRefusedOnceRecorded(t *testing.T) {
+	t.Parallel()
+	env := testutils.NewEnv(t, time.Date(2026, 3, 14, 10, 0, 0, 0, time.Local))
+
+	env.InsertCompound("C_1", "Acetone", "g")
+	update := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handlers.UpdateCompoundHandler(w, env.Request(http.MethodPut, "/update-compound", strings.NewReader(body)))
+		return w
+	}
+	scale := func() string {
+		var scale string
+		if err := env.DB.QueryRow("SELECT scale FROM compound WHERE id = 'C_1'").Scan(&scale); err != nil {
+			t.Fatal(err)
+		}
+		return scale
+	}
+
+	if w := update(`{"id": "C_1", "name": "Acetone", "scale": "buckets"}`); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), string(utils.INVALID_SCALE_ERR)) {
+		t.Errorf("unknown scale: status %d, %s", w.Code, w.Body)
+	}
+	if w := update(`{"id": "C_1", "name": "Acetone", "scale": "millilitres"}`); w.Code != http.StatusOK {
+		t.Fatalf("scale of a compound without entries: status %d, %s", w.Code, w.Body)
+	}
+	if got := scale(); got != "ml" {
+		t.Errorf("scale %q, want ml", got)
+	}
+
+	if w := insertEntry(env, utils.ENTRY_TYPE_INCOMING, "C_1", "2026-03-10", 100); w.Code != http.StatusOK {
+		t.Fatalf("delivery: status %d, %s", w.Code, w.Body)
+	}
+	if w := update(`{"id": "C_1", "name": "Acetone", "scale": "l"}`); w.Code != http.StatusNotAcceptable || !strings.Contains(w.Body.String(), string(utils.COMPOUND_SCALE_IN_USE)) {
+		t.Errorf("scale of a compound with entries: status %d, %s", w.Code, w.Body)
+	}
+	if got := scale(); got != "ml" {
+		t.Errorf("scale %q after the refused change, want ml", got)
+	}
+}
@@ -1,45 +1,180 @@
 package handlers
 
 import (
+	"bytes"
+	"chemical-ledger-backend/datetime"
 	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/stock"
 	"chemical-ledger-backend/utils"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
 	"log/slog"
 	"net/http"
-	"sync"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// Updates must name the version of the entry they change (see GetEntryHistoryHandler), so that of two users editing
+// the same entry the second one is refused instead of silently overwriting the first. Only full updates sent without
+// one, as the desktop frontend sends them, are applied to whatever version the entry is at.
 type UpdateEntryReq struct {
 	InsertEntryReq
-	Id string `json:"id"`
+	Id      string `json:"id"`
+	Version int    `json:"version"`
 }
 
+var errStaleEntryVersion = errors.New("entry changed since the version the update was made from")
+
 func UpdateEntryHandler(w http.ResponseWriter, r *http.Request) {
 	reqBody := &UpdateEntryReq{}
-	if errStr := utils.DecodeJsonReq(r, reqBody); errStr != utils.NO_ERR {
-		slog.Error("failed to decode JSON request", "error", errStr)
-		utils.RespWithError(w, http.StatusBadRequest, errStr)
+	if errStr := httpx.DecodeJsonReq(r, reqBody); errStr != utils.NO_ERR {
+		slog.ErrorContext(r.Context(), "failed to decode JSON request", "error", errStr)
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	if errStr := validateUpdateEntryReq(r.Context(), reqBody); errStr != utils.NO_ERR {
+		slog.ErrorContext(r.Context(), "invalid update entry request", "entry_id", reqBody.Id, "error", errStr)
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	// The frontend shipped with the application does not send versions yet
+	if status, errStr := readEntryVersionPrecondition(r, reqBody, false); errStr != utils.NO_ERR {
+		httpx.RespWithError(w, status, errStr)
 		return
 	}
 
-	if errStr := validateUpdateEntryReq(reqBody); errStr != utils.NO_ERR {
-		slog.Error("invalid update entry request", "entry_id", reqBody.Id, "error", errStr)
-		utils.RespWithError(w, http.StatusBadRequest, errStr)
+	if status, errStr := updateEntry(r.Context(), reqBody, currentUser(r).Id); errStr != utils.NO_ERR {
+		httpx.RespWithError(w, status, errStr)
 		return
 	}
 
-	compoundValid, err := utils.CheckIfCompoundExists(reqBody.CompoundId)
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"entry_id": reqBody.Id,
+		"version":  reqBody.Version + 1,
+	})
+}
+
+// Updates only the fields sent along with the "id", e.g. {"id": "E_1", "remark": "..."}; the other fields keep
+// their current values. The merged entry is validated and applied like a full update.
+func PatchEntryHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		slog.Error("error checking compound existence", "compound_id", reqBody.CompoundId, "error", err)
-		utils.RespWithError(w, http.StatusInternalServerError, utils.COMPOUND_ID_CHECK_ERR)
+		slog.ErrorContext(r.Context(), "failed to read request body", "error", err)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.REQUEST_BODY_DECODE_ERR)
 		return
 	}
-	if !compoundValid {
-		slog.Warn("compound not found", "compound_id", reqBody.CompoundId)
-		utils.RespWithError(w, http.StatusNotFound, utils.INVALID_COMPOUND_ID)
+
+	var target struct {
+		Id string `json:"id"`
+	}
+	if err := json.Unmarshal(body, &target); err != nil {
+		slog.ErrorContext(r.Context(), "failed to decode JSON request", "error", err)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.REQUEST_BODY_DECODE_ERR)
+		return
+	}
+	if target.Id == "" {
+		slog.WarnContext(r.Context(), "missing required field", "field", "id")
+		httpx.RespWithError(w, http.StatusBadRequest, utils.MISSING_REQUIRED_FIELDS)
+		return
+	}
+
+	current, err := readEntryVersionData(r.Context(), db.ConnFrom(r.Context()).QueryRowContext, target.Id)
+	if err == sql.ErrNoRows {
+		slog.WarnContext(r.Context(), "entry not found", "entry_id", target.Id)
+		httpx.RespWithError(w, http.StatusNotFound, utils.INVALID_ENTRY_ID)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error retrieving entry", "entry_id", target.Id, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.ENTRY_RETRIEVAL_ERR)
+		return
+	}
+
+	// Decoding onto the current values only replaces the fields present in the body
+	reqBody := &UpdateEntryReq{InsertEntryReq: *current}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if errStr := httpx.DecodeJsonReq(r, reqBody); errStr != utils.NO_ERR {
+		slog.ErrorContext(r.Context(), "failed to decode JSON request", "error", errStr)
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	if errStr := validateUpdateEntryReq(r.Context(), reqBody); errStr != utils.NO_ERR {
+		slog.ErrorContext(r.Context(), "invalid patch entry request", "entry_id", reqBody.Id, "error", errStr)
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	if status, errStr := readEntryVersionPrecondition(r, reqBody, true); errStr != utils.NO_ERR {
+		httpx.RespWithError(w, status, errStr)
+		return
+	}
+
+	if status, errStr := updateEntry(r.Context(), reqBody, currentUser(r).Id); errStr != utils.NO_ERR {
+		httpx.RespWithError(w, status, errStr)
 		return
 	}
 
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"entry_id": reqBody.Id,
+		"version":  reqBody.Version + 1,
+	})
+}
+
+// Reads the version of the entry an update was made from into "Version": the "If-Match" header, e.g. "3" (quotes
+// optional), takes precedence over the "version" field of the body. Without either "Version" stays 0, the current
+// version, unless a version is required.
+// Returns the status code to answer with when neither holds a required version.
+func readEntryVersionPrecondition(r *http.Request, reqBody *UpdateEntryReq, required bool) (int, utils.ErrorMessage) {
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+		version, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(ifMatch, "W/"), `"`))
+		if err != nil || version <= 0 {
+			slog.WarnContext(r.Context(), "invalid If-Match header", "if_match", ifMatch)
+			return http.StatusBadRequest, utils.ENTRY_VERSION_REQUIRED
+		}
+		reqBody.Version = version
+	}
+
+	if reqBody.Version < 0 || (required && reqBody.Version == 0) {
+		slog.WarnContext(r.Context(), "missing entry version", "entry_id", reqBody.Id, "version", reqBody.Version)
+		return http.StatusPreconditionRequired, utils.ENTRY_VERSION_REQUIRED
+	}
+	return http.StatusOK, utils.NO_ERR
+}
+
+// Applies a validated update to an entry, keeping its previous state as a new version, and recalculates the stock
+// when the update changes it. The update is refused with 409 when the entry is no longer at "Version"; with "Version"
+// 0 it applies to the current version, which is set in its place.
+// Returns the status code to answer with when it fails.
+func updateEntry(ctx context.Context, reqBody *UpdateEntryReq, actorId string) (int, utils.ErrorMessage) {
+	compoundValid, err := utils.CheckIfCompoundExists(ctx, reqBody.CompoundId)
+	if err != nil {
+		slog.ErrorContext(ctx, "error checking compound existence", "compound_id", reqBody.CompoundId, "error", err)
+		return http.StatusInternalServerError, utils.COMPOUND_ID_CHECK_ERR
+	}
+	if !compoundValid {
+		slog.WarnContext(ctx, "compound not found", "compound_id", reqBody.CompoundId)
+		return http.StatusNotFound, utils.INVALID_COMPOUND_ID
+	}
+
+	if status, errStr := convertEntryUnit(ctx, &reqBody.InsertEntryReq); errStr != utils.NO_ERR {
+		return status, errStr
+	}
+
+	unlock, err := stock.LockEntryCompounds(ctx, []string{reqBody.Id}, reqBody.CompoundId)
+	if err != nil {
+		slog.ErrorContext(ctx, "error locking compounds of entry", "entry_id", reqBody.Id, "error", err)
+		return http.StatusInternalServerError, utils.ENTRY_RETRIEVAL_ERR
+	}
+	defer unlock()
+
 	var oldEntry struct {
 		Id         string
 		Type       string
@@ -47,118 +182,245 @@ func UpdateEntryHandler(w http.ResponseWriter, r *http.Request) {
 		QuantityId string
 		Date       int64
 	}
-	if err := db.Conn.QueryRow(
-		"SELECT id, type, compound_id, quantity_id, date FROM entry WHERE id = ?",
+	if err := db.ConnFrom(ctx).QueryRowContext(ctx,
+		"SELECT id, type, compound_id, quantity_id, date FROM entry WHERE id = ? AND deleted_at IS NULL",
 		reqBody.Id,
 	).Scan(&oldEntry.Id, &oldEntry.Type, &oldEntry.CompoundId, &oldEntry.QuantityId, &oldEntry.Date); err != nil {
-		slog.Error("error retrieving entry", "entry_id", reqBody.Id, "error", err)
-		utils.RespWithError(w, http.StatusInternalServerError, utils.ENTRY_RETRIEVAL_ERR)
-		return
+		slog.ErrorContext(ctx, "error retrieving entry", "entry_id", reqBody.Id, "error", err)
+		return http.StatusInternalServerError, utils.ENTRY_RETRIEVAL_ERR
 	}
 
-	currTxQuantity := reqBody.NumOfUnits * reqBody.QuantityPerUnit
-	entryDate, err := utils.MergeDateWithUnixTime(reqBody.Date, oldEntry.Date)
+	entryDate, err := datetime.MergeDateWithUnixTime(reqBody.Date, oldEntry.Date)
 	if err != nil {
-		slog.Error("failed to merge date with unix time", "input_date", reqBody.Date, "error", err)
-		utils.RespWithError(w, http.StatusInternalServerError, utils.INVALID_DATE_FORMAT)
-		return
+		slog.ErrorContext(ctx, "failed to merge date with unix time", "input_date", reqBody.Date, "error", err)
+		return http.StatusInternalServerError, utils.INVALID_DATE_FORMAT
+	}
+
+	// Moving an entry out of a locked month changes that month as much as moving one into it
+	if status, errStr := checkEntryDatesUnlocked(ctx, oldEntry.Date, entryDate); errStr != utils.NO_ERR {
+		return status, errStr
 	}
 
-	tx, err := db.Conn.Begin()
+	tx, err := db.ConnFrom(ctx).BeginTx(ctx, nil)
 	if err != nil {
-		slog.Error("failed to begin transaction", "error", err)
-		utils.RespWithError(w, http.StatusInternalServerError, utils.TX_START_ERR)
-		return
+		slog.ErrorContext(ctx, "failed to begin transaction", "error", err)
+		return http.StatusInternalServerError, utils.TX_START_ERR
 	}
 	defer tx.Rollback()
 
-	if _, err = tx.Exec(
-		"UPDATE quantity SET num_of_units = ?, quantity_per_unit = ? WHERE id = ?",
-		reqBody.NumOfUnits, reqBody.QuantityPerUnit, oldEntry.QuantityId); err != nil {
-		slog.Error("failed to update quantity", "quantity_id", oldEntry.QuantityId, "error", err)
-		utils.RespWithError(w, http.StatusInternalServerError, utils.UPDATE_ENTRY_ERR)
-		return
+	previous, err := readEntryVersionData(ctx, tx.QueryRowContext, reqBody.Id)
+	if err != nil {
+		slog.ErrorContext(ctx, "error retrieving entry", "entry_id", reqBody.Id, "error", err)
+		return http.StatusInternalServerError, utils.ENTRY_RETRIEVAL_ERR
+	}
+	if reqBody.Version == 0 {
+		if err := tx.QueryRowContext(ctx,
+			"SELECT COALESCE(MAX(version), 0) + 1 FROM entry_version WHERE entry_id = ?", reqBody.Id,
+		).Scan(&reqBody.Version); err != nil {
+			slog.ErrorContext(ctx, "error retrieving entry version", "entry_id", reqBody.Id, "error", err)
+			return http.StatusInternalServerError, utils.ENTRY_VERSION_ERR
+		}
+	}
+	err = saveEntryVersion(ctx, tx, reqBody.Id, reqBody.Version, previous, actorId)
+	if err == errStaleEntryVersion {
+		slog.WarnContext(ctx, "entry changed since it was loaded", "entry_id", reqBody.Id, "version", reqBody.Version)
+		return http.StatusConflict, utils.STALE_ENTRY_VERSION
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to save entry version", "entry_id", reqBody.Id, "error", err)
+		return http.StatusInternalServerError, utils.ENTRY_VERSION_ERR
+	}
+
+	if _, err = tx.ExecContext(ctx,
+		"UPDATE quantity SET num_of_units = ?, packs_per_unit = ?, quantity_per_unit = ?, partial_quantity = ? WHERE id = ?",
+		reqBody.NumOfUnits, reqBody.PacksPerUnit, reqBody.QuantityPerUnit, reqBody.PartialQuantity, oldEntry.QuantityId); err != nil {
+		slog.ErrorContext(ctx, "failed to update quantity", "quantity_id", oldEntry.QuantityId, "error", err)
+		return http.StatusInternalServerError, utils.UPDATE_ENTRY_ERR
 	}
 
-	if _, err = tx.Exec(
+	if _, err = tx.ExecContext(ctx,
 		`UPDATE entry 
-		SET type = ?, compound_id = ?, date = ?, remark = ?, voucher_no = ?, quantity_id = ?, net_stock = ? 
+		SET type = ?, compound_id = ?, date = ?, remark = ?, voucher_no = ?, quantity_id = ?, lot_id = NULLIF(?, ''), supplier_id = NULLIF(?, ''), recipient_id = NULLIF(?, ''), reason = NULLIF(?, ''),
+			instrument_id = NULLIF(?, ''), instrument_event = NULLIF(?, ''), disposal_method = NULLIF(?, ''), disposal_authorized_by = NULLIF(?, ''),
+			location_id = NULLIF(?, ''), to_location_id = NULLIF(?, ''), project_id = NULLIF(?, ''), unit_cost = ?, po_line_id = NULLIF(?, '')
 		WHERE id = ?`,
 		reqBody.Type, reqBody.CompoundId, entryDate,
 		reqBody.Remark, reqBody.VoucherNo,
-		oldEntry.QuantityId, currTxQuantity,
+		oldEntry.QuantityId, reqBody.LotId, reqBody.SupplierId, reqBody.RecipientId, reqBody.Reason,
+		reqBody.InstrumentId, reqBody.InstrumentEvent, reqBody.DisposalMethod, reqBody.DisposalAuthorizedBy,
+		reqBody.LocationId, reqBody.ToLocationId, reqBody.ProjectId, reqBody.UnitCost, reqBody.PoLineId,
 		reqBody.Id); err != nil {
-		slog.Error("failed to update entry", "entry_id", reqBody.Id, "error", err)
-		utils.RespWithError(w, http.StatusInternalServerError, utils.UPDATE_ENTRY_ERR)
-		return
+		slog.ErrorContext(ctx, "failed to update entry", "entry_id", reqBody.Id, "error", err)
+		return http.StatusInternalServerError, utils.UPDATE_ENTRY_ERR
 	}
 
-	wg := sync.WaitGroup{}
-	errStrCh := make(chan utils.ErrorMessage, 2)
-
-	if oldEntry.CompoundId != reqBody.CompoundId {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			errStrCh <- utils.UpdateNetStockFromTodayOnwards(tx, oldEntry.CompoundId, oldEntry.Date)
-		}()
+	if utils.IsInwardEntryType(reqBody.Type) {
+		if _, err = tx.ExecContext(ctx,
+			`INSERT INTO lot (id, compound_id, entry_id, lot_no, expiry, supplier)
+			VALUES ('L_' || substr(?, 3), ?, ?, ?, ?, ?)
+			ON CONFLICT(entry_id) DO UPDATE SET lot_no = excluded.lot_no, expiry = excluded.expiry, supplier = excluded.supplier`,
+			reqBody.Id, reqBody.CompoundId, reqBody.Id, reqBody.LotNo, reqBody.Expiry, reqBody.Supplier); err != nil {
+			slog.ErrorContext(ctx, "failed to update lot", "entry_id", reqBody.Id, "error", err)
+			return http.StatusInternalServerError, utils.UPDATE_ENTRY_ERR
+		}
 	}
 
-	errStrCh <- utils.UpdateNetStockFromTodayOnwards(tx, reqBody.CompoundId, entryDate)
-
-	wg.Wait()
-	close(errStrCh)
-
-	for errStr := range errStrCh {
-		if errStr != utils.NO_ERR {
-			slog.Error("failed to update net stock during entry update", "entry_id", reqBody.Id, "error", errStr)
-			utils.RespWithError(w, http.StatusInternalServerError, errStr)
-			return
+	// Changes to the remark, voucher, parties or lot details leave the stock as it is
+	if changesStock(previous, &reqBody.InsertEntryReq) {
+		if errStr := stock.RecalculateAfterEntryChange(ctx, tx, oldEntry.CompoundId, oldEntry.Date, reqBody.CompoundId, entryDate, reqBody.ConfirmShortfall); errStr != utils.NO_ERR {
+			slog.ErrorContext(ctx, "failed to update net stock during entry update", "entry_id", reqBody.Id, "error", errStr)
+			return recalculationErrStatus(errStr), errStr
 		}
 	}
 
 	if err := tx.Commit(); err != nil {
-		slog.Error("failed to commit transaction", "entry_id", reqBody.Id, "error", err)
-		utils.RespWithError(w, http.StatusInternalServerError, utils.COMMIT_TRANSACTION_ERR)
-		return
+		slog.ErrorContext(ctx, "failed to commit transaction", "entry_id", reqBody.Id, "error", err)
+		return http.StatusInternalServerError, utils.COMMIT_TRANSACTION_ERR
 	}
 
-	utils.RespWithData(w, http.StatusOK, map[string]any{
-		"entry_id": reqBody.Id,
-	})
+	return http.StatusOK, utils.NO_ERR
+}
+
+// Status code for an error of the stock recalculation: 406 when the change would leave too little stock
+// (overall, in a lot or unconfirmed within the day), which the user can fix, 500 otherwise
+func recalculationErrStatus(errStr utils.ErrorMessage) int {
+	switch errStr {
+	case utils.INSUFFICIENT_STOCK_ERR, utils.INSUFFICIENT_LOCATION_STOCK_ERR, utils.INSUFFICIENT_LOT_STOCK_ERR, utils.SAME_DAY_STOCK_SHORTFALL_ERR:
+		return http.StatusNotAcceptable
+	}
+	return http.StatusInternalServerError
+}
+
+// Whether an update changes what the entry does to the stock: its type, compound, day, quantity, the lot it is issued
+// from or the locations it moves
+func changesStock(previous *InsertEntryReq, updated *InsertEntryReq) bool {
+	return previous.Type != updated.Type || previous.CompoundId != updated.CompoundId || previous.Date != updated.Date ||
+		previous.NumOfUnits != updated.NumOfUnits || previous.PacksPerUnit != updated.PacksPerUnit ||
+		previous.QuantityPerUnit != updated.QuantityPerUnit || previous.PartialQuantity != updated.PartialQuantity ||
+		previous.LotId != updated.LotId || previous.LocationId != updated.LocationId || previous.ToLocationId != updated.ToLocationId
 }
 
-func validateUpdateEntryReq(reqBody *UpdateEntryReq) utils.ErrorMessage {
+func validateUpdateEntryReq(ctx context.Context, reqBody *UpdateEntryReq) utils.ErrorMessage {
 	if reqBody.Id == "" {
-		slog.Warn("missing required field", "field", "id")
+		slog.WarnContext(ctx, "missing required field", "field", "id")
 		return utils.MISSING_REQUIRED_FIELDS
 	}
 
-	if reqBody.Type != utils.ENTRY_TYPE_INCOMING && reqBody.Type != utils.ENTRY_TYPE_OUTGOING {
-		slog.Warn("invalid entry type", "received", reqBody.Type)
+	if !utils.IsValidEntryType(reqBody.Type) {
+		slog.WarnContext(ctx, "invalid entry type", "received", reqBody.Type)
 		return utils.INVALID_ENTRY_TYPE
 	}
 
-	if reqBody.NumOfUnits <= 0 || reqBody.QuantityPerUnit <= 0 || reqBody.CompoundId == "" {
-		slog.Warn("missing required numeric fields or compound ID", "num_of_units", reqBody.NumOfUnits, "quantity_per_unit", reqBody.QuantityPerUnit, "compound_id", reqBody.CompoundId)
+	if errStr := validateReasonField(ctx, &reqBody.InsertEntryReq); errStr != utils.NO_ERR {
+		return errStr
+	}
+
+	if errStr := validateDisposalFields(ctx, &reqBody.InsertEntryReq); errStr != utils.NO_ERR {
+		return errStr
+	}
+
+	if ((reqBody.NumOfUnits <= 0 || reqBody.QuantityPerUnit <= 0) && reqBody.PartialQuantity <= 0) || reqBody.CompoundId == "" {
+		slog.WarnContext(ctx, "missing required numeric fields or compound ID", "num_of_units", reqBody.NumOfUnits, "quantity_per_unit", reqBody.QuantityPerUnit, "partial_quantity", reqBody.PartialQuantity, "compound_id", reqBody.CompoundId)
 		return utils.MISSING_REQUIRED_FIELDS
 	}
 
 	if _, err := time.Parse("2006-01-02", reqBody.Date); err != nil {
-		slog.Warn("invalid date format", "input_date", reqBody.Date, "error", err)
+		slog.WarnContext(ctx, "invalid date format", "input_date", reqBody.Date, "error", err)
 		return utils.INVALID_DATE_FORMAT
 	}
 
+	if errStr := validatePackagingField(ctx, &reqBody.InsertEntryReq); errStr != utils.NO_ERR {
+		return errStr
+	}
+
+	if errStr := validateLotFields(ctx, &reqBody.InsertEntryReq); errStr != utils.NO_ERR {
+		return errStr
+	}
+
+	if errStr := validateSupplierField(ctx, &reqBody.InsertEntryReq); errStr != utils.NO_ERR {
+		return errStr
+	}
+
+	if errStr := validateRecipientField(ctx, &reqBody.InsertEntryReq); errStr != utils.NO_ERR {
+		return errStr
+	}
+
+	if errStr := validateInstrumentFields(ctx, &reqBody.InsertEntryReq); errStr != utils.NO_ERR {
+		return errStr
+	}
+
 	var entryExists bool
-	if err := db.Conn.QueryRow("SELECT EXISTS(SELECT 1 FROM entry WHERE id = ?)", reqBody.Id).Scan(&entryExists); err != nil {
-		slog.Error("error checking entry existence", "entry_id", reqBody.Id, "error", err)
+	if err := db.ConnFrom(ctx).QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM entry WHERE id = ? AND deleted_at IS NULL)", reqBody.Id).Scan(&entryExists); err != nil {
+		slog.ErrorContext(ctx, "error checking entry existence", "entry_id", reqBody.Id, "error", err)
 		return utils.ENTRY_RETRIEVAL_ERR
 	}
 
 	if !entryExists {
-		slog.Warn("entry not found", "entry_id", reqBody.Id)
+		slog.WarnContext(ctx, "entry not found", "entry_id", reqBody.Id)
 		return utils.INVALID_ENTRY_ID
 	}
 
 	return utils.NO_ERR
 }
+
+// Reads an entry as the fields of an update, so that a version can be stored and later applied again.
+// "queryRow" is the QueryRowContext of the connection or of a transaction.
+func readEntryVersionData(ctx context.Context, queryRow func(ctx context.Context, query string, args ...any) *sql.Row, entryId string) (*InsertEntryReq, error) {
+	data := &InsertEntryReq{}
+	var date int64
+	err := queryRow(ctx, `
+		SELECT
+			e.type, e.compound_id, e.date, COALESCE(e.remark, ''), COALESCE(e.voucher_no, ''),
+			q.num_of_units, q.packs_per_unit, q.quantity_per_unit, q.partial_quantity,
+			COALESCE(l.lot_no, ''), COALESCE(l.expiry, ''), COALESCE(l.supplier, ''),
+			COALESCE(e.lot_id, ''), COALESCE(e.supplier_id, ''), COALESCE(e.recipient_id, ''), COALESCE(e.reason, ''),
+			COALESCE(e.instrument_id, ''), COALESCE(e.instrument_event, ''),
+			COALESCE(e.disposal_method, ''), COALESCE(e.disposal_authorized_by, ''),
+			COALESCE(e.location_id, ''), COALESCE(e.to_location_id, ''), COALESCE(e.project_id, ''), e.unit_cost, COALESCE(e.po_line_id, '')
+		FROM entry e
+		JOIN quantity q ON e.quantity_id = q.id
+		LEFT JOIN lot l ON l.entry_id = e.id
+		WHERE e.id = ?`,
+		entryId,
+	).Scan(
+		&data.Type, &data.CompoundId, &date, &data.Remark, &data.VoucherNo,
+		&data.NumOfUnits, &data.PacksPerUnit, &data.QuantityPerUnit, &data.PartialQuantity,
+		&data.LotNo, &data.Expiry, &data.Supplier,
+		&data.LotId, &data.SupplierId, &data.RecipientId, &data.Reason,
+		&data.InstrumentId, &data.InstrumentEvent,
+		&data.DisposalMethod, &data.DisposalAuthorizedBy,
+		&data.LocationId, &data.ToLocationId, &data.ProjectId, &data.UnitCost, &data.PoLineId,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Dates are entered as IST days, see datetime.MergeDateWithUnixTime
+	data.Date = time.Unix(date, 0).In(time.FixedZone("IST", 5*60*60+30*60)).Format("2006-01-02")
+	return data, nil
+}
+
+// Stores the current state of an entry, as read by readEntryVersionData, as the given version before it is changed.
+// Returns errStaleEntryVersion when the entry is no longer at that version, so the check and the write are one statement.
+func saveEntryVersion(ctx context.Context, tx *sql.Tx, entryId string, version int, data *InsertEntryReq, actorId string) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO entry_version (entry_id, version, data, replaced_by, replaced_at)
+		SELECT ?, ?, ?, NULLIF(?, ''), ?
+		WHERE (SELECT COALESCE(MAX(version), 0) + 1 FROM entry_version WHERE entry_id = ?) = ?`,
+		entryId, version, string(raw), actorId, datetime.Now(ctx).Unix(), entryId, version,
+	)
+	if err != nil {
+		return err
+	}
+	if saved, err := result.RowsAffected(); err != nil {
+		return err
+	} else if saved == 0 {
+		return errStaleEntryVersion
+	}
+	return nil
+}
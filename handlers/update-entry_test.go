@@ -0,0 +1,93 @@
+package handlers_test
+
+import (
+	"chemical-ledger-backend/handlers"
+	"chemical-ledger-backend/testutils"
+	"chemical-ledger-backend/utils"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Changing only the quantity of a delivery is saved and carried into the entries after it, unless it leaves too
+// little for them, in which case nothing changes
+func TestQuantityEditIsSavedAndRecalculated(t *testing.T) {
+	t.Parallel()
+	env := testutils.NewEnv(t, time.Date(2026, 3, 14, 10, 0, 0, 0, time.Local))
+
+	env.InsertCompound("C_1", "Acetone", "ml")
+	if w := insertEntry(env, utils.ENTRY_TYPE_INCOMING, "C_1", "2026-03-10", 100); w.Code != http.StatusOK {
+		t.Fatalf("delivery: status %d, %s", w.Code, w.Body)
+	}
+	if w := insertEntry(env, utils.ENTRY_TYPE_OUTGOING, "C_1", "2026-03-12", 60); w.Code != http.StatusOK {
+		t.Fatalf("issue: status %d, %s", w.Code, w.Body)
+	}
+	var deliveryId string
+	if err := env.DB.QueryRow("SELECT id FROM entry WHERE type = ?", utils.ENTRY_TYPE_INCOMING).Scan(&deliveryId); err != nil {
+		t.Fatal(err)
+	}
+
+	update := func(version int, quantity int) *httptest.ResponseRecorder {
+		body := fmt.Sprintf(
+			`{"id": %q, "version": %d, "type": %q, "compound_id": "C_1", "date": "2026-03-10", "num_of_units": 1, "quantity_per_unit": %d}`,
+			deliveryId, version, utils.ENTRY_TYPE_INCOMING, quantity,
+		)
+		w := httptest.NewRecorder()
+		handlers.UpdateEntryHandler(w, env.Request(http.MethodPut, "/update-entry", strings.NewReader(body)))
+		return w
+	}
+	state := func() (quantity int, issueStock int, balance int) {
+		if err := env.DB.QueryRow(
+			"SELECT q.quantity_per_unit FROM entry e JOIN quantity q ON q.id = e.quantity_id WHERE e.id = ?", deliveryId,
+		).Scan(&quantity); err != nil {
+			t.Fatal(err)
+		}
+		if err := env.DB.QueryRow("SELECT net_stock FROM entry WHERE type = ?", utils.ENTRY_TYPE_OUTGOING).Scan(&issueStock); err != nil {
+			t.Fatal(err)
+		}
+		if err := env.DB.QueryRow("SELECT balance FROM stock_current WHERE compound_id = 'C_1'").Scan(&balance); err != nil {
+			t.Fatal(err)
+		}
+		return quantity, issueStock, balance
+	}
+
+	if w := update(1, 250); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"version":2`) {
+		t.Fatalf("raising the delivery: status %d, %s", w.Code, w.Body)
+	}
+	if quantity, issueStock, balance := state(); quantity != 250 || issueStock != 190 || balance != 190 {
+		t.Errorf("after raising the delivery: quantity %d, stock after the issue %d, current stock %d, want 250, 190, 190", quantity, issueStock, balance)
+	}
+	env.AssertNetStock("C_1")
+
+	// 50 delivered cannot cover the 60 issued after it
+	if w := update(2, 50); w.Code != http.StatusNotAcceptable || !strings.Contains(w.Body.String(), string(utils.INSUFFICIENT_STOCK_ERR)) {
+		t.Fatalf("shortfall: status %d, %s", w.Code, w.Body)
+	}
+	if quantity, issueStock, balance := state(); quantity != 250 || issueStock != 190 || balance != 190 {
+		t.Errorf("after the refused edit: quantity %d, stock after the issue %d, current stock %d, want it unchanged", quantity, issueStock, balance)
+	}
+	// The refused edit left no version behind, so the entry is still at version 2
+	if w := update(2, 80); w.Code != http.StatusOK {
+		t.Errorf("edit after the refused one: status %d, %s", w.Code, w.Body)
+	}
+	env.AssertNetStock("C_1")
+
+	// Full updates without a version, as the frontend sends them, apply to the current version; partial ones are refused
+	if w := update(0, 90); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"version":4`) {
+		t.Errorf("full update without a version: status %d, %s", w.Code, w.Body)
+	}
+	if quantity, issueStock, balance := state(); quantity != 90 || issueStock != 30 || balance != 30 {
+		t.Errorf("after the update without a version: quantity %d, stock after the issue %d, current stock %d, want 90, 30, 30", quantity, issueStock, balance)
+	}
+	if w := update(3, 100); w.Code != http.StatusConflict {
+		t.Errorf("edit of the version replaced without one: status %d, %s", w.Code, w.Body)
+	}
+	w := httptest.NewRecorder()
+	handlers.PatchEntryHandler(w, env.Request(http.MethodPatch, "/update-entry", strings.NewReader(fmt.Sprintf(`{"id": %q, "remark": "checked"}`, deliveryId))))
+	if w.Code != http.StatusPreconditionRequired {
+		t.Errorf("partial update without a version: status %d, %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"context"
+	"log/slog"
+	"net/http"
+)
+
+type UpdateInstrumentReq struct {
+	ID string `json:"id"`
+	InsertInstrumentReq
+}
+
+func UpdateInstrumentHandler(w http.ResponseWriter, r *http.Request) {
+	reqBody := &UpdateInstrumentReq{}
+	if errStr := httpx.DecodeJsonReq(r, reqBody); errStr != utils.NO_ERR {
+		slog.ErrorContext(r.Context(), "failed to decode JSON request", "error", errStr)
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	if errStr := validateInstrumentIdField(r.Context(), reqBody.ID); errStr != utils.NO_ERR {
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	lowerCasedName := utils.GetLowerCasedCompoundName(reqBody.Name)
+	if reqBody.Name != "" {
+		var nameTaken bool
+		if err := db.ConnFrom(r.Context()).QueryRowContext(r.Context(),
+			"SELECT EXISTS(SELECT 1 FROM instrument WHERE lower_case_name = ? AND id != ?)",
+			lowerCasedName, reqBody.ID,
+		).Scan(&nameTaken); err != nil {
+			slog.ErrorContext(r.Context(), "failed to check instrument name", "instrument_name", reqBody.Name, "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.INSTRUMENT_RETRIEVAL_ERR)
+			return
+		}
+		if nameTaken {
+			slog.WarnContext(r.Context(), "instrument name already exists", "name", reqBody.Name)
+			httpx.RespWithError(w, http.StatusNotAcceptable, utils.INSTRUMENT_ALREADY_EXISTS)
+			return
+		}
+	}
+
+	if _, err := db.ConnFrom(r.Context()).ExecContext(r.Context(), `
+		UPDATE instrument
+		SET
+			name = CASE WHEN ? != '' THEN ? ELSE name END,
+			lower_case_name = CASE WHEN ? != '' THEN ? ELSE lower_case_name END,
+			model = ?, serial_no = ?, location = ?
+		WHERE id = ?`,
+		reqBody.Name, reqBody.Name,
+		reqBody.Name, lowerCasedName,
+		reqBody.Model, reqBody.SerialNo, reqBody.Location,
+		reqBody.ID,
+	); err != nil {
+		slog.ErrorContext(r.Context(), "failed to update instrument", "instrument_id", reqBody.ID, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.INSTRUMENT_UPDATE_ERR)
+		return
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"instrument_id": reqBody.ID,
+	})
+}
+
+func validateInstrumentIdField(ctx context.Context, id string) utils.ErrorMessage {
+	if id == "" {
+		slog.WarnContext(ctx, "missing required field", "field", "id")
+		return utils.MISSING_REQUIRED_FIELDS
+	}
+
+	instrumentExists, err := utils.CheckIfInstrumentExists(ctx, id)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to check instrument existence", "instrument_id", id, "error", err)
+		return utils.INSTRUMENT_RETRIEVAL_ERR
+	}
+	if !instrumentExists {
+		slog.WarnContext(ctx, "instrument does not exist", "instrument_id", id)
+		return utils.INVALID_INSTRUMENT_ID
+	}
+
+	return utils.NO_ERR
+}
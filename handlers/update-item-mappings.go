@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/datetime"
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type UpdateItemMappingsReq struct {
+	Mappings []ItemMapping `json:"mappings"`
+}
+
+// Maps item codes of an inbound source to compounds, replacing the earlier mapping of the codes listed and leaving
+// the others. A unit must be of the kind of the compound's scale. Admins only; every change is audited.
+func UpdateItemMappingsHandler(w http.ResponseWriter, r *http.Request) {
+	source := chi.URLParam(r, "source")
+	if !utils.ValidInboundSource(source) {
+		slog.WarnContext(r.Context(), "invalid inbound source", "source", source)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.INVALID_INBOUND_SOURCE)
+		return
+	}
+
+	reqBody := &UpdateItemMappingsReq{}
+	if errStr := httpx.DecodeJsonReq(r, reqBody); errStr != utils.NO_ERR {
+		slog.ErrorContext(r.Context(), "failed to decode JSON request", "error", errStr)
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+	if len(reqBody.Mappings) == 0 {
+		slog.WarnContext(r.Context(), "no item mappings sent", "source", source)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.INVALID_ITEM_MAPPING)
+		return
+	}
+
+	for i := range reqBody.Mappings {
+		if status, errStr := validateItemMapping(r.Context(), &reqBody.Mappings[i]); errStr != utils.NO_ERR {
+			httpx.RespWithError(w, status, utils.ErrorMessage(fmt.Sprintf("%s (item_code %q)", errStr, reqBody.Mappings[i].ItemCode)))
+			return
+		}
+	}
+
+	tx, err := db.ConnFrom(r.Context()).BeginTx(r.Context(), nil)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error starting transaction", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.TX_START_ERR)
+		return
+	}
+	defer tx.Rollback()
+
+	actorId := currentUser(r).Id
+	now := datetime.Now(r.Context()).Unix()
+	itemCodes := []string{}
+	for i := range reqBody.Mappings {
+		mapping := &reqBody.Mappings[i]
+		mapping.UpdatedBy, mapping.UpdatedAt = actorId, now
+		if _, err := tx.ExecContext(r.Context(), `
+			INSERT INTO item_mapping (source, item_code, compound_id, unit, quantity_per_unit, updated_by, updated_at)
+			VALUES (?, ?, ?, NULLIF(?, ''), ?, ?, ?)
+			ON CONFLICT(source, item_code) DO UPDATE SET
+				compound_id = excluded.compound_id, unit = excluded.unit, quantity_per_unit = excluded.quantity_per_unit,
+				updated_by = excluded.updated_by, updated_at = excluded.updated_at`,
+			source, mapping.ItemCode, mapping.CompoundId, mapping.Unit, mapping.QuantityPerUnit, actorId, now,
+		); err != nil {
+			slog.ErrorContext(r.Context(), "failed to save item mapping", "source", source, "item_code", mapping.ItemCode, "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.ITEM_MAPPING_UPDATE_ERR)
+			return
+		}
+		itemCodes = append(itemCodes, mapping.ItemCode)
+	}
+
+	utils.RecordAudit(r.Context(), tx, actorId, "item_mapping.update", utils.AUDIT_TARGET_ITEM_MAPPING, source, map[string]any{
+		"mappings": reqBody.Mappings,
+	})
+
+	if err := tx.Commit(); err != nil {
+		slog.ErrorContext(r.Context(), "error committing transaction", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.COMMIT_TRANSACTION_ERR)
+		return
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"source":     source,
+		"item_codes": itemCodes,
+	})
+}
+
+// Checks a mapping and stores its unit by short name. Returns the status code to answer with when it is invalid.
+func validateItemMapping(ctx context.Context, mapping *ItemMapping) (int, utils.ErrorMessage) {
+	mapping.ItemCode, mapping.CompoundId = strings.TrimSpace(mapping.ItemCode), strings.TrimSpace(mapping.CompoundId)
+	if mapping.ItemCode == "" || mapping.CompoundId == "" || mapping.QuantityPerUnit < 0 {
+		slog.WarnContext(ctx, "invalid item mapping", "item_code", mapping.ItemCode, "compound_id", mapping.CompoundId)
+		return http.StatusBadRequest, utils.INVALID_ITEM_MAPPING
+	}
+
+	compoundExists, err := utils.CheckIfCompoundExists(ctx, mapping.CompoundId)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to check compound existence", "compound_id", mapping.CompoundId, "error", err)
+		return http.StatusInternalServerError, utils.COMPOUND_ID_CHECK_ERR
+	}
+	if !compoundExists {
+		slog.WarnContext(ctx, "item mapped to unknown compound", "item_code", mapping.ItemCode, "compound_id", mapping.CompoundId)
+		return http.StatusNotFound, utils.INVALID_COMPOUND_ID
+	}
+
+	if mapping.Unit == "" {
+		return http.StatusOK, utils.NO_ERR
+	}
+	scale, err := utils.GetCompoundScale(ctx, mapping.CompoundId)
+	if err != nil {
+		slog.ErrorContext(ctx, "error retrieving compound scale", "compound_id", mapping.CompoundId, "error", err)
+		return http.StatusInternalServerError, utils.COMPOUND_RETRIEVAL_ERR
+	}
+	unit, err := utils.ParseQuantityUnit(ctx, mapping.Unit)
+	if err != nil {
+		slog.ErrorContext(ctx, "error retrieving quantity unit", "unit", mapping.Unit, "error", err)
+		return http.StatusInternalServerError, utils.UNIT_RETRIEVAL_ERR
+	}
+	if unit == nil {
+		slog.WarnContext(ctx, "unrecognized quantity unit", "unit", mapping.Unit)
+		return http.StatusBadRequest, utils.INVALID_QUANTITY_UNIT
+	}
+	scaleUnit, err := utils.GetQuantityUnit(ctx, scale)
+	if err != nil || scaleUnit == nil {
+		slog.ErrorContext(ctx, "error retrieving unit of compound scale", "compound_id", mapping.CompoundId, "scale", scale, "error", err)
+		return http.StatusInternalServerError, utils.UNIT_RETRIEVAL_ERR
+	}
+	if unit.Kind != scaleUnit.Kind {
+		slog.WarnContext(ctx, "item mapping unit of the other kind", "unit", unit.Name, "scale", scale)
+		return http.StatusBadRequest, utils.UNIT_SCALE_MISMATCH
+	}
+	mapping.Unit = unit.Name
+	return http.StatusOK, utils.NO_ERR
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"context"
+	"log/slog"
+	"net/http"
+)
+
+type UpdateLocationReq struct {
+	ID string `json:"id"`
+	InsertLocationReq
+}
+
+func UpdateLocationHandler(w http.ResponseWriter, r *http.Request) {
+	reqBody := &UpdateLocationReq{}
+	if errStr := httpx.DecodeJsonReq(r, reqBody); errStr != utils.NO_ERR {
+		slog.ErrorContext(r.Context(), "failed to decode JSON request", "error", errStr)
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	if errStr := validateLocationIdField(r.Context(), reqBody.ID); errStr != utils.NO_ERR {
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	lowerCasedName := utils.GetLowerCasedCompoundName(reqBody.Name)
+	if reqBody.Name != "" {
+		var nameTaken bool
+		if err := db.ConnFrom(r.Context()).QueryRowContext(r.Context(),
+			"SELECT EXISTS(SELECT 1 FROM location WHERE lower_case_name = ? AND id != ?)",
+			lowerCasedName, reqBody.ID,
+		).Scan(&nameTaken); err != nil {
+			slog.ErrorContext(r.Context(), "failed to check location name", "location_name", reqBody.Name, "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.LOCATION_RETRIEVAL_ERR)
+			return
+		}
+		if nameTaken {
+			slog.WarnContext(r.Context(), "location name already exists", "name", reqBody.Name)
+			httpx.RespWithError(w, http.StatusNotAcceptable, utils.LOCATION_ALREADY_EXISTS)
+			return
+		}
+	}
+
+	if _, err := db.ConnFrom(r.Context()).ExecContext(r.Context(), `
+		UPDATE location
+		SET
+			name = CASE WHEN ? != '' THEN ? ELSE name END,
+			lower_case_name = CASE WHEN ? != '' THEN ? ELSE lower_case_name END,
+			description = ?
+		WHERE id = ?`,
+		reqBody.Name, reqBody.Name,
+		reqBody.Name, lowerCasedName,
+		reqBody.Description,
+		reqBody.ID,
+	); err != nil {
+		slog.ErrorContext(r.Context(), "failed to update location", "location_id", reqBody.ID, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.LOCATION_UPDATE_ERR)
+		return
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"location_id": reqBody.ID,
+	})
+}
+
+func validateLocationIdField(ctx context.Context, id string) utils.ErrorMessage {
+	if id == "" {
+		slog.WarnContext(ctx, "missing required field", "field", "id")
+		return utils.MISSING_REQUIRED_FIELDS
+	}
+
+	locationExists, err := utils.CheckIfLocationExists(ctx, id)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to check location existence", "location_id", id, "error", err)
+		return utils.LOCATION_RETRIEVAL_ERR
+	}
+	if !locationExists {
+		slog.WarnContext(ctx, "location does not exist", "location_id", id)
+		return utils.INVALID_LOCATION_ID
+	}
+
+	return utils.NO_ERR
+}
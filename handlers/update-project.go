@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"context"
+	"log/slog"
+	"net/http"
+)
+
+type UpdateProjectReq struct {
+	ID string `json:"id"`
+	InsertProjectReq
+}
+
+func UpdateProjectHandler(w http.ResponseWriter, r *http.Request) {
+	reqBody := &UpdateProjectReq{}
+	if errStr := httpx.DecodeJsonReq(r, reqBody); errStr != utils.NO_ERR {
+		slog.ErrorContext(r.Context(), "failed to decode JSON request", "error", errStr)
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	if errStr := validateProjectIdField(r.Context(), reqBody.ID); errStr != utils.NO_ERR {
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	lowerCasedName := utils.GetLowerCasedCompoundName(reqBody.Name)
+	if reqBody.Name != "" {
+		var nameTaken bool
+		if err := db.ConnFrom(r.Context()).QueryRowContext(r.Context(),
+			"SELECT EXISTS(SELECT 1 FROM project WHERE lower_case_name = ? AND id != ?)",
+			lowerCasedName, reqBody.ID,
+		).Scan(&nameTaken); err != nil {
+			slog.ErrorContext(r.Context(), "failed to check project name", "project_name", reqBody.Name, "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.PROJECT_RETRIEVAL_ERR)
+			return
+		}
+		if nameTaken {
+			slog.WarnContext(r.Context(), "project name already exists", "name", reqBody.Name)
+			httpx.RespWithError(w, http.StatusNotAcceptable, utils.PROJECT_ALREADY_EXISTS)
+			return
+		}
+	}
+
+	if _, err := db.ConnFrom(r.Context()).ExecContext(r.Context(), `
+		UPDATE project
+		SET
+			name = CASE WHEN ? != '' THEN ? ELSE name END,
+			lower_case_name = CASE WHEN ? != '' THEN ? ELSE lower_case_name END,
+			code = ?, lead = ?
+		WHERE id = ?`,
+		reqBody.Name, reqBody.Name,
+		reqBody.Name, lowerCasedName,
+		reqBody.Code, reqBody.Lead,
+		reqBody.ID,
+	); err != nil {
+		slog.ErrorContext(r.Context(), "failed to update project", "project_id", reqBody.ID, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.PROJECT_UPDATE_ERR)
+		return
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"project_id": reqBody.ID,
+	})
+}
+
+func validateProjectIdField(ctx context.Context, id string) utils.ErrorMessage {
+	if id == "" {
+		slog.WarnContext(ctx, "missing required field", "field", "id")
+		return utils.MISSING_REQUIRED_FIELDS
+	}
+
+	projectExists, err := utils.CheckIfProjectExists(ctx, id)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to check project existence", "project_id", id, "error", err)
+		return utils.PROJECT_RETRIEVAL_ERR
+	}
+	if !projectExists {
+		slog.WarnContext(ctx, "project does not exist", "project_id", id)
+		return utils.INVALID_PROJECT_ID
+	}
+
+	return utils.NO_ERR
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"context"
+	"log/slog"
+	"net/http"
+)
+
+type UpdateRecipientReq struct {
+	ID string `json:"id"`
+	InsertRecipientReq
+}
+
+func UpdateRecipientHandler(w http.ResponseWriter, r *http.Request) {
+	reqBody := &UpdateRecipientReq{}
+	if errStr := httpx.DecodeJsonReq(r, reqBody); errStr != utils.NO_ERR {
+		slog.ErrorContext(r.Context(), "failed to decode JSON request", "error", errStr)
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	if errStr := validateRecipientIdField(r.Context(), reqBody.ID); errStr != utils.NO_ERR {
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	lowerCasedName := utils.GetLowerCasedCompoundName(reqBody.Name)
+	if reqBody.Name != "" {
+		var nameTaken bool
+		if err := db.ConnFrom(r.Context()).QueryRowContext(r.Context(),
+			"SELECT EXISTS(SELECT 1 FROM recipient WHERE lower_case_name = ? AND id != ?)",
+			lowerCasedName, reqBody.ID,
+		).Scan(&nameTaken); err != nil {
+			slog.ErrorContext(r.Context(), "failed to check recipient name", "recipient_name", reqBody.Name, "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.RECIPIENT_RETRIEVAL_ERR)
+			return
+		}
+		if nameTaken {
+			slog.WarnContext(r.Context(), "recipient name already exists", "name", reqBody.Name)
+			httpx.RespWithError(w, http.StatusNotAcceptable, utils.RECIPIENT_ALREADY_EXISTS)
+			return
+		}
+	}
+
+	if _, err := db.ConnFrom(r.Context()).ExecContext(r.Context(), `
+		UPDATE recipient
+		SET
+			name = CASE WHEN ? != '' THEN ? ELSE name END,
+			lower_case_name = CASE WHEN ? != '' THEN ? ELSE lower_case_name END,
+			department = ?, phone = ?, email = ? = ?
+		WHERE id = ?`,
+		reqBody.Name, reqBody.Name,
+		reqBody.Name, lowerCasedName,
+		reqBody.Department, reqBody.Phone, reqBody.Email,
+		reqBody.ID,
+	); err != nil {
+		slog.ErrorContext(r.Context(), "failed to update recipient", "recipient_id", reqBody.ID, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.RECIPIENT_UPDATE_ERR)
+		return
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"recipient_id": reqBody.ID,
+	})
+}
+
+func validateRecipientIdField(ctx context.Context, id string) utils.ErrorMessage {
+	if id == "" {
+		slog.WarnContext(ctx, "missing required field", "field", "id")
+		return utils.MISSING_REQUIRED_FIELDS
+	}
+
+	recipientExists, err := utils.CheckIfRecipientExists(ctx, id)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to check recipient existence", "recipient_id", id, "error", err)
+		return utils.RECIPIENT_RETRIEVAL_ERR
+	}
+	if !recipientExists {
+		slog.WarnContext(ctx, "recipient does not exist", "recipient_id", id)
+		return utils.INVALID_RECIPIENT_ID
+	}
+
+	return utils.NO_ERR
+}
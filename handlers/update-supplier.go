@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"context"
+	"log/slog"
+	"net/http"
+)
+
+type UpdateSupplierReq struct {
+	ID string `json:"id"`
+	InsertSupplierReq
+}
+
+func UpdateSupplierHandler(w http.ResponseWriter, r *http.Request) {
+	reqBody := &UpdateSupplierReq{}
+	if errStr := httpx.DecodeJsonReq(r, reqBody); errStr != utils.NO_ERR {
+		slog.ErrorContext(r.Context(), "failed to decode JSON request", "error", errStr)
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	if errStr := validateSupplierIdField(r.Context(), reqBody.ID); errStr != utils.NO_ERR {
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	lowerCasedName := utils.GetLowerCasedCompoundName(reqBody.Name)
+	if reqBody.Name != "" {
+		var nameTaken bool
+		if err := db.ConnFrom(r.Context()).QueryRowContext(r.Context(),
+			"SELECT EXISTS(SELECT 1 FROM supplier WHERE lower_case_name = ? AND id != ?)",
+			lowerCasedName, reqBody.ID,
+		).Scan(&nameTaken); err != nil {
+			slog.ErrorContext(r.Context(), "failed to check supplier name", "supplier_name", reqBody.Name, "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.SUPPLIER_RETRIEVAL_ERR)
+			return
+		}
+		if nameTaken {
+			slog.WarnContext(r.Context(), "supplier name already exists", "name", reqBody.Name)
+			httpx.RespWithError(w, http.StatusNotAcceptable, utils.SUPPLIER_ALREADY_EXISTS)
+			return
+		}
+	}
+
+	if _, err := db.ConnFrom(r.Context()).ExecContext(r.Context(), `
+		UPDATE supplier
+		SET
+			name = CASE WHEN ? != '' THEN ? ELSE name END,
+			lower_case_name = CASE WHEN ? != '' THEN ? ELSE lower_case_name END,
+			contact_person = ?, phone = ?, email = ?, address = ?
+		WHERE id = ?`,
+		reqBody.Name, reqBody.Name,
+		reqBody.Name, lowerCasedName,
+		reqBody.ContactPerson, reqBody.Phone, reqBody.Email, reqBody.Address,
+		reqBody.ID,
+	); err != nil {
+		slog.ErrorContext(r.Context(), "failed to update supplier", "supplier_id", reqBody.ID, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.SUPPLIER_UPDATE_ERR)
+		return
+	}
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"supplier_id": reqBody.ID,
+	})
+}
+
+func validateSupplierIdField(ctx context.Context, id string) utils.ErrorMessage {
+	if id == "" {
+		slog.WarnContext(ctx, "missing required field", "field", "id")
+		return utils.MISSING_REQUIRED_FIELDS
+	}
+
+	supplierExists, err := utils.CheckIfSupplierExists(ctx, id)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to check supplier existence", "supplier_id", id, "error", err)
+		return utils.SUPPLIER_RETRIEVAL_ERR
+	}
+	if !supplierExists {
+		slog.WarnContext(ctx, "supplier does not exist", "supplier_id", id)
+		return utils.INVALID_SUPPLIER_ID
+	}
+
+	return utils.NO_ERR
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"log/slog"
+	"net/http"
+)
+
+type UpdateUserReq struct {
+	Id string `json:"id"`
+	InsertUserReq
+	Active bool `json:"active"`
+}
+
+func UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
+	reqBody := &UpdateUserReq{}
+	if errStr := httpx.DecodeJsonReq(r, reqBody); errStr != utils.NO_ERR {
+		slog.ErrorContext(r.Context(), "failed to decode JSON request", "error", errStr)
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	user, err := utils.GetUser(r.Context(), reqBody.Id)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to get user", "user_id", reqBody.Id, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.USER_RETRIEVAL_ERR)
+		return
+	}
+	if user == nil {
+		slog.WarnContext(r.Context(), "user does not exist", "user_id", reqBody.Id)
+		httpx.RespWithError(w, http.StatusBadRequest, utils.INVALID_USER_ID)
+		return
+	}
+
+	if errStr := validateUserFields(r.Context(), &reqBody.InsertUserReq, reqBody.Id); errStr != utils.NO_ERR {
+		httpx.RespWithError(w, http.StatusBadRequest, errStr)
+		return
+	}
+
+	if reqBody.Id == utils.LOCAL_USER_ID && (reqBody.Role != utils.ROLE_ADMIN || !reqBody.Active) {
+		slog.WarnContext(r.Context(), "attempt to demote the local administrator")
+		httpx.RespWithError(w, http.StatusNotAcceptable, utils.LOCAL_USER_LOCKED)
+		return
+	}
+
+	if _, err := db.ConnFrom(r.Context()).ExecContext(r.Context(),
+		"UPDATE user SET name = ?, role = ?, supervisor_id = NULLIF(?, ''), active = ? WHERE id = ?",
+		reqBody.Name, reqBody.Role, reqBody.SupervisorId, reqBody.Active, reqBody.Id,
+	); err != nil {
+		slog.ErrorContext(r.Context(), "failed to update user", "user_id", reqBody.Id, "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.USER_UPDATE_ERR)
+		return
+	}
+
+	utils.RecordAudit(r.Context(), nil, currentUser(r).Id, "user.update", utils.AUDIT_TARGET_USER, reqBody.Id, map[string]any{
+		"before": user,
+		"after":  reqBody,
+	})
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"user_id": reqBody.Id,
+	})
+}
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"bytes"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+const (
+	USER_ID_HEADER = "X-User-Id"
+	// Carries the token of the user, as "Bearer <token>", see InsertUserTokenHandler
+	AUTHORIZATION_HEADER = "Authorization"
+)
+
+type userContextKey struct{}
+
+// Identifies the user making the request by the token in the "Authorization" header, in the role of their active
+// role grant if they hold one. "X-User-Id" proves nothing by itself: with a token it must name the token's user, and
+// without one only the built-in local administrator, which requests without either act as too. That is the desktop
+// frontend, so only requests from this machine may; others are refused with 401, as the API listens on every
+// interface.
+func IdentifyUserMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Header.Get(USER_ID_HEADER)
+		if token, ok := strings.CutPrefix(r.Header.Get(AUTHORIZATION_HEADER), "Bearer "); ok {
+			tokenUserId, err := utils.GetTokenUserId(r.Context(), strings.TrimSpace(token))
+			if err != nil {
+				slog.ErrorContext(r.Context(), "failed to look up user token", "error", err)
+				httpx.RespWithError(w, http.StatusInternalServerError, utils.USER_TOKEN_RETRIEVAL_ERR)
+				return
+			}
+			if tokenUserId == "" || (userId != "" && userId != tokenUserId) {
+				slog.WarnContext(r.Context(), "unknown user token", "user_id", userId, "token_user_id", tokenUserId, "remote_addr", r.RemoteAddr)
+				httpx.RespWithError(w, http.StatusUnauthorized, utils.INVALID_USER_TOKEN)
+				return
+			}
+			userId = tokenUserId
+		} else {
+			if userId == "" {
+				userId = utils.LOCAL_USER_ID
+			}
+			if userId != utils.LOCAL_USER_ID {
+				slog.WarnContext(r.Context(), "user without token", "user_id", userId, "remote_addr", r.RemoteAddr)
+				httpx.RespWithError(w, http.StatusUnauthorized, utils.USER_TOKEN_REQUIRED)
+				return
+			}
+			if !isLocalRequest(r) {
+				slog.WarnContext(r.Context(), "local administrator from another machine", "remote_addr", r.RemoteAddr)
+				httpx.RespWithError(w, http.StatusUnauthorized, utils.LOCAL_USER_REMOTE)
+				return
+			}
+		}
+
+		user, err := utils.GetUser(r.Context(), userId)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to identify user", "user_id", userId, "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.USER_RETRIEVAL_ERR)
+			return
+		}
+		if user == nil || !user.Active {
+			slog.WarnContext(r.Context(), "unknown or inactive user", "user_id", userId)
+			httpx.RespWithError(w, http.StatusUnauthorized, utils.UNKNOWN_USER)
+			return
+		}
+		if err := utils.ApplyRoleGrant(r.Context(), user); err != nil {
+			slog.ErrorContext(r.Context(), "failed to apply role grant", "user_id", userId, "error", err)
+			httpx.RespWithError(w, http.StatusInternalServerError, utils.ROLE_GRANT_RETRIEVAL_ERR)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userContextKey{}, user)))
+	})
+}
+
+// Only lets requests through for users with one of the given roles
+func RequireRoles(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user := currentUser(r)
+			if !slices.Contains(roles, user.Role) {
+				slog.WarnContext(r.Context(), "role not allowed", "user_id", user.Id, "role", user.Role, "path", r.URL.Path)
+				httpx.RespWithError(w, http.StatusForbidden, utils.FORBIDDEN_ROLE)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Blanks the fields the user's role may not see (see utils.RedactionPolicies) in every JSON response.
+// Handlers writing other formats, i.e. exports, redact their data with utils.RedactForRole themselves.
+func RedactResponseMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fields := utils.GetRedactedFields(currentUser(r).Role)
+		if fields == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+		if recorder.passThrough {
+			return
+		}
+
+		body := recorder.body.Bytes()
+		if strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") && len(body) > 0 {
+			redacted, err := utils.RedactJSON(body, fields)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "failed to redact response", "path", r.URL.Path, "error", err)
+				httpx.RespWithError(w, http.StatusInternalServerError, utils.REDACTION_ERR)
+				return
+			}
+			body = redacted
+		}
+
+		w.WriteHeader(recorder.status)
+		w.Write(body)
+	})
+}
+
+// Holds back the JSON response of a handler so it can be changed before it is sent. Other responses, e.g.
+// streamed exports that redact themselves, are passed through as they are written.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	body        bytes.Buffer
+	wroteHeader bool
+	passThrough bool
+}
+
+func (rr *responseRecorder) WriteHeader(status int) {
+	rr.status = status
+	rr.wroteHeader = true
+	if !strings.HasPrefix(rr.Header().Get("Content-Type"), "application/json") {
+		rr.passThrough = true
+		rr.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (rr *responseRecorder) Write(data []byte) (int, error) {
+	if !rr.wroteHeader {
+		rr.WriteHeader(http.StatusOK)
+	}
+	if rr.passThrough {
+		return rr.ResponseWriter.Write(data)
+	}
+	return rr.body.Write(data)
+}
+
+// Lets streamed responses passed through flush, see http.NewResponseController
+func (rr *responseRecorder) Unwrap() http.ResponseWriter {
+	return rr.ResponseWriter
+}
+
+// Whether the request was made on this machine: from a loopback address, but not forwarded by a proxy, which would
+// make every request it forwards look local when it runs on the same machine. Requests from the trusted proxies (see
+// utils.TrustedProxies) never are, and those carrying the forwarding headers of any other proxy neither.
+func isLocalRequest(r *http.Request) bool {
+	if utils.IsTrustedProxy(r.RemoteAddr) || r.Header.Get("Forwarded") != "" || r.Header.Get("X-Forwarded-For") != "" {
+		return false
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Gets the user identified by IdentifyUserMiddleware, the local administrator when the middleware did not run
+func currentUser(r *http.Request) *utils.User {
+	if user, ok := r.Context().Value(userContextKey{}).(*utils.User); ok {
+		return user
+	}
+	return &utils.User{Id: utils.LOCAL_USER_ID, Name: "Local administrator", Role: utils.ROLE_ADMIN, Active: true}
+}
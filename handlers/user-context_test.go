@@ -0,0 +1,139 @@
+package handlers_test
+
+import (
+	"chemical-ledger-backend/handlers"
+	"chemical-ledger-backend/testutils"
+	"chemical-ledger-backend/utils"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocalAdministratorOnlyFromThisMachine(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "127.0.0.2")
+	env := testutils.NewEnv(t, time.Date(2026, 3, 14, 10, 0, 0, 0, time.Local))
+	if _, err := env.DB.Exec("INSERT INTO user (id, name, role) VALUES ('U_admin', 'Admin', 'admin')"); err != nil {
+		t.Fatal(err)
+	}
+
+	diagnostics := handlers.IdentifyUserMiddleware(handlers.RequireRoles(utils.ROLE_ADMIN)(http.HandlerFunc(handlers.GetDiagnosticsHandler)))
+	get := func(remoteAddr string, userId string, token string) *httptest.ResponseRecorder {
+		req := env.Request(http.MethodGet, "/admin/diagnostics", nil)
+		req.RemoteAddr = remoteAddr
+		if userId != "" {
+			req.Header.Set(handlers.USER_ID_HEADER, userId)
+		}
+		if token != "" {
+			req.Header.Set(handlers.AUTHORIZATION_HEADER, "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		diagnostics.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, addr := range []string{"127.0.0.1:51234", "[::1]:51234"} {
+		if w := get(addr, "", ""); w.Code != http.StatusOK {
+			t.Errorf("without header from %s: status %d, %s", addr, w.Code, w.Body)
+		}
+	}
+	for _, userId := range []string{"", utils.LOCAL_USER_ID} {
+		if w := get("192.168.1.20:51234", userId, ""); w.Code != http.StatusUnauthorized {
+			t.Errorf("local administrator %q from another machine: status %d, %s", userId, w.Code, w.Body)
+		}
+	}
+	// Requests a proxy on this machine forwards are not made on it, be it a trusted proxy or one sending its headers
+	if w := get("127.0.0.2:51234", "", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("local administrator through the trusted proxy: status %d, %s", w.Code, w.Body)
+	}
+	for _, header := range []string{"X-Forwarded-For", "Forwarded"} {
+		req := env.Request(http.MethodGet, "/admin/diagnostics", nil)
+		req.RemoteAddr = "127.0.0.1:51234"
+		req.Header.Set(header, "for=203.0.113.5")
+		w := httptest.NewRecorder()
+		diagnostics.ServeHTTP(w, req)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("local administrator forwarded with %s: status %d, %s", header, w.Code, w.Body)
+		}
+	}
+
+	// Naming a user proves nothing, from this machine or another
+	for _, addr := range []string{"127.0.0.1:51234", "192.168.1.20:51234"} {
+		if w := get(addr, "U_admin", ""); w.Code != http.StatusUnauthorized {
+			t.Errorf("admin named without a token from %s: status %d, %s", addr, w.Code, w.Body)
+		}
+	}
+}
+
+func TestUsersSignInWithIssuedTokens(t *testing.T) {
+	t.Parallel()
+	env := testutils.NewEnv(t, time.Date(2026, 3, 14, 10, 0, 0, 0, time.Local))
+	if _, err := env.DB.Exec("INSERT INTO user (id, name, role) VALUES ('U_admin', 'Admin', 'admin'), ('U_op', 'Operator', 'operator')"); err != nil {
+		t.Fatal(err)
+	}
+
+	issue := func(userId string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handlers.InsertUserTokenHandler(w, env.Request(http.MethodPost, "/insert-user-token", strings.NewReader(`{"user_id": "`+userId+`", "label": "lab tablet"}`)))
+		return w
+	}
+	if w := issue(utils.LOCAL_USER_ID); w.Code != http.StatusBadRequest {
+		t.Errorf("token for the local administrator: status %d, %s", w.Code, w.Body)
+	}
+	w := issue("U_admin")
+	var issued struct {
+		Data struct {
+			TokenId string `json:"token_id"`
+			Token   string `json:"token"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &issued); w.Code != http.StatusOK || err != nil || issued.Data.Token == "" {
+		t.Fatalf("token for an admin: status %d, %s, %v", w.Code, w.Body, err)
+	}
+	var stored int
+	if err := env.DB.QueryRow("SELECT COUNT(*) FROM user_token WHERE token_hash = ?", issued.Data.Token).Scan(&stored); err != nil || stored != 0 {
+		t.Errorf("token kept as it was issued: %d, %v", stored, err)
+	}
+
+	users := handlers.IdentifyUserMiddleware(handlers.RequireRoles(utils.ROLE_ADMIN)(http.HandlerFunc(handlers.GetUserHandler)))
+	get := func(userId string, token string) *httptest.ResponseRecorder {
+		req := env.Request(http.MethodGet, "/get-user", nil)
+		req.RemoteAddr = "192.168.1.20:51234"
+		if userId != "" {
+			req.Header.Set(handlers.USER_ID_HEADER, userId)
+		}
+		req.Header.Set(handlers.AUTHORIZATION_HEADER, "Bearer "+token)
+		w := httptest.NewRecorder()
+		users.ServeHTTP(w, req)
+		return w
+	}
+	if w := get("", issued.Data.Token); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"U_op"`) {
+		t.Errorf("admin signed in from another machine: status %d, %s", w.Code, w.Body)
+	}
+	if w := get("U_op", issued.Data.Token); w.Code != http.StatusUnauthorized {
+		t.Errorf("token of another user than named: status %d, %s", w.Code, w.Body)
+	}
+	if w := get("", "0123456789abcdef"); w.Code != http.StatusUnauthorized {
+		t.Errorf("unknown token: status %d, %s", w.Code, w.Body)
+	}
+
+	// The list of users, and so their IDs, is for admins only
+	req := env.Request(http.MethodGet, "/get-user", nil)
+	env.SignIn(req, "U_op")
+	w = httptest.NewRecorder()
+	users.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("users listed for an operator: status %d, %s", w.Code, w.Body)
+	}
+
+	w = httptest.NewRecorder()
+	handlers.DeleteUserTokenHandler(w, env.Request(http.MethodDelete, "/delete-user-token?id="+issued.Data.TokenId, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("revoke: status %d, %s", w.Code, w.Body)
+	}
+	if w := get("", issued.Data.Token); w.Code != http.StatusUnauthorized {
+		t.Errorf("revoked token: status %d, %s", w.Code, w.Body)
+	}
+}
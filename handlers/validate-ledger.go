@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"chemical-ledger-backend/datetime"
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/httpx"
+	"chemical-ledger-backend/utils"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Categories of the violations found by ValidateLedgerHandler, in the order they are listed
+const (
+	VIOLATION_FUTURE_DATE    = "future_date"
+	VIOLATION_ENTRY_TYPE     = "invalid_type"
+	VIOLATION_QUANTITY       = "quantity"
+	VIOLATION_FIELDS         = "fields"
+	VIOLATION_LARGE_INCOMING = "large_incoming"
+	VIOLATION_LOCKED_PERIOD  = "locked_period"
+)
+
+var violationCategories = []string{
+	VIOLATION_FUTURE_DATE, VIOLATION_ENTRY_TYPE, VIOLATION_QUANTITY, VIOLATION_FIELDS, VIOLATION_LARGE_INCOMING, VIOLATION_LOCKED_PERIOD,
+}
+
+// Entry recorded before a rule it breaks was in force, or whose data was changed since
+type LedgerViolation struct {
+	EntryId  string `json:"entry_id"`
+	Type     string `json:"type"`
+	Compound string `json:"compound"`
+	Date     string `json:"date"`
+	Status   string `json:"status"`
+	Problem  string `json:"problem"`
+}
+
+type LedgerViolationGroup struct {
+	Category string            `json:"category"`
+	Count    int               `json:"count"`
+	Entries  []LedgerViolation `json:"entries"`
+}
+
+// Entry as read back for validation, with the request it would have been recorded with
+type ledgerEntry struct {
+	id                 string
+	compound           string
+	scale              string
+	date               int64
+	status             string
+	totalQuantity      int
+	largeIncomingBound int
+	req                InsertEntryReq
+}
+
+// Runs the rules entries are recorded under again over every entry in the ledger, for admins to plan a cleanup:
+// dates in the future, invalid types, quantities and fields /insert-entry refuses today, deliveries above the
+// plausible bound of their compound and entries still pending in a locked month, which cannot be reviewed any more.
+// Rules change with the code and the settings, so entries recorded before can break them. Deleted and rejected
+// entries are left out. Each entry is listed under the first problem found in each category.
+func ValidateLedgerHandler(w http.ResponseWriter, r *http.Request) {
+	entries, err := readLedgerEntries(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to read entries to validate", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.LEDGER_VALIDATION_ERR)
+		return
+	}
+
+	lockedBefore, err := utils.ActiveEntryLock(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to retrieve entry lock", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.ENTRY_LOCK_RETRIEVAL_ERR)
+		return
+	}
+
+	// Read-only, the transaction only gives the bounds one view of the entries
+	tx, err := db.ConnFrom(r.Context()).BeginTx(r.Context(), nil)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error starting transaction", "error", err)
+		httpx.RespWithError(w, http.StatusInternalServerError, utils.TX_START_ERR)
+		return
+	}
+	defer tx.Rollback()
+
+	checkLargeIncoming := utils.LargeIncomingCheck() != utils.LARGE_INCOMING_OFF
+	now := datetime.Now(r.Context()).Unix()
+	byCategory := map[string][]LedgerViolation{}
+	add := func(entry *ledgerEntry, category string, problem string) {
+		byCategory[category] = append(byCategory[category], LedgerViolation{
+			EntryId:  entry.id,
+			Type:     entry.req.Type,
+			Compound: entry.compound,
+			Date:     entry.req.Date,
+			Status:   entry.status,
+			Problem:  problem,
+		})
+	}
+
+	for i := range entries {
+		entry := &entries[i]
+
+		if entry.date > now {
+			add(entry, VIOLATION_FUTURE_DATE, string(utils.FUTURE_DATE_ERR))
+		}
+
+		if errStr := validateInsertEntryReq(r.Context(), &entry.req); errStr != utils.NO_ERR {
+			switch errStr {
+			case utils.INVALID_ENTRY_TYPE:
+				add(entry, VIOLATION_ENTRY_TYPE, string(errStr))
+			case utils.MISSING_REQUIRED_FIELDS, utils.INVALID_PARTIAL_QUANTITY, utils.INVALID_PACKS_PER_UNIT:
+				add(entry, VIOLATION_QUANTITY, string(errStr))
+			default:
+				add(entry, VIOLATION_FIELDS, string(errStr))
+			}
+		} else if entry.totalQuantity <= 0 {
+			add(entry, VIOLATION_QUANTITY, fmt.Sprintf("The quantity is %d %s.", entry.totalQuantity, entry.scale))
+		}
+
+		if checkLargeIncoming && entry.req.Type == utils.ENTRY_TYPE_INCOMING {
+			bound := entry.largeIncomingBound
+			if bound == 0 {
+				if bound, err = utils.LargeIncomingBound(r.Context(), tx, entry.req.CompoundId, entry.date); err != nil {
+					slog.ErrorContext(r.Context(), "error checking for large incoming quantity", "entry_id", entry.id, "error", err)
+					httpx.RespWithError(w, http.StatusInternalServerError, utils.LARGE_INCOMING_CHECK_ERR)
+					return
+				}
+			}
+			if bound != 0 && entry.totalQuantity > bound {
+				add(entry, VIOLATION_LARGE_INCOMING, fmt.Sprintf("%d %s is above the plausible %d %s.", entry.totalQuantity, entry.scale, bound, entry.scale))
+			}
+		}
+
+		if lockedBefore != "" && entry.status == utils.ENTRY_STATUS_PENDING && entry.req.Date < lockedBefore {
+			add(entry, VIOLATION_LOCKED_PERIOD, fmt.Sprintf("Still pending, and entries dated before %s are locked.", lockedBefore))
+		}
+	}
+
+	groups := []LedgerViolationGroup{}
+	total := 0
+	for _, category := range violationCategories {
+		if violations := byCategory[category]; len(violations) > 0 {
+			groups = append(groups, LedgerViolationGroup{Category: category, Count: len(violations), Entries: violations})
+			total += len(violations)
+		}
+	}
+	slog.InfoContext(r.Context(), "ledger validated", "entries", len(entries), "violations", total)
+
+	httpx.RespWithData(w, http.StatusOK, map[string]any{
+		"checked":    len(entries),
+		"violations": total,
+		"categories": groups,
+	})
+}
+
+// Reads the entries that count towards the ledger, oldest first, as the requests they would be recorded with now
+func readLedgerEntries(ctx context.Context) ([]ledgerEntry, error) {
+	rows, err := db.ConnFrom(ctx).QueryContext(ctx, `
+		SELECT
+			e.id, c.name, c.scale, e.date, e.status, q.total_quantity, COALESCE(e.large_incoming_bound, 0),
+			e.type, e.compound_id, COALESCE(e.remark, ''), COALESCE(e.voucher_no, ''),
+			q.num_of_units, q.quantity_per_unit, q.packs_per_unit, q.partial_quantity,
+			COALESCE(l.lot_no, ''), COALESCE(l.expiry, ''), COALESCE(l.supplier, ''),
+			COALESCE(e.lot_id, ''), COALESCE(e.supplier_id, ''), COALESCE(e.recipient_id, ''), COALESCE(e.reason, ''),
+			COALESCE(e.instrument_id, ''), COALESCE(e.instrument_event, ''),
+			COALESCE(e.disposal_method, ''), COALESCE(e.disposal_authorized_by, ''),
+			COALESCE(e.location_id, ''), COALESCE(e.to_location_id, ''), COALESCE(e.project_id, ''), e.unit_cost,
+			COALESCE(e.po_line_id, '')
+		FROM entry e
+		JOIN compound c ON e.compound_id = c.id
+		JOIN quantity q ON e.quantity_id = q.id
+		LEFT JOIN lot l ON l.entry_id = e.id
+		WHERE e.deleted_at IS NULL AND e.status != ?
+		ORDER BY e.date ASC, e.seq ASC`,
+		utils.ENTRY_STATUS_REJECTED,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []ledgerEntry{}
+	for rows.Next() {
+		var e ledgerEntry
+		var numOfUnits, quantityPerUnit, packsPerUnit, partialQuantity int
+		if err := rows.Scan(
+			&e.id, &e.compound, &e.scale, &e.date, &e.status, &e.totalQuantity, &e.largeIncomingBound,
+			&e.req.Type, &e.req.CompoundId, &e.req.Remark, &e.req.VoucherNo,
+			&numOfUnits, &quantityPerUnit, &packsPerUnit, &partialQuantity,
+			&e.req.LotNo, &e.req.Expiry, &e.req.Supplier,
+			&e.req.LotId, &e.req.SupplierId, &e.req.RecipientId, &e.req.Reason,
+			&e.req.InstrumentId, &e.req.InstrumentEvent,
+			&e.req.DisposalMethod, &e.req.DisposalAuthorizedBy,
+			&e.req.LocationId, &e.req.ToLocationId, &e.req.ProjectId, &e.req.UnitCost,
+			&e.req.PoLineId,
+		); err != nil {
+			return nil, err
+		}
+		e.req.Date = time.Unix(e.date, 0).Format("2006-01-02")
+		e.req.NumOfUnits, e.req.QuantityPerUnit = utils.LocalizedInt(numOfUnits), utils.LocalizedInt(quantityPerUnit)
+		e.req.PacksPerUnit, e.req.PartialQuantity = utils.LocalizedInt(packsPerUnit), utils.LocalizedInt(partialQuantity)
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
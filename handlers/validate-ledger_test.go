@@ -0,0 +1,58 @@
+package handlers_test
+
+import (
+	"chemical-ledger-backend/handlers"
+	"chemical-ledger-backend/testutils"
+	"chemical-ledger-backend/utils"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Entries recorded before a rule was in force, or changed by hand since, are reported per category
+func TestValidateLedgerReportsViolations(t *testing.T) {
+	t.Parallel()
+	env := testutils.NewEnv(t, time.Date(2026, 3, 14, 10, 0, 0, 0, time.Local))
+
+	env.InsertCompound("C_1", "Acetone", "ml")
+	for _, w := range []*httptest.ResponseRecorder{
+		insertEntry(env, utils.ENTRY_TYPE_INCOMING, "C_1", "2026-03-01", 1000),
+		insertEntry(env, utils.ENTRY_TYPE_OUTGOING, "C_1", "2026-03-02", 100),
+		insertEntry(env, utils.ENTRY_TYPE_OUTGOING, "C_1", "2026-03-03", 100),
+	} {
+		if w.Code != http.StatusOK {
+			t.Fatalf("entry: status %d, %s", w.Code, w.Body)
+		}
+	}
+
+	validate := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handlers.ValidateLedgerHandler(w, env.Request(http.MethodGet, "/admin/validate-ledger", nil))
+		return w
+	}
+	if w := validate(); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"checked":3,"violations":0`) {
+		t.Fatalf("clean ledger: status %d, %s", w.Code, w.Body)
+	}
+
+	// A reason on an issue and an issue dated tomorrow, as a hand edit or an older version could leave them
+	if _, err := env.DB.Exec("UPDATE entry SET reason = 'spill' WHERE date < ? AND type = 'outgoing'", time.Date(2026, 3, 3, 0, 0, 0, 0, time.Local).Unix()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.DB.Exec("UPDATE entry SET date = ? WHERE date > ?", time.Date(2026, 3, 15, 9, 0, 0, 0, time.Local).Unix(), time.Date(2026, 3, 3, 0, 0, 0, 0, time.Local).Unix()); err != nil {
+		t.Fatal(err)
+	}
+
+	w := validate()
+	for _, want := range []string{
+		`"checked":3,"violations":2`,
+		`"category":"future_date","count":1`,
+		`"category":"fields","count":1`,
+		`"problem":"` + string(utils.REASON_ON_NON_ADJUSTMENT) + `"`,
+	} {
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), want) {
+			t.Errorf("validation: status %d, want %s in %s", w.Code, want, w.Body)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+// Package httpx reads requests and writes the JSON responses of the API, all in the same envelope: {"error": ...} or
+// {"data": ...}.
+package httpx
+
+import (
+	"chemical-ledger-backend/utils"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+// Response header carrying the ID of the request, also sent along with errors as "request_id"
+const REQUEST_ID_HEADER = "X-Request-Id"
+
+type Resp struct {
+	Error any `json:"error,omitempty"`
+	Data  any `json:"data,omitempty"`
+	// Build that failed, on server errors, so the report a user sends tells support which build it was
+	Build *utils.BuildInfo `json:"build,omitempty"`
+	// ID of a failed request, which its log lines carry, for the user to quote when reporting it
+	RequestId string `json:"request_id,omitempty"`
+}
+
+func NewRespWithError(errStr utils.ErrorMessage) *Resp {
+	return &Resp{
+		Error: errStr,
+	}
+}
+
+func NewRespWithData(data any) *Resp {
+	return &Resp{
+		Data: data,
+	}
+}
+
+// Decodes the JSON request body into the given object
+func DecodeJsonReq(r *http.Request, obj any) utils.ErrorMessage {
+	err := json.NewDecoder(r.Body).Decode(obj)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to decode JSON request body", "error", err)
+		// Fields that validate themselves while decoding, like localized numbers, explain what is wrong
+		var errStr utils.ErrorMessage
+		if errors.As(err, &errStr) {
+			return errStr
+		}
+		return utils.REQUEST_BODY_DECODE_ERR
+	}
+	return utils.NO_ERR
+}
+
+// Encodes the given object into JSON and writes it to the response
+func EncodeJsonRes(w http.ResponseWriter, status int, obj *Resp) error {
+	w.WriteHeader(status)
+	return json.NewEncoder(w).Encode(obj)
+}
+
+// Encodes the given error into JSON and writes it to the response, along with the ID of the request and the build
+// on server errors
+func RespWithError(w http.ResponseWriter, status int, errStr utils.ErrorMessage) {
+	resp := NewRespWithError(errStr)
+	resp.RequestId = w.Header().Get(REQUEST_ID_HEADER)
+	if status >= http.StatusInternalServerError {
+		build := utils.GetBuildInfo()
+		resp.Build = &build
+	}
+	EncodeJsonRes(w, status, resp)
+}
+
+// Encodes the given data into JSON and writes it to the response
+func RespWithData(w http.ResponseWriter, status int, data any) {
+	EncodeJsonRes(w, status, NewRespWithData(data))
+}
+
+// Gets the value of the given parameter from the URL query string
+func GetParam(r *http.Request, param string) string {
+	return r.URL.Query().Get(param)
+}
+
+// Gets the value of the given parameter from the URL query string and converts it to an integer
+func GetIntParam(r *http.Request, param string) (int, error) {
+	str := GetParam(r, param)
+	if str == "" {
+		return 0, nil
+	}
+	num, err := strconv.Atoi(str)
+	if err != nil {
+		return 0, err
+	}
+	return num, nil
+}
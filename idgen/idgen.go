@@ -0,0 +1,78 @@
+// Package idgen makes the unique part of record IDs, e.g. "01JA2XQ8N5V3W6Y9Z0B1C2D3E4" in "E_01JA2XQ8N5V3W6Y9Z0B1C2D3E4".
+package idgen
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"sync"
+	"time"
+)
+
+// Source of the unique part of record IDs
+type Generator interface {
+	Next() string
+}
+
+// Crockford's base 32, which leaves out I, L, O and U so IDs cannot be misread
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ULIDs (https://github.com/ulid/spec): the millisecond they are made in, followed by 80 random bits, written in
+// 26 characters of Crockford's base 32. They sort in the order they were made: IDs of the same millisecond count up
+// from the one before instead of drawing new random bits, and a clock going back keeps counting from the last ID.
+type ULIDs struct {
+	// Time the IDs are made at, the system time when nil
+	Now func() time.Time
+
+	mu         sync.Mutex
+	lastMillis uint64
+	lastRandom [10]byte
+}
+
+func (g *ULIDs) Next() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now
+	if g.Now != nil {
+		now = g.Now
+	}
+	millis := uint64(max(now().UnixMilli(), 0))
+
+	if millis <= g.lastMillis && g.increment() {
+		millis = g.lastMillis
+	} else {
+		// A new millisecond, or the last one ran out of IDs
+		millis = max(millis, g.lastMillis+1)
+		rand.Read(g.lastRandom[:])
+	}
+	g.lastMillis = millis
+
+	var id [16]byte
+	binary.BigEndian.PutUint64(id[:8], millis<<16)
+	copy(id[6:], g.lastRandom[:])
+	return encode(id)
+}
+
+// Adds one to the random part of the last ID, reporting false when it was already at its largest
+func (g *ULIDs) increment() bool {
+	for i := len(g.lastRandom) - 1; i >= 0; i-- {
+		g.lastRandom[i]++
+		if g.lastRandom[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Writes the 128 bits of an ID 5 at a time, the first character holding the 3 highest bits
+func encode(id [16]byte) string {
+	hi, lo := binary.BigEndian.Uint64(id[:8]), binary.BigEndian.Uint64(id[8:])
+
+	var out [26]byte
+	for i := len(out) - 1; i >= 0; i-- {
+		out[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
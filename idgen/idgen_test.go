@@ -0,0 +1,79 @@
+package idgen_test
+
+import (
+	"chemical-ledger-backend/idgen"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestULIDsSortInTheOrderTheyWereMade(t *testing.T) {
+	t.Parallel()
+
+	at := time.Date(2026, 3, 14, 10, 0, 0, 0, time.UTC)
+	var mu sync.Mutex
+	g := &idgen.ULIDs{Now: func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return at
+	}}
+
+	ids := []string{}
+	for i := range 1000 {
+		// Mostly the same millisecond, and once the clock going back
+		switch i {
+		case 400:
+			mu.Lock()
+			at = at.Add(time.Millisecond)
+			mu.Unlock()
+		case 700:
+			mu.Lock()
+			at = at.Add(-time.Second)
+			mu.Unlock()
+		}
+		ids = append(ids, g.Next())
+	}
+
+	for i, id := range ids {
+		if len(id) != 26 || strings.Trim(id, "0123456789ABCDEFGHJKMNPQRSTVWXYZ") != "" {
+			t.Fatalf("id %d %q is not a ULID", i, id)
+		}
+		if i > 0 && id <= ids[i-1] {
+			t.Fatalf("id %d %q does not sort after %q", i, id, ids[i-1])
+		}
+	}
+	// The time comes first, 2026-03-14T10:00:00Z is 1773482400000 ms
+	if !strings.HasPrefix(ids[0], "01KKNWKP80") {
+		t.Errorf("first id %q does not start with its time", ids[0])
+	}
+}
+
+func TestULIDsDoNotCollideAcrossGoroutines(t *testing.T) {
+	t.Parallel()
+
+	g := &idgen.ULIDs{}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	ids := []string{}
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 500 {
+				id := g.Next()
+				mu.Lock()
+				ids = append(ids, id)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	slices.Sort(ids)
+	if unique := len(slices.Compact(ids)); unique != 8*500 {
+		t.Errorf("%d of %d ids are unique", unique, 8*500)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"chemical-ledger-backend/config"
+	"chemical-ledger-backend/utils"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+)
+
+// Command line argument that promotes a standby, followed by the usual configuration options
+const PROMOTE_COMMAND = "promote"
+
+// Exit code of a promotion that found no replica or one that failed its checks
+const EXIT_PROMOTE = 17
+
+// Promotes a standby to take over from a lost primary: the replica received last is checked against its checksum and
+// by SQLite and becomes the database, and what to do next is printed. The standby must be stopped first. Returns the
+// exit code.
+func runPromote(args []string, out io.Writer) int {
+	cfg, err := config.Load(args, os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err == nil {
+		err = cfg.Apply()
+	}
+	if err != nil {
+		fmt.Fprintln(out, "Cannot promote, the configuration could not be loaded: "+err.Error())
+		return EXIT_CONFIG
+	}
+
+	if logFile, err := os.OpenFile(cfg.LogPath, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666); err == nil {
+		defer logFile.Close()
+		slog.SetDefault(slog.New(slog.NewJSONHandler(logFile, &slog.HandlerOptions{Level: slog.LevelInfo})))
+	}
+
+	if mode := utils.ReplicationMode(); mode != utils.REPLICATION_MODE_STANDBY {
+		fmt.Fprintf(out, "Cannot promote, this instance is not a standby (REPLICATION_MODE=%q). Only a standby's replica can "+
+			"replace the database.\n", mode)
+		return EXIT_CONFIG
+	}
+
+	// The standby holds its address while it runs, and must not receive a snapshot halfway through
+	listener, err := net.Listen("tcp", cfg.ApiAddr)
+	if err != nil {
+		fmt.Fprintln(out, "Cannot promote while the standby is running on "+cfg.ApiAddr+". Stop it first: "+err.Error())
+		return EXIT_PORT
+	}
+	listener.Close()
+
+	manifest, keptAs, err := utils.PromoteReplica(cfg.DbPath)
+	if err != nil {
+		slog.Error("failed to promote replica", "db_path", cfg.DbPath, "error", err)
+		fmt.Fprintln(out, "Cannot promote: "+err.Error()+".")
+		if errors.Is(err, utils.ErrReplicaChecksum) || errors.Is(err, utils.ErrReplicaCorrupt) {
+			fmt.Fprintln(out, "The replica is damaged. Restore the latest backup of the primary's database instead.")
+		}
+		return EXIT_PROMOTE
+	}
+
+	fmt.Fprintf(out, "Promoted the replica of %s (received %s, sha256 %s) to %s.\n",
+		manifest.TakenAt, manifest.ReceivedAt, manifest.Sha256, cfg.DbPath)
+	if keptAs != "" {
+		fmt.Fprintln(out, "The database that was there is kept as "+keptAs+".")
+	}
+	fmt.Fprintln(out, "Entries recorded on the primary after that snapshot are not in it; enter them again from the vouchers.")
+	fmt.Fprintln(out, "To finish:")
+	fmt.Fprintln(out, "  1. Remove REPLICATION_MODE from the [env] table of the configuration file or the environment, or set it to")
+	fmt.Fprintln(out, "     primary with REPLICATION_TARGET naming a new standby.")
+	fmt.Fprintln(out, "  2. Start Chemical Ledger. It opens at "+cfg.FrontendURL()+" on this machine; point the lab's browsers here.")
+	fmt.Fprintln(out, "  3. Keep the old primary switched off until it is set up again as a standby of this machine.")
+	return 0
+}
@@ -0,0 +1,22 @@
+// Package retry runs calls that may fail for a moment, e.g. on a busy database, again before giving up.
+package retry
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Pause before a failed call is run again
+const RETRY_DELAY = 100 * time.Millisecond
+
+// Runs the given function and, when it returns an error, runs it once more after RETRY_DELAY. Returns the error of
+// the last run. A call canceled with its request, or that ran out of time, is not run again.
+func Once(f func() error) error {
+	err := f()
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	time.Sleep(RETRY_DELAY)
+	return f()
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"chemical-ledger-backend/config"
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/utils"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Exit codes of a failed startup self-test, one per check, so the desktop launcher can tell the user what to fix.
+// When several checks fail the first one's code is used.
+const (
+	EXIT_CONFIG    = 10
+	EXIT_TIMEZONE  = 11
+	EXIT_DATA_DIR  = 12
+	EXIT_DATABASE  = 13
+	EXIT_MIGRATION = 14
+	EXIT_SEED_DATA = 15
+	EXIT_PORT      = 16
+)
+
+const (
+	SELF_TEST_OK      = "ok"
+	SELF_TEST_WARN    = "warn"
+	SELF_TEST_FAIL    = "fail"
+	SELF_TEST_SKIPPED = "skip"
+)
+
+type selfTestResult struct {
+	check    string
+	status   string
+	detail   string
+	hint     string
+	exitCode int
+}
+
+// What the startup self-test found, and what it set up on the way: the log file, the database connection and the
+// listeners the servers are started on, so that nothing can take the ports between the check and the start
+type selfTest struct {
+	config   *config.Config
+	results  []selfTestResult
+	logFile  *os.File
+	api      net.Listener
+	frontend net.Listener
+}
+
+func (t *selfTest) ok(check, detail string) {
+	t.results = append(t.results, selfTestResult{check: check, status: SELF_TEST_OK, detail: detail})
+}
+
+func (t *selfTest) warn(check, detail, hint string) {
+	t.results = append(t.results, selfTestResult{check: check, status: SELF_TEST_WARN, detail: detail, hint: hint})
+}
+
+func (t *selfTest) fail(check, detail, hint string, exitCode int) {
+	t.results = append(t.results, selfTestResult{check: check, status: SELF_TEST_FAIL, detail: detail, hint: hint, exitCode: exitCode})
+}
+
+func (t *selfTest) skip(check, reason string) {
+	t.results = append(t.results, selfTestResult{check: check, status: SELF_TEST_SKIPPED, detail: reason})
+}
+
+// Exit code of the first failed check, 0 when none failed
+func (t *selfTest) exitCode() int {
+	for _, result := range t.results {
+		if result.status == SELF_TEST_FAIL {
+			return result.exitCode
+		}
+	}
+	return 0
+}
+
+// Runs every startup check in order, skipping those that depend on a failed one. A configuration that could not be
+// loaded fails the first check and skips the others, which all depend on it.
+func runSelfTest(cfg *config.Config, loadErr error) *selfTest {
+	t := &selfTest{config: cfg}
+
+	if loadErr != nil {
+		t.fail("configuration", loadErr.Error(),
+			"Correct the configuration file, environment variable or command line option named, see the README.", EXIT_CONFIG)
+		for _, check := range []string{"time zone", "data folder", "database", "migrations", "seed data", "ports"} {
+			t.skip(check, "needs the configuration")
+		}
+		return t
+	}
+	if err := cfg.Apply(); err != nil {
+		t.fail("configuration", err.Error(), "Correct the [env] table of the configuration file.", EXIT_CONFIG)
+	} else if problems := utils.ConfigProblems(); len(problems) > 0 {
+		t.fail("configuration", strings.Join(problems, "\n"),
+			"Correct or remove these environment variables, see the README for the accepted values.", EXIT_CONFIG)
+	} else if cfg.AllowsAnyOrigin() {
+		t.warn("configuration", "CORS_ORIGINS allows every origin",
+			"Any web page can call the API. Name the origins the frontend is served from unless this is a development setup.")
+	} else if cfg.File != "" {
+		t.ok("configuration", cfg.File)
+	} else {
+		t.ok("configuration", "")
+	}
+
+	if zone, warning, err := utils.CheckTimezone(); err != nil {
+		t.fail("time zone", err.Error(),
+			"Set TZ to a zone name such as Asia/Kolkata, or remove it to use the system time zone.", EXIT_TIMEZONE)
+	} else if warning != "" {
+		t.warn("time zone", zone+"; "+warning,
+			"Entries are dated in the system time zone. Install the tzdata package to be able to set TZ.")
+	} else {
+		t.ok("time zone", zone)
+	}
+
+	// A standby keeps the snapshots it receives apart and opens no database until it is promoted
+	standby := utils.ReplicationMode() == utils.REPLICATION_MODE_STANDBY
+	databaseReady := false
+	if err := checkDataDir(t); err != nil {
+		t.fail("data folder", err.Error(),
+			"Make sure the current user can write to the application folder, or move it out of read-only "+
+				"locations such as Program Files.", EXIT_DATA_DIR)
+		t.skip("database", "needs the data folder")
+	} else {
+		t.ok("data folder", cfg.DataDir)
+		if standby {
+			t.skip("database", "standby, receiving snapshots into "+utils.ReplicationDir())
+		} else if err := checkDatabase(cfg.DbPath); err != nil {
+			t.fail("database", err.Error(),
+				"Close any other copy of Chemical Ledger and any program that has the database open, and make sure "+
+					cfg.DbPath+" is not read-only.", EXIT_DATABASE)
+		} else {
+			t.ok("database", cfg.DbPath)
+			databaseReady = true
+		}
+	}
+
+	if standby {
+		t.skip("migrations", "standby")
+		t.skip("seed data", "standby")
+	} else if !databaseReady {
+		t.skip("migrations", "needs the database")
+		t.skip("seed data", "needs the database")
+	} else if err := db.CreateTables(); err != nil {
+		t.fail("migrations", err.Error(),
+			"The database could not be brought up to date. Restore the latest backup of "+cfg.DbPath+
+				" or send the log file to support.", EXIT_MIGRATION)
+		t.skip("seed data", "needs the migrations")
+	} else {
+		t.ok("migrations", "")
+		if err := checkSeedData(); err != nil {
+			t.fail("seed data", err.Error(),
+				"The built-in units or the local administrator were changed outside the application. Restore the "+
+					"latest backup of "+cfg.DbPath+".", EXIT_SEED_DATA)
+		} else {
+			t.ok("seed data", "")
+		}
+	}
+
+	var err error
+	if t.api, err = net.Listen("tcp", cfg.ApiAddr); err != nil {
+		t.fail("ports", err.Error(),
+			"Another copy of Chemical Ledger is probably running; close it. Otherwise stop the program using port "+
+				portOf(cfg.ApiAddr)+", or set api_addr to another one.", EXIT_PORT)
+	} else if standby {
+		t.ok("ports", cfg.ApiAddr)
+	} else if t.frontend, err = net.Listen("tcp", cfg.FrontendAddr); err != nil {
+		t.api.Close()
+		t.fail("ports", err.Error(),
+			"Another copy of Chemical Ledger is probably running; close it. Otherwise stop the program using port "+
+				portOf(cfg.FrontendAddr)+", or set frontend_addr to another one.", EXIT_PORT)
+	} else {
+		t.ok("ports", cfg.ApiAddr+", "+cfg.FrontendAddr)
+	}
+
+	return t
+}
+
+func portOf(addr string) string {
+	if _, port, err := net.SplitHostPort(addr); err == nil {
+		return port
+	}
+	return addr
+}
+
+// Creates the data folder, logs to the file in it from then on and checks the attachments can be stored
+func checkDataDir(t *selfTest) error {
+	if err := os.MkdirAll(t.config.DataDir, 0755); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(t.config.LogPath), 0755); err != nil {
+		return err
+	}
+	logFile, err := os.OpenFile(t.config.LogPath, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	t.logFile = logFile
+	slog.SetDefault(slog.New(utils.NewRequestLogHandler(slog.NewJSONHandler(logFile, &slog.HandlerOptions{Level: slog.LevelInfo}))))
+
+	dir := utils.AttachmentsDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	probe, err := os.CreateTemp(dir, ".self-test-*")
+	if err != nil {
+		return err
+	}
+	probe.Close()
+	return os.Remove(probe.Name())
+}
+
+// Opens the database and checks it takes changes, which a read-only file or another process holding it refuses
+func checkDatabase(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := db.SetUpConnection(path); err != nil {
+		return err
+	}
+	tx, err := db.Conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec("CREATE TABLE self_test_probe (id INTEGER)")
+	return err
+}
+
+// Checks the rows the application relies on: the base units the others are converted through and the local
+// administrator requests without a user fall back to
+func checkSeedData() error {
+	for _, unit := range []struct{ name, kind string }{{"g", "mass"}, {"ml", "volume"}} {
+		var kind string
+		var multiplier, divisor int
+		err := db.Conn.QueryRow("SELECT kind, multiplier, divisor FROM unit WHERE name = ?", unit.name).Scan(&kind, &multiplier, &divisor)
+		if err != nil {
+			return fmt.Errorf("base unit %s: %w", unit.name, err)
+		}
+		if kind != unit.kind || multiplier != 1 || divisor != 1 {
+			return fmt.Errorf("base unit %s is not a plain %s unit", unit.name, unit.kind)
+		}
+	}
+
+	var role string
+	var active bool
+	if err := db.Conn.QueryRow("SELECT role, active FROM user WHERE id = ?", utils.LOCAL_USER_ID).Scan(&role, &active); err != nil {
+		return fmt.Errorf("local administrator: %w", err)
+	}
+	if role != utils.ROLE_ADMIN || !active {
+		return fmt.Errorf("local administrator is no longer an active admin")
+	}
+	return nil
+}
+
+// Prints the report for whoever started the application, with what to do about each failure
+func (t *selfTest) print(w io.Writer) {
+	// Lines after the first line of a result line up with its details
+	indent := strings.Repeat(" ", 24)
+	fmt.Fprintln(w, "Chemical Ledger startup self-test")
+	for _, result := range t.results {
+		lines := strings.Split(result.detail, "\n")
+		fmt.Fprintln(w, strings.TrimRight(fmt.Sprintf("  %-6s %-14s %s", "["+result.status+"]", result.check, lines[0]), " "))
+		for _, line := range lines[1:] {
+			fmt.Fprintln(w, indent+line)
+		}
+		if result.hint != "" {
+			fmt.Fprintln(w, indent+"-> "+result.hint)
+		}
+	}
+	if code := t.exitCode(); code != 0 {
+		fmt.Fprintf(w, "Startup self-test failed, exiting with code %d.\n", code)
+	}
+}
+
+// Writes the report to the log, or to stderr when the log file could not be opened
+func (t *selfTest) log() {
+	for _, result := range t.results {
+		attrs := []any{"check", result.check, "status", result.status, "detail", result.detail}
+		switch result.status {
+		case SELF_TEST_FAIL:
+			slog.Error("startup self-test", append(attrs, "exit_code", result.exitCode)...)
+		case SELF_TEST_WARN:
+			slog.Warn("startup self-test", attrs...)
+		default:
+			slog.Info("startup self-test", attrs...)
+		}
+	}
+}
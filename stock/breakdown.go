@@ -0,0 +1,84 @@
+package stock
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/utils"
+	"context"
+	"database/sql"
+)
+
+// Beside the stock on hand, what of it is reserved and what is still to come on purchase orders, so teachers can see
+// what they can actually ask for. Both are as they stand now: reservations and purchase orders are not dated back.
+// A reservation holds its quantity until the end of the day it is needed on, or until it is cancelled.
+
+// Gets the quantity of each compound still on order: what its lines on open and partially received orders ask for
+// beyond what was received against them. Compounds with nothing on order are left out.
+func OnOrder(ctx context.Context) (map[string]int, error) {
+	rows, err := db.ConnFrom(ctx).QueryContext(ctx, `
+		SELECT l.compound_id, SUM(MAX(l.quantity - l.received_quantity, 0))
+		FROM purchase_order_line l
+		JOIN purchase_order o ON l.purchase_order_id = o.id
+		WHERE o.status IN (?, ?)
+		GROUP BY l.compound_id`,
+		utils.PO_STATUS_OPEN, utils.PO_STATUS_PARTIALLY_RECEIVED,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	onOrder := map[string]int{}
+	for rows.Next() {
+		var compoundId string
+		var quantity int
+		if err := rows.Scan(&compoundId, &quantity); err != nil {
+			return nil, err
+		}
+		if quantity > 0 {
+			onOrder[compoundId] = quantity
+		}
+	}
+	return onOrder, rows.Err()
+}
+
+// Gets the quantity of each compound held by reservations not cancelled and needed on the given day (YYYY-MM-DD) or
+// later. Compounds with nothing reserved are left out.
+func Reserved(ctx context.Context, today string) (map[string]int, error) {
+	rows, err := db.ConnFrom(ctx).QueryContext(ctx, `
+		SELECT compound_id, SUM(quantity)
+		FROM reservation
+		WHERE cancelled_at IS NULL AND needed_on >= ?
+		GROUP BY compound_id`,
+		today,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reserved := map[string]int{}
+	for rows.Next() {
+		var compoundId string
+		var quantity int
+		if err := rows.Scan(&compoundId, &quantity); err != nil {
+			return nil, err
+		}
+		if quantity > 0 {
+			reserved[compoundId] = quantity
+		}
+	}
+	return reserved, rows.Err()
+}
+
+// Gets the current stock of a compound less what is reserved of it on the given day (YYYY-MM-DD), within a
+// transaction so a reservation can be checked against it and made at once
+func Available(ctx context.Context, tx *sql.Tx, compoundId string, today string) (int, error) {
+	var available int
+	err := tx.QueryRowContext(ctx, `
+		SELECT
+			COALESCE((SELECT balance FROM stock_current WHERE compound_id = ?), 0)
+			- COALESCE((SELECT SUM(quantity) FROM reservation WHERE compound_id = ? AND cancelled_at IS NULL AND needed_on >= ?), 0)`,
+		compoundId, compoundId, today,
+	).Scan(&available)
+	return available, err
+}
@@ -0,0 +1,89 @@
+package stock
+
+import (
+	"chemical-ledger-backend/db"
+	"context"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Changes to the stock of a compound read the net stock before them and rewrite the entries after them, so two
+// changes to the same compound must not interleave. Each compound has a mutex for as long as someone holds it.
+var compoundLocks = struct {
+	sync.Mutex
+	held map[string]*compoundLock
+}{held: map[string]*compoundLock{}}
+
+type compoundLock struct {
+	sync.Mutex
+	holders int
+}
+
+// Waits until no other change to the stock of the given compounds is running in this process, and holds them until
+// the returned function is called. Take the lock before the transaction starts reading the stock, and release it
+// once the transaction is over. Compounds are locked in order, so changes spanning several compounds cannot deadlock.
+func LockCompounds(compoundIds ...string) (unlock func()) {
+	ids := slices.Clone(compoundIds)
+	slices.Sort(ids)
+	ids = slices.Compact(ids)
+
+	locks := make([]*compoundLock, len(ids))
+	for i, id := range ids {
+		compoundLocks.Lock()
+		lock, ok := compoundLocks.held[id]
+		if !ok {
+			lock = &compoundLock{}
+			compoundLocks.held[id] = lock
+		}
+		lock.holders++
+		compoundLocks.Unlock()
+
+		lock.Lock()
+		locks[i] = lock
+	}
+
+	return func() {
+		for i := len(ids) - 1; i >= 0; i-- {
+			locks[i].Unlock()
+
+			compoundLocks.Lock()
+			if locks[i].holders--; locks[i].holders == 0 {
+				delete(compoundLocks.held, ids[i])
+			}
+			compoundLocks.Unlock()
+		}
+	}
+}
+
+// Locks the compounds of the given entries, along with any other compounds given, see LockCompounds.
+// Entries that do not exist are left out, they are reported by the change itself.
+func LockEntryCompounds(ctx context.Context, entryIds []string, compoundIds ...string) (unlock func(), err error) {
+	compoundIds = slices.Clone(compoundIds)
+	if len(entryIds) > 0 {
+		args := make([]any, len(entryIds))
+		for i, id := range entryIds {
+			args[i] = id
+		}
+		rows, err := db.ConnFrom(ctx).QueryContext(ctx,
+			"SELECT DISTINCT compound_id FROM entry WHERE id IN (?"+strings.Repeat(", ?", len(entryIds)-1)+")", args...,
+		)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var compoundId string
+			if err := rows.Scan(&compoundId); err != nil {
+				return nil, err
+			}
+			compoundIds = append(compoundIds, compoundId)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	return LockCompounds(compoundIds...), nil
+}
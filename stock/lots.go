@@ -0,0 +1,162 @@
+package stock
+
+import (
+	"chemical-ledger-backend/datetime"
+	"chemical-ledger-backend/utils"
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+)
+
+// Replays all the entries of the given compound in date order and reallocates the outgoing quantities to lots.
+// Incoming entries and adjustments in each make a lot, outgoing entries and adjustments out consume them.
+// Outgoing entries with a lot ID consume from that lot, the rest consume from the oldest open lots first (FIFO).
+// Entries which are not approved or are deleted are left out: their lots hold no stock and they consume none.
+func AllocateLots(ctx context.Context, tx *sql.Tx, compoundId string) utils.ErrorMessage {
+	// Incoming entries which were recorded before lots existed (or moved to this compound) get a lot of their own
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO lot (id, compound_id, entry_id)
+		SELECT 'L_' || substr(e.id, 3), e.compound_id, e.id
+		FROM entry e
+		WHERE e.compound_id = ? AND e.type IN (?, ?) AND NOT EXISTS (
+			SELECT 1 FROM lot l WHERE l.entry_id = e.id
+		)`, compoundId, utils.ENTRY_TYPE_INCOMING, utils.ENTRY_TYPE_ADJUSTMENT_IN,
+	); err != nil {
+		slog.ErrorContext(ctx, "error creating missing lots", "compound_id", compoundId, "error", err)
+		return utils.LOT_ALLOCATION_ERR
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE lot SET compound_id = ?
+		WHERE entry_id IN (SELECT id FROM entry WHERE compound_id = ? AND type IN (?, ?))`,
+		compoundId, compoundId, utils.ENTRY_TYPE_INCOMING, utils.ENTRY_TYPE_ADJUSTMENT_IN,
+	); err != nil {
+		slog.ErrorContext(ctx, "error syncing lot compounds", "compound_id", compoundId, "error", err)
+		return utils.LOT_ALLOCATION_ERR
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM lot
+		WHERE entry_id IN (SELECT id FROM entry WHERE compound_id = ? AND type IN (?, ?, ?))`,
+		compoundId, utils.ENTRY_TYPE_OUTGOING, utils.ENTRY_TYPE_ADJUSTMENT_OUT, utils.ENTRY_TYPE_DISPOSAL,
+	); err != nil {
+		slog.ErrorContext(ctx, "error removing lots of outgoing entries", "compound_id", compoundId, "error", err)
+		return utils.LOT_ALLOCATION_ERR
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM lot_consumption
+		WHERE entry_id IN (SELECT id FROM entry WHERE compound_id = ?)
+			OR lot_id IN (SELECT id FROM lot WHERE compound_id = ?)`,
+		compoundId, compoundId,
+	); err != nil {
+		slog.ErrorContext(ctx, "error clearing lot consumption", "compound_id", compoundId, "error", err)
+		return utils.LOT_ALLOCATION_ERR
+	}
+
+	// Under the same-day grace, issues can draw on deliveries recorded later the same day, so each day's
+	// deliveries are allocated before its issues, and today's issues may be left short for now
+	grace := SameDayStockGrace()
+	order, args := "e.date ASC, e.seq ASC", []any{compoundId, utils.ENTRY_STATUS_APPROVED}
+	if grace {
+		order = "date(e.date, 'unixepoch', 'localtime') ASC, e.type NOT IN (?, ?) ASC, e.date ASC, e.seq ASC"
+		args = append(args, utils.ENTRY_TYPE_INCOMING, utils.ENTRY_TYPE_ADJUSTMENT_IN)
+	}
+	today := stockDay(datetime.Now(ctx).Unix())
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT e.id, e.type, q.total_quantity, e.date, COALESCE(e.lot_id, ''), COALESCE(l.id, '')
+		FROM entry e
+		JOIN quantity q ON e.quantity_id = q.id
+		LEFT JOIN lot l ON l.entry_id = e.id
+		WHERE e.compound_id = ? AND e.status = ? AND e.deleted_at IS NULL
+		ORDER BY `+order, args...)
+	if err != nil {
+		slog.ErrorContext(ctx, "error retrieving entries for lot allocation", "compound_id", compoundId, "error", err)
+		return utils.ENTRY_RETRIEVAL_ERR
+	}
+
+	type movement struct {
+		EntryId   string
+		Type      string
+		Quantity  int
+		Date      int64
+		PinnedLot string
+		OwnLot    string
+	}
+
+	var movements []movement
+	for rows.Next() {
+		var m movement
+		if err := rows.Scan(&m.EntryId, &m.Type, &m.Quantity, &m.Date, &m.PinnedLot, &m.OwnLot); err != nil {
+			rows.Close()
+			return utils.ENTRY_UPDATE_SCAN_ERR
+		}
+		movements = append(movements, m)
+	}
+	rows.Close()
+
+	openLots := []string{}
+	remaining := map[string]int{}
+	consumption := map[string]map[string]int{}
+
+	for _, m := range movements {
+		if utils.IsInwardEntryType(m.Type) {
+			openLots = append(openLots, m.OwnLot)
+			remaining[m.OwnLot] = m.Quantity
+			continue
+		}
+		// Transfers move stock between locations, the lots stay as they are
+		if !utils.IsOutwardEntryType(m.Type) {
+			continue
+		}
+
+		consumed := map[string]int{}
+		if m.PinnedLot != "" {
+			stock, ok := remaining[m.PinnedLot]
+			if !ok {
+				slog.ErrorContext(ctx, "pinned lot not available", "entry_id", m.EntryId, "lot_id", m.PinnedLot)
+				return utils.INVALID_LOT_ID
+			}
+			if stock < m.Quantity {
+				slog.ErrorContext(ctx, "insufficient stock in pinned lot", "entry_id", m.EntryId, "lot_id", m.PinnedLot, "stock", stock)
+				return utils.INSUFFICIENT_LOT_STOCK_ERR
+			}
+			remaining[m.PinnedLot] -= m.Quantity
+			consumed[m.PinnedLot] = m.Quantity
+		} else {
+			need := m.Quantity
+			for _, lotId := range openLots {
+				if need == 0 {
+					break
+				}
+				take := min(remaining[lotId], need)
+				if take == 0 {
+					continue
+				}
+				remaining[lotId] -= take
+				consumed[lotId] = take
+				need -= take
+			}
+			if need > 0 && !(grace && stockDay(m.Date) == today) {
+				return utils.INSUFFICIENT_STOCK_ERR
+			}
+		}
+		consumption[m.EntryId] = consumed
+	}
+
+	for entryId, lots := range consumption {
+		for lotId, quantity := range lots {
+			if _, err := tx.ExecContext(ctx,
+				"INSERT INTO lot_consumption (entry_id, lot_id, quantity) VALUES (?, ?, ?)",
+				entryId, lotId, quantity,
+			); err != nil {
+				slog.ErrorContext(ctx, fmt.Sprintf("Error recording consumption of lot '%s' by entry '%s': %v", lotId, entryId, err))
+				return utils.LOT_ALLOCATION_ERR
+			}
+		}
+	}
+
+	return utils.NO_ERR
+}
@@ -0,0 +1,198 @@
+// Package stock keeps the running net stock of the entries, the current stock of compounds and their lots in step
+// with the ledger, and serializes the changes made to a compound.
+package stock
+
+import (
+	"chemical-ledger-backend/datetime"
+	"chemical-ledger-backend/retry"
+	"chemical-ledger-backend/utils"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("chemical-ledger-backend/stock")
+
+func UpdateNetStockFromTodayOnwards(ctx context.Context, tx *sql.Tx, compoundId string, date int64) utils.ErrorMessage {
+	return updateNetStock(ctx, tx, compoundId, date, false)
+}
+
+// Same as UpdateNetStockFromTodayOnwards, for changes the user confirmed may leave the stock short within a day
+// under the same-day grace, see SameDayStockGrace.
+func UpdateNetStockConfirmingShortfall(ctx context.Context, tx *sql.Tx, compoundId string, date int64) utils.ErrorMessage {
+	return updateNetStock(ctx, tx, compoundId, date, true)
+}
+
+// Traced as "stock.UpdateNetStock" with the number of entries recalculated, to tell which compounds take long
+func updateNetStock(ctx context.Context, tx *sql.Tx, compoundId string, date int64, shortfallConfirmed bool) (errStr utils.ErrorMessage) {
+	ctx, span := tracer.Start(ctx, "stock.UpdateNetStock", trace.WithAttributes(
+		attribute.String("compound_id", compoundId),
+		attribute.Int64("from_date", date),
+		attribute.Bool("shortfall_confirmed", shortfallConfirmed),
+	))
+	recalculated := 0
+	defer func() {
+		span.SetAttributes(attribute.Int("entries", recalculated))
+		if errStr != utils.NO_ERR {
+			span.SetStatus(codes.Error, string(errStr))
+		}
+		span.End()
+	}()
+
+	var netStock int
+	var previousDate int64
+	err := retry.Once(func() error {
+		err := tx.QueryRowContext(ctx, "SELECT net_stock, date FROM entry WHERE compound_id = ? AND date < ? AND deleted_at IS NULL ORDER BY date DESC, seq DESC LIMIT 1", compoundId, date).Scan(&netStock, &previousDate)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return errors.New("error retrieving previous stock")
+		}
+		return nil
+	})
+
+	if err != nil {
+		slog.ErrorContext(ctx, fmt.Sprintf("Error retrieving previous stock for compound '%s': %v", compoundId, err))
+		return utils.STOCK_RETRIEVAL_ERR
+	}
+
+	locations, err := locationStockBefore(ctx, tx, compoundId, date)
+	if err != nil {
+		slog.ErrorContext(ctx, "error retrieving previous stock per location", "compound_id", compoundId, "error", err)
+		return utils.STOCK_RETRIEVAL_ERR
+	}
+
+	var rows *sql.Rows
+	err = retry.Once(func() error {
+		var queryErr error
+		rows, queryErr = tx.QueryContext(ctx, `
+SELECT
+	e.id,
+	e.type,
+	q.total_quantity,
+	e.date,
+	e.status,
+	COALESCE(e.location_id, ''),
+	COALESCE(e.to_location_id, '')
+FROM entry e
+JOIN quantity q ON e.quantity_id = q.id
+WHERE
+	e.compound_id = ? AND e.date >= ? AND e.deleted_at IS NULL
+ORDER BY
+	e.date ASC, e.seq ASC
+		`, compoundId, date)
+		return queryErr
+	})
+
+	if err != nil {
+		slog.ErrorContext(ctx, fmt.Sprintf("Error retrieving subsequent entries for compound '%s': %v", compoundId, err))
+		return utils.ENTRY_RETRIEVAL_ERR
+	}
+
+	defer rows.Close()
+
+	// Under the same-day grace, the stock is checked at the end of each day rather than after each entry
+	grace := SameDayStockGrace()
+	today := stockDay(datetime.Now(ctx).Unix())
+	day := stockDay(previousDate)
+	shortWithinDay := false
+
+	var updateQueriesBuilder strings.Builder
+	for rows.Next() {
+		var entry struct {
+			Id         string
+			Type       string
+			Quantity   int
+			Date       int
+			Status     string
+			Location   string
+			ToLocation string
+		}
+		err := rows.Scan(&entry.Id, &entry.Type, &entry.Quantity, &entry.Date, &entry.Status, &entry.Location, &entry.ToLocation)
+		if err != nil {
+			return utils.ENTRY_UPDATE_SCAN_ERR
+		}
+
+		if entryDay := stockDay(int64(entry.Date)); grace && entryDay != day {
+			if errStr := stockShortage(netStock, locations); errStr != utils.NO_ERR {
+				return errStr
+			}
+			day = entryDay
+		}
+
+		// Pending and rejected entries do not move the stock, they carry the stock left by the entries before them.
+		// Transfers only move it between locations.
+		switch {
+		case entry.Status != utils.ENTRY_STATUS_APPROVED:
+		case utils.IsInwardEntryType(entry.Type):
+			netStock += entry.Quantity
+			locations[entry.Location] += entry.Quantity
+		case utils.IsOutwardEntryType(entry.Type):
+			netStock -= entry.Quantity
+			locations[entry.Location] -= entry.Quantity
+		case entry.Type == utils.ENTRY_TYPE_TRANSFER:
+			locations[entry.Location] -= entry.Quantity
+			locations[entry.ToLocation] += entry.Quantity
+		}
+
+		if errStr := stockShortage(netStock, locations); errStr != utils.NO_ERR {
+			if !grace {
+				return errStr
+			}
+			shortWithinDay = true
+		}
+		updateQueriesBuilder.WriteString(fmt.Sprintf("UPDATE entry SET net_stock = %d WHERE id = '%s';\n", netStock, entry.Id))
+		recalculated++
+	}
+
+	// The last day may only be left short while it is still today
+	if errStr := stockShortage(netStock, locations); grace && errStr != utils.NO_ERR && day != today {
+		return errStr
+	}
+	if shortWithinDay && !shortfallConfirmed {
+		return utils.SAME_DAY_STOCK_SHORTFALL_ERR
+	}
+
+	updateQueries := updateQueriesBuilder.String()
+	if updateQueries != "" {
+		_, err = tx.ExecContext(ctx, updateQueries)
+		if err != nil {
+			return utils.SUBSEQUENT_UPDATE_ERR
+		}
+	}
+
+	if err := RefreshStockCurrent(ctx, tx, compoundId); err != nil {
+		slog.ErrorContext(ctx, "failed to refresh current stock", "compound_id", compoundId, "error", err)
+		return utils.STOCK_CURRENT_UPDATE_ERR
+	}
+	if err := RefreshStockLocations(ctx, tx, compoundId); err != nil {
+		slog.ErrorContext(ctx, "failed to refresh stock per location", "compound_id", compoundId, "error", err)
+		return utils.STOCK_CURRENT_UPDATE_ERR
+	}
+	if err := RefreshPurchaseOrders(ctx, tx, compoundId); err != nil {
+		slog.ErrorContext(ctx, "failed to refresh purchase orders", "compound_id", compoundId, "error", err)
+		return utils.PURCHASE_ORDER_UPDATE_ERR
+	}
+
+	return AllocateLots(ctx, tx, compoundId)
+}
+
+// Recalculates the net stock after an entry moved from the old compound and date to the new ones. The old compound
+// is recalculated from where the entry left, the new compound from the earliest date the entry affected.
+// When the user confirmed it, the change may leave the stock short within a day, see SameDayStockGrace.
+func RecalculateAfterEntryChange(ctx context.Context, tx *sql.Tx, oldCompoundId string, oldDate int64, newCompoundId string, newDate int64, shortfallConfirmed bool) utils.ErrorMessage {
+	if oldCompoundId != newCompoundId {
+		if errStr := updateNetStock(ctx, tx, oldCompoundId, oldDate, shortfallConfirmed); errStr != utils.NO_ERR {
+			return errStr
+		}
+		return updateNetStock(ctx, tx, newCompoundId, newDate, shortfallConfirmed)
+	}
+
+	return updateNetStock(ctx, tx, newCompoundId, min(oldDate, newDate), shortfallConfirmed)
+}
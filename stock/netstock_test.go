@@ -0,0 +1,244 @@
+package stock_test
+
+import (
+	"chemical-ledger-backend/stock"
+	"chemical-ledger-backend/testutils"
+	"chemical-ledger-backend/utils"
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand/v2"
+	"testing"
+)
+
+// Applies random operations to the ledger the same way the handlers do, checking every compound against the
+// replay oracle after each one
+type randomLedger struct {
+	t         *testing.T
+	conn      *sql.DB
+	rng       *rand.Rand
+	compounds []string
+	entries   []string
+	pending   []string
+	dates     map[int64]bool
+	nextId    int
+}
+
+const ledgerStart = int64(1767225600) // 2026-01-01 00:00:00 UTC
+
+func newRandomLedger(t *testing.T, conn *sql.DB, seed uint64) *randomLedger {
+	l := &randomLedger{
+		t:         t,
+		conn:      conn,
+		rng:       rand.New(rand.NewPCG(seed, seed)),
+		compounds: []string{"C_1", "C_2"},
+		dates:     map[int64]bool{},
+	}
+	for _, id := range l.compounds {
+		testutils.InsertCompoundIn(t, conn, id, id, "g")
+	}
+	return l
+}
+
+// Dates are kept unique, ties between entries of the same second are not what this oracle checks
+func (l *randomLedger) uniqueDate() int64 {
+	for {
+		date := ledgerStart + l.rng.Int64N(90*24*60*60)
+		if !l.dates[date] {
+			l.dates[date] = true
+			return date
+		}
+	}
+}
+
+func (l *randomLedger) randomType() string {
+	if l.rng.IntN(5) < 3 {
+		return utils.ENTRY_TYPE_INCOMING
+	}
+	return utils.ENTRY_TYPE_OUTGOING
+}
+
+func (l *randomLedger) finish(errStr utils.ErrorMessage, commit func() error, rollback func() error) bool {
+	if errStr == utils.INSUFFICIENT_STOCK_ERR {
+		rollback()
+		return false
+	}
+	if errStr != utils.NO_ERR {
+		l.t.Fatalf("recalculation failed: %s", errStr)
+	}
+	if err := commit(); err != nil {
+		l.t.Fatalf("failed to commit: %v", err)
+	}
+	return true
+}
+
+func (l *randomLedger) insert() {
+	l.nextId++
+	entryId := fmt.Sprintf("E_%d", l.nextId)
+	quantityId := fmt.Sprintf("Q_%d", l.nextId)
+	compoundId := l.compounds[l.rng.IntN(len(l.compounds))]
+	units, perUnit := 1+l.rng.IntN(5), 1+l.rng.IntN(20)
+	date := l.uniqueDate()
+	status := utils.ENTRY_STATUS_APPROVED
+	if l.rng.IntN(4) == 0 {
+		status = utils.ENTRY_STATUS_PENDING
+	}
+
+	tx, err := l.conn.Begin()
+	if err != nil {
+		l.t.Fatalf("failed to begin transaction: %v", err)
+	}
+	if _, err := tx.Exec("INSERT INTO quantity (id, num_of_units, quantity_per_unit) VALUES (?, ?, ?)", quantityId, units, perUnit); err != nil {
+		l.t.Fatalf("failed to insert quantity: %v", err)
+	}
+	if _, err := tx.Exec(
+		"INSERT INTO entry (id, type, compound_id, date, remark, voucher_no, quantity_id, net_stock, status, seq) VALUES (?, ?, ?, ?, '', '', ?, ?, ?, "+utils.NEXT_ENTRY_SEQ+")",
+		entryId, l.randomType(), compoundId, date, quantityId, units*perUnit, status,
+	); err != nil {
+		l.t.Fatalf("failed to insert entry: %v", err)
+	}
+
+	if l.finish(stock.UpdateNetStockFromTodayOnwards(context.Background(), tx, compoundId, date), tx.Commit, tx.Rollback) {
+		l.entries = append(l.entries, entryId)
+		if status == utils.ENTRY_STATUS_PENDING {
+			l.pending = append(l.pending, entryId)
+		}
+	}
+}
+
+// Approves or rejects a pending entry, approvals that would leave too little stock are rolled back
+func (l *randomLedger) review() {
+	if len(l.pending) == 0 {
+		return
+	}
+	i := l.rng.IntN(len(l.pending))
+	entryId := l.pending[i]
+
+	status := utils.ENTRY_STATUS_APPROVED
+	if l.rng.IntN(3) == 0 {
+		status = utils.ENTRY_STATUS_REJECTED
+	}
+
+	var compoundId string
+	var date int64
+	if err := l.conn.QueryRow("SELECT compound_id, date FROM entry WHERE id = ?", entryId).Scan(&compoundId, &date); err != nil {
+		l.t.Fatalf("failed to read entry %q: %v", entryId, err)
+	}
+
+	tx, err := l.conn.Begin()
+	if err != nil {
+		l.t.Fatalf("failed to begin transaction: %v", err)
+	}
+	if _, err := tx.Exec("UPDATE entry SET status = ? WHERE id = ?", status, entryId); err != nil {
+		l.t.Fatalf("failed to review entry: %v", err)
+	}
+
+	if l.finish(stock.UpdateNetStockFromTodayOnwards(context.Background(), tx, compoundId, date), tx.Commit, tx.Rollback) {
+		l.pending = append(l.pending[:i], l.pending[i+1:]...)
+	}
+}
+
+func (l *randomLedger) update() {
+	if len(l.entries) == 0 {
+		return
+	}
+	entryId := l.entries[l.rng.IntN(len(l.entries))]
+
+	var entryType, compoundId, quantityId string
+	var date int64
+	if err := l.conn.QueryRow("SELECT type, compound_id, quantity_id, date FROM entry WHERE id = ?", entryId).
+		Scan(&entryType, &compoundId, &quantityId, &date); err != nil {
+		l.t.Fatalf("failed to read entry %q: %v", entryId, err)
+	}
+
+	newType, newCompoundId, newDate := entryType, compoundId, date
+	if l.rng.IntN(2) == 0 {
+		newType = l.randomType()
+	}
+	if l.rng.IntN(3) == 0 {
+		newCompoundId = l.compounds[l.rng.IntN(len(l.compounds))]
+	}
+	if l.rng.IntN(2) == 0 {
+		newDate = l.uniqueDate()
+	}
+	units, perUnit := 1+l.rng.IntN(5), 1+l.rng.IntN(20)
+
+	tx, err := l.conn.Begin()
+	if err != nil {
+		l.t.Fatalf("failed to begin transaction: %v", err)
+	}
+	if _, err := tx.Exec("UPDATE quantity SET num_of_units = ?, quantity_per_unit = ? WHERE id = ?", units, perUnit, quantityId); err != nil {
+		l.t.Fatalf("failed to update quantity: %v", err)
+	}
+	if _, err := tx.Exec(
+		"UPDATE entry SET type = ?, compound_id = ?, date = ?, net_stock = ? WHERE id = ?",
+		newType, newCompoundId, newDate, units*perUnit, entryId,
+	); err != nil {
+		l.t.Fatalf("failed to update entry: %v", err)
+	}
+
+	l.finish(stock.RecalculateAfterEntryChange(context.Background(), tx, compoundId, date, newCompoundId, newDate, false), tx.Commit, tx.Rollback)
+}
+
+// Moves an entry to the trash or restores it, either is rolled back when it would leave too little stock
+func (l *randomLedger) toggleDeleted() {
+	if len(l.entries) == 0 {
+		return
+	}
+	entryId := l.entries[l.rng.IntN(len(l.entries))]
+
+	var compoundId string
+	var date int64
+	if err := l.conn.QueryRow("SELECT compound_id, date FROM entry WHERE id = ?", entryId).Scan(&compoundId, &date); err != nil {
+		l.t.Fatalf("failed to read entry %q: %v", entryId, err)
+	}
+
+	tx, err := l.conn.Begin()
+	if err != nil {
+		l.t.Fatalf("failed to begin transaction: %v", err)
+	}
+	if _, err := tx.Exec("UPDATE entry SET deleted_at = CASE WHEN deleted_at IS NULL THEN ? END WHERE id = ?", date, entryId); err != nil {
+		l.t.Fatalf("failed to toggle entry deletion: %v", err)
+	}
+
+	l.finish(stock.UpdateNetStockFromTodayOnwards(context.Background(), tx, compoundId, date), tx.Commit, tx.Rollback)
+}
+
+func (l *randomLedger) assertNetStock() {
+	l.t.Helper()
+	for _, compoundId := range l.compounds {
+		testutils.AssertNetStockIn(l.t, context.Background(), l.conn, compoundId)
+	}
+}
+
+func TestNetStockMatchesReplayAfterRandomOperations(t *testing.T) {
+	const (
+		seeds        = 30
+		opsPerLedger = 60
+	)
+
+	for seed := uint64(1); seed <= seeds; seed++ {
+		t.Run(fmt.Sprintf("seed=%d", seed), func(t *testing.T) {
+			// Every ledger has a database of its own, so they are checked side by side
+			t.Parallel()
+
+			l := newRandomLedger(t, testutils.NewTestDB(t), seed)
+			for op := 0; op < opsPerLedger; op++ {
+				switch l.rng.IntN(7) {
+				case 0, 1:
+					l.update()
+				case 2:
+					l.review()
+				case 3:
+					l.toggleDeleted()
+				default:
+					l.insert()
+				}
+				l.assertNetStock()
+				if t.Failed() {
+					t.Fatalf("net stock diverged from the replay after operation %d", op)
+				}
+			}
+		})
+	}
+}
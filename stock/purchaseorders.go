@@ -0,0 +1,44 @@
+package stock
+
+import (
+	"chemical-ledger-backend/utils"
+	"context"
+	"database/sql"
+)
+
+// Purchase order lines hold the quantity received against them, from the approved deliveries naming them, and
+// purchase orders the status that follows from their lines. Both are refreshed along with the net stock of the
+// compound of the lines, so approving, updating, deleting and restoring a delivery keeps them in step.
+
+// Refreshes the quantities received against the purchase order lines of a compound and the status of their orders,
+// within the transaction that changed its stock. Cancelled orders stay cancelled.
+func RefreshPurchaseOrders(ctx context.Context, tx *sql.Tx, compoundId string) error {
+	_, err := tx.ExecContext(ctx, `
+		UPDATE purchase_order_line SET received_quantity = COALESCE((
+			SELECT SUM(q.total_quantity)
+			FROM entry e
+			JOIN quantity q ON e.quantity_id = q.id
+			WHERE e.po_line_id = purchase_order_line.id AND e.type = ? AND e.status = ? AND e.deleted_at IS NULL
+		), 0)
+		WHERE compound_id = ?`,
+		utils.ENTRY_TYPE_INCOMING, utils.ENTRY_STATUS_APPROVED, compoundId,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE purchase_order SET status = CASE
+			WHEN NOT EXISTS (
+				SELECT 1 FROM purchase_order_line l WHERE l.purchase_order_id = purchase_order.id AND l.received_quantity < l.quantity
+			) THEN ?
+			WHEN EXISTS (
+				SELECT 1 FROM purchase_order_line l WHERE l.purchase_order_id = purchase_order.id AND l.received_quantity > 0
+			) THEN ?
+			ELSE ?
+		END
+		WHERE status != ? AND id IN (SELECT purchase_order_id FROM purchase_order_line WHERE compound_id = ?)`,
+		utils.PO_STATUS_RECEIVED, utils.PO_STATUS_PARTIALLY_RECEIVED, utils.PO_STATUS_OPEN, utils.PO_STATUS_CANCELLED, compoundId,
+	)
+	return err
+}
@@ -0,0 +1,82 @@
+package stock
+
+import (
+	"chemical-ledger-backend/db"
+	"context"
+	"database/sql"
+)
+
+// The "stock_current" table holds the stock of each compound as of its last entry, so the current stock can be
+// looked up instead of searched for among the entries. Compounds without entries have no row and hold no stock.
+// It is refreshed along with the net stock of the entries, in the same transaction, and rebuilt from the entries
+// at startup and by admins.
+
+// Refreshes the current stock of a compound from its last entry, within the transaction that changed its stock
+func RefreshStockCurrent(ctx context.Context, tx *sql.Tx, compoundId string) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM stock_current WHERE compound_id = ?", compoundId); err != nil {
+		return err
+	}
+
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO stock_current (compound_id, balance, last_entry_at)
+		SELECT compound_id, net_stock, date FROM entry
+		WHERE compound_id = ? AND deleted_at IS NULL
+		ORDER BY date DESC, seq DESC
+		LIMIT 1`,
+		compoundId,
+	)
+	return err
+}
+
+// Rebuilds the current stock of every compound, and its stock per location, from the entries. Returns how many compounds there is stock of,
+// and how many of them were out of step with their entries and got corrected.
+func RebuildStockCurrent(ctx context.Context) (compounds int, corrected int, err error) {
+	tx, err := db.ConnFrom(ctx).BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	const latestQuery = `
+		SELECT compound_id, net_stock, date FROM (
+			SELECT
+				compound_id, net_stock, date,
+				ROW_NUMBER() OVER (PARTITION BY compound_id ORDER BY date DESC, seq DESC) AS recency
+			FROM entry
+			WHERE deleted_at IS NULL
+		)
+		WHERE recency = 1`
+
+	// Rows that differ from the entries, are missing or are left over from compounds whose entries are all gone
+	err = tx.QueryRowContext(ctx, `
+		SELECT
+			(SELECT COUNT(*) FROM (`+latestQuery+`) l
+				LEFT JOIN stock_current s ON s.compound_id = l.compound_id
+				WHERE s.compound_id IS NULL OR s.balance != l.net_stock OR s.last_entry_at != l.date)
+			+ (SELECT COUNT(*) FROM stock_current s
+				WHERE NOT EXISTS (SELECT 1 FROM entry e WHERE e.compound_id = s.compound_id AND e.deleted_at IS NULL))`,
+	).Scan(&corrected)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM stock_current"); err != nil {
+		return 0, 0, err
+	}
+	result, err := tx.ExecContext(ctx, "INSERT INTO stock_current (compound_id, balance, last_entry_at) "+latestQuery)
+	if err != nil {
+		return 0, 0, err
+	}
+	rebuilt, err := result.RowsAffected()
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := rebuildStockLocations(ctx, tx); err != nil {
+		return 0, 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, 0, err
+	}
+	return int(rebuilt), corrected, nil
+}
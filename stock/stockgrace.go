@@ -0,0 +1,19 @@
+package stock
+
+import (
+	"chemical-ledger-backend/utils"
+	"time"
+)
+
+// Deliveries and issues of the same day often get recorded out of order, the issue before the delivery it was
+// drawn from. With SAME_DAY_STOCK_GRACE set, the stock is only required to last until the end of each day: it may
+// run short in between, and today may be left short until the rest of its entries are in. Leaving the stock short
+// needs the user to confirm it, see UpdateNetStockConfirmingShortfall. Unset, every entry must leave stock.
+func SameDayStockGrace() bool {
+	return utils.GetEnvBool("SAME_DAY_STOCK_GRACE", false)
+}
+
+// Local day the given entry date falls on
+func stockDay(date int64) string {
+	return time.Unix(date, 0).Local().Format("2006-01-02")
+}
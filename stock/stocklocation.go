@@ -0,0 +1,106 @@
+package stock
+
+import (
+	"chemical-ledger-backend/utils"
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// The "stock_location" table holds the stock of each compound per location, as moved by the approved entries:
+// deliveries add to their location, issues take from theirs and transfers move stock from their location to
+// "to_location_id". Entries without a location count towards the location "", so a ledger that does not use
+// locations keeps all of its stock there. Locations without stock of a compound have no row. Like "stock_current"
+// it is refreshed along with the net stock of the entries and rebuilt with it.
+
+// Query of what every approved entry matching the condition moves the stock of a location by, one row per
+// location moved with compound_id, location_id, quantity and the entry date, and its arguments.
+// The condition is appended to the WHERE clauses, so it must start with AND and use "e." for the entry.
+func LocationMovesQuery(condition string, conditionArgs ...any) (string, []any) {
+	query := fmt.Sprintf(`
+		SELECT
+			e.compound_id, COALESCE(e.location_id, '') AS location_id,
+			CASE WHEN e.type IN (?, ?) THEN q.total_quantity ELSE -q.total_quantity END AS quantity,
+			e.date
+		FROM entry e
+		JOIN quantity q ON e.quantity_id = q.id
+		WHERE e.status = ? AND e.deleted_at IS NULL %[1]s
+		UNION ALL
+		SELECT e.compound_id, e.to_location_id, q.total_quantity, e.date
+		FROM entry e
+		JOIN quantity q ON e.quantity_id = q.id
+		WHERE e.type = ? AND e.status = ? AND e.deleted_at IS NULL %[1]s`, condition)
+
+	args := []any{utils.ENTRY_TYPE_INCOMING, utils.ENTRY_TYPE_ADJUSTMENT_IN, utils.ENTRY_STATUS_APPROVED}
+	args = append(args, conditionArgs...)
+	args = append(args, utils.ENTRY_TYPE_TRANSFER, utils.ENTRY_STATUS_APPROVED)
+	return query, append(args, conditionArgs...)
+}
+
+// Stock of a compound per location left by its entries before the given date
+func locationStockBefore(ctx context.Context, tx *sql.Tx, compoundId string, date int64) (map[string]int, error) {
+	moves, args := LocationMovesQuery("AND e.compound_id = ? AND e.date < ?", compoundId, date)
+	rows, err := tx.QueryContext(ctx, "SELECT location_id, SUM(quantity) FROM ("+moves+") GROUP BY location_id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	balances := map[string]int{}
+	for rows.Next() {
+		var locationId string
+		var balance int
+		if err := rows.Scan(&locationId, &balance); err != nil {
+			return nil, err
+		}
+		balances[locationId] = balance
+	}
+	return balances, rows.Err()
+}
+
+// Refreshes the stock of a compound per location from its entries, within the transaction that changed its stock
+func RefreshStockLocations(ctx context.Context, tx *sql.Tx, compoundId string) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM stock_location WHERE compound_id = ?", compoundId); err != nil {
+		return err
+	}
+
+	moves, args := LocationMovesQuery("AND e.compound_id = ?", compoundId)
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO stock_location (compound_id, location_id, balance)
+		SELECT compound_id, location_id, SUM(quantity) FROM (`+moves+`)
+		GROUP BY compound_id, location_id
+		HAVING SUM(quantity) != 0`,
+		args...,
+	)
+	return err
+}
+
+// Rebuilds the stock of every compound per location from the entries
+func rebuildStockLocations(ctx context.Context, tx *sql.Tx) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM stock_location"); err != nil {
+		return err
+	}
+
+	moves, args := LocationMovesQuery("")
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO stock_location (compound_id, location_id, balance)
+		SELECT compound_id, location_id, SUM(quantity) FROM (`+moves+`)
+		GROUP BY compound_id, location_id
+		HAVING SUM(quantity) != 0`,
+		args...,
+	)
+	return err
+}
+
+// Error for the first shortage among the stock of a compound and its stock per location, if any
+func stockShortage(netStock int, locations map[string]int) utils.ErrorMessage {
+	if netStock < 0 {
+		return utils.INSUFFICIENT_STOCK_ERR
+	}
+	for _, balance := range locations {
+		if balance < 0 {
+			return utils.INSUFFICIENT_LOCATION_STOCK_ERR
+		}
+	}
+	return utils.NO_ERR
+}
@@ -0,0 +1,171 @@
+package stock
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/utils"
+	"context"
+	"math"
+)
+
+// Value of the current stock of a compound
+type CompoundValuation struct {
+	CompoundId string `json:"compound_id"`
+	Name       string `json:"name"`
+	Scale      string `json:"scale"`
+	Quantity   int    `json:"quantity"`
+	// Value of one unit of the scale, e.g. of 1 ml
+	UnitCost float64 `json:"unit_cost"`
+	Value    float64 `json:"value"`
+	// Stock no cost is known for, which is left out of the value
+	UncostedQuantity int `json:"uncosted_quantity"`
+}
+
+// Values the current stock of every compound that has stock, or of one compound, with the given method.
+// Deliveries are costed by their "unit_cost", the cost of one unit as delivered. Stock that came in without a cost,
+// e.g. by an adjustment, is valued at the average cost of the compound, and is uncosted while the compound has none.
+func ValueStock(ctx context.Context, method string, compoundId string) ([]CompoundValuation, error) {
+	query := `
+		SELECT
+			c.id, c.name, c.scale, e.id, e.type, q.total_quantity,
+			e.unit_cost / NULLIF(q.packs_per_unit * q.quantity_per_unit, 0)
+		FROM entry e
+		JOIN compound c ON e.compound_id = c.id
+		JOIN quantity q ON e.quantity_id = q.id
+		WHERE e.status = ? AND e.deleted_at IS NULL AND e.type != ?`
+	args := []any{utils.ENTRY_STATUS_APPROVED, utils.ENTRY_TYPE_TRANSFER}
+	if compoundId != "" {
+		query += " AND e.compound_id = ?"
+		args = append(args, compoundId)
+	}
+	query += " ORDER BY c.lower_case_name ASC, c.id ASC, e.date ASC, e.seq ASC"
+
+	rows, err := db.ConnFrom(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// The moving average: each costed delivery averages its cost in with the stock it adds to
+	type compoundCost struct {
+		valuation *CompoundValuation
+		average   float64
+		costKnown bool
+		entryCost map[string]float64
+	}
+	costs := []*compoundCost{}
+	var current *compoundCost
+	for rows.Next() {
+		var id, name, scale, entryId, entryType string
+		var quantity int
+		var cost *float64
+		if err := rows.Scan(&id, &name, &scale, &entryId, &entryType, &quantity, &cost); err != nil {
+			return nil, err
+		}
+		if current == nil || current.valuation.CompoundId != id {
+			current = &compoundCost{
+				valuation: &CompoundValuation{CompoundId: id, Name: name, Scale: scale},
+				entryCost: map[string]float64{},
+			}
+			costs = append(costs, current)
+		}
+
+		v := current.valuation
+		switch {
+		case utils.IsInwardEntryType(entryType) && cost != nil:
+			if v.Quantity > 0 && current.costKnown {
+				current.average = (float64(v.Quantity)*current.average + float64(quantity)**cost) / float64(v.Quantity+quantity)
+			} else {
+				current.average = *cost
+			}
+			current.costKnown = true
+			current.entryCost[entryId] = *cost
+			v.Quantity += quantity
+		case utils.IsInwardEntryType(entryType):
+			v.Quantity += quantity
+		case utils.IsOutwardEntryType(entryType):
+			v.Quantity -= quantity
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var lotStock map[string][]lotRemaining
+	if method == utils.VALUATION_FIFO {
+		if lotStock, err = remainingLotStock(ctx, compoundId); err != nil {
+			return nil, err
+		}
+	}
+
+	valuations := []CompoundValuation{}
+	for _, c := range costs {
+		v := c.valuation
+		if v.Quantity == 0 {
+			continue
+		}
+
+		if method == utils.VALUATION_FIFO {
+			for _, lot := range lotStock[v.CompoundId] {
+				if cost, ok := c.entryCost[lot.entryId]; ok {
+					v.Value += float64(lot.remaining) * cost
+				} else if c.costKnown {
+					v.Value += float64(lot.remaining) * c.average
+				} else {
+					v.UncostedQuantity += lot.remaining
+				}
+			}
+		} else if c.costKnown {
+			v.Value = float64(v.Quantity) * c.average
+		} else {
+			v.UncostedQuantity = v.Quantity
+		}
+
+		if costed := v.Quantity - v.UncostedQuantity; costed > 0 {
+			v.UnitCost = math.Round(v.Value/float64(costed)*10000) / 10000
+		}
+		v.Value = math.Round(v.Value*100) / 100
+		valuations = append(valuations, *v)
+	}
+	return valuations, nil
+}
+
+type lotRemaining struct {
+	entryId   string
+	remaining int
+}
+
+// Stock left in the lots of every compound, or of one compound, keyed by compound ID
+func remainingLotStock(ctx context.Context, compoundId string) (map[string][]lotRemaining, error) {
+	query := `
+		SELECT l.compound_id, e.id, q.total_quantity - COALESCE((
+			SELECT SUM(lc.quantity) FROM lot_consumption lc WHERE lc.lot_id = l.id
+		), 0)
+		FROM lot l
+		JOIN entry e ON l.entry_id = e.id
+		JOIN quantity q ON e.quantity_id = q.id
+		WHERE e.status = ? AND e.deleted_at IS NULL`
+	args := []any{utils.ENTRY_STATUS_APPROVED}
+	if compoundId != "" {
+		query += " AND l.compound_id = ?"
+		args = append(args, compoundId)
+	}
+
+	rows, err := db.ConnFrom(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lots := map[string][]lotRemaining{}
+	for rows.Next() {
+		var id string
+		var lot lotRemaining
+		if err := rows.Scan(&id, &lot.entryId, &lot.remaining); err != nil {
+			return nil, err
+		}
+		if lot.remaining > 0 {
+			lots[id] = append(lots[id], lot)
+		}
+	}
+	return lots, rows.Err()
+}
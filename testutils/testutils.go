@@ -0,0 +1,287 @@
+// Package testutils holds the helpers shared by the tests: a throwaway database, a fixed clock and IDs, and an independent
+// net stock oracle to check the ledger against.
+package testutils
+
+import (
+	"chemical-ledger-backend/datetime"
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/stock"
+	"chemical-ledger-backend/utils"
+	"context"
+	"database/sql"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	ENTRY_TYPE_INCOMING = "incoming"
+	ENTRY_TYPE_OUTGOING = "outgoing"
+
+	ENTRY_TYPE_ADJUSTMENT_IN  = "adjustment-in"
+	ENTRY_TYPE_ADJUSTMENT_OUT = "adjustment-out"
+	ENTRY_TYPE_DISPOSAL       = "disposal"
+	ENTRY_TYPE_TRANSFER       = "transfer"
+
+	ENTRY_STATUS_APPROVED = "approved"
+)
+
+// Opens a fresh database in a temporary directory of its own, closed when the test ends. It is not assigned to
+// "db.Conn", so tests using it can call t.Parallel.
+func NewTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	conn, err := db.Open(filepath.Join(t.TempDir(), "chemical-ledger-test.db"))
+	if err != nil {
+		t.Fatalf("failed to set up test database: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := conn.Close(); err != nil {
+			t.Errorf("failed to close test database: %v", err)
+		}
+	})
+	if err := db.Migrate(conn); err != nil {
+		t.Fatalf("failed to create tables: %v", err)
+	}
+	return conn
+}
+
+// Dependencies the code under test finds in the context of its requests: a database, a clock standing still and IDs
+// numbered 1, 2, 3, ... Each test has its own, so tests going through the handlers can call t.Parallel.
+type Env struct {
+	t     *testing.T
+	DB    *sql.DB
+	Clock *FixedClock
+	IDs   *SequenceIDs
+}
+
+// Sets up the dependencies of a test: a fresh database from NewTestDB, and a clock standing at the given time until
+// moved with "Clock.Advance"
+func NewEnv(t *testing.T, at time.Time) *Env {
+	t.Helper()
+	return &Env{t: t, DB: NewTestDB(t), Clock: &FixedClock{T: at}, IDs: &SequenceIDs{}}
+}
+
+// Context carrying the dependencies, for calling the code under test directly
+func (e *Env) Context() context.Context {
+	return utils.WithIDs(datetime.WithClock(db.WithConn(context.Background(), e.DB), e.Clock), e.IDs)
+}
+
+// Request carrying the dependencies in its context, for calling handlers directly
+func (e *Env) Request(method string, target string, body io.Reader) *http.Request {
+	return httptest.NewRequestWithContext(e.Context(), method, target, body)
+}
+
+// Signs the request in as the given user, with a token issued to them directly in the database of the test. The
+// local administrator needs none, as long as the request comes from this machine.
+func (e *Env) SignIn(req *http.Request, userId string) {
+	e.t.Helper()
+	if userId == utils.LOCAL_USER_ID {
+		return
+	}
+	token, err := utils.NewUserToken()
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	if _, err := e.DB.Exec(
+		"INSERT INTO user_token (id, user_id, token_hash, created_by, created_at) VALUES (?, ?, ?, ?, 0)",
+		utils.NewId(e.Context(), "UT"), userId, utils.HashUserToken(token), utils.LOCAL_USER_ID,
+	); err != nil {
+		e.t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+}
+
+// Inserts a compound directly into the database of the test
+func (e *Env) InsertCompound(id string, name string, scale string) {
+	e.t.Helper()
+	InsertCompoundIn(e.t, e.DB, id, name, scale)
+}
+
+// ReplayNetStock on the database of the test, as of the day of the clock
+func (e *Env) ReplayNetStock(compoundId string) map[string]int {
+	e.t.Helper()
+	return ReplayNetStockIn(e.t, e.Context(), e.DB, compoundId)
+}
+
+// AssertNetStock on the database of the test, as of the day of the clock
+func (e *Env) AssertNetStock(compoundId string) {
+	e.t.Helper()
+	AssertNetStockIn(e.t, e.Context(), e.DB, compoundId)
+}
+
+// Inserts a compound directly into the given database
+func InsertCompoundIn(t *testing.T, conn *sql.DB, id string, name string, scale string) {
+	t.Helper()
+
+	if _, err := conn.Exec(
+		"INSERT INTO compound (id, lower_case_name, name, scale) VALUES (?, ?, ?, ?)",
+		id, name, name, scale,
+	); err != nil {
+		t.Fatalf("failed to insert compound %q: %v", id, err)
+	}
+}
+
+// Replays every movement of the compound in the given database from scratch and returns the net stock each entry
+// should hold, keyed by entry ID. It deliberately shares no code with the recalculation in utils, so the two can be
+// checked against each other. Under the same-day grace, the stock only has to be there at the end of each day before
+// today, by the clock of the context.
+func ReplayNetStockIn(t *testing.T, ctx context.Context, conn *sql.DB, compoundId string) map[string]int {
+	t.Helper()
+
+	grace := stock.SameDayStockGrace()
+	today := datetime.Now(ctx).Local().Format("2006-01-02")
+
+	rows, err := conn.Query(`
+		SELECT
+			e.id, e.type, e.status, date(e.date, 'unixepoch', 'localtime'),
+			q.num_of_units * q.packs_per_unit * q.quantity_per_unit + q.partial_quantity
+		FROM entry e
+		JOIN quantity q ON e.quantity_id = q.id
+		WHERE e.compound_id = ? AND e.deleted_at IS NULL
+		ORDER BY e.date ASC, e.seq ASC`, compoundId)
+	if err != nil {
+		t.Fatalf("failed to query movements of compound %q: %v", compoundId, err)
+	}
+	defer rows.Close()
+
+	expected := map[string]int{}
+	stock := 0
+	day := ""
+	for rows.Next() {
+		var id, entryType, status, entryDay string
+		var quantity int
+		if err := rows.Scan(&id, &entryType, &status, &entryDay, &quantity); err != nil {
+			t.Fatalf("failed to scan movement: %v", err)
+		}
+		if grace && entryDay != day {
+			if stock < 0 {
+				t.Errorf("compound %q closes %s negative (%d)", compoundId, day, stock)
+			}
+			day = entryDay
+		}
+		if status != ENTRY_STATUS_APPROVED {
+			expected[id] = stock
+			continue
+		}
+
+		switch entryType {
+		case ENTRY_TYPE_INCOMING, ENTRY_TYPE_ADJUSTMENT_IN:
+			stock += quantity
+		case ENTRY_TYPE_OUTGOING, ENTRY_TYPE_ADJUSTMENT_OUT, ENTRY_TYPE_DISPOSAL:
+			stock -= quantity
+		case ENTRY_TYPE_TRANSFER:
+		default:
+			t.Fatalf("entry %q has unknown type %q", id, entryType)
+		}
+		if stock < 0 && !grace {
+			t.Errorf("compound %q goes negative (%d) at entry %q", compoundId, stock, id)
+		}
+		expected[id] = stock
+	}
+	if grace && stock < 0 && day != today {
+		t.Errorf("compound %q closes %s negative (%d)", compoundId, day, stock)
+	}
+
+	return expected
+}
+
+// Asserts that the stored net_stock of every entry of the compound in the given database, and its current stock,
+// match an independent replay of its movements. Deleted entries are not kept up to date and are left out.
+func AssertNetStockIn(t *testing.T, ctx context.Context, conn *sql.DB, compoundId string) {
+	t.Helper()
+
+	expected := ReplayNetStockIn(t, ctx, conn, compoundId)
+
+	rows, err := conn.Query("SELECT id, net_stock FROM entry WHERE compound_id = ? AND deleted_at IS NULL", compoundId)
+	if err != nil {
+		t.Fatalf("failed to query stored net stock of compound %q: %v", compoundId, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		var netStock int
+		if err := rows.Scan(&id, &netStock); err != nil {
+			t.Fatalf("failed to scan stored net stock: %v", err)
+		}
+		if netStock != expected[id] {
+			t.Errorf("entry %q of compound %q: stored net_stock %d, replay gives %d", id, compoundId, netStock, expected[id])
+		}
+	}
+	rows.Close()
+
+	// The current stock is that of the last entry, and there is none without entries
+	var lastId string
+	var balance int
+	err = conn.QueryRow(`
+		SELECT COALESCE(e.id, ''), COALESCE(s.balance, 0)
+		FROM (SELECT ? AS compound_id) c
+		LEFT JOIN stock_current s ON s.compound_id = c.compound_id
+		LEFT JOIN (
+			SELECT id, compound_id FROM entry WHERE compound_id = ? AND deleted_at IS NULL ORDER BY date DESC, seq DESC LIMIT 1
+		) e ON e.compound_id = c.compound_id`,
+		compoundId, compoundId,
+	).Scan(&lastId, &balance)
+	if err != nil {
+		t.Fatalf("failed to query current stock of compound %q: %v", compoundId, err)
+	}
+	if balance != expected[lastId] {
+		t.Errorf("compound %q: current stock %d, replay gives %d", compoundId, balance, expected[lastId])
+	}
+}
+
+// Clock standing still at "T" until moved with Advance
+type FixedClock struct {
+	mu sync.Mutex
+	T  time.Time
+}
+
+func (c *FixedClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.T
+}
+
+func (c *FixedClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.T = c.T.Add(d)
+}
+
+// IDs numbered 1, 2, 3, ... in the order they are made
+type SequenceIDs struct {
+	mu   sync.Mutex
+	last int64
+}
+
+func (s *SequenceIDs) Next() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.last++
+	return strconv.FormatInt(s.last, 10)
+}
+
+// Makes the disk guard find the given megabytes free, checking right away, for the rest of the test. Afterwards the
+// disk counts as having plenty of space again.
+func UseFreeDiskSpace(t *testing.T, freeMB uint64) {
+	t.Helper()
+
+	previous := utils.FreeDiskSpace
+	setFree := func(mb uint64) {
+		utils.FreeDiskSpace = func(string) (uint64, error) { return mb << 20, nil }
+		if err := utils.CheckDiskSpace(t.TempDir()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	setFree(freeMB)
+	t.Cleanup(func() {
+		setFree(1 << 20)
+		utils.FreeDiskSpace = previous
+	})
+}
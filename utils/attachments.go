@@ -0,0 +1,101 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// Safety data sheet of a compound
+	ATTACHMENT_KIND_SDS = "sds"
+	// Scan of the physical voucher of an entry
+	ATTACHMENT_KIND_VOUCHER = "voucher"
+
+	// Largest attachment accepted
+	MAX_ATTACHMENT_SIZE = 20 << 20
+)
+
+// File attached to a compound, or to one of its entries when EntryId is set. The file itself is kept on disk under
+// AttachmentsDir, by ID.
+type Attachment struct {
+	Id          string `json:"attachment_id"`
+	CompoundId  string `json:"compound_id"`
+	EntryId     string `json:"entry_id,omitempty"`
+	Kind        string `json:"kind"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Size        int    `json:"size"`
+	Sha256      string `json:"sha256"`
+	UploadedBy  string `json:"uploaded_by"`
+	UploadedAt  int64  `json:"uploaded_at"`
+}
+
+// Directory the attachments are kept in, ATTACHMENTS_DIR or "./info/attachments" next to the database
+func AttachmentsDir() string {
+	if dir := os.Getenv("ATTACHMENTS_DIR"); dir != "" {
+		return dir
+	}
+	return "./info/attachments"
+}
+
+func attachmentPath(id string) string {
+	return filepath.Join(AttachmentsDir(), id)
+}
+
+// Whether a file is a PDF, going by its content rather than its name
+func IsPdf(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("%PDF-"))
+}
+
+// Content types a voucher scan can have
+var voucherContentTypes = map[string]bool{
+	"application/pdf": true,
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/webp":      true,
+}
+
+// Tells the content type of a voucher scan by its content, and whether it is one accepted: a PDF or an image
+func VoucherContentType(data []byte) (string, bool) {
+	contentType := http.DetectContentType(data)
+	return contentType, voucherContentTypes[contentType]
+}
+
+// Stores an attachment: the file is written to disk first and then recorded in the given transaction, so a failed
+// upload leaves at most an unreferenced file behind. Fills in its size and checksum.
+func SaveAttachment(ctx context.Context, tx *sql.Tx, attachment *Attachment, data []byte) error {
+	sum := sha256.Sum256(data)
+	attachment.Size, attachment.Sha256 = len(data), hex.EncodeToString(sum[:])
+
+	if err := writeFileAtomic(attachmentPath(attachment.Id), data); err != nil {
+		return err
+	}
+
+	_, err := tx.ExecContext(ctx,
+		"INSERT INTO attachment (id, compound_id, entry_id, kind, filename, content_type, size, sha256, uploaded_by, uploaded_at) VALUES (?, ?, NULLIF(?, ''), ?, ?, ?, ?, ?, ?, ?)",
+		attachment.Id, attachment.CompoundId, attachment.EntryId, attachment.Kind, attachment.Filename, attachment.ContentType,
+		attachment.Size, attachment.Sha256, attachment.UploadedBy, attachment.UploadedAt,
+	)
+	return err
+}
+
+// Reads the file of an attachment
+func ReadAttachment(id string) ([]byte, error) {
+	return os.ReadFile(attachmentPath(id))
+}
+
+// Removes the files of attachments whose records are gone. Files already missing are fine.
+func RemoveAttachmentFiles(ids []string) error {
+	for _, id := range ids {
+		if err := os.Remove(attachmentPath(id)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"chemical-ledger-backend/datetime"
+	"chemical-ledger-backend/db"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+)
+
+const (
+	AUDIT_TARGET_USER           = "user"
+	AUDIT_TARGET_DELEGATION     = "delegation"
+	AUDIT_TARGET_ROLE_GRANT     = "role_grant"
+	AUDIT_TARGET_USER_TOKEN     = "user_token"
+	AUDIT_TARGET_ENTRY          = "entry"
+	AUDIT_TARGET_STOCK_TAKE     = "stock_take"
+	AUDIT_TARGET_ENTRY_LOCK     = "entry_lock"
+	AUDIT_TARGET_STOCK          = "stock"
+	AUDIT_TARGET_IMPORT         = "import"
+	AUDIT_TARGET_COMPOUND       = "compound"
+	AUDIT_TARGET_DATABASE       = "database"
+	AUDIT_TARGET_ITEM_MAPPING   = "item_mapping"
+	AUDIT_TARGET_PURCHASE_ORDER = "purchase_order"
+	AUDIT_TARGET_INVOICE        = "invoice"
+	AUDIT_TARGET_RESERVATION    = "reservation"
+
+	// Actor of the actions the application takes on its own, e.g. scheduled jobs
+	AUDIT_ACTOR_SYSTEM = "system"
+)
+
+// Records an action in the audit trail, inside the transaction of the change it describes when "tx" is not nil.
+// Details are stored as JSON. Failing to audit is logged but never fails the action itself.
+func RecordAudit(ctx context.Context, tx *sql.Tx, actorId string, action string, targetType string, targetId string, details any) {
+	detailsJson := ""
+	if details != nil {
+		raw, err := json.Marshal(details)
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to encode audit details", "action", action, "error", err)
+		}
+		detailsJson = string(raw)
+	}
+
+	const query = "INSERT INTO audit_log (at, actor_id, action, target_type, target_id, details) VALUES (?, ?, ?, ?, ?, ?)"
+	args := []any{datetime.Now(ctx).Unix(), actorId, action, targetType, targetId, detailsJson}
+
+	var err error
+	if tx != nil {
+		_, err = tx.ExecContext(ctx, query, args...)
+	} else {
+		_, err = db.ConnFrom(ctx).ExecContext(ctx, query, args...)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to record audit log", "actor_id", actorId, "action", action, "target_type", targetType, "target_id", targetId, "error", err)
+	}
+}
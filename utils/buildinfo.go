@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"chemical-ledger-backend/db"
+	"os"
+	"runtime"
+	"runtime/debug"
+)
+
+// Commit and date of the build, set when building a release with
+// -ldflags "-X chemical-ledger-backend/utils.Commit=... -X chemical-ledger-backend/utils.BuildDate=...".
+// Otherwise they are taken from the version control details Go records in the binary, when there are any.
+var (
+	Commit    string
+	BuildDate string
+)
+
+// Which build is running and how it is set up, for support to tell which build a school is running
+type BuildInfo struct {
+	Commit string `json:"commit"`
+	// Whether the build had changes that were not committed
+	Modified  bool   `json:"modified"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+	// Version of the schema this build migrates databases to
+	SchemaVersion int `json:"schema_version"`
+	// Settings that switch features on or off or change how they behave, with their current values
+	Features map[string]any `json:"features"`
+}
+
+func GetBuildInfo() BuildInfo {
+	info := BuildInfo{
+		Commit:        Commit,
+		BuildDate:     BuildDate,
+		GoVersion:     runtime.Version(),
+		SchemaVersion: db.SCHEMA_VERSION,
+		Features:      FeatureFlags(),
+	}
+	if build, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range build.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = setting.Value
+			case setting.Key == "vcs.time" && info.BuildDate == "":
+				info.BuildDate = setting.Value
+			case setting.Key == "vcs.modified":
+				info.Modified = setting.Value == "true"
+			}
+		}
+	}
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	return info
+}
+
+// Current values of the settings switching features on or off, by feature
+func FeatureFlags() map[string]any {
+	replication := ReplicationMode()
+	if replication == "" {
+		replication = "off"
+	}
+	return map[string]any{
+		"same_day_stock_grace":    GetEnvBool("SAME_DAY_STOCK_GRACE", false),
+		"sql_console":             SqlConsoleEnabled(),
+		"duplicate_voucher_check": DuplicateVoucherCheck(),
+		"large_incoming_check":    LargeIncomingCheck(),
+		"valuation_method":        ValuationMethod(),
+		"entry_lock":              GetEntryLockPolicy().AfterDays > 0,
+		"stock_board":             GetStockBoardTarget().Enabled(),
+		"digest_email":            os.Getenv("DIGEST_EMAIL_TO") != "",
+		"replication":             replication,
+		"tracing":                 TracingEnabled(),
+		"pprof":                   PprofEnabled(),
+	}
+}
@@ -0,0 +1,22 @@
+package utils
+
+import "regexp"
+
+// CAS registry numbers are two to seven digits, two digits and a check digit, e.g. 7732-18-5 for water
+var casNumberPattern = regexp.MustCompile(`^(\d{2,7})-(\d{2})-(\d)$`)
+
+// Whether a CAS registry number is well-formed and its check digit right: the last digit is the sum of the other
+// digits, each multiplied by its position counted from the right, modulo 10.
+func ValidCasNumber(casNo string) bool {
+	parts := casNumberPattern.FindStringSubmatch(casNo)
+	if parts == nil {
+		return false
+	}
+
+	digits := parts[1] + parts[2]
+	sum := 0
+	for i := range len(digits) {
+		sum += int(digits[len(digits)-1-i]-'0') * (i + 1)
+	}
+	return sum%10 == int(parts[3][0]-'0')
+}
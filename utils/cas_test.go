@@ -0,0 +1,26 @@
+package utils_test
+
+import (
+	"chemical-ledger-backend/utils"
+	"testing"
+)
+
+func TestValidCasNumberChecksTheCheckDigit(t *testing.T) {
+	t.Parallel()
+
+	for casNo, valid := range map[string]bool{
+		"7732-18-5":     true,  // water
+		"64-17-5":       true,  // ethanol
+		"67-64-1":       true,  // acetone
+		"7647-14-5":     true,  // sodium chloride
+		"67-64-2":       false, // wrong check digit
+		"6764-1":        false,
+		"1-64-1":        false,
+		"67-64-1 ":      false,
+		"12345678-00-0": false,
+	} {
+		if got := utils.ValidCasNumber(casNo); got != valid {
+			t.Errorf("ValidCasNumber(%q) = %t, want %t", casNo, got, valid)
+		}
+	}
+}
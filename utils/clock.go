@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"chemical-ledger-backend/idgen"
+	"context"
+)
+
+// Generator of the IDs made without one in the context, timed by the system clock
+var systemIDs idgen.Generator = &idgen.ULIDs{}
+
+type idsKey struct{}
+
+// Context carrying the ID generator that NewId draws from for the rest of the request. The server sets it once for
+// every request, tests set one numbering IDs 1, 2, 3, ... of their own, see testutils.NewEnv.
+func WithIDs(ctx context.Context, ids idgen.Generator) context.Context {
+	return context.WithValue(ctx, idsKey{}, ids)
+}
+
+// ID generator carried by the context, ULIDs timed by the system clock when it carries none
+func IDsFrom(ctx context.Context) idgen.Generator {
+	if ids, ok := ctx.Value(idsKey{}).(idgen.Generator); ok {
+		return ids
+	}
+	return systemIDs
+}
+
+// New ID for a record of the kind given by the prefix, e.g. "E_01JA2XQ8N5V3W6Y9Z0B1C2D3E4" for entries. IDs of the
+// same kind sort in the order they were made.
+func NewId(ctx context.Context, prefix string) string {
+	return prefix + "_" + IDsFrom(ctx).Next()
+}
@@ -0,0 +1,29 @@
+package utils_test
+
+import (
+	"chemical-ledger-backend/testutils"
+	"chemical-ledger-backend/utils"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestNewIdNumbersInOrder(t *testing.T) {
+	t.Parallel()
+	ctx := utils.WithIDs(context.Background(), &testutils.SequenceIDs{})
+
+	for i, want := range []string{"E_1", "Q_2", "E_3"} {
+		if got := utils.NewId(ctx, want[:1]); got != want {
+			t.Errorf("ID %d is %q, want %q", i+1, got, want)
+		}
+	}
+}
+
+func TestNewIdWithoutGeneratorMakesULIDs(t *testing.T) {
+	t.Parallel()
+
+	id := utils.NewId(context.Background(), "E")
+	if !strings.HasPrefix(id, "E_") || len(id) != len("E_")+26 {
+		t.Errorf("ID made without a generator in the context is %q, want a ULID", id)
+	}
+}
@@ -0,0 +1,188 @@
+package utils
+
+import (
+	"chemical-ledger-backend/db"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Integer settings and the smallest value each accepts
+var intSettings = []struct {
+	name string
+	min  int
+}{
+	{"DISK_READ_ONLY_MB", 0},
+	{"DISK_WARN_MB", 0},
+	{"ENTRY_LOCK_AFTER_DAYS", 0},
+	{"ENTRY_LOCK_NOTICE_DAYS", 0},
+	{"IMPORT_ROLLBACK_HOURS", 0},
+	{"LABEL_COLUMNS", 1},
+	{"LABEL_GAP_MM", 0},
+	{"LABEL_MARGIN_SIDE_MM", 0},
+	{"LABEL_MARGIN_TOP_MM", 0},
+	{"LABEL_ROWS", 1},
+	{"LARGE_INCOMING_FACTOR", 1},
+	{"LONG_REQUEST_TIMEOUT_SECONDS", 0},
+	{"REPLICATION_INTERVAL_MINUTES", 1},
+	{"REQUEST_TIMEOUT_SECONDS", 0},
+	{"STOCK_BOARD_INTERVAL_MINUTES", 1},
+	{"TENANT_MAX_OPEN", 1},
+	{"TRIAL_COMPOUND_LIMIT", 0},
+	{"TRIAL_ENTRY_LIMIT", 0},
+	{"TRIAL_USER_LIMIT", 0},
+}
+
+var boolSettings = []string{"SAME_DAY_STOCK_GRACE", "SQL_CONSOLE", "PPROF"}
+
+// Checks the settings read from the environment. Invalid values quietly fall back to their defaults when read, which
+// hides typos, so the startup self-test reports them instead. Returns one line per problem, naming the variable.
+func ConfigProblems() []string {
+	problems := []string{}
+
+	for _, setting := range intSettings {
+		str := os.Getenv(setting.name)
+		if str == "" {
+			continue
+		}
+		if num, err := strconv.Atoi(str); err != nil || num < setting.min {
+			problems = append(problems, fmt.Sprintf("%s=%q is not a whole number of at least %d", setting.name, str, setting.min))
+		}
+	}
+
+	for _, name := range boolSettings {
+		if str := os.Getenv(name); str != "" {
+			if _, err := strconv.ParseBool(str); err != nil {
+				problems = append(problems, fmt.Sprintf("%s=%q is not true or false", name, str))
+			}
+		}
+	}
+
+	switch check := os.Getenv("DUPLICATE_VOUCHER_CHECK"); check {
+	case "", DUPLICATE_CHECK_OFF, DUPLICATE_CHECK_WARN, DUPLICATE_CHECK_REJECT:
+	default:
+		problems = append(problems, fmt.Sprintf("DUPLICATE_VOUCHER_CHECK=%q is not one of %s, %s, %s",
+			check, DUPLICATE_CHECK_OFF, DUPLICATE_CHECK_WARN, DUPLICATE_CHECK_REJECT))
+	}
+
+	if method := os.Getenv("VALUATION_METHOD"); method != "" && !IsValidValuationMethod(method) {
+		problems = append(problems, fmt.Sprintf("VALUATION_METHOD=%q is not one of %s, %s", method, VALUATION_AVERAGE, VALUATION_FIFO))
+	}
+
+	switch check := os.Getenv("LARGE_INCOMING_CHECK"); check {
+	case "", LARGE_INCOMING_OFF, LARGE_INCOMING_WARN, LARGE_INCOMING_CONFIRM:
+	default:
+		problems = append(problems, fmt.Sprintf("LARGE_INCOMING_CHECK=%q is not one of %s, %s, %s",
+			check, LARGE_INCOMING_OFF, LARGE_INCOMING_WARN, LARGE_INCOMING_CONFIRM))
+	}
+
+	if locale := os.Getenv("NUMBER_LOCALE"); locale != "" {
+		if _, ok := NumberLocales[locale]; !ok {
+			locales := make([]string, 0, len(NumberLocales))
+			for name := range NumberLocales {
+				locales = append(locales, name)
+			}
+			sort.Strings(locales)
+			problems = append(problems, fmt.Sprintf("NUMBER_LOCALE=%q is not one of %s", locale, strings.Join(locales, ", ")))
+		}
+	}
+
+	if str := os.Getenv("DIGEST_HOUR"); str != "" {
+		if hour, err := strconv.Atoi(str); err != nil || hour < 0 || hour > 23 {
+			problems = append(problems, fmt.Sprintf("DIGEST_HOUR=%q is not an hour from 0 to 23", str))
+		}
+	}
+
+	// Digests can only be mailed through an SMTP server
+	if os.Getenv("DIGEST_EMAIL_TO") != "" {
+		for _, name := range []string{"SMTP_ADDR", "SMTP_FROM"} {
+			if os.Getenv(name) == "" {
+				problems = append(problems, fmt.Sprintf("%s is needed along with DIGEST_EMAIL_TO", name))
+			}
+		}
+	}
+
+	// An endpoint alone is not enough to upload the stock board
+	if os.Getenv("STOCK_BOARD_S3_ENDPOINT") != "" {
+		for _, name := range []string{"STOCK_BOARD_S3_BUCKET", "STOCK_BOARD_S3_ACCESS_KEY", "STOCK_BOARD_S3_SECRET_KEY"} {
+			if os.Getenv(name) == "" {
+				problems = append(problems, fmt.Sprintf("%s is needed along with STOCK_BOARD_S3_ENDPOINT", name))
+			}
+		}
+	}
+
+	// The standby only takes snapshots sent with its token, and the primary must know where to send them
+	switch mode := ReplicationMode(); mode {
+	case "":
+	case REPLICATION_MODE_PRIMARY, REPLICATION_MODE_STANDBY:
+		names := []string{"REPLICATION_TOKEN"}
+		if mode == REPLICATION_MODE_PRIMARY {
+			names = append(names, "REPLICATION_TARGET")
+		}
+		for _, name := range names {
+			if os.Getenv(name) == "" {
+				problems = append(problems, fmt.Sprintf("%s is needed with REPLICATION_MODE=%s", name, mode))
+			}
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("REPLICATION_MODE=%q is not one of %s, %s",
+			mode, REPLICATION_MODE_PRIMARY, REPLICATION_MODE_STANDBY))
+	}
+
+	if _, invalid := TrustedProxies(); len(invalid) > 0 {
+		problems = append(problems, fmt.Sprintf("TRUSTED_PROXIES has %s, which are not addresses or CIDR ranges", strings.Join(invalid, ", ")))
+	}
+
+	// Tenant IDs name files and subdomains. Without subdomains, only proxies name the tenant. Replication and the stock
+	// board are made for a single database.
+	if tenants := TenantIds(); len(tenants) > 0 {
+		if TenantDomain() == "" && os.Getenv("TRUSTED_PROXIES") == "" {
+			problems = append(problems, "TENANTS needs TENANT_DOMAIN or TRUSTED_PROXIES to tell the tenant of a request")
+		}
+		for _, id := range tenants {
+			if !db.IsValidTenantId(id) {
+				problems = append(problems, fmt.Sprintf("TENANTS has %q, which is not lowercase letters, digits and dashes", id))
+			}
+		}
+		if ReplicationMode() != "" {
+			problems = append(problems, "REPLICATION_MODE cannot be used with TENANTS")
+		}
+		if GetStockBoardTarget().Enabled() {
+			problems = append(problems, "the stock board cannot be exported with TENANTS")
+		}
+	}
+
+	return problems
+}
+
+// Time zone whose data is looked up to tell whether the time zone database is there at all
+const TIMEZONE_PROBE = "Asia/Kolkata"
+
+// Checks the time zone entries are dated in. Go quietly runs in UTC when TZ names a zone it cannot load, which moves
+// entries recorded in the evening or early morning to the wrong day, so that is an error. A missing time zone
+// database only matters once TZ is changed, so it is returned as a warning. Returns the zone in use otherwise.
+func CheckTimezone() (zone string, warning string, err error) {
+	if tz := strings.TrimPrefix(os.Getenv("TZ"), ":"); tz != "" {
+		if _, err := time.LoadLocation(tz); err != nil {
+			return "", "", fmt.Errorf("TZ=%q cannot be loaded: %w", tz, err)
+		}
+	}
+
+	name, offset := time.Now().Zone()
+	zone = fmt.Sprintf("%s (%s, UTC%+03d:%02d)", time.Local.String(), name, offset/3600, abs(offset%3600)/60)
+
+	if _, err := time.LoadLocation(TIMEZONE_PROBE); err != nil {
+		warning = fmt.Sprintf("time zone database not found (%v)", err)
+	}
+	return zone, warning, nil
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
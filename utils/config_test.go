@@ -0,0 +1,75 @@
+package utils_test
+
+import (
+	"chemical-ledger-backend/utils"
+	"strings"
+	"testing"
+)
+
+func TestConfigProblemsNamesEachInvalidSetting(t *testing.T) {
+	t.Setenv("ENTRY_LOCK_AFTER_DAYS", "30")
+	t.Setenv("STOCK_BOARD_INTERVAL_MINUTES", "0")
+	t.Setenv("SQL_CONSOLE", "yes please")
+	t.Setenv("DUPLICATE_VOUCHER_CHECK", "strict")
+	t.Setenv("NUMBER_LOCALE", "en-IN")
+
+	problems := utils.ConfigProblems()
+	if len(problems) != 3 {
+		t.Fatalf("got problems %q, want 3", problems)
+	}
+	for i, name := range []string{"STOCK_BOARD_INTERVAL_MINUTES", "SQL_CONSOLE", "DUPLICATE_VOUCHER_CHECK"} {
+		if !strings.HasPrefix(problems[i], name+"=") {
+			t.Errorf("problem %d = %q, want it to name %s", i, problems[i], name)
+		}
+	}
+}
+
+func TestConfigProblemsNeedsReplicationTargetAndToken(t *testing.T) {
+	t.Setenv("REPLICATION_MODE", "primary")
+	t.Setenv("REPLICATION_TARGET", "")
+	t.Setenv("REPLICATION_TOKEN", "s3cret")
+
+	if problems := utils.ConfigProblems(); len(problems) != 1 || !strings.HasPrefix(problems[0], "REPLICATION_TARGET is needed") {
+		t.Errorf("primary without target: %q", problems)
+	}
+	t.Setenv("REPLICATION_MODE", "standby")
+	if problems := utils.ConfigProblems(); len(problems) != 0 {
+		t.Errorf("standby: %q", problems)
+	}
+	t.Setenv("REPLICATION_MODE", "replica")
+	if problems := utils.ConfigProblems(); len(problems) != 1 || !strings.HasPrefix(problems[0], "REPLICATION_MODE=") {
+		t.Errorf("unknown mode: %q", problems)
+	}
+}
+
+func TestConfigProblemsChecksTrustedProxies(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "127.0.0.1, 10.0.0.0/8, ::1, proxy.local")
+	if problems := utils.ConfigProblems(); len(problems) != 1 || !strings.Contains(problems[0], "proxy.local") {
+		t.Errorf("host name among the proxies: %q", problems)
+	}
+	for addr, trusted := range map[string]bool{"127.0.0.1:80": true, "10.1.2.3:80": true, "[::1]:80": true, "127.0.0.2:80": false, "192.168.1.2:80": false} {
+		if utils.IsTrustedProxy(addr) != trusted {
+			t.Errorf("%s trusted: got %v, want %v", addr, !trusted, trusted)
+		}
+	}
+
+	// Without subdomains or proxies, nothing could name a tenant
+	t.Setenv("TRUSTED_PROXIES", "")
+	t.Setenv("TENANTS", "stmarys")
+	t.Setenv("TENANT_DOMAIN", "")
+	if problems := utils.ConfigProblems(); len(problems) != 1 || !strings.HasPrefix(problems[0], "TENANTS needs") {
+		t.Errorf("tenants without domain or proxies: %q", problems)
+	}
+}
+
+func TestCheckTimezoneRejectsUnknownZone(t *testing.T) {
+	t.Setenv("TZ", "Asia/Kolkata")
+	if _, _, err := utils.CheckTimezone(); err != nil {
+		t.Errorf("CheckTimezone() with TZ=Asia/Kolkata: %v", err)
+	}
+
+	t.Setenv("TZ", "Asia/Nowhere")
+	if _, _, err := utils.CheckTimezone(); err == nil {
+		t.Error("CheckTimezone() with TZ=Asia/Nowhere succeeded, want an error")
+	}
+}
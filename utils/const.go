@@ -1,9 +1,80 @@
 package utils
 
+import "slices"
+
 const (
 	ENTRY_TYPE_INCOMING = "incoming"
 	ENTRY_TYPE_OUTGOING = "outgoing"
 
-	SCALE_G  = "g"
-	SCALE_ML = "ml"
+	// Corrections after a physical count, they move stock like incoming and outgoing entries but need a reason
+	ENTRY_TYPE_ADJUSTMENT_IN  = "adjustment-in"
+	ENTRY_TYPE_ADJUSTMENT_OUT = "adjustment-out"
+
+	// Waste taken out of the stock for disposal, which must say how it was disposed of and who authorized it
+	ENTRY_TYPE_DISPOSAL = "disposal"
+
+	// Stock moved from one location to another, which leaves the stock of the compound as it is
+	ENTRY_TYPE_TRANSFER = "transfer"
+
+	// Entries by users who need a second pair of eyes wait as pending and only count towards the stock once approved
+	ENTRY_STATUS_PENDING  = "pending"
+	ENTRY_STATUS_APPROVED = "approved"
+	ENTRY_STATUS_REJECTED = "rejected"
+
+	STOCK_TAKE_STATUS_OPEN     = "open"
+	STOCK_TAKE_STATUS_APPROVED = "approved"
+
+	// A purchase order is received as approved deliveries against its lines come in, unless it was cancelled first
+	PO_STATUS_OPEN               = "open"
+	PO_STATUS_PARTIALLY_RECEIVED = "partially_received"
+	PO_STATUS_RECEIVED           = "received"
+	PO_STATUS_CANCELLED          = "cancelled"
+
+	// What the chemicals of an outgoing entry linked to an instrument were used for; without one they were used
+	// with the instrument otherwise
+	INSTRUMENT_EVENT_CALIBRATION = "calibration"
+	INSTRUMENT_EVENT_MAINTENANCE = "maintenance"
+
+	// How the waste of a disposal entry was disposed of, as listed in environmental compliance filings
+	DISPOSAL_METHOD_INCINERATION   = "incineration"
+	DISPOSAL_METHOD_NEUTRALIZATION = "neutralization"
+	DISPOSAL_METHOD_DRAIN          = "drain"
+	DISPOSAL_METHOD_LANDFILL       = "landfill"
+	DISPOSAL_METHOD_CONTRACTOR     = "licensed-contractor"
+	DISPOSAL_METHOD_RETURN         = "return-to-supplier"
 )
+
+var DisposalMethods = []string{
+	DISPOSAL_METHOD_INCINERATION, DISPOSAL_METHOD_NEUTRALIZATION, DISPOSAL_METHOD_DRAIN,
+	DISPOSAL_METHOD_LANDFILL, DISPOSAL_METHOD_CONTRACTOR, DISPOSAL_METHOD_RETURN,
+}
+
+// Entries are numbered in the order they are recorded, which puts entries of the same second in order: every
+// ORDER BY on the entry date breaks ties on "seq". New entries take the next number with this as the value of "seq".
+const NEXT_ENTRY_SEQ = "(SELECT COALESCE(MAX(seq), 0) + 1 FROM entry)"
+
+// Whether entries of the given type add to the stock
+func IsInwardEntryType(entryType string) bool {
+	return entryType == ENTRY_TYPE_INCOMING || entryType == ENTRY_TYPE_ADJUSTMENT_IN
+}
+
+// Whether entries of the given type take from the stock
+func IsOutwardEntryType(entryType string) bool {
+	return entryType == ENTRY_TYPE_OUTGOING || entryType == ENTRY_TYPE_ADJUSTMENT_OUT || entryType == ENTRY_TYPE_DISPOSAL
+}
+
+func IsAdjustmentEntryType(entryType string) bool {
+	return entryType == ENTRY_TYPE_ADJUSTMENT_IN || entryType == ENTRY_TYPE_ADJUSTMENT_OUT
+}
+
+func IsValidEntryType(entryType string) bool {
+	return IsInwardEntryType(entryType) || IsOutwardEntryType(entryType) || entryType == ENTRY_TYPE_TRANSFER
+}
+
+func IsValidDisposalMethod(method string) bool {
+	return slices.Contains(DisposalMethods, method)
+}
+
+func IsValidEntryStatus(status string) bool {
+	return status == ENTRY_STATUS_PENDING || status == ENTRY_STATUS_APPROVED || status == ENTRY_STATUS_REJECTED
+}
@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/retry"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Longest chain of delegations followed when resolving an approver
+const MAX_DELEGATION_DEPTH = 10
+
+// Gets the user an active delegation of the given user points to on the given day, or "" when there is none
+func getActiveDelegate(ctx context.Context, userId string, at time.Time) (string, error) {
+	day := at.Local().Format("2006-01-02")
+
+	var delegateId string
+	err := retry.Once(func() error {
+		err := db.ConnFrom(ctx).QueryRowContext(ctx, `
+			SELECT d.delegate_id
+			FROM delegation d
+			JOIN user u ON d.delegate_id = u.id
+			WHERE d.delegator_id = ? AND d.revoked = 0 AND u.active = 1
+				AND d.from_date <= ? AND d.to_date >= ?
+			ORDER BY d.created_at DESC
+			LIMIT 1`, userId, day, day,
+		).Scan(&delegateId)
+		if errors.Is(err, sql.ErrNoRows) {
+			delegateId = ""
+			return nil
+		}
+		return err
+	})
+	return delegateId, err
+}
+
+// Follows the active delegations of the given approver and returns the chain of users approvals are routed
+// through, starting with the approver. The last user of the chain is the one currently expected to act.
+func ResolveApprover(ctx context.Context, approverId string, at time.Time) ([]string, error) {
+	chain := []string{approverId}
+	seen := map[string]bool{approverId: true}
+
+	current := approverId
+	for range MAX_DELEGATION_DEPTH {
+		delegateId, err := getActiveDelegate(ctx, current, at)
+		if err != nil {
+			return nil, err
+		}
+		if delegateId == "" || seen[delegateId] {
+			break
+		}
+		chain = append(chain, delegateId)
+		seen[delegateId] = true
+		current = delegateId
+	}
+
+	return chain, nil
+}
+
+// Checks whether the actor may approve what is assigned to the given approver, either directly, as an admin or
+// through a delegation active at the given time. When acting for someone else, that approver's ID is returned
+// so the caller can record the delegation in the audit trail.
+func AuthorizeApproval(ctx context.Context, actor *User, approverId string, at time.Time) (bool, string, error) {
+	if actor.Id == approverId {
+		return true, "", nil
+	}
+
+	chain, err := ResolveApprover(ctx, approverId, at)
+	if err != nil {
+		return false, "", err
+	}
+	for _, userId := range chain[1:] {
+		if userId == actor.Id {
+			return true, approverId, nil
+		}
+	}
+
+	if actor.Role == ROLE_ADMIN {
+		return true, approverId, nil
+	}
+
+	return false, "", nil
+}
@@ -0,0 +1,374 @@
+package utils
+
+import (
+	"chemical-ledger-backend/datetime"
+	"chemical-ledger-backend/db"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// How often the digest job checks whether yesterday's digest is due
+	DIGEST_INTERVAL = 15 * time.Minute
+
+	DIGEST_ANOMALY_DUPLICATE_VOUCHER = "duplicate_voucher"
+	DIGEST_ANOMALY_ADJUSTMENT_OUT    = "adjustment_out"
+	DIGEST_ANOMALY_DELETED_ENTRY     = "deleted_entry"
+	DIGEST_ANOMALY_LARGE_INCOMING    = "large_incoming"
+)
+
+// What happened in the ledger on one day, for supervisors to start the next one with. Low stock and pending
+// approvals are as they were when the digest was made.
+type DailyDigest struct {
+	Date             string               `json:"date"`
+	GeneratedAt      string               `json:"generated_at"`
+	Movements        []DigestMovement     `json:"movements"`
+	LowStock         []DigestLowStock     `json:"low_stock"`
+	PendingApprovals []DigestPendingEntry `json:"pending_approvals"`
+	Anomalies        []DigestAnomaly      `json:"anomalies"`
+}
+
+// Approved quantities moved for a compound on the day, by entry type
+type DigestMovement struct {
+	CompoundId    string `json:"compound_id"`
+	Name          string `json:"name"`
+	Scale         string `json:"scale"`
+	Entries       int    `json:"entries"`
+	Incoming      int    `json:"incoming"`
+	Outgoing      int    `json:"outgoing"`
+	AdjustmentIn  int    `json:"adjustment_in"`
+	AdjustmentOut int    `json:"adjustment_out"`
+	Disposed      int    `json:"disposed"`
+}
+
+type DigestLowStock struct {
+	CompoundId string `json:"compound_id"`
+	Name       string `json:"name"`
+	Scale      string `json:"scale"`
+	NetStock   int    `json:"net_stock"`
+	MinStock   int    `json:"min_stock"`
+}
+
+type DigestPendingEntry struct {
+	EntryId   string `json:"entry_id"`
+	Type      string `json:"type"`
+	Date      string `json:"date"`
+	Compound  string `json:"compound"`
+	Scale     string `json:"scale"`
+	Quantity  int    `json:"quantity"`
+	CreatedBy string `json:"created_by"`
+}
+
+// Entry of the day worth a second look: a voucher number recorded twice for the compound that day, stock taken out
+// by an adjustment rather than an issue, an entry moved to the trash, or a delivery above the plausible bound of its
+// compound, see LargeIncomingBound
+type DigestAnomaly struct {
+	Kind     string `json:"kind"`
+	EntryId  string `json:"entry_id"`
+	Compound string `json:"compound"`
+	Detail   string `json:"detail"`
+}
+
+// Hour of the day (0-23, default 6) from which yesterday's digest is made, set with DIGEST_HOUR
+func DigestHour() int {
+	hour := GetEnvInt("DIGEST_HOUR", 6)
+	if hour < 0 || hour > 23 {
+		slog.Warn("invalid digest hour, using default", "value", hour, "default", 6)
+		return 6
+	}
+	return hour
+}
+
+// Checks every DIGEST_INTERVAL, and once right away, whether yesterday's digest is due, so it is still made when
+// the application was not running at DIGEST_HOUR. In multi-tenant mode each tenant gets a digest of its own.
+func StartDailyDigest(ctx context.Context) {
+	job := func() error { return db.EachDatabase(ctx, RunDailyDigest) }
+
+	subsystem := ScheduleJob("daily-digest", DIGEST_INTERVAL, job)
+	go subsystem.Run(job)
+}
+
+// Makes yesterday's digest once DIGEST_HOUR has passed, and mails it to DIGEST_EMAIL_TO when a mailer is set up.
+// A mail that could not be sent is tried again on the next run.
+func RunDailyDigest(ctx context.Context) error {
+	now := datetime.Now(ctx).Local()
+	if now.Hour() < DigestHour() {
+		return nil
+	}
+	date := now.AddDate(0, 0, -1).Format("2006-01-02")
+
+	digest, emailedAt, err := EnsureDailyDigest(ctx, date)
+	if err != nil {
+		return fmt.Errorf("failed to make daily digest of %s: %w", date, err)
+	}
+
+	mailer, to := GetMailer(), ParseMailAddresses(os.Getenv("DIGEST_EMAIL_TO"))
+	if mailer == nil || len(to) == 0 || emailedAt != 0 {
+		return nil
+	}
+	subject := "Chemical ledger digest of " + date
+	if tenant := db.TenantFrom(ctx); tenant != "" {
+		subject += " for " + tenant
+	}
+	if err := mailer.Send(to, subject, FormatDailyDigest(digest)); err != nil {
+		return fmt.Errorf("failed to mail daily digest of %s: %w", date, err)
+	}
+	if _, err := db.ConnFrom(ctx).ExecContext(ctx, "UPDATE daily_digest SET emailed_at = ? WHERE date = ?", datetime.Now(ctx).Unix(), date); err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "daily digest mailed", "date", date, "recipients", len(to))
+	return nil
+}
+
+// Gets the stored digest of a day that is over, making and storing it first when there is none, with the time it
+// was mailed (0 when it was not). Once stored a digest does not change, so everyone reads the same one.
+func EnsureDailyDigest(ctx context.Context, date string) (*DailyDigest, int64, error) {
+	digest, emailedAt, err := GetDailyDigest(ctx, date)
+	if err != nil || digest != nil {
+		return digest, emailedAt, err
+	}
+
+	day, err := time.ParseInLocation("2006-01-02", date, time.Local)
+	if err != nil {
+		return nil, 0, err
+	}
+	digest, err = BuildDailyDigest(ctx, day)
+	if err != nil {
+		return nil, 0, err
+	}
+	data, err := json.Marshal(digest)
+	if err != nil {
+		return nil, 0, err
+	}
+	// Another request may have made it meanwhile, the one stored first is kept
+	if _, err := db.ConnFrom(ctx).ExecContext(ctx,
+		"INSERT OR IGNORE INTO daily_digest (date, data, generated_at) VALUES (?, ?, ?)",
+		date, string(data), datetime.Now(ctx).Unix(),
+	); err != nil {
+		return nil, 0, err
+	}
+	slog.InfoContext(ctx, "daily digest made", "date", date, "movements", len(digest.Movements), "anomalies", len(digest.Anomalies))
+	return GetDailyDigest(ctx, date)
+}
+
+// Gets the stored digest of a day, or nil when it was not made
+func GetDailyDigest(ctx context.Context, date string) (*DailyDigest, int64, error) {
+	var data string
+	var emailedAt sql.NullInt64
+	err := db.ConnFrom(ctx).QueryRowContext(ctx, "SELECT data, emailed_at FROM daily_digest WHERE date = ?", date).Scan(&data, &emailedAt)
+	if err == sql.ErrNoRows {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	digest := &DailyDigest{}
+	if err := json.Unmarshal([]byte(data), digest); err != nil {
+		return nil, 0, err
+	}
+	return digest, emailedAt.Int64, nil
+}
+
+// Builds the digest of the day starting at the given local midnight
+func BuildDailyDigest(ctx context.Context, day time.Time) (*DailyDigest, error) {
+	from, to := day.Unix(), day.AddDate(0, 0, 1).Unix()
+	digest := &DailyDigest{
+		Date:        day.Format("2006-01-02"),
+		GeneratedAt: datetime.Now(ctx).Local().Format("2006-01-02 15:04"),
+	}
+
+	var err error
+	if digest.Movements, err = getDigestMovements(ctx, from, to); err != nil {
+		return nil, fmt.Errorf("movements: %w", err)
+	}
+	if digest.LowStock, err = getDigestLowStock(ctx); err != nil {
+		return nil, fmt.Errorf("low stock: %w", err)
+	}
+	if digest.PendingApprovals, err = getDigestPendingEntries(ctx); err != nil {
+		return nil, fmt.Errorf("pending approvals: %w", err)
+	}
+	if digest.Anomalies, err = getDigestAnomalies(ctx, from, to); err != nil {
+		return nil, fmt.Errorf("anomalies: %w", err)
+	}
+	return digest, nil
+}
+
+func getDigestMovements(ctx context.Context, from, to int64) ([]DigestMovement, error) {
+	rows, err := db.ConnFrom(ctx).QueryContext(ctx, `
+		SELECT
+			c.id, c.name, c.scale, COUNT(*),
+			SUM(CASE WHEN e.type = ? THEN q.total_quantity ELSE 0 END),
+			SUM(CASE WHEN e.type = ? THEN q.total_quantity ELSE 0 END),
+			SUM(CASE WHEN e.type = ? THEN q.total_quantity ELSE 0 END),
+			SUM(CASE WHEN e.type = ? THEN q.total_quantity ELSE 0 END),
+			SUM(CASE WHEN e.type = ? THEN q.total_quantity ELSE 0 END)
+		FROM entry e
+		JOIN compound c ON e.compound_id = c.id
+		JOIN quantity q ON e.quantity_id = q.id
+		WHERE e.status = ? AND e.deleted_at IS NULL AND e.date >= ? AND e.date < ?
+		GROUP BY c.id
+		ORDER BY c.lower_case_name ASC`,
+		ENTRY_TYPE_INCOMING, ENTRY_TYPE_OUTGOING, ENTRY_TYPE_ADJUSTMENT_IN, ENTRY_TYPE_ADJUSTMENT_OUT,
+		ENTRY_TYPE_DISPOSAL, ENTRY_STATUS_APPROVED, from, to,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	movements := []DigestMovement{}
+	for rows.Next() {
+		var m DigestMovement
+		if err := rows.Scan(&m.CompoundId, &m.Name, &m.Scale, &m.Entries, &m.Incoming, &m.Outgoing, &m.AdjustmentIn, &m.AdjustmentOut, &m.Disposed); err != nil {
+			return nil, err
+		}
+		movements = append(movements, m)
+	}
+	return movements, rows.Err()
+}
+
+func getDigestLowStock(ctx context.Context) ([]DigestLowStock, error) {
+	rows, err := db.ConnFrom(ctx).QueryContext(ctx, `
+		SELECT c.id, c.name, c.scale, COALESCE(s.balance, 0), c.min_stock
+		FROM compound c
+		LEFT JOIN stock_current s ON s.compound_id = c.id
+		WHERE c.min_stock > 0 AND COALESCE(s.balance, 0) < c.min_stock AND c.archived_at IS NULL
+		ORDER BY c.lower_case_name ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	compounds := []DigestLowStock{}
+	for rows.Next() {
+		var c DigestLowStock
+		if err := rows.Scan(&c.CompoundId, &c.Name, &c.Scale, &c.NetStock, &c.MinStock); err != nil {
+			return nil, err
+		}
+		compounds = append(compounds, c)
+	}
+	return compounds, rows.Err()
+}
+
+func getDigestPendingEntries(ctx context.Context) ([]DigestPendingEntry, error) {
+	rows, err := db.ConnFrom(ctx).QueryContext(ctx, `
+		SELECT
+			e.id, e.type, date(e.date, 'unixepoch', 'localtime'), c.name, c.scale, q.total_quantity,
+			COALESCE(u.name, e.created_by, '')
+		FROM entry e
+		JOIN compound c ON e.compound_id = c.id
+		JOIN quantity q ON e.quantity_id = q.id
+		LEFT JOIN user u ON e.created_by = u.id
+		WHERE e.status = ? AND e.deleted_at IS NULL
+		ORDER BY e.date ASC, e.seq ASC`,
+		ENTRY_STATUS_PENDING,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []DigestPendingEntry{}
+	for rows.Next() {
+		var e DigestPendingEntry
+		if err := rows.Scan(&e.EntryId, &e.Type, &e.Date, &e.Compound, &e.Scale, &e.Quantity, &e.CreatedBy); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+func getDigestAnomalies(ctx context.Context, from, to int64) ([]DigestAnomaly, error) {
+	rows, err := db.ConnFrom(ctx).QueryContext(ctx, `
+		SELECT ?, e.id, c.name, 'voucher ' || e.voucher_no || ' also on ' || d.id
+		FROM entry e
+		JOIN compound c ON e.compound_id = c.id
+		JOIN entry d ON d.id = (
+			SELECT id FROM entry
+			WHERE compound_id = e.compound_id AND voucher_no = e.voucher_no AND deleted_at IS NULL AND status != ?
+				AND date >= ? AND date < ? AND (date < e.date OR (date = e.date AND seq < e.seq))
+			ORDER BY date ASC, seq ASC
+			LIMIT 1
+		)
+		WHERE e.voucher_no IS NOT NULL AND e.voucher_no != '' AND e.deleted_at IS NULL AND e.status != ?
+			AND e.date >= ? AND e.date < ?
+
+		UNION ALL
+
+		SELECT ?, e.id, c.name, q.total_quantity || ' ' || c.scale || COALESCE(': ' || NULLIF(e.reason, ''), '')
+		FROM entry e
+		JOIN compound c ON e.compound_id = c.id
+		JOIN quantity q ON e.quantity_id = q.id
+		WHERE e.type = ? AND e.status = ? AND e.deleted_at IS NULL AND e.date >= ? AND e.date < ?
+
+		UNION ALL
+
+		SELECT ?, e.id, c.name, 'moved to the trash by ' || COALESCE(u.name, e.deleted_by, 'unknown')
+		FROM entry e
+		JOIN compound c ON e.compound_id = c.id
+		LEFT JOIN user u ON e.deleted_by = u.id
+		WHERE e.deleted_at >= ? AND e.deleted_at < ?
+
+		UNION ALL
+
+		SELECT ?, e.id, c.name, q.total_quantity || ' ' || c.scale || ', above the plausible ' || e.large_incoming_bound || ' ' || c.scale
+		FROM entry e
+		JOIN compound c ON e.compound_id = c.id
+		JOIN quantity q ON e.quantity_id = q.id
+		WHERE e.large_incoming_bound IS NOT NULL AND e.status != ? AND e.deleted_at IS NULL AND e.date >= ? AND e.date < ?`,
+		DIGEST_ANOMALY_DUPLICATE_VOUCHER, ENTRY_STATUS_REJECTED, from, to, ENTRY_STATUS_REJECTED, from, to,
+		DIGEST_ANOMALY_ADJUSTMENT_OUT, ENTRY_TYPE_ADJUSTMENT_OUT, ENTRY_STATUS_APPROVED, from, to,
+		DIGEST_ANOMALY_DELETED_ENTRY, from, to,
+		DIGEST_ANOMALY_LARGE_INCOMING, ENTRY_STATUS_REJECTED, from, to,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	anomalies := []DigestAnomaly{}
+	for rows.Next() {
+		var a DigestAnomaly
+		if err := rows.Scan(&a.Kind, &a.EntryId, &a.Compound, &a.Detail); err != nil {
+			return nil, err
+		}
+		anomalies = append(anomalies, a)
+	}
+	return anomalies, rows.Err()
+}
+
+// Writes the digest as the plain text of its mail
+func FormatDailyDigest(digest *DailyDigest) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Chemical ledger digest of %s (made %s)\n", digest.Date, digest.GeneratedAt)
+
+	fmt.Fprintf(&b, "\nMovements (%d compounds)\n", len(digest.Movements))
+	for _, m := range digest.Movements {
+		fmt.Fprintf(&b, "- %s: in %d, out %d, adjusted +%d/-%d, disposed %d %s (%d entries)\n",
+			m.Name, m.Incoming, m.Outgoing, m.AdjustmentIn, m.AdjustmentOut, m.Disposed, m.Scale, m.Entries)
+	}
+
+	fmt.Fprintf(&b, "\nBelow minimum stock (%d)\n", len(digest.LowStock))
+	for _, c := range digest.LowStock {
+		fmt.Fprintf(&b, "- %s: %d of %d %s\n", c.Name, c.NetStock, c.MinStock, c.Scale)
+	}
+
+	fmt.Fprintf(&b, "\nWaiting for approval (%d)\n", len(digest.PendingApprovals))
+	for _, e := range digest.PendingApprovals {
+		fmt.Fprintf(&b, "- %s %s %d %s on %s by %s (%s)\n", e.Type, e.Compound, e.Quantity, e.Scale, e.Date, e.CreatedBy, e.EntryId)
+	}
+
+	fmt.Fprintf(&b, "\nTo look into (%d)\n", len(digest.Anomalies))
+	for _, a := range digest.Anomalies {
+		fmt.Fprintf(&b, "- %s %s: %s (%s)\n", strings.ReplaceAll(a.Kind, "_", " "), a.Compound, a.Detail, a.EntryId)
+	}
+	return b.String()
+}
@@ -0,0 +1,136 @@
+package utils
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// How often the free disk space is checked
+const DISK_GUARD_INTERVAL = time.Minute
+
+// Free space of the disk holding the given folder, in bytes. Swapped out by tests and by deployments keeping the
+// database on storage with a quota of its own.
+var FreeDiskSpace = freeDiskSpace
+
+// Free disk space below which users are warned, DISK_WARN_MB (default 1024), and below which the API stops taking
+// changes, DISK_READ_ONLY_MB (default 200), both in megabytes. SQLite failing a write halfway for lack of space can
+// leave a journal it cannot roll back, so changes are refused well before the disk is full. 0 disables either.
+type DiskGuardPolicy struct {
+	WarnMB     int
+	ReadOnlyMB int
+}
+
+func GetDiskGuardPolicy() DiskGuardPolicy {
+	return DiskGuardPolicy{
+		WarnMB:     GetEnvInt("DISK_WARN_MB", 1024),
+		ReadOnlyMB: GetEnvInt("DISK_READ_ONLY_MB", 200),
+	}
+}
+
+// Outcome of the last disk space check
+type DiskStatus struct {
+	Dir       string `json:"dir"`
+	FreeMB    int64  `json:"free_mb"`
+	Warning   bool   `json:"warning"`
+	ReadOnly  bool   `json:"read_only"`
+	CheckedAt string `json:"checked_at"`
+}
+
+var (
+	diskStatusMu sync.Mutex
+	diskStatus   *DiskStatus
+)
+
+// Gets the outcome of the last check, nil before the first one
+func GetDiskStatus() *DiskStatus {
+	diskStatusMu.Lock()
+	defer diskStatusMu.Unlock()
+	if diskStatus == nil {
+		return nil
+	}
+	status := *diskStatus
+	return &status
+}
+
+// Whether the API is read-only for lack of disk space
+func DiskReadOnly() bool {
+	status := GetDiskStatus()
+	return status != nil && status.ReadOnly
+}
+
+// Notice shown to users while the disk is running full, empty otherwise
+func (s *DiskStatus) Notice() string {
+	switch {
+	case s == nil || !s.Warning:
+		return ""
+	case s.ReadOnly:
+		return fmt.Sprintf("%d MB of disk space left, changes are not saved until space is freed", s.FreeMB)
+	}
+	return fmt.Sprintf("%d MB of disk space left", s.FreeMB)
+}
+
+// Checks the disk space every DISK_GUARD_INTERVAL, and once right away so the API does not take changes on a full
+// disk in the meantime
+func StartDiskGuard(dir string) {
+	job := func() error { return CheckDiskSpace(dir) }
+	subsystem := ScheduleJob("disk-guard", DISK_GUARD_INTERVAL, job)
+	subsystem.Run(job)
+}
+
+// Measures the free space of the disk holding the folder and applies the policy. Going into or out of warning or
+// read-only is logged and mailed to DISK_ALERT_EMAIL_TO when a mailer is set up. When the space cannot be measured
+// the last outcome is kept.
+func CheckDiskSpace(dir string) error {
+	free, err := FreeDiskSpace(dir)
+	if err != nil {
+		return fmt.Errorf("failed to get free disk space of %s: %w", dir, err)
+	}
+
+	policy := GetDiskGuardPolicy()
+	freeMB := int64(free / (1 << 20))
+	status := &DiskStatus{
+		Dir:       dir,
+		FreeMB:    freeMB,
+		ReadOnly:  policy.ReadOnlyMB > 0 && freeMB < int64(policy.ReadOnlyMB),
+		CheckedAt: time.Now().Format(time.RFC3339),
+	}
+	status.Warning = status.ReadOnly || policy.WarnMB > 0 && freeMB < int64(policy.WarnMB)
+
+	diskStatusMu.Lock()
+	previous := diskStatus
+	diskStatus = status
+	diskStatusMu.Unlock()
+
+	if previous != nil && previous.Warning == status.Warning && previous.ReadOnly == status.ReadOnly {
+		return nil
+	}
+	var subject string
+	switch {
+	case status.ReadOnly:
+		slog.Error("disk space low, the API is read-only", "dir", dir, "free_mb", freeMB)
+		subject = "Chemical ledger is read-only: disk space low"
+	case status.Warning:
+		slog.Warn("disk space running low", "dir", dir, "free_mb", freeMB)
+		subject = "Chemical ledger: disk space running low"
+	case previous != nil:
+		slog.Info("disk space freed", "dir", dir, "free_mb", freeMB)
+		subject = "Chemical ledger: disk space freed"
+	default:
+		return nil
+	}
+
+	mailer, to := GetMailer(), ParseMailAddresses(os.Getenv("DISK_ALERT_EMAIL_TO"))
+	if mailer == nil || len(to) == 0 {
+		return nil
+	}
+	body := fmt.Sprintf("%d MB of disk space is left for %s.\nWarning below %d MB, read-only below %d MB.\n",
+		freeMB, dir, policy.WarnMB, policy.ReadOnlyMB)
+	// The new state is kept even when the mail fails, the failure shows up on the email subsystem
+	if err := mailer.Send(to, subject, body); err != nil {
+		slog.Error("failed to mail disk space alert", "error", err)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"os"
+)
+
+// Values of DUPLICATE_VOUCHER_CHECK
+const (
+	DUPLICATE_CHECK_OFF    = "off"
+	DUPLICATE_CHECK_WARN   = "warn"
+	DUPLICATE_CHECK_REJECT = "reject"
+)
+
+// What happens to an entry with the voucher number of an entry already recorded for the same compound on the same
+// day, set with DUPLICATE_VOUCHER_CHECK: "off" (the default) records it, "warn" records it and names the entry it
+// duplicates, "reject" refuses it
+func DuplicateVoucherCheck() string {
+	switch check := os.Getenv("DUPLICATE_VOUCHER_CHECK"); check {
+	case "", DUPLICATE_CHECK_OFF:
+		return DUPLICATE_CHECK_OFF
+	case DUPLICATE_CHECK_WARN, DUPLICATE_CHECK_REJECT:
+		return check
+	default:
+		slog.Warn("invalid duplicate voucher check, using default", "value", check, "default", DUPLICATE_CHECK_OFF)
+		return DUPLICATE_CHECK_OFF
+	}
+}
+
+// Finds an entry other than the given one with the same voucher number for the compound on the same day as the
+// given date, returning its ID or "" when there is none. Entries without a voucher number never duplicate each other,
+// nor do rejected entries duplicate the ones sent in again after them.
+func FindDuplicateEntry(ctx context.Context, tx *sql.Tx, compoundId string, date int64, voucherNo string, entryId string) (string, error) {
+	if voucherNo == "" {
+		return "", nil
+	}
+
+	var duplicateId string
+	err := tx.QueryRowContext(ctx, `
+		SELECT id FROM entry
+		WHERE compound_id = ? AND voucher_no = ? AND id != ? AND deleted_at IS NULL AND status != ?
+			AND date(date, 'unixepoch', 'localtime') = date(?, 'unixepoch', 'localtime')
+		ORDER BY date ASC, seq ASC
+		LIMIT 1`,
+		compoundId, voucherNo, entryId, ENTRY_STATUS_REJECTED, date,
+	).Scan(&duplicateId)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return duplicateId, err
+}
@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+)
+
+// SMTP server mail is sent through, read from the environment: SMTP_ADDR (host:port) and SMTP_FROM, and
+// SMTP_USERNAME with SMTP_PASSWORD when the server wants a login. The connection is upgraded to TLS when the server
+// offers it.
+type Mailer struct {
+	Addr     string
+	From     string
+	Username string
+	Password string
+}
+
+// Gets the configured mailer, or nil when no SMTP server is set
+func GetMailer() *Mailer {
+	addr := os.Getenv("SMTP_ADDR")
+	if addr == "" {
+		return nil
+	}
+	return &Mailer{
+		Addr:     addr,
+		From:     os.Getenv("SMTP_FROM"),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+	}
+}
+
+// Sends a plain text mail. Failures are counted under the "email" subsystem, so a mail server that is down shows
+// up in the diagnostics.
+func (m *Mailer) Send(to []string, subject string, body string) error {
+	return RegisterSubsystem("email").Run(func() error {
+		var auth smtp.Auth
+		if m.Username != "" {
+			host, _, _ := net.SplitHostPort(m.Addr)
+			auth = smtp.PlainAuth("", m.Username, m.Password, host)
+		}
+
+		var msg strings.Builder
+		fmt.Fprintf(&msg, "From: %s\r\n", m.From)
+		fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+		fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+		msg.WriteString("MIME-Version: 1.0\r\n")
+		msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+		msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+		return smtp.SendMail(m.Addr, auth, m.From, to, []byte(msg.String()))
+	})
+}
+
+// Splits a comma separated list of mail addresses, leaving out empty ones
+func ParseMailAddresses(list string) []string {
+	addresses := []string{}
+	for _, address := range strings.Split(list, ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			addresses = append(addresses, address)
+		}
+	}
+	return addresses
+}
@@ -0,0 +1,143 @@
+package utils
+
+import (
+	"chemical-ledger-backend/datetime"
+	"chemical-ledger-backend/db"
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// How often the entry lock policy is applied
+const ENTRY_LOCK_INTERVAL = time.Hour
+
+// Policy locking the entries of past months, read from the environment. A month locks ENTRY_LOCK_AFTER_DAYS days
+// after it ends (unset or 0 disables locking), and users are warned ENTRY_LOCK_NOTICE_DAYS days (default 3) before.
+// Locked entries cannot be recorded, changed, reviewed, deleted or restored until an admin unlocks them for a while.
+type EntryLockPolicy struct {
+	AfterDays  int
+	NoticeDays int
+}
+
+func GetEntryLockPolicy() EntryLockPolicy {
+	policy := EntryLockPolicy{
+		AfterDays:  GetEnvInt("ENTRY_LOCK_AFTER_DAYS", 0),
+		NoticeDays: GetEnvInt("ENTRY_LOCK_NOTICE_DAYS", 3),
+	}
+	if policy.NoticeDays < 0 {
+		policy.NoticeDays = 0
+	}
+	return policy
+}
+
+func (p EntryLockPolicy) Enabled() bool {
+	return p.AfterDays > 0
+}
+
+// First day of the month following the last month the policy locks at the given time. Entries dated before it are locked.
+func (p EntryLockPolicy) LockedBefore(at time.Time) time.Time {
+	t := at.Local().AddDate(0, 0, -p.AfterDays)
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.Local)
+}
+
+// The next month to lock after the given time: entries dated before "lockedBefore" lock at "lockAt"
+func (p EntryLockPolicy) NextLock(at time.Time) (lockedBefore time.Time, lockAt time.Time) {
+	lockedBefore = p.LockedBefore(at).AddDate(0, 1, 0)
+	return lockedBefore, lockedBefore.AddDate(0, 0, p.AfterDays)
+}
+
+// Notice shown to users during the days before the next month locks, empty otherwise
+func (p EntryLockPolicy) Notice(at time.Time) string {
+	if !p.Enabled() {
+		return ""
+	}
+	lockedBefore, lockAt := p.NextLock(at)
+	if at.Before(lockAt.AddDate(0, 0, -p.NoticeDays)) {
+		return ""
+	}
+	return fmt.Sprintf("entries dated before %s lock on %s", lockedBefore.Format("2006-01-02"), lockAt.Format("2006-01-02"))
+}
+
+// State of the lock as applied by the scheduled job. "LockedBefore" is a YYYY-MM-DD day; "UnlockedUntil" is the
+// Unix time until which an admin suspended the lock, 0 when it is not.
+type EntryLock struct {
+	LockedBefore  string `json:"locked_before"`
+	LockedAt      int64  `json:"-"`
+	UnlockedUntil int64  `json:"-"`
+	UnlockedBy    string `json:"unlocked_by"`
+}
+
+// Returns the applied lock, nil when nothing has been locked yet
+func GetEntryLock(ctx context.Context) (*EntryLock, error) {
+	lock := &EntryLock{}
+	err := db.ConnFrom(ctx).QueryRowContext(ctx,
+		"SELECT locked_before, locked_at, COALESCE(unlocked_until, 0), COALESCE(unlocked_by, '') FROM entry_lock WHERE id = 1",
+	).Scan(&lock.LockedBefore, &lock.LockedAt, &lock.UnlockedUntil, &lock.UnlockedBy)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return lock, nil
+}
+
+// Returns the first day that is not locked right now, empty when no entries are locked: when locking is disabled,
+// nothing was locked yet or an admin unlocked the entries for the time being.
+func ActiveEntryLock(ctx context.Context) (string, error) {
+	if !GetEntryLockPolicy().Enabled() {
+		return "", nil
+	}
+	lock, err := GetEntryLock(ctx)
+	if err != nil || lock == nil {
+		return "", err
+	}
+	if datetime.Now(ctx).Unix() < lock.UnlockedUntil {
+		return "", nil
+	}
+	return lock.LockedBefore, nil
+}
+
+// Locks the months the policy locks by now. The lock only ever moves forward, so shortening ENTRY_LOCK_AFTER_DAYS
+// locks more months while lengthening it does not unlock any.
+func ApplyEntryLockPolicy(ctx context.Context) error {
+	policy := GetEntryLockPolicy()
+	if !policy.Enabled() {
+		return nil
+	}
+
+	now := datetime.Now(ctx)
+	lockedBefore := policy.LockedBefore(now).Format("2006-01-02")
+	result, err := db.ConnFrom(ctx).ExecContext(ctx, `
+		INSERT INTO entry_lock (id, locked_before, locked_at) VALUES (1, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET locked_before = excluded.locked_before, locked_at = excluded.locked_at
+		WHERE excluded.locked_before > entry_lock.locked_before`,
+		lockedBefore, now.Unix(),
+	)
+	if err != nil {
+		return err
+	}
+	if changed, err := result.RowsAffected(); err == nil && changed > 0 {
+		slog.InfoContext(ctx, "locked entries", "locked_before", lockedBefore)
+		RecordAudit(ctx, nil, AUDIT_ACTOR_SYSTEM, "entry_lock.advance", AUDIT_TARGET_ENTRY_LOCK, lockedBefore, nil)
+	}
+
+	if notice := policy.Notice(now); notice != "" {
+		slog.WarnContext(ctx, "entries lock soon", "notice", notice)
+	}
+	return nil
+}
+
+// Applies the entry lock policy every ENTRY_LOCK_INTERVAL, and once right away, to the database of every tenant in
+// multi-tenant mode. Does nothing when locking is disabled.
+func StartEntryLock(ctx context.Context) {
+	if !GetEntryLockPolicy().Enabled() {
+		return
+	}
+	job := func() error { return db.EachDatabase(ctx, ApplyEntryLockPolicy) }
+
+	subsystem := ScheduleJob("entry-lock", ENTRY_LOCK_INTERVAL, job)
+	go subsystem.Run(job)
+}
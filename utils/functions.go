@@ -2,208 +2,156 @@ package utils
 
 import (
 	"chemical-ledger-backend/db"
-	"database/sql"
-	"encoding/json"
-	"errors"
+	"chemical-ledger-backend/retry"
+	"context"
 	"fmt"
 	"log/slog"
-	"net/http"
+	"os"
 	"strconv"
 	"strings"
-	"time"
 )
 
-// Decodes the JSON request body into the given object
-func DecodeJsonReq(r *http.Request, obj any) ErrorMessage {
-	err := json.NewDecoder(r.Body).Decode(obj)
+// Gets the value of the given environment variable as an integer, falling back to the default when unset or invalid
+func GetEnvInt(name string, defaultValue int) int {
+	str := os.Getenv(name)
+	if str == "" {
+		return defaultValue
+	}
+	num, err := strconv.Atoi(str)
 	if err != nil {
-		slog.Error(err.Error())
-		return REQUEST_BODY_DECODE_ERR
+		slog.Warn("invalid integer environment variable, using default", "name", name, "value", str, "default", defaultValue)
+		return defaultValue
 	}
-	return NO_ERR
+	return num
 }
 
-// Encodes the given object into JSON and writes it to the response
-func EncodeJsonRes(w http.ResponseWriter, status int, obj *Resp) error {
-	w.WriteHeader(status)
-	return json.NewEncoder(w).Encode(obj)
+// Gets the value of the given environment variable as a boolean, falling back to the default when unset or invalid
+func GetEnvBool(name string, defaultValue bool) bool {
+	str := os.Getenv(name)
+	if str == "" {
+		return defaultValue
+	}
+	value, err := strconv.ParseBool(str)
+	if err != nil {
+		slog.Warn("invalid boolean environment variable, using default", "name", name, "value", str, "default", defaultValue)
+		return defaultValue
+	}
+	return value
 }
 
-// Encodes the given error into JSON and writes it to the response
-func RespWithError(w http.ResponseWriter, status int, errStr ErrorMessage) {
-	EncodeJsonRes(w, status, NewRespWithError(errStr))
-}
+func CheckIfCompoundExists(ctx context.Context, compoundId string) (bool, error) {
+	var compoundExists bool
+	err := retry.Once(func() error {
+		return db.ConnFrom(ctx).QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM compound WHERE id = ?)", compoundId).Scan(&compoundExists)
+	})
 
-// Encodes the given data into JSON and writes it to the response
-func RespWithData(w http.ResponseWriter, status int, data any) {
-	EncodeJsonRes(w, status, NewRespWithData(data))
-}
+	if err != nil {
+		return false, err
+	}
 
-// Gets the value of the given parameter from the URL query string
-func GetParam(r *http.Request, param string) string {
-	return r.URL.Query().Get(param)
+	return compoundExists, nil
 }
 
-// Gets the value of the given parameter from the URL query string and converts it to an integer
-func GetIntParam(r *http.Request, param string) (int, error) {
-	str := GetParam(r, param)
-	if str == "" {
-		return 0, nil
-	}
-	num, err := strconv.Atoi(str)
+// Returns the warning pinned on a compound, empty when there is none
+func GetCompoundPinnedWarning(ctx context.Context, compoundId string) (string, error) {
+	var warning string
+	err := retry.Once(func() error {
+		return db.ConnFrom(ctx).QueryRowContext(ctx, "SELECT pinned_warning FROM compound WHERE id = ?", compoundId).Scan(&warning)
+	})
 	if err != nil {
-		return 0, err
+		return "", err
 	}
-	return num, nil
+	return warning, nil
 }
 
-// Retries the given function up to a maximum of 1 time if first time it returns error
-func IfErrRetry(f func() error) error {
-	const (
-		maxRetries = 1
-		retryDelay = 100 * time.Millisecond
-	)
-
-	var err error
-	for _ = range maxRetries + 1 {
-		err = f()
-		if err == nil {
-			return nil
-		}
-		time.Sleep(retryDelay)
+// Returns the scale a compound is measured in
+func GetCompoundScale(ctx context.Context, compoundId string) (string, error) {
+	var scale string
+	err := retry.Once(func() error {
+		return db.ConnFrom(ctx).QueryRowContext(ctx, "SELECT scale FROM compound WHERE id = ?", compoundId).Scan(&scale)
+	})
+	if err != nil {
+		return "", err
 	}
-
-	return err
+	return scale, nil
 }
 
-// Gets the Unix timestamp of the given date with the current time
-func GetDateUnix(date string) int64 {
-	t, _ := time.Parse("2006-01-02", date)
+func CheckIfSupplierExists(ctx context.Context, supplierId string) (bool, error) {
+	var supplierExists bool
+	err := retry.Once(func() error {
+		return db.ConnFrom(ctx).QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM supplier WHERE id = ?)", supplierId).Scan(&supplierExists)
+	})
 
-	now := time.Now().Local()
-	nowDate := time.Date(t.Year(), t.Month(), t.Day(), now.Hour(), now.Minute(), now.Second(), 0, now.Location())
+	if err != nil {
+		return false, err
+	}
 
-	return nowDate.Unix()
+	return supplierExists, nil
 }
 
-func MergeDateWithUnixTime(dateStr string, unixTime int64) (int64, error) {
-	// Define IST as +05:30
-	ist := time.FixedZone("IST", 5*60*60+30*60)
+func CheckIfRecipientExists(ctx context.Context, recipientId string) (bool, error) {
+	var recipientExists bool
+	err := retry.Once(func() error {
+		return db.ConnFrom(ctx).QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM recipient WHERE id = ?)", recipientId).Scan(&recipientExists)
+	})
 
-	// Parse the date string in IST
-	date, err := time.ParseInLocation("2006-01-02", dateStr, ist)
 	if err != nil {
-		return 0, fmt.Errorf("invalid date format: %w", err)
+		return false, err
 	}
 
-	// Convert the Unix timestamp to time.Time in IST
-	t := time.Unix(unixTime, 0).In(ist)
-
-	// Merge the date with the time from the Unix timestamp
-	merged := time.Date(
-		date.Year(), date.Month(), date.Day(),
-		t.Hour(), t.Minute(), t.Second(), t.Nanosecond(),
-		ist,
-	)
+	return recipientExists, nil
+}
 
-	return merged.Unix(), nil
+// Escapes the wildcards of LIKE in text typed by users, so it is matched literally by a LIKE ... ESCAPE '\'
+func EscapeLike(text string) string {
+	return likeEscaper.Replace(text)
 }
 
-func UpdateNetStockFromTodayOnwards(tx *sql.Tx, compoundId string, date int64) ErrorMessage {
-	var netStock int
-	err := IfErrRetry(func() error {
-		err := tx.QueryRow("SELECT net_stock FROM entry WHERE compound_id = ? AND date < ? ORDER BY date DESC LIMIT 1", compoundId, date).Scan(&netStock)
-		if err != nil && !errors.Is(err, sql.ErrNoRows) {
-			return errors.New("error retrieving previous stock")
-		}
-		return nil
-	})
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
 
-	if err != nil {
-		slog.Error(fmt.Sprintf("Error retrieving previous stock for compound '%s': %v", compoundId, err))
-		return STOCK_RETRIEVAL_ERR
-	}
-
-	var rows *sql.Rows
-	err = IfErrRetry(func() error {
-		var queryErr error
-		rows, queryErr = tx.Query(`
-SELECT
-	e.id,
-	e.type,
-	q.num_of_units * q.quantity_per_unit,
-	e.date
-FROM entry e
-JOIN quantity q ON e.quantity_id = q.id
-WHERE
-	e.compound_id = ? AND e.date >= ?
-ORDER BY
-	e.date ASC
-		`, compoundId, date)
-		return queryErr
+func CheckIfInstrumentExists(ctx context.Context, instrumentId string) (bool, error) {
+	var instrumentExists bool
+	err := retry.Once(func() error {
+		return db.ConnFrom(ctx).QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM instrument WHERE id = ?)", instrumentId).Scan(&instrumentExists)
 	})
 
 	if err != nil {
-		slog.Error(fmt.Sprintf("Error retrieving subsequent entries for compound '%s': %v", compoundId, err))
-		return ENTRY_RETRIEVAL_ERR
+		return false, err
 	}
 
-	defer rows.Close()
-
-	var updateQueriesBuilder strings.Builder
-	for rows.Next() {
-		var entry struct {
-			Id       string
-			Type     string
-			Quantity int
-			Date     int
-		}
-		err := rows.Scan(&entry.Id, &entry.Type, &entry.Quantity, &entry.Date)
-		if err != nil {
-			return ENTRY_UPDATE_SCAN_ERR
-		}
-
-		switch entry.Type {
-		case ENTRY_TYPE_INCOMING:
-			netStock += entry.Quantity
-		case ENTRY_TYPE_OUTGOING:
-			netStock -= entry.Quantity
-		}
+	return instrumentExists, nil
+}
 
-		if netStock < 0 {
-			return INSUFFICIENT_STOCK_ERR
-		}
-		updateQueriesBuilder.WriteString(fmt.Sprintf("UPDATE entry SET net_stock = %d WHERE id = '%s';\n", netStock, entry.Id))
-	}
+func CheckIfLocationExists(ctx context.Context, locationId string) (bool, error) {
+	var locationExists bool
+	err := retry.Once(func() error {
+		return db.ConnFrom(ctx).QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM location WHERE id = ?)", locationId).Scan(&locationExists)
+	})
 
-	updateQueries := updateQueriesBuilder.String()
-	if updateQueries != "" {
-		_, err = tx.Exec(updateQueries)
-		if err != nil {
-			return SUBSEQUENT_UPDATE_ERR
-		}
+	if err != nil {
+		return false, err
 	}
 
-	return NO_ERR
+	return locationExists, nil
 }
 
-func CheckIfCompoundExists(compoundId string) (bool, error) {
-	var compoundExists bool
-	err := IfErrRetry(func() error {
-		return db.Conn.QueryRow("SELECT EXISTS(SELECT 1 FROM compound WHERE id = ?)", compoundId).Scan(&compoundExists)
+func CheckIfProjectExists(ctx context.Context, projectId string) (bool, error) {
+	var projectExists bool
+	err := retry.Once(func() error {
+		return db.ConnFrom(ctx).QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM project WHERE id = ?)", projectId).Scan(&projectExists)
 	})
 
 	if err != nil {
 		return false, err
 	}
 
-	return compoundExists, nil
+	return projectExists, nil
 }
 
-func CheckIfLowerCaseCompoundExists(lowerCasedName string) (bool, error) {
+func CheckIfLowerCaseCompoundExists(ctx context.Context, lowerCasedName string) (bool, error) {
 	var lowerCaseCompoundExists bool
-	err := IfErrRetry(func() error {
-		return db.Conn.QueryRow("SELECT EXISTS(SELECT 1 FROM compound WHERE lower_case_name = ?)", lowerCasedName).Scan(&lowerCaseCompoundExists)
+	err := retry.Once(func() error {
+		return db.ConnFrom(ctx).QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM compound WHERE lower_case_name = ?)", lowerCasedName).Scan(&lowerCaseCompoundExists)
 	})
 
 	if err != nil {
@@ -220,3 +168,28 @@ func GetLowerCasedCompoundName(compoundName string) string {
 	}
 	return strings.Join(subStrs, "-")
 }
+
+// Gets the total quantity of an entry in its compound's scale, e.g. 4 boxes × 6 bottles × 500 ml = 12000 ml.
+// The partial quantity is what was drawn from an already open unit.
+func GetTotalQuantity(numOfUnits, packsPerUnit, quantityPerUnit, partialQuantity int) int {
+	return numOfUnits*max(packsPerUnit, 1)*quantityPerUnit + partialQuantity
+}
+
+// Formats the packaging of an entry for display, e.g. "4 × 6 × 500 ml (12000 ml)", "2 × 250 g (500 g)"
+// when there is no middle packaging level, or "1 × 500 ml + 150 ml (650 ml)" with a partial quantity
+func FormatPackaging(numOfUnits, packsPerUnit, quantityPerUnit, partialQuantity int, scale string) string {
+	total := GetTotalQuantity(numOfUnits, packsPerUnit, quantityPerUnit, partialQuantity)
+
+	parts := []string{}
+	if numOfUnits > 0 && quantityPerUnit > 0 {
+		if packsPerUnit > 1 {
+			parts = append(parts, fmt.Sprintf("%d × %d × %d %s", numOfUnits, packsPerUnit, quantityPerUnit, scale))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d × %d %s", numOfUnits, quantityPerUnit, scale))
+		}
+	}
+	if partialQuantity > 0 {
+		parts = append(parts, fmt.Sprintf("%d %s", partialQuantity, scale))
+	}
+	return fmt.Sprintf("%s (%d %s)", strings.Join(parts, " + "), total, scale)
+}
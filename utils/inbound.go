@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"encoding/hex"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const (
+	// Header carrying the signature of an inbound event: "sha256=" and the hex HMAC-SHA256 of the raw body, keyed
+	// with the secret of its source
+	INBOUND_SIGNATURE_HEADER = "X-Signature-256"
+
+	// Inactive user the entries of inbound integrations are recorded by, see db/create-tables.sql. Its role decides
+	// whether they wait for approval, as it does for users.
+	INBOUND_USER_ID = "U_inbound"
+)
+
+var inboundSourcePattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// Whether a name can be that of an inbound source: lowercase letters and digits, separated by dashes
+func ValidInboundSource(source string) bool {
+	return inboundSourcePattern.MatchString(source)
+}
+
+// Secret an inbound integration signs its events with, set with INBOUND_SECRET_<SOURCE>, e.g.
+// INBOUND_SECRET_PROCUREMENT for the source "procurement". Events of sources without one are not accepted, so ""
+// is returned for them as for invalid names.
+func InboundSecret(source string) string {
+	if !ValidInboundSource(source) {
+		return ""
+	}
+	return os.Getenv("INBOUND_SECRET_" + strings.ToUpper(strings.ReplaceAll(source, "-", "_")))
+}
+
+// Whether the signature header of an inbound event matches its body, compared in constant time
+func VerifyInboundSignature(secret string, body []byte, signature string) bool {
+	sent, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil || !strings.HasPrefix(signature, "sha256=") {
+		return false
+	}
+	return hmac.Equal(sent, hmacSHA256([]byte(secret), string(body)))
+}
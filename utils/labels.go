@@ -0,0 +1,64 @@
+package utils
+
+import "fmt"
+
+// Most labels printed at once, so a mistyped number of copies does not print a ream
+const MAX_LABELS = 1000
+
+// Millimetres to PDF points
+const pdfPointsPerMM = 72 / 25.4
+
+// Layout of the label stationery on an A4 sheet, read from the environment: LABEL_ROWS (default 7) by
+// LABEL_COLUMNS (default 3) labels, LABEL_MARGIN_TOP_MM (default 15) above and below them, LABEL_MARGIN_SIDE_MM
+// (default 7) left and right of them and LABEL_GAP_MM (default 2) between them. Labels share the rest of the
+// sheet evenly.
+type LabelSheet struct {
+	Rows         int `json:"rows"`
+	Columns      int `json:"columns"`
+	MarginTopMM  int `json:"margin_top_mm"`
+	MarginSideMM int `json:"margin_side_mm"`
+	GapMM        int `json:"gap_mm"`
+}
+
+func GetLabelSheet() LabelSheet {
+	return LabelSheet{
+		Rows:         GetEnvInt("LABEL_ROWS", 7),
+		Columns:      GetEnvInt("LABEL_COLUMNS", 3),
+		MarginTopMM:  GetEnvInt("LABEL_MARGIN_TOP_MM", 15),
+		MarginSideMM: GetEnvInt("LABEL_MARGIN_SIDE_MM", 7),
+		GapMM:        GetEnvInt("LABEL_GAP_MM", 2),
+	}
+}
+
+// Size of each label in PDF points
+func (s LabelSheet) LabelSize() (width, height float64) {
+	gap := float64(s.GapMM) * pdfPointsPerMM
+	width = (PDF_PAGE_WIDTH - 2*float64(s.MarginSideMM)*pdfPointsPerMM - float64(s.Columns-1)*gap) / float64(s.Columns)
+	height = (PDF_PAGE_HEIGHT - 2*float64(s.MarginTopMM)*pdfPointsPerMM - float64(s.Rows-1)*gap) / float64(s.Rows)
+	return width, height
+}
+
+// Top left corner of the label at the given position on the sheet, counting row by row from the top left
+func (s LabelSheet) LabelOrigin(position int) (x, y float64) {
+	width, height := s.LabelSize()
+	gap := float64(s.GapMM) * pdfPointsPerMM
+	row, column := position/s.Columns, position%s.Columns
+	x = float64(s.MarginSideMM)*pdfPointsPerMM + float64(column)*(width+gap)
+	y = float64(s.MarginTopMM)*pdfPointsPerMM + float64(row)*(height+gap)
+	return x, y
+}
+
+func (s LabelSheet) LabelsPerSheet() int {
+	return s.Rows * s.Columns
+}
+
+// Checks the layout leaves labels of at least 25 by 10 mm, describing the problem otherwise
+func (s LabelSheet) Validate() error {
+	if s.Rows < 1 || s.Columns < 1 || s.MarginTopMM < 0 || s.MarginSideMM < 0 || s.GapMM < 0 {
+		return fmt.Errorf("rows and columns must be at least 1 and margins and gaps not negative")
+	}
+	if width, height := s.LabelSize(); width < 25*pdfPointsPerMM || height < 10*pdfPointsPerMM {
+		return fmt.Errorf("labels of %.0f by %.0f mm are too small to print on", width/pdfPointsPerMM, height/pdfPointsPerMM)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package utils
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"os"
+	"sort"
+)
+
+// Values of LARGE_INCOMING_CHECK
+const (
+	LARGE_INCOMING_OFF     = "off"
+	LARGE_INCOMING_WARN    = "warn"
+	LARGE_INCOMING_CONFIRM = "confirm"
+
+	// Deliveries of a compound its bound is derived from when none is set: the ones of the past year, as long as
+	// there are enough of them to tell what is usual
+	LARGE_INCOMING_HISTORY_DAYS       = 365
+	LARGE_INCOMING_HISTORY_DELIVERIES = 3
+)
+
+// What happens to an incoming entry above the plausible bound of its compound, set with LARGE_INCOMING_CHECK:
+// "off" records it, "warn" (the default) records it and flags it, "confirm" refuses it until it is confirmed and then
+// records it flagged
+func LargeIncomingCheck() string {
+	switch check := os.Getenv("LARGE_INCOMING_CHECK"); check {
+	case "":
+		return LARGE_INCOMING_WARN
+	case LARGE_INCOMING_OFF, LARGE_INCOMING_WARN, LARGE_INCOMING_CONFIRM:
+		return check
+	default:
+		slog.Warn("invalid large incoming check, using default", "value", check, "default", LARGE_INCOMING_WARN)
+		return LARGE_INCOMING_WARN
+	}
+}
+
+// How many times its usual delivery (default 5) an incoming quantity of a compound may be before it is flagged, when
+// the compound has no "max_incoming" of its own, set with LARGE_INCOMING_FACTOR
+func LargeIncomingFactor() int {
+	factor := GetEnvInt("LARGE_INCOMING_FACTOR", 5)
+	if factor < 1 {
+		slog.Warn("invalid large incoming factor, using default", "value", factor, "default", 5)
+		return 5
+	}
+	return factor
+}
+
+// Largest incoming quantity of a compound that is plausible as of the given date, or 0 when there is no bound. It is
+// the "max_incoming" of the compound when set, otherwise LargeIncomingFactor times the median of its approved
+// deliveries over the LARGE_INCOMING_HISTORY_DAYS before the date. The median is used so that a single past typo does
+// not raise the bound. Compounds with fewer than LARGE_INCOMING_HISTORY_DELIVERIES deliveries have no bound yet.
+func LargeIncomingBound(ctx context.Context, tx *sql.Tx, compoundId string, date int64) (int, error) {
+	var maxIncoming int
+	if err := tx.QueryRowContext(ctx, "SELECT max_incoming FROM compound WHERE id = ?", compoundId).Scan(&maxIncoming); err != nil {
+		return 0, err
+	}
+	if maxIncoming > 0 {
+		return maxIncoming, nil
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT q.total_quantity
+		FROM entry e
+		JOIN quantity q ON e.quantity_id = q.id
+		WHERE e.compound_id = ? AND e.type = ? AND e.status = ? AND e.deleted_at IS NULL AND e.date <= ? AND e.date > ?`,
+		compoundId, ENTRY_TYPE_INCOMING, ENTRY_STATUS_APPROVED, date, date-LARGE_INCOMING_HISTORY_DAYS*24*60*60,
+	)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	quantities := []int{}
+	for rows.Next() {
+		var quantity int
+		if err := rows.Scan(&quantity); err != nil {
+			return 0, err
+		}
+		quantities = append(quantities, quantity)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(quantities) < LARGE_INCOMING_HISTORY_DELIVERIES {
+		return 0, nil
+	}
+
+	sort.Ints(quantities)
+	return quantities[len(quantities)/2] * LargeIncomingFactor(), nil
+}
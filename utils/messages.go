@@ -1,43 +1,341 @@
 package utils
 
+// Message a request failed with, sent to the client as the error of the response
+type ErrorMessage string
+
 const (
 	REQUEST_BODY_DECODE_ERR = "Unable to read the request body. Ensure the data format is correct."
 
 	TRIAL_PERIOD_LIMIT_EXCEEDED = "Trial period limit exceeded. Please contact the developers."
+	QUOTA_RETRIEVAL_ERR         = "Failed to retrieve quota data."
+	DISK_SPACE_READ_ONLY        = "The disk is almost full, so changes cannot be saved for now. Free up disk space and try again."
+	INTERNAL_SERVER_ERR         = "Something went wrong on the server. Quote the request ID when reporting it."
+	REQUEST_TIMEOUT             = "The request took too long and was canceled. Narrow it down, e.g. to fewer days, and try again."
 
-	MISSING_REQUIRED_FIELDS = "Required fields are missing. Complete all necessary fields and try again."
-	INVALID_ENTRY_TYPE      = "Unrecognized entry type. Use a valid entry type."
-	INVALID_DATE_FORMAT     = "Invalid date format. Use the format YYYY-MM-DD."
-	FUTURE_DATE_ERR         = "The selected date is in the future. Use a current or past date."
-	INVALID_DATE_RANGE      = "Invalid date range. Check the start and end dates."
+	MISSING_REQUIRED_FIELDS    = "Required fields are missing. Complete all necessary fields and try again."
+	INVALID_TIMELINE_FILTER    = "Give exactly one of voucher_no, recipient_id or project_id for the timeline."
+	INVALID_ENTRY_TYPE         = "Unrecognized entry type. Use a valid entry type."
+	INVALID_DATE_FORMAT        = "Invalid date format. Use the format YYYY-MM-DD."
+	FUTURE_DATE_ERR            = "The selected date is in the future. Use a current or past date."
+	INVALID_DATE_RANGE         = "Invalid date range. Check the start and end dates."
+	INVALID_GROUP_BY           = "Invalid grouping. Use one of the available grouping options."
+	INVALID_INTERVAL           = "Invalid interval. Use day, week or month."
+	INVALID_CONSUMPTION_WINDOW = "Invalid months. Use a number of months between 1 and 24."
+	INVALID_REPORT_LIMIT       = "Invalid limit. Use a number between 1 and 100."
+	INVALID_IDLE_DAYS          = "Invalid days. Use a number of days between 1 and 3650."
+	INVALID_NUMBER             = "Invalid number. Use whole numbers only."
+	AMBIGUOUS_NUMBER           = "Ambiguous number. Write it without separators."
+	NUMBER_LOCALE_MISMATCH     = "Number format does not match the configured locale."
+	INVALID_QUANTITY_UNIT      = "Unrecognized quantity unit. Use mg, g, kg, ml, l or another unit listed by /units."
+	UNIT_SCALE_MISMATCH        = "The quantity unit measures another kind of quantity (mass or volume) than the unit the compound is measured in."
+	UNIT_CONVERSION_ERR        = "The quantity does not convert to a whole number in the unit the compound is measured in."
+	INVALID_DISPLAY_UNIT       = "The display unit must be a unit listed by /units of the same kind (mass or volume) as the scale of the compound."
+	UNIT_CONVERSION_NEEDED     = "The quantity is in another unit than the compound is measured in. Set convert_unit to record it converted."
+	INVALID_REPORT_FORMAT      = "Unsupported format. Use one of the formats this endpoint offers."
 
-	INVALID_COMPOUND_ID          = "Compound ID does not match any existing records."
-	COMPOUND_ALREADY_EXISTS      = "A compound with the same name already exists. Use a different name."
-	INVALID_COMPOUND_FILTER_TYPE = "Invalid filter type for compound. Check available filter options."
+	INVALID_COMPOUND_ID            = "Compound ID does not match any existing records."
+	TOO_MANY_ENTRY_COMPOUNDS       = "Too many compounds. List at most 20 compound IDs at once."
+	COMPOUND_ALREADY_EXISTS        = "A compound with the same name already exists. Use a different name."
+	INVALID_COMPOUND_FILTER_TYPE   = "Invalid filter type for compound. Check available filter options."
+	COMPOUND_IN_USE                = "The compound has entries, stock-take counts, purchase orders or invoices and cannot be deleted. Archive it instead."
+	SAME_COMPOUND_MERGE            = "A compound cannot be merged into itself."
+	COMPOUND_MERGE_SCALE_MISMATCH  = "Only compounds measured in the same scale can be merged."
+	COMPOUND_MERGE_TARGET_ARCHIVED = "The compound to merge into is archived. Unarchive it first."
+	COMPOUND_MERGE_COUNT_CONFLICT  = "Both compounds were counted in the same stock-take. Remove one of the counts before merging."
+	COMPOUND_SCALE_IN_USE          = "The compound has entries, stock-take counts, purchase orders or invoices in its scale, so the scale cannot change."
 
 	INVALID_ENTRY_ID = "Entry ID not found in records."
 
-	INVALID_SCALE_ERR = "Provided scale value is invalid."
+	INVALID_ENTRY_STATUS   = "Unrecognized entry status. Use pending, approved or rejected."
+	ENTRY_NOT_PENDING      = "The entry has already been reviewed."
+	FORBIDDEN_APPROVAL     = "You are not the approver of this entry and no delegation lets you act for them."
+	INVALID_ENTRY_VERSION  = "Version does not match any earlier version of the entry."
+	ENTRY_PERIOD_LOCKED    = "The entry falls in a locked month. Ask an admin to unlock entries first."
+	NOTHING_LOCKED         = "No entries are locked."
+	INVALID_UNLOCK_HOURS   = "Unlock for between 1 and 168 hours."
+	ENTRY_NOT_DELETED      = "The entry is not in the trash."
+	ENTRY_VERSION_REQUIRED = "Send the version of the entry being changed, in the If-Match header or the \"version\" field."
+	STALE_ENTRY_VERSION    = "The entry was changed since it was loaded. Load it again and reapply the changes."
+
+	INVALID_STOCK_TAKE_ID    = "Stock-take ID does not match any stock-take."
+	STOCK_TAKE_CLOSED        = "The stock-take is already approved and can no longer change."
+	INVALID_COUNTED_QUANTITY = "Counted quantities must be zero or more."
+	STOCK_TAKE_EMPTY         = "Nothing has been counted in this stock-take yet."
+
+	INVALID_VOUCHER_PATTERN     = "Invalid voucher pattern. Use a valid regular expression."
+	INVALID_VOUCHER_REPLACEMENT = "The replacement leaves some vouchers without a number. Check the pattern and replacement."
+	VOUCHER_COLLISION           = "Renumbering would give different vouchers the same number, nothing was changed. Check the listed collisions."
+	DUPLICATE_VOUCHER_ENTRY     = "An entry with this voucher number is already recorded for the compound on this day."
+	LARGE_INCOMING_QUANTITY     = "The quantity is far above the usual deliveries of this compound. Check it, and send confirm_large_quantity if it is right."
+
+	INVALID_SUPPLIER_ID     = "Supplier ID does not match any existing records."
+	SUPPLIER_ALREADY_EXISTS = "A supplier with the same name already exists. Use a different name."
+	SUPPLIER_ON_OUTGOING    = "A supplier can only be set on incoming entries."
+	SUPPLIER_IN_USE         = "The supplier is linked to existing entries, purchase orders or invoices and cannot be deleted."
+
+	INVALID_RECIPIENT_ID            = "Recipient ID does not match any existing records."
+	RECIPIENT_ALREADY_EXISTS        = "A recipient with the same name already exists. Use a different name."
+	RECIPIENT_ON_INCOMING           = "A recipient can only be set on outgoing entries."
+	MISSING_ADJUSTMENT_REASON       = "Adjustments need a reason. Describe why the stock is corrected."
+	MISSING_DISPOSAL_FIELDS         = "Disposals need a disposal method and who authorized them."
+	INVALID_DISPOSAL_METHOD         = "Unrecognized disposal method. Use incineration, neutralization, drain, landfill, licensed-contractor or return-to-supplier."
+	DISPOSAL_FIELDS_ON_NON_DISPOSAL = "A disposal method and authorizer are only allowed on disposal entries."
+	REASON_ON_NON_ADJUSTMENT        = "A reason can only be set on adjustment entries."
+
+	RECIPIENT_IN_USE = "The recipient is linked to existing entries and cannot be deleted."
+
+	INVALID_INSTRUMENT_ID     = "Instrument ID does not match any existing records."
+	INSTRUMENT_ALREADY_EXISTS = "An instrument with the same name already exists. Use a different name."
+	INSTRUMENT_ON_INCOMING    = "An instrument can only be set on outgoing entries."
+	INVALID_INSTRUMENT_EVENT  = "Unrecognized instrument event. Use calibration, maintenance or leave it empty."
+	INSTRUMENT_EVENT_ALONE    = "An instrument event needs the instrument it was for."
+	INSTRUMENT_IN_USE         = "The instrument is linked to existing entries and cannot be deleted."
+
+	INVALID_LOCATION_ID         = "Location ID does not match any existing records."
+	LOCATION_ALREADY_EXISTS     = "A location with the same name already exists. Use a different name."
+	LOCATION_IN_USE             = "The location is linked to existing entries and cannot be deleted."
+	MISSING_TRANSFER_LOCATION   = "Transfers need the location the stock is moved to."
+	SAME_TRANSFER_LOCATION      = "A transfer must move the stock to another location than it is taken from."
+	TO_LOCATION_ON_NON_TRANSFER = "A location to move the stock to can only be set on transfer entries."
+
+	INVALID_PROJECT_ID     = "Project ID does not match any existing records."
+	PROJECT_ALREADY_EXISTS = "A project with the same name already exists. Use a different name."
+	PROJECT_ON_INCOMING    = "A project can only be set on outgoing entries."
+	PROJECT_IN_USE         = "The project is linked to existing entries and cannot be deleted."
+
+	INVALID_PURCHASE_ORDER_ID     = "Purchase order ID does not match any existing records."
+	INVALID_PO_LINE_ID            = "Purchase order line ID does not match any existing records."
+	EMPTY_PURCHASE_ORDER          = "A purchase order needs at least one line."
+	INVALID_PO_LINE_QUANTITY      = "Ordered quantities must be more than zero."
+	PO_LINE_ON_NON_INCOMING       = "A purchase order line can only be set on incoming entries."
+	PO_LINE_COMPOUND_MISMATCH     = "The purchase order line is for another compound."
+	PO_LINE_SUPPLIER_MISMATCH     = "The purchase order is placed with another supplier."
+	PURCHASE_ORDER_CANCELLED      = "The purchase order is cancelled."
+	PURCHASE_ORDER_RECEIVED       = "Deliveries were already recorded against the purchase order, so it can no longer be cancelled."
+	INVALID_PURCHASE_ORDER_STATUS = "Unrecognized purchase order status. Use open, partially_received, received or cancelled."
+	INVALID_INVOICE_ID            = "Invoice ID does not match any existing records."
+	EMPTY_INVOICE                 = "An invoice needs at least one line."
+	INVALID_INVOICE_LINE          = "Invoiced quantities must be more than zero and amounts cannot be negative."
+	DUPLICATE_INVOICE             = "An invoice with this number was already entered for the supplier."
+	INVALID_MONTH_FORMAT          = "Invalid month format. Use YYYY-MM."
+	INVALID_RESERVATION_ID        = "Reservation ID does not match any reservation still held."
+	INVALID_RESERVATION_QUANTITY  = "Reserved quantities must be more than zero."
+	RESERVATION_IN_PAST           = "The day a reservation is needed on cannot be in the past."
+	RESERVATION_EXCEEDS_AVAILABLE = "The quantity is more than is available of the compound, after what is reserved already."
+	RESERVATION_NOT_OWN           = "Only admins and supervisors can cancel reservations made by other users."
+
+	UNKNOWN_USER          = "User not recognised or deactivated. Sign in again."
+	PPROF_REMOTE          = "Profiles can only be captured from the machine the backend runs on."
+	LOCAL_USER_REMOTE     = "Only requests from this machine act as the local administrator. Sign in with your user's token."
+	USER_TOKEN_REQUIRED   = "Sign in with your user's token, sent as \"Authorization: Bearer <token>\"."
+	INVALID_USER_TOKEN    = "The token is unknown or revoked, or belongs to another user than X-User-Id names."
+	INVALID_USER_TOKEN_ID = "Token ID does not match any token in use."
+	LOCAL_USER_TOKEN      = "The local administrator acts from this machine only and gets no token."
+	TENANT_REQUIRED       = "Name the school whose ledger to use, by its address or in X-Tenant-Id."
+	UNKNOWN_TENANT        = "No ledger is hosted for this school."
+	TENANT_DATABASE_ERR   = "The ledger of this school could not be opened. Try again later."
+	FORBIDDEN_ROLE        = "You do not have permission to perform this action."
+	INVALID_ROLE          = "Unrecognized role. Use a valid role."
+	INVALID_USER_ID       = "User ID does not match any active user."
+	LOCAL_USER_LOCKED     = "The local administrator cannot be demoted or deactivated."
+	INVALID_DELEGATION    = "A user cannot delegate approvals to themselves."
+	INVALID_DELEGATION_ID = "Delegation ID does not match any active delegation."
+	INVALID_ROLE_GRANT    = "Grant a role other than the user's own."
+	INVALID_GRANT_HOURS   = "Grant a role for between 1 and 336 hours."
+	MISSING_GRANT_REASON  = "Give the reason the role is granted."
+	ROLE_GRANT_ACTIVE     = "The user already holds a granted role. Revoke it first."
+	INVALID_ROLE_GRANT_ID = "Role grant ID does not match any active grant."
+
+	SQL_CONSOLE_DISABLED = "The SQL console is disabled. Set SQL_CONSOLE to enable it."
+	SQL_QUERY_NOT_SELECT = "Only SELECT queries, or WITH queries leading to one, can be run."
+	SQL_QUERY_NOT_SINGLE = "Only one statement can be run at a time."
+
+	INVALID_SDS_FILE = "Upload the safety data sheet as a PDF of at most 20 MB in the \"file\" field."
+	SDS_NOT_FOUND    = "The compound has no safety data sheet."
+
+	INVALID_VOUCHER_FILE = "Upload the voucher scan as a PDF, JPEG, PNG or WebP of at most 20 MB in the \"file\" field."
+	ATTACHMENT_NOT_FOUND = "The entry has no attachment with this ID."
+
+	INVALID_CAS_NO           = "Invalid CAS number. Use the form 64-17-5, whose last digit checks the others."
+	INVALID_MOLECULAR_WEIGHT = "The molecular weight must be a positive number of g/mol."
+	INVALID_SCALE_ERR        = "The scale must be one of the units listed by /units."
+	INVALID_MIN_STOCK        = "Minimum stock cannot be negative."
+	INVALID_MAX_INCOMING     = "The largest plausible delivery cannot be negative."
+
+	INVALID_PACKS_PER_UNIT    = "Packs per unit must be a positive number."
+	INVALID_PARTIAL_QUANTITY  = "A partial quantity cannot be negative and can only be issued on outgoing entries."
+	INVALID_UNIT_COST         = "The unit cost cannot be negative."
+	UNIT_COST_ON_NON_INCOMING = "A unit cost can only be set on incoming entries."
+	INVALID_VALUATION_METHOD  = "Unrecognized valuation method. Use average or fifo."
 
 	TX_START_ERR              = "Transaction could not be started."
 	COMMIT_TRANSACTION_ERR    = "Transaction could not be committed."
+	SCHEMA_VERSION_ERR        = "Failed to read the schema version of the database."
 	INVALID_TRANSACTIONS_TYPE = "Invalid transaction type specified."
+	INVALID_PAGINATION        = "Invalid pagination. Use a limit between 1 and 500, only with date ordered transactions."
+	INVALID_VOUCHER_MATCH     = "Unrecognized voucher match. Use exact or prefix."
+	INVALID_CURSOR            = "Invalid or expired cursor. Restart from the first page."
+	INVALID_SORT              = "Invalid sort. Sort by date, name, net_stock or quantity, in asc or desc order; workbooks are always sorted by date."
+	INVALID_RUNNING_BALANCE   = "A running balance needs the entries of a single compound, sorted by date."
+	INVALID_ENTRY_INCLUDE     = "Unrecognized include. Use deleted, pending or both."
 
 	COMPOUND_ID_CHECK_ERR  = "Compound ID could not be verified."
 	COMPOUND_RETRIEVAL_ERR = "Failed to retrieve compound data."
 	COMPOUND_UPDATE_ERR    = "Compound data could not be updated."
+	COMPOUND_DELETE_ERR    = "Compound could not be deleted."
+	COMPOUND_MERGE_ERR     = "Compounds could not be merged."
 	INSERT_COMPOUND_ERR    = "Failed to insert compound data."
 	COMPOUND_SCALE_ERR     = "Failed to update compound scale."
 
-	INSERT_QUANTITY_ERR   = "Failed to insert quantity data."
-	INSERT_ENTRY_ERR      = "Failed to insert entry data."
-	UPDATE_ENTRY_ERR      = "Failed to update entry data."
-	ENTRY_UPDATE_SCAN_ERR = "Error occurred while scanning updated entry data."
-	SUBSEQUENT_UPDATE_ERR = "Failed to update subsequent entries."
-	ENTRY_RETRIEVAL_ERR   = "Entry data could not be retrieved."
+	SUPPLIER_RETRIEVAL_ERR = "Failed to retrieve supplier data."
+	INSERT_SUPPLIER_ERR    = "Failed to insert supplier data."
+	SUPPLIER_UPDATE_ERR    = "Supplier data could not be updated."
+	SUPPLIER_DELETE_ERR    = "Supplier could not be deleted."
+
+	RECIPIENT_RETRIEVAL_ERR = "Failed to retrieve recipient data."
+	INSERT_RECIPIENT_ERR    = "Failed to insert recipient data."
+	RECIPIENT_UPDATE_ERR    = "Recipient data could not be updated."
+	RECIPIENT_DELETE_ERR    = "Recipient could not be deleted."
+
+	INSTRUMENT_RETRIEVAL_ERR = "Failed to retrieve instrument data."
+	INSERT_INSTRUMENT_ERR    = "Failed to insert instrument data."
+	INSTRUMENT_UPDATE_ERR    = "Instrument data could not be updated."
+	INSTRUMENT_DELETE_ERR    = "Instrument could not be deleted."
+
+	LOCATION_RETRIEVAL_ERR = "Failed to retrieve location data."
+	INSERT_LOCATION_ERR    = "Failed to insert location data."
+	LOCATION_UPDATE_ERR    = "Location data could not be updated."
+	LOCATION_DELETE_ERR    = "Location could not be deleted."
+
+	PROJECT_RETRIEVAL_ERR = "Failed to retrieve project data."
+	INSERT_PROJECT_ERR    = "Failed to insert project data."
+	PROJECT_UPDATE_ERR    = "Project data could not be updated."
+	PROJECT_DELETE_ERR    = "Project could not be deleted."
+
+	PURCHASE_ORDER_RETRIEVAL_ERR = "Failed to retrieve purchase order data."
+	INSERT_PURCHASE_ORDER_ERR    = "Failed to insert purchase order data."
+	PURCHASE_ORDER_UPDATE_ERR    = "Purchase order could not be updated."
+	INVOICE_RETRIEVAL_ERR        = "Failed to retrieve invoice data."
+	INSERT_INVOICE_ERR           = "Failed to insert invoice data."
+	DELETE_INVOICE_ERR           = "Invoice could not be deleted."
+	RESERVATION_RETRIEVAL_ERR    = "Failed to retrieve reservation data."
+	INSERT_RESERVATION_ERR       = "Failed to insert reservation data."
+	RESERVATION_UPDATE_ERR       = "Reservation could not be cancelled."
+
+	ATTACHMENT_SAVE_ERR      = "The file could not be saved."
+	ATTACHMENT_RETRIEVAL_ERR = "Failed to retrieve the attached file."
+	ATTACHMENT_DELETE_ERR    = "The attachment could not be deleted."
+
+	SQL_QUERY_ERR = "The query failed."
+
+	REPORT_RETRIEVAL_ERR    = "Failed to generate the report."
+	COMPOUND_NOT_CONTROLLED = "The compound is not a controlled substance. Mark it as controlled to report its chain of custody."
+	DASHBOARD_RETRIEVAL_ERR = "Failed to load the dashboard."
+
+	INVALID_IMPORT_FILE     = "The uploaded file could not be read. Upload a CSV or xlsx file with a header row."
+	INVALID_IMPORT_MAPPING  = "Column mapping is invalid or a required column (type, compound, date) is missing."
+	IMPORT_TOO_MANY_ROWS    = "The file has too many rows. Split it into files of at most 10000 rows."
+	IMPORT_VALIDATION_ERR   = "Some rows are invalid, nothing was imported. Fix the listed rows and try again."
+	INVALID_PASTE           = "The pasted text could not be read. Paste tab or comma separated rows, with a header line or the columns named."
+	PASTE_NO_VALID_ROWS     = "None of the pasted rows are valid, nothing was inserted. Fix the listed rows and try again."
+	PASTE_STOCK_ERR         = "The stock of the listed compounds cannot be recalculated with the pasted rows, nothing was inserted."
+	INVALID_IMPORT_ID       = "Import ID does not match any import."
+	IMPORT_ROLLED_BACK      = "The import is already rolled back."
+	IMPORT_ROLLBACK_CLOSED  = "The import is past its rollback window. Delete its entries one by one instead."
+	INVALID_CATALOG_COLUMNS = "The catalog needs a CAS RN and a Name column."
+	MISSING_CATALOG_CAS_NO  = "Catalog rows are keyed by CAS number. Add the CAS number of the compound."
+	CATALOG_NAME_CONFLICT   = "A compound of this name is already listed under another CAS number."
+	MISSING_CATALOG_UNIT    = "New compounds need a unit. Fill in the Unit column or send a default scale."
+
+	UNKNOWN_INBOUND_SOURCE     = "Unknown inbound source. Set INBOUND_SECRET_<SOURCE> to accept its events."
+	INVALID_INBOUND_SOURCE     = "Inbound source names are lowercase letters and digits, separated by dashes."
+	INVALID_INBOUND_SIGNATURE  = "The X-Signature-256 header does not match the body signed with the secret of the source."
+	INVALID_INBOUND_EVENT      = "Invalid inbound event. Send JSON with schema_version, event_id, event_type, date and items."
+	UNSUPPORTED_SCHEMA_VERSION = "Unsupported schema_version."
+	INVALID_INBOUND_EVENT_TYPE = "Unrecognized event_type. Use goods_received or stock_adjustment."
+	INBOUND_EVENT_REJECTED     = "The event was not recorded. Fix the listed items and send it again."
+	ITEM_NOT_MAPPED            = "The item code is not mapped to a compound. Map it with PUT /admin/item-mappings/{source} first."
+	INVALID_ITEM_MAPPING       = "Each mapping needs an item_code and a compound_id, and a quantity_per_unit that is not negative."
+	ITEM_MAPPING_NOT_FOUND     = "The item code is not mapped for this source."
+
+	INVALID_SHARED_VIEW_PATH = "This view cannot be shared. Share entries, stock, lots, the dashboard or a report."
+	SHARED_VIEW_NOT_JSON     = "Snapshots can only be kept of views, not of exports. Leave out the format or the snapshot."
+	INVALID_SHARE_TOKEN      = "The shared link is invalid."
+
+	DIGEST_DAY_NOT_OVER = "The digest of a day is made once the day is over. Pick an earlier date."
+
+	USER_RETRIEVAL_ERR        = "Failed to retrieve user data."
+	INSERT_USER_ERR           = "Failed to insert user data."
+	USER_UPDATE_ERR           = "User data could not be updated."
+	DELEGATION_RETRIEVAL_ERR  = "Failed to retrieve delegation data."
+	INSERT_DELEGATION_ERR     = "Failed to insert delegation data."
+	DELEGATION_UPDATE_ERR     = "Delegation could not be revoked."
+	ROLE_GRANT_RETRIEVAL_ERR  = "Failed to retrieve role grant data."
+	INSERT_ROLE_GRANT_ERR     = "Failed to insert role grant data."
+	ROLE_GRANT_UPDATE_ERR     = "Role grant could not be revoked."
+	USER_TOKEN_RETRIEVAL_ERR  = "Failed to retrieve user token data."
+	INSERT_USER_TOKEN_ERR     = "Failed to issue the user token."
+	USER_TOKEN_UPDATE_ERR     = "User token could not be revoked."
+	REDACTION_ERR             = "Failed to prepare the response for your role."
+	STOCK_TAKE_RETRIEVAL_ERR  = "Failed to retrieve stock-take data."
+	INSERT_STOCK_TAKE_ERR     = "Failed to insert stock-take data."
+	STOCK_TAKE_UPDATE_ERR     = "Stock-take could not be updated."
+	AUDIT_RETRIEVAL_ERR       = "Failed to retrieve the audit log."
+	INSERT_SHARED_VIEW_ERR    = "Failed to create the shared link."
+	SHARED_VIEW_RETRIEVAL_ERR = "Failed to open the shared link."
+	USAGE_RETRIEVAL_ERR       = "Failed to retrieve usage metrics."
+	DIGEST_RETRIEVAL_ERR      = "Failed to retrieve the daily digest."
+
+	INSERT_QUANTITY_ERR         = "Failed to insert quantity data."
+	INSERT_ENTRY_ERR            = "Failed to insert entry data."
+	VOUCHER_RENUMBER_ERR        = "Failed to renumber vouchers."
+	DUPLICATE_CHECK_ERR         = "Failed to check for duplicate entries."
+	LARGE_INCOMING_CHECK_ERR    = "Failed to check the quantity against the usual deliveries."
+	VALUATION_ERR               = "Failed to value the stock."
+	LEDGER_VALIDATION_ERR       = "Failed to validate the ledger."
+	ENTRY_REVIEW_ERR            = "Failed to record the review of the entry."
+	ENTRY_VERSION_ERR           = "Failed to keep the previous version of the entry."
+	ENTRY_HISTORY_RETRIEVAL_ERR = "Failed to retrieve the history of the entry."
+	ENTRY_LOCK_RETRIEVAL_ERR    = "Failed to check whether entries are locked."
+	ENTRY_UNLOCK_ERR            = "Entries could not be unlocked."
+	ENTRY_DELETE_ERR            = "Entry could not be deleted."
+	ENTRY_RESTORE_ERR           = "Entry could not be restored."
+	UPDATE_ENTRY_ERR            = "Failed to update entry data."
+	ENTRY_UPDATE_SCAN_ERR       = "Error occurred while scanning updated entry data."
+	SUBSEQUENT_UPDATE_ERR       = "Failed to update subsequent entries."
+	STOCK_CURRENT_UPDATE_ERR    = "Failed to update the current stock."
+	UNIT_RETRIEVAL_ERR          = "Failed to retrieve the quantity unit."
+	STOCK_REBUILD_ERR           = "Failed to rebuild the current stock."
+	STOCK_RECALCULATION_ERR     = "The stock of some compounds could not be recalculated. Check the errors of the operation."
+	OPERATION_FAILED            = "The operation failed. Check the response of the request that started it."
+	IMPORT_BATCH_ERR            = "Failed to record the import."
+	IMPORT_ROLLBACK_ERR         = "Failed to roll back the import."
+	INBOUND_EVENT_ERR           = "Failed to record the inbound event."
+	ITEM_MAPPING_RETRIEVAL_ERR  = "Failed to retrieve item mappings."
+	ITEM_MAPPING_UPDATE_ERR     = "Item mappings could not be saved."
+	ENTRY_RETRIEVAL_ERR         = "Entry data could not be retrieved."
+
+	STOCK_RETRIEVAL_ERR             = "Failed to retrieve stock data."
+	INSUFFICIENT_STOCK_ERR          = "Insufficient stock for the requested transaction."
+	INSUFFICIENT_LOCATION_STOCK_ERR = "Insufficient stock at the location for the requested transaction."
+	SAME_DAY_STOCK_SHORTFALL_ERR    = "The stock would run short within the day. Set confirm_shortfall if the rest of the day's entries make up for it."
+
+	INVALID_LOT_ID             = "Lot ID does not match any lot available for this compound on the entry date."
+	INVALID_LOT_FIELDS         = "Lot details are only allowed on incoming entries and a lot ID only on outgoing entries, neither on transfers."
+	INSUFFICIENT_LOT_STOCK_ERR = "Insufficient stock in the selected lot for the requested transaction."
+	LOT_ALLOCATION_ERR         = "Failed to allocate stock to lots."
+	LOT_RETRIEVAL_ERR          = "Failed to retrieve lot data."
+	LABEL_LOT_NOT_FOUND        = "Lot ID does not match any lot of this compound."
+	INVALID_LABEL_LAYOUT       = "Invalid label layout. Check the rows, columns and labels to skip."
+	TOO_MANY_LABELS            = "Too many labels. Print at most 1000 labels at once."
 
-	STOCK_RETRIEVAL_ERR    = "Failed to retrieve stock data."
-	INSUFFICIENT_STOCK_ERR = "Insufficient stock for the requested transaction."
+	INVALID_REPLICATION_TOKEN     = "Replication token is missing or does not match the standby's."
+	INVALID_REPLICATION_SNAPSHOT  = "Snapshot must come with its SHA-256 checksum and sequence number."
+	REPLICATION_CHECKSUM_MISMATCH = "Snapshot does not match its checksum. It was probably cut short on the way; it is sent again at the next interval."
+	REPLICATION_SNAPSHOT_CORRUPT  = "Snapshot failed the integrity check and was not kept."
+	REPLICATION_SNAPSHOT_STALE    = "Snapshot is not newer than the replica the standby has."
+	REPLICATION_RECEIVE_ERR       = "Failed to store the snapshot."
+	REPLICATION_STATUS_ERR        = "Failed to read the replica's manifest."
 
 	NO_ERR = ""
 )
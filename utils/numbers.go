@@ -0,0 +1,186 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Locale used to read numbers typed or pasted by users, set with the NUMBER_LOCALE environment variable
+const DEFAULT_NUMBER_LOCALE = "en"
+
+// How a locale writes numbers. Indian grouping puts the last three digits in a group and the rest in pairs,
+// e.g. 1,00,000.
+type NumberFormat struct {
+	Decimal        rune
+	Group          rune
+	IndianGrouping bool
+}
+
+var NumberLocales = map[string]NumberFormat{
+	"en":    {Decimal: '.', Group: ','},
+	"en-IN": {Decimal: '.', Group: ',', IndianGrouping: true},
+	"de":    {Decimal: ',', Group: '.'},
+	"fr":    {Decimal: ',', Group: ' '},
+	"de-CH": {Decimal: '.', Group: '\''},
+}
+
+// Lets error messages be returned from JSON unmarshalers and recognised by httpx.DecodeJsonReq
+func (e ErrorMessage) Error() string {
+	return string(e)
+}
+
+// Gets the configured number locale, falling back to the default one when it is not set or unknown
+func GetNumberLocale() string {
+	locale := os.Getenv("NUMBER_LOCALE")
+	if _, ok := NumberLocales[locale]; !ok {
+		return DEFAULT_NUMBER_LOCALE
+	}
+	return locale
+}
+
+// Whole number that can also be sent as a string written in the configured locale, e.g. "1.000" for
+// a thousand with NUMBER_LOCALE=de
+type LocalizedInt int
+
+func (n *LocalizedInt) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		// Plain JSON numbers are locale independent
+		var f float64
+		if err := json.Unmarshal(data, &f); err != nil || f != math.Trunc(f) {
+			return ErrorMessage(INVALID_NUMBER)
+		}
+		*n = LocalizedInt(f)
+		return nil
+	}
+
+	value, errStr := ParseLocalizedInt(text)
+	if errStr != NO_ERR {
+		return errStr
+	}
+	*n = LocalizedInt(value)
+	return nil
+}
+
+// Parses a whole number written in the configured locale. Values that only make sense in a locale with
+// the other decimal mark, or that read as a different whole number there (e.g. "1.000" is 1 in English
+// and 1000 in German), are rejected with an error naming the value instead of being guessed.
+func ParseLocalizedInt(text string) (int, ErrorMessage) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return 0, NO_ERR
+	}
+
+	locale := GetNumberLocale()
+	format := NumberLocales[locale]
+
+	value, ok := parseNumber(text, format)
+	if !ok {
+		for _, name := range slices.Sorted(maps.Keys(NumberLocales)) {
+			other := NumberLocales[name]
+			if other.Decimal == format.Decimal {
+				continue
+			}
+			if _, ok := parseNumber(text, other); ok {
+				return 0, ErrorMessage(fmt.Sprintf("%s (%q is written for %s, numbers are read as %s)", NUMBER_LOCALE_MISMATCH, text, name, locale))
+			}
+		}
+		return 0, INVALID_NUMBER
+	}
+	if value != math.Trunc(value) {
+		return 0, INVALID_NUMBER
+	}
+
+	for _, other := range NumberLocales {
+		if other.Decimal == format.Decimal {
+			continue
+		}
+		if otherValue, ok := parseNumber(text, other); ok && otherValue == math.Trunc(otherValue) && otherValue != value {
+			return 0, ErrorMessage(fmt.Sprintf("%s (%q could be %s or %s)", AMBIGUOUS_NUMBER, text, formatPlain(value), formatPlain(otherValue)))
+		}
+	}
+
+	return int(value), NO_ERR
+}
+
+// Reads a number in the given format, checking that group separators are where the format puts them
+func parseNumber(text string, format NumberFormat) (float64, bool) {
+	// Spaces are only ever group separators, including the narrow no-break space French uses
+	text = strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\u00a0' || r == '\u202f' {
+			if format.Group == ' ' {
+				return -1
+			}
+			return '#'
+		}
+		return r
+	}, text)
+
+	sign := ""
+	if strings.HasPrefix(text, "-") || strings.HasPrefix(text, "+") {
+		sign, text = text[:1], text[1:]
+	}
+
+	integer, fraction, hasFraction := strings.Cut(text, string(format.Decimal))
+	if hasFraction && (fraction == "" || !isDigits(fraction)) {
+		return 0, false
+	}
+
+	groups := strings.Split(integer, string(format.Group))
+	if len(groups) > 1 {
+		for i, group := range groups {
+			size := len(group)
+			switch {
+			case !isDigits(group):
+				return 0, false
+			case i == 0:
+				if size == 0 || size > 3 || (format.IndianGrouping && size > 2 && len(groups) > 2) {
+					return 0, false
+				}
+			case i == len(groups)-1 || !format.IndianGrouping:
+				if size != 3 {
+					return 0, false
+				}
+			default:
+				if size != 2 {
+					return 0, false
+				}
+			}
+		}
+	} else if !isDigits(integer) {
+		return 0, false
+	}
+
+	normalized := sign + strings.Join(groups, "")
+	if hasFraction {
+		normalized += "." + fraction
+	}
+	value, err := strconv.ParseFloat(normalized, 64)
+	return value, err == nil
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func formatPlain(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+// Panics recovered from handlers since the application started, shown in /admin/diagnostics
+type PanicStats struct {
+	Total int `json:"total"`
+	// Counts by route, e.g. "GET /report/summary"
+	ByRoute       map[string]int `json:"by_route"`
+	LastRoute     string         `json:"last_route,omitempty"`
+	LastRequestId string         `json:"last_request_id,omitempty"`
+	LastAt        string         `json:"last_at,omitempty"`
+}
+
+var (
+	panicsMu sync.Mutex
+	panics   = PanicStats{ByRoute: map[string]int{}}
+)
+
+// Counts a panic recovered from the handler of the given route
+func RecordPanic(route string, requestId string) {
+	panicsMu.Lock()
+	defer panicsMu.Unlock()
+
+	panics.Total++
+	panics.ByRoute[route]++
+	panics.LastRoute = route
+	panics.LastRequestId = requestId
+	panics.LastAt = time.Now().Format(time.RFC3339)
+}
+
+func GetPanicStats() PanicStats {
+	panicsMu.Lock()
+	defer panicsMu.Unlock()
+
+	stats := panics
+	stats.ByRoute = make(map[string]int, len(panics.ByRoute))
+	for route, count := range panics.ByRoute {
+		stats.ByRoute[route] = count
+	}
+	return stats
+}
@@ -0,0 +1,152 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// A4 page size and margin in PDF points
+const (
+	PDF_PAGE_WIDTH  = 595.0
+	PDF_PAGE_HEIGHT = 842.0
+	PDF_MARGIN      = 40.0
+)
+
+// Width of a Courier glyph relative to the font size. Every glyph has the same width, which keeps column
+// alignment simple without embedding font metrics.
+const pdfCharWidth = 0.6
+
+// Minimal PDF writer for printable reports. Text is set in the built-in Courier fonts, so nothing has to be
+// embedded, and characters outside Latin-1 are replaced with "?".
+type PDF struct {
+	pages []*bytes.Buffer
+
+	// Leaves out the page numbers, for sheets printed onto stationery such as labels
+	NoPageNumbers bool
+}
+
+func NewPDF() *PDF {
+	pdf := &PDF{}
+	pdf.AddPage()
+	return pdf
+}
+
+func (p *PDF) AddPage() {
+	p.pages = append(p.pages, &bytes.Buffer{})
+}
+
+func (p *PDF) PageCount() int {
+	return len(p.pages)
+}
+
+// Writes text with its left edge at x. y is measured from the top of the page.
+func (p *PDF) Text(x, y, size float64, bold bool, text string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(p.current(), "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, PDF_PAGE_HEIGHT-y, pdfEscape(text))
+}
+
+// Writes text with its right edge at x
+func (p *PDF) TextRight(x, y, size float64, bold bool, text string) {
+	p.Text(x-PDFTextWidth(text, size), y, size, bold, text)
+}
+
+// Draws a horizontal rule from x1 to x2. y is measured from the top of the page.
+func (p *PDF) Line(x1, x2, y float64) {
+	fmt.Fprintf(p.current(), "0.5 w %.2f %.2f m %.2f %.2f l S\n", x1, PDF_PAGE_HEIGHT-y, x2, PDF_PAGE_HEIGHT-y)
+}
+
+func PDFTextWidth(text string, size float64) float64 {
+	return float64(len([]rune(text))) * size * pdfCharWidth
+}
+
+// Cuts the text down to at most maxChars characters, marking the cut with "~"
+func PDFTruncate(text string, maxChars int) string {
+	runes := []rune(text)
+	if len(runes) <= maxChars {
+		return text
+	}
+	return string(runes[:maxChars-1]) + "~"
+}
+
+// Lays out the document, numbering the pages in the footer unless NoPageNumbers is set
+func (p *PDF) Bytes() []byte {
+	out := &bytes.Buffer{}
+	offsets := []int{}
+	startObj := func() int {
+		offsets = append(offsets, out.Len())
+		return len(offsets)
+	}
+
+	out.WriteString("%PDF-1.4\n")
+
+	pageCount := len(p.pages)
+	pageIds := make([]string, pageCount)
+	for i := range p.pages {
+		// Objects 1-4 are the catalog, the page tree and the two fonts, then a page and its content per page
+		pageIds[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+
+	startObj()
+	out.WriteString("1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n")
+	startObj()
+	fmt.Fprintf(out, "2 0 obj\n<< /Type /Pages /Kids [%s] /Count %d >>\nendobj\n", strings.Join(pageIds, " "), pageCount)
+	startObj()
+	out.WriteString("3 0 obj\n<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>\nendobj\n")
+	startObj()
+	out.WriteString("4 0 obj\n<< /Type /Font /Subtype /Type1 /BaseFont /Courier-Bold /Encoding /WinAnsiEncoding >>\nendobj\n")
+
+	for i, page := range p.pages {
+		content := page.String()
+		if !p.NoPageNumbers {
+			footer := fmt.Sprintf("Page %d of %d", i+1, pageCount)
+			content += fmt.Sprintf(
+				"BT /F1 8.0 Tf %.2f %.2f Td (%s) Tj ET\n",
+				PDF_PAGE_WIDTH-PDF_MARGIN-PDFTextWidth(footer, 8), PDF_MARGIN/2, footer,
+			)
+		}
+
+		pageObj := startObj()
+		fmt.Fprintf(out,
+			"%d 0 obj\n<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>\nendobj\n",
+			pageObj, PDF_PAGE_WIDTH, PDF_PAGE_HEIGHT, pageObj+1,
+		)
+		contentObj := startObj()
+		fmt.Fprintf(out, "%d 0 obj\n<< /Length %d >>\nstream\n%sendstream\nendobj\n", contentObj, len(content), content)
+	}
+
+	xrefOffset := out.Len()
+	fmt.Fprintf(out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xrefOffset)
+
+	return out.Bytes()
+}
+
+func (p *PDF) current() *bytes.Buffer {
+	return p.pages[len(p.pages)-1]
+}
+
+// Converts the text to Latin-1 and escapes the characters PDF string literals treat specially
+func pdfEscape(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			b.WriteByte('\\')
+			b.WriteByte(byte(r))
+		case r < 32:
+			b.WriteByte(' ')
+		case r < 256:
+			b.WriteByte(byte(r))
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,7 @@
+package utils
+
+// Whether admins may capture CPU and heap profiles under /debug/pprof, e.g. when recalculating the stock gets slow at
+// a school. Off unless PPROF is set, as profiles show the command line and internals of the running backend.
+func PprofEnabled() bool {
+	return GetEnvBool("PPROF", false)
+}
@@ -0,0 +1,177 @@
+package utils
+
+import (
+	"chemical-ledger-backend/datetime"
+	"chemical-ledger-backend/db"
+	"context"
+	"sync"
+	"time"
+)
+
+// Long-running admin operations, e.g. imports and stock recalculations, report their progress to an Operation so
+// the admin UI can follow it as it runs instead of waiting on the request, see GetOperationEventsHandler. The
+// client picks the ID of the operation and sends it along with the request starting it ("progress_id"), so it can
+// subscribe before the operation starts. Operations are kept in memory only, for OPERATION_RETENTION after
+// they finish.
+
+// State of an operation, sent to its subscribers whenever it changes
+type ProgressEvent struct {
+	OperationId string `json:"operation_id"`
+	// Counts the changes of the state, for long polling clients to tell whether they saw it already
+	Seq       int          `json:"seq"`
+	Kind      string       `json:"kind,omitempty"`
+	Percent   int          `json:"percent"`
+	Current   string       `json:"current,omitempty"`
+	Errors    int          `json:"errors"`
+	LastError ErrorMessage `json:"last_error,omitempty"`
+	Done      bool         `json:"done"`
+	Result    ErrorMessage `json:"result,omitempty"`
+}
+
+// Kinds of operations reporting progress
+const (
+	OPERATION_IMPORT          = "import"
+	OPERATION_PASTE           = "paste"
+	OPERATION_RECALCULATE_ALL = "recalculate"
+)
+
+// How long a finished operation can still be subscribed to
+const OPERATION_RETENTION = 10 * time.Minute
+
+type Operation struct {
+	mu          sync.Mutex
+	event       ProgressEvent
+	subscribers map[chan ProgressEvent]bool
+	// Clock of the request the operation was first tracked by, timing how long it is kept once finished
+	clock      datetime.Clock
+	finishedAt time.Time
+}
+
+var operations = struct {
+	sync.Mutex
+	byId map[string]*Operation
+}{byId: map[string]*Operation{}}
+
+// Gets the operation with the given ID, starting to track it when it is new. Returns nil for an empty ID, and
+// reporting to a nil operation does nothing, so requests without a "progress_id" run untracked.
+func TrackOperation(ctx context.Context, id string, kind string) *Operation {
+	if id == "" {
+		return nil
+	}
+
+	operations.Lock()
+	defer operations.Unlock()
+
+	// Finished operations are dropped here rather than on a timer
+	for opId, op := range operations.byId {
+		op.mu.Lock()
+		expired := !op.finishedAt.IsZero() && datetime.Now(ctx).Sub(op.finishedAt) > OPERATION_RETENTION
+		op.mu.Unlock()
+		if expired {
+			delete(operations.byId, opId)
+		}
+	}
+
+	// Kept apart per tenant, so a tenant cannot follow the operations of another by their ID
+	key := db.TenantFrom(ctx) + "/" + id
+	op, ok := operations.byId[key]
+	if !ok {
+		op = &Operation{event: ProgressEvent{OperationId: id}, subscribers: map[chan ProgressEvent]bool{}, clock: datetime.ClockFrom(ctx)}
+		operations.byId[key] = op
+	}
+	if kind != "" {
+		op.mu.Lock()
+		op.event.Kind = kind
+		op.mu.Unlock()
+	}
+	return op
+}
+
+// Reports that done of total steps are over, the current one being about the given compound or row
+func (op *Operation) Step(done int, total int, current string) {
+	if op == nil {
+		return
+	}
+	op.update(func(event *ProgressEvent) {
+		if total > 0 {
+			event.Percent = min(done*100/total, 100)
+		}
+		event.Current = current
+	})
+}
+
+// Reports an error of the operation that does not stop it, e.g. a compound that could not be recalculated
+func (op *Operation) Fail(current string, errStr ErrorMessage) {
+	if op == nil {
+		return
+	}
+	op.update(func(event *ProgressEvent) {
+		event.Current = current
+		event.Errors++
+		event.LastError = errStr
+	})
+}
+
+// Reports the end of the operation, with NO_ERR when it succeeded. Subscribers are sent the final state and let go.
+func (op *Operation) Finish(result ErrorMessage) {
+	if op == nil {
+		return
+	}
+	op.update(func(event *ProgressEvent) {
+		if result == NO_ERR {
+			event.Percent = 100
+		}
+		event.Current = ""
+		event.Done = true
+		event.Result = result
+	})
+
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	op.finishedAt = op.clock.Now()
+	for subscriber := range op.subscribers {
+		close(subscriber)
+		delete(op.subscribers, subscriber)
+	}
+}
+
+// Follows the operation: the returned channel gets its current state straight away, then every change until it
+// finishes, when the channel is closed. Call the returned function to stop following it earlier. Subscribers that
+// fall behind miss intermediate states, never the final one.
+func (op *Operation) Subscribe() (<-chan ProgressEvent, func()) {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+
+	events := make(chan ProgressEvent, 1)
+	events <- op.event
+	if op.event.Done {
+		close(events)
+		return events, func() {}
+	}
+
+	op.subscribers[events] = true
+	return events, func() {
+		op.mu.Lock()
+		defer op.mu.Unlock()
+		if op.subscribers[events] {
+			delete(op.subscribers, events)
+			close(events)
+		}
+	}
+}
+
+func (op *Operation) update(change func(event *ProgressEvent)) {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+
+	change(&op.event)
+	op.event.Seq++
+	for subscriber := range op.subscribers {
+		// Replace a state the subscriber has not read yet with the newer one
+		select {
+		case <-subscriber:
+		default:
+		}
+		subscriber <- op.event
+	}
+}
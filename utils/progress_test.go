@@ -0,0 +1,39 @@
+package utils_test
+
+import (
+	"chemical-ledger-backend/utils"
+	"context"
+	"testing"
+)
+
+func TestOperationSubscribersAlwaysGetTheFinalState(t *testing.T) {
+	ctx := context.Background()
+
+	// Subscribed before the operation starts, and reading nothing until it is over
+	early, stop := utils.TrackOperation(ctx, "OP_test", "").Subscribe()
+	defer stop()
+
+	op := utils.TrackOperation(ctx, "OP_test", utils.OPERATION_RECALCULATE_ALL)
+	for i := range 100 {
+		op.Step(i, 100, "C_1")
+	}
+	op.Fail("C_2", utils.INSUFFICIENT_STOCK_ERR)
+	op.Finish(utils.STOCK_RECALCULATION_ERR)
+
+	var last utils.ProgressEvent
+	for event := range early {
+		last = event
+	}
+	if !last.Done || last.Errors != 1 || last.Result != utils.STOCK_RECALCULATION_ERR || last.Kind != utils.OPERATION_RECALCULATE_ALL {
+		t.Errorf("last state seen by early subscriber: %+v", last)
+	}
+
+	// Subscribed after it finished
+	late, _ := utils.TrackOperation(ctx, "OP_test", "").Subscribe()
+	if event, ok := <-late; !ok || !event.Done || event.LastError != utils.INSUFFICIENT_STOCK_ERR {
+		t.Errorf("state seen by late subscriber: %+v", event)
+	}
+	if _, ok := <-late; ok {
+		t.Error("late subscriber is still subscribed")
+	}
+}
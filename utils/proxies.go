@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"net"
+	"os"
+	"strings"
+)
+
+// Reverse proxies in front of the instance, from the comma-separated TRUSTED_PROXIES of addresses and CIDR ranges,
+// e.g. "127.0.0.1,10.0.0.0/8". Only requests they forward may name their tenant in X-Tenant-Id, and none of them
+// counts as made on this machine, even from a proxy running on it. Entries that are neither are returned apart, for
+// ConfigProblems.
+func TrustedProxies() (proxies []*net.IPNet, invalid []string) {
+	for _, entry := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil {
+				bits := 8 * len(ip.To16())
+				if ip.To4() != nil {
+					ip, bits = ip.To4(), 32
+				}
+				proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+				continue
+			}
+		}
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			proxies = append(proxies, network)
+			continue
+		}
+		invalid = append(invalid, entry)
+	}
+	return proxies, invalid
+}
+
+// Whether the given remote address, as in http.Request.RemoteAddr, is one of the TrustedProxies
+func IsTrustedProxy(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	proxies, _ := TrustedProxies()
+	for _, proxy := range proxies {
+		if proxy.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
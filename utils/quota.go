@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/retry"
+	"context"
+)
+
+const (
+	QUOTA_ENTRIES   = "entries"
+	QUOTA_COMPOUNDS = "compounds"
+	QUOTA_USERS     = "users"
+
+	// Share of a limit after which clients are warned that it is about to be reached
+	QUOTA_WARNING_RATIO = 0.9
+)
+
+// Usage of a limited resource. A limit of 0 means the resource is unlimited, in which case remaining is null.
+type Quota struct {
+	Used      int  `json:"used"`
+	Limit     int  `json:"limit"`
+	Remaining *int `json:"remaining"`
+	NearLimit bool `json:"near_limit"`
+	Exceeded  bool `json:"exceeded"`
+}
+
+var quotaSources = map[string]struct {
+	limitEnv   string
+	countQuery string
+}{
+	QUOTA_ENTRIES:   {"TRIAL_ENTRY_LIMIT", "SELECT COUNT(*) FROM entry"},
+	QUOTA_COMPOUNDS: {"TRIAL_COMPOUND_LIMIT", "SELECT COUNT(*) FROM compound"},
+	QUOTA_USERS:     {"TRIAL_USER_LIMIT", "SELECT COUNT(*) FROM user WHERE active = 1"},
+}
+
+// Gets the usage of the given resource against its trial/license limit
+func GetQuota(ctx context.Context, resource string) (Quota, error) {
+	source := quotaSources[resource]
+	quota := Quota{Limit: max(GetEnvInt(source.limitEnv, 0), 0)}
+
+	err := retry.Once(func() error {
+		return db.ConnFrom(ctx).QueryRowContext(ctx, source.countQuery).Scan(&quota.Used)
+	})
+	if err != nil {
+		return Quota{}, err
+	}
+
+	if quota.Limit > 0 {
+		remaining := max(quota.Limit-quota.Used, 0)
+		quota.Remaining = &remaining
+		quota.NearLimit = float64(quota.Used) >= QUOTA_WARNING_RATIO*float64(quota.Limit)
+		quota.Exceeded = quota.Used >= quota.Limit
+	}
+
+	return quota, nil
+}
+
+// Gets the usage of every limited resource, keyed by resource name
+func GetQuotas(ctx context.Context) (map[string]Quota, error) {
+	quotas := map[string]Quota{}
+	for resource := range quotaSources {
+		quota, err := GetQuota(ctx, resource)
+		if err != nil {
+			return nil, err
+		}
+		quotas[resource] = quota
+	}
+	return quotas, nil
+}
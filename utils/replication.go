@@ -0,0 +1,364 @@
+package utils
+
+import (
+	"chemical-ledger-backend/db"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Roles of an instance in warm standby replication, set with REPLICATION_MODE. The primary is the ledger the lab
+// works on and ships snapshots of its database; a standby only receives them, ready to take over.
+const (
+	REPLICATION_MODE_PRIMARY = "primary"
+	REPLICATION_MODE_STANDBY = "standby"
+
+	REPLICATION_SNAPSHOT_PATH = "/replication/snapshot"
+	REPLICATION_STATUS_PATH   = "/replication/status"
+
+	REPLICATION_TOKEN_HEADER    = "X-Replication-Token"
+	REPLICATION_SHA256_HEADER   = "X-Replication-Sha256"
+	REPLICATION_SEQUENCE_HEADER = "X-Replication-Sequence"
+	REPLICATION_TAKEN_AT_HEADER = "X-Replication-Taken-At"
+
+	REPLICA_FILE          = "replica.db"
+	REPLICA_MANIFEST_FILE = "replica.json"
+	// Snapshot of the primary on its way to the standby, removed once shipped
+	REPLICATION_OUTGOING_FILE = "outgoing.db"
+)
+
+var (
+	ErrReplicaChecksum = errors.New("snapshot does not match its checksum")
+	ErrReplicaCorrupt  = errors.New("snapshot failed the integrity check")
+	ErrReplicaStale    = errors.New("snapshot is not newer than the replica")
+	ErrNoReplica       = errors.New("no replica has been received")
+)
+
+// What the standby knows about the replica it keeps: which snapshot of the primary it is and its checksum, checked
+// again when it is promoted
+type ReplicaManifest struct {
+	// Orders the snapshots, so one delivered late never replaces a newer one
+	Sequence   int64  `json:"sequence"`
+	TakenAt    string `json:"taken_at"`
+	ReceivedAt string `json:"received_at"`
+	Size       int64  `json:"size"`
+	Sha256     string `json:"sha256"`
+}
+
+// Snapshots are whole databases, so they get longer than other requests to go through
+var replicationClient = &http.Client{Timeout: 10 * time.Minute}
+
+// Received snapshots are checked and replace the replica one at a time
+var replicaMu sync.Mutex
+
+func ReplicationMode() string {
+	return os.Getenv("REPLICATION_MODE")
+}
+
+// Folder the snapshots are written to, the replica and its manifest on a standby
+func ReplicationDir() string {
+	if dir := os.Getenv("REPLICATION_DIR"); dir != "" {
+		return dir
+	}
+	return "./info/replication"
+}
+
+// Shared secret the primary sends along with each snapshot and the standby checks
+func ReplicationToken() string {
+	return os.Getenv("REPLICATION_TOKEN")
+}
+
+// Schedules shipping a snapshot to the standby at REPLICATION_TARGET every REPLICATION_INTERVAL_MINUTES (default 5)
+// and ships one right away. Does nothing unless this instance is the primary.
+func StartReplication(ctx context.Context) {
+	if ReplicationMode() != REPLICATION_MODE_PRIMARY {
+		return
+	}
+
+	interval := GetEnvInt("REPLICATION_INTERVAL_MINUTES", 5)
+	if interval <= 0 {
+		interval = 5
+	}
+	target, token := os.Getenv("REPLICATION_TARGET"), ReplicationToken()
+	job := func() error { return ShipSnapshot(ctx, target, token) }
+
+	subsystem := ScheduleJob("replication", time.Duration(interval)*time.Minute, job)
+	go subsystem.Run(job)
+}
+
+// Takes a consistent snapshot of the database with VACUUM INTO, which does not hold up the entries being recorded,
+// and posts it to the standby at the given URL with its checksum
+func ShipSnapshot(ctx context.Context, target, token string) error {
+	dir := ReplicationDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	path := filepath.Join(dir, REPLICATION_OUTGOING_FILE)
+	// VACUUM INTO refuses to overwrite a snapshot left by a run that failed halfway
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	defer os.Remove(path)
+
+	takenAt := time.Now()
+	if _, err := db.ConnFrom(ctx).ExecContext(ctx, "VACUUM INTO ?", path); err != nil {
+		return fmt.Errorf("failed to snapshot database: %w", err)
+	}
+	sum, size, err := fileSha256(path)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	endpoint, err := url.Parse(strings.TrimRight(target, "/"))
+	if err != nil {
+		return fmt.Errorf("invalid REPLICATION_TARGET: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.JoinPath(REPLICATION_SNAPSHOT_PATH).String(), file)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/vnd.sqlite3")
+	req.Header.Set(REPLICATION_TOKEN_HEADER, token)
+	req.Header.Set(REPLICATION_SHA256_HEADER, sum)
+	req.Header.Set(REPLICATION_SEQUENCE_HEADER, strconv.FormatInt(takenAt.UnixNano(), 10))
+	req.Header.Set(REPLICATION_TAKEN_AT_HEADER, takenAt.Format(time.RFC3339))
+
+	resp, err := replicationClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("standby refused the snapshot with status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	slog.InfoContext(ctx, "snapshot shipped to standby", "target", target, "size", size, "sha256", sum)
+	return nil
+}
+
+// Receives a snapshot on the standby. It is written next to the replica, and only replaces it once its checksum
+// matches the one the primary sent, SQLite finds nothing wrong with it and it is newer than the replica.
+func ReceiveSnapshot(ctx context.Context, body io.Reader, sha256Sum string, sequence int64, takenAt string) (*ReplicaManifest, error) {
+	replicaMu.Lock()
+	defer replicaMu.Unlock()
+
+	dir := ReplicationDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	current, err := GetReplicaManifest()
+	if err != nil && !errors.Is(err, ErrNoReplica) {
+		return nil, err
+	}
+	if current != nil && sequence <= current.Sequence {
+		return nil, ErrReplicaStale
+	}
+
+	tmp, err := os.CreateTemp(dir, "incoming-*.db")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	if hex.EncodeToString(hash.Sum(nil)) != strings.ToLower(sha256Sum) {
+		return nil, ErrReplicaChecksum
+	}
+	if err := CheckDatabaseIntegrity(tmp.Name()); err != nil {
+		slog.ErrorContext(ctx, "received snapshot is damaged", "error", err)
+		return nil, ErrReplicaCorrupt
+	}
+
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, REPLICA_FILE)); err != nil {
+		return nil, err
+	}
+	manifest := &ReplicaManifest{
+		Sequence:   sequence,
+		TakenAt:    takenAt,
+		ReceivedAt: time.Now().Format(time.RFC3339),
+		Size:       size,
+		Sha256:     strings.ToLower(sha256Sum),
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(filepath.Join(dir, REPLICA_MANIFEST_FILE), data); err != nil {
+		return nil, err
+	}
+
+	slog.InfoContext(ctx, "snapshot received from primary", "sequence", sequence, "taken_at", takenAt, "size", size)
+	return manifest, nil
+}
+
+// Gets the manifest of the replica kept on this standby, ErrNoReplica before the first snapshot arrived
+func GetReplicaManifest() (*ReplicaManifest, error) {
+	data, err := os.ReadFile(filepath.Join(ReplicationDir(), REPLICA_MANIFEST_FILE))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNoReplica
+	}
+	if err != nil {
+		return nil, err
+	}
+	manifest := &ReplicaManifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("invalid replica manifest: %w", err)
+	}
+	return manifest, nil
+}
+
+// Makes the replica the database at the given path, for a standby taking over from a lost primary. The replica is
+// checked against its manifest and by SQLite first. A database already at the path is kept beside it, renamed with
+// the time of the promotion. Returns the manifest of the promoted replica and where the old database went, if any.
+func PromoteReplica(dbPath string) (manifest *ReplicaManifest, keptAs string, err error) {
+	replicaMu.Lock()
+	defer replicaMu.Unlock()
+
+	manifest, err = GetReplicaManifest()
+	if err != nil {
+		return nil, "", err
+	}
+	replica := filepath.Join(ReplicationDir(), REPLICA_FILE)
+	sum, _, err := fileSha256(replica)
+	if err != nil {
+		return nil, "", err
+	}
+	if sum != manifest.Sha256 {
+		return nil, "", ErrReplicaChecksum
+	}
+	if err := CheckDatabaseIntegrity(replica); err != nil {
+		slog.Error("replica is damaged", "error", err)
+		return nil, "", ErrReplicaCorrupt
+	}
+
+	// Copied rather than moved, so the replica is still there should the promotion have to be done again
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+		return nil, "", err
+	}
+	tmp := dbPath + ".promote"
+	if err := copyFile(replica, tmp); err != nil {
+		os.Remove(tmp)
+		return nil, "", err
+	}
+	if _, err := os.Stat(dbPath); err == nil {
+		keptAs = dbPath + ".before-promote-" + time.Now().Format("20060102-150405")
+		if err := os.Rename(dbPath, keptAs); err != nil {
+			os.Remove(tmp)
+			return nil, "", err
+		}
+	}
+	if err := os.Rename(tmp, dbPath); err != nil {
+		return nil, keptAs, err
+	}
+
+	slog.Info("replica promoted", "db_path", dbPath, "sequence", manifest.Sequence, "taken_at", manifest.TakenAt, "kept_as", keptAs)
+	return manifest, keptAs, nil
+}
+
+// Runs SQLite's integrity check on the database at the given path
+func CheckDatabaseIntegrity(path string) error {
+	conn, err := db.Open("file:" + path + "?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	rows, err := conn.Query("PRAGMA integrity_check")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	problems := []string{}
+	for rows.Next() {
+		var problem string
+		if err := rows.Scan(&problem); err != nil {
+			return err
+		}
+		if problem != "ok" {
+			problems = append(problems, problem)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func fileSha256(path string) (sum string, size int64, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if size, err = io.Copy(hash, file); err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), size, nil
+}
+
+func copyFile(from, to string) error {
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(to)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Sync(); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+// Checks a snapshot's checksum header is a SHA-256 in hex
+func IsSha256Hex(str string) bool {
+	if len(str) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(str)
+	return err == nil
+}
@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"context"
+	"log/slog"
+)
+
+type requestIdKey struct{}
+
+// Carries the ID of the request the context belongs to, see RequestId
+func WithRequestId(ctx context.Context, requestId string) context.Context {
+	return context.WithValue(ctx, requestIdKey{}, requestId)
+}
+
+// Gets the ID of the request the context belongs to, "" outside of requests
+func RequestId(ctx context.Context) string {
+	requestId, _ := ctx.Value(requestIdKey{}).(string)
+	return requestId
+}
+
+// Adds the "request_id" of the request a line is logged for, e.g. with slog.ErrorContext(r.Context(), ...), so the
+// lines of one request can be found together
+type requestLogHandler struct {
+	slog.Handler
+}
+
+func NewRequestLogHandler(handler slog.Handler) slog.Handler {
+	return requestLogHandler{handler}
+}
+
+func (h requestLogHandler) Handle(ctx context.Context, record slog.Record) error {
+	if requestId := RequestId(ctx); requestId != "" {
+		record.AddAttrs(slog.String("request_id", requestId))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h requestLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return requestLogHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h requestLogHandler) WithGroup(name string) slog.Handler {
+	return requestLogHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,93 @@
+package utils
+
+import (
+	"chemical-ledger-backend/datetime"
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/retry"
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// How often the role grants that ran out are recorded as expired
+const ROLE_GRANT_INTERVAL = 5 * time.Minute
+
+// A role grant lets a user act in another role until it expires or is revoked, e.g. a technician approving as a
+// supervisor while the approver is on leave. Grants take effect on the requests of the user as they are identified,
+// so an expired grant stops applying right away; the scheduled job only records the expiry in the audit trail.
+
+// Gives the user the role of their active grant, if any, keeping their own role as "BaseRole"
+func ApplyRoleGrant(ctx context.Context, user *User) error {
+	var role string
+	var expiresAt int64
+	err := retry.Once(func() error {
+		err := db.ConnFrom(ctx).QueryRowContext(ctx, `
+			SELECT role, expires_at FROM role_grant
+			WHERE user_id = ? AND revoked_at IS NULL AND expires_at > ?
+			ORDER BY granted_at DESC
+			LIMIT 1`,
+			user.Id, datetime.Now(ctx).Unix(),
+		).Scan(&role, &expiresAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			role = ""
+			return nil
+		}
+		return err
+	})
+	if err != nil || role == "" {
+		return err
+	}
+
+	user.BaseRole, user.Role = user.Role, role
+	user.ElevatedUntil = time.Unix(expiresAt, 0).Local().Format("2006-01-02 15:04:05")
+	return nil
+}
+
+// Records the role grants that ran out since the last run as expired, each in the audit trail
+func ExpireRoleGrants(ctx context.Context) error {
+	now := datetime.Now(ctx).Unix()
+	rows, err := db.ConnFrom(ctx).QueryContext(ctx,
+		"SELECT id, user_id, role FROM role_grant WHERE revoked_at IS NULL AND expired_at IS NULL AND expires_at <= ?", now,
+	)
+	if err != nil {
+		return err
+	}
+
+	type expiredGrant struct{ id, userId, role string }
+	expired := []expiredGrant{}
+	for rows.Next() {
+		var g expiredGrant
+		if err := rows.Scan(&g.id, &g.userId, &g.role); err != nil {
+			rows.Close()
+			return err
+		}
+		expired = append(expired, g)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, g := range expired {
+		if _, err := db.ConnFrom(ctx).ExecContext(ctx, "UPDATE role_grant SET expired_at = ? WHERE id = ?", now, g.id); err != nil {
+			return err
+		}
+		slog.InfoContext(ctx, "role grant expired", "role_grant_id", g.id, "user_id", g.userId, "role", g.role)
+		RecordAudit(ctx, nil, AUDIT_ACTOR_SYSTEM, "role_grant.expire", AUDIT_TARGET_ROLE_GRANT, g.id, map[string]any{
+			"user_id": g.userId,
+			"role":    g.role,
+		})
+	}
+	return nil
+}
+
+// Records expired role grants every ROLE_GRANT_INTERVAL, and once right away, in the database of every tenant in
+// multi-tenant mode
+func StartRoleGrantExpiry(ctx context.Context) {
+	job := func() error { return db.EachDatabase(ctx, ExpireRoleGrants) }
+
+	subsystem := ScheduleJob("role-grants", ROLE_GRANT_INTERVAL, job)
+	go subsystem.Run(job)
+}
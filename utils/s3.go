@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Bucket on an S3-compatible object store (AWS S3, MinIO, Cloudflare R2, ...), addressed path-style as
+// <endpoint>/<bucket>/<key> so it works with servers that have no per-bucket DNS
+type S3Bucket struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+}
+
+var s3Client = &http.Client{Timeout: 30 * time.Second}
+
+// Uploads the given object, replacing any object with the same key. Requests are signed with AWS Signature V4.
+func (b *S3Bucket) PutObject(key, contentType, cacheControl string, body []byte) error {
+	endpoint, err := url.Parse(strings.TrimRight(b.Endpoint, "/"))
+	if err != nil {
+		return fmt.Errorf("invalid S3 endpoint: %w", err)
+	}
+	objectURL := endpoint.JoinPath(b.Bucket, key)
+
+	req, err := http.NewRequest(http.MethodPut, objectURL.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if cacheControl != "" {
+		req.Header.Set("Cache-Control", cacheControl)
+	}
+	b.sign(req, body, time.Now().UTC())
+
+	resp, err := s3Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("S3 upload of %s failed with status %d: %s", key, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+func (b *S3Bucket) sign(req *http.Request, body []byte, now time.Time) {
+	region := b.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("Host", req.URL.Host)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := []string{"cache-control", "content-type", "host", "x-amz-content-sha256", "x-amz-date"}
+	if req.Header.Get("Cache-Control") == "" {
+		signedHeaders = signedHeaders[1:]
+	}
+	var canonicalHeaders strings.Builder
+	for _, h := range signedHeaders {
+		canonicalHeaders.WriteString(h + ":" + strings.TrimSpace(req.Header.Get(h)) + "\n")
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		strings.Join(signedHeaders, ";"),
+		payloadHash,
+	}, "\n")
+
+	scope := day + "/" + region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+b.SecretKey), day)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		b.AccessKey, scope, strings.Join(signedHeaders, ";"), signature))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,28 @@
+package utils
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// Runs the given job every interval in the background. Each job is its own subsystem, so a failing job trips
+// its circuit breaker and shows up in the diagnostics instead of affecting the rest of the application.
+func ScheduleJob(name string, interval time.Duration, job func() error) *Subsystem {
+	subsystem := RegisterSubsystem("scheduler:" + name)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			err := subsystem.Run(job)
+			if errors.Is(err, ErrCircuitOpen) {
+				slog.Warn("skipping scheduled job, circuit open", "job", name)
+			}
+		}
+	}()
+
+	slog.Info("scheduled job", "job", name, "interval", interval.String())
+	return subsystem
+}
@@ -0,0 +1,167 @@
+package utils
+
+import (
+	"chemical-ledger-backend/db"
+	"context"
+	"database/sql/driver"
+	"strings"
+	"time"
+)
+
+const (
+	// Rows a console query returns unless it asks for fewer
+	SQL_CONSOLE_DEFAULT_ROWS = 100
+	// Most rows a console query can return
+	SQL_CONSOLE_MAX_ROWS = 1000
+	// Longest a console query may run before it is interrupted
+	SQL_CONSOLE_TIMEOUT = 10 * time.Second
+)
+
+// Whether admins may run read-only queries against the database, see RunReadOnlyQuery. Off unless SQL_CONSOLE is set.
+func SqlConsoleEnabled() bool {
+	return GetEnvBool("SQL_CONSOLE", false)
+}
+
+// Result of a console query: its columns and at most the rows asked for, "truncated" when there were more
+type QueryResult struct {
+	Columns   []string `json:"columns"`
+	Rows      [][]any  `json:"rows"`
+	Truncated bool     `json:"truncated"`
+}
+
+// Checks that a query is a single SELECT, or a WITH leading to one, ignoring comments and a trailing semicolon.
+// Returns the query to run.
+func CheckReadOnlyQuery(query string) (string, ErrorMessage) {
+	code := stripSqlComments(query)
+	code = strings.TrimSpace(code)
+	code = strings.TrimSpace(strings.TrimSuffix(code, ";"))
+	if code == "" {
+		return "", SQL_QUERY_NOT_SELECT
+	}
+	if containsStatementSeparator(code) {
+		return "", SQL_QUERY_NOT_SINGLE
+	}
+
+	words := strings.FieldsFunc(code, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z')
+	})
+	if len(words) == 0 || !strings.EqualFold(words[0], "SELECT") && !strings.EqualFold(words[0], "WITH") {
+		return "", SQL_QUERY_NOT_SELECT
+	}
+	return code, NO_ERR
+}
+
+// Runs a query checked by CheckReadOnlyQuery on a connection switched to query_only, so that SQLite itself refuses
+// any change the check let through, e.g. a WITH leading to a DELETE. Queries are interrupted after
+// SQL_CONSOLE_TIMEOUT and return at most "limit" rows, bounded by SQL_CONSOLE_MAX_ROWS. Text comes back as strings.
+func RunReadOnlyQuery(ctx context.Context, query string, limit int) (*QueryResult, error) {
+	if limit <= 0 {
+		limit = SQL_CONSOLE_DEFAULT_ROWS
+	}
+	limit = min(limit, SQL_CONSOLE_MAX_ROWS)
+
+	ctx, cancel := context.WithTimeout(ctx, SQL_CONSOLE_TIMEOUT)
+	defer cancel()
+
+	conn, err := db.ConnFrom(ctx).Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "PRAGMA query_only = ON"); err != nil {
+		return nil, err
+	}
+	// The connection goes back to the pool, where it must take changes again, or else be closed
+	defer func() {
+		if _, err := conn.ExecContext(context.Background(), "PRAGMA query_only = OFF"); err != nil {
+			conn.Raw(func(any) error { return driver.ErrBadConn })
+		}
+	}()
+
+	rows, err := conn.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &QueryResult{Columns: columns, Rows: [][]any{}}
+	for rows.Next() {
+		if len(result.Rows) == limit {
+			result.Truncated = true
+			break
+		}
+		values := make([]any, len(columns))
+		pointers := make([]any, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+		for i, value := range values {
+			if raw, ok := value.([]byte); ok {
+				values[i] = string(raw)
+			}
+		}
+		result.Rows = append(result.Rows, values)
+	}
+	return result, rows.Err()
+}
+
+// Removes the -- and /* */ comments of a query, leaving string literals and quoted names alone
+func stripSqlComments(query string) string {
+	var code strings.Builder
+	for i := 0; i < len(query); i++ {
+		switch {
+		case query[i] == '\'' || query[i] == '"' || query[i] == '`':
+			end := strings.IndexByte(query[i+1:], query[i])
+			if end == -1 {
+				code.WriteString(query[i:])
+				return code.String()
+			}
+			code.WriteString(query[i : i+end+2])
+			i += end + 1
+		case strings.HasPrefix(query[i:], "--"):
+			end := strings.IndexByte(query[i:], '\n')
+			if end == -1 {
+				return code.String()
+			}
+			i += end - 1
+			code.WriteByte(' ')
+		case strings.HasPrefix(query[i:], "/*"):
+			end := strings.Index(query[i+2:], "*/")
+			if end == -1 {
+				return code.String()
+			}
+			i += end + 3
+			code.WriteByte(' ')
+		default:
+			code.WriteByte(query[i])
+		}
+	}
+	return code.String()
+}
+
+// Whether a query without comments has a semicolon outside its string literals and quoted names
+func containsStatementSeparator(code string) bool {
+	var quote byte
+	for i := 0; i < len(code); i++ {
+		switch {
+		case quote != 0:
+			if code[i] == quote {
+				quote = 0
+			}
+		case code[i] == '\'' || code[i] == '"' || code[i] == '`':
+			quote = code[i]
+		case code[i] == ';':
+			return true
+		}
+	}
+	return false
+}
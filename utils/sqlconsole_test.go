@@ -0,0 +1,42 @@
+package utils_test
+
+import (
+	"chemical-ledger-backend/testutils"
+	"chemical-ledger-backend/utils"
+	"testing"
+	"time"
+)
+
+func TestReadOnlyQueriesCannotChangeTheDatabase(t *testing.T) {
+	t.Parallel()
+	env := testutils.NewEnv(t, time.Date(2026, 3, 14, 10, 0, 0, 0, time.Local))
+	env.InsertCompound("C_1", "Acetone", "ml")
+	// A single connection, so the changes below run on the one the console used
+	env.DB.SetMaxOpenConns(1)
+
+	for query, want := range map[string]utils.ErrorMessage{
+		"SELECT name FROM compound; -- list":                                utils.NO_ERR,
+		"/* names */ with c AS (SELECT name FROM compound) SELECT * FROM c": utils.NO_ERR,
+		"SELECT ';' AS separator":                                           utils.NO_ERR,
+		"DELETE FROM compound":                                              utils.SQL_QUERY_NOT_SELECT,
+		"SELECT 1; DELETE FROM compound":                                    utils.SQL_QUERY_NOT_SINGLE,
+		"-- only a comment":                                                 utils.SQL_QUERY_NOT_SELECT,
+	} {
+		if _, errStr := utils.CheckReadOnlyQuery(query); errStr != want {
+			t.Errorf("CheckReadOnlyQuery(%q) = %q, want %q", query, errStr, want)
+		}
+	}
+
+	// A WITH leading to a change gets past the check, but not past SQLite
+	if _, err := utils.RunReadOnlyQuery(env.Context(), "WITH c AS (SELECT 1) DELETE FROM compound", 0); err == nil {
+		t.Errorf("change through a WITH query was run")
+	}
+	result, err := utils.RunReadOnlyQuery(env.Context(), "SELECT id, name FROM compound", 0)
+	if err != nil || len(result.Rows) != 1 || result.Rows[0][1] != "Acetone" {
+		t.Fatalf("query after a refused change: %+v, %v", result, err)
+	}
+
+	if _, err := env.DB.Exec("UPDATE compound SET notes = 'checked' WHERE id = 'C_1'"); err != nil {
+		t.Errorf("connection left read-only: %v", err)
+	}
+}
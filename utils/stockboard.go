@@ -0,0 +1,207 @@
+package utils
+
+import (
+	"bytes"
+	"chemical-ledger-backend/datetime"
+	"chemical-ledger-backend/db"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Availability shown for a compound on the public stock board
+const (
+	STOCK_BOARD_AVAILABLE    = "available"
+	STOCK_BOARD_LOW          = "low"
+	STOCK_BOARD_OUT_OF_STOCK = "out of stock"
+
+	STOCK_BOARD_JSON_FILE = "stock.json"
+	STOCK_BOARD_HTML_FILE = "index.html"
+)
+
+// Read-only stock snapshot published for the notice board. It holds names and stock only, no IDs, parties or prices.
+type StockBoard struct {
+	GeneratedAt string            `json:"generated_at"`
+	Compounds   []StockBoardEntry `json:"compounds"`
+}
+
+type StockBoardEntry struct {
+	Name     string `json:"name"`
+	Scale    string `json:"scale"`
+	NetStock int    `json:"net_stock"`
+	Status   string `json:"status"`
+}
+
+// Where the stock board is published, read from the environment. STOCK_BOARD_DIR writes the files to a local
+// directory, STOCK_BOARD_S3_ENDPOINT with STOCK_BOARD_S3_BUCKET, STOCK_BOARD_S3_ACCESS_KEY, STOCK_BOARD_S3_SECRET_KEY
+// and optionally STOCK_BOARD_S3_REGION uploads them to an S3-compatible bucket. Both can be set.
+type StockBoardTarget struct {
+	Dir string
+	S3  *S3Bucket
+}
+
+func GetStockBoardTarget() StockBoardTarget {
+	target := StockBoardTarget{Dir: os.Getenv("STOCK_BOARD_DIR")}
+	if endpoint := os.Getenv("STOCK_BOARD_S3_ENDPOINT"); endpoint != "" {
+		target.S3 = &S3Bucket{
+			Endpoint:  endpoint,
+			Region:    os.Getenv("STOCK_BOARD_S3_REGION"),
+			Bucket:    os.Getenv("STOCK_BOARD_S3_BUCKET"),
+			AccessKey: os.Getenv("STOCK_BOARD_S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("STOCK_BOARD_S3_SECRET_KEY"),
+		}
+	}
+	return target
+}
+
+func (t StockBoardTarget) Enabled() bool {
+	return t.Dir != "" || t.S3 != nil
+}
+
+// Schedules the stock board export every STOCK_BOARD_INTERVAL_MINUTES (default 60) and runs it once right away,
+// so the board is there as soon as the application starts. Does nothing when no target is configured.
+func StartStockBoardExport(ctx context.Context) {
+	target := GetStockBoardTarget()
+	if !target.Enabled() {
+		return
+	}
+
+	interval := GetEnvInt("STOCK_BOARD_INTERVAL_MINUTES", 60)
+	if interval <= 0 {
+		interval = 60
+	}
+	job := func() error { return ExportStockBoard(ctx, target) }
+
+	subsystem := ScheduleJob("stock-board", time.Duration(interval)*time.Minute, job)
+	go subsystem.Run(job)
+}
+
+// Builds the current stock snapshot and publishes it as stock.json and index.html to the given target
+func ExportStockBoard(ctx context.Context, target StockBoardTarget) error {
+	board, err := GetStockBoard(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to build stock board: %w", err)
+	}
+
+	jsonData, err := json.MarshalIndent(board, "", "  ")
+	if err != nil {
+		return err
+	}
+	var html bytes.Buffer
+	if err := stockBoardTemplate.Execute(&html, board); err != nil {
+		return err
+	}
+
+	files := []struct {
+		name, contentType string
+		data              []byte
+	}{
+		{STOCK_BOARD_JSON_FILE, "application/json", jsonData},
+		{STOCK_BOARD_HTML_FILE, "text/html; charset=utf-8", html.Bytes()},
+	}
+
+	// The local files are written first so an unreachable bucket does not hold them back
+	if target.Dir != "" {
+		for _, f := range files {
+			if err := writeFileAtomic(filepath.Join(target.Dir, f.name), f.data); err != nil {
+				return err
+			}
+		}
+	}
+	if target.S3 != nil {
+		for _, f := range files {
+			// The board changes every interval, so caches must not hold it much longer
+			if err := target.S3.PutObject(f.name, f.contentType, "public, max-age=300", f.data); err != nil {
+				return err
+			}
+		}
+	}
+
+	slog.InfoContext(ctx, "stock board exported", "compounds", len(board.Compounds), "dir", target.Dir, "s3", target.S3 != nil)
+	return nil
+}
+
+// Gets the current stock of every compound with its availability. Compounds without a minimum stock are
+// only ever available or out of stock.
+func GetStockBoard(ctx context.Context) (*StockBoard, error) {
+	rows, err := db.ConnFrom(ctx).QueryContext(ctx, `
+		SELECT c.name, c.scale, COALESCE(s.balance, 0), c.min_stock
+		FROM compound c
+		LEFT JOIN stock_current s ON s.compound_id = c.id
+		ORDER BY c.lower_case_name ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	board := &StockBoard{
+		GeneratedAt: datetime.Now(ctx).Format("2006-01-02 15:04"),
+		Compounds:   []StockBoardEntry{},
+	}
+	for rows.Next() {
+		var entry StockBoardEntry
+		var minStock int
+		if err := rows.Scan(&entry.Name, &entry.Scale, &entry.NetStock, &minStock); err != nil {
+			return nil, err
+		}
+
+		switch {
+		case entry.NetStock <= 0:
+			entry.Status = STOCK_BOARD_OUT_OF_STOCK
+		case entry.NetStock < minStock:
+			entry.Status = STOCK_BOARD_LOW
+		default:
+			entry.Status = STOCK_BOARD_AVAILABLE
+		}
+		board.Compounds = append(board.Compounds, entry)
+	}
+	return board, rows.Err()
+}
+
+// Writes to a temporary file first and renames it, so a page reading the board never sees a half written file
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+var stockBoardTemplate = template.Must(template.New("stock-board").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta http-equiv="refresh" content="300">
+<title>Chemical stock</title>
+<style>
+body { font-family: sans-serif; margin: 2rem; }
+table { border-collapse: collapse; width: 100%; }
+th, td { padding: 0.4rem 0.8rem; border-bottom: 1px solid #ddd; text-align: left; }
+td.stock { text-align: right; }
+.low { color: #b26a00; }
+.out-of-stock { color: #b00020; }
+</style>
+</head>
+<body>
+<h1>Chemical stock</h1>
+<p>Updated {{.GeneratedAt}}</p>
+<table>
+<thead><tr><th>Compound</th><th>Stock</th><th>Availability</th></tr></thead>
+<tbody>
+{{- range .Compounds}}
+<tr><td>{{.Name}}</td><td class="stock">{{.NetStock}} {{.Scale}}</td><td class="{{if eq .Status "low"}}low{{else if eq .Status "out of stock"}}out-of-stock{{end}}">{{.Status}}</td></tr>
+{{- end}}
+</tbody>
+</table>
+</body>
+</html>
+`))
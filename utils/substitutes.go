@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Compound that can be issued instead of one out of stock
+type Substitute struct {
+	CompoundId string `json:"compound_id"`
+	Name       string `json:"name"`
+	Scale      string `json:"scale"`
+	NetStock   int    `json:"net_stock"`
+}
+
+// Most substitutes offered for one shortfall
+const MAX_SUBSTITUTES = 5
+
+// Finds the compounds that could be issued instead of the given one when it does not have the quantity: those of
+// the same category, e.g. other grades of the same solvent, measured in the same scale and holding at least the
+// quantity. The fullest come first. Compounds without a category have no substitutes, and archived compounds are
+// never one.
+func FindSubstitutes(ctx context.Context, tx *sql.Tx, compoundId string, quantity int) ([]Substitute, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT c.id, c.name, c.scale, s.balance
+		FROM compound c
+		JOIN compound o ON o.id = ?
+		JOIN stock_current s ON s.compound_id = c.id
+		WHERE c.id != o.id AND c.archived_at IS NULL
+			AND o.category != ''
+			AND c.category = o.category COLLATE NOCASE
+			AND c.scale = o.scale
+			AND s.balance >= ?
+		ORDER BY s.balance DESC, c.lower_case_name ASC
+		LIMIT ?`,
+		compoundId, quantity, MAX_SUBSTITUTES,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	substitutes := []Substitute{}
+	for rows.Next() {
+		var substitute Substitute
+		if err := rows.Scan(&substitute.CompoundId, &substitute.Name, &substitute.Scale, &substitute.NetStock); err != nil {
+			return nil, err
+		}
+		substitutes = append(substitutes, substitute)
+	}
+	return substitutes, rows.Err()
+}
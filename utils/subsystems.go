@@ -0,0 +1,161 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	SUBSYSTEM_STATE_CLOSED    = "closed"
+	SUBSYSTEM_STATE_OPEN      = "open"
+	SUBSYSTEM_STATE_HALF_OPEN = "half-open"
+
+	// Consecutive failures after which a subsystem's circuit opens
+	SUBSYSTEM_FAILURE_THRESHOLD = 3
+	// Time an open circuit waits before letting a trial call through
+	SUBSYSTEM_OPEN_DURATION = time.Minute
+)
+
+var ErrCircuitOpen = errors.New("circuit open, subsystem temporarily disabled")
+
+// Optional part of the application (email, webhooks, scheduled jobs, ...) whose failures must never
+// break the core ledger operations. Calls go through a circuit breaker and the outcome is kept for diagnostics.
+type Subsystem struct {
+	name string
+
+	mu                  sync.Mutex
+	state               string
+	consecutiveFailures int
+	totalFailures       int
+	totalSuccesses      int
+	lastError           string
+	lastFailureAt       time.Time
+	lastSuccessAt       time.Time
+	openedAt            time.Time
+}
+
+type SubsystemStatus struct {
+	Name                string `json:"name"`
+	State               string `json:"state"`
+	Healthy             bool   `json:"healthy"`
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+	TotalFailures       int    `json:"total_failures"`
+	TotalSuccesses      int    `json:"total_successes"`
+	LastError           string `json:"last_error,omitempty"`
+	LastFailureAt       string `json:"last_failure_at,omitempty"`
+	LastSuccessAt       string `json:"last_success_at,omitempty"`
+}
+
+var (
+	subsystemsMu sync.Mutex
+	subsystems   = map[string]*Subsystem{}
+)
+
+// Gets the subsystem with the given name, registering it on first use
+func RegisterSubsystem(name string) *Subsystem {
+	subsystemsMu.Lock()
+	defer subsystemsMu.Unlock()
+
+	if s, ok := subsystems[name]; ok {
+		return s
+	}
+	s := &Subsystem{name: name, state: SUBSYSTEM_STATE_CLOSED}
+	subsystems[name] = s
+	return s
+}
+
+// Runs the given function through the subsystem's circuit breaker. While the circuit is open the function
+// is not called and ErrCircuitOpen is returned. Panics are recovered and counted as failures.
+func (s *Subsystem) Run(f func() error) (err error) {
+	if !s.allow() {
+		return ErrCircuitOpen
+	}
+
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("panic: %v", rec)
+		}
+		s.record(err)
+	}()
+
+	return f()
+}
+
+func (s *Subsystem) allow() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.state == SUBSYSTEM_STATE_OPEN {
+		if time.Since(s.openedAt) < SUBSYSTEM_OPEN_DURATION {
+			return false
+		}
+		s.state = SUBSYSTEM_STATE_HALF_OPEN
+	}
+	return true
+}
+
+func (s *Subsystem) record(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err == nil {
+		s.state = SUBSYSTEM_STATE_CLOSED
+		s.consecutiveFailures = 0
+		s.totalSuccesses++
+		s.lastSuccessAt = time.Now()
+		return
+	}
+
+	s.consecutiveFailures++
+	s.totalFailures++
+	s.lastError = err.Error()
+	s.lastFailureAt = time.Now()
+	slog.Error("subsystem call failed", "subsystem", s.name, "consecutive_failures", s.consecutiveFailures, "error", err)
+
+	if s.state == SUBSYSTEM_STATE_HALF_OPEN || s.consecutiveFailures >= SUBSYSTEM_FAILURE_THRESHOLD {
+		if s.state != SUBSYSTEM_STATE_OPEN {
+			slog.Warn("subsystem circuit opened", "subsystem", s.name)
+		}
+		s.state = SUBSYSTEM_STATE_OPEN
+		s.openedAt = time.Now()
+	}
+}
+
+func (s *Subsystem) Status() SubsystemStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := SubsystemStatus{
+		Name:                s.name,
+		State:               s.state,
+		Healthy:             s.consecutiveFailures == 0,
+		ConsecutiveFailures: s.consecutiveFailures,
+		TotalFailures:       s.totalFailures,
+		TotalSuccesses:      s.totalSuccesses,
+		LastError:           s.lastError,
+	}
+	if !s.lastFailureAt.IsZero() {
+		status.LastFailureAt = s.lastFailureAt.Format(time.RFC3339)
+	}
+	if !s.lastSuccessAt.IsZero() {
+		status.LastSuccessAt = s.lastSuccessAt.Format(time.RFC3339)
+	}
+	return status
+}
+
+// Gets the status of every registered subsystem, sorted by name
+func GetSubsystemStatuses() []SubsystemStatus {
+	subsystemsMu.Lock()
+	defer subsystemsMu.Unlock()
+
+	statuses := make([]SubsystemStatus, 0, len(subsystems))
+	for _, s := range subsystems {
+		statuses = append(statuses, s.Status())
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"os"
+	"strings"
+)
+
+// Tenants hosted in multi-tenant mode, from the comma-separated TENANTS, e.g. "stmarys,oakridge". None in
+// single-tenant mode, the default.
+func TenantIds() []string {
+	ids := []string{}
+	for _, id := range strings.Split(os.Getenv("TENANTS"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// Folder the databases of the tenants are kept in, TENANT_DIR or "./info/tenants"
+func TenantDir() string {
+	if dir := os.Getenv("TENANT_DIR"); dir != "" {
+		return dir
+	}
+	return "./info/tenants"
+}
+
+// Domain whose subdomains name the tenant, e.g. "ledger.example.org" for "stmarys.ledger.example.org". Without it
+// the tenant is only read from the "X-Tenant-Id" header set by the TrustedProxies.
+func TenantDomain() string {
+	return strings.ToLower(strings.Trim(os.Getenv("TENANT_DOMAIN"), "."))
+}
+
+// How many tenant databases are kept open at most, TENANT_MAX_OPEN (default 16)
+func TenantMaxOpen() int {
+	return GetEnvInt("TENANT_MAX_OPEN", 16)
+}
@@ -0,0 +1,15 @@
+package utils
+
+import "time"
+
+// Time a request gets before its queries are canceled, REQUEST_TIMEOUT_SECONDS (default 30). 0 lets requests run as
+// long as they take.
+func RequestTimeout() time.Duration {
+	return time.Duration(max(GetEnvInt("REQUEST_TIMEOUT_SECONDS", 30), 0)) * time.Second
+}
+
+// Time the routes that go through the whole ledger get instead, e.g. imports, exports and rebuilding the stock,
+// LONG_REQUEST_TIMEOUT_SECONDS (default 600). 0 lets them run as long as they take.
+func LongRequestTimeout() time.Duration {
+	return time.Duration(max(GetEnvInt("LONG_REQUEST_TIMEOUT_SECONDS", 600), 0)) * time.Second
+}
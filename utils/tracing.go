@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"context"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Name traces are reported under unless OTEL_SERVICE_NAME is set
+const TRACING_SERVICE_NAME = "chemical-ledger"
+
+// Whether traces are sent, which is when an OTLP endpoint is configured with OTEL_EXPORTER_OTLP_ENDPOINT or
+// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT and OTEL_SDK_DISABLED is not set
+func TracingEnabled() bool {
+	if GetEnvBool("OTEL_SDK_DISABLED", false) {
+		return false
+	}
+	return os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != ""
+}
+
+// Sends the spans of requests, their queries and stock recalculations to the OTLP/HTTP collector configured with
+// the usual OTEL_* variables, e.g. OTEL_EXPORTER_OTLP_ENDPOINT, OTEL_EXPORTER_OTLP_HEADERS, OTEL_TRACES_SAMPLER and
+// OTEL_RESOURCE_ATTRIBUTES. Does nothing unless TracingEnabled; the spans then cost next to nothing. Incoming
+// "traceparent" headers are followed, so a trace started by a proxy continues here.
+func StartTracing(ctx context.Context) error {
+	if !TracingEnabled() {
+		return nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return err
+	}
+	res, err := resource.Merge(
+		resource.NewSchemaless(
+			attribute.String("service.name", TRACING_SERVICE_NAME),
+			attribute.String("service.version", GetBuildInfo().Commit),
+		),
+		// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES take precedence
+		resource.Environment(),
+	)
+	if err != nil {
+		return err
+	}
+
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res)))
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return nil
+}
@@ -0,0 +1,124 @@
+package utils
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/retry"
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Unit a quantity can be given in, a compound measured in or shown in. Units are kept in the "unit" table, which
+// starts with mg, g, kg, ml and l: each measures a kind of quantity (mass or volume), one of it being
+// Multiplier/Divisor of the base unit of its kind, g or ml. Quantities of one kind are converted between its units,
+// those of the other kind refused.
+type QuantityUnit struct {
+	Name       string `json:"name"`
+	Kind       string `json:"kind"`
+	Multiplier int    `json:"multiplier"`
+	Divisor    int    `json:"divisor"`
+}
+
+// Other ways users write the units, compared in lower case without dots, e.g. "Ltr." or "gms"
+var quantityUnitAliases = map[string]string{
+	"milligram": "mg", "milligrams": "mg", "mgs": "mg",
+	"gram": "g", "grams": "g", "gm": "g", "gms": "g", "gr": "g",
+	"kilogram": "kg", "kilograms": "kg", "kgs": "kg", "kilo": "kg", "kilos": "kg",
+	"millilitre": "ml", "millilitres": "ml", "milliliter": "ml", "milliliters": "ml", "mls": "ml", "cc": "ml",
+	"litre": "l", "litres": "l", "liter": "l", "liters": "l", "ltr": "l", "ltrs": "l", "lt": "l",
+}
+
+// Gets the unit with the given short name, nil when there is none
+func GetQuantityUnit(ctx context.Context, name string) (*QuantityUnit, error) {
+	unit := &QuantityUnit{Name: name}
+	err := retry.Once(func() error {
+		err := db.ConnFrom(ctx).QueryRowContext(ctx, "SELECT kind, multiplier, divisor FROM unit WHERE name = ?", name).Scan(&unit.Kind, &unit.Multiplier, &unit.Divisor)
+		if err == sql.ErrNoRows {
+			unit = nil
+			return nil
+		}
+		return err
+	})
+	return unit, err
+}
+
+// Reads a quantity unit the way users write it, nil when it is not a known unit
+func ParseQuantityUnit(ctx context.Context, text string) (*QuantityUnit, error) {
+	name := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(text), ".", ""))
+	if alias, ok := quantityUnitAliases[name]; ok {
+		name = alias
+	}
+	return GetQuantityUnit(ctx, name)
+}
+
+// Converts a quantity in the given unit to the scale (unit) a compound is measured in. Quantities of the other kind
+// are refused with an error naming both units, and those that do not come to a whole number in the scale, e.g.
+// 1500 mg in g, with one naming the value.
+func ConvertToScale(quantity int, unit *QuantityUnit, scale *QuantityUnit) (int, ErrorMessage) {
+	if unit.Kind != scale.Kind {
+		return 0, ErrorMessage(fmt.Sprintf("%s (the quantity is in %s, the compound is measured in %s)", UNIT_SCALE_MISMATCH, unit.Name, scale.Name))
+	}
+	multiplier, divisor := unit.Multiplier*scale.Divisor, unit.Divisor*scale.Multiplier
+	if quantity*multiplier%divisor != 0 {
+		return 0, ErrorMessage(fmt.Sprintf("%s (%d %s is not a whole number of %s)", UNIT_CONVERSION_ERR, quantity, unit.Name, scale.Name))
+	}
+	return quantity * multiplier / divisor, NO_ERR
+}
+
+// Shows a quantity kept in the scale of its compound in another unit of the same kind, rounded to 3 decimals, e.g.
+// 1250 g as 1.25 kg
+func ConvertFromScale(quantity int, scale *QuantityUnit, unit *QuantityUnit) float64 {
+	multiplier, divisor := scale.Multiplier*unit.Divisor, scale.Divisor*unit.Multiplier
+	return math.Round(float64(quantity)*float64(multiplier)/float64(divisor)*1000) / 1000
+}
+
+// Unit a compound is measured in and the one it is shown in
+type CompoundUnits struct {
+	Scale   QuantityUnit
+	Display QuantityUnit
+}
+
+// Gets the units of each compound with a display unit, by compound ID
+func GetDisplayUnits(ctx context.Context) (map[string]CompoundUnits, error) {
+	rows, err := db.ConnFrom(ctx).QueryContext(ctx, `
+		SELECT c.id, s.name, s.kind, s.multiplier, s.divisor, d.name, d.kind, d.multiplier, d.divisor
+		FROM compound c
+		JOIN unit s ON s.name = c.scale
+		JOIN unit d ON d.name = c.display_unit`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	units := map[string]CompoundUnits{}
+	for rows.Next() {
+		var compoundId string
+		var u CompoundUnits
+		if err := rows.Scan(&compoundId, &u.Scale.Name, &u.Scale.Kind, &u.Scale.Multiplier, &u.Scale.Divisor, &u.Display.Name, &u.Display.Kind, &u.Display.Multiplier, &u.Display.Divisor); err != nil {
+			return nil, err
+		}
+		units[compoundId] = u
+	}
+	return units, rows.Err()
+}
+
+// Gets every unit, by kind and then from the smallest
+func GetQuantityUnits(ctx context.Context) ([]QuantityUnit, error) {
+	rows, err := db.ConnFrom(ctx).QueryContext(ctx, "SELECT name, kind, multiplier, divisor FROM unit ORDER BY kind ASC, CAST(multiplier AS REAL) / divisor ASC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	units := []QuantityUnit{}
+	for rows.Next() {
+		var unit QuantityUnit
+		if err := rows.Scan(&unit.Name, &unit.Kind, &unit.Multiplier, &unit.Divisor); err != nil {
+			return nil, err
+		}
+		units = append(units, unit)
+	}
+	return units, rows.Err()
+}
@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"chemical-ledger-backend/db"
+	"context"
+	"errors"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+)
+
+// How often the usage counted in memory is written to the usage_metric table
+const USAGE_FLUSH_INTERVAL = time.Minute
+
+// Query parameters whose value is recorded along with their name, as it selects a feature (a report format,
+// a grouping, ...) rather than identifying records. Other parameters are only recorded as used.
+var UsageParamValues = []string{"format", "groupBy", "transactions", "entry_type", "status", "dry_run", "voucher_match", "include", "sort", "order", "interval"}
+
+// Usage is counted per tenant in multi-tenant mode, and kept in the tenant's own database
+type usageKey struct {
+	tenant, day, endpoint, feature, role string
+}
+
+var (
+	usageMu     sync.Mutex
+	usageCounts = map[usageKey]int{}
+)
+
+// Counts a call to an endpoint (method and route pattern, e.g. "GET /get-entry") by a user of the given role,
+// along with the query parameters it used. Only counts are kept, never the values identifying records or users.
+func RecordUsage(ctx context.Context, endpoint, role string, query url.Values) {
+	tenant, day := db.TenantFrom(ctx), time.Now().Format("2006-01-02")
+
+	usageMu.Lock()
+	defer usageMu.Unlock()
+
+	usageCounts[usageKey{tenant, day, endpoint, "", role}]++
+	for param, values := range query {
+		if len(values) == 0 || values[0] == "" {
+			continue
+		}
+		feature := "param:" + param
+		if slices.Contains(UsageParamValues, param) {
+			feature += "=" + values[0]
+		}
+		usageCounts[usageKey{tenant, day, endpoint, feature, role}]++
+	}
+}
+
+// Writes the usage counted since the last flush to the database, that of each tenant in multi-tenant mode. On
+// failure the counts are kept for the next one.
+func FlushUsage(ctx context.Context) error {
+	usageMu.Lock()
+	counts := usageCounts
+	usageCounts = map[usageKey]int{}
+	usageMu.Unlock()
+
+	byTenant := map[string]map[usageKey]int{}
+	for key, count := range counts {
+		if byTenant[key.tenant] == nil {
+			byTenant[key.tenant] = map[usageKey]int{}
+		}
+		byTenant[key.tenant][key] = count
+	}
+
+	var errs []error
+	for tenant, counts := range byTenant {
+		write := func(ctx context.Context) error { return writeUsage(ctx, counts) }
+		var err error
+		if tenants := db.TenantsFrom(ctx); tenant != "" && tenants != nil {
+			err = tenants.Run(ctx, tenant, write)
+		} else {
+			err = write(ctx)
+		}
+		if err != nil {
+			errs = append(errs, err)
+			usageMu.Lock()
+			for key, count := range counts {
+				usageCounts[key] += count
+			}
+			usageMu.Unlock()
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func writeUsage(ctx context.Context, counts map[usageKey]int) error {
+	tx, err := db.ConnFrom(ctx).BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for key, count := range counts {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO usage_metric (day, endpoint, feature, role, count) VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT(day, endpoint, feature, role) DO UPDATE SET count = count + excluded.count`,
+			key.day, key.endpoint, key.feature, key.role, count,
+		); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Flushes the usage metrics to the database in the background
+func StartUsageMetrics(ctx context.Context) {
+	ScheduleJob("usage-metrics", USAGE_FLUSH_INTERVAL, func() error { return FlushUsage(ctx) })
+}
@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/retry"
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+)
+
+const (
+	ROLE_ADMIN      = "admin"
+	ROLE_SUPERVISOR = "supervisor"
+	ROLE_OPERATOR   = "operator"
+	ROLE_TECHNICIAN = "technician"
+	ROLE_AUDITOR    = "auditor"
+	ROLE_STUDENT    = "student"
+
+	// Built-in administrator used for requests that do not identify a user, i.e. the desktop frontend
+	LOCAL_USER_ID = "U_local"
+)
+
+var Roles = []string{ROLE_ADMIN, ROLE_SUPERVISOR, ROLE_OPERATOR, ROLE_TECHNICIAN, ROLE_AUDITOR, ROLE_STUDENT}
+
+type User struct {
+	Id           string `json:"id"`
+	Name         string `json:"name"`
+	Role         string `json:"role"`
+	SupervisorId string `json:"supervisor_id"`
+	Active       bool   `json:"active"`
+	// While a role grant is active, "role" is the granted role, "base_role" the user's own and "elevated_until"
+	// the time the grant expires, see ApplyRoleGrant
+	BaseRole      string `json:"base_role,omitempty"`
+	ElevatedUntil string `json:"elevated_until,omitempty"`
+}
+
+func IsValidRole(role string) bool {
+	return slices.Contains(Roles, role)
+}
+
+// Whether entries recorded by users of the given role wait as pending until an approver reviews them.
+// Only admins and supervisors record entries that count towards the stock straight away.
+func EntryNeedsApproval(role string) bool {
+	return role != ROLE_ADMIN && role != ROLE_SUPERVISOR
+}
+
+// Gets the user with the given ID, returning nil when there is none
+func GetUser(ctx context.Context, userId string) (*User, error) {
+	user := &User{}
+	err := retry.Once(func() error {
+		err := db.ConnFrom(ctx).QueryRowContext(ctx,
+			"SELECT id, name, role, COALESCE(supervisor_id, ''), active FROM user WHERE id = ?", userId,
+		).Scan(&user.Id, &user.Name, &user.Role, &user.SupervisorId, &user.Active)
+		if errors.Is(err, sql.ErrNoRows) {
+			user = nil
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"chemical-ledger-backend/db"
+	"chemical-ledger-backend/retry"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+)
+
+// Users other than the local administrator prove who they are with a token an admin issued them. Only the SHA-256
+// of each token is kept, so tokens cannot be read back from the database or its backups.
+
+// Random bytes in a token, hex encoded when handed out
+const USER_TOKEN_BYTES = 32
+
+// Makes a new token, to be handed out once and kept by its hash
+func NewUserToken() (string, error) {
+	raw := make([]byte, USER_TOKEN_BYTES)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(raw), nil
+}
+
+// Hash a token is kept and looked up by
+func HashUserToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Gets the ID of the user the given token was issued to, empty when it is unknown or revoked
+func GetTokenUserId(ctx context.Context, token string) (string, error) {
+	var userId string
+	err := retry.Once(func() error {
+		err := db.ConnFrom(ctx).QueryRowContext(ctx,
+			"SELECT user_id FROM user_token WHERE token_hash = ? AND revoked_at IS NULL", HashUserToken(token),
+		).Scan(&userId)
+		if errors.Is(err, sql.ErrNoRows) {
+			userId = ""
+			return nil
+		}
+		return err
+	})
+	return userId, err
+}
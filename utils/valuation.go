@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"log/slog"
+	"os"
+)
+
+// Values of VALUATION_METHOD
+const (
+	VALUATION_AVERAGE = "average"
+	VALUATION_FIFO    = "fifo"
+)
+
+// How the stock is valued, set with VALUATION_METHOD: "average" (the default) at the moving weighted average cost
+// of the deliveries, "fifo" at the cost of the lots the stock is left in, which are drawn oldest first
+func ValuationMethod() string {
+	switch method := os.Getenv("VALUATION_METHOD"); method {
+	case "":
+		return VALUATION_AVERAGE
+	case VALUATION_AVERAGE, VALUATION_FIFO:
+		return method
+	default:
+		slog.Warn("invalid valuation method, using default", "value", method, "default", VALUATION_AVERAGE)
+		return VALUATION_AVERAGE
+	}
+}
+
+func IsValidValuationMethod(method string) bool {
+	return method == VALUATION_AVERAGE || method == VALUATION_FIFO
+}
@@ -0,0 +1,358 @@
+package utils
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Limits of Excel sheet names and column widths
+const (
+	XLSX_MAX_SHEET_NAME   = 31
+	XLSX_MAX_COLUMN_WIDTH = 60
+)
+
+// Minimal xlsx workbook writer. Cells hold strings or numbers, the first row of every sheet is set in bold
+// as its header. Strings are written inline so no shared string table is needed.
+type XLSX struct {
+	sheets []*XLSXSheet
+}
+
+type XLSXSheet struct {
+	name string
+	rows [][]any
+}
+
+func NewXLSX() *XLSX {
+	return &XLSX{}
+}
+
+// Adds a sheet with the given header row. The name is cut down to what Excel accepts and made unique.
+func (x *XLSX) AddSheet(name string, header ...string) *XLSXSheet {
+	name = x.uniqueSheetName(name)
+	row := make([]any, len(header))
+	for i, h := range header {
+		row[i] = h
+	}
+	sheet := &XLSXSheet{name: name, rows: [][]any{row}}
+	x.sheets = append(x.sheets, sheet)
+	return sheet
+}
+
+func (s *XLSXSheet) AddRow(cells ...any) {
+	s.rows = append(s.rows, cells)
+}
+
+// Writes the workbook as a zip archive
+func (x *XLSX) Write(w io.Writer) error {
+	zw := zip.NewWriter(w)
+
+	sheetTypes := &strings.Builder{}
+	sheetEntries := &strings.Builder{}
+	sheetRels := &strings.Builder{}
+	for i, sheet := range x.sheets {
+		fmt.Fprintf(sheetTypes, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i+1)
+		fmt.Fprintf(sheetEntries, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xmlEscape(sheet.name), i+1, i+1)
+		fmt.Fprintf(sheetRels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i+1, i+1)
+	}
+
+	files := []struct {
+		name    string
+		content string
+	}{
+		{"[Content_Types].xml", xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+			sheetTypes.String() + `</Types>`},
+		{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets>` + sheetEntries.String() + `</sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			sheetRels.String() +
+			fmt.Sprintf(`<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, len(x.sheets)+1) +
+			`</Relationships>`},
+		{"xl/styles.xml", xml.Header + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+			`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+			`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+			`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+			`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+			`<cellXfs count="2"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/><xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/></cellXfs>` +
+			`</styleSheet>`},
+	}
+	for i, sheet := range x.sheets {
+		files = append(files, struct {
+			name    string
+			content string
+		}{fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1), sheet.xml()})
+	}
+
+	for _, f := range files {
+		fw, err := zw.Create(f.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(fw, f.content); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+func (s *XLSXSheet) xml() string {
+	b := &strings.Builder{}
+	b.WriteString(xml.Header)
+	b.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+
+	// Columns are sized to their longest value
+	widths := []int{}
+	for _, row := range s.rows {
+		for i, cell := range row {
+			if i >= len(widths) {
+				widths = append(widths, 0)
+			}
+			widths[i] = max(widths[i], utf8.RuneCountInString(fmt.Sprint(cell)))
+		}
+	}
+	if len(widths) > 0 {
+		b.WriteString("<cols>")
+		for i, width := range widths {
+			fmt.Fprintf(b, `<col min="%d" max="%d" width="%d" customWidth="1"/>`, i+1, i+1, min(width+2, XLSX_MAX_COLUMN_WIDTH))
+		}
+		b.WriteString("</cols>")
+	}
+
+	b.WriteString("<sheetData>")
+	for r, row := range s.rows {
+		fmt.Fprintf(b, `<row r="%d">`, r+1)
+		style := ""
+		if r == 0 {
+			style = ` s="1"`
+		}
+		for c, cell := range row {
+			ref := xlsxColumn(c) + fmt.Sprint(r+1)
+			switch v := cell.(type) {
+			case int, int64, float64:
+				fmt.Fprintf(b, `<c r="%s"%s><v>%v</v></c>`, ref, style, v)
+			default:
+				fmt.Fprintf(b, `<c r="%s"%s t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, style, xmlEscape(fmt.Sprint(v)))
+			}
+		}
+		b.WriteString("</row>")
+	}
+	b.WriteString("</sheetData></worksheet>")
+
+	return b.String()
+}
+
+// Sheet names are limited to 31 characters, cannot contain []:*?/\ and must be unique (case insensitively)
+func (x *XLSX) uniqueSheetName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	if name == "" {
+		name = "Sheet"
+	}
+
+	taken := func(candidate string) bool {
+		for _, sheet := range x.sheets {
+			if strings.EqualFold(sheet.name, candidate) {
+				return true
+			}
+		}
+		return false
+	}
+
+	candidate := truncateRunes(name, XLSX_MAX_SHEET_NAME)
+	for n := 2; taken(candidate); n++ {
+		suffix := fmt.Sprintf(" (%d)", n)
+		candidate = truncateRunes(name, XLSX_MAX_SHEET_NAME-len(suffix)) + suffix
+	}
+	return candidate
+}
+
+// Converts a zero based column index to its letters, e.g. 0 -> A, 27 -> AB
+func xlsxColumn(index int) string {
+	name := ""
+	for index >= 0 {
+		name = string(rune('A'+index%26)) + name
+		index = index/26 - 1
+	}
+	return name
+}
+
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n])
+}
+
+func xmlEscape(s string) string {
+	b := &strings.Builder{}
+	xml.EscapeText(b, []byte(s))
+	return b.String()
+}
+
+// Reads the rows of the first sheet of an xlsx workbook as text. Shared and inline strings are resolved,
+// numbers (including dates, which Excel stores as day serials) are returned as written in the file and
+// skipped cells are left empty so columns stay aligned.
+func ReadXLSXRows(r io.ReaderAt, size int64) ([][]string, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+	readXML := func(name string, v any) error {
+		f, ok := files[name]
+		if !ok {
+			return fmt.Errorf("%s missing from workbook", name)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		return xml.NewDecoder(rc).Decode(v)
+	}
+
+	var workbook struct {
+		Sheets []struct {
+			RelId string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := readXML("xl/workbook.xml", &workbook); err != nil {
+		return nil, err
+	}
+	if len(workbook.Sheets) == 0 {
+		return nil, fmt.Errorf("workbook has no sheets")
+	}
+
+	var rels struct {
+		Relationships []struct {
+			Id     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if err := readXML("xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return nil, err
+	}
+	sheetPath := ""
+	for _, rel := range rels.Relationships {
+		if rel.Id == workbook.Sheets[0].RelId {
+			if strings.HasPrefix(rel.Target, "/") {
+				sheetPath = strings.TrimPrefix(rel.Target, "/")
+			} else {
+				sheetPath = "xl/" + rel.Target
+			}
+		}
+	}
+	if sheetPath == "" {
+		return nil, fmt.Errorf("first sheet of workbook not found")
+	}
+
+	type richText struct {
+		Text string `xml:"t"`
+		Runs []struct {
+			Text string `xml:"t"`
+		} `xml:"r"`
+	}
+	plain := func(rt richText) string {
+		text := rt.Text
+		for _, run := range rt.Runs {
+			text += run.Text
+		}
+		return text
+	}
+
+	sharedStrings := []string{}
+	if _, ok := files["xl/sharedStrings.xml"]; ok {
+		var sst struct {
+			Items []richText `xml:"si"`
+		}
+		if err := readXML("xl/sharedStrings.xml", &sst); err != nil {
+			return nil, err
+		}
+		for _, item := range sst.Items {
+			sharedStrings = append(sharedStrings, plain(item))
+		}
+	}
+
+	var sheet struct {
+		Rows []struct {
+			Number int `xml:"r,attr"`
+			Cells  []struct {
+				Ref    string   `xml:"r,attr"`
+				Type   string   `xml:"t,attr"`
+				Value  string   `xml:"v"`
+				Inline richText `xml:"is"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := readXML(sheetPath, &sheet); err != nil {
+		return nil, err
+	}
+
+	rows := make([][]string, 0, len(sheet.Rows))
+	for _, row := range sheet.Rows {
+		// Empty rows are left out of the file, keep them so row numbers match what users see in Excel
+		for row.Number > 0 && len(rows) < row.Number-1 {
+			rows = append(rows, []string{})
+		}
+
+		values := []string{}
+		for i, cell := range row.Cells {
+			col := i
+			if cell.Ref != "" {
+				col = xlsxColumnIndex(cell.Ref)
+			}
+			for len(values) <= col {
+				values = append(values, "")
+			}
+
+			switch cell.Type {
+			case "s":
+				index, err := strconv.Atoi(cell.Value)
+				if err != nil || index < 0 || index >= len(sharedStrings) {
+					return nil, fmt.Errorf("cell %s refers to a missing shared string", cell.Ref)
+				}
+				values[col] = sharedStrings[index]
+			case "inlineStr":
+				values[col] = plain(cell.Inline)
+			default:
+				values[col] = cell.Value
+			}
+		}
+		rows = append(rows, values)
+	}
+
+	return rows, nil
+}
+
+// Converts a cell reference to its zero based column index, e.g. "AB12" -> 27
+func xlsxColumnIndex(ref string) int {
+	index := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		index = index*26 + int(r-'A'+1)
+	}
+	return index - 1
+}